@@ -65,4 +65,7 @@ type Response struct {
 
 	// If set, then the body contains sensitive data and should be redacted in debug log
 	TagPrintingBody bool
+
+	// content type of body. json content type is used if not set
+	ContentType string
 }
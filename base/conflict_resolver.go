@@ -0,0 +1,459 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+// defines the conflict resolvers that can be used for source side conflict resolution
+package base
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/couchbase/goxdcr/log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// metadata of a document, as carried by a setMeta request or returned by a getMeta request
+type DocumentMetadata struct {
+	key      []byte
+	revSeq   uint64 //Item revision seqno
+	cas      uint64 //Item cas
+	flags    uint32 // Item flags
+	expiry   uint32 // Item expiration time
+	deletion bool
+	dataType uint8 // item data type
+}
+
+func NewDocumentMetadata(key []byte, revSeq, cas uint64, flags, expiry uint32, deletion bool, dataType uint8) DocumentMetadata {
+	return DocumentMetadata{key: key,
+		revSeq:   revSeq,
+		cas:      cas,
+		flags:    flags,
+		expiry:   expiry,
+		deletion: deletion,
+		dataType: dataType,
+	}
+}
+
+func (doc_meta DocumentMetadata) Key() []byte {
+	return doc_meta.key
+}
+
+func (doc_meta DocumentMetadata) RevSeq() uint64 {
+	return doc_meta.revSeq
+}
+
+func (doc_meta DocumentMetadata) Cas() uint64 {
+	return doc_meta.cas
+}
+
+func (doc_meta DocumentMetadata) Flags() uint32 {
+	return doc_meta.flags
+}
+
+func (doc_meta DocumentMetadata) Expiry() uint32 {
+	return doc_meta.expiry
+}
+
+func (doc_meta DocumentMetadata) IsDeletion() bool {
+	return doc_meta.deletion
+}
+
+func (doc_meta DocumentMetadata) DataType() uint8 {
+	return doc_meta.dataType
+}
+
+func (doc_meta DocumentMetadata) String() string {
+	return fmt.Sprintf("[key=%s; revSeq=%v;cas=%v;flags=%v;expiry=%v;deletion=%v:datatype=%v]", doc_meta.key, doc_meta.revSeq, doc_meta.cas, doc_meta.flags, doc_meta.expiry, doc_meta.deletion, doc_meta.dataType)
+}
+
+func (doc_meta *DocumentMetadata) Clone() *DocumentMetadata {
+	var clone *DocumentMetadata
+	if doc_meta != nil {
+		clone = &DocumentMetadata{}
+		*clone = *doc_meta
+		clone.key = DeepCopyByteArray(doc_meta.key)
+	}
+	return clone
+}
+
+func (doc_meta *DocumentMetadata) Redact() *DocumentMetadata {
+	if doc_meta != nil {
+		if len(doc_meta.key) > 0 && !IsByteSliceRedacted(doc_meta.key) {
+			doc_meta.key = TagUDBytes(doc_meta.key)
+		}
+	}
+	return doc_meta
+}
+
+func (doc_meta *DocumentMetadata) CloneAndRedact() *DocumentMetadata {
+	if doc_meta != nil {
+		return doc_meta.Clone().Redact()
+	}
+	return doc_meta
+}
+
+// ConflictResolver decides whether a source mutation should be sent to target, given the metadata
+// of the source mutation and the metadata of the existing target document.
+// Resolvers that need document bodies or xattrs implement DocumentConflictResolver as well.
+// With ConflictResolverDefault, only documents larger than optimistic_replication_threshold go through
+// source side conflict resolution, and target memcached performs its own conflict resolution.
+// With any other resolver, every document goes through source side conflict resolution, and target
+// memcached is told to skip its own conflict resolution, so that the decision of the resolver holds.
+type ConflictResolver interface {
+	// returns true if doc_meta_source wins; false otherwise
+	Resolve(doc_meta_source DocumentMetadata, doc_meta_target DocumentMetadata,
+		source_cr_mode ConflictResolutionMode, xattrEnabled bool, logger *log.CommonLogger) bool
+}
+
+// ConflictResolverFunc allows an ordinary function to be used as a ConflictResolver
+type ConflictResolverFunc func(doc_meta_source DocumentMetadata, doc_meta_target DocumentMetadata,
+	source_cr_mode ConflictResolutionMode, xattrEnabled bool, logger *log.CommonLogger) bool
+
+func (f ConflictResolverFunc) Resolve(doc_meta_source DocumentMetadata, doc_meta_target DocumentMetadata,
+	source_cr_mode ConflictResolutionMode, xattrEnabled bool, logger *log.CommonLogger) bool {
+	return f(doc_meta_source, doc_meta_target, source_cr_mode, xattrEnabled, logger)
+}
+
+// Document is a document as seen by a DocumentConflictResolver
+type Document struct {
+	Metadata DocumentMetadata
+	// uncompressed body of document, without xattrs
+	Body []byte
+	// values of xattrs of document, keyed by xattr names.
+	// for target documents, only the xattrs named by TargetXattrs of resolver are included
+	Xattrs map[string]string
+}
+
+// DocumentConflictResolver is a ConflictResolver that decides with the bodies or xattrs of documents.
+// When the target document of a source mutation exists and is not deleted, and the source mutation is not a deletion,
+// xmem fetches the body and the xattrs named by TargetXattrs of the target document, and calls ResolveDocument.
+// Resolve is called otherwise, e.g., when the target document has been deleted or cannot be fetched.
+type DocumentConflictResolver interface {
+	ConflictResolver
+	// names of xattrs of target documents that ResolveDocument needs. there can be at most SubdocMaxPaths-1 names
+	TargetXattrs() []string
+	// returns true if source wins. When source wins, the returned xattrs, if not nil, replace the xattrs of
+	// the source mutation sent to target
+	ResolveDocument(source *Document, target *Document, source_cr_mode ConflictResolutionMode,
+		xattrEnabled bool, logger *log.CommonLogger) (bool, map[string]string)
+}
+
+var ErrorConflictResolverNameEmpty = errors.New("Conflict resolver name cannot be empty")
+var ErrorConflictResolverNil = errors.New("Conflict resolver cannot be nil")
+
+func ErrorConflictResolverAlreadyRegistered(name string) error {
+	return fmt.Errorf("Conflict resolver %v has already been registered", name)
+}
+
+func ErrorConflictResolverNotFound(name string) error {
+	return fmt.Errorf("Conflict resolver %v does not exist. Valid values are %v", name, ConflictResolverNames())
+}
+
+// registry of named conflict resolvers
+var conflictResolverRegistry = map[string]ConflictResolver{
+	ConflictResolverDefault:    ConflictResolverFunc(ResolveConflict),
+	ConflictResolverSourceWins: ConflictResolverFunc(resolveConflictSourceWins),
+	ConflictResolverTargetWins: ConflictResolverFunc(resolveConflictTargetWins),
+}
+var conflictResolverRegistryLock sync.RWMutex
+
+// parameterized conflict resolvers, which are selected with names in the form of <name>:<parameter>
+var conflictResolverFactories = map[string]func(param string) (ConflictResolver, error){
+	ConflictResolverJSONFieldWins: NewJSONFieldConflictResolver,
+	ConflictResolverMergeXattrs:   NewMergeXattrsConflictResolver,
+}
+
+// RegisterConflictResolver makes a conflict resolver available under the specified name,
+// so that it can be selected for a replication through the conflict_resolver replication setting.
+// It is expected to be called during process initialization, before replications are started.
+func RegisterConflictResolver(name string, resolver ConflictResolver) error {
+	if len(name) == 0 {
+		return ErrorConflictResolverNameEmpty
+	}
+	if resolver == nil {
+		return ErrorConflictResolverNil
+	}
+
+	conflictResolverRegistryLock.Lock()
+	defer conflictResolverRegistryLock.Unlock()
+	if _, ok := conflictResolverRegistry[name]; ok {
+		return ErrorConflictResolverAlreadyRegistered(name)
+	}
+	if _, ok := conflictResolverFactories[name]; ok {
+		return ErrorConflictResolverAlreadyRegistered(name)
+	}
+	conflictResolverRegistry[name] = resolver
+	return nil
+}
+
+// GetConflictResolver returns the conflict resolver registered under the specified name,
+// or a new parameterized conflict resolver when the name is in the form of <name>:<parameter>.
+// Empty name is treated as ConflictResolverDefault
+func GetConflictResolver(name string) (ConflictResolver, error) {
+	if len(name) == 0 {
+		name = ConflictResolverDefault
+	}
+
+	if parts := strings.SplitN(name, ConflictResolverParamDelimiter, 2); len(parts) == 2 {
+		factory, ok := conflictResolverFactories[parts[0]]
+		if !ok {
+			return nil, ErrorConflictResolverNotFound(name)
+		}
+		resolver, err := factory(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid parameter for conflict resolver %v. err=%v", parts[0], err)
+		}
+		return resolver, nil
+	}
+
+	conflictResolverRegistryLock.RLock()
+	resolver, ok := conflictResolverRegistry[name]
+	conflictResolverRegistryLock.RUnlock()
+	if !ok {
+		return nil, ErrorConflictResolverNotFound(name)
+	}
+	return resolver, nil
+}
+
+// ValidateConflictResolver checks that a conflict resolver has been registered under the specified name
+func ValidateConflictResolver(name string) error {
+	_, err := GetConflictResolver(name)
+	return err
+}
+
+// IsCustomConflictResolver returns true if the specified name refers to a resolver other than ConflictResolverDefault
+func IsCustomConflictResolver(name string) bool {
+	return len(name) > 0 && name != ConflictResolverDefault
+}
+
+// ConflictResolverNames returns the sorted names of all registered conflict resolvers,
+// with parameterized conflict resolvers listed as <name>:<parameter>
+func ConflictResolverNames() []string {
+	conflictResolverRegistryLock.RLock()
+	defer conflictResolverRegistryLock.RUnlock()
+	names := make([]string, 0, len(conflictResolverRegistry)+len(conflictResolverFactories))
+	for name, _ := range conflictResolverRegistry {
+		names = append(names, name)
+	}
+	for name, _ := range conflictResolverFactories {
+		names = append(names, name+ConflictResolverParamDelimiter+"<parameter>")
+	}
+	sort.Strings(names)
+	return names
+}
+
+//return true if doc_meta_source win; false otherwise
+func ResolveConflict(doc_meta_source DocumentMetadata, doc_meta_target DocumentMetadata,
+	source_cr_mode ConflictResolutionMode, xattrEnabled bool, logger *log.CommonLogger) bool {
+	if source_cr_mode == CRMode_LWW {
+		return resolveConflictByCAS(doc_meta_source, doc_meta_target, xattrEnabled, logger)
+	} else {
+		return resolveConflictByRevSeq(doc_meta_source, doc_meta_target, xattrEnabled, logger)
+	}
+}
+
+func resolveConflictByCAS(doc_meta_source DocumentMetadata,
+	doc_meta_target DocumentMetadata, xattrEnabled bool, logger *log.CommonLogger) bool {
+	ret := true
+	if doc_meta_target.cas > doc_meta_source.cas {
+		ret = false
+	} else if doc_meta_target.cas == doc_meta_source.cas {
+		if doc_meta_target.revSeq > doc_meta_source.revSeq {
+			ret = false
+		} else if doc_meta_target.revSeq == doc_meta_source.revSeq {
+			//if the outgoing mutation is deletion and its revSeq and cas are the
+			//same as the target side document, it would lose the conflict resolution
+			if doc_meta_source.deletion || (doc_meta_target.expiry > doc_meta_source.expiry) {
+				ret = false
+			} else if doc_meta_target.expiry == doc_meta_source.expiry {
+				if doc_meta_target.flags > doc_meta_source.flags {
+					ret = false
+				} else if doc_meta_target.flags == doc_meta_source.flags {
+					ret = resolveConflictByXattr(doc_meta_source, doc_meta_target, xattrEnabled)
+				}
+			}
+		}
+	}
+	return ret
+}
+
+func resolveConflictByRevSeq(doc_meta_source DocumentMetadata,
+	doc_meta_target DocumentMetadata, xattrEnabled bool, logger *log.CommonLogger) bool {
+	ret := true
+	if doc_meta_target.revSeq > doc_meta_source.revSeq {
+		ret = false
+	} else if doc_meta_target.revSeq == doc_meta_source.revSeq {
+		if doc_meta_target.cas > doc_meta_source.cas {
+			ret = false
+		} else if doc_meta_target.cas == doc_meta_source.cas {
+			//if the outgoing mutation is deletion and its revSeq and cas are the
+			//same as the target side document, it would lose the conflict resolution
+			if doc_meta_source.deletion || (doc_meta_target.expiry > doc_meta_source.expiry) {
+				ret = false
+			} else if doc_meta_target.expiry == doc_meta_source.expiry {
+				if doc_meta_target.flags > doc_meta_source.flags {
+					ret = false
+				} else if doc_meta_target.flags == doc_meta_source.flags {
+					ret = resolveConflictByXattr(doc_meta_source, doc_meta_target, xattrEnabled)
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// if all other metadata fields are equal, use xattr field to decide whether source mutations should win
+func resolveConflictByXattr(doc_meta_source DocumentMetadata,
+	doc_meta_target DocumentMetadata, xattrEnabled bool) bool {
+	if xattrEnabled {
+		// if target is xattr enabled, source mutation has xattr, and target mutation does not have xattr
+		// let source mutation win
+		source_has_xattr := HasXattr(doc_meta_source.dataType)
+		target_has_xattr := HasXattr(doc_meta_target.dataType)
+		return source_has_xattr && !target_has_xattr
+	} else {
+		// if target is not xattr enabled, target mutation always does not have xattr
+		// do not have let source mutation win even if source mutation has xattr,
+		// otherwise source mutations need to be repeatly re-sent in backfill mode
+		return false
+	}
+}
+
+// source mutation always wins and is always sent to target
+func resolveConflictSourceWins(doc_meta_source DocumentMetadata, doc_meta_target DocumentMetadata,
+	source_cr_mode ConflictResolutionMode, xattrEnabled bool, logger *log.CommonLogger) bool {
+	return true
+}
+
+// existing target document always wins and source mutation is never sent to target
+func resolveConflictTargetWins(doc_meta_source DocumentMetadata, doc_meta_target DocumentMetadata,
+	source_cr_mode ConflictResolutionMode, xattrEnabled bool, logger *log.CommonLogger) bool {
+	return false
+}
+
+// jsonFieldConflictResolver lets the document with the higher numeric value in a json field win.
+// When either document does not have a numeric value in the field, or the values are equal, it resolves
+// conflicts the same way as ConflictResolverDefault.
+type jsonFieldConflictResolver struct {
+	fieldPath []string
+}
+
+// NewJSONFieldConflictResolver returns a jsonFieldConflictResolver on the specified field,
+// which can be a nested field with names separated by ".", e.g., "meta.version"
+func NewJSONFieldConflictResolver(field string) (ConflictResolver, error) {
+	fieldPath := strings.Split(field, ".")
+	for _, fieldName := range fieldPath {
+		if len(fieldName) == 0 {
+			return nil, fmt.Errorf("Invalid json field %v", field)
+		}
+	}
+	return &jsonFieldConflictResolver{fieldPath: fieldPath}, nil
+}
+
+func (resolver *jsonFieldConflictResolver) Resolve(doc_meta_source DocumentMetadata, doc_meta_target DocumentMetadata,
+	source_cr_mode ConflictResolutionMode, xattrEnabled bool, logger *log.CommonLogger) bool {
+	return ResolveConflict(doc_meta_source, doc_meta_target, source_cr_mode, xattrEnabled, logger)
+}
+
+func (resolver *jsonFieldConflictResolver) TargetXattrs() []string {
+	return nil
+}
+
+func (resolver *jsonFieldConflictResolver) ResolveDocument(source *Document, target *Document, source_cr_mode ConflictResolutionMode,
+	xattrEnabled bool, logger *log.CommonLogger) (bool, map[string]string) {
+	sourceValue, sourceOk := resolver.fieldValue(source.Body)
+	targetValue, targetOk := resolver.fieldValue(target.Body)
+	if sourceOk && targetOk && sourceValue != targetValue {
+		return sourceValue > targetValue, nil
+	}
+	return ResolveConflict(source.Metadata, target.Metadata, source_cr_mode, xattrEnabled, logger), nil
+}
+
+// returns the numeric value of the field in a json document body, and whether the value exists
+func (resolver *jsonFieldConflictResolver) fieldValue(body []byte) (float64, bool) {
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if decoder.Decode(&doc) != nil {
+		return 0, false
+	}
+	for _, fieldName := range resolver.fieldPath {
+		object, ok := doc.(map[string]interface{})
+		if !ok {
+			return 0, false
+		}
+		doc = object[fieldName]
+	}
+	number, ok := doc.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	value, err := number.Float64()
+	return value, err == nil
+}
+
+// mergeXattrsConflictResolver resolves conflicts the same way as ConflictResolverDefault.
+// When source wins, the named xattrs that the target document has and the source mutation does not have
+// are added to the source mutation, so that they are not lost when the target document is overwritten.
+type mergeXattrsConflictResolver struct {
+	xattrs []string
+}
+
+// NewMergeXattrsConflictResolver returns a mergeXattrsConflictResolver on the specified comma separated xattr names
+func NewMergeXattrsConflictResolver(xattrs string) (ConflictResolver, error) {
+	names := strings.Split(xattrs, ",")
+	if len(names) > SubdocMaxPaths-1 {
+		return nil, fmt.Errorf("At most %v xattrs can be merged", SubdocMaxPaths-1)
+	}
+	for index, name := range names {
+		names[index] = strings.TrimSpace(name)
+		if len(names[index]) == 0 {
+			return nil, fmt.Errorf("Invalid xattr names %v", xattrs)
+		}
+	}
+	return &mergeXattrsConflictResolver{xattrs: names}, nil
+}
+
+func (resolver *mergeXattrsConflictResolver) Resolve(doc_meta_source DocumentMetadata, doc_meta_target DocumentMetadata,
+	source_cr_mode ConflictResolutionMode, xattrEnabled bool, logger *log.CommonLogger) bool {
+	return ResolveConflict(doc_meta_source, doc_meta_target, source_cr_mode, xattrEnabled, logger)
+}
+
+func (resolver *mergeXattrsConflictResolver) TargetXattrs() []string {
+	return resolver.xattrs
+}
+
+func (resolver *mergeXattrsConflictResolver) ResolveDocument(source *Document, target *Document, source_cr_mode ConflictResolutionMode,
+	xattrEnabled bool, logger *log.CommonLogger) (bool, map[string]string) {
+	if !ResolveConflict(source.Metadata, target.Metadata, source_cr_mode, xattrEnabled, logger) {
+		return false, nil
+	}
+
+	var mergedXattrs map[string]string
+	for _, name := range resolver.xattrs {
+		targetValue, ok := target.Xattrs[name]
+		if !ok {
+			continue
+		}
+		if _, ok = source.Xattrs[name]; ok {
+			continue
+		}
+		if mergedXattrs == nil {
+			mergedXattrs = make(map[string]string, len(source.Xattrs)+1)
+			for sourceName, sourceValue := range source.Xattrs {
+				mergedXattrs[sourceName] = sourceValue
+			}
+		}
+		mergedXattrs[name] = targetValue
+	}
+	return true, mergedXattrs
+}
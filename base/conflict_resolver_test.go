@@ -0,0 +1,155 @@
+// +build !pcre
+
+package base
+
+import (
+	"fmt"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var crTestLogger = log.NewLogger("ConflictResolverTest", log.DefaultLoggerContext)
+
+func TestConflictResolvers(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestConflictResolvers =================")
+
+	key := []byte("testKey")
+	xattrDataType := PROTOCOL_BINARY_DATATYPE_XATTR
+
+	testCases := []struct {
+		name         string
+		resolver     string
+		crMode       ConflictResolutionMode
+		xattrEnabled bool
+		source       DocumentMetadata
+		target       DocumentMetadata
+		sourceWins   bool
+	}{
+		{"revId higher revSeq on source", ConflictResolverDefault, CRMode_RevId, false,
+			NewDocumentMetadata(key, 5, 100, 0, 0, false, 0), NewDocumentMetadata(key, 4, 200, 0, 0, false, 0), true},
+		{"revId higher revSeq on target", ConflictResolverDefault, CRMode_RevId, false,
+			NewDocumentMetadata(key, 4, 200, 0, 0, false, 0), NewDocumentMetadata(key, 5, 100, 0, 0, false, 0), false},
+		{"revId same revSeq higher cas on source", ConflictResolverDefault, CRMode_RevId, false,
+			NewDocumentMetadata(key, 5, 200, 0, 0, false, 0), NewDocumentMetadata(key, 5, 100, 0, 0, false, 0), true},
+		{"lww higher cas on source", ConflictResolverDefault, CRMode_LWW, false,
+			NewDocumentMetadata(key, 4, 200, 0, 0, false, 0), NewDocumentMetadata(key, 5, 100, 0, 0, false, 0), true},
+		{"lww higher cas on target", ConflictResolverDefault, CRMode_LWW, false,
+			NewDocumentMetadata(key, 5, 100, 0, 0, false, 0), NewDocumentMetadata(key, 4, 200, 0, 0, false, 0), false},
+		{"identical deletion loses", ConflictResolverDefault, CRMode_RevId, false,
+			NewDocumentMetadata(key, 5, 100, 0, 0, true, 0), NewDocumentMetadata(key, 5, 100, 0, 0, false, 0), false},
+		{"identical meta with source xattr wins", ConflictResolverDefault, CRMode_LWW, true,
+			NewDocumentMetadata(key, 5, 100, 0, 0, false, xattrDataType), NewDocumentMetadata(key, 5, 100, 0, 0, false, 0), true},
+		{"identical meta with source xattr but xattr disabled", ConflictResolverDefault, CRMode_LWW, false,
+			NewDocumentMetadata(key, 5, 100, 0, 0, false, xattrDataType), NewDocumentMetadata(key, 5, 100, 0, 0, false, 0), false},
+		{"empty name falls back to default", "", CRMode_RevId, false,
+			NewDocumentMetadata(key, 4, 200, 0, 0, false, 0), NewDocumentMetadata(key, 5, 100, 0, 0, false, 0), false},
+		{"source wins with older source", ConflictResolverSourceWins, CRMode_RevId, false,
+			NewDocumentMetadata(key, 4, 100, 0, 0, false, 0), NewDocumentMetadata(key, 5, 200, 0, 0, false, 0), true},
+		{"source wins with identical deletion", ConflictResolverSourceWins, CRMode_LWW, false,
+			NewDocumentMetadata(key, 5, 100, 0, 0, true, 0), NewDocumentMetadata(key, 5, 100, 0, 0, false, 0), true},
+		{"target wins with newer source", ConflictResolverTargetWins, CRMode_LWW, false,
+			NewDocumentMetadata(key, 6, 300, 0, 0, false, 0), NewDocumentMetadata(key, 5, 200, 0, 0, false, 0), false},
+	}
+
+	for _, testCase := range testCases {
+		resolver, err := GetConflictResolver(testCase.resolver)
+		assert.Nil(err, testCase.name)
+		assert.Equal(testCase.sourceWins, resolver.Resolve(testCase.source, testCase.target, testCase.crMode, testCase.xattrEnabled, crTestLogger), testCase.name)
+	}
+	fmt.Println("============== Test case end: TestConflictResolvers =================")
+}
+
+func TestRegisterConflictResolver(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestRegisterConflictResolver =================")
+
+	higherFlagsWins := ConflictResolverFunc(func(doc_meta_source DocumentMetadata, doc_meta_target DocumentMetadata,
+		source_cr_mode ConflictResolutionMode, xattrEnabled bool, logger *log.CommonLogger) bool {
+		return doc_meta_source.Flags() > doc_meta_target.Flags()
+	})
+
+	assert.Equal(ErrorConflictResolverNameEmpty, RegisterConflictResolver("", higherFlagsWins))
+	assert.Equal(ErrorConflictResolverNil, RegisterConflictResolver("higherFlagsWins", nil))
+	assert.NotNil(RegisterConflictResolver(ConflictResolverDefault, higherFlagsWins))
+	assert.NotNil(ValidateConflictResolver("higherFlagsWins"))
+
+	assert.Nil(RegisterConflictResolver("higherFlagsWins", higherFlagsWins))
+	assert.Nil(ValidateConflictResolver("higherFlagsWins"))
+	assert.Contains(ConflictResolverNames(), "higherFlagsWins")
+
+	resolver, err := GetConflictResolver("higherFlagsWins")
+	assert.Nil(err)
+	assert.True(resolver.Resolve(NewDocumentMetadata([]byte("key"), 1, 1, 2, 0, false, 0),
+		NewDocumentMetadata([]byte("key"), 1, 1, 1, 0, false, 0), CRMode_RevId, false, crTestLogger))
+	fmt.Println("============== Test case end: TestRegisterConflictResolver =================")
+}
+
+func TestDocumentConflictResolvers(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestDocumentConflictResolvers =================")
+
+	key := []byte("testKey")
+	olderMeta := NewDocumentMetadata(key, 4, 100, 0, 0, false, 0)
+	newerMeta := NewDocumentMetadata(key, 5, 200, 0, 0, false, 0)
+
+	testCases := []struct {
+		name         string
+		resolver     string
+		source       *Document
+		target       *Document
+		sourceWins   bool
+		mergedXattrs map[string]string
+	}{
+		{"higher field on older source", "jsonFieldWins:version",
+			&Document{Metadata: olderMeta, Body: []byte(`{"version":10}`)}, &Document{Metadata: newerMeta, Body: []byte(`{"version":9.5}`)}, true, nil},
+		{"lower field on newer source", "jsonFieldWins:version",
+			&Document{Metadata: newerMeta, Body: []byte(`{"version":1}`)}, &Document{Metadata: olderMeta, Body: []byte(`{"version":2}`)}, false, nil},
+		{"nested field", "jsonFieldWins:meta.version",
+			&Document{Metadata: olderMeta, Body: []byte(`{"meta":{"version":3}}`)}, &Document{Metadata: newerMeta, Body: []byte(`{"meta":{"version":2}}`)}, true, nil},
+		{"equal fields fall back to metadata", "jsonFieldWins:version",
+			&Document{Metadata: olderMeta, Body: []byte(`{"version":1}`)}, &Document{Metadata: newerMeta, Body: []byte(`{"version":1}`)}, false, nil},
+		{"missing field falls back to metadata", "jsonFieldWins:version",
+			&Document{Metadata: newerMeta, Body: []byte(`{"a":1}`)}, &Document{Metadata: olderMeta, Body: []byte(`{"version":2}`)}, true, nil},
+		{"non-numeric field falls back to metadata", "jsonFieldWins:version",
+			&Document{Metadata: olderMeta, Body: []byte(`{"version":"3"}`)}, &Document{Metadata: newerMeta, Body: []byte(`{"version":2}`)}, false, nil},
+		{"non-json body falls back to metadata", "jsonFieldWins:version",
+			&Document{Metadata: newerMeta, Body: []byte("binary")}, &Document{Metadata: olderMeta, Body: []byte(`{"version":2}`)}, true, nil},
+		{"merge target only xattrs", "mergeXattrs:a, b",
+			&Document{Metadata: newerMeta, Xattrs: map[string]string{"a": `"source"`, "c": "1"}}, &Document{Metadata: olderMeta, Xattrs: map[string]string{"a": `"target"`, "b": "2"}},
+			true, map[string]string{"a": `"source"`, "b": "2", "c": "1"}},
+		{"nothing to merge", "mergeXattrs:a",
+			&Document{Metadata: newerMeta, Xattrs: map[string]string{"a": "1"}}, &Document{Metadata: olderMeta, Xattrs: map[string]string{"a": "2"}}, true, nil},
+		{"older source loses without merge", "mergeXattrs:b",
+			&Document{Metadata: olderMeta, Xattrs: map[string]string{}}, &Document{Metadata: newerMeta, Xattrs: map[string]string{"b": "2"}}, false, nil},
+	}
+
+	for _, testCase := range testCases {
+		resolver, err := GetConflictResolver(testCase.resolver)
+		assert.Nil(err, testCase.name)
+		docResolver, ok := resolver.(DocumentConflictResolver)
+		assert.True(ok, testCase.name)
+		if !ok {
+			continue
+		}
+		sourceWins, mergedXattrs := docResolver.ResolveDocument(testCase.source, testCase.target, CRMode_RevId, true, crTestLogger)
+		assert.Equal(testCase.sourceWins, sourceWins, testCase.name)
+		assert.Equal(testCase.mergedXattrs, mergedXattrs, testCase.name)
+	}
+
+	resolver, err := GetConflictResolver("mergeXattrs:a,b")
+	assert.Nil(err)
+	assert.Equal([]string{"a", "b"}, resolver.(DocumentConflictResolver).TargetXattrs())
+	// metadata only resolution is the same as default
+	assert.False(resolver.Resolve(olderMeta, newerMeta, CRMode_RevId, false, crTestLogger))
+
+	invalidNames := []string{"jsonFieldWins:", "jsonFieldWins:a..b", "mergeXattrs:", "mergeXattrs:a,,b", "mergeXattrs:1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16", "unknown:param"}
+	for _, name := range invalidNames {
+		assert.NotNil(ValidateConflictResolver(name), name)
+	}
+	assert.Contains(ConflictResolverNames(), "jsonFieldWins:<parameter>")
+	assert.NotNil(RegisterConflictResolver(ConflictResolverMergeXattrs, ConflictResolverFunc(ResolveConflict)))
+
+	fmt.Println("============== Test case end: TestDocumentConflictResolvers =================")
+}
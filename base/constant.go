@@ -123,6 +123,7 @@ type XDCROutgoingNozzleType int
 const (
 	Xmem XDCROutgoingNozzleType = iota
 	Capi XDCROutgoingNozzleType = iota
+	Sink XDCROutgoingNozzleType = iota
 )
 
 // Last element is invalid and is there to keep consistency with the EndMarker
@@ -142,6 +143,44 @@ const CompressionTypeREST = "compressionType"
 
 const CompressionTypeKey = "compression_type"
 
+const ConflictResolverREST = "conflictResolver"
+
+const ConflictLoggingREST = "conflictLogging"
+
+const ScheduleREST = "schedule"
+
+const ScheduleTimezoneREST = "scheduleTimezone"
+
+const BandwidthProfileREST = "networkUsageLimitProfile"
+
+const TransformationRulesREST = "transformationRules"
+
+const BoundedSeqnoRangeREST = "boundedSeqnoRange"
+
+const BoundedTimeRangeREST = "boundedTimeRange"
+
+const TargetBatchLatencyREST = "targetBatchLatency"
+
+const ConnectionsPerTargetNozzleREST = "connectionsPerTargetNozzle"
+
+const SinkEndpointREST = "sinkEndpoint"
+
+const SinkUsernameREST = "sinkUsername"
+
+const SinkPasswordREST = "sinkPassword"
+
+const SinkTLSREST = "sinkTLS"
+
+const SinkCertificateREST = "sinkCertificate"
+
+const SinkHttpHeadersREST = "sinkHttpHeaders"
+
+const SinkHttpRetryCodesREST = "sinkHttpRetryStatusCodes"
+
+const SinkHttpSkipCodesREST = "sinkHttpSkipStatusCodes"
+
+const SinkKafkaMaxRequestBytesREST = "sinkKafkaMaxRequestBytes"
+
 // DataType fields of MCRequest
 // kv_engine/include/mcbp/protocol/datatype.h
 const (
@@ -173,6 +212,7 @@ const (
 	GlobalSettingChangeListener    = "GlobalSettingChangeListener"
 	BucketSettingsChangeListener   = "BucketSettingsChangeListener"
 	InternalSettingsChangeListener = "InternalSettingsChangeListener"
+	WebhookChangeListener          = "WebhookChangeListener"
 )
 
 // constants for integer parsing
@@ -285,6 +325,8 @@ const (
 	JsonContentType    = "application/json"
 	ContentLength      = "Content-Length"
 	UserAgent          = "User-Agent"
+	// text exposition format of prometheus metrics
+	PrometheusContentType = "text/plain; version=0.0.4"
 )
 
 //constant for replication tasklist status
@@ -292,6 +334,9 @@ const (
 	Pending     = "Pending"
 	Replicating = "Replicating"
 	Paused      = "Paused"
+	Completed   = "Completed"
+	// replication is outside of the time windows in its schedule
+	PausedBySchedule = "PausedBySchedule"
 )
 
 const (
@@ -350,6 +395,28 @@ const (
 	SET_WITH_META    = mc.CommandCode(0xa2)
 	DELETE_WITH_META = mc.CommandCode(0xa8)
 	SET_TIME_SYNC    = mc.CommandCode(0xc1)
+	// subdoc commands for reading the bodies and xattrs of documents
+	SUBDOC_GET          = mc.CommandCode(0xc5)
+	SUBDOC_MULTI_LOOKUP = mc.CommandCode(0xd0)
+)
+
+// constants for subdoc lookups
+const (
+	// path flag indicating that path refers to an xattr
+	SUBDOC_FLAG_XATTR_PATH = 0x04
+	// doc flag allowing lookups on the tombstones of deleted documents
+	SUBDOC_DOC_FLAG_ACCESS_DELETED = 0x04
+	// status of multi lookup response when some of the paths are not found
+	SUBDOC_MULTI_PATH_FAILURE = mc.Status(0xcc)
+	// statuses of lookups done on the tombstones of deleted documents
+	SUBDOC_SUCCESS_DELETED            = mc.Status(0xcd)
+	SUBDOC_MULTI_PATH_FAILURE_DELETED = mc.Status(0xd3)
+	// max number of paths in a multi lookup
+	SubdocMaxPaths = 16
+	// virtual xattr that lists the names of all xattrs of a document
+	SubdocXattrTOC = "$XTOC"
+	// virtual xattr path of the seqno of a document, which is a hex string
+	SubdocDocumentSeqno = "$document.seqno"
 )
 
 const (
@@ -369,6 +436,7 @@ const (
 	GetMetaReceivedEventListener         = "GetMetaReceivedEventListener"
 	DataThrottledEventListener           = "DataThrottledEventListener"
 	DataThroughputThrottledEventListener = "DataThroughputThrottledEventListener"
+	DataTransformedEventListener         = "DataTransformedEventListener"
 )
 
 const (
@@ -422,8 +490,39 @@ const (
 	ConflictResolutionType_Lww   = "lww"
 )
 
+// names of built-in conflict resolvers that can be selected through replication settings
+const (
+	// conflict resolution based on the conflict resolution type of buckets
+	ConflictResolverDefault = "default"
+	// source mutations always win in source side conflict resolution
+	ConflictResolverSourceWins = "sourceWins"
+	// existing target documents always win in source side conflict resolution
+	ConflictResolverTargetWins = "targetWins"
+	// document with the higher numeric value in a json field wins, selected as "jsonFieldWins:<field path>"
+	ConflictResolverJSONFieldWins = "jsonFieldWins"
+	// conflict resolution as with default resolver, with xattrs of target documents merged into winning source mutations,
+	// selected as "mergeXattrs:<xattr>[,<xattr>...]"
+	ConflictResolverMergeXattrs = "mergeXattrs"
+)
+
+// separates the name of a parameterized conflict resolver from its parameter
+const ConflictResolverParamDelimiter = ":"
+
+// names of built-in sinks that can be selected as replication type for replications to non-couchbase targets
+const (
+	// appends mutations as json lines to local files, one file per vbucket
+	SinkTypeFile = "file"
+	// produces mutations as records to a kafka compatible broker
+	SinkTypeKafka = "kafka"
+	// posts batches of mutations as json to an http or https endpoint
+	SinkTypeHttp = "http"
+)
+
 var UnexpectedEOF = "unexpected EOF"
 
+// flag for memcached to skip its own conflict resolution and accept setMeta/delMeta unconditionally
+var SKIP_CONFLICT_RESOLUTION_FLAG uint32 = 0x01
+
 // flag for memcached to enable lww to lww bucket replication
 var FORCE_ACCEPT_WITH_META_OPS uint32 = 0x02
 
@@ -534,6 +633,10 @@ const (
 	FilterFlagKeyOnly   FilterFlagType = 0x4
 )
 
+// max number of document keys in a filter evaluation request. each of the documents is retrieved from source bucket
+// while the request is being served
+const MaxFilterEvaluationDocIds = 100
+
 var DefaultGoMaxProcs int = 4
 
 var BacklogThresholdDefault = 1000
@@ -591,6 +694,28 @@ var MaxCheckpointRecordsToKeep int = 5
 // the maximum number of checkpoint records to read from the checkpoint doc
 var MaxCheckpointRecordsToRead int = 5
 
+// interval for verifying checkpoint records against the current failover logs and target vbucket opaques,
+// and removing records that can no longer be used
+var CheckpointVerificationInterval = 10 * time.Minute
+
+// interval for checking whether all vbuckets of a bounded replication have been fully replicated
+var BoundedReplicationCompletionCheckInterval = 30 * time.Second
+
+// replication health evaluation
+// the period over which samples of replication stats are evaluated
+var ReplicationHealthWindow = 10 * time.Minute
+
+// the number of errors in ReplicationHealthWindow at and above which replication is considered degraded
+// a single transient error, e.g., a connection reset that pipeline recovers from, is not considered a health issue
+var ReplicationHealthErrorThreshold = 3
+
+// the ratio of resent docs to processed docs in ReplicationHealthWindow above which replication is considered degraded
+var ReplicationHealthMaxResendRatio = 0.01
+
+// replication is considered degraded when no checkpoint has been taken for this many checkpoint intervals
+// while there have been mutations to replicate
+var ReplicationHealthMaxCheckpointIntervals = 2
+
 // default time out for outgoing http requests if it is not explicitly specified (seconds)
 var DefaultHttpTimeout = 180 * time.Second
 
@@ -673,6 +798,30 @@ var XmemMaxDataChanSize = 10 * 1024 * 1024
 // max batch size that can be sent in one writeToClient() op
 var XmemMaxBatchSize = 50
 
+// lower bounds of the batch count and the batch size (in KB) that adaptive batch sizing in xmem can go down to.
+// the upper bounds are worker_batch_size and doc_batch_size_kb
+var XmemAdaptiveBatchMinCount = 10
+var XmemAdaptiveBatchMinSize = 10
+
+// min interval between two adjustments of batch count and batch size by adaptive batch sizing in xmem
+var XmemAdaptiveBatchAdjustInterval = 2 * time.Second
+
+// factor by which adaptive batch sizing in xmem grows batches when response latency is below target
+var XmemAdaptiveBatchGrowFactor = 1.25
+
+// max factor by which adaptive batch sizing in xmem shrinks batches in one adjustment when response latency is above target
+var XmemAdaptiveBatchMaxShrinkFactor = 0.5
+
+// adaptive batch sizing in xmem grows batches only when response latency is below target * XmemAdaptiveBatchGrowThreshold,
+// so that batch sizes settle instead of oscillating around the target
+var XmemAdaptiveBatchGrowThreshold = 0.8
+
+// growth of batches that drops throughput by more than this percentage is reverted by adaptive batch sizing in xmem
+var XmemAdaptiveBatchThroughputDropPercentage = 10
+
+// number of adjustments that adaptive batch sizing in xmem waits before growing batches again after reverting a growth
+var XmemAdaptiveBatchHoldCount = 15
+
 // interval between retries on batchUpdateDocs
 var CapiRetryInterval = 500 * time.Millisecond
 
@@ -797,6 +946,87 @@ var MaxCountCpuNotMaxed = 3
 // if we are in extra quota period, the period will be ended when the max count is reached
 var MaxCountThroughputDrop = 3
 
+// max size of a conflict log file, in bytes
+var ConflictLogMaxFileSize uint64 = 10 * 1024 * 1024
+
+// max number of conflict log files, including rotated ones, to keep for a replication
+var ConflictLogMaxNumberOfFiles uint64 = 5
+
+// max number of conflict records queued for writing. records are dropped when the queue is full
+var ConflictLogQueueSize = 10000
+
+// default and max number of records that can be returned by a single conflict log query
+var ConflictLogDefaultQueryLimit = 100
+var ConflictLogMaxQueryLimit = 1000
+
+// max number of notification events queued for delivery to webhooks. events are dropped when the queue is full
+var WebhookEventQueueSize = 1000
+
+// max number of events queued for delivery to a single webhook. events to a webhook are dropped when its queue is full
+var WebhookDeliveryQueueSize = 100
+
+// max number of retries when posting an event to a webhook fails
+var WebhookMaxRetry = 5
+
+// backoff time before the first retry of webhook delivery. it doubles on each retry, up to WebhookMaxBackoffTime
+var WebhookInitialBackoffTime = 1 * time.Second
+var WebhookMaxBackoffTime = 1 * time.Minute
+
+// timeout for posting an event to a webhook
+var WebhookRequestTimeout = 10 * time.Second
+
+// default and max number of documents that a diff job streams from source and compares with target per second
+var DiffDefaultMaxDocsPerSecond = 1000
+var DiffMaxMaxDocsPerSecond = 50000
+
+// number of getMeta requests that a diff job sends to target in one batch
+var DiffGetMetaBatchSize = 100
+
+// max number of documents of a vbucket that a diff job holds in memory. the documents are compared with target
+// each time this many have been streamed from source
+var DiffWindowSize = 10000
+
+// max number of differences recorded by a diff job. differences beyond this are counted but not recorded
+var DiffMaxRecords = 100000
+
+// timeout for receiving dcp events and getMeta responses in a diff job
+var DiffReadTimeout = 2 * time.Minute
+
+// max number of documents that a repair job can be requested to repair
+var RepairMaxKeys = 100000
+
+// max number of times that a repair job reads a source document again when it changes while being read
+var RepairMaxReadRetry = 3
+
+// max number of retries when a sink fails to write a batch of mutations
+var SinkMaxRetry = 6
+
+// backoff time before the first retry of a failed write to a sink. it doubles on each retry
+var SinkInitialBackoffTime = 500 * time.Millisecond
+
+// size of the data channel of each vbucket in a sink nozzle, as multiples of batch count
+var SinkDataChanSizeMultiplier = 1
+
+// timeout for establishing connections to kafka brokers
+var KafkaDialTimeout = 10 * time.Second
+
+// timeout for kafka brokers to respond to requests, including the time to get produced records acknowledged by all in-sync replicas
+var KafkaRequestTimeout = 30 * time.Second
+
+// max size of the records in each produce request of kafka sinks, when it is not configured for the sink.
+// it is within the default message.max.bytes of kafka brokers
+var KafkaDefaultMaxRequestBytes = 1000000
+
+// client id that kafka sinks identify themselves with to kafka brokers
+var KafkaClientId = "goxdcr"
+
+// timeout for http sinks to get responses to posted batches
+var HttpSinkRequestTimeout = 30 * time.Second
+
+// status codes of http sink responses that are retried when retry status codes are not configured for the sink
+// i.e., request timeout, too many requests, internal server error, bad gateway, service unavailable and gateway timeout
+var HttpSinkDefaultRetryStatusCodes = []int{408, 429, 500, 502, 503, 504}
+
 func InitConstants(topologyChangeCheckInterval time.Duration, maxTopologyChangeCountBeforeRestart,
 	maxTopologyStableCountBeforeRestart, maxWorkersForCheckpointing int,
 	timeoutCheckpointBeforeStop time.Duration, capiDataChanSizeMultiplier int,
@@ -968,3 +1198,15 @@ const FilterExpDelKey = "filter_exp_del"
 const FilterExpKey = "filterExpiration"
 const FilterDelKey = "filterDeletion"
 const BypassExpiryKey = "filterBypassExpiry"
+
+// policy for deletions and expirations that filter expression cannot be evaluated against, i.e.,
+// when filter expression references document body, or references xattrs that the deletion does not carry
+const FilterDelExpFallbackKey = "filter_del_exp_fallback"
+const FilterDelExpFallbackREST = "filterDelExpFallback"
+
+const (
+	// replicate deletions and expirations that cannot be filtered, which is the behavior prior to filtering on deletions
+	FilterDelExpFallbackReplicate = "replicate"
+	// do not replicate deletions and expirations that cannot be filtered
+	FilterDelExpFallbackSkip = "skip"
+)
@@ -21,6 +21,7 @@ import (
 	"github.com/couchbase/gojsonsm"
 	mcc "github.com/couchbase/gomemcached/client"
 	"github.com/couchbase/goxdcr/log"
+	"hash/crc32"
 	"io/ioutil"
 	"math"
 	mrand "math/rand"
@@ -895,6 +896,11 @@ func ConstructVbServerMap(vbList []uint16, serverVbMap map[string][]uint16) map[
 	return vbServerMap
 }
 
+// returns the vbucket that a document key is hashed to, in the same way as by couchbase clients
+func GetVBucketForKey(key []byte, numOfVBuckets int) uint16 {
+	return uint16(((crc32.ChecksumIEEE(key) >> 16) & 0x7fff) % uint32(numOfVBuckets))
+}
+
 func UpgradeFilter(oldFilter string) string {
 	return fmt.Sprintf("%v(`%v`, \"%v\")", gojsonsm.FuncRegexp, ReservedWordsMap[ExternalKeyKey], oldFilter)
 }
@@ -1099,6 +1105,56 @@ func FilterContainsKeyExpression(expression string) bool {
 	return strings.Contains(expression, ExternalKeyKeyContains)
 }
 
+// string literals, which may contain anything that looks like field references
+var filterStringLiteralRegex *regexp.Regexp = regexp.MustCompile(`"(\\.|[^"\\])*"|'(\\.|[^'\\])*'`)
+
+// references to document key and xattrs, including paths into xattrs, e.g., META().xattrs.app.version
+var filterKeyXattrRefRegex *regexp.Regexp = regexp.MustCompile(fmt.Sprintf("(%v|%v((\\.[a-zA-Z0-9_]+|\\.`[^`]*`|\\[[0-9]+\\]))*)", ExternalKeyKey, ExternalKeyXattr))
+
+// numbers, identifiers and back-quoted identifiers
+var filterTokenRegex *regexp.Regexp = regexp.MustCompile("[0-9]+(\\.[0-9]+)?([eE][-+]?[0-9]+)?|[a-zA-Z_][a-zA-Z0-9_]*|`[^`]*`")
+
+var filterKeywords = map[string]bool{
+	"AND":     true,
+	"OR":      true,
+	"NOT":     true,
+	"IS":      true,
+	"NULL":    true,
+	"MISSING": true,
+	"VALUED":  true,
+	"EXISTS":  true,
+	"TRUE":    true,
+	"FALSE":   true,
+	"LIKE":    true,
+	"IN":      true,
+	"BETWEEN": true,
+}
+
+// Checks whether filter expression references any field in document body, i.e., whether it can be evaluated
+// using only document key and xattrs, as is the case for deletions and expirations, which do not have body.
+// The check errs on the side of reporting a reference, e.g., for references to META() fields other than id and xattrs
+// NOTE - takes in user entered expression
+func FilterReferencesDocBody(expression string) bool {
+	expression = filterStringLiteralRegex.ReplaceAllString(expression, " ")
+	expression = filterKeyXattrRefRegex.ReplaceAllString(expression, " ")
+
+	for _, loc := range filterTokenRegex.FindAllStringIndex(expression, -1) {
+		token := expression[loc[0]:loc[1]]
+		if token[0] >= '0' && token[0] <= '9' {
+			continue
+		}
+		if filterKeywords[strings.ToUpper(token)] {
+			continue
+		}
+		if strings.HasPrefix(strings.TrimLeft(expression[loc[1]:], " \t"), "(") {
+			// function call
+			continue
+		}
+		return true
+	}
+	return false
+}
+
 // Checks for at least one of the valid key expression connected by one or more valid key expression connected by AND or OR
 // Logic explained:
 // Either a single instance that starts and ends with one of: "REGEXP_CONTAINS(key, \".*\")" OR "key op \"alphanumeric\"*"
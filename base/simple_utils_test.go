@@ -209,3 +209,33 @@ func TestFlagType(t *testing.T) {
 	assert.False(baseType&FilterExpDelStripExpiration > 0)
 	fmt.Println("============== Test case end: TestFlagType =================")
 }
+
+func TestFilterReferencesDocBody(t *testing.T) {
+	fmt.Println("============== Test case start: TestFilterReferencesDocBody =================")
+	assert := assert.New(t)
+
+	var bodyExpr []string
+	bodyExpr = append(bodyExpr, "type = \"foo\"")
+	bodyExpr = append(bodyExpr, "REGEXP_CONTAINS(META().id, \"^abc\") AND a.b > 1")
+	bodyExpr = append(bodyExpr, "`field with space` = 1")
+	bodyExpr = append(bodyExpr, "EXISTS(field)")
+	bodyExpr = append(bodyExpr, "META().xattrs.app = name")
+	// META() fields other than id and xattrs are treated as body references
+	bodyExpr = append(bodyExpr, "META().expiration > 0")
+
+	var keyXattrExpr []string
+	keyXattrExpr = append(keyXattrExpr, "REGEXP_CONTAINS(META().id, \"^type = field\")")
+	keyXattrExpr = append(keyXattrExpr, "META().xattrs.app.version > 2 AND NOT META().id = \"abc\"")
+	keyXattrExpr = append(keyXattrExpr, "META().xattrs.`odd field`[0] IS NOT MISSING")
+	keyXattrExpr = append(keyXattrExpr, "META().id LIKE \"a%\" OR META().id = 'it\\'s'")
+	keyXattrExpr = append(keyXattrExpr, "META().xattrs.app.count >= 1.5e3")
+
+	for _, expr := range bodyExpr {
+		assert.True(FilterReferencesDocBody(expr), expr)
+	}
+
+	for _, expr := range keyXattrExpr {
+		assert.False(FilterReferencesDocBody(expr), expr)
+	}
+	fmt.Println("============== Test case end: TestFilterReferencesDocBody =================")
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+// defines the registry of sinks, which can be selected as replication type for replications to non-couchbase targets
+package base
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var ErrorSinkNameEmpty = errors.New("Sink name cannot be empty")
+
+func ErrorSinkAlreadyRegistered(name string) error {
+	return fmt.Errorf("Sink %v has already been registered", name)
+}
+
+func ErrorSinkNotFound(name string) error {
+	return fmt.Errorf("Sink %v does not exist. Valid values are %v", name, SinkNames())
+}
+
+// registry of sink names. the constructors of sinks are kept in parts package, which registers the names here,
+// so that replication settings can be validated without depending on parts package
+var sinkRegistry = make(map[string]bool)
+var sinkRegistryLock sync.RWMutex
+
+// RegisterSink makes the specified sink name valid as replication type.
+// It is expected to be called during process initialization, before replications are started.
+func RegisterSink(name string) error {
+	if len(name) == 0 {
+		return ErrorSinkNameEmpty
+	}
+
+	sinkRegistryLock.Lock()
+	defer sinkRegistryLock.Unlock()
+	if sinkRegistry[name] {
+		return ErrorSinkAlreadyRegistered(name)
+	}
+	sinkRegistry[name] = true
+	return nil
+}
+
+// ValidateSink checks that a sink has been registered under the specified name
+func ValidateSink(name string) error {
+	sinkRegistryLock.RLock()
+	registered := sinkRegistry[name]
+	sinkRegistryLock.RUnlock()
+	if !registered {
+		return ErrorSinkNotFound(name)
+	}
+	return nil
+}
+
+// SinkNames returns the sorted names of all registered sinks
+func SinkNames() []string {
+	sinkRegistryLock.RLock()
+	defer sinkRegistryLock.RUnlock()
+	names := make([]string, 0, len(sinkRegistry))
+	for name, _ := range sinkRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -85,6 +85,35 @@ type ReplicationInfo struct {
 	Id        string
 	StatsMap  map[string]interface{}
 	ErrorList []ErrorInfo
+	// only populated when replication has been paused through pauseReplication endpoint
+	PauseInfo *PauseInfo `json:",omitempty"`
+	// only populated when replication has a schedule
+	ScheduleInfo *ScheduleInfo `json:",omitempty"`
+}
+
+// information about an explicit pause of a replication
+type PauseInfo struct {
+	Reason string `json:"reason"`
+	// PauseTime and ResumeTime are the number of seconds elapsed since 1/1/1970 UTC
+	PauseTime int64 `json:"pauseTime"`
+	// 0 indicates that replication will not be resumed automatically
+	ResumeTime int64 `json:"resumeTime"`
+}
+
+func (info *PauseInfo) Clone() *PauseInfo {
+	if info == nil {
+		return nil
+	}
+	clonedInfo := *info
+	return &clonedInfo
+}
+
+// state of the schedule of a replication
+type ScheduleInfo struct {
+	Schedule string `json:"schedule"`
+	Timezone string `json:"timezone"`
+	// whether replication is currently in one of the time windows in its schedule
+	InWindow bool `json:"inWindow"`
 }
 
 type ErrorInfo struct {
@@ -94,7 +123,10 @@ type ErrorInfo struct {
 }
 
 type WrappedMCRequest struct {
-	Seqno      uint64
+	Seqno uint64
+	// source vbucket of the request. it is different from Req.VBucket when the document key has been changed
+	// by transformation rules and the request has been routed to the target vbucket of the new key
+	SrcVBucket uint16
 	Req        *gomemcached.MCRequest
 	Start_time time.Time
 	UniqueKey  string
@@ -53,6 +53,14 @@ const (
 	DataThroughputThrottled ComponentEventType = iota
 	// Expiry field has been stripped
 	ExpiryFieldStripped ComponentEventType = iota
+	// data has been changed by the transformation rules of the replication
+	DataTransformed ComponentEventType = iota
+	// data is unable to be transformed and is not replicated
+	DataUnableToTransform ComponentEventType = iota
+	// checkpoint records that can no longer be used have been removed from checkpoint docs
+	InvalidCheckpointsRemoved ComponentEventType = iota
+	// data streaming of a bounded replication has reached the end of its range for a vbucket
+	StreamingEnd ComponentEventType = iota
 )
 
 type Event struct {
@@ -28,6 +28,7 @@ const (
 	DCP_NOZZLE_NAME_PREFIX  = "dcp"
 	XMEM_NOZZLE_NAME_PREFIX = "xmem"
 	CAPI_NOZZLE_NAME_PREFIX = "capi"
+	SINK_NOZZLE_NAME_PREFIX = "sink"
 )
 
 // interface so we can autogenerate mock and do unit test
@@ -57,6 +58,7 @@ type XDCRFactory struct {
 	//bucket settings service
 	bucket_settings_svc      service_def.BucketSettingsSvc
 	throughput_throttler_svc service_def.ThroughputThrottlerSvc
+	conflict_log_svc         service_def.ConflictLogSvc
 
 	default_logger_ctx       *log.LoggerContext
 	pipeline_failure_handler common.SupervisorFailureHandler
@@ -74,6 +76,7 @@ func NewXDCRFactory(repl_spec_svc service_def.ReplicationSpecSvc,
 	uilog_svc service_def.UILogSvc,
 	bucket_settings_svc service_def.BucketSettingsSvc,
 	throughput_throttler_svc service_def.ThroughputThrottlerSvc,
+	conflict_log_svc service_def.ConflictLogSvc,
 	pipeline_default_logger_ctx *log.LoggerContext,
 	factory_logger_ctx *log.LoggerContext,
 	pipeline_failure_handler common.SupervisorFailureHandler,
@@ -87,6 +90,7 @@ func NewXDCRFactory(repl_spec_svc service_def.ReplicationSpecSvc,
 		uilog_svc:                uilog_svc,
 		bucket_settings_svc:      bucket_settings_svc,
 		throughput_throttler_svc: throughput_throttler_svc,
+		conflict_log_svc:         conflict_log_svc,
 		default_logger_ctx:       pipeline_default_logger_ctx,
 		pipeline_failure_handler: pipeline_failure_handler,
 		logger:                   log.NewLogger("XDCRFactory", factory_logger_ctx),
@@ -108,7 +112,13 @@ func (xdcrf *XDCRFactory) NewPipeline(topic string, progress_recorder common.Pip
 	logger_ctx := log.CopyCtx(xdcrf.default_logger_ctx)
 	logger_ctx.SetLogLevel(spec.Settings.LogLevel)
 
-	targetClusterRef, err := xdcrf.remote_cluster_svc.RemoteClusterByUuid(spec.TargetClusterUUID, false)
+	var targetClusterRef *metadata.RemoteClusterReference
+	if spec.Settings.IsSink() {
+		// replications to sinks do not have remote cluster references
+		targetClusterRef, err = metadata.NewSinkTargetClusterReference(spec)
+	} else {
+		targetClusterRef, err = xdcrf.remote_cluster_svc.RemoteClusterByUuid(spec.TargetClusterUUID, false)
+	}
 	if err != nil {
 		xdcrf.logger.Errorf("Error getting remote cluster with uuid=%v for pipeline %v, err=%v\n", spec.TargetClusterUUID, spec.Id, err)
 		return nil, err
@@ -120,39 +130,50 @@ func (xdcrf *XDCRFactory) NewPipeline(topic string, progress_recorder common.Pip
 		return nil, err
 	}
 	isCapiReplication := (nozzleType == base.Capi)
+	isSinkReplication := (nozzleType == base.Sink)
 
-	connStr, err := xdcrf.remote_cluster_svc.GetConnectionStringForRemoteCluster(targetClusterRef, isCapiReplication)
-	if err != nil {
-		return nil, err
-	}
+	// sourceCRMode is the conflict resolution mode to use when resolving conflicts for big documents at source side
+	// capi replication always uses rev id based conflict resolution
+	// replication to sink does not resolve conflicts and uses rev id based conflict resolution as well
+	sourceCRMode := base.CRMode_RevId
+	var targetBucketInfo map[string]interface{}
+	var httpAuthMech base.HttpAuthMech
+	var isTargetES bool
+	// sinks are not couchbase buckets and there is no target bucket info to retrieve
+	if !isSinkReplication {
+		connStr, err := xdcrf.remote_cluster_svc.GetConnectionStringForRemoteCluster(targetClusterRef, isCapiReplication)
+		if err != nil {
+			return nil, err
+		}
 
-	username, password, httpAuthMech, certificate, sanInCertificate, clientCertificate, clientKey, err := targetClusterRef.MyCredentials()
-	if err != nil {
-		return nil, err
-	}
+		var username, password string
+		var certificate, clientCertificate, clientKey []byte
+		var sanInCertificate bool
+		username, password, httpAuthMech, certificate, sanInCertificate, clientCertificate, clientKey, err = targetClusterRef.MyCredentials()
+		if err != nil {
+			return nil, err
+		}
 
-	targetBucketInfo, err := xdcrf.utils.GetBucketInfo(connStr, spec.TargetBucketName, username, password, httpAuthMech, certificate, sanInCertificate, clientCertificate, clientKey, xdcrf.logger)
-	if err != nil {
-		return nil, err
-	}
+		targetBucketInfo, err = xdcrf.utils.GetBucketInfo(connStr, spec.TargetBucketName, username, password, httpAuthMech, certificate, sanInCertificate, clientCertificate, clientKey, xdcrf.logger)
+		if err != nil {
+			return nil, err
+		}
 
-	isTargetES := xdcrf.utils.CheckWhetherClusterIsESBasedOnBucketInfo(targetBucketInfo)
+		isTargetES = xdcrf.utils.CheckWhetherClusterIsESBasedOnBucketInfo(targetBucketInfo)
 
-	conflictResolutionType, err := xdcrf.utils.GetConflictResolutionTypeFromBucketInfo(spec.TargetBucketName, targetBucketInfo)
-	if err != nil {
-		return nil, err
-	}
+		conflictResolutionType, err := xdcrf.utils.GetConflictResolutionTypeFromBucketInfo(spec.TargetBucketName, targetBucketInfo)
+		if err != nil {
+			return nil, err
+		}
 
-	// sourceCRMode is the conflict resolution mode to use when resolving conflicts for big documents at source side
-	// capi replication always uses rev id based conflict resolution
-	sourceCRMode := base.CRMode_RevId
-	if !isCapiReplication {
-		// for xmem replication, sourceCRMode is LWW if and only if target bucket is LWW enabled, so as to ensure that source side conflict
-		// resolution and target side conflict resolution yield consistent results
-		sourceCRMode = base.GetCRModeFromConflictResolutionTypeSetting(conflictResolutionType)
+		if !isCapiReplication {
+			// for xmem replication, sourceCRMode is LWW if and only if target bucket is LWW enabled, so as to ensure that source side conflict
+			// resolution and target side conflict resolution yield consistent results
+			sourceCRMode = base.GetCRModeFromConflictResolutionTypeSetting(conflictResolutionType)
+		}
 	}
 
-	xdcrf.logger.Infof("%v sourceCRMode=%v httpAuthMech=%v isCapiReplication=%v isTargetES=%v\n", topic, sourceCRMode, httpAuthMech, isCapiReplication, isTargetES)
+	xdcrf.logger.Infof("%v sourceCRMode=%v httpAuthMech=%v isCapiReplication=%v isTargetES=%v isSinkReplication=%v\n", topic, sourceCRMode, httpAuthMech, isCapiReplication, isTargetES, isSinkReplication)
 
 	/**
 	 * Construct the Source nozzles
@@ -177,8 +198,17 @@ func (xdcrf *XDCRFactory) NewPipeline(topic string, progress_recorder common.Pip
 	 * 2. vbNozzleMap - map of VBucket# -> nozzle to be used (to be used by router)
 	 * 3. kvVBMap - map of remote KVNodes -> vbucket# responsible for per node
 	 */
-	outNozzles, vbNozzleMap, target_kv_vb_map, targetUserName, targetPassword, targetClusterVersion, err :=
-		xdcrf.constructOutgoingNozzles(spec, kv_vb_map, sourceCRMode, targetBucketInfo, targetClusterRef, isCapiReplication, isTargetES, logger_ctx)
+	var outNozzles map[string]common.Nozzle
+	var vbNozzleMap map[uint16]string
+	var target_kv_vb_map map[string][]uint16
+	var targetUserName, targetPassword string
+	var targetClusterVersion int
+	if isSinkReplication {
+		outNozzles, vbNozzleMap, err = xdcrf.constructSinkNozzles(spec, kv_vb_map, logger_ctx)
+	} else {
+		outNozzles, vbNozzleMap, target_kv_vb_map, targetUserName, targetPassword, targetClusterVersion, err =
+			xdcrf.constructOutgoingNozzles(spec, kv_vb_map, sourceCRMode, targetBucketInfo, targetClusterRef, isCapiReplication, isTargetES, logger_ctx)
+	}
 
 	if err != nil {
 		return nil, err
@@ -187,10 +217,22 @@ func (xdcrf *XDCRFactory) NewPipeline(topic string, progress_recorder common.Pip
 
 	// TODO construct queue parts. This will affect vbMap in router. may need an additional outNozzle -> downStreamPart/queue map in constructRouter
 
+	// when transformation rules change document keys, documents are routed to the target vbuckets of their new keys,
+	// which may be handled by any of the out nozzles
+	targetVBCount := 0
+	if !isSinkReplication && metadata.TransformationRulesChangeKeys(spec.Settings.GetTransformationRules()) {
+		targetVBCount = len(vbNozzleMap)
+	}
+
 	// construct routers to be able to connect the nozzles
 	for _, sourceNozzle := range sourceNozzles {
 		vblist := sourceNozzle.(*parts.DcpNozzle).GetVBList()
 		downStreamParts := make(map[string]common.Part)
+		if targetVBCount > 0 {
+			for targetNozzleId, outNozzle := range outNozzles {
+				downStreamParts[targetNozzleId] = outNozzle
+			}
+		}
 		for _, vb := range vblist {
 			targetNozzleId, ok := vbNozzleMap[vb]
 			if !ok {
@@ -205,7 +247,7 @@ func (xdcrf *XDCRFactory) NewPipeline(topic string, progress_recorder common.Pip
 		}
 
 		// Construct a router - each Source nozzle has a router.
-		router, err := xdcrf.constructRouter(sourceNozzle.Id(), spec, downStreamParts, vbNozzleMap, sourceCRMode, logger_ctx)
+		router, err := xdcrf.constructRouter(sourceNozzle.Id(), spec, downStreamParts, vbNozzleMap, sourceCRMode, targetVBCount, logger_ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -232,7 +274,7 @@ func (xdcrf *XDCRFactory) NewPipeline(topic string, progress_recorder common.Pip
 	} else {
 		//register services to the pipeline context, so when pipeline context starts as part of the pipeline starting, these services will start as well
 		pipeline.SetRuntimeContext(pipelineContext)
-		err = xdcrf.registerServices(pipeline, logger_ctx, kv_vb_map, targetUserName, targetPassword, spec.TargetBucketName, target_kv_vb_map, targetClusterRef, targetClusterVersion, isCapiReplication, isTargetES)
+		err = xdcrf.registerServices(pipeline, logger_ctx, kv_vb_map, targetUserName, targetPassword, spec.TargetBucketName, target_kv_vb_map, targetClusterRef, targetClusterVersion, isCapiReplication, isTargetES, isSinkReplication)
 		if err != nil {
 			return nil, err
 		}
@@ -281,6 +323,9 @@ func (xdcrf *XDCRFactory) registerAsyncListenersOnSources(pipeline common.Pipeli
 		data_throughput_throttled_event_listener := component.NewDefaultAsyncComponentEventListenerImpl(
 			pipeline_utils.GetElementIdFromNameAndIndex(pipeline, base.DataThroughputThrottledEventListener, i),
 			pipeline.Topic(), logger_ctx)
+		data_transformed_event_listener := component.NewDefaultAsyncComponentEventListenerImpl(
+			pipeline_utils.GetElementIdFromNameAndIndex(pipeline, base.DataTransformedEventListener, i),
+			pipeline.Topic(), logger_ctx)
 
 		for index := load_distribution[i][0]; index < load_distribution[i][1]; index++ {
 			// Get the source DCP nozzle
@@ -293,6 +338,9 @@ func (xdcrf *XDCRFactory) registerAsyncListenersOnSources(pipeline common.Pipeli
 			// For filtering event, register the event ON the router itself to let the router take care of it
 			conn := dcp_part.Connector()
 			conn.RegisterComponentEventListener(common.DataFiltered, data_filtered_event_listener)
+			// transformed data, as well as data that cannot be transformed, is still replicated and only needs to be counted by stats manager
+			conn.RegisterComponentEventListener(common.DataTransformed, data_transformed_event_listener)
+			conn.RegisterComponentEventListener(common.DataUnableToTransform, data_transformed_event_listener)
 			conn.RegisterComponentEventListener(common.DataThroughputThrottled, data_throughput_throttled_event_listener)
 		}
 	}
@@ -479,6 +527,9 @@ func (xdcrf *XDCRFactory) constructOutgoingNozzles(spec *metadata.ReplicationSpe
 
 	var vbCouchApiBaseMap map[uint16]string
 
+	// when transformation rules change document keys, documents may be routed to any target vbucket
+	routeToAllTargetVBs := !isCapiReplication && metadata.TransformationRulesChangeKeys(spec.Settings.GetTransformationRules())
+
 	// For each destination host (kvaddr) and its vbucvket list that it has (kvVBList)
 	for kvaddr, kvVBList := range kvVBMap {
 		if isCapiReplication && len(vbCouchApiBaseMap) == 0 {
@@ -493,6 +544,9 @@ func (xdcrf *XDCRFactory) constructOutgoingNozzles(spec *metadata.ReplicationSpe
 		// Given current Destination node's list of VBucketList and the map of all source nodes -> vbLists
 		// Match the needed vbuckets
 		relevantVBs := xdcrf.filterVBList(kvVBList /* Dest */, kv_vb_map /* source */)
+		if routeToAllTargetVBs {
+			relevantVBs = kvVBList
+		}
 
 		xdcrf.logger.Debugf("kvaddr = %v; kvVbList=%v, relevantVBs=-%v\n", kvaddr, kvVBList, relevantVBs)
 
@@ -519,7 +573,8 @@ func (xdcrf *XDCRFactory) constructOutgoingNozzles(spec *metadata.ReplicationSpe
 					return
 				}
 			} else {
-				connSize := numOfOutNozzles * 2
+				// each xmem nozzle uses one connection for getMeta and the rest for setMeta
+				connSize := numOfOutNozzles * (spec.Settings.GetConnectionsPerTargetNozzle() + 1)
 				outNozzle = xdcrf.constructXMEMNozzle(spec.Id, spec.TargetClusterUUID, kvaddr, spec.SourceBucketName, spec.TargetBucketName, targetUserName, targetPassword, i, connSize, sourceCRMode, targetBucketInfo, logger_ctx)
 			}
 
@@ -543,18 +598,92 @@ func (xdcrf *XDCRFactory) constructOutgoingNozzles(spec *metadata.ReplicationSpe
 	return
 }
 
+/**
+ * Constructs the sink nozzles for replication to a sink
+ * Unlike xmem and capi nozzles, sink nozzles are not tied to target nodes. Source vbuckets on each source node
+ * are evenly distributed among up to TargetNozzlePerNode sink nozzles
+ * Returns:
+ * 1. outNozzles - map of ID -> actual nozzle
+ * 2. vbNozzleMap - map of VBucket# -> nozzle to be used (to be used by router)
+ */
+func (xdcrf *XDCRFactory) constructSinkNozzles(spec *metadata.ReplicationSpecification, kv_vb_map map[string][]uint16,
+	logger_ctx *log.LoggerContext) (outNozzles map[string]common.Nozzle, vbNozzleMap map[uint16]string, err error) {
+	outNozzles = make(map[string]common.Nozzle)
+	vbNozzleMap = make(map[uint16]string)
+
+	sinkName := spec.Settings.RepType
+	constructor, err := parts.GetSinkConstructor(sinkName)
+	if err != nil {
+		return
+	}
+
+	for kvaddr, vbnos := range kv_vb_map {
+		numOfVbs := len(vbnos)
+		if numOfVbs == 0 {
+			continue
+		}
+
+		numOfOutNozzles := min(numOfVbs, spec.Settings.TargetNozzlePerNode)
+		load_distribution := base.BalanceLoad(numOfOutNozzles, numOfVbs)
+		xdcrf.logger.Infof("topic=%v, sink=%v, numOfOutNozzles=%v, numOfVbs=%v, load_distribution=%v\n", spec.Id, sinkName, numOfOutNozzles, numOfVbs, load_distribution)
+
+		for i := 0; i < numOfOutNozzles; i++ {
+			vbList := make([]uint16, 0)
+			for index := load_distribution[i][0]; index < load_distribution[i][1]; index++ {
+				vbList = append(vbList, vbnos[index])
+			}
+
+			var sink parts.Sink
+			sink, err = constructor(&parts.SinkParams{
+				Topic:            spec.Id,
+				SourceBucketName: spec.SourceBucketName,
+				TargetBucketName: spec.TargetBucketName,
+				NozzleIndex:      i,
+				VBList:           vbList,
+				Settings:         spec.Settings.GetSinkSettings(),
+			}, log.NewLogger("Sink", logger_ctx))
+			if err != nil {
+				xdcrf.logger.Errorf("Failed to construct %v sink for %v, err=%v\n", sinkName, spec.Id, err)
+				return
+			}
+
+			// partIds of the sink nozzles look like "sink_$topic_$kvaddr_1"
+			sinkNozzle_Id := xdcrf.partId(SINK_NOZZLE_NAME_PREFIX, spec.Id, kvaddr, i)
+			outNozzle := parts.NewSinkNozzle(sinkNozzle_Id, spec.Id, sinkName, sink, vbList, pipeline_manager.RecycleMCRequestObj, logger_ctx, xdcrf.utils)
+			outNozzles[outNozzle.Id()] = outNozzle
+
+			for _, vbno := range vbList {
+				vbNozzleMap[vbno] = outNozzle.Id()
+			}
+
+			xdcrf.logger.Debugf("Constructed out nozzle %v\n", outNozzle.Id())
+		}
+	}
+
+	if len(outNozzles) == 0 {
+		err = base.ErrorNoTargetNozzle
+		return
+	}
+
+	xdcrf.logger.Infof("Constructed %v sink nozzles\n", len(outNozzles))
+	xdcrf.logger.Debugf("vbNozzleMap = %v\n", vbNozzleMap)
+	return
+}
+
 func (xdcrf *XDCRFactory) constructRouter(id string, spec *metadata.ReplicationSpecification,
 	downStreamParts map[string]common.Part,
 	vbNozzleMap map[uint16]string,
 	sourceCRMode base.ConflictResolutionMode,
+	targetVBCount int,
 	logger_ctx *log.LoggerContext) (*parts.Router, error) {
 	routerId := "Router" + PART_NAME_DELIMITER + id
 	// when initializing router, isHighReplication is set to true only if replication priority is High
 	// for replications with Medium priority and ongoing flag set, isHighReplication will be updated to true
 	// through a UpdateSettings() call to the router in the pipeline startup sequence before parts are started
 	router, err := parts.NewRouter(routerId, spec.Id, spec.Settings.FilterExpression, downStreamParts, vbNozzleMap, sourceCRMode,
-		logger_ctx, pipeline_manager.NewMCRequestObj, xdcrf.utils, xdcrf.throughput_throttler_svc,
-		spec.Settings.GetPriority() == base.PriorityTypeHigh, spec.Settings.GetExpDelMode())
+		logger_ctx, pipeline_manager.NewMCRequestObj, pipeline_manager.RecycleMCRequestObj, xdcrf.utils, xdcrf.throughput_throttler_svc,
+		spec.Settings.GetPriority() == base.PriorityTypeHigh, spec.Settings.GetExpDelMode(), spec.Settings.GetTransformationRules(),
+		spec.Settings.GetBoundedRange(), targetVBCount)
 	if err != nil {
 		xdcrf.logger.Errorf("Error (%v) constructing router %v", err.Error(), routerId)
 	} else {
@@ -570,6 +699,9 @@ func (xdcrf *XDCRFactory) getOutNozzleType(targetClusterRef *metadata.RemoteClus
 	case metadata.ReplicationTypeCapi:
 		return base.Capi, nil
 	default:
+		if base.ValidateSink(spec.Settings.RepType) == nil {
+			return base.Sink, nil
+		}
 		// should never get here
 		return -1, errors.New(fmt.Sprintf("Invalid replication type %v", spec.Settings.RepType))
 	}
@@ -591,6 +723,7 @@ func (xdcrf *XDCRFactory) constructXMEMNozzle(topic string,
 	xmemNozzle_Id := xdcrf.partId(XMEM_NOZZLE_NAME_PREFIX, topic, kvaddr, nozzle_index)
 	nozzle := parts.NewXmemNozzle(xmemNozzle_Id, xdcrf.remote_cluster_svc, targetClusterUuid, topic, topic, connPoolSize, kvaddr, sourceBucketName, targetBucketName,
 		username, password, pipeline_manager.RecycleMCRequestObj, sourceCRMode, logger_ctx, xdcrf.utils)
+	nozzle.SetConflictLogSvc(xdcrf.conflict_log_svc)
 	return nozzle
 }
 
@@ -637,6 +770,9 @@ func (xdcrf *XDCRFactory) ConstructSettingsForPart(pipeline common.Pipeline, par
 	} else if _, ok := part.(*parts.CapiNozzle); ok {
 		xdcrf.logger.Debugf("Construct settings for CapiNozzle %s", part.Id())
 		return xdcrf.constructSettingsForCapiNozzle(pipeline, settings)
+	} else if _, ok := part.(*parts.SinkNozzle); ok {
+		xdcrf.logger.Debugf("Construct settings for SinkNozzle %s", part.Id())
+		return xdcrf.constructSettingsForSinkNozzle(pipeline, settings)
 	} else {
 		return settings, nil
 	}
@@ -685,6 +821,16 @@ func (xdcrf *XDCRFactory) constructUpdateSettingsForXmemNozzle(pipeline common.P
 		xmemSettings[parts.SETTING_OPTI_REP_THRESHOLD] = optiRepThreshold
 	}
 
+	conflictLogging, ok := settings[metadata.ConflictLoggingKey]
+	if ok {
+		xmemSettings[parts.XMEM_SETTING_CONFLICT_LOGGING] = conflictLogging
+	}
+
+	targetBatchLatency, ok := settings[metadata.TargetBatchLatencyKey]
+	if ok {
+		xmemSettings[parts.XMEM_SETTING_TARGET_BATCH_LATENCY] = time.Duration(targetBatchLatency.(int)) * time.Millisecond
+	}
+
 	return xmemSettings
 
 }
@@ -759,6 +905,10 @@ func (xdcrf *XDCRFactory) constructSettingsForXmemNozzle(pipeline common.Pipelin
 	xmemSettings[parts.SETTING_OPTI_REP_THRESHOLD] = getSettingFromSettingsMap(settings, metadata.OptimisticReplicationThresholdKey, repSettings.OptimisticReplicationThreshold)
 	xmemSettings[parts.SETTING_STATS_INTERVAL] = getSettingFromSettingsMap(settings, metadata.PipelineStatsIntervalKey, repSettings.StatsInterval)
 	xmemSettings[parts.SETTING_COMPRESSION_TYPE] = base.GetCompressionType(getSettingFromSettingsMap(settings, metadata.CompressionTypeKey, repSettings.CompressionType).(int))
+	xmemSettings[parts.XMEM_SETTING_CONFLICT_RESOLVER] = getSettingFromSettingsMap(settings, metadata.ConflictResolverKey, repSettings.GetConflictResolver())
+	xmemSettings[parts.XMEM_SETTING_CONFLICT_LOGGING] = getSettingFromSettingsMap(settings, metadata.ConflictLoggingKey, repSettings.GetConflictLogging())
+	xmemSettings[parts.XMEM_SETTING_TARGET_BATCH_LATENCY] = time.Duration(getSettingFromSettingsMap(settings, metadata.TargetBatchLatencyKey, repSettings.GetTargetBatchLatency()).(int)) * time.Millisecond
+	xmemSettings[parts.XMEM_SETTING_SETMETA_CONNECTIONS] = getSettingFromSettingsMap(settings, metadata.ConnectionsPerTargetNozzleKey, repSettings.GetConnectionsPerTargetNozzle())
 
 	xmemSettings[parts.XMEM_SETTING_DEMAND_ENCRYPTION] = targetClusterRef.DemandEncryption()
 	xmemSettings[parts.XMEM_SETTING_CERTIFICATE] = targetClusterRef.Certificate()
@@ -795,6 +945,17 @@ func (xdcrf *XDCRFactory) constructSettingsForCapiNozzle(pipeline common.Pipelin
 
 }
 
+func (xdcrf *XDCRFactory) constructSettingsForSinkNozzle(pipeline common.Pipeline, settings metadata.ReplicationSettingsMap) (map[string]interface{}, error) {
+	sinkSettings := make(metadata.ReplicationSettingsMap)
+	repSettings := pipeline.Specification().Settings
+
+	sinkSettings[parts.SETTING_BATCHCOUNT] = getSettingFromSettingsMap(settings, metadata.BatchCountKey, repSettings.BatchCount)
+	sinkSettings[parts.SETTING_BATCHSIZE] = getSettingFromSettingsMap(settings, metadata.BatchSizeKey, repSettings.BatchSize)
+	sinkSettings[parts.SETTING_STATS_INTERVAL] = getSettingFromSettingsMap(settings, metadata.PipelineStatsIntervalKey, repSettings.StatsInterval)
+
+	return sinkSettings, nil
+}
+
 func (xdcrf *XDCRFactory) getTargetTimeoutEstimate(topic string) time.Duration {
 	//TODO: implement
 	//need to get the tcp ping time for the estimate
@@ -814,8 +975,8 @@ func (xdcrf *XDCRFactory) constructSettingsForDcpNozzle(pipeline common.Pipeline
 
 	dcpNozzleSettings[parts.DCP_VBTimestampUpdater] = ckpt_svc.(*pipeline_svc.CheckpointManager).UpdateVBTimestamps
 	dcpNozzleSettings[parts.DCP_Stats_Interval] = getSettingFromSettingsMap(settings, metadata.PipelineStatsIntervalKey, repSettings.StatsInterval)
-	if repSettings.IsCapi() {
-		// For CAPI nozzle, do not allow DCP to have compression
+	if repSettings.IsCapi() || repSettings.IsSink() {
+		// For CAPI and sink nozzles, do not allow DCP to have compression
 		dcpNozzleSettings[parts.SETTING_COMPRESSION_TYPE] = (base.CompressionType)(base.CompressionTypeNone)
 	} else {
 		dcpNozzleSettings[parts.SETTING_COMPRESSION_TYPE] = base.GetCompressionType(getSettingFromSettingsMap(settings, metadata.CompressionTypeKey, repSettings.CompressionType).(int))
@@ -827,6 +988,11 @@ func (xdcrf *XDCRFactory) constructSettingsForDcpNozzle(pipeline common.Pipeline
 		dcpNozzleSettings[parts.DCP_Priority] = dcpPriority
 	}
 
+	if boundedRange := repSettings.GetBoundedRange(); boundedRange != nil {
+		dcpNozzleSettings[parts.DCP_BoundedRange] = boundedRange
+		dcpNozzleSettings[parts.DCP_BoundedEndSeqnoGetter] = ckpt_svc.(*pipeline_svc.CheckpointManager).GetBoundedEndSeqno
+	}
+
 	return dcpNozzleSettings, nil
 }
 
@@ -843,13 +1009,18 @@ func (xdcrf *XDCRFactory) constructSettingsForRouter(pipeline common.Pipeline, s
 		routerSettings[parts.FilterExpDelKey] = filterExpDelMode
 	}
 
+	filterDelExpFallback, ok := settings[parts.FilterDelExpFallbackKey]
+	if ok {
+		routerSettings[parts.FilterDelExpFallbackKey] = filterDelExpFallback
+	}
+
 	return routerSettings, nil
 }
 
 func (xdcrf *XDCRFactory) registerServices(pipeline common.Pipeline, logger_ctx *log.LoggerContext,
 	kv_vb_map map[string][]uint16, targetUserName, targetPassword string, targetBucketName string,
 	target_kv_vb_map map[string][]uint16, targetClusterRef *metadata.RemoteClusterReference,
-	targetClusterVersion int, isCapi bool, isTargetES bool) error {
+	targetClusterVersion int, isCapi bool, isTargetES bool, isSink bool) error {
 
 	ctx := pipeline.RuntimeContext()
 
@@ -890,14 +1061,15 @@ func (xdcrf *XDCRFactory) registerServices(pipeline common.Pipeline, logger_ctx
 	}
 
 	//register topology change detect service
-	targetHasRBACAndXattrSupport := base.IsClusterCompatible(targetClusterVersion, base.VersionForRBACAndXattrSupport)
+	// sinks receive xattrs along with the document body
+	targetHasRBACAndXattrSupport := isSink || base.IsClusterCompatible(targetClusterVersion, base.VersionForRBACAndXattrSupport)
 	top_detect_svc := pipeline_svc.NewTopologyChangeDetectorSvc(xdcrf.cluster_info_svc, xdcrf.xdcr_topology_svc, xdcrf.remote_cluster_svc, xdcrf.repl_spec_svc, targetHasRBACAndXattrSupport, logger_ctx, xdcrf.utils)
 	err = ctx.RegisterService(base.TOPOLOGY_CHANGE_DETECT_SVC, top_detect_svc)
 	if err != nil {
 		return err
 	}
 
-	if !isCapi {
+	if !isCapi && !isSink {
 		//register bandwidth throttler service
 		bw_throttler_svc := pipeline_svc.NewBandwidthThrottlerSvc(xdcrf.xdcr_topology_svc, logger_ctx)
 		err = ctx.RegisterService(base.BANDWIDTH_THROTTLER_SVC, bw_throttler_svc)
@@ -1023,6 +1195,11 @@ func (xdcrf *XDCRFactory) constructUpdateSettingsForBandwidthThrottler(pipeline
 	if number_of_source_nodes != nil {
 		s[pipeline_svc.NUMBER_OF_SOURCE_NODES] = number_of_source_nodes
 	}
+	bandwidth_profile := settings[metadata.BandwidthProfileKey]
+	if bandwidth_profile != nil {
+		s[pipeline_svc.BANDWIDTH_PROFILE] = bandwidth_profile
+		s[pipeline_svc.BANDWIDTH_PROFILE_TIMEZONE] = getSettingFromSettingsMap(settings, metadata.ScheduleTimezoneKey, pipeline.Specification().Settings.GetScheduleTimezone())
+	}
 	return s, nil
 }
 
@@ -61,6 +61,14 @@ func (writer *RotatingLogFileWriter) Write(data []byte) (n int, err error) {
 	}
 }
 
+// close the current log file. writer cannot be used after it is closed
+func (writer *RotatingLogFileWriter) Close() error {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	return writer.logFile.Close()
+}
+
 // get the number of log files by looking for existing log files with the highest postfix  
 func (writer *RotatingLogFileWriter) getNumberOfRotatedFiles() (uint64, error){
 	for i:= writer.maxNumberOfLogFiles; i >1; i-- {
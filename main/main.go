@@ -15,6 +15,7 @@ import (
 	base "github.com/couchbase/goxdcr/base"
 	log "github.com/couchbase/goxdcr/log"
 	"github.com/couchbase/goxdcr/metadata_svc"
+	"github.com/couchbase/goxdcr/parts"
 	rm "github.com/couchbase/goxdcr/replication_manager"
 	"github.com/couchbase/goxdcr/service_def"
 	"github.com/couchbase/goxdcr/service_impl"
@@ -35,6 +36,11 @@ var options struct {
 	isIpv6               bool   // whether couchbase supports ipv6
 	isConvert            bool   // whether xdcr is running in conversion/upgrade mode
 
+	// directory for file based metadata store. metakv is used when it is not specified
+	metadataDir string
+	// bucket for storing checkpoint docs as system documents. checkpoint docs are stored in metakv when it is not specified
+	checkpointBucket string
+
 	// logging related parameters
 	logFileDir          string
 	maxLogFileSize      uint64
@@ -57,6 +63,10 @@ func argParse() {
 		"whether couchbase supports ipv6")
 	flag.BoolVar(&options.isConvert, "isConvert", false,
 		"whether xdcr is running in convertion/upgrade mode")
+	flag.StringVar(&options.metadataDir, "metadataDir", "",
+		"directory for storing metadata locally instead of in metakv, e.g., for development and testing")
+	flag.StringVar(&options.checkpointBucket, "checkpointBucket", "",
+		"bucket for storing checkpoints instead of in metakv. needs to be the same on all nodes. existing checkpoints are migrated through the checkpointsMigration REST API")
 
 	flag.StringVar(&options.logFileDir, "logFileDir", "",
 		"directory for couchbase server logs")
@@ -71,9 +81,14 @@ func argParse() {
 func usage() {
 	fmt.Fprintf(os.Stderr, "Usage : %s [OPTIONS] \n", os.Args[0])
 	flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "       %s %s %s|%s [OPTIONS] \n", os.Args[0], TopologyCommand, topologyExportAction, topologyImportAction)
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == TopologyCommand {
+		os.Exit(runTopologyCommand(os.Args[2:]))
+	}
+
 	HideConsole(true)
 	defer HideConsole(false)
 
@@ -89,6 +104,23 @@ func main() {
 	// Initializes official utility object to be used throughout
 	utils := utilities.NewUtilities()
 
+	// registers built-in sinks, which can be selected as replication type
+	err := parts.RegisterSink(base.SinkTypeFile, parts.NewFileSinkConstructor(options.logFileDir))
+	if err != nil {
+		fmt.Printf("Error registering file sink. err=%v\n", err)
+		os.Exit(1)
+	}
+	err = parts.RegisterSink(base.SinkTypeKafka, parts.NewKafkaSink)
+	if err != nil {
+		fmt.Printf("Error registering kafka sink. err=%v\n", err)
+		os.Exit(1)
+	}
+	err = parts.RegisterSink(base.SinkTypeHttp, parts.NewHttpSink)
+	if err != nil {
+		fmt.Printf("Error registering http sink. err=%v\n", err)
+		os.Exit(1)
+	}
+
 	cluster_info_svc := service_impl.NewClusterInfoSvc(nil, utils)
 	top_svc, err := service_impl.NewXDCRTopologySvc(uint16(options.sourceKVAdminPort), uint16(options.xdcrRestPort), options.isEnterprise, options.isIpv6, cluster_info_svc, nil, utils)
 	if err != nil {
@@ -98,7 +130,7 @@ func main() {
 
 	host := top_svc.GetLocalHostName()
 
-	metakv_svc, err := metadata_svc.NewMetaKVMetadataSvc(nil, utils)
+	metakv_svc, err := newMetadataSvc(utils)
 	if err != nil {
 		fmt.Printf("Error starting metadata service. err=%v\n", err)
 		os.Exit(1)
@@ -120,13 +152,13 @@ func main() {
 	bucketSettings_svc := metadata_svc.NewBucketSettingsService(metakv_svc, top_svc, nil, utils)
 
 	if options.isConvert {
-		// disable uilogging during upgrade by specifying a nil uilog service
-		remote_cluster_svc, err := metadata_svc.NewRemoteClusterService(nil, metakv_svc, top_svc, cluster_info_svc, nil, utils)
+		// disable uilogging and notifications during upgrade by specifying nil uilog and notification services
+		remote_cluster_svc, err := metadata_svc.NewRemoteClusterService(nil, nil, metakv_svc, top_svc, cluster_info_svc, nil, utils)
 		if err != nil {
 			fmt.Printf("Error starting remote cluster service. err=%v\n", err)
 			os.Exit(1)
 		}
-		replication_spec_svc, err := metadata_svc.NewReplicationSpecService(nil, remote_cluster_svc, metakv_svc, top_svc, cluster_info_svc, nil, utils)
+		replication_spec_svc, err := metadata_svc.NewReplicationSpecService(nil, nil, remote_cluster_svc, metakv_svc, top_svc, cluster_info_svc, nil, utils)
 		if err != nil {
 			fmt.Printf("Error starting replication spec service. err=%v\n", err)
 			os.Exit(1)
@@ -145,12 +177,14 @@ func main() {
 		}
 	} else {
 		uilog_svc := service_impl.NewUILogSvc(top_svc, nil, utils)
-		remote_cluster_svc, err := metadata_svc.NewRemoteClusterService(uilog_svc, metakv_svc, top_svc, cluster_info_svc, nil, utils)
+		webhook_svc := metadata_svc.NewWebhookService(metakv_svc, nil)
+		notification_svc := service_impl.NewNotificationSvc(webhook_svc, top_svc, nil)
+		remote_cluster_svc, err := metadata_svc.NewRemoteClusterService(uilog_svc, notification_svc, metakv_svc, top_svc, cluster_info_svc, nil, utils)
 		if err != nil {
 			fmt.Printf("Error starting remote cluster service. err=%v\n", err)
 			os.Exit(1)
 		}
-		replication_spec_svc, err := metadata_svc.NewReplicationSpecService(uilog_svc, remote_cluster_svc, metakv_svc, top_svc, cluster_info_svc, nil, utils)
+		replication_spec_svc, err := metadata_svc.NewReplicationSpecService(uilog_svc, notification_svc, remote_cluster_svc, metakv_svc, top_svc, cluster_info_svc, nil, utils)
 		if err != nil {
 			fmt.Printf("Error starting replication spec service. err=%v\n", err)
 			os.Exit(1)
@@ -158,6 +192,12 @@ func main() {
 
 		internalSettings_svc := metadata_svc.NewInternalSettingsSvc(metakv_svc, nil)
 
+		checkpoints_svc, err := newCheckpointsSvc(metakv_svc, top_svc, replication_spec_svc, utils)
+		if err != nil {
+			fmt.Printf("Error starting checkpoints service. err=%v\n", err)
+			os.Exit(1)
+		}
+
 		// start replication manager in normal mode
 		rm.StartReplicationManager(host,
 			uint16(options.xdcrRestPort),
@@ -167,7 +207,7 @@ func main() {
 			cluster_info_svc,
 			top_svc,
 			metadata_svc.NewReplicationSettingsSvc(metakv_svc, nil),
-			metadata_svc.NewCheckpointsService(metakv_svc, nil),
+			checkpoints_svc,
 			service_impl.NewCAPIService(cluster_info_svc, nil, utils),
 			audit_svc,
 			uilog_svc,
@@ -175,6 +215,10 @@ func main() {
 			bucketSettings_svc,
 			internalSettings_svc,
 			service_impl.NewThroughputThrottlerSvc(nil),
+			service_impl.NewConflictLogSvc(options.logFileDir, nil),
+			webhook_svc,
+			notification_svc,
+			service_impl.NewDiffSvc(remote_cluster_svc, cluster_info_svc, top_svc, options.logFileDir, nil, utils),
 			utils)
 
 		// keep main alive in normal mode
@@ -182,6 +226,88 @@ func main() {
 	}
 }
 
+// metadata is stored in metakv unless metadataDir is specified
+func newMetadataSvc(utils utilities.UtilsIface) (service_def.MetadataSvc, error) {
+	if options.metadataDir == "" {
+		return metadata_svc.NewMetaKVMetadataSvc(nil, utils)
+	}
+
+	file_svc, err := metadata_svc.NewFileMetadataSvc(options.metadataDir, nil)
+	if err != nil {
+		return nil, err
+	}
+	// metadata change listeners need to observe the file based metadata store instead of metakv
+	rm.SetMetadataChangeObserver(file_svc)
+	return file_svc, nil
+}
+
+// checkpoint docs are stored in metakv unless checkpointBucket is specified
+// checkpoint docs that are not found in the configured backend are read from the previous backend, i.e., metakv when
+// checkpointBucket is specified, or the bucket that has last been configured when it is not, until they are migrated
+// through the checkpointsMigration REST API. this way nodes keep reading existing checkpoint docs during rolling restarts
+// the checkpoint bucket cannot be the source bucket of a replication, since checkpoint docs would be replicated along with its data
+func newCheckpointsSvc(metakv_svc service_def.MetadataSvc, top_svc service_def.XDCRCompTopologySvc,
+	replication_spec_svc service_def.ReplicationSpecSvc, utils utilities.UtilsIface) (service_def.CheckpointsService, error) {
+	if options.checkpointBucket != "" {
+		specs, err := replication_spec_svc.AllReplicationSpecs()
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range specs {
+			if spec.SourceBucketName == options.checkpointBucket {
+				return nil, fmt.Errorf("checkpointBucket %v is the source bucket of replication %v", options.checkpointBucket, spec.Id)
+			}
+		}
+	}
+
+	ckpt_meta_svc, err := newCheckpointsMetadataSvc(metakv_svc, top_svc, options.checkpointBucket, utils)
+	if err != nil {
+		return nil, err
+	}
+
+	lastBucket, rev, err := metadata_svc.GetCheckpointsBucket(metakv_svc)
+	if err != nil {
+		return nil, err
+	}
+
+	var fallback_meta_svc service_def.MetadataSvc
+	if options.checkpointBucket != "" {
+		fallback_meta_svc = metakv_svc
+		if lastBucket != options.checkpointBucket {
+			// let nodes that still store checkpoint docs in metakv read checkpoint docs from the bucket
+			err = metadata_svc.SetCheckpointsBucket(metakv_svc, options.checkpointBucket, rev)
+			if err != nil && err != service_def.ErrorRevisionMismatch {
+				return nil, err
+			}
+		}
+	} else if lastBucket != "" {
+		fallback_meta_svc, err = newCheckpointsMetadataSvc(metakv_svc, top_svc, lastBucket, utils)
+		if err != nil {
+			// e.g., when the bucket has been deleted
+			fmt.Printf("Unable to read checkpoints from bucket %v. err=%v\n", lastBucket, err)
+			fallback_meta_svc = nil
+		}
+	}
+
+	return metadata_svc.NewCheckpointsServiceWithFallback(ckpt_meta_svc, fallback_meta_svc, nil), nil
+}
+
+func newCheckpointsMetadataSvc(metakv_svc service_def.MetadataSvc, top_svc service_def.XDCRCompTopologySvc, bucketName string,
+	utils utilities.UtilsIface) (service_def.MetadataSvc, error) {
+	if bucketName == "" {
+		return metakv_svc, nil
+	}
+	connStr, err := top_svc.MyConnectionStr()
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := utils.LocalBucket(connStr, bucketName)
+	if err != nil {
+		return nil, err
+	}
+	return metadata_svc.NewBucketMetadataSvc(bucket, nil), nil
+}
+
 // wait [for an upward of 30 seconds] for metadata service to become available
 func waitForMetadataService(metakv_svc service_def.MetadataSvc) error {
 	num_retry := 0
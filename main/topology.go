@@ -0,0 +1,147 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	base "github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/metadata"
+	rm "github.com/couchbase/goxdcr/replication_manager"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// name of the subcommand for exporting and importing replication topology through the rest api of a running xdcr process
+const TopologyCommand = "topology"
+
+const (
+	topologyExportAction = "export"
+	topologyImportAction = "import"
+)
+
+var topologyOptions struct {
+	hostName     string
+	xdcrRestPort uint64
+	userName     string
+	password     string
+	credentials  string
+	passphrase   string
+	file         string
+}
+
+func topologyUsage(flagSet *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(os.Stderr, "Usage : %s %s %s|%s [OPTIONS] \n", os.Args[0], TopologyCommand, topologyExportAction, topologyImportAction)
+		flagSet.PrintDefaults()
+	}
+}
+
+// runs topology subcommand and returns exit code
+// export writes topology document to file, or to stdout when file is not specified
+// import reads topology document from file, or from stdin when file is not specified, and prints the import result
+func runTopologyCommand(args []string) int {
+	flagSet := flag.NewFlagSet(TopologyCommand, flag.ContinueOnError)
+	flagSet.Usage = topologyUsage(flagSet)
+	flagSet.StringVar(&topologyOptions.hostName, "hostName", base.LocalHostName,
+		"host name of xdcr rest server")
+	flagSet.Uint64Var(&topologyOptions.xdcrRestPort, "xdcrRestPort", uint64(base.AdminportNumber),
+		"port number of xdcr rest server")
+	flagSet.StringVar(&topologyOptions.userName, "username", "",
+		"user name of full admin")
+	flagSet.StringVar(&topologyOptions.password, "password", "",
+		"password of full admin")
+	flagSet.StringVar(&topologyOptions.credentials, "credentials", metadata.TopologyCredentialsRedacted,
+		"how credentials of remote cluster references are exported, redacted or encrypted")
+	flagSet.StringVar(&topologyOptions.passphrase, "passphrase", "",
+		"passphrase for encrypting or decrypting credentials of remote cluster references")
+	flagSet.StringVar(&topologyOptions.file, "file", "",
+		"file to write exported topology document to, or to read topology document to be imported from")
+
+	if len(args) == 0 || (args[0] != topologyExportAction && args[0] != topologyImportAction) {
+		flagSet.Usage()
+		return 1
+	}
+	action := args[0]
+	if err := flagSet.Parse(args[1:]); err != nil {
+		return 1
+	}
+
+	form := make(url.Values)
+	var path string
+	if action == topologyExportAction {
+		path = rm.TopologyExportPath
+		form.Set(rm.TopologyCredentials, topologyOptions.credentials)
+	} else {
+		path = rm.TopologyImportPath
+		var doc []byte
+		var err error
+		if topologyOptions.file != "" {
+			doc, err = ioutil.ReadFile(topologyOptions.file)
+		} else {
+			doc, err = ioutil.ReadAll(os.Stdin)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading topology document. err=%v\n", err)
+			return 1
+		}
+		form.Set(rm.TopologyDocument, string(doc))
+	}
+	if topologyOptions.passphrase != "" {
+		form.Set(rm.TopologyPassphrase, topologyOptions.passphrase)
+	}
+
+	body, err := postTopologyRequest(path, form)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error running %v %v. err=%v\n", TopologyCommand, action, err)
+		return 1
+	}
+
+	if action == topologyExportAction && topologyOptions.file != "" {
+		// topology document may contain encrypted credentials
+		err = ioutil.WriteFile(topologyOptions.file, body, 0600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing topology document. err=%v\n", err)
+			return 1
+		}
+	} else {
+		fmt.Printf("%s\n", body)
+	}
+	return 0
+}
+
+func postTopologyRequest(path string, form url.Values) ([]byte, error) {
+	requestUrl := fmt.Sprintf("http://%v%v%v", base.GetHostAddr(topologyOptions.hostName, uint16(topologyOptions.xdcrRestPort)),
+		base.AdminportUrlPrefix, path)
+	request, err := http.NewRequest(base.MethodPost, requestUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set(base.ContentType, base.DefaultContentType)
+	request.SetBasicAuth(topologyOptions.userName, topologyOptions.password)
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status=%v, response=%s", response.Status, body)
+	}
+	return body, nil
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BoundedRangeEntryDelimiter = ";"
+	BoundedRangeVBDelimiter    = ":"
+	BoundedRangeDelimiter      = "-"
+	BoundedTimeRangeDelimiter  = "/"
+	// vbucket specifier in seqno range that covers all vbuckets that are not listed explicitly
+	BoundedRangeAllVBs = "*"
+)
+
+// range of seqnos [Start, End] in a vbucket
+type SeqnoRange struct {
+	Start uint64
+	End   uint64
+}
+
+// BoundedRange is the parsed form of the bounded_seqno_range and bounded_time_range settings of a replication.
+// seqno range looks like "*:0-5000;0-511:100-8000;1023:0-0"
+// entries for specific vbuckets or vbucket ranges override the "*" entry. when seqno range is specified,
+// vbuckets not covered by any entry are not replicated.
+// time range looks like "2019-06-01T00:00:00Z/2019-06-02T00:00:00Z", and limits the documents replicated
+// to the ones whose cas, i.e., last modification time, falls into [start, end)
+type BoundedRange struct {
+	// nil when seqno range is not specified
+	vbSeqnoRanges   map[uint16]*SeqnoRange
+	allVBSeqnoRange *SeqnoRange
+	// zero when time range is not specified
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// returns nil BoundedRange when neither range is specified, i.e., when replication is not bounded
+func ParseBoundedRange(seqnoRange, timeRange string) (*BoundedRange, error) {
+	if len(seqnoRange) == 0 && len(timeRange) == 0 {
+		return nil, nil
+	}
+
+	boundedRange := &BoundedRange{}
+	if len(seqnoRange) > 0 {
+		err := boundedRange.parseSeqnoRange(seqnoRange)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(timeRange) > 0 {
+		err := boundedRange.parseTimeRange(timeRange)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return boundedRange, nil
+}
+
+func (boundedRange *BoundedRange) parseSeqnoRange(seqnoRange string) error {
+	boundedRange.vbSeqnoRanges = make(map[uint16]*SeqnoRange)
+	for _, entryStr := range strings.Split(seqnoRange, BoundedRangeEntryDelimiter) {
+		entryStr = strings.TrimSpace(entryStr)
+		if len(entryStr) == 0 {
+			continue
+		}
+		parts := strings.Split(entryStr, BoundedRangeVBDelimiter)
+		if len(parts) != 2 {
+			return fmt.Errorf("Seqno range entry %v is not in the form of \"<vbuckets>:<start seqno>-<end seqno>\"", entryStr)
+		}
+
+		startSeqno, endSeqno, err := parseUint64Range(parts[1], false /*allowSingleValue*/)
+		if err != nil {
+			return fmt.Errorf("Invalid seqno range %v in entry %v", parts[1], entryStr)
+		}
+		if startSeqno > endSeqno {
+			return fmt.Errorf("Start seqno is larger than end seqno in entry %v", entryStr)
+		}
+		entry := &SeqnoRange{Start: startSeqno, End: endSeqno}
+
+		if parts[0] == BoundedRangeAllVBs {
+			if boundedRange.allVBSeqnoRange != nil {
+				return fmt.Errorf("Seqno range %v contains more than one entry for all vbuckets", seqnoRange)
+			}
+			boundedRange.allVBSeqnoRange = entry
+			continue
+		}
+
+		firstVB, lastVB, err := parseUint64Range(parts[0], true /*allowSingleValue*/)
+		if err != nil || firstVB > lastVB || lastVB > math.MaxUint16 {
+			return fmt.Errorf("Invalid vbuckets %v in entry %v", parts[0], entryStr)
+		}
+		for vbno := firstVB; vbno <= lastVB; vbno++ {
+			if _, ok := boundedRange.vbSeqnoRanges[uint16(vbno)]; ok {
+				return fmt.Errorf("Seqno range %v contains more than one entry for vbucket %v", seqnoRange, vbno)
+			}
+			boundedRange.vbSeqnoRanges[uint16(vbno)] = entry
+		}
+	}
+
+	if boundedRange.allVBSeqnoRange == nil && len(boundedRange.vbSeqnoRanges) == 0 {
+		return fmt.Errorf("Seqno range %v does not contain any entry", seqnoRange)
+	}
+	return nil
+}
+
+// parses "<start>-<end>", or "<value>" when allowSingleValue is true
+func parseUint64Range(rangeStr string, allowSingleValue bool) (uint64, uint64, error) {
+	parts := strings.Split(rangeStr, BoundedRangeDelimiter)
+	if len(parts) > 2 || (len(parts) == 1 && !allowSingleValue) {
+		return 0, 0, fmt.Errorf("Invalid range %v", rangeStr)
+	}
+	start, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	end := start
+	if len(parts) == 2 {
+		end, err = strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return start, end, nil
+}
+
+func (boundedRange *BoundedRange) parseTimeRange(timeRange string) error {
+	parts := strings.Split(timeRange, BoundedTimeRangeDelimiter)
+	if len(parts) != 2 {
+		return fmt.Errorf("Time range %v is not in the form of \"<start time>/<end time>\"", timeRange)
+	}
+	var err error
+	boundedRange.StartTime, err = time.Parse(time.RFC3339, strings.TrimSpace(parts[0]))
+	if err != nil {
+		return fmt.Errorf("Invalid start time %v. Time needs to be in RFC3339 format, e.g., 2019-06-01T00:00:00Z", parts[0])
+	}
+	boundedRange.EndTime, err = time.Parse(time.RFC3339, strings.TrimSpace(parts[1]))
+	if err != nil {
+		return fmt.Errorf("Invalid end time %v. Time needs to be in RFC3339 format, e.g., 2019-06-01T00:00:00Z", parts[1])
+	}
+	if !boundedRange.StartTime.Before(boundedRange.EndTime) {
+		return fmt.Errorf("Start time needs to be earlier than end time in time range %v", timeRange)
+	}
+	return nil
+}
+
+func (boundedRange *BoundedRange) HasSeqnoRange() bool {
+	return boundedRange.vbSeqnoRanges != nil
+}
+
+func (boundedRange *BoundedRange) HasTimeRange() bool {
+	return !boundedRange.EndTime.IsZero()
+}
+
+// returns the seqno range of the specified vbucket.
+// ok is false when seqno range is not specified, in which case the end seqno of the vbucket
+// needs to be determined by the caller, e.g., as the high seqno of the vbucket when replication starts.
+// vbuckets not covered by the seqno range get an empty range, [0, 0]
+func (boundedRange *BoundedRange) SeqnoRange(vbno uint16) (seqnoRange SeqnoRange, ok bool) {
+	if !boundedRange.HasSeqnoRange() {
+		return
+	}
+	ok = true
+	if entry, found := boundedRange.vbSeqnoRanges[vbno]; found {
+		seqnoRange = *entry
+	} else if boundedRange.allVBSeqnoRange != nil {
+		seqnoRange = *boundedRange.allVBSeqnoRange
+	}
+	return
+}
+
+// whether a document with the specified cas falls into the time range.
+// cas is a hybrid logical clock whose value is close to the wall clock time, in nanoseconds, of the last modification of the document
+func (boundedRange *BoundedRange) InTimeRange(cas uint64) bool {
+	if !boundedRange.HasTimeRange() {
+		return true
+	}
+	modTime := int64(cas)
+	return modTime >= boundedRange.StartTime.UnixNano() && modTime < boundedRange.EndTime.UnixNano()
+}
+
+// whether a mutation with the specified vbucket, seqno and cas falls into the range
+func (boundedRange *BoundedRange) Contains(vbno uint16, seqno uint64, cas uint64) bool {
+	if seqnoRange, ok := boundedRange.SeqnoRange(vbno); ok {
+		if seqno < seqnoRange.Start || seqno > seqnoRange.End {
+			return false
+		}
+	}
+	return boundedRange.InTimeRange(cas)
+}
@@ -0,0 +1,72 @@
+// +build !pcre
+
+package metadata
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseBoundedRange(t *testing.T) {
+	fmt.Println("============== Test case start: TestParseBoundedRange =================")
+	assert := assert.New(t)
+
+	boundedRange, err := ParseBoundedRange("", "")
+	assert.Nil(err)
+	assert.Nil(boundedRange)
+
+	boundedRange, err = ParseBoundedRange("*:0-5000;0-511:100-8000;1023:0-0", "")
+	assert.Nil(err)
+	assert.True(boundedRange.HasSeqnoRange())
+	assert.False(boundedRange.HasTimeRange())
+	seqnoRange, ok := boundedRange.SeqnoRange(0)
+	assert.True(ok)
+	assert.Equal(SeqnoRange{100, 8000}, seqnoRange)
+	seqnoRange, _ = boundedRange.SeqnoRange(511)
+	assert.Equal(SeqnoRange{100, 8000}, seqnoRange)
+	seqnoRange, _ = boundedRange.SeqnoRange(512)
+	assert.Equal(SeqnoRange{0, 5000}, seqnoRange)
+	seqnoRange, _ = boundedRange.SeqnoRange(1023)
+	assert.Equal(SeqnoRange{0, 0}, seqnoRange)
+	assert.True(boundedRange.Contains(0, 100, 0))
+	assert.False(boundedRange.Contains(0, 99, 0))
+	assert.False(boundedRange.Contains(0, 8001, 0))
+	assert.True(boundedRange.Contains(600, 5000, 0))
+
+	// vbuckets not covered by seqno range get an empty range
+	boundedRange, err = ParseBoundedRange("1:10-20", "")
+	assert.Nil(err)
+	seqnoRange, ok = boundedRange.SeqnoRange(2)
+	assert.True(ok)
+	assert.Equal(SeqnoRange{0, 0}, seqnoRange)
+	assert.False(boundedRange.Contains(2, 1, 0))
+
+	// invalid seqno ranges
+	for _, invalid := range []string{"abc", "*:0-5000;*:0-10", "0:100-10", "0:100", "1-0:0-10", "0:0-10;0-1:0-10", ";", "70000:0-10"} {
+		_, err = ParseBoundedRange(invalid, "")
+		assert.NotNil(err, invalid)
+	}
+
+	boundedRange, err = ParseBoundedRange("", "2019-06-01T00:00:00Z/2019-06-02T00:00:00Z")
+	assert.Nil(err)
+	assert.False(boundedRange.HasSeqnoRange())
+	assert.True(boundedRange.HasTimeRange())
+	_, ok = boundedRange.SeqnoRange(0)
+	assert.False(ok)
+	inRange := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	assert.True(boundedRange.InTimeRange(uint64(inRange.UnixNano())))
+	assert.True(boundedRange.Contains(100, 12345, uint64(inRange.UnixNano())))
+	assert.False(boundedRange.InTimeRange(uint64(inRange.Add(-24 * time.Hour).UnixNano())))
+	// end time is exclusive
+	assert.False(boundedRange.InTimeRange(uint64(boundedRange.EndTime.UnixNano())))
+
+	// invalid time ranges
+	for _, invalid := range []string{"2019-06-01T00:00:00Z", "2019-06-02T00:00:00Z/2019-06-01T00:00:00Z", "2019-06-01/2019-06-02"} {
+		_, err = ParseBoundedRange("", invalid)
+		assert.NotNil(err, invalid)
+	}
+
+	fmt.Println("============== Test case end: TestParseBoundedRange =================")
+}
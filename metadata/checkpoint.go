@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/couchbase/goxdcr/base"
+	"math"
 )
 
 const (
@@ -15,6 +16,8 @@ const (
 	TargetSeqno         string = "target_seqno"
 	TargetVbUuid        string = "target_vb_uuid"
 	StartUpTime         string = "startup_time"
+	BoundedCompleted    string = "bounded_completed"
+	BoundedEndSeqno     string = "bounded_end_seqno"
 )
 
 type CheckpointRecord struct {
@@ -30,6 +33,11 @@ type CheckpointRecord struct {
 	Target_vb_opaque TargetVBOpaque `json:"target_vb_opaque"`
 	//target vb high sequence number
 	Target_Seqno uint64 `json:"target_seqno"`
+	//whether all the data in the range of a bounded replication has been replicated for the vbucket
+	Bounded_completed bool `json:"bounded_completed,omitempty"`
+	//seqno at which the dcp stream of a bounded replication without seqno range ends for the vbucket, i.e., the high seqno
+	//of the vbucket when the replication first started. kept so that the range does not grow on pipeline restarts
+	Bounded_end_seqno uint64 `json:"bounded_end_seqno,omitempty"`
 }
 
 func (ckptRecord *CheckpointRecord) IsSame(new_record *CheckpointRecord) bool {
@@ -44,7 +52,9 @@ func (ckptRecord *CheckpointRecord) IsSame(new_record *CheckpointRecord) bool {
 		ckptRecord.Dcp_snapshot_seqno == new_record.Dcp_snapshot_seqno &&
 		ckptRecord.Dcp_snapshot_end_seqno == new_record.Dcp_snapshot_end_seqno &&
 		ckptRecord.Target_vb_opaque.IsSame(new_record.Target_vb_opaque) &&
-		ckptRecord.Target_Seqno == new_record.Target_Seqno {
+		ckptRecord.Target_Seqno == new_record.Target_Seqno &&
+		ckptRecord.Bounded_completed == new_record.Bounded_completed &&
+		ckptRecord.Bounded_end_seqno == new_record.Bounded_end_seqno {
 		return true
 	} else {
 		return false
@@ -82,6 +92,16 @@ func (ckptRecord *CheckpointRecord) UnmarshalJSON(data []byte) error {
 		ckptRecord.Target_Seqno = uint64(target_seqno.(float64))
 	}
 
+	bounded_completed, ok := fieldMap[BoundedCompleted]
+	if ok {
+		ckptRecord.Bounded_completed = bounded_completed.(bool)
+	}
+
+	bounded_end_seqno, ok := fieldMap[BoundedEndSeqno]
+	if ok {
+		ckptRecord.Bounded_end_seqno = uint64(bounded_end_seqno.(float64))
+	}
+
 	// this is the special logic where we unmarshal targetVBOpaque into different concrete types
 	target_vb_opaque, ok := fieldMap[TargetVbOpaque]
 	if ok {
@@ -290,7 +310,7 @@ func NewCheckpointsDoc(specInternalId string) *CheckpointsDoc {
 	return ckpt_doc
 }
 
-//Not concurrency safe. It should be used by one goroutine only
+// Not concurrency safe. It should be used by one goroutine only
 func (ckptsDoc *CheckpointsDoc) AddRecord(record *CheckpointRecord) bool {
 	length := len(ckptsDoc.Checkpoint_records)
 	if length > 0 {
@@ -326,3 +346,66 @@ func (ckptsDoc *CheckpointsDoc) GetCheckpointRecords() []*CheckpointRecord {
 		return ckptsDoc.Checkpoint_records[:base.MaxCheckpointRecordsToRead]
 	}
 }
+
+// Rewind removes checkpoint records with seqno larger than the specified seqno, so that replication
+// resumes from a checkpoint record at or before the seqno.
+// returns the seqno of the newest remaining checkpoint record, or 0 if no records remain
+// Not concurrency safe. It should be used by one goroutine only
+func (ckptsDoc *CheckpointsDoc) Rewind(seqno uint64) uint64 {
+	records := make([]*CheckpointRecord, 0, len(ckptsDoc.Checkpoint_records))
+	for _, record := range ckptsDoc.Checkpoint_records {
+		if record != nil && record.Seqno <= seqno {
+			records = append(records, record)
+		}
+	}
+	ckptsDoc.Checkpoint_records = records
+
+	if len(records) == 0 {
+		return 0
+	}
+	return records[0].Seqno
+}
+
+// IsUsable checks whether checkpoint record could still be used to resume replication, given the current failover log
+// of the source vbucket, with the newest entry first, and the current opaque of the target vbucket.
+// a record is not usable when its failover uuid is no longer in the failover log, or when its seqno is beyond the point
+// where its branch of the failover log ends, since dcp would then roll back to an earlier seqno.
+// a record is not usable either when its target vb opaque differs from the current one, since target vbucket opaque
+// never reverts to an old value. target vb opaque is not checked when targetVBOpaque is nil
+func (ckptRecord *CheckpointRecord) IsUsable(failoverLog [][2]uint64, targetVBOpaque TargetVBOpaque) bool {
+	if targetVBOpaque != nil && !targetVBOpaque.IsSame(ckptRecord.Target_vb_opaque) {
+		return false
+	}
+
+	// seqno at which the next newer branch starts. the newest branch does not end
+	var branchEndSeqno uint64 = math.MaxUint64
+	for _, entry := range failoverLog {
+		failover_uuid := entry[0]
+		starting_seqno := entry[1]
+		if failover_uuid == ckptRecord.Failover_uuid {
+			return ckptRecord.Seqno <= branchEndSeqno
+		}
+		branchEndSeqno = starting_seqno
+	}
+	return false
+}
+
+// Compact removes nil checkpoint records, as well as records that isUsable deems to be unusable
+// returns the number of unusable records removed
+// Not concurrency safe. It should be used by one goroutine only
+func (ckptsDoc *CheckpointsDoc) Compact(isUsable func(record *CheckpointRecord) bool) int {
+	records := make([]*CheckpointRecord, 0, len(ckptsDoc.Checkpoint_records))
+	removed := 0
+	for _, record := range ckptsDoc.Checkpoint_records {
+		if record == nil {
+			continue
+		}
+		if isUsable(record) {
+			records = append(records, record)
+		} else {
+			removed++
+		}
+	}
+	ckptsDoc.Checkpoint_records = records
+	return removed
+}
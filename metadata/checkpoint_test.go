@@ -0,0 +1,104 @@
+// +build !pcre
+
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCheckpointsDocRewind(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestCheckpointsDocRewind =================")
+
+	ckptDoc := NewCheckpointsDoc("internalId")
+	for _, seqno := range []uint64{10, 20, 30, 40} {
+		assert.True(ckptDoc.AddRecord(&CheckpointRecord{Seqno: seqno}))
+	}
+
+	// records newer than seqno are removed, and nil records are dropped
+	assert.Equal(uint64(20), ckptDoc.Rewind(25))
+	assert.Equal(2, len(ckptDoc.Checkpoint_records))
+	assert.Equal(uint64(20), ckptDoc.GetCheckpointRecords()[0].Seqno)
+	assert.Equal(uint64(10), ckptDoc.GetCheckpointRecords()[1].Seqno)
+
+	// rewinding to a seqno that has a record keeps the record
+	assert.Equal(uint64(10), ckptDoc.Rewind(10))
+	assert.Equal(1, len(ckptDoc.Checkpoint_records))
+
+	// no records left
+	assert.Equal(uint64(0), ckptDoc.Rewind(5))
+	assert.Equal(0, len(ckptDoc.Checkpoint_records))
+
+	// records can still be added after rewind
+	assert.True(ckptDoc.AddRecord(&CheckpointRecord{Seqno: 50}))
+	assert.Equal(uint64(50), ckptDoc.GetCheckpointRecords()[0].Seqno)
+
+	fmt.Println("============== Test case end: TestCheckpointsDocRewind =================")
+}
+
+func TestCheckpointRecordIsUsable(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestCheckpointRecordIsUsable =================")
+
+	// newest entry first. branch of uuid 100 covers seqnos 0 to 50, branch of uuid 200 covers seqnos 50 onward
+	failoverLog := [][2]uint64{{200, 50}, {100, 0}}
+	targetVBOpaque := &TargetVBUuid{Target_vb_uuid: 1}
+
+	assert.True((&CheckpointRecord{Failover_uuid: 200, Seqno: 80, Target_vb_opaque: targetVBOpaque}).IsUsable(failoverLog, targetVBOpaque))
+	assert.True((&CheckpointRecord{Failover_uuid: 100, Seqno: 50, Target_vb_opaque: targetVBOpaque}).IsUsable(failoverLog, targetVBOpaque))
+	// seqno beyond the end of its branch
+	assert.False((&CheckpointRecord{Failover_uuid: 100, Seqno: 60, Target_vb_opaque: targetVBOpaque}).IsUsable(failoverLog, targetVBOpaque))
+	// failover uuid no longer in failover log
+	assert.False((&CheckpointRecord{Failover_uuid: 300, Seqno: 10, Target_vb_opaque: targetVBOpaque}).IsUsable(failoverLog, targetVBOpaque))
+	// target vb opaque has changed
+	assert.False((&CheckpointRecord{Failover_uuid: 200, Seqno: 80, Target_vb_opaque: &TargetVBUuid{Target_vb_uuid: 2}}).IsUsable(failoverLog, targetVBOpaque))
+	// target vb opaque is not checked when current opaque is unknown
+	assert.True((&CheckpointRecord{Failover_uuid: 200, Seqno: 80, Target_vb_opaque: &TargetVBUuid{Target_vb_uuid: 2}}).IsUsable(failoverLog, nil))
+
+	fmt.Println("============== Test case end: TestCheckpointRecordIsUsable =================")
+}
+
+func TestCheckpointsDocCompact(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestCheckpointsDocCompact =================")
+
+	ckptDoc := NewCheckpointsDoc("internalId")
+	for _, seqno := range []uint64{10, 20, 30} {
+		assert.True(ckptDoc.AddRecord(&CheckpointRecord{Seqno: seqno}))
+	}
+
+	removed := ckptDoc.Compact(func(record *CheckpointRecord) bool {
+		return record.Seqno != 20
+	})
+	// nil records are dropped without being counted
+	assert.Equal(1, removed)
+	assert.Equal(2, len(ckptDoc.Checkpoint_records))
+	assert.Equal(uint64(30), ckptDoc.GetCheckpointRecords()[0].Seqno)
+	assert.Equal(uint64(10), ckptDoc.GetCheckpointRecords()[1].Seqno)
+
+	fmt.Println("============== Test case end: TestCheckpointsDocCompact =================")
+}
+
+func TestCheckpointRecordBoundedFieldsRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestCheckpointRecordBoundedFieldsRoundTrip =================")
+
+	record := &CheckpointRecord{Failover_uuid: 100, Seqno: 80, Target_vb_opaque: &TargetVBUuid{Target_vb_uuid: 1},
+		Bounded_completed: true, Bounded_end_seqno: 120}
+	data, err := json.Marshal(record)
+	assert.Nil(err)
+
+	unmarshalled := &CheckpointRecord{}
+	assert.Nil(json.Unmarshal(data, unmarshalled))
+	assert.Equal(uint64(120), unmarshalled.Bounded_end_seqno)
+	assert.True(unmarshalled.Bounded_completed)
+	assert.True(record.IsSame(unmarshalled))
+
+	unmarshalled.Bounded_end_seqno = 130
+	assert.False(record.IsSame(unmarshalled))
+
+	fmt.Println("============== Test case end: TestCheckpointRecordBoundedFieldsRoundTrip =================")
+}
@@ -93,6 +93,13 @@ func NewRemoteClusterReference(uuid, name, hostName, userName, password string,
 	}, nil
 }
 
+// returns the reference that stands in for the target cluster of a replication to a sink, for the parts of
+// pipeline that work with target cluster references. it is not stored, and has no host name or credentials
+func NewSinkTargetClusterReference(spec *ReplicationSpecification) (*RemoteClusterReference, error) {
+	return NewRemoteClusterReference(spec.TargetClusterUUID, spec.TargetClusterUUID, "" /*hostName*/, "" /*userName*/, "" /*password*/,
+		false /*demandEncryption*/, "" /*encryptionType*/, nil, nil, nil)
+}
+
 func RemoteClusterRefId() (string, error) {
 	refUuid, err := base.GenerateRandomId(SizeOfRemoteClusterRefId, MaxRetryForIdGeneration)
 	if err != nil {
@@ -235,3 +235,212 @@ func TestMultiValueHelperCheckAndConvert(t *testing.T) {
 
 	fmt.Println("============== Test case end: TestMultiValueHelperCheckAndConvert =================")
 }
+
+func TestValidateConflictResolverSetting(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestValidateConflictResolverSetting =================")
+	settings := setupBoilerPlate()
+	assert.Equal(base.ConflictResolverDefault, settings.GetConflictResolver())
+
+	converted, err := ValidateAndConvertReplicationSettingsValue(ConflictResolverKey, base.ConflictResolverSourceWins, "", true, false)
+	assert.Nil(err)
+	assert.Equal(base.ConflictResolverSourceWins, converted)
+
+	// empty name is not allowed
+	_, err = ValidateAndConvertReplicationSettingsValue(ConflictResolverKey, "", "", true, false)
+	assert.NotNil(err)
+
+	// name needs to be registered
+	_, err = ValidateAndConvertReplicationSettingsValue(ConflictResolverKey, "bogus", "", true, false)
+	assert.NotNil(err)
+
+	// custom resolver is not allowed for CAPI, while default is
+	_, err = ValidateAndConvertReplicationSettingsValue(ConflictResolverKey, base.ConflictResolverSourceWins, "", true, true)
+	assert.NotNil(err)
+	_, err = ValidateAndConvertReplicationSettingsValue(ConflictResolverKey, base.ConflictResolverDefault, "", true, true)
+	assert.Nil(err)
+
+	settingsMap := make(map[string]interface{})
+	settingsMap[ConflictResolverKey] = base.ConflictResolverTargetWins
+	changedSettingsMap, errMap := settings.UpdateSettingsFromMap(settingsMap)
+	assert.Equal(1, len(changedSettingsMap))
+	assert.Equal(0, len(errMap))
+	assert.Equal(base.ConflictResolverTargetWins, settings.GetConflictResolver())
+	fmt.Println("============== Test case end: TestValidateConflictResolverSetting =================")
+}
+
+func TestSinkReplicationType(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestSinkReplicationType =================")
+	settings := setupBoilerPlate()
+	assert.False(settings.IsSink())
+
+	converted, err := ValidateAndConvertReplicationSettingsValue(ReplicationTypeKey, base.SinkTypeFile, "", true, false)
+	assert.Nil(err)
+	assert.Equal(base.SinkTypeFile, converted)
+
+	// empty type is not allowed
+	_, err = ValidateAndConvertReplicationSettingsValue(ReplicationTypeKey, "", "", true, false)
+	assert.NotNil(err)
+
+	settingsMap := make(map[string]interface{})
+	settingsMap[ReplicationTypeKey] = base.SinkTypeFile
+	_, errMap := settings.UpdateSettingsFromMap(settingsMap)
+	assert.Equal(0, len(errMap))
+	assert.True(settings.IsSink())
+	assert.False(settings.IsCapi())
+
+	settingsMap[ReplicationTypeKey] = ReplicationTypeCapi
+	settings.UpdateSettingsFromMap(settingsMap)
+	assert.False(settings.IsSink())
+	fmt.Println("============== Test case end: TestSinkReplicationType =================")
+}
+
+func TestSinkSettings(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestSinkSettings =================")
+
+	testCases := []struct {
+		name     string
+		sinkType string
+		settings SinkSettings
+		errorKey string
+		brokers  []string
+	}{
+		{"file sink without settings", base.SinkTypeFile, SinkSettings{}, "", nil},
+		{"file sink with endpoint", base.SinkTypeFile, SinkSettings{Endpoint: "host:9092"}, base.SinkEndpointREST, nil},
+		{"kafka sink without endpoint", base.SinkTypeKafka, SinkSettings{}, base.SinkEndpointREST, nil},
+		{"kafka sink", base.SinkTypeKafka, SinkSettings{Endpoint: "host1:9092, host2:9093"}, "", []string{"host1:9092", "host2:9093"}},
+		{"kafka broker without port", base.SinkTypeKafka, SinkSettings{Endpoint: "host1:9092,host2"}, base.SinkEndpointREST, nil},
+		{"kafka broker with invalid port", base.SinkTypeKafka, SinkSettings{Endpoint: "host1:port"}, base.SinkEndpointREST, nil},
+		{"kafka sink with credentials", base.SinkTypeKafka, SinkSettings{Endpoint: "host:9092", Username: "user", Password: "password", TLS: true}, "", []string{"host:9092"}},
+		{"password without username", base.SinkTypeKafka, SinkSettings{Endpoint: "host:9092", Password: "password"}, base.SinkUsernameREST, []string{"host:9092"}},
+		{"certificate without tls", base.SinkTypeKafka, SinkSettings{Endpoint: "host:9092", Certificate: "cert"}, base.SinkCertificateREST, []string{"host:9092"}},
+		{"kafka sink with http headers", base.SinkTypeKafka, SinkSettings{Endpoint: "host:9092", HttpHeaders: `{"a":"b"}`}, base.SinkHttpHeadersREST, []string{"host:9092"}},
+		{"http sink", base.SinkTypeHttp, SinkSettings{Endpoint: "https://host/hook", Username: "user", Password: "password", Certificate: "cert", HttpHeaders: `{"a":"b"}`, HttpRetryStatusCodes: "503", HttpSkipStatusCodes: "409, 400"}, "", nil},
+		{"http sink without url", base.SinkTypeHttp, SinkSettings{}, base.SinkEndpointREST, nil},
+		{"http sink with relative url", base.SinkTypeHttp, SinkSettings{Endpoint: "host/hook"}, base.SinkEndpointREST, nil},
+		{"http sink with tls", base.SinkTypeHttp, SinkSettings{Endpoint: "https://host/hook", TLS: true}, base.SinkTLSREST, nil},
+		{"certificate with http url", base.SinkTypeHttp, SinkSettings{Endpoint: "http://host/hook", Certificate: "cert"}, base.SinkCertificateREST, nil},
+		{"2xx retry status code", base.SinkTypeHttp, SinkSettings{Endpoint: "http://host/hook", HttpRetryStatusCodes: "200"}, base.SinkHttpRetryCodesREST, nil},
+		{"skip status code retried by default", base.SinkTypeHttp, SinkSettings{Endpoint: "http://host/hook", HttpSkipStatusCodes: "503"}, base.SinkHttpSkipCodesREST, nil},
+		{"skip status code also retried", base.SinkTypeHttp, SinkSettings{Endpoint: "http://host/hook", HttpRetryStatusCodes: "409", HttpSkipStatusCodes: "409"}, base.SinkHttpSkipCodesREST, nil},
+		{"kafka sink with max request bytes", base.SinkTypeKafka, SinkSettings{Endpoint: "host:9092", KafkaMaxRequestBytes: 512 * 1024}, "", []string{"host:9092"}},
+		{"http sink with kafka max request bytes", base.SinkTypeHttp, SinkSettings{Endpoint: "http://host/hook", KafkaMaxRequestBytes: 512 * 1024}, base.SinkKafkaMaxRequestBytesREST, nil},
+		{"file sink with kafka max request bytes", base.SinkTypeFile, SinkSettings{KafkaMaxRequestBytes: 512 * 1024}, base.SinkEndpointREST, nil},
+		{"custom sink", "custom", SinkSettings{Password: "password"}, "", nil},
+	}
+
+	for _, testCase := range testCases {
+		errorMap := make(base.ErrorMap)
+		testCase.settings.Validate(testCase.sinkType, errorMap)
+		if len(testCase.errorKey) == 0 {
+			assert.Equal(0, len(errorMap), testCase.name)
+		} else {
+			assert.NotNil(errorMap[testCase.errorKey], testCase.name)
+		}
+		if testCase.brokers != nil {
+			brokers, err := testCase.settings.KafkaBrokers()
+			assert.Nil(err, testCase.name)
+			assert.Equal(testCase.brokers, brokers, testCase.name)
+		}
+	}
+
+	// sink settings are populated from settings map, and password is hidden from rest output and cleared in redacted settings
+	settings := setupBoilerPlate()
+	settingsMap := map[string]interface{}{ReplicationTypeKey: base.SinkTypeKafka, SinkEndpointKey: "host:9092", SinkUsernameKey: "user", SinkPasswordKey: "password", SinkTLSKey: true}
+	_, errMap := settings.UpdateSettingsFromMap(settingsMap)
+	assert.Equal(0, len(errMap))
+	assert.Equal(SinkSettings{Endpoint: "host:9092", Username: "user", Password: "password", TLS: true}, settings.GetSinkSettings())
+	_, ok := settings.ToRESTMap()[SinkPasswordKey]
+	assert.False(ok)
+	assert.Equal("", settings.CloneAndRedact().GetSinkSettings().Password)
+	assert.Equal("password", settings.GetSinkSettings().Password)
+	assert.Equal(base.KafkaDefaultMaxRequestBytes, settings.GetSinkSettings().KafkaMaxRequestBytesOrDefault())
+	_, errMap = settings.UpdateSettingsFromMap(map[string]interface{}{SinkKafkaMaxRequestBytesKey: 512 * 1024})
+	assert.Equal(0, len(errMap))
+	assert.Equal(512*1024, settings.GetSinkSettings().KafkaMaxRequestBytesOrDefault())
+
+	// certificate needs to be PEM encoded
+	_, err := ValidateAndConvertReplicationSettingsValue(SinkCertificateKey, "not a certificate", base.SinkCertificateREST, true, false)
+	assert.NotNil(err)
+	converted, err := ValidateAndConvertReplicationSettingsValue(SinkCertificateKey, "", base.SinkCertificateREST, true, false)
+	assert.Nil(err)
+	assert.Equal("", converted)
+
+	// http headers need to be a json object, and status codes need to be comma separated non-2xx status codes
+	_, err = ValidateAndConvertReplicationSettingsValue(SinkHttpHeadersKey, `["a"]`, base.SinkHttpHeadersREST, true, false)
+	assert.NotNil(err)
+	_, err = ValidateAndConvertReplicationSettingsValue(SinkHttpSkipStatusCodesKey, "409,abc", base.SinkHttpSkipCodesREST, true, false)
+	assert.NotNil(err)
+	_, err = ValidateAndConvertReplicationSettingsValue(SinkHttpRetryStatusCodesKey, "600", base.SinkHttpRetryCodesREST, true, false)
+	assert.NotNil(err)
+	headers, err := ParseSinkHttpHeaders(`{"Authorization":"Bearer token"}`)
+	assert.Nil(err)
+	assert.Equal(map[string]string{"Authorization": "Bearer token"}, headers)
+	statusCodes, err := ParseSinkHttpStatusCodes("409, 429")
+	assert.Nil(err)
+	assert.Equal([]int{409, 429}, statusCodes)
+
+	// http headers are hidden from rest output and cleared in redacted settings
+	settingsMap = map[string]interface{}{SinkHttpHeadersKey: `{"Authorization":"Bearer token"}`}
+	_, errMap = settings.UpdateSettingsFromMap(settingsMap)
+	assert.Equal(0, len(errMap))
+	_, ok = settings.ToRESTMap()[SinkHttpHeadersKey]
+	assert.False(ok)
+	assert.Equal("", settings.CloneAndRedact().GetSinkSettings().HttpHeaders)
+
+	fmt.Println("============== Test case end: TestSinkSettings =================")
+}
+
+func TestValidateTargetBatchLatencySetting(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestValidateTargetBatchLatencySetting =================")
+	settings := setupBoilerPlate()
+	assert.Equal(0, settings.GetTargetBatchLatency())
+
+	converted, err := ValidateAndConvertReplicationSettingsValue(TargetBatchLatencyKey, "50", "", true, false)
+	assert.Nil(err)
+	assert.Equal(50, converted)
+
+	_, err = ValidateAndConvertReplicationSettingsValue(TargetBatchLatencyKey, "-1", "", true, false)
+	assert.NotNil(err)
+	_, err = ValidateAndConvertReplicationSettingsValue(TargetBatchLatencyKey, "60001", "", true, false)
+	assert.NotNil(err)
+
+	// not applicable to capi replications, except for the disabled value
+	_, err = ValidateAndConvertReplicationSettingsValue(TargetBatchLatencyKey, "50", "", true, true)
+	assert.NotNil(err)
+	_, err = ValidateAndConvertReplicationSettingsValue(TargetBatchLatencyKey, "0", "", true, true)
+	assert.Nil(err)
+
+	settingsMap := make(map[string]interface{})
+	settingsMap[TargetBatchLatencyKey] = 50
+	_, errMap := settings.UpdateSettingsFromMap(settingsMap)
+	assert.Equal(0, len(errMap))
+	assert.Equal(50, settings.GetTargetBatchLatency())
+	fmt.Println("============== Test case end: TestValidateTargetBatchLatencySetting =================")
+}
+
+func TestValidateConnectionsPerTargetNozzleSetting(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestValidateConnectionsPerTargetNozzleSetting =================")
+	settings := setupBoilerPlate()
+	assert.Equal(1, settings.GetConnectionsPerTargetNozzle())
+
+	converted, err := ValidateAndConvertReplicationSettingsValue(ConnectionsPerTargetNozzleKey, "4", "", true, false)
+	assert.Nil(err)
+	assert.Equal(4, converted)
+
+	_, err = ValidateAndConvertReplicationSettingsValue(ConnectionsPerTargetNozzleKey, "0", "", true, false)
+	assert.NotNil(err)
+	_, err = ValidateAndConvertReplicationSettingsValue(ConnectionsPerTargetNozzleKey, "11", "", true, false)
+	assert.NotNil(err)
+
+	// capi replications use a single connection
+	_, err = ValidateAndConvertReplicationSettingsValue(ConnectionsPerTargetNozzleKey, "4", "", true, true)
+	assert.NotNil(err)
+	_, err = ValidateAndConvertReplicationSettingsValue(ConnectionsPerTargetNozzleKey, "1", "", true, true)
+	assert.Nil(err)
+	fmt.Println("============== Test case end: TestValidateConnectionsPerTargetNozzleSetting =================")
+}
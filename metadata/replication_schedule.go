@@ -0,0 +1,250 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ScheduleWindowDelimiter = ";"
+	ScheduleDayDelimiter    = ","
+	ScheduleRangeDelimiter  = "-"
+	ScheduleTimeDelimiter   = ":"
+	// delimiter between time window and bandwidth limit in bandwidth profile
+	BandwidthProfileLimitDelimiter = "="
+	// days covered by a bandwidth profile entry that does not specify days
+	allScheduleDays = "Sun-Sat"
+	minutesPerDay   = 24 * 60
+)
+
+var scheduleWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// a time window in which replication is allowed to run
+// a window whose end is not later than its start, e.g., 20:00-06:00, spans midnight
+// and ends on the day after the day on which it starts
+type ScheduleWindow struct {
+	// days of week on which the window starts, indexed by time.Weekday
+	Days [7]bool
+	// start and end of the window, in minutes since midnight
+	Start int
+	End   int
+}
+
+// ReplicationSchedule is the parsed form of the schedule setting of a replication, which looks like
+// "Mon-Fri 20:00-06:00;Sat,Sun 00:00-24:00"
+// replication is allowed to run only when the current time, in the timezone of the schedule,
+// falls into one of the windows of the schedule
+type ReplicationSchedule struct {
+	Windows  []*ScheduleWindow
+	Location *time.Location
+}
+
+func ParseReplicationSchedule(schedule string, timezone string) (*ReplicationSchedule, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid timezone %v. err=%v", timezone, err)
+	}
+
+	replSchedule := &ReplicationSchedule{Location: location}
+	for _, windowStr := range strings.Split(schedule, ScheduleWindowDelimiter) {
+		windowStr = strings.TrimSpace(windowStr)
+		if len(windowStr) == 0 {
+			continue
+		}
+		window, err := parseScheduleWindow(windowStr)
+		if err != nil {
+			return nil, err
+		}
+		replSchedule.Windows = append(replSchedule.Windows, window)
+	}
+
+	if len(replSchedule.Windows) == 0 {
+		return nil, fmt.Errorf("Schedule %v does not contain any time window", schedule)
+	}
+	return replSchedule, nil
+}
+
+// window is in the form of "<days> <start time>-<end time>", e.g., "Mon,Wed-Fri 08:30-17:00"
+func parseScheduleWindow(windowStr string) (*ScheduleWindow, error) {
+	parts := strings.Fields(windowStr)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Time window %v is not in the form of \"<days> <start time>-<end time>\"", windowStr)
+	}
+
+	window := &ScheduleWindow{}
+	for _, dayStr := range strings.Split(parts[0], ScheduleDayDelimiter) {
+		dayRange := strings.Split(dayStr, ScheduleRangeDelimiter)
+		if len(dayRange) > 2 {
+			return nil, fmt.Errorf("Invalid days %v in time window %v", dayStr, windowStr)
+		}
+		firstDay, err := parseWeekday(dayRange[0])
+		if err != nil {
+			return nil, err
+		}
+		lastDay := firstDay
+		if len(dayRange) == 2 {
+			lastDay, err = parseWeekday(dayRange[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		// day range could wrap around the end of week, e.g., Sat-Mon
+		for day := firstDay; ; day = (day + 1) % 7 {
+			window.Days[day] = true
+			if day == lastDay {
+				break
+			}
+		}
+	}
+
+	timeRange := strings.Split(parts[1], ScheduleRangeDelimiter)
+	if len(timeRange) != 2 {
+		return nil, fmt.Errorf("Invalid time range %v in time window %v", parts[1], windowStr)
+	}
+	var err error
+	window.Start, err = parseTimeOfDay(timeRange[0])
+	if err != nil {
+		return nil, err
+	}
+	window.End, err = parseTimeOfDay(timeRange[1])
+	if err != nil {
+		return nil, err
+	}
+	if window.Start == window.End || window.Start == minutesPerDay {
+		return nil, fmt.Errorf("Invalid time range %v in time window %v", parts[1], windowStr)
+	}
+
+	return window, nil
+}
+
+func parseWeekday(dayStr string) (time.Weekday, error) {
+	day, ok := scheduleWeekdays[strings.ToLower(dayStr)]
+	if !ok {
+		return time.Sunday, fmt.Errorf("Invalid day of week %v. Valid values are Sun, Mon, Tue, Wed, Thu, Fri and Sat", dayStr)
+	}
+	return day, nil
+}
+
+// parses time in the form of "hh:mm" into minutes since midnight. "24:00" is accepted as the end of day
+func parseTimeOfDay(timeStr string) (int, error) {
+	parts := strings.Split(timeStr, ScheduleTimeDelimiter)
+	if len(parts) == 2 {
+		hour, err1 := strconv.Atoi(parts[0])
+		minute, err2 := strconv.Atoi(parts[1])
+		if err1 == nil && err2 == nil && hour >= 0 && minute >= 0 && minute < 60 &&
+			(hour < 24 || (hour == 24 && minute == 0)) {
+			return hour*60 + minute, nil
+		}
+	}
+	return 0, fmt.Errorf("Invalid time %v. Time needs to be in the form of hh:mm", timeStr)
+}
+
+// whether the specified time falls into one of the windows of the schedule
+func (schedule *ReplicationSchedule) InWindow(t time.Time) bool {
+	t = t.In(schedule.Location)
+	for _, window := range schedule.Windows {
+		if window.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// t needs to be in the timezone in which the window is specified
+func (window *ScheduleWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	prevDay := (day + 6) % 7
+
+	if window.Start < window.End {
+		return window.Days[day] && minute >= window.Start && minute < window.End
+	}
+	// window spans midnight
+	return (window.Days[day] && minute >= window.Start) || (window.Days[prevDay] && minute < window.End)
+}
+
+// a time window with its own bandwidth limit, in MB/sec
+type BandwidthProfileEntry struct {
+	Window *ScheduleWindow
+	Limit  int
+}
+
+// BandwidthProfile is the parsed form of the bandwidth profile setting of a replication, which looks like
+// "08:00-18:00=50;Sat,Sun 08:00-18:00=200"
+// days are optional and default to all days of the week. when multiple entries cover the current time,
+// the first one wins. when no entry covers the current time, bandwidth_limit setting applies
+type BandwidthProfile struct {
+	Entries  []*BandwidthProfileEntry
+	Location *time.Location
+}
+
+func ParseBandwidthProfile(profile string, timezone string) (*BandwidthProfile, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid timezone %v. err=%v", timezone, err)
+	}
+
+	bandwidthProfile := &BandwidthProfile{Location: location}
+	for _, entryStr := range strings.Split(profile, ScheduleWindowDelimiter) {
+		entryStr = strings.TrimSpace(entryStr)
+		if len(entryStr) == 0 {
+			continue
+		}
+		parts := strings.Split(entryStr, BandwidthProfileLimitDelimiter)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Bandwidth profile entry %v is not in the form of \"[<days>] <start time>-<end time>=<limit>\"", entryStr)
+		}
+
+		limit, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || limit < BandwidthLimitConfig.MinValue || limit > BandwidthLimitConfig.MaxValue {
+			return nil, fmt.Errorf("Invalid bandwidth limit %v in bandwidth profile entry %v. Limit needs to be an integer between %v and %v",
+				parts[1], entryStr, BandwidthLimitConfig.MinValue, BandwidthLimitConfig.MaxValue)
+		}
+
+		windowStr := strings.TrimSpace(parts[0])
+		if len(strings.Fields(windowStr)) == 1 {
+			windowStr = allScheduleDays + " " + windowStr
+		}
+		window, err := parseScheduleWindow(windowStr)
+		if err != nil {
+			return nil, err
+		}
+		bandwidthProfile.Entries = append(bandwidthProfile.Entries, &BandwidthProfileEntry{Window: window, Limit: limit})
+	}
+
+	if len(bandwidthProfile.Entries) == 0 {
+		return nil, fmt.Errorf("Bandwidth profile %v does not contain any entry", profile)
+	}
+	return bandwidthProfile, nil
+}
+
+// returns the bandwidth limit of the first entry that covers the specified time
+// the second return value is false when no entry covers the specified time
+func (profile *BandwidthProfile) LimitAt(t time.Time) (int, bool) {
+	t = t.In(profile.Location)
+	for _, entry := range profile.Entries {
+		if entry.Window.contains(t) {
+			return entry.Limit, true
+		}
+	}
+	return 0, false
+}
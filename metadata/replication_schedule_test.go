@@ -0,0 +1,113 @@
+// +build !pcre
+
+package metadata
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseReplicationSchedule(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestParseReplicationSchedule =================")
+
+	schedule, err := ParseReplicationSchedule("Mon-Fri 20:00-06:00; Sat,Sun 00:00-24:00", "UTC")
+	assert.Nil(err)
+	assert.Equal(2, len(schedule.Windows))
+	assert.True(schedule.Windows[0].Days[time.Friday])
+	assert.False(schedule.Windows[0].Days[time.Saturday])
+	assert.Equal(20*60, schedule.Windows[0].Start)
+	assert.Equal(6*60, schedule.Windows[0].End)
+	assert.Equal(24*60, schedule.Windows[1].End)
+
+	// day range wrapping around the end of week
+	schedule, err = ParseReplicationSchedule("sat-mon 08:00-09:30", "UTC")
+	assert.Nil(err)
+	assert.True(schedule.Windows[0].Days[time.Sunday])
+	assert.False(schedule.Windows[0].Days[time.Tuesday])
+
+	invalidSchedules := []string{"", ";", "Mon", "Mon 08:00", "Foo 08:00-09:00", "Mon 08:00-08:00",
+		"Mon 25:00-26:00", "Mon 08:60-09:00", "Mon-Tue-Wed 08:00-09:00", "Mon 24:00-01:00"}
+	for _, invalidSchedule := range invalidSchedules {
+		_, err = ParseReplicationSchedule(invalidSchedule, "UTC")
+		assert.NotNil(err, invalidSchedule)
+	}
+
+	_, err = ParseReplicationSchedule("Mon 08:00-09:00", "Invalid/Timezone")
+	assert.NotNil(err)
+
+	fmt.Println("============== Test case end: TestParseReplicationSchedule =================")
+}
+
+func TestReplicationScheduleInWindow(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestReplicationScheduleInWindow =================")
+
+	schedule, err := ParseReplicationSchedule("Mon-Fri 20:00-06:00", "UTC")
+	assert.Nil(err)
+
+	// 2019-07-01 is a Monday
+	assert.False(schedule.InWindow(time.Date(2019, 7, 1, 5, 0, 0, 0, time.UTC)))
+	assert.True(schedule.InWindow(time.Date(2019, 7, 1, 20, 0, 0, 0, time.UTC)))
+	assert.True(schedule.InWindow(time.Date(2019, 7, 2, 5, 59, 0, 0, time.UTC)))
+	assert.False(schedule.InWindow(time.Date(2019, 7, 2, 6, 0, 0, 0, time.UTC)))
+	// window starting on Friday ends on Saturday morning
+	assert.True(schedule.InWindow(time.Date(2019, 7, 6, 1, 0, 0, 0, time.UTC)))
+	assert.False(schedule.InWindow(time.Date(2019, 7, 6, 21, 0, 0, 0, time.UTC)))
+
+	// windows are evaluated in the timezone of the schedule
+	schedule, err = ParseReplicationSchedule("Mon 09:00-17:00", "America/New_York")
+	assert.Nil(err)
+	assert.True(schedule.InWindow(time.Date(2019, 7, 1, 14, 0, 0, 0, time.UTC)))
+	assert.False(schedule.InWindow(time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)))
+
+	// replication without schedule is always in window
+	settings := DefaultReplicationSettings()
+	assert.True(settings.InScheduleWindow(time.Now()))
+
+	// schedule is parsed when the setting is changed
+	_, errMap := settings.UpdateSettingsFromMap(map[string]interface{}{ScheduleKey: "Mon-Fri 20:00-06:00"})
+	assert.Equal(0, len(errMap))
+	assert.NotNil(settings.schedule)
+	assert.False(settings.InScheduleWindow(time.Date(2019, 7, 1, 5, 0, 0, 0, time.UTC)))
+	assert.True(settings.InScheduleWindow(time.Date(2019, 7, 1, 20, 0, 0, 0, time.UTC)))
+	assert.NotNil(settings.Clone().schedule)
+
+	_, errMap = settings.UpdateSettingsFromMap(map[string]interface{}{ScheduleKey: ""})
+	assert.Equal(0, len(errMap))
+	assert.Nil(settings.schedule)
+	assert.True(settings.InScheduleWindow(time.Date(2019, 7, 1, 5, 0, 0, 0, time.UTC)))
+
+	fmt.Println("============== Test case end: TestReplicationScheduleInWindow =================")
+}
+
+func TestBandwidthProfile(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestBandwidthProfile =================")
+
+	profile, err := ParseBandwidthProfile("08:00-18:00=50; Sat,Sun 20:00-02:00=0", "UTC")
+	assert.Nil(err)
+	assert.Equal(2, len(profile.Entries))
+	assert.True(profile.Entries[0].Window.Days[time.Wednesday])
+
+	// 2019-07-01 is a Monday
+	limit, ok := profile.LimitAt(time.Date(2019, 7, 1, 9, 0, 0, 0, time.UTC))
+	assert.True(ok)
+	assert.Equal(50, limit)
+	_, ok = profile.LimitAt(time.Date(2019, 7, 1, 19, 0, 0, 0, time.UTC))
+	assert.False(ok)
+	// window starting on Sunday ends on Monday morning
+	limit, ok = profile.LimitAt(time.Date(2019, 7, 1, 1, 0, 0, 0, time.UTC))
+	assert.True(ok)
+	assert.Equal(0, limit)
+
+	invalidProfiles := []string{"", "08:00-18:00", "08:00-18:00=abc", "08:00-18:00=-1", "08:00-18:00=50=60", "Foo 08:00-18:00=50"}
+	for _, invalidProfile := range invalidProfiles {
+		_, err = ParseBandwidthProfile(invalidProfile, "UTC")
+		assert.NotNil(err, invalidProfile)
+	}
+
+	fmt.Println("============== Test case end: TestBandwidthProfile =================")
+}
@@ -10,10 +10,12 @@
 package metadata
 
 import (
+	"crypto/x509"
 	"fmt"
 	"github.com/couchbase/goxdcr/base"
 	"github.com/couchbase/goxdcr/log"
 	"strconv"
+	"time"
 )
 
 // keys for replication settings
@@ -35,6 +37,46 @@ const (
 	FilterVersionKey                  = "filter_expression_version"
 	FilterSkipRestreamKey             = "filter_skip_restream"
 	PriorityKey                       = "priority"
+	// name of the conflict resolver used by xmem for source side conflict resolution
+	ConflictResolverKey = "conflict_resolver"
+	// whether mutations that lose source side conflict resolution are recorded in conflict log
+	ConflictLoggingKey = "conflict_logging"
+	// time windows in which replication is allowed to run. empty schedule means that replication can run any time
+	ScheduleKey = "schedule"
+	// timezone in which the time windows in schedule and bandwidth profile are specified, e.g., "UTC" or "America/Los_Angeles"
+	ScheduleTimezoneKey = "schedule_timezone"
+	// time windows with their own bandwidth limits, which override bandwidth_limit during the time windows
+	BandwidthProfileKey = "bandwidth_profile"
+	// json array of rules for transforming documents before they are sent to target. empty value means no transformation
+	TransformationRulesKey = "transformation_rules"
+	// per vbucket seqno ranges that a bounded replication copies, e.g., "*:0-5000;0-511:100-8000"
+	BoundedSeqnoRangeKey = "bounded_seqno_range"
+	// time range of document modification that a bounded replication copies, e.g., "2019-06-01T00:00:00Z/2019-06-02T00:00:00Z"
+	BoundedTimeRangeKey = "bounded_time_range"
+	// whether a bounded replication has copied all the data in its range. set internally by checkpoint manager
+	BoundedCompletedKey = "bounded_completed"
+	// target response latency, in milliseconds, that xmem adapts batch count and batch size to,
+	// with worker_batch_size and doc_batch_size_kb as upper bounds. 0 disables adaptive batch sizing
+	TargetBatchLatencyKey = "target_batch_latency"
+	// number of connections that each xmem nozzle stripes its batches across, by vbucket
+	ConnectionsPerTargetNozzleKey = "connections_per_target_nozzle"
+	// endpoint of the sink that a replication to a sink writes to.
+	// for kafka sink, it is comma separated host:port of bootstrap brokers
+	SinkEndpointKey = "sink_endpoint"
+	// credentials for authenticating with the sink, if it requires authentication
+	SinkUsernameKey = "sink_username"
+	SinkPasswordKey = "sink_password"
+	// whether connections to the sink use TLS
+	SinkTLSKey = "sink_tls"
+	// PEM encoded certificates that the sink is verified against when TLS is used. system certificates are used when empty
+	SinkCertificateKey = "sink_certificate"
+	// json object of headers that http sink sets on each request, e.g., {"Authorization":"Bearer <token>"}
+	SinkHttpHeadersKey = "sink_http_headers"
+	// comma separated status codes of responses for which http sink posts the batch again, or considers the batch replicated
+	SinkHttpRetryStatusCodesKey = "sink_http_retry_status_codes"
+	SinkHttpSkipStatusCodesKey  = "sink_http_skip_status_codes"
+	// max size in bytes of the records in each produce request of kafka sink. 0 means base.KafkaDefaultMaxRequestBytes
+	SinkKafkaMaxRequestBytesKey = "sink_kafka_max_request_bytes"
 	// threshold for deciding whether replication has backlog
 	// defined as desired latency, i.e., changesLeft/throughput,
 	// in other words, nnumber of mutations left to process/ number of mutations that can be processed per millisecond
@@ -47,6 +89,8 @@ const (
 	FilterExpKey    = base.FilterExpKey
 	FilterDelKey    = base.FilterDelKey
 	BypassExpiryKey = base.BypassExpiryKey
+	// whether deletions and expirations that filter expression cannot be evaluated against are replicated or skipped
+	FilterDelExpFallbackKey = base.FilterDelExpFallbackKey
 )
 
 // keys to facilitate redaction of replication settings map
@@ -57,13 +101,16 @@ const (
 )
 
 // settings whose default values cannot be viewed or changed through rest apis
-var ImmutableDefaultSettings = []string{ReplicationTypeKey, FilterExpressionKey, ActiveKey, FilterVersionKey}
+var ImmutableDefaultSettings = []string{ReplicationTypeKey, FilterExpressionKey, ActiveKey, FilterVersionKey,
+	BoundedSeqnoRangeKey, BoundedTimeRangeKey, BoundedCompletedKey,
+	SinkEndpointKey, SinkUsernameKey, SinkPasswordKey, SinkTLSKey, SinkCertificateKey,
+	SinkHttpHeadersKey, SinkHttpRetryStatusCodesKey, SinkHttpSkipStatusCodesKey, SinkKafkaMaxRequestBytesKey}
 
 // settings whose values cannot be changed after replication is created
-var ImmutableSettings = []string{}
+var ImmutableSettings = []string{BoundedSeqnoRangeKey, BoundedTimeRangeKey}
 
 // settings that are internal and should be hidden from outside
-var HiddenSettings = []string{FilterVersionKey, FilterSkipRestreamKey, FilterExpDelKey}
+var HiddenSettings = []string{FilterVersionKey, FilterSkipRestreamKey, FilterExpDelKey, BoundedCompletedKey, SinkPasswordKey, SinkHttpHeadersKey}
 
 // settings that are externally multiple values, but internally single value
 var MultiValueMap map[string]string = map[string]string{
@@ -96,6 +143,27 @@ var CompressionTypeConfig = &SettingsConfig{base.CompressionTypeAuto, &Range{bas
 var PriorityConfig = &SettingsConfig{base.PriorityTypeHigh, nil}
 var BacklogThresholdConfig = &SettingsConfig{base.BacklogThresholdDefault, &Range{10, 10000000}}
 var FilterExpDelConfig = &SettingsConfig{base.FilterExpDelNone, &Range{int(base.FilterExpDelNone), int(base.FilterExpDelAll)}}
+var ConflictResolverConfig = &SettingsConfig{base.ConflictResolverDefault, nil}
+var ConflictLoggingConfig = &SettingsConfig{false, nil}
+var ScheduleConfig = &SettingsConfig{"", nil}
+var ScheduleTimezoneConfig = &SettingsConfig{"UTC", nil}
+var BandwidthProfileConfig = &SettingsConfig{"", nil}
+var FilterDelExpFallbackConfig = &SettingsConfig{base.FilterDelExpFallbackReplicate, nil}
+var TransformationRulesConfig = &SettingsConfig{"", nil}
+var BoundedSeqnoRangeConfig = &SettingsConfig{"", nil}
+var BoundedTimeRangeConfig = &SettingsConfig{"", nil}
+var BoundedCompletedConfig = &SettingsConfig{false, nil}
+var TargetBatchLatencyConfig = &SettingsConfig{0, &Range{0, 60000}}
+var ConnectionsPerTargetNozzleConfig = &SettingsConfig{1, &Range{1, 10}}
+var SinkEndpointConfig = &SettingsConfig{"", nil}
+var SinkUsernameConfig = &SettingsConfig{"", nil}
+var SinkPasswordConfig = &SettingsConfig{"", nil}
+var SinkTLSConfig = &SettingsConfig{false, nil}
+var SinkCertificateConfig = &SettingsConfig{"", nil}
+var SinkHttpHeadersConfig = &SettingsConfig{"", nil}
+var SinkHttpRetryStatusCodesConfig = &SettingsConfig{"", nil}
+var SinkHttpSkipStatusCodesConfig = &SettingsConfig{"", nil}
+var SinkKafkaMaxRequestBytesConfig = &SettingsConfig{0, &Range{0, 100 * 1024 * 1024}}
 
 // Set to keyOnly as default because prior to adv filtering, this config did not exist
 var FilterVersionConfig = &SettingsConfig{base.FilterVersionKeyOnly, nil}
@@ -121,6 +189,27 @@ var ReplicationSettingsConfigMap = map[string]*SettingsConfig{
 	PriorityKey:                       PriorityConfig,
 	BacklogThresholdKey:               BacklogThresholdConfig,
 	FilterExpDelKey:                   FilterExpDelConfig,
+	ConflictResolverKey:               ConflictResolverConfig,
+	ConflictLoggingKey:                ConflictLoggingConfig,
+	ScheduleKey:                       ScheduleConfig,
+	ScheduleTimezoneKey:               ScheduleTimezoneConfig,
+	BandwidthProfileKey:               BandwidthProfileConfig,
+	FilterDelExpFallbackKey:           FilterDelExpFallbackConfig,
+	TransformationRulesKey:            TransformationRulesConfig,
+	BoundedSeqnoRangeKey:              BoundedSeqnoRangeConfig,
+	BoundedTimeRangeKey:               BoundedTimeRangeConfig,
+	BoundedCompletedKey:               BoundedCompletedConfig,
+	TargetBatchLatencyKey:             TargetBatchLatencyConfig,
+	ConnectionsPerTargetNozzleKey:     ConnectionsPerTargetNozzleConfig,
+	SinkEndpointKey:                   SinkEndpointConfig,
+	SinkUsernameKey:                   SinkUsernameConfig,
+	SinkPasswordKey:                   SinkPasswordConfig,
+	SinkTLSKey:                        SinkTLSConfig,
+	SinkCertificateKey:                SinkCertificateConfig,
+	SinkHttpHeadersKey:                SinkHttpHeadersConfig,
+	SinkHttpRetryStatusCodesKey:       SinkHttpRetryStatusCodesConfig,
+	SinkHttpSkipStatusCodesKey:        SinkHttpSkipStatusCodesConfig,
+	SinkKafkaMaxRequestBytesKey:       SinkKafkaMaxRequestBytesConfig,
 }
 
 // Adding values in this struct is deprecated - use ReplicationSettings.Settings.Values instead
@@ -200,6 +289,10 @@ type ReplicationSettings struct {
 
 	// revision number to be used by metadata service. not included in json - not currently being used/set
 	Revision interface{}
+
+	// parsed form of the schedule setting. nil when replication does not have a schedule
+	// it is refreshed whenever the settings map is changed, so that schedule is not parsed on every check
+	schedule *ReplicationSchedule
 }
 
 type ReplicationMultiValueHelper struct {
@@ -357,6 +450,13 @@ func (s *ReplicationSettings) Redact() *ReplicationSettings {
 		s.FilterExpression = base.TagUD(s.FilterExpression)
 	}
 
+	// password of sink and http headers, which may carry tokens, are cleared instead of tagged
+	for _, key := range []string{SinkPasswordKey, SinkHttpHeadersKey} {
+		if value, ok := s.Values[key]; ok && len(value.(string)) > 0 {
+			s.Values[key] = ""
+		}
+	}
+
 	return s
 }
 
@@ -438,6 +538,8 @@ func (s *ReplicationSettings) PostProcessAfterUnmarshalling() {
 		}
 
 		// no need for populateFieldsUsingMap() since fields and map in metakv should already be consistent
+		// schedule is not persisted in parsed form and needs to be populated still
+		s.populateSchedule()
 	}
 	s.HandleUpgrade()
 }
@@ -539,12 +641,36 @@ func (s *ReplicationSettings) populateFieldsUsingMap() {
 	if value, ok = s.Values[CompressionTypeKey]; ok {
 		s.CompressionType = value.(int)
 	}
+	s.populateSchedule()
+}
+
+func (s *ReplicationSettings) populateSchedule() {
+	s.schedule = nil
+	schedule := s.GetSchedule()
+	if len(schedule) == 0 {
+		return
+	}
+	replSchedule, err := ParseReplicationSchedule(schedule, s.GetScheduleTimezone())
+	if err != nil {
+		// schedule has been validated when it is set. this should not happen
+		return
+	}
+	s.schedule = replSchedule
 }
 
 func (s *ReplicationSettings) IsCapi() bool {
 	return s.RepType == ReplicationTypeCapi
 }
 
+// whether replication is to a sink, i.e., a non-couchbase target, instead of a couchbase cluster
+func (s *ReplicationSettings) IsSink() bool {
+	return IsSinkReplicationType(s.RepType)
+}
+
+func IsSinkReplicationType(repType string) bool {
+	return len(repType) > 0 && repType != ReplicationTypeXmem && repType != ReplicationTypeCapi
+}
+
 func (s *ReplicationSettings) GetPriority() base.PriorityType {
 	priority, _ := s.GetSettingValueOrDefaultValue(PriorityKey)
 	return priority.(base.PriorityType)
@@ -563,6 +689,74 @@ func (s *ReplicationSettings) GetCompressionType() int {
 	}
 }
 
+func (s *ReplicationSettings) GetConflictResolver() string {
+	return s.GetStringSettingValue(ConflictResolverKey)
+}
+
+func (s *ReplicationSettings) GetConflictLogging() bool {
+	return s.GetBoolSettingValue(ConflictLoggingKey)
+}
+
+func (s *ReplicationSettings) GetTargetBatchLatency() int {
+	return s.GetIntSettingValue(TargetBatchLatencyKey)
+}
+
+func (s *ReplicationSettings) GetConnectionsPerTargetNozzle() int {
+	return s.GetIntSettingValue(ConnectionsPerTargetNozzleKey)
+}
+
+// settings of replication to a sink for connecting to the sink
+func (s *ReplicationSettings) GetSinkSettings() SinkSettings {
+	return SinkSettingsFromMap(s.Values)
+}
+
+func (s *ReplicationSettings) GetSchedule() string {
+	return s.GetStringSettingValue(ScheduleKey)
+}
+
+func (s *ReplicationSettings) GetScheduleTimezone() string {
+	return s.GetStringSettingValue(ScheduleTimezoneKey)
+}
+
+// whether replication is allowed to run at the specified time according to its schedule
+// replication without schedule can run any time
+func (s *ReplicationSettings) InScheduleWindow(t time.Time) bool {
+	if s.schedule == nil {
+		return true
+	}
+	return s.schedule.InWindow(t)
+}
+
+func (s *ReplicationSettings) GetBandwidthProfile() string {
+	return s.GetStringSettingValue(BandwidthProfileKey)
+}
+
+func (s *ReplicationSettings) GetTransformationRules() string {
+	return s.GetStringSettingValue(TransformationRulesKey)
+}
+
+// returns nil when replication is not bounded, i.e., when it streams data continuously
+func (s *ReplicationSettings) GetBoundedRange() *BoundedRange {
+	boundedRange, err := ParseBoundedRange(s.GetStringSettingValue(BoundedSeqnoRangeKey), s.GetStringSettingValue(BoundedTimeRangeKey))
+	if err != nil {
+		// ranges have been validated when they are set. this should not happen
+		return nil
+	}
+	return boundedRange
+}
+
+func (s *ReplicationSettings) IsBounded() bool {
+	return len(s.GetStringSettingValue(BoundedSeqnoRangeKey)) > 0 || len(s.GetStringSettingValue(BoundedTimeRangeKey)) > 0
+}
+
+func (s *ReplicationSettings) IsBoundedCompleted() bool {
+	return s.IsBounded() && s.GetBoolSettingValue(BoundedCompletedKey)
+}
+
+func (s *ReplicationSettings) GetFilterDelExpFallback() string {
+	return s.GetStringSettingValue(FilterDelExpFallbackKey)
+}
+
 func (s *ReplicationSettings) GetExpDelMode() base.FilterExpDelType {
 	expDel, _ := s.GetSettingValueOrDefaultValue(base.FilterExpDelKey)
 	return expDel.(base.FilterExpDelType)
@@ -583,7 +777,9 @@ const (
 var replicationSettingsMapRedactDict = map[string]redactDictType{FilterExpressionKey: redactDictString,
 	XmemCertificate:       redactDictBytes,
 	XmemClientKey:         redactDictBytesClear, // Clear the value instead of redaction
-	XmemClientCertificate: redactDictBytes}
+	XmemClientCertificate: redactDictBytes,
+	SinkPasswordKey:       redactDictStringClear,
+	SinkHttpHeadersKey:    redactDictStringClear}
 
 // Input - the key that is being redacted. Value - the value to be redacted
 // The function will redact the value automatically if the key needs to be redacted, otherwise, it will do shallow clone
@@ -648,7 +844,8 @@ func ValidateAndConvertReplicationSettingsValue(key, value, errorKey string, isE
 	switch key {
 	// special cases
 	case ReplicationTypeKey:
-		if value != ReplicationTypeXmem && value != ReplicationTypeCapi {
+		// replication types other than xmem and capi are names of sinks, which are validated against the sink registry in ReplicationSpecService
+		if len(value) == 0 {
 			err = base.GenericInvalidValueError(errorKey)
 		} else {
 			convertedValue = value
@@ -738,6 +935,144 @@ func ValidateAndConvertReplicationSettingsValue(key, value, errorKey string, isE
 		if err = nonCAPIOnlyFeature(convertedValue.(base.FilterExpDelType), base.FilterExpDelNone, isCapi); err != nil {
 			return
 		}
+	case TransformationRulesKey:
+		// empty value removes transformation rules
+		if len(value) > 0 {
+			if _, err = ParseTransformationRules(value); err != nil {
+				return
+			}
+		}
+		// transformation is done by router on requests sent through xmem
+		if err = enterpriseOnlyFeature(value, "", isEnterprise); err != nil {
+			return
+		}
+		if err = nonCAPIOnlyFeature(value, "", isCapi); err != nil {
+			return
+		}
+		convertedValue = value
+	case FilterDelExpFallbackKey:
+		if value != base.FilterDelExpFallbackReplicate && value != base.FilterDelExpFallbackSkip {
+			err = fmt.Errorf("%v needs to be either %v or %v", errorKey, base.FilterDelExpFallbackReplicate, base.FilterDelExpFallbackSkip)
+			return
+		}
+		// filtering is done by router and applies to non-CAPI replications only
+		if err = enterpriseOnlyFeature(value, base.FilterDelExpFallbackReplicate, isEnterprise); err != nil {
+			return
+		}
+		if err = nonCAPIOnlyFeature(value, base.FilterDelExpFallbackReplicate, isCapi); err != nil {
+			return
+		}
+		convertedValue = value
+	case ConflictResolverKey:
+		// validated against the registry here, so that settings updates, which do not always go through
+		// ReplicationSpecService, cannot store a resolver that pipelines fail to start with
+		if len(value) == 0 {
+			err = base.GenericInvalidValueError(errorKey)
+			return
+		}
+		if err = base.ValidateConflictResolver(value); err != nil {
+			return
+		}
+		if err = nonCAPIOnlyFeature(value, base.ConflictResolverDefault, isCapi); err != nil {
+			return
+		}
+		convertedValue = value
+	case ConflictLoggingKey:
+		convertedValue, err = ValidateAndConvertSettingsValue(key, value, ReplicationSettingsConfigMap)
+		if err != nil {
+			return
+		}
+		// conflict log is populated by xmem only
+		if err = nonCAPIOnlyFeature(convertedValue.(bool), false, isCapi); err != nil {
+			return
+		}
+	case TargetBatchLatencyKey:
+		convertedValue, err = ValidateAndConvertSettingsValue(key, value, ReplicationSettingsConfigMap)
+		if err != nil {
+			return
+		}
+		// batch sizes are adapted by xmem only
+		if err = nonCAPIOnlyFeature(convertedValue.(int), 0, isCapi); err != nil {
+			return
+		}
+	case ConnectionsPerTargetNozzleKey:
+		convertedValue, err = ValidateAndConvertSettingsValue(key, value, ReplicationSettingsConfigMap)
+		if err != nil {
+			return
+		}
+		if err = nonCAPIOnlyFeature(convertedValue.(int), ConnectionsPerTargetNozzleConfig.defaultValue, isCapi); err != nil {
+			return
+		}
+	case ScheduleKey:
+		// empty value removes the schedule
+		if len(value) > 0 {
+			// timezone is validated separately
+			if _, err = ParseReplicationSchedule(value, ScheduleTimezoneConfig.defaultValue.(string)); err != nil {
+				return
+			}
+		}
+		convertedValue = value
+	case BandwidthProfileKey:
+		// empty value removes the bandwidth profile
+		if len(value) > 0 {
+			// timezone is validated separately
+			if _, err = ParseBandwidthProfile(value, ScheduleTimezoneConfig.defaultValue.(string)); err != nil {
+				return
+			}
+		}
+		// bandwidth profile is an extension of bandwidth limit and is subject to the same restrictions
+		if err = enterpriseOnlyFeature(value, "", isEnterprise); err != nil {
+			return
+		}
+		if err = nonCAPIOnlyFeature(value, "", isCapi); err != nil {
+			return
+		}
+		convertedValue = value
+	case BoundedSeqnoRangeKey:
+		// empty value means that replication is not bounded by seqno
+		if len(value) > 0 {
+			if _, err = ParseBoundedRange(value, ""); err != nil {
+				return
+			}
+		}
+		convertedValue = value
+	case BoundedTimeRangeKey:
+		// empty value means that replication is not bounded by time
+		if len(value) > 0 {
+			if _, err = ParseBoundedRange("", value); err != nil {
+				return
+			}
+		}
+		convertedValue = value
+	case SinkCertificateKey:
+		// empty value means that system certificates are used
+		if len(value) > 0 && !x509.NewCertPool().AppendCertsFromPEM([]byte(value)) {
+			err = fmt.Errorf("%v needs to contain PEM encoded certificates", errorKey)
+			return
+		}
+		convertedValue = value
+	case SinkHttpHeadersKey:
+		// empty value means no additional headers
+		if len(value) > 0 {
+			if _, err = ParseSinkHttpHeaders(value); err != nil {
+				return
+			}
+		}
+		convertedValue = value
+	case SinkHttpRetryStatusCodesKey, SinkHttpSkipStatusCodesKey:
+		// empty value means default retry status codes, or no skip status codes
+		if len(value) > 0 {
+			if _, err = ParseSinkHttpStatusCodes(value); err != nil {
+				return
+			}
+		}
+		convertedValue = value
+	case ScheduleTimezoneKey:
+		if _, err = time.LoadLocation(value); err != nil || len(value) == 0 {
+			err = base.GenericInvalidValueError(errorKey)
+			return
+		}
+		convertedValue = value
 	default:
 		// generic cases that can be handled by ValidateAndConvertSettingsValue
 		convertedValue, err = ValidateAndConvertSettingsValue(key, value, ReplicationSettingsConfigMap)
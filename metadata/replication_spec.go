@@ -14,6 +14,7 @@ import (
 	"github.com/couchbase/goxdcr/base"
 	"reflect"
 	"strings"
+	"time"
 )
 
 /************************************
@@ -42,6 +43,9 @@ type ReplicationSpecification struct {
 
 	Settings *ReplicationSettings `json:"replicationSettings"`
 
+	// reason of the pause and scheduled resume time, when replication has been paused through pauseReplication endpoint
+	PauseInfo *base.PauseInfo `json:"pauseInfo,omitempty"`
+
 	// revision number to be used by metadata service. not included in json
 	Revision interface{}
 }
@@ -99,6 +103,7 @@ func (spec *ReplicationSpecification) Clone() *ReplicationSpecification {
 		TargetBucketName:  spec.TargetBucketName,
 		TargetBucketUUID:  spec.TargetBucketUUID,
 		Settings:          spec.Settings.Clone(),
+		PauseInfo:         spec.PauseInfo.Clone(),
 		// !!! shallow copy of revision.
 		// spec.Revision should only be passed along and should never be modified
 		Revision: spec.Revision}
@@ -138,11 +143,30 @@ func (spec *ReplicationSpecification) UpgradeFilterIfNeeded() {
 	}
 }
 
+// whether replication has been paused with a scheduled resume time that has been reached
+func (spec *ReplicationSpecification) IsResumeDue(now time.Time) bool {
+	return spec.Settings != nil && !spec.Settings.Active && spec.PauseInfo != nil &&
+		spec.PauseInfo.ResumeTime > 0 && spec.PauseInfo.ResumeTime <= now.Unix()
+}
+
 func ReplicationId(sourceBucketName string, targetClusterUUID string, targetBucketName string) string {
 	parts := []string{targetClusterUUID, sourceBucketName, targetBucketName}
 	return strings.Join(parts, base.KeyPartsDelimiter)
 }
 
+// prefix of the target identifiers of replications to sinks
+const SinkTargetClusterUUIDPrefix = "sink-"
+
+// replications to sinks do not need remote cluster references. the returned identifier of the sink type
+// takes the place of target cluster uuid in the specs of replications to sinks of the type
+func SinkTargetClusterUUID(sinkType string) string {
+	return SinkTargetClusterUUIDPrefix + sinkType
+}
+
+func IsSinkTargetClusterUUID(targetClusterUUID string) bool {
+	return strings.HasPrefix(targetClusterUUID, SinkTargetClusterUUIDPrefix)
+}
+
 func IsReplicationIdForSourceBucket(replicationId string, sourceBucketName string) (bool, error) {
 	replBucketName, err := GetSourceBucketNameFromReplicationId(replicationId)
 	if err != nil {
@@ -0,0 +1,46 @@
+// +build !pcre
+
+package metadata
+
+import (
+	"fmt"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestIsResumeDue(t *testing.T) {
+	fmt.Println("============== Test case start: TestIsResumeDue =================")
+	assert := assert.New(t)
+
+	now := time.Unix(1600000000, 0)
+
+	testCases := []struct {
+		name      string
+		active    bool
+		pauseInfo *base.PauseInfo
+		expected  bool
+	}{
+		{"active", true, &base.PauseInfo{ResumeTime: now.Unix() - 1}, false},
+		{"paused without pause info", false, nil, false},
+		{"paused without scheduled resume", false, &base.PauseInfo{PauseTime: now.Unix() - 10}, false},
+		{"resume time in future", false, &base.PauseInfo{ResumeTime: now.Unix() + 1}, false},
+		{"resume time reached", false, &base.PauseInfo{ResumeTime: now.Unix()}, true},
+		{"resume time passed", false, &base.PauseInfo{ResumeTime: now.Unix() - 3600}, true},
+	}
+
+	for _, testCase := range testCases {
+		spec, err := NewReplicationSpecification("source", "sourceUUID", "targetClusterUUID", "target", "targetUUID")
+		assert.Nil(err)
+		spec.Settings.Active = testCase.active
+		spec.PauseInfo = testCase.pauseInfo
+		assert.Equal(testCase.expected, spec.IsResumeDue(now), testCase.name)
+	}
+
+	// replication without settings
+	spec := &ReplicationSpecification{PauseInfo: &base.PauseInfo{ResumeTime: now.Unix() - 1}}
+	assert.False(spec.IsResumeDue(now))
+
+	fmt.Println("============== Test case end: TestIsResumeDue =================")
+}
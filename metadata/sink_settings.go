@@ -0,0 +1,206 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/couchbase/goxdcr/base"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	SinkKafkaBrokerDelimiter    = ","
+	SinkHttpStatusCodeDelimiter = ","
+)
+
+// SinkSettings are the settings of a replication to a sink that the sink connects with.
+// They are stored with the replication spec, and are passed to the sink when pipeline is constructed
+type SinkSettings struct {
+	Endpoint    string
+	Username    string
+	Password    string
+	TLS         bool
+	Certificate string
+	// raw values of http sink specific settings
+	HttpHeaders          string
+	HttpRetryStatusCodes string
+	HttpSkipStatusCodes  string
+	// max size of produce requests of kafka sink. 0 means default
+	KafkaMaxRequestBytes int
+}
+
+// SinkSettingsFromMap extracts sink settings from a settings map. missing settings take default, i.e., zero, values
+func SinkSettingsFromMap(settings map[string]interface{}) SinkSettings {
+	sinkSettings := SinkSettings{}
+	sinkSettings.Endpoint, _ = settings[SinkEndpointKey].(string)
+	sinkSettings.Username, _ = settings[SinkUsernameKey].(string)
+	sinkSettings.Password, _ = settings[SinkPasswordKey].(string)
+	sinkSettings.TLS, _ = settings[SinkTLSKey].(bool)
+	sinkSettings.Certificate, _ = settings[SinkCertificateKey].(string)
+	sinkSettings.HttpHeaders, _ = settings[SinkHttpHeadersKey].(string)
+	sinkSettings.HttpRetryStatusCodes, _ = settings[SinkHttpRetryStatusCodesKey].(string)
+	sinkSettings.HttpSkipStatusCodes, _ = settings[SinkHttpSkipStatusCodesKey].(string)
+	sinkSettings.KafkaMaxRequestBytes, _ = settings[SinkKafkaMaxRequestBytesKey].(int)
+	return sinkSettings
+}
+
+// Validate checks that sink settings are complete and applicable to the built-in sink of the specified type,
+// and populates errorMap, which is keyed by rest keys, with the errors found.
+// Format of individual settings, e.g., certificate, has been validated when the settings are set.
+// Settings of sinks other than the built-in ones are not validated.
+func (settings SinkSettings) Validate(sinkType string, errorMap base.ErrorMap) {
+	switch sinkType {
+	case base.SinkTypeFile:
+		// file sink writes to local files and does not connect to anything
+		if settings != (SinkSettings{}) {
+			errorMap[base.SinkEndpointREST] = fmt.Errorf("Sink settings are not applicable to %v sink", sinkType)
+			return
+		}
+	case base.SinkTypeKafka:
+		if _, err := settings.KafkaBrokers(); err != nil {
+			errorMap[base.SinkEndpointREST] = err
+			return
+		}
+		if len(settings.Certificate) > 0 && !settings.TLS {
+			errorMap[base.SinkCertificateREST] = fmt.Errorf("%v is applicable only when %v is true", base.SinkCertificateREST, base.SinkTLSREST)
+			return
+		}
+		if settings.hasHttpSettings() {
+			errorMap[base.SinkHttpHeadersREST] = fmt.Errorf("Http sink settings are not applicable to %v sink", sinkType)
+			return
+		}
+	case base.SinkTypeHttp:
+		if !settings.validateHttpSettings(errorMap) {
+			return
+		}
+		if settings.KafkaMaxRequestBytes != 0 {
+			errorMap[base.SinkKafkaMaxRequestBytesREST] = fmt.Errorf("%v is not applicable to %v sink", base.SinkKafkaMaxRequestBytesREST, sinkType)
+			return
+		}
+	default:
+		return
+	}
+
+	if len(settings.Password) > 0 && len(settings.Username) == 0 {
+		errorMap[base.SinkUsernameREST] = fmt.Errorf("%v needs to be specified along with %v", base.SinkUsernameREST, base.SinkPasswordREST)
+	}
+}
+
+func (settings SinkSettings) hasHttpSettings() bool {
+	return len(settings.HttpHeaders) > 0 || len(settings.HttpRetryStatusCodes) > 0 || len(settings.HttpSkipStatusCodes) > 0
+}
+
+// returns false if errors are found
+func (settings SinkSettings) validateHttpSettings(errorMap base.ErrorMap) bool {
+	parsedUrl, err := url.Parse(settings.Endpoint)
+	if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") || len(parsedUrl.Host) == 0 {
+		errorMap[base.SinkEndpointREST] = fmt.Errorf("%v needs to be an absolute http or https url for %v sink", base.SinkEndpointREST, base.SinkTypeHttp)
+		return false
+	}
+	// whether TLS is used is decided by the scheme of url
+	if settings.TLS {
+		errorMap[base.SinkTLSREST] = fmt.Errorf("%v is not applicable to %v sink. Use https url instead", base.SinkTLSREST, base.SinkTypeHttp)
+		return false
+	}
+	if len(settings.Certificate) > 0 && parsedUrl.Scheme != "https" {
+		errorMap[base.SinkCertificateREST] = fmt.Errorf("%v is applicable only to https url", base.SinkCertificateREST)
+		return false
+	}
+
+	retryStatusCodes, err := settings.HttpRetryStatusCodesOrDefault()
+	if err != nil {
+		errorMap[base.SinkHttpRetryCodesREST] = err
+		return false
+	}
+	skipStatusCodes, err := ParseSinkHttpStatusCodes(settings.HttpSkipStatusCodes)
+	if err != nil {
+		errorMap[base.SinkHttpSkipCodesREST] = err
+		return false
+	}
+	for _, statusCode := range skipStatusCodes {
+		for _, retryStatusCode := range retryStatusCodes {
+			if statusCode == retryStatusCode {
+				errorMap[base.SinkHttpSkipCodesREST] = fmt.Errorf("Status code %v cannot be both retried and skipped", statusCode)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// HttpRetryStatusCodesOrDefault returns the retry status codes of http sink, which default to base.HttpSinkDefaultRetryStatusCodes
+func (settings SinkSettings) HttpRetryStatusCodesOrDefault() ([]int, error) {
+	if len(settings.HttpRetryStatusCodes) == 0 {
+		return base.HttpSinkDefaultRetryStatusCodes, nil
+	}
+	return ParseSinkHttpStatusCodes(settings.HttpRetryStatusCodes)
+}
+
+// KafkaMaxRequestBytesOrDefault returns the max size of produce requests of kafka sink, which defaults to base.KafkaDefaultMaxRequestBytes
+func (settings SinkSettings) KafkaMaxRequestBytesOrDefault() int {
+	if settings.KafkaMaxRequestBytes == 0 {
+		return base.KafkaDefaultMaxRequestBytes
+	}
+	return settings.KafkaMaxRequestBytes
+}
+
+// ParseSinkHttpHeaders parses http headers specified as a json object of names to values
+func ParseSinkHttpHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	if len(value) == 0 {
+		return headers, nil
+	}
+	err := json.Unmarshal([]byte(value), &headers)
+	if err != nil {
+		return nil, fmt.Errorf("Http headers need to be a json object of header names to string values. err=%v", err)
+	}
+	return headers, nil
+}
+
+// ParseSinkHttpStatusCodes parses comma separated status codes, which need to be non-2xx status codes
+func ParseSinkHttpStatusCodes(value string) ([]int, error) {
+	statusCodes := make([]int, 0)
+	if len(value) == 0 {
+		return statusCodes, nil
+	}
+	for _, statusCodeStr := range strings.Split(value, SinkHttpStatusCodeDelimiter) {
+		statusCode, err := strconv.Atoi(strings.TrimSpace(statusCodeStr))
+		if err != nil || statusCode < 100 || statusCode > 599 || (statusCode >= 200 && statusCode < 300) {
+			return nil, fmt.Errorf("Invalid status code %v. Retry and skip status codes need to be non-2xx status codes", statusCodeStr)
+		}
+		statusCodes = append(statusCodes, statusCode)
+	}
+	return statusCodes, nil
+}
+
+// KafkaBrokers returns the bootstrap brokers in the endpoint of kafka sink, each in the form of host:port
+func (settings SinkSettings) KafkaBrokers() ([]string, error) {
+	if len(settings.Endpoint) == 0 {
+		return nil, fmt.Errorf("%v needs to be specified for %v sink, as comma separated host:port of kafka brokers", base.SinkEndpointREST, base.SinkTypeKafka)
+	}
+
+	brokers := strings.Split(settings.Endpoint, SinkKafkaBrokerDelimiter)
+	for index, broker := range brokers {
+		broker = strings.TrimSpace(broker)
+		host, port, err := net.SplitHostPort(broker)
+		if err == nil && len(host) > 0 {
+			_, err = strconv.ParseUint(port, 10, 16)
+		}
+		if err != nil || len(host) == 0 {
+			return nil, fmt.Errorf("Invalid kafka broker %v in %v. It needs to be in the form of host:port", broker, base.SinkEndpointREST)
+		}
+		brokers[index] = broker
+	}
+	return brokers, nil
+}
@@ -0,0 +1,335 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package metadata
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// version of topology document format. to be incremented when incompatible changes are made to the format
+const TopologyDocumentVersion = 1
+
+// ways in which credentials of remote cluster references and sinks are exported
+const (
+	// passwords, client keys and sink http headers are left out of topology document
+	TopologyCredentialsRedacted = "redacted"
+	// passwords, client keys and sink http headers are encrypted with a passphrase supplied at export
+	TopologyCredentialsEncrypted = "encrypted"
+)
+
+const (
+	TopologyPassphraseMinLength = 8
+	topologySaltLength          = 16
+	// iteration count of PBKDF2 key derivation
+	topologyKeyIterations = 100000
+)
+
+var ErrorTopologyCredentialsRedacted = errors.New("Credentials of remote cluster reference were redacted when topology was exported")
+var ErrorTopologySinkCredentialsRedacted = errors.New("Password and http headers of sink were redacted when topology was exported")
+var ErrorTopologyWrongPassphrase = errors.New("Unable to decrypt credentials. Passphrase may be incorrect")
+
+// TopologyDocument is a snapshot of the xdcr configuration of a cluster, which can be imported into the same or another cluster
+type TopologyDocument struct {
+	Version    int    `json:"version"`
+	ExportTime string `json:"exportTime"`
+	// TopologyCredentialsRedacted or TopologyCredentialsEncrypted
+	Credentials string `json:"credentials"`
+	// salt for deriving encryption key from passphrase. present only when credentials are encrypted
+	Salt []byte `json:"salt,omitempty"`
+
+	RemoteClusters []*TopologyRemoteCluster `json:"remoteClusters"`
+	Replications   []*TopologyReplication   `json:"replications"`
+	// default replication settings and global settings, keyed by rest keys
+	DefaultSettings map[string]string `json:"defaultSettings"`
+	// xdcr internal settings
+	InternalSettings map[string]string         `json:"internalSettings"`
+	BucketSettings   []*TopologyBucketSettings `json:"bucketSettings"`
+
+	// encryption key derived from passphrase
+	key []byte
+}
+
+type TopologyRemoteCluster struct {
+	Name              string `json:"name"`
+	Uuid              string `json:"uuid"`
+	HostName          string `json:"hostname"`
+	UserName          string `json:"username,omitempty"`
+	DemandEncryption  bool   `json:"demandEncryption"`
+	EncryptionType    string `json:"encryptionType,omitempty"`
+	Certificate       string `json:"certificate,omitempty"`
+	ClientCertificate string `json:"clientCertificate,omitempty"`
+	// password and client key of remote cluster reference, encrypted. absent when credentials are redacted
+	EncryptedCredentials []byte `json:"encryptedCredentials,omitempty"`
+}
+
+// secrets of remote cluster reference that are encrypted as a whole
+type topologyCredentials struct {
+	Password  string `json:"password"`
+	ClientKey []byte `json:"clientKey,omitempty"`
+}
+
+type TopologyReplication struct {
+	SourceBucket string `json:"sourceBucket"`
+	// name of the remote cluster reference of target cluster, or, for replication to a sink,
+	// the identifier of the sink type that takes the place of target cluster uuid, e.g., "sink-file"
+	TargetCluster string `json:"targetCluster"`
+	TargetBucket  string `json:"targetBucket"`
+	// replication settings, keyed by rest keys. password and http headers of sink are not included
+	Settings map[string]string `json:"settings"`
+	// password and http headers of sink, encrypted. absent when credentials are redacted or when sink has none
+	EncryptedSinkCredentials []byte `json:"encryptedSinkCredentials,omitempty"`
+	// whether password and http headers of sink have been left out of document
+	SinkCredentialsRedacted bool `json:"sinkCredentialsRedacted,omitempty"`
+}
+
+// secrets of sink that are encrypted as a whole
+type topologySinkCredentials struct {
+	Password    string `json:"password,omitempty"`
+	HttpHeaders string `json:"httpHeaders,omitempty"`
+}
+
+type TopologyBucketSettings struct {
+	BucketName string `json:"bucketName"`
+	LWWEnabled bool   `json:"lwwEnabled"`
+}
+
+func NewTopologyDocument(credentials, passphrase string) (*TopologyDocument, error) {
+	doc := &TopologyDocument{
+		Version:          TopologyDocumentVersion,
+		ExportTime:       time.Now().UTC().Format(time.RFC3339),
+		Credentials:      credentials,
+		RemoteClusters:   make([]*TopologyRemoteCluster, 0),
+		Replications:     make([]*TopologyReplication, 0),
+		DefaultSettings:  make(map[string]string),
+		InternalSettings: make(map[string]string),
+		BucketSettings:   make([]*TopologyBucketSettings, 0),
+	}
+
+	switch credentials {
+	case TopologyCredentialsRedacted:
+	case TopologyCredentialsEncrypted:
+		doc.Salt = make([]byte, topologySaltLength)
+		_, err := rand.Read(doc.Salt)
+		if err != nil {
+			return nil, err
+		}
+		err = doc.deriveKey(passphrase)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("credentials needs to be either %v or %v", TopologyCredentialsRedacted, TopologyCredentialsEncrypted)
+	}
+	return doc, nil
+}
+
+// Prepare validates a topology document that has been unmarshalled for import, and derives encryption key from
+// passphrase when credentials are encrypted. passphrase is not used when credentials are redacted
+func (doc *TopologyDocument) Prepare(passphrase string) error {
+	if doc.Version <= 0 || doc.Version > TopologyDocumentVersion {
+		return fmt.Errorf("Topology document version %v is not supported. Supported version is %v", doc.Version, TopologyDocumentVersion)
+	}
+
+	switch doc.Credentials {
+	case TopologyCredentialsRedacted:
+		return nil
+	case TopologyCredentialsEncrypted:
+		if len(doc.Salt) != topologySaltLength {
+			return errors.New("Topology document does not contain a valid salt for encrypted credentials")
+		}
+		return doc.deriveKey(passphrase)
+	default:
+		return fmt.Errorf("credentials of topology document needs to be either %v or %v", TopologyCredentialsRedacted, TopologyCredentialsEncrypted)
+	}
+}
+
+// AddRemoteCluster adds ref to document. credentials of ref are encrypted or left out depending on doc.Credentials
+func (doc *TopologyDocument) AddRemoteCluster(ref *RemoteClusterReference) error {
+	userName, password, _, certificate, _, clientCertificate, clientKey, _ := ref.MyCredentials()
+	remoteCluster := &TopologyRemoteCluster{
+		Name:              ref.Name(),
+		Uuid:              ref.Uuid(),
+		HostName:          ref.HostName(),
+		UserName:          userName,
+		DemandEncryption:  ref.DemandEncryption(),
+		EncryptionType:    ref.EncryptionType(),
+		Certificate:       string(certificate),
+		ClientCertificate: string(clientCertificate),
+	}
+
+	if doc.Credentials == TopologyCredentialsEncrypted {
+		plaintext, err := json.Marshal(&topologyCredentials{password, clientKey})
+		if err != nil {
+			return err
+		}
+		remoteCluster.EncryptedCredentials, err = doc.encrypt(plaintext)
+		if err != nil {
+			return err
+		}
+	}
+
+	doc.RemoteClusters = append(doc.RemoteClusters, remoteCluster)
+	return nil
+}
+
+// RemoteClusterReference constructs a new remote cluster reference from remoteCluster, with its credentials decrypted
+// returns ErrorTopologyCredentialsRedacted when credentials were not exported
+func (doc *TopologyDocument) RemoteClusterReference(remoteCluster *TopologyRemoteCluster) (*RemoteClusterReference, error) {
+	if doc.Credentials != TopologyCredentialsEncrypted || len(remoteCluster.EncryptedCredentials) == 0 {
+		return nil, ErrorTopologyCredentialsRedacted
+	}
+
+	plaintext, err := doc.decrypt(remoteCluster.EncryptedCredentials)
+	if err != nil {
+		return nil, err
+	}
+	credentials := &topologyCredentials{}
+	err = json.Unmarshal(plaintext, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	var certificate, clientCertificate []byte
+	if len(remoteCluster.Certificate) > 0 {
+		certificate = []byte(remoteCluster.Certificate)
+	}
+	if len(remoteCluster.ClientCertificate) > 0 {
+		clientCertificate = []byte(remoteCluster.ClientCertificate)
+	}
+	// uuid is left empty, as it is when remote cluster reference is created through rest api.
+	// it will be populated with the uuid of target cluster during validation
+	return NewRemoteClusterReference("", remoteCluster.Name, remoteCluster.HostName, remoteCluster.UserName, credentials.Password,
+		remoteCluster.DemandEncryption, remoteCluster.EncryptionType, certificate, clientCertificate, credentials.ClientKey)
+}
+
+// AddReplication adds replication to document. password and http headers of sink are encrypted
+// or left out depending on doc.Credentials
+func (doc *TopologyDocument) AddReplication(replication *TopologyReplication, sinkPassword, sinkHttpHeaders string) error {
+	if len(sinkPassword) > 0 || len(sinkHttpHeaders) > 0 {
+		if doc.Credentials == TopologyCredentialsEncrypted {
+			plaintext, err := json.Marshal(&topologySinkCredentials{sinkPassword, sinkHttpHeaders})
+			if err != nil {
+				return err
+			}
+			replication.EncryptedSinkCredentials, err = doc.encrypt(plaintext)
+			if err != nil {
+				return err
+			}
+		} else {
+			replication.SinkCredentialsRedacted = true
+		}
+	}
+
+	doc.Replications = append(doc.Replications, replication)
+	return nil
+}
+
+// SinkCredentials returns the password and http headers of the sink of replication, decrypted. they are empty when sink has none
+// returns ErrorTopologySinkCredentialsRedacted when they were not exported
+func (doc *TopologyDocument) SinkCredentials(replication *TopologyReplication) (sinkPassword, sinkHttpHeaders string, err error) {
+	if replication.SinkCredentialsRedacted {
+		err = ErrorTopologySinkCredentialsRedacted
+		return
+	}
+	if len(replication.EncryptedSinkCredentials) == 0 {
+		return
+	}
+
+	plaintext, err := doc.decrypt(replication.EncryptedSinkCredentials)
+	if err != nil {
+		return
+	}
+	credentials := &topologySinkCredentials{}
+	err = json.Unmarshal(plaintext, credentials)
+	if err != nil {
+		return
+	}
+	return credentials.Password, credentials.HttpHeaders, nil
+}
+
+func (doc *TopologyDocument) deriveKey(passphrase string) error {
+	if len(passphrase) < TopologyPassphraseMinLength {
+		return fmt.Errorf("passphrase needs to contain at least %v characters when credentials are encrypted", TopologyPassphraseMinLength)
+	}
+	doc.key = pbkdf2Sha256([]byte(passphrase), doc.Salt, topologyKeyIterations)
+	return nil
+}
+
+// encrypts plaintext with AES-256-GCM. a random nonce is prepended to the output
+func (doc *TopologyDocument) encrypt(plaintext []byte) ([]byte, error) {
+	gcm, err := doc.newGCM()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (doc *TopologyDocument) decrypt(ciphertext []byte) ([]byte, error) {
+	gcm, err := doc.newGCM()
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, ErrorTopologyWrongPassphrase
+	}
+	plaintext, err := gcm.Open(nil, ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrorTopologyWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+func (doc *TopologyDocument) newGCM() (cipher.AEAD, error) {
+	if doc.key == nil {
+		return nil, errors.New("Encryption key has not been derived from passphrase")
+	}
+	block, err := aes.NewCipher(doc.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// PBKDF2 (RFC 8018) with HMAC-SHA256, producing a single block of 32 bytes, which is the key size of AES-256
+func pbkdf2Sha256(password, salt []byte, iterations int) []byte {
+	prf := hmac.New(sha256.New, password)
+	blockIndex := make([]byte, 4)
+	binary.BigEndian.PutUint32(blockIndex, 1)
+
+	prf.Write(salt)
+	prf.Write(blockIndex)
+	u := prf.Sum(nil)
+	key := make([]byte, len(u))
+	copy(key, u)
+
+	for i := 1; i < iterations; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
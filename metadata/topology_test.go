@@ -0,0 +1,142 @@
+// +build !pcre
+
+package metadata
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTopologyPbkdf2(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestTopologyPbkdf2 =================")
+
+	// test vectors of PBKDF2-HMAC-SHA256
+	assert.Equal("120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b",
+		hex.EncodeToString(pbkdf2Sha256([]byte("password"), []byte("salt"), 1)))
+	assert.Equal("ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43",
+		hex.EncodeToString(pbkdf2Sha256([]byte("password"), []byte("salt"), 2)))
+	assert.Equal("c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a",
+		hex.EncodeToString(pbkdf2Sha256([]byte("password"), []byte("salt"), 4096)))
+
+	fmt.Println("============== Test case end: TestTopologyPbkdf2 =================")
+}
+
+func TestTopologyDocumentCredentials(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestTopologyDocumentCredentials =================")
+
+	ref, err := NewRemoteClusterReference("uuid", "remote", "127.0.0.1:9000", "Administrator", "secret",
+		true, EncryptionType_Full, []byte("cert"), []byte("clientCert"), []byte("clientKey"))
+	assert.Nil(err)
+
+	// encrypted credentials
+	_, err = NewTopologyDocument(TopologyCredentialsEncrypted, "short")
+	assert.NotNil(err)
+	doc, err := NewTopologyDocument(TopologyCredentialsEncrypted, "passphrase")
+	assert.Nil(err)
+	assert.Nil(doc.AddRemoteCluster(ref))
+	docBytes, err := json.Marshal(doc)
+	assert.Nil(err)
+	assert.NotContains(string(docBytes), "secret")
+	assert.NotContains(string(docBytes), "clientKey\"")
+
+	importedDoc := &TopologyDocument{}
+	assert.Nil(json.Unmarshal(docBytes, importedDoc))
+	assert.Nil(importedDoc.Prepare("wrongPassphrase"))
+	_, err = importedDoc.RemoteClusterReference(importedDoc.RemoteClusters[0])
+	assert.Equal(ErrorTopologyWrongPassphrase, err)
+
+	assert.Nil(importedDoc.Prepare("passphrase"))
+	importedRef, err := importedDoc.RemoteClusterReference(importedDoc.RemoteClusters[0])
+	assert.Nil(err)
+	assert.Equal("remote", importedRef.Name())
+	assert.Equal("127.0.0.1:9000", importedRef.HostName())
+	assert.True(ref.AreUserSecurityCredentialsTheSame(importedRef))
+
+	// redacted credentials
+	doc, err = NewTopologyDocument(TopologyCredentialsRedacted, "")
+	assert.Nil(err)
+	assert.Nil(doc.AddRemoteCluster(ref))
+	assert.Nil(doc.RemoteClusters[0].EncryptedCredentials)
+	assert.Equal("Administrator", doc.RemoteClusters[0].UserName)
+	_, err = doc.RemoteClusterReference(doc.RemoteClusters[0])
+	assert.Equal(ErrorTopologyCredentialsRedacted, err)
+
+	_, err = NewTopologyDocument("plain", "")
+	assert.NotNil(err)
+
+	fmt.Println("============== Test case end: TestTopologyDocumentCredentials =================")
+}
+
+func TestTopologyDocumentSinkCredentials(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestTopologyDocumentSinkCredentials =================")
+
+	newReplication := func() *TopologyReplication {
+		return &TopologyReplication{SourceBucket: "source", TargetCluster: "remote", TargetBucket: "target",
+			Settings: map[string]string{"type": "http"}}
+	}
+
+	// encrypted credentials
+	doc, err := NewTopologyDocument(TopologyCredentialsEncrypted, "passphrase")
+	assert.Nil(err)
+	assert.Nil(doc.AddReplication(newReplication(), "secret", `{"X-Token":"token"}`))
+	// replication without sink credentials
+	assert.Nil(doc.AddReplication(newReplication(), "", ""))
+	assert.Nil(doc.Replications[1].EncryptedSinkCredentials)
+	docBytes, err := json.Marshal(doc)
+	assert.Nil(err)
+	assert.NotContains(string(docBytes), "secret")
+	assert.NotContains(string(docBytes), "token")
+
+	importedDoc := &TopologyDocument{}
+	assert.Nil(json.Unmarshal(docBytes, importedDoc))
+	assert.Nil(importedDoc.Prepare("wrongPassphrase"))
+	_, _, err = importedDoc.SinkCredentials(importedDoc.Replications[0])
+	assert.Equal(ErrorTopologyWrongPassphrase, err)
+
+	assert.Nil(importedDoc.Prepare("passphrase"))
+	password, httpHeaders, err := importedDoc.SinkCredentials(importedDoc.Replications[0])
+	assert.Nil(err)
+	assert.Equal("secret", password)
+	assert.Equal(`{"X-Token":"token"}`, httpHeaders)
+	password, httpHeaders, err = importedDoc.SinkCredentials(importedDoc.Replications[1])
+	assert.Nil(err)
+	assert.Equal("", password)
+	assert.Equal("", httpHeaders)
+
+	// redacted credentials
+	doc, err = NewTopologyDocument(TopologyCredentialsRedacted, "")
+	assert.Nil(err)
+	assert.Nil(doc.AddReplication(newReplication(), "secret", ""))
+	assert.Nil(doc.AddReplication(newReplication(), "", ""))
+	assert.True(doc.Replications[0].SinkCredentialsRedacted)
+	assert.Nil(doc.Replications[0].EncryptedSinkCredentials)
+	_, _, err = doc.SinkCredentials(doc.Replications[0])
+	assert.Equal(ErrorTopologySinkCredentialsRedacted, err)
+	assert.False(doc.Replications[1].SinkCredentialsRedacted)
+	_, _, err = doc.SinkCredentials(doc.Replications[1])
+	assert.Nil(err)
+
+	fmt.Println("============== Test case end: TestTopologyDocumentSinkCredentials =================")
+}
+
+func TestTopologyDocumentVersion(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestTopologyDocumentVersion =================")
+
+	doc, err := NewTopologyDocument(TopologyCredentialsRedacted, "")
+	assert.Nil(err)
+	assert.Nil(doc.Prepare(""))
+
+	doc.Version = TopologyDocumentVersion + 1
+	assert.NotNil(doc.Prepare(""))
+	doc.Version = 0
+	assert.NotNil(doc.Prepare(""))
+
+	fmt.Println("============== Test case end: TestTopologyDocumentVersion =================")
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// types of transformation rules
+const (
+	// prepends Value to document keys
+	TransformKeyPrefix = "keyPrefix"
+	// replaces matches of regular expression Match in document keys with Replace
+	TransformKeyRename = "keyRename"
+	// removes Field from document bodies
+	TransformDropField = "dropField"
+	// replaces the value of Field in document bodies with Value, or with DefaultFieldMask when Value is not specified
+	TransformMaskField = "maskField"
+	// removes extended attribute Xattr from documents
+	TransformStripXattr = "stripXattr"
+	// sets the expiry of documents to TTL seconds from the time they are replicated
+	TransformSetTTL = "setTTL"
+)
+
+const (
+	DefaultFieldMask = "****"
+	// delimiter between levels of a field path, e.g., address.zip
+	FieldPathDelimiter = "."
+)
+
+// TransformationRule is a declarative rule in the transformation_rules setting of a replication, which is a
+// json array of rules, e.g., [{"type":"keyPrefix","value":"dc1::"},{"type":"maskField","field":"customer.ssn"}]
+// rules are applied in the order in which they are specified
+// a document whose key is changed may belong to a different vbucket than the source document, and is routed
+// to the target vbucket of its new key
+type TransformationRule struct {
+	Type    string `json:"type"`
+	Value   string `json:"value,omitempty"`
+	Match   string `json:"match,omitempty"`
+	Replace string `json:"replace,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Xattr   string `json:"xattr,omitempty"`
+	TTL     uint32 `json:"ttl,omitempty"`
+
+	// compiled Match of keyRename rule
+	matchRegex *regexp.Regexp
+}
+
+func ParseTransformationRules(rules string) ([]*TransformationRule, error) {
+	var ruleList []*TransformationRule
+	err := json.Unmarshal([]byte(rules), &ruleList)
+	if err != nil {
+		return nil, fmt.Errorf("Transformation rules need to be a json array of rules. err=%v", err)
+	}
+	if len(ruleList) == 0 {
+		return nil, fmt.Errorf("Transformation rules %v does not contain any rule", rules)
+	}
+
+	for index, rule := range ruleList {
+		if rule == nil {
+			return nil, fmt.Errorf("Transformation rule %v is empty", index)
+		}
+		err = rule.validate()
+		if err != nil {
+			return nil, fmt.Errorf("Transformation rule %v is invalid. err=%v", index, err)
+		}
+	}
+	return ruleList, nil
+}
+
+func (rule *TransformationRule) validate() error {
+	switch rule.Type {
+	case TransformKeyPrefix:
+		if len(rule.Value) == 0 {
+			return fmt.Errorf("value needs to be specified for %v rule", rule.Type)
+		}
+	case TransformKeyRename:
+		if len(rule.Match) == 0 {
+			return fmt.Errorf("match needs to be specified for %v rule", rule.Type)
+		}
+		matchRegex, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return fmt.Errorf("match %v is not a valid regular expression. err=%v", rule.Match, err)
+		}
+		rule.matchRegex = matchRegex
+	case TransformDropField, TransformMaskField:
+		if len(rule.Field) == 0 {
+			return fmt.Errorf("field needs to be specified for %v rule", rule.Type)
+		}
+		for _, fieldName := range rule.FieldPath() {
+			if len(fieldName) == 0 {
+				return fmt.Errorf("field %v is not a valid field path", rule.Field)
+			}
+		}
+	case TransformStripXattr:
+		if len(rule.Xattr) == 0 {
+			return fmt.Errorf("xattr needs to be specified for %v rule", rule.Type)
+		}
+	case TransformSetTTL:
+		if rule.TTL == 0 {
+			return fmt.Errorf("ttl needs to be a positive integer for %v rule", rule.Type)
+		}
+	default:
+		return fmt.Errorf("type %v is not valid. Valid types are %v, %v, %v, %v, %v and %v", rule.Type, TransformKeyPrefix,
+			TransformKeyRename, TransformDropField, TransformMaskField, TransformStripXattr, TransformSetTTL)
+	}
+	return nil
+}
+
+// field path of dropField and maskField rules, e.g., [address zip] for address.zip
+func (rule *TransformationRule) FieldPath() []string {
+	return strings.Split(rule.Field, FieldPathDelimiter)
+}
+
+// whether the rule changes document keys
+func (rule *TransformationRule) IsKeyRule() bool {
+	return rule.Type == TransformKeyPrefix || rule.Type == TransformKeyRename
+}
+
+// applies keyPrefix or keyRename rule to document key
+func (rule *TransformationRule) TransformKey(key []byte) []byte {
+	switch rule.Type {
+	case TransformKeyPrefix:
+		newKey := make([]byte, 0, len(rule.Value)+len(key))
+		newKey = append(newKey, rule.Value...)
+		return append(newKey, key...)
+	case TransformKeyRename:
+		return rule.matchRegex.ReplaceAll(key, []byte(rule.Replace))
+	default:
+		return key
+	}
+}
+
+// whether transformation rules change document keys, in which case documents may be routed to target vbuckets
+// other than the vbuckets of the source documents. invalid rules do not change keys
+func TransformationRulesChangeKeys(rules string) bool {
+	if len(rules) == 0 {
+		return false
+	}
+	ruleList, err := ParseTransformationRules(rules)
+	if err != nil {
+		return false
+	}
+	for _, rule := range ruleList {
+		if rule.IsKeyRule() {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *TransformationRule) FieldMask() string {
+	if len(rule.Value) > 0 {
+		return rule.Value
+	}
+	return DefaultFieldMask
+}
@@ -0,0 +1,71 @@
+// +build !pcre
+
+package metadata
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseTransformationRules(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestParseTransformationRules =================")
+
+	rules, err := ParseTransformationRules(`[{"type":"maskField","field":"customer.ssn"},{"type":"dropField","field":"notes"},
+		{"type":"stripXattr","xattr":"_sync"},{"type":"setTTL","ttl":3600},{"type":"maskField","field":"card","value":"xxxx"}]`)
+	assert.Nil(err)
+	assert.Equal(5, len(rules))
+	assert.Equal([]string{"customer", "ssn"}, rules[0].FieldPath())
+	assert.Equal(DefaultFieldMask, rules[0].FieldMask())
+	assert.Equal("xxxx", rules[4].FieldMask())
+
+	invalidRules := []string{"", "[]", "{}", "[null]", `[{"type":"unknown"}]`, `[{"type":"dropField"}]`,
+		`[{"type":"maskField","field":"a..b"}]`, `[{"type":"stripXattr"}]`, `[{"type":"setTTL","ttl":0}]`, `[{"type":"setTTL","ttl":-1}]`,
+		`[{"type":"keyPrefix"}]`, `[{"type":"keyRename","replace":"customer::"}]`, `[{"type":"keyRename","match":"(","replace":"x"}]`}
+	for _, invalidRule := range invalidRules {
+		_, err = ParseTransformationRules(invalidRule)
+		assert.NotNil(err, invalidRule)
+	}
+
+	fmt.Println("============== Test case end: TestParseTransformationRules =================")
+}
+
+func TestTransformKey(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestTransformKey =================")
+
+	rules, err := ParseTransformationRules(`[{"type":"keyRename","match":"^user::","replace":"customer::"},{"type":"keyPrefix","value":"dc1::"}]`)
+	assert.Nil(err)
+	assert.True(rules[0].IsKeyRule())
+	assert.True(rules[1].IsKeyRule())
+
+	testCases := []struct {
+		key      string
+		expected string
+	}{
+		{"user::1", "dc1::customer::1"},
+		{"order::user::1", "dc1::order::user::1"},
+		{"", "dc1::"},
+	}
+	for _, testCase := range testCases {
+		key := []byte(testCase.key)
+		for _, rule := range rules {
+			key = rule.TransformKey(key)
+		}
+		assert.Equal(testCase.expected, string(key), testCase.key)
+	}
+
+	// rules that do not change keys leave keys as they are
+	rules, err = ParseTransformationRules(`[{"type":"dropField","field":"notes"}]`)
+	assert.Nil(err)
+	assert.False(rules[0].IsKeyRule())
+	assert.Equal("user::1", string(rules[0].TransformKey([]byte("user::1"))))
+
+	assert.True(TransformationRulesChangeKeys(`[{"type":"dropField","field":"notes"},{"type":"keyPrefix","value":"dc1::"}]`))
+	assert.False(TransformationRulesChangeKeys(`[{"type":"dropField","field":"notes"}]`))
+	assert.False(TransformationRulesChangeKeys(""))
+	assert.False(TransformationRulesChangeKeys(`[{"type":"keyPrefix"}]`))
+
+	fmt.Println("============== Test case end: TestTransformKey =================")
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"github.com/couchbase/goxdcr/base"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// types of the replication lifecycle events that webhooks can subscribe to
+const (
+	// an error has been recorded for a replication
+	WebhookEventPipelineError = "pipelineError"
+	// pipeline updater has restarted a replication
+	WebhookEventPipelineRestart = "pipelineRestart"
+	// refresh of a remote cluster reference has started failing
+	WebhookEventRemoteClusterRefreshFailure = "remoteClusterRefreshFailure"
+	// a replication spec has been deleted because its source or target bucket is no longer valid
+	WebhookEventReplicationSpecGC = "replicationSpecGC"
+)
+
+var WebhookEventTypes = []string{
+	WebhookEventPipelineError,
+	WebhookEventPipelineRestart,
+	WebhookEventRemoteClusterRefreshFailure,
+	WebhookEventReplicationSpecGC,
+}
+
+// Webhook is an http endpoint to which notifications of the subscribed event types are posted
+type Webhook struct {
+	Id         string   `json:"id"`
+	Url        string   `json:"url"`
+	EventTypes []string `json:"eventTypes"`
+
+	// revision number to be used by metadata service. not included in json
+	Revision interface{} `json:"-"`
+}
+
+func NewWebhook(webhookUrl string, eventTypes []string) (*Webhook, error) {
+	webhook := &Webhook{Url: webhookUrl, EventTypes: eventTypes}
+	err := webhook.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.Id, err = base.GenerateRandomId(base.LengthOfRandomId, base.MaxRetryForRandomIdGeneration)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(webhook.EventTypes)
+	return webhook, nil
+}
+
+func (webhook *Webhook) Validate() error {
+	parsedUrl, err := url.Parse(webhook.Url)
+	if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") || parsedUrl.Host == "" {
+		return fmt.Errorf("Invalid webhook url %v. It needs to be an absolute http or https url", webhook.Url)
+	}
+
+	if len(webhook.EventTypes) == 0 {
+		return fmt.Errorf("No event type is specified for webhook. Valid event types are %v", WebhookEventTypes)
+	}
+	for _, eventType := range webhook.EventTypes {
+		if !base.StringListContains(WebhookEventTypes, eventType) {
+			return fmt.Errorf("Invalid event type %v. Valid event types are %v", eventType, WebhookEventTypes)
+		}
+	}
+	return nil
+}
+
+func (webhook *Webhook) IsSubscribedTo(eventType string) bool {
+	return base.StringListContains(webhook.EventTypes, eventType)
+}
+
+// WebhookEvent is the json payload posted to webhooks
+type WebhookEvent struct {
+	EventType string `json:"eventType"`
+	// replication that the event is about, if any
+	ReplicationId string `json:"replicationId,omitempty"`
+	// remote cluster reference that the event is about, if any
+	RemoteClusterName string `json:"remoteClusterName,omitempty"`
+	Message           string `json:"message"`
+	// node on which the event happened. filled in by notification service
+	Node      string    `json:"node"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func NewReplicationWebhookEvent(eventType, replicationId, message string) *WebhookEvent {
+	return &WebhookEvent{
+		EventType:     eventType,
+		ReplicationId: replicationId,
+		Message:       message,
+		Timestamp:     time.Now(),
+	}
+}
+
+func NewRemoteClusterWebhookEvent(eventType, remoteClusterName, message string) *WebhookEvent {
+	return &WebhookEvent{
+		EventType:         eventType,
+		RemoteClusterName: remoteClusterName,
+		Message:           message,
+		Timestamp:         time.Now(),
+	}
+}
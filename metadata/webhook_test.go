@@ -0,0 +1,33 @@
+// +build !pcre
+
+package metadata
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewWebhook(t *testing.T) {
+	fmt.Println("============== Test case start: TestNewWebhook =================")
+	assert := assert.New(t)
+
+	webhook, err := NewWebhook("https://example.com/hooks/xdcr", []string{WebhookEventReplicationSpecGC, WebhookEventPipelineError})
+	assert.Nil(err)
+	assert.NotEqual("", webhook.Id)
+	// event types are sorted
+	assert.Equal([]string{WebhookEventPipelineError, WebhookEventReplicationSpecGC}, webhook.EventTypes)
+	assert.True(webhook.IsSubscribedTo(WebhookEventPipelineError))
+	assert.False(webhook.IsSubscribedTo(WebhookEventPipelineRestart))
+
+	_, err = NewWebhook("ftp://example.com", []string{WebhookEventPipelineError})
+	assert.NotNil(err)
+	_, err = NewWebhook("/hooks/xdcr", []string{WebhookEventPipelineError})
+	assert.NotNil(err)
+	_, err = NewWebhook("http://example.com", []string{})
+	assert.NotNil(err)
+	_, err = NewWebhook("http://example.com", []string{WebhookEventPipelineError, "bucketDeleted"})
+	assert.NotNil(err)
+
+	fmt.Println("============== Test case end: TestNewWebhook =================")
+}
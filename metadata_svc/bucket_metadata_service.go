@@ -0,0 +1,259 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+// metadata service implementation backed by system documents in a couchbase bucket, for storing checkpoints outside of metakv
+package metadata_svc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/couchbase/go-couchbase"
+	mc "github.com/couchbase/gomemcached"
+	mcc "github.com/couchbase/gomemcached/client"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/service_def"
+	"strings"
+)
+
+// prefix of the keys of system documents written by BucketMetadataSvc
+// the key parts delimiter in metadata keys is replaced by ":", e.g., ckpt/<replicationId>/<vbno> is stored
+// as _sync:xdcr:ckpt:<targetClusterUuid>:<sourceBucket>:<targetBucket>:<vbno>.
+// when such a key would exceed the maximum key length, the middle parts of the key, i.e., replication id,
+// are replaced by their sha256 hash, e.g., _sync:xdcr:ckpt:<hash>:<vbno>
+const BucketMetadataDocKeyPrefix = "_sync:xdcr:"
+const bucketMetadataDocKeyDelimiter = ":"
+
+// maximum length of document keys in couchbase buckets
+const maxBucketMetadataDocKeyLength = 250
+
+// key value operations on the bucket that BucketMetadataSvc needs
+type bucketMetadataStore interface {
+	// returns service_def.MetadataNotFoundErr when key does not exist
+	get(key string) ([]byte, uint64, error)
+	// returns service_def.ErrorKeyAlreadyExist when key already exists
+	add(key string, value []byte) error
+	// unconditional when cas is 0. otherwise returns service_def.ErrorRevisionMismatch when cas does not match
+	set(key string, value []byte, cas uint64) error
+	// unconditional when cas is 0. otherwise returns service_def.ErrorRevisionMismatch when cas does not match
+	// returns service_def.MetadataNotFoundErr when key does not exist
+	del(key string, cas uint64) error
+	numberOfVBuckets() int
+}
+
+// BucketMetadataSvc stores each metadata entry as a system document in a couchbase bucket, with the cas of the
+// document as revision. Like metakv, Set and Del with nil revision are unconditional.
+// Since keys cannot be listed through memcached, catalogs are supported only when the entries in them are keyed by
+// vbucket number, i.e., <catalogKey>/<vbno>, which is the case for checkpoint docs. Catalogs are enumerated by reading
+// all such keys, so BucketMetadataSvc is meant for checkpoints only.
+// The bucket should not be the source bucket of any replication, or the system documents will get replicated.
+type BucketMetadataSvc struct {
+	bucketName string
+	store      bucketMetadataStore
+	logger     *log.CommonLogger
+}
+
+func NewBucketMetadataSvc(bucket *couchbase.Bucket, logger_ctx *log.LoggerContext) *BucketMetadataSvc {
+	return newBucketMetadataSvcWithStore(bucket.Name, &couchbaseBucketMetadataStore{bucket}, logger_ctx)
+}
+
+func newBucketMetadataSvcWithStore(bucketName string, store bucketMetadataStore, logger_ctx *log.LoggerContext) *BucketMetadataSvc {
+	return &BucketMetadataSvc{
+		bucketName: bucketName,
+		store:      store,
+		logger:     log.NewLogger("BucketMetadataSvc", logger_ctx),
+	}
+}
+
+func (meta_svc *BucketMetadataSvc) BucketName() string {
+	return meta_svc.bucketName
+}
+
+func (meta_svc *BucketMetadataSvc) Get(key string) ([]byte, interface{}, error) {
+	value, cas, err := meta_svc.store.get(getBucketMetadataDocKey(key))
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, cas, nil
+}
+
+func (meta_svc *BucketMetadataSvc) Add(key string, value []byte) error {
+	return meta_svc.store.add(getBucketMetadataDocKey(key), value)
+}
+
+// documents in bucket are not encrypted. sensitive values are stored the same way as others
+func (meta_svc *BucketMetadataSvc) AddSensitive(key string, value []byte) error {
+	return meta_svc.Add(key, value)
+}
+
+func (meta_svc *BucketMetadataSvc) AddWithCatalog(catalogKey, key string, value []byte) error {
+	return meta_svc.Add(key, value)
+}
+
+func (meta_svc *BucketMetadataSvc) AddSensitiveWithCatalog(catalogKey, key string, value []byte) error {
+	return meta_svc.Add(key, value)
+}
+
+func (meta_svc *BucketMetadataSvc) Set(key string, value []byte, rev interface{}) error {
+	cas, err := getCasFromRev(rev)
+	if err != nil {
+		return err
+	}
+	return meta_svc.store.set(getBucketMetadataDocKey(key), value, cas)
+}
+
+func (meta_svc *BucketMetadataSvc) SetSensitive(key string, value []byte, rev interface{}) error {
+	return meta_svc.Set(key, value, rev)
+}
+
+// deleting a key that does not exist is a no-op, as it is in metakv
+func (meta_svc *BucketMetadataSvc) Del(key string, rev interface{}) error {
+	cas, err := getCasFromRev(rev)
+	if err != nil {
+		return err
+	}
+	err = meta_svc.store.del(getBucketMetadataDocKey(key), cas)
+	if err == service_def.MetadataNotFoundErr {
+		return nil
+	}
+	return err
+}
+
+func (meta_svc *BucketMetadataSvc) DelWithCatalog(catalogKey, key string, rev interface{}) error {
+	return meta_svc.Del(key, rev)
+}
+
+func (meta_svc *BucketMetadataSvc) DelAllFromCatalog(catalogKey string) error {
+	entries, err := meta_svc.GetAllMetadataFromCatalog(catalogKey)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err = meta_svc.Del(entry.Key, nil)
+		if err != nil {
+			meta_svc.logger.Errorf("Failed to delete %v from bucket %v. err=%v\n", entry.Key, meta_svc.bucketName, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (meta_svc *BucketMetadataSvc) GetAllMetadataFromCatalog(catalogKey string) ([]*service_def.MetadataEntry, error) {
+	entries := make([]*service_def.MetadataEntry, 0)
+	for vbno := 0; vbno < meta_svc.store.numberOfVBuckets(); vbno++ {
+		key := fmt.Sprintf("%v%v%v", catalogKey, base.KeyPartsDelimiter, vbno)
+		value, rev, err := meta_svc.Get(key)
+		if err == service_def.MetadataNotFoundErr {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &service_def.MetadataEntry{Key: key, Value: value, Rev: rev})
+	}
+	return entries, nil
+}
+
+func (meta_svc *BucketMetadataSvc) GetAllKeysFromCatalog(catalogKey string) ([]string, error) {
+	entries, err := meta_svc.GetAllMetadataFromCatalog(catalogKey)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		keys[i] = entry.Key
+	}
+	return keys, nil
+}
+
+func getBucketMetadataDocKey(key string) string {
+	docKey := BucketMetadataDocKeyPrefix + strings.Replace(key, base.KeyPartsDelimiter, bucketMetadataDocKeyDelimiter, -1)
+	if len(docKey) <= maxBucketMetadataDocKeyLength {
+		return docKey
+	}
+
+	// first and last parts are kept so that the keys of the same catalog still differ by vbno
+	parts := strings.Split(key, base.KeyPartsDelimiter)
+	if len(parts) < 3 {
+		hash := sha256.Sum256([]byte(key))
+		return BucketMetadataDocKeyPrefix + hex.EncodeToString(hash[:])
+	}
+	hash := sha256.Sum256([]byte(strings.Join(parts[1:len(parts)-1], base.KeyPartsDelimiter)))
+	return BucketMetadataDocKeyPrefix + parts[0] + bucketMetadataDocKeyDelimiter + hex.EncodeToString(hash[:]) +
+		bucketMetadataDocKeyDelimiter + parts[len(parts)-1]
+}
+
+// nil revision is converted to cas of 0, which makes operations unconditional
+func getCasFromRev(rev interface{}) (uint64, error) {
+	if rev == nil {
+		return 0, nil
+	}
+	cas, ok := rev.(uint64)
+	if !ok {
+		return 0, fmt.Errorf("Revision %v is not of cas type", rev)
+	}
+	return cas, nil
+}
+
+// bucketMetadataStore on a couchbase bucket
+type couchbaseBucketMetadataStore struct {
+	bucket *couchbase.Bucket
+}
+
+func (store *couchbaseBucketMetadataStore) get(key string) ([]byte, uint64, error) {
+	value, _, cas, err := store.bucket.GetsRaw(key)
+	if couchbase.IsKeyNoEntError(err) {
+		return nil, 0, service_def.MetadataNotFoundErr
+	}
+	return value, cas, err
+}
+
+func (store *couchbaseBucketMetadataStore) add(key string, value []byte) error {
+	added, err := store.bucket.AddRaw(key, 0, value)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return service_def.ErrorKeyAlreadyExist
+	}
+	return nil
+}
+
+func (store *couchbaseBucketMetadataStore) set(key string, value []byte, cas uint64) error {
+	if cas == 0 {
+		return store.bucket.SetRaw(key, 0, value)
+	}
+	_, err := store.bucket.CasRaw(key, 0, cas, value)
+	if couchbase.IsKeyEExistsError(err) || couchbase.IsKeyNoEntError(err) {
+		return service_def.ErrorRevisionMismatch
+	}
+	return err
+}
+
+func (store *couchbaseBucketMetadataStore) del(key string, cas uint64) error {
+	err := store.bucket.Do(key, func(client *mcc.Client, vb uint16) error {
+		_, err := client.Send(&mc.MCRequest{
+			Opcode:  mc.DELETE,
+			VBucket: vb,
+			Key:     []byte(key),
+			Cas:     cas,
+		})
+		return err
+	})
+	if couchbase.IsKeyNoEntError(err) {
+		return service_def.MetadataNotFoundErr
+	} else if couchbase.IsKeyEExistsError(err) {
+		return service_def.ErrorRevisionMismatch
+	}
+	return err
+}
+
+func (store *couchbaseBucketMetadataStore) numberOfVBuckets() int {
+	return len(store.bucket.VBServerMap().VBucketMap)
+}
@@ -0,0 +1,225 @@
+// +build !pcre
+
+package metadata_svc
+
+import (
+	"fmt"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/metadata"
+	"github.com/couchbase/goxdcr/service_def"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// in memory bucketMetadataStore
+type fakeBucketMetadataStore struct {
+	values  map[string][]byte
+	cas     map[string]uint64
+	lastCas uint64
+}
+
+func newFakeBucketMetadataStore() *fakeBucketMetadataStore {
+	return &fakeBucketMetadataStore{values: make(map[string][]byte), cas: make(map[string]uint64)}
+}
+
+func (store *fakeBucketMetadataStore) get(key string) ([]byte, uint64, error) {
+	value, ok := store.values[key]
+	if !ok {
+		return nil, 0, service_def.MetadataNotFoundErr
+	}
+	return value, store.cas[key], nil
+}
+
+func (store *fakeBucketMetadataStore) add(key string, value []byte) error {
+	if _, ok := store.values[key]; ok {
+		return service_def.ErrorKeyAlreadyExist
+	}
+	return store.set(key, value, 0)
+}
+
+func (store *fakeBucketMetadataStore) set(key string, value []byte, cas uint64) error {
+	if cas != 0 && store.cas[key] != cas {
+		return service_def.ErrorRevisionMismatch
+	}
+	store.lastCas++
+	store.values[key] = value
+	store.cas[key] = store.lastCas
+	return nil
+}
+
+func (store *fakeBucketMetadataStore) del(key string, cas uint64) error {
+	if _, ok := store.values[key]; !ok {
+		return service_def.MetadataNotFoundErr
+	}
+	if cas != 0 && store.cas[key] != cas {
+		return service_def.ErrorRevisionMismatch
+	}
+	delete(store.values, key)
+	delete(store.cas, key)
+	return nil
+}
+
+func (store *fakeBucketMetadataStore) numberOfVBuckets() int {
+	return 4
+}
+
+func TestBucketMetadataSvcCheckpoints(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestBucketMetadataSvcCheckpoints =================")
+
+	store := newFakeBucketMetadataStore()
+	meta_svc := newBucketMetadataSvcWithStore("ckptBucket", store, log.DefaultLoggerContext)
+	ckpt_svc := NewCheckpointsService(meta_svc, log.DefaultLoggerContext)
+
+	assert.Nil(ckpt_svc.UpsertCheckpoints("uuid/src/tgt", "internalId", 1, &metadata.CheckpointRecord{Seqno: 100}, 0, 0))
+	assert.Nil(ckpt_svc.UpsertCheckpoints("uuid/src/tgt", "internalId", 3, &metadata.CheckpointRecord{Seqno: 300}, 0, 0))
+	assert.Nil(ckpt_svc.UpsertCheckpoints("uuid/src/tgt2", "internalId2", 0, &metadata.CheckpointRecord{Seqno: 10}, 0, 0))
+
+	// checkpoint docs are stored as system documents
+	_, ok := store.values["_sync:xdcr:ckpt:uuid:src:tgt:1"]
+	assert.True(ok)
+
+	ckpt_docs, err := ckpt_svc.CheckpointsDocs("uuid/src/tgt")
+	assert.Nil(err)
+	assert.Equal(2, len(ckpt_docs))
+	assert.Equal(uint64(300), ckpt_docs[3].Checkpoint_records[0].Seqno)
+	vbnos, err := ckpt_svc.GetVbnosFromCheckpointDocs("uuid/src/tgt")
+	assert.Nil(err)
+	assert.Equal([]uint16{1, 3}, vbnos)
+
+	// cas is used as revision
+	ckpt_doc, err := ckpt_svc.CheckpointsDoc("uuid/src/tgt", 1)
+	assert.Nil(err)
+	assert.Nil(ckpt_svc.UpsertCheckpoints("uuid/src/tgt", "internalId", 1, &metadata.CheckpointRecord{Seqno: 200}, 0, 0))
+	assert.Equal(service_def.ErrorRevisionMismatch, meta_svc.Set("ckpt/uuid/src/tgt/1", []byte("{}"), ckpt_doc.Revision))
+
+	assert.Nil(ckpt_svc.DelCheckpointsDoc("uuid/src/tgt", 1))
+	_, err = ckpt_svc.CheckpointsDoc("uuid/src/tgt", 1)
+	assert.Equal(service_def.MetadataNotFoundErr, err)
+
+	assert.Nil(ckpt_svc.DelCheckpointsDocs("uuid/src/tgt"))
+	ckpt_docs, err = ckpt_svc.CheckpointsDocs("uuid/src/tgt")
+	assert.Nil(err)
+	assert.Equal(0, len(ckpt_docs))
+	assert.Equal(1, len(store.values))
+
+	fmt.Println("============== Test case end: TestBucketMetadataSvcCheckpoints =================")
+}
+
+func TestBucketMetadataSvcLongCheckpointKeys(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestBucketMetadataSvcLongCheckpointKeys =================")
+
+	store := newFakeBucketMetadataStore()
+	meta_svc := newBucketMetadataSvcWithStore("ckptBucket", store, log.DefaultLoggerContext)
+	ckpt_svc := NewCheckpointsService(meta_svc, log.DefaultLoggerContext)
+
+	longBucketName := strings.Repeat("b", 100)
+	replId := "uuid/" + longBucketName + "/" + longBucketName
+	assert.Nil(ckpt_svc.UpsertCheckpoints(replId, "internalId", 1, &metadata.CheckpointRecord{Seqno: 100}, 0, 0))
+	assert.Nil(ckpt_svc.UpsertCheckpoints(replId, "internalId", 2, &metadata.CheckpointRecord{Seqno: 200}, 0, 0))
+
+	// replication id is hashed to keep doc keys within the key length limit of couchbase
+	for key := range store.values {
+		assert.True(len(key) <= maxBucketMetadataDocKeyLength, key)
+		assert.True(strings.HasPrefix(key, "_sync:xdcr:ckpt:"), key)
+	}
+	assert.Equal(2, len(store.values))
+
+	ckpt_docs, err := ckpt_svc.CheckpointsDocs(replId)
+	assert.Nil(err)
+	assert.Equal(2, len(ckpt_docs))
+	assert.Equal(uint64(200), ckpt_docs[2].Checkpoint_records[0].Seqno)
+
+	assert.Nil(ckpt_svc.DelCheckpointsDocs(replId))
+	assert.Equal(0, len(store.values))
+
+	fmt.Println("============== Test case end: TestBucketMetadataSvcLongCheckpointKeys =================")
+}
+
+func TestMigrateCheckpoints(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestMigrateCheckpoints =================")
+
+	dir, err := ioutil.TempDir("", "fileMetadataSvc")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	file_svc, err := NewFileMetadataSvc(dir, log.DefaultLoggerContext)
+	assert.Nil(err)
+	bucket_svc := newBucketMetadataSvcWithStore("ckptBucket", newFakeBucketMetadataStore(), log.DefaultLoggerContext)
+
+	bucketName, rev, err := GetCheckpointsBucket(file_svc)
+	assert.Nil(err)
+	assert.Equal("", bucketName)
+	assert.Nil(SetCheckpointsBucket(file_svc, "ckptBucket", rev))
+	bucketName, _, err = GetCheckpointsBucket(file_svc)
+	assert.Nil(err)
+	assert.Equal("ckptBucket", bucketName)
+
+	from_ckpt_svc := NewCheckpointsService(file_svc, log.DefaultLoggerContext)
+	to_ckpt_svc := NewCheckpointsService(bucket_svc, log.DefaultLoggerContext)
+	assert.Nil(from_ckpt_svc.UpsertCheckpoints("uuid/src/tgt", "internalId", 0, &metadata.CheckpointRecord{Seqno: 100}, 0, 0))
+	assert.Nil(from_ckpt_svc.UpsertCheckpoints("uuid/src/tgt", "internalId", 2, &metadata.CheckpointRecord{Seqno: 200}, 0, 0))
+	assert.Nil(from_ckpt_svc.UpsertCheckpoints("uuid/src/tgt", "internalId", 3, &metadata.CheckpointRecord{Seqno: 300}, 0, 0))
+	// checkpoint doc that already exists in destination is newer and is kept
+	assert.Nil(to_ckpt_svc.UpsertCheckpoints("uuid/src/tgt", "internalId", 2, &metadata.CheckpointRecord{Seqno: 250}, 0, 0))
+
+	// nothing to migrate when backend has not been changed
+	_, err = to_ckpt_svc.MigrateCheckpoints([]string{"uuid/src/tgt"})
+	assert.Equal(service_def.ErrorNoCheckpointsFallback, err)
+
+	// before migration, checkpoint docs not found in the new backend are read from the previous one
+	ckpt_svc := NewCheckpointsServiceWithFallback(bucket_svc, file_svc, log.DefaultLoggerContext)
+	ckpt_doc, err := ckpt_svc.CheckpointsDoc("uuid/src/tgt", 0)
+	assert.Nil(err)
+	assert.Equal(uint64(100), ckpt_doc.Checkpoint_records[0].Seqno)
+	assert.Nil(ckpt_doc.Revision)
+	ckpt_docs, err := ckpt_svc.CheckpointsDocs("uuid/src/tgt")
+	assert.Nil(err)
+	assert.Equal(3, len(ckpt_docs))
+	assert.Equal(uint64(100), ckpt_docs[0].Checkpoint_records[0].Seqno)
+	assert.Equal(uint64(250), ckpt_docs[2].Checkpoint_records[0].Seqno)
+	vbnos, err := ckpt_svc.GetVbnosFromCheckpointDocs("uuid/src/tgt")
+	assert.Nil(err)
+	assert.Equal(3, len(vbnos))
+
+	// checkpoint doc removed through the new backend is removed from the previous one too
+	assert.Nil(ckpt_svc.DelCheckpointsDoc("uuid/src/tgt", 3))
+	_, err = ckpt_svc.CheckpointsDoc("uuid/src/tgt", 3)
+	assert.Equal(service_def.MetadataNotFoundErr, err)
+	assert.Equal(service_def.MetadataNotFoundErr, ckpt_svc.DelCheckpointsDoc("uuid/src/tgt", 3))
+
+	migrated, err := ckpt_svc.MigrateCheckpoints([]string{"uuid/src/tgt", "uuid/src/tgt2"})
+	assert.Nil(err)
+	assert.Equal(1, migrated)
+
+	// checkpoint docs are kept in the previous backend for nodes that have not switched yet
+	ckpt_docs, err = from_ckpt_svc.CheckpointsDocs("uuid/src/tgt")
+	assert.Nil(err)
+	assert.Equal(2, len(ckpt_docs))
+	ckpt_docs, err = to_ckpt_svc.CheckpointsDocs("uuid/src/tgt")
+	assert.Nil(err)
+	assert.Equal(2, len(ckpt_docs))
+	assert.Equal(uint64(100), ckpt_docs[0].Checkpoint_records[0].Seqno)
+	assert.Equal(uint64(250), ckpt_docs[2].Checkpoint_records[0].Seqno)
+
+	// migration can be re-run
+	migrated, err = ckpt_svc.MigrateCheckpoints([]string{"uuid/src/tgt"})
+	assert.Nil(err)
+	assert.Equal(0, migrated)
+
+	removed, err := ckpt_svc.RemoveFallbackCheckpoints([]string{"uuid/src/tgt"})
+	assert.Nil(err)
+	assert.Equal(2, removed)
+	ckpt_docs, err = from_ckpt_svc.CheckpointsDocs("uuid/src/tgt")
+	assert.Nil(err)
+	assert.Equal(0, len(ckpt_docs))
+	ckpt_docs, err = ckpt_svc.CheckpointsDocs("uuid/src/tgt")
+	assert.Nil(err)
+	assert.Equal(2, len(ckpt_docs))
+
+	fmt.Println("============== Test case end: TestMigrateCheckpoints =================")
+}
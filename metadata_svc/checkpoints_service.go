@@ -20,17 +20,30 @@ const (
 
 type CheckpointsService struct {
 	metadata_svc service_def.MetadataSvc
-	logger       *log.CommonLogger
+	// where checkpoint docs were stored before checkpoints backend was changed. nil when backend has not been changed
+	// checkpoint docs that are not found in metadata_svc are read from it until they are migrated
+	fallback_metadata_svc service_def.MetadataSvc
+	logger                *log.CommonLogger
 }
 
 func NewCheckpointsService(metadata_svc service_def.MetadataSvc, logger_ctx *log.LoggerContext) service_def.CheckpointsService {
+	return NewCheckpointsServiceWithFallback(metadata_svc, nil, logger_ctx)
+}
+
+func NewCheckpointsServiceWithFallback(metadata_svc, fallback_metadata_svc service_def.MetadataSvc, logger_ctx *log.LoggerContext) service_def.CheckpointsService {
 	return &CheckpointsService{metadata_svc: metadata_svc,
-		logger: log.NewLogger("CheckpointSvc", logger_ctx)}
+		fallback_metadata_svc: fallback_metadata_svc,
+		logger:                log.NewLogger("CheckpointSvc", logger_ctx)}
 }
 
 func (ckpt_svc *CheckpointsService) CheckpointsDoc(replicationId string, vbno uint16) (*metadata.CheckpointsDoc, error) {
 	key := ckpt_svc.getCheckpointDocKey(replicationId, vbno)
 	result, rev, err := ckpt_svc.metadata_svc.Get(key)
+	if err == service_def.MetadataNotFoundErr && ckpt_svc.fallback_metadata_svc != nil {
+		result, _, err = ckpt_svc.fallback_metadata_svc.Get(key)
+		// checkpoint doc read from fallback is always written to metadata_svc, where it does not exist yet
+		rev = nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -65,6 +78,9 @@ func (ckpt_svc *CheckpointsService) DelCheckpointsDocs(replicationId string) err
 	ckpt_svc.logger.Infof("DelCheckpointsDocs for replication %v...", replicationId)
 	catalogKey := ckpt_svc.getCheckpointCatalogKey(replicationId)
 	err_ret := ckpt_svc.metadata_svc.DelAllFromCatalog(catalogKey)
+	if err_ret == nil && ckpt_svc.fallback_metadata_svc != nil {
+		err_ret = ckpt_svc.fallback_metadata_svc.DelAllFromCatalog(catalogKey)
+	}
 	if err_ret != nil {
 		ckpt_svc.logger.Errorf("Failed to delete checkpoints docs for %v\n", replicationId)
 	} else {
@@ -76,12 +92,15 @@ func (ckpt_svc *CheckpointsService) DelCheckpointsDocs(replicationId string) err
 func (ckpt_svc *CheckpointsService) DelCheckpointsDoc(replicationId string, vbno uint16) error {
 	ckpt_svc.logger.Debugf("DelCheckpointsDoc for replication %v and vbno %v...", replicationId, vbno)
 	key := ckpt_svc.getCheckpointDocKey(replicationId, vbno)
-	_, rev, err := ckpt_svc.metadata_svc.Get(key)
-	if err != nil {
-		return err
-	}
 	catalogKey := ckpt_svc.getCheckpointCatalogKey(replicationId)
-	err = ckpt_svc.metadata_svc.DelWithCatalog(catalogKey, key, rev)
+	err := delCheckpointsDoc(ckpt_svc.metadata_svc, catalogKey, key)
+	if ckpt_svc.fallback_metadata_svc != nil && (err == nil || err == service_def.MetadataNotFoundErr) {
+		// the checkpoint doc in fallback would otherwise be read again
+		fallbackErr := delCheckpointsDoc(ckpt_svc.fallback_metadata_svc, catalogKey, key)
+		if err == service_def.MetadataNotFoundErr || fallbackErr != service_def.MetadataNotFoundErr {
+			err = fallbackErr
+		}
+	}
 	if err != nil {
 		ckpt_svc.logger.Errorf("Failed to delete checkpoints doc for replication %v and vbno %v\n", replicationId, vbno)
 	} else {
@@ -90,6 +109,14 @@ func (ckpt_svc *CheckpointsService) DelCheckpointsDoc(replicationId string, vbno
 	return err
 }
 
+func delCheckpointsDoc(metadata_svc service_def.MetadataSvc, catalogKey, key string) error {
+	_, rev, err := metadata_svc.Get(key)
+	if err != nil {
+		return err
+	}
+	return metadata_svc.DelWithCatalog(catalogKey, key, rev)
+}
+
 // in addition to upserting checkpoint record, this method may also update xattr seqno
 // and target cluster version in checkpoint doc
 // these operations are done in the same metakv operation to ensure that they succeed and fail together
@@ -147,7 +174,7 @@ func (ckpt_svc *CheckpointsService) UpsertCheckpoints(replicationId string, spec
 func (ckpt_svc *CheckpointsService) CheckpointsDocs(replicationId string) (map[uint16]*metadata.CheckpointsDoc, error) {
 	checkpointsDocs := make(map[uint16]*metadata.CheckpointsDoc)
 	catalogKey := ckpt_svc.getCheckpointCatalogKey(replicationId)
-	ckpt_entries, err := ckpt_svc.metadata_svc.GetAllMetadataFromCatalog(catalogKey)
+	ckpt_entries, err := ckpt_svc.getAllCheckpointEntries(catalogKey)
 	if err != nil {
 		return nil, err
 	}
@@ -176,6 +203,30 @@ func (ckpt_svc *CheckpointsService) CheckpointsDocs(replicationId string) (map[u
 	return checkpointsDocs, nil
 }
 
+// returns the checkpoint entries in both metadata_svc and fallback. entries in fallback come before those in metadata_svc,
+// so that checkpoint docs in metadata_svc replace the older copies in fallback when entries are processed in order
+func (ckpt_svc *CheckpointsService) getAllCheckpointEntries(catalogKey string) ([]*service_def.MetadataEntry, error) {
+	var ckpt_entries []*service_def.MetadataEntry
+	if ckpt_svc.fallback_metadata_svc != nil {
+		fallback_entries, err := ckpt_svc.fallback_metadata_svc.GetAllMetadataFromCatalog(catalogKey)
+		if err != nil {
+			return nil, err
+		}
+		for _, ckpt_entry := range fallback_entries {
+			if ckpt_entry != nil {
+				// checkpoint doc read from fallback is always written to metadata_svc, where it does not exist yet
+				ckpt_entries = append(ckpt_entries, &service_def.MetadataEntry{Key: ckpt_entry.Key, Value: ckpt_entry.Value})
+			}
+		}
+	}
+
+	entries, err := ckpt_svc.metadata_svc.GetAllMetadataFromCatalog(catalogKey)
+	if err != nil {
+		return nil, err
+	}
+	return append(ckpt_entries, entries...), nil
+}
+
 func (ckpt_svc *CheckpointsService) constructCheckpointDoc(content []byte, rev interface{}) (*metadata.CheckpointsDoc, error) {
 	// The only time content is empty is when this is a fresh XDCR system and no checkpoints has been registered yet
 	if len(content) > 0 {
@@ -196,19 +247,177 @@ func (ckpt_svc *CheckpointsService) constructCheckpointDoc(content []byte, rev i
 func (ckpt_svc *CheckpointsService) GetVbnosFromCheckpointDocs(replicationId string) ([]uint16, error) {
 	vbnos := make([]uint16, 0)
 	catalogKey := ckpt_svc.getCheckpointCatalogKey(replicationId)
-	ckpt_entries, err := ckpt_svc.metadata_svc.GetAllMetadataFromCatalog(catalogKey)
+	ckpt_entries, err := ckpt_svc.getAllCheckpointEntries(catalogKey)
 	if err != nil {
 		return nil, err
 	}
 
+	vbnoMap := make(map[uint16]bool)
 	for _, ckpt_entry := range ckpt_entries {
 		if ckpt_entry != nil {
 			vbno, err := ckpt_svc.decodeVbnoFromCkptDocKey(ckpt_entry.Key)
 			if err != nil {
 				return nil, err
 			}
-			vbnos = append(vbnos, vbno)
+			if !vbnoMap[vbno] {
+				vbnoMap[vbno] = true
+				vbnos = append(vbnos, vbno)
+			}
 		}
 	}
 	return vbnos, nil
 }
+
+func (ckpt_svc *CheckpointsService) RewindCheckpointsDoc(replicationId string, vbno uint16, seqno uint64) (uint64, error) {
+	ckpt_svc.logger.Infof("RewindCheckpointsDoc for replication %v and vbno %v to seqno %v...", replicationId, vbno, seqno)
+
+	if seqno > 0 {
+		ckpt_doc, err := ckpt_svc.CheckpointsDoc(replicationId, vbno)
+		if err == service_def.MetadataNotFoundErr {
+			// no checkpoints to rewind. replication will start from 0
+			return 0, nil
+		} else if err != nil {
+			return 0, err
+		}
+
+		resumeSeqno := ckpt_doc.Rewind(seqno)
+		if resumeSeqno > 0 {
+			ckpt_json, err := json.Marshal(ckpt_doc)
+			if err != nil {
+				return 0, err
+			}
+			key := ckpt_svc.getCheckpointDocKey(replicationId, vbno)
+			err = ckpt_svc.metadata_svc.Set(key, ckpt_json, ckpt_doc.Revision)
+			if err != nil {
+				ckpt_svc.logger.Errorf("Failed to set checkpoint doc key=%v, err=%v\n", key, err)
+				return 0, err
+			}
+			return resumeSeqno, nil
+		}
+	}
+
+	// no checkpoint records at or before seqno. remove checkpoint doc so that replication starts from 0
+	err := ckpt_svc.DelCheckpointsDoc(replicationId, vbno)
+	if err == service_def.MetadataNotFoundErr {
+		err = nil
+	}
+	return 0, err
+}
+
+// VerifyCheckpointsDoc verifies the checkpoint records of vbno against the current failover log of the source vbucket
+// and the current opaque of the target vbucket, and removes records that can no longer be used to resume replication
+// returns the number of records removed
+func (ckpt_svc *CheckpointsService) VerifyCheckpointsDoc(replicationId string, vbno uint16, failoverLog [][2]uint64,
+	targetVBOpaque metadata.TargetVBOpaque) (int, error) {
+	ckpt_doc, err := ckpt_svc.CheckpointsDoc(replicationId, vbno)
+	if err == service_def.MetadataNotFoundErr {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	removed := ckpt_doc.Compact(func(ckpt_record *metadata.CheckpointRecord) bool {
+		usable := ckpt_record.IsUsable(failoverLog, targetVBOpaque)
+		if !usable {
+			ckpt_svc.logger.Infof("Removing unusable checkpoint record %v for replication %v and vbno %v", ckpt_record, replicationId, vbno)
+		}
+		return usable
+	})
+	if removed == 0 {
+		return 0, nil
+	}
+
+	ckpt_json, err := json.Marshal(ckpt_doc)
+	if err != nil {
+		return 0, err
+	}
+	// update with revision so as not to overwrite checkpoint records that were added concurrently
+	key := ckpt_svc.getCheckpointDocKey(replicationId, vbno)
+	err = ckpt_svc.metadata_svc.Set(key, ckpt_json, ckpt_doc.Revision)
+	if err == service_def.ErrorRevisionMismatch {
+		ckpt_svc.logger.Infof("Checkpoint doc for replication %v and vbno %v has been changed during verification. It will be verified again later", replicationId, vbno)
+		return 0, nil
+	} else if err != nil {
+		ckpt_svc.logger.Errorf("Failed to set checkpoint doc key=%v, err=%v\n", key, err)
+		return 0, err
+	}
+	return removed, nil
+}
+
+// key of the metakv entry that records the bucket that has last been configured for storing checkpoint docs
+// nodes that store checkpoint docs in metakv read checkpoint docs from this bucket when they are not found in metakv
+const CheckpointsBucketKey = "checkpointsBucket"
+
+// returns the bucket that has last been configured for storing checkpoint docs, or empty string when no bucket has been configured
+func GetCheckpointsBucket(metadata_svc service_def.MetadataSvc) (string, interface{}, error) {
+	value, rev, err := metadata_svc.Get(CheckpointsBucketKey)
+	if err == service_def.MetadataNotFoundErr {
+		return "", nil, nil
+	} else if err != nil {
+		return "", nil, err
+	}
+	return string(value), rev, nil
+}
+
+func SetCheckpointsBucket(metadata_svc service_def.MetadataSvc, bucketName string, rev interface{}) error {
+	return metadata_svc.Set(CheckpointsBucketKey, []byte(bucketName), rev)
+}
+
+// MigrateCheckpoints copies checkpoint docs of the specified replications from fallback to metadata_svc
+// checkpoint docs that already exist in metadata_svc are newer, and are kept
+// checkpoint docs are not removed from fallback, where nodes that have not switched to the new backend still read them
+// returns the number of checkpoint docs copied
+func (ckpt_svc *CheckpointsService) MigrateCheckpoints(replicationIds []string) (int, error) {
+	if ckpt_svc.fallback_metadata_svc == nil {
+		return 0, service_def.ErrorNoCheckpointsFallback
+	}
+
+	total := 0
+	for _, replicationId := range replicationIds {
+		catalogKey := ckpt_svc.getCheckpointCatalogKey(replicationId)
+		ckpt_entries, err := ckpt_svc.fallback_metadata_svc.GetAllMetadataFromCatalog(catalogKey)
+		if err != nil {
+			return total, err
+		}
+
+		migrated := 0
+		for _, ckpt_entry := range ckpt_entries {
+			err = ckpt_svc.metadata_svc.AddWithCatalog(catalogKey, ckpt_entry.Key, ckpt_entry.Value)
+			if err == service_def.ErrorKeyAlreadyExist {
+				continue
+			} else if err != nil {
+				ckpt_svc.logger.Errorf("Failed to migrate checkpoint doc %v. err=%v\n", ckpt_entry.Key, err)
+				return total, err
+			}
+			migrated++
+		}
+		total += migrated
+		ckpt_svc.logger.Infof("Migrated %v of %v checkpoint docs for replication %v\n", migrated, len(ckpt_entries), replicationId)
+	}
+	return total, nil
+}
+
+// RemoveFallbackCheckpoints removes checkpoint docs of the specified replications from fallback
+// it is to be called only after checkpoints have been migrated and all nodes have switched to the new backend
+// returns the number of checkpoint docs removed
+func (ckpt_svc *CheckpointsService) RemoveFallbackCheckpoints(replicationIds []string) (int, error) {
+	if ckpt_svc.fallback_metadata_svc == nil {
+		return 0, service_def.ErrorNoCheckpointsFallback
+	}
+
+	total := 0
+	for _, replicationId := range replicationIds {
+		catalogKey := ckpt_svc.getCheckpointCatalogKey(replicationId)
+		ckpt_entries, err := ckpt_svc.fallback_metadata_svc.GetAllMetadataFromCatalog(catalogKey)
+		if err != nil {
+			return total, err
+		}
+		err = ckpt_svc.fallback_metadata_svc.DelAllFromCatalog(catalogKey)
+		if err != nil {
+			return total, err
+		}
+		total += len(ckpt_entries)
+		ckpt_svc.logger.Infof("Removed %v checkpoint docs for replication %v from previous checkpoints backend\n", len(ckpt_entries), replicationId)
+	}
+	return total, nil
+}
@@ -0,0 +1,420 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+// metadata service implementation backed by a local directory, for running xdcr without metakv
+package metadata_svc
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/service_def"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// metadata files can be read only by the owner since they may contain sensitive values
+	fileMetadataDirPerm   = 0700
+	fileMetadataFilePerm  = 0600
+	fileMetadataTmpSuffix = ".tmp"
+)
+
+// metadata entry persisted in the file of its key
+type fileMetadataEntry struct {
+	Value     []byte `json:"value"`
+	Rev       uint64 `json:"rev"`
+	Sensitive bool   `json:"sensitive,omitempty"`
+}
+
+// FileMetadataSvc stores each metadata entry in a separate file under a local directory.
+// All entries are cached in memory, which serves all reads. Files are written only when entries are changed.
+// Revisions are unique across all entries, and are derived from the time of writes so that they remain unique
+// after restarts. Like metakv, Set and Del with nil revision are unconditional.
+type FileMetadataSvc struct {
+	dir     string
+	entries map[string]*fileMetadataEntry
+	lastRev uint64
+	// observers of metadata changes
+	observers map[*fileMetadataObserver]bool
+	lock      sync.RWMutex
+	logger    *log.CommonLogger
+}
+
+func NewFileMetadataSvc(dir string, logger_ctx *log.LoggerContext) (*FileMetadataSvc, error) {
+	meta_svc := &FileMetadataSvc{
+		dir:       dir,
+		entries:   make(map[string]*fileMetadataEntry),
+		observers: make(map[*fileMetadataObserver]bool),
+		logger:    log.NewLogger("FileMetadataSvc", logger_ctx),
+	}
+
+	err := os.MkdirAll(dir, fileMetadataDirPerm)
+	if err != nil {
+		return nil, err
+	}
+	err = meta_svc.load()
+	if err != nil {
+		return nil, err
+	}
+	meta_svc.logger.Infof("Loaded %v metadata entries from %v\n", len(meta_svc.entries), dir)
+	return meta_svc, nil
+}
+
+// loads all entries in dir into memory
+func (meta_svc *FileMetadataSvc) load() error {
+	fileInfos, err := ioutil.ReadDir(meta_svc.dir)
+	if err != nil {
+		return err
+	}
+	for _, fileInfo := range fileInfos {
+		if fileInfo.IsDir() {
+			continue
+		}
+		fileName := fileInfo.Name()
+		if strings.HasSuffix(fileName, fileMetadataTmpSuffix) {
+			// left over by a write that did not complete
+			os.Remove(filepath.Join(meta_svc.dir, fileName))
+			continue
+		}
+		key, err := url.PathUnescape(fileName)
+		if err != nil {
+			meta_svc.logger.Warnf("Skipping file %v since it is not a metadata file\n", fileName)
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(meta_svc.dir, fileName))
+		if err != nil {
+			return err
+		}
+		entry := &fileMetadataEntry{}
+		err = json.Unmarshal(data, entry)
+		if err != nil {
+			return fmt.Errorf("Metadata file %v is corrupted. err=%v", fileName, err)
+		}
+		meta_svc.entries[key] = entry
+		if entry.Rev > meta_svc.lastRev {
+			meta_svc.lastRev = entry.Rev
+		}
+	}
+	return nil
+}
+
+func (meta_svc *FileMetadataSvc) Get(key string) ([]byte, interface{}, error) {
+	meta_svc.lock.RLock()
+	defer meta_svc.lock.RUnlock()
+
+	entry, ok := meta_svc.entries[key]
+	if !ok {
+		meta_svc.logger.Debugf("Can't find key=%v", key)
+		return nil, nil, service_def.MetadataNotFoundErr
+	}
+	return base.DeepCopyByteArray(entry.Value), entry.Rev, nil
+}
+
+func (meta_svc *FileMetadataSvc) Add(key string, value []byte) error {
+	return meta_svc.add(key, value, false)
+}
+
+func (meta_svc *FileMetadataSvc) AddSensitive(key string, value []byte) error {
+	return meta_svc.add(key, value, true)
+}
+
+// if the key already exists, return service_def.ErrorKeyAlreadyExist
+func (meta_svc *FileMetadataSvc) add(key string, value []byte, sensitive bool) error {
+	meta_svc.lock.Lock()
+	defer meta_svc.lock.Unlock()
+
+	if _, ok := meta_svc.entries[key]; ok {
+		return service_def.ErrorKeyAlreadyExist
+	}
+	return meta_svc.write(key, value, sensitive)
+}
+
+func (meta_svc *FileMetadataSvc) AddWithCatalog(catalogKey, key string, value []byte) error {
+	// ignore catalogKey, which is always a prefix of key
+	return meta_svc.Add(key, value)
+}
+
+func (meta_svc *FileMetadataSvc) AddSensitiveWithCatalog(catalogKey, key string, value []byte) error {
+	// ignore catalogKey, which is always a prefix of key
+	return meta_svc.AddSensitive(key, value)
+}
+
+func (meta_svc *FileMetadataSvc) Set(key string, value []byte, rev interface{}) error {
+	return meta_svc.set(key, value, rev, false)
+}
+
+func (meta_svc *FileMetadataSvc) SetSensitive(key string, value []byte, rev interface{}) error {
+	return meta_svc.set(key, value, rev, true)
+}
+
+// if the rev provided doesn't match with the rev of the existing entry, return service_def.ErrorRevisionMismatch
+func (meta_svc *FileMetadataSvc) set(key string, value []byte, rev interface{}, sensitive bool) error {
+	meta_svc.lock.Lock()
+	defer meta_svc.lock.Unlock()
+
+	if !meta_svc.revMatches(key, rev) {
+		return service_def.ErrorRevisionMismatch
+	}
+	return meta_svc.write(key, value, sensitive)
+}
+
+// if the rev provided doesn't match with the rev of the existing entry, return service_def.ErrorRevisionMismatch
+// deleting a key that does not exist is a no-op
+func (meta_svc *FileMetadataSvc) Del(key string, rev interface{}) error {
+	meta_svc.lock.Lock()
+	defer meta_svc.lock.Unlock()
+
+	if _, ok := meta_svc.entries[key]; !ok {
+		return nil
+	}
+	if !meta_svc.revMatches(key, rev) {
+		return service_def.ErrorRevisionMismatch
+	}
+	return meta_svc.delete(key)
+}
+
+func (meta_svc *FileMetadataSvc) DelWithCatalog(catalogKey, key string, rev interface{}) error {
+	// ignore catalogKey, which is always a prefix of key
+	return meta_svc.Del(key, rev)
+}
+
+func (meta_svc *FileMetadataSvc) DelAllFromCatalog(catalogKey string) error {
+	meta_svc.lock.Lock()
+	defer meta_svc.lock.Unlock()
+
+	for _, key := range meta_svc.getKeysFromCatalog(catalogKey) {
+		err := meta_svc.delete(key)
+		if err != nil {
+			meta_svc.logger.Warnf("Failed to delete key=%v in catalog %v. err=%v\n", key, catalogKey, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (meta_svc *FileMetadataSvc) GetAllMetadataFromCatalog(catalogKey string) ([]*service_def.MetadataEntry, error) {
+	meta_svc.lock.RLock()
+	defer meta_svc.lock.RUnlock()
+
+	keys := meta_svc.getKeysFromCatalog(catalogKey)
+	entries := make([]*service_def.MetadataEntry, 0, len(keys))
+	for _, key := range keys {
+		entry := meta_svc.entries[key]
+		entries = append(entries, &service_def.MetadataEntry{key, base.DeepCopyByteArray(entry.Value), entry.Rev})
+	}
+	return entries, nil
+}
+
+func (meta_svc *FileMetadataSvc) GetAllKeysFromCatalog(catalogKey string) ([]string, error) {
+	meta_svc.lock.RLock()
+	defer meta_svc.lock.RUnlock()
+
+	return meta_svc.getKeysFromCatalog(catalogKey), nil
+}
+
+// ObserveChildren implements service_def.MetadataChangeObserver
+// it blocks until cancel is closed, in which case it returns nil, or until callback returns error
+func (meta_svc *FileMetadataSvc) ObserveChildren(dirpath string, callback base.MetadataServiceCallback, cancel <-chan struct{}) error {
+	observer := newFileMetadataObserver(dirpath)
+
+	// existing entries and the observer need to be set up under the same lock so that no change is missed
+	meta_svc.lock.Lock()
+	for _, key := range meta_svc.getSortedKeys() {
+		if observer.matches(key) {
+			entry := meta_svc.entries[key]
+			observer.enqueue(&fileMetadataChange{getPathFromKey(key), base.DeepCopyByteArray(entry.Value), entry.Rev})
+		}
+	}
+	meta_svc.observers[observer] = true
+	meta_svc.lock.Unlock()
+
+	defer func() {
+		meta_svc.lock.Lock()
+		delete(meta_svc.observers, observer)
+		meta_svc.lock.Unlock()
+	}()
+
+	for {
+		for _, change := range observer.dequeueAll() {
+			err := callback(change.path, change.value, change.rev)
+			if err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-cancel:
+			return nil
+		case <-observer.notifyCh:
+		}
+	}
+}
+
+// caller needs to hold write lock
+func (meta_svc *FileMetadataSvc) revMatches(key string, rev interface{}) bool {
+	if rev == nil {
+		return true
+	}
+	entry, ok := meta_svc.entries[key]
+	if !ok {
+		return false
+	}
+	revNum, ok := rev.(uint64)
+	return ok && revNum == entry.Rev
+}
+
+// revisions increase with the time of writes
+// caller needs to hold write lock
+func (meta_svc *FileMetadataSvc) nextRev() uint64 {
+	rev := uint64(time.Now().UnixNano())
+	if rev <= meta_svc.lastRev {
+		rev = meta_svc.lastRev + 1
+	}
+	meta_svc.lastRev = rev
+	return rev
+}
+
+// writes entry to a temp file and then renames the temp file, so that the file of the key is never partially written
+// caller needs to hold write lock
+func (meta_svc *FileMetadataSvc) write(key string, value []byte, sensitive bool) error {
+	entry := &fileMetadataEntry{
+		Value:     base.DeepCopyByteArray(value),
+		Rev:       meta_svc.nextRev(),
+		Sensitive: sensitive,
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	filePath := meta_svc.getFilePathFromKey(key)
+	tmpFilePath := filePath + fileMetadataTmpSuffix
+	err = ioutil.WriteFile(tmpFilePath, data, fileMetadataFilePerm)
+	if err == nil {
+		err = os.Rename(tmpFilePath, filePath)
+	}
+	if err != nil {
+		os.Remove(tmpFilePath)
+		valueToPrint := value
+		if sensitive {
+			valueToPrint = base.TagUDBytes(base.DeepCopyByteArray(value))
+		}
+		meta_svc.logger.Warnf("Failed to write metadata file. key=%v, value=%v, err=%v\n", key, valueToPrint, err)
+		return err
+	}
+
+	meta_svc.entries[key] = entry
+	meta_svc.notifyObservers(key, entry.Value, entry.Rev)
+	return nil
+}
+
+// caller needs to hold write lock
+func (meta_svc *FileMetadataSvc) delete(key string) error {
+	err := os.Remove(meta_svc.getFilePathFromKey(key))
+	if err != nil && !os.IsNotExist(err) {
+		meta_svc.logger.Warnf("Failed to delete metadata file. key=%v, err=%v\n", key, err)
+		return err
+	}
+
+	delete(meta_svc.entries, key)
+	meta_svc.notifyObservers(key, nil, nil)
+	return nil
+}
+
+// caller needs to hold write lock
+func (meta_svc *FileMetadataSvc) notifyObservers(key string, value []byte, rev interface{}) {
+	for observer, _ := range meta_svc.observers {
+		if observer.matches(key) {
+			observer.enqueue(&fileMetadataChange{getPathFromKey(key), base.DeepCopyByteArray(value), rev})
+		}
+	}
+}
+
+// keys are escaped so that hierarchical keys map to files directly under dir
+func (meta_svc *FileMetadataSvc) getFilePathFromKey(key string) string {
+	return filepath.Join(meta_svc.dir, url.PathEscape(key))
+}
+
+// caller needs to hold lock
+func (meta_svc *FileMetadataSvc) getKeysFromCatalog(catalogKey string) []string {
+	prefix := catalogKey + base.KeyPartsDelimiter
+	keys := make([]string, 0)
+	for key, _ := range meta_svc.entries {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// caller needs to hold lock
+func (meta_svc *FileMetadataSvc) getSortedKeys() []string {
+	keys := make([]string, 0, len(meta_svc.entries))
+	for key, _ := range meta_svc.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type fileMetadataChange struct {
+	path  string
+	value []byte
+	rev   interface{}
+}
+
+// observer of the changes under a dir path
+// changes are queued so that writers are never blocked by slow callbacks
+type fileMetadataObserver struct {
+	dirpath  string
+	changes  []*fileMetadataChange
+	notifyCh chan bool
+	lock     sync.Mutex
+}
+
+func newFileMetadataObserver(dirpath string) *fileMetadataObserver {
+	return &fileMetadataObserver{
+		dirpath:  dirpath,
+		changes:  make([]*fileMetadataChange, 0),
+		notifyCh: make(chan bool, 1),
+	}
+}
+
+func (observer *fileMetadataObserver) matches(key string) bool {
+	return strings.HasPrefix(getPathFromKey(key), observer.dirpath)
+}
+
+func (observer *fileMetadataObserver) enqueue(change *fileMetadataChange) {
+	observer.lock.Lock()
+	observer.changes = append(observer.changes, change)
+	observer.lock.Unlock()
+
+	select {
+	case observer.notifyCh <- true:
+	default:
+		// observer has already been notified
+	}
+}
+
+func (observer *fileMetadataObserver) dequeueAll() []*fileMetadataChange {
+	observer.lock.Lock()
+	defer observer.lock.Unlock()
+	changes := observer.changes
+	observer.changes = make([]*fileMetadataChange, 0)
+	return changes
+}
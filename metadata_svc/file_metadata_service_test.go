@@ -0,0 +1,186 @@
+// +build !pcre
+
+package metadata_svc
+
+import (
+	"fmt"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/service_def"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFileMetadataSvcRevisions(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestFileMetadataSvcRevisions =================")
+
+	dir, err := ioutil.TempDir("", "fileMetadataSvc")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	meta_svc, err := NewFileMetadataSvc(dir, log.DefaultLoggerContext)
+	assert.Nil(err)
+
+	_, _, err = meta_svc.Get("remoteCluster/ref1")
+	assert.Equal(service_def.MetadataNotFoundErr, err)
+
+	assert.Nil(meta_svc.AddWithCatalog("remoteCluster", "remoteCluster/ref1", []byte("value1")))
+	assert.Equal(service_def.ErrorKeyAlreadyExist, meta_svc.Add("remoteCluster/ref1", []byte("value2")))
+
+	value, rev, err := meta_svc.Get("remoteCluster/ref1")
+	assert.Nil(err)
+	assert.Equal([]byte("value1"), value)
+
+	// set with the current revision succeeds and changes revision
+	assert.Nil(meta_svc.Set("remoteCluster/ref1", []byte("value2"), rev))
+	value, newRev, err := meta_svc.Get("remoteCluster/ref1")
+	assert.Nil(err)
+	assert.Equal([]byte("value2"), value)
+	assert.NotEqual(rev, newRev)
+
+	// set and del with stale revision fail
+	assert.Equal(service_def.ErrorRevisionMismatch, meta_svc.Set("remoteCluster/ref1", []byte("value3"), rev))
+	assert.Equal(service_def.ErrorRevisionMismatch, meta_svc.Del("remoteCluster/ref1", rev))
+	// set on a key that does not exist fails unless revision is nil
+	assert.Equal(service_def.ErrorRevisionMismatch, meta_svc.Set("remoteCluster/ref2", []byte("value"), newRev))
+	assert.Nil(meta_svc.SetSensitive("remoteCluster/ref2", []byte("secret"), nil))
+
+	// files are readable only by owner
+	fileInfo, err := os.Stat(meta_svc.getFilePathFromKey("remoteCluster/ref2"))
+	assert.Nil(err)
+	assert.Equal(os.FileMode(fileMetadataFilePerm), fileInfo.Mode().Perm())
+
+	// entries and revisions survive restarts
+	meta_svc, err = NewFileMetadataSvc(dir, log.DefaultLoggerContext)
+	assert.Nil(err)
+	value, rev, err = meta_svc.Get("remoteCluster/ref1")
+	assert.Nil(err)
+	assert.Equal([]byte("value2"), value)
+	assert.Equal(newRev, rev)
+	value, _, err = meta_svc.Get("remoteCluster/ref2")
+	assert.Nil(err)
+	assert.Equal([]byte("secret"), value)
+
+	assert.Nil(meta_svc.DelWithCatalog("remoteCluster", "remoteCluster/ref1", rev))
+	_, _, err = meta_svc.Get("remoteCluster/ref1")
+	assert.Equal(service_def.MetadataNotFoundErr, err)
+	// deleting a key that does not exist is a no-op
+	assert.Nil(meta_svc.Del("remoteCluster/ref1", rev))
+
+	fmt.Println("============== Test case end: TestFileMetadataSvcRevisions =================")
+}
+
+func TestFileMetadataSvcCatalogs(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestFileMetadataSvcCatalogs =================")
+
+	dir, err := ioutil.TempDir("", "fileMetadataSvc")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	meta_svc, err := NewFileMetadataSvc(dir, log.DefaultLoggerContext)
+	assert.Nil(err)
+
+	// keys may contain the key parts delimiter
+	assert.Nil(meta_svc.Add("ckpt/uuid/src/tgt/1", []byte("1")))
+	assert.Nil(meta_svc.Add("ckpt/uuid/src/tgt/0", []byte("0")))
+	assert.Nil(meta_svc.Add("ckpt/uuid/src/tgt2/0", []byte("0")))
+	assert.Nil(meta_svc.Add("replicationSpec/uuid/src/tgt", []byte("spec")))
+
+	keys, err := meta_svc.GetAllKeysFromCatalog("ckpt/uuid/src/tgt")
+	assert.Nil(err)
+	assert.Equal([]string{"ckpt/uuid/src/tgt/0", "ckpt/uuid/src/tgt/1"}, keys)
+
+	entries, err := meta_svc.GetAllMetadataFromCatalog("ckpt")
+	assert.Nil(err)
+	assert.Equal(3, len(entries))
+
+	assert.Nil(meta_svc.DelAllFromCatalog("ckpt/uuid/src/tgt"))
+	keys, err = meta_svc.GetAllKeysFromCatalog("ckpt")
+	assert.Nil(err)
+	assert.Equal([]string{"ckpt/uuid/src/tgt2/0"}, keys)
+
+	// deleted entries do not come back after restarts
+	meta_svc, err = NewFileMetadataSvc(dir, log.DefaultLoggerContext)
+	assert.Nil(err)
+	keys, err = meta_svc.GetAllKeysFromCatalog("ckpt")
+	assert.Nil(err)
+	assert.Equal([]string{"ckpt/uuid/src/tgt2/0"}, keys)
+	keys, err = meta_svc.GetAllKeysFromCatalog("replicationSpec")
+	assert.Nil(err)
+	assert.Equal([]string{"replicationSpec/uuid/src/tgt"}, keys)
+
+	fmt.Println("============== Test case end: TestFileMetadataSvcCatalogs =================")
+}
+
+func TestFileMetadataSvcObserveChildren(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestFileMetadataSvcObserveChildren =================")
+
+	dir, err := ioutil.TempDir("", "fileMetadataSvc")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	meta_svc, err := NewFileMetadataSvc(dir, log.DefaultLoggerContext)
+	assert.Nil(err)
+	assert.Nil(meta_svc.Add("replicationSpec/spec1", []byte("spec1")))
+	assert.Nil(meta_svc.Add("remoteCluster/ref1", []byte("ref1")))
+
+	type change struct {
+		path  string
+		value []byte
+	}
+	changeCh := make(chan *change, 10)
+	callback := func(path string, value []byte, rev interface{}) error {
+		changeCh <- &change{path, value}
+		return nil
+	}
+	cancelCh := make(chan struct{})
+	errCh := make(chan error)
+	go func() {
+		errCh <- meta_svc.ObserveChildren(GetCatalogPathFromCatalogKey("replicationSpec"), callback, cancelCh)
+	}()
+
+	nextChange := func() *change {
+		select {
+		case c := <-changeCh:
+			return c
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	}
+
+	// existing entries are delivered first
+	c := nextChange()
+	assert.NotNil(c)
+	assert.Equal("/replicationSpec/spec1", c.path)
+	assert.Equal([]byte("spec1"), c.value)
+
+	// changes outside of the observed path are not delivered
+	assert.Nil(meta_svc.Add("remoteCluster/ref2", []byte("ref2")))
+	assert.Nil(meta_svc.Add("replicationSpec/spec2", []byte("spec2")))
+	c = nextChange()
+	assert.NotNil(c)
+	assert.Equal("/replicationSpec/spec2", c.path)
+
+	// deletion is delivered with nil value
+	assert.Nil(meta_svc.Del("replicationSpec/spec1", nil))
+	c = nextChange()
+	assert.NotNil(c)
+	assert.Equal("/replicationSpec/spec1", c.path)
+	assert.Nil(c.value)
+
+	close(cancelCh)
+	select {
+	case err = <-errCh:
+		assert.Nil(err)
+	case <-time.After(5 * time.Second):
+		assert.Fail("ObserveChildren did not return after cancellation")
+	}
+	assert.Equal(0, len(meta_svc.observers))
+
+	fmt.Println("============== Test case end: TestFileMetadataSvcObserveChildren =================")
+}
@@ -85,6 +85,8 @@ type RemoteClusterAgent struct {
 	metakvSvc service_def.MetadataSvc
 	// uilog svc for printing
 	uiLogSvc service_def.UILogSvc
+	// notification svc for reporting refresh failures
+	notificationSvc service_def.NotificationSvc
 	// utilites service
 	utils utilities.UtilsIface
 
@@ -522,6 +524,9 @@ func (agent *RemoteClusterAgent) runPeriodicRefresh() {
 	ticker := time.NewTicker(base.RefreshRemoteClusterRefInterval)
 	defer ticker.Stop()
 
+	// only the first of consecutive refresh failures is notified
+	refreshFailing := false
+
 	for {
 		select {
 		case <-agent.refresherFinCh:
@@ -531,7 +536,15 @@ func (agent *RemoteClusterAgent) runPeriodicRefresh() {
 			err := agent.Refresh()
 			if err != nil {
 				agent.logger.Warnf("Agent %v periodic refresher encountered error while doing a refresh: %v", cachedId, err.Error())
+				if !refreshFailing && agent.notificationSvc != nil {
+					agent.refMtx.RLock()
+					refName := agent.reference.Name()
+					agent.refMtx.RUnlock()
+					agent.notificationSvc.Notify(metadata.NewRemoteClusterWebhookEvent(metadata.WebhookEventRemoteClusterRefreshFailure,
+						refName, err.Error()))
+				}
 			}
+			refreshFailing = err != nil
 		}
 	}
 }
@@ -732,6 +745,7 @@ func (agent *RemoteClusterAgent) setMetadataChangeCb(newCb base.MetadataChangeHa
 type RemoteClusterService struct {
 	metakv_svc        service_def.MetadataSvc
 	uilog_svc         service_def.UILogSvc
+	notification_svc  service_def.NotificationSvc
 	xdcr_topology_svc service_def.XDCRCompTopologySvc
 	cluster_info_svc  service_def.ClusterInfoSvc
 	logger            *log.CommonLogger
@@ -748,13 +762,14 @@ type RemoteClusterService struct {
 	agentMutex           sync.RWMutex
 }
 
-func NewRemoteClusterService(uilog_svc service_def.UILogSvc, metakv_svc service_def.MetadataSvc,
+func NewRemoteClusterService(uilog_svc service_def.UILogSvc, notification_svc service_def.NotificationSvc, metakv_svc service_def.MetadataSvc,
 	xdcr_topology_svc service_def.XDCRCompTopologySvc, cluster_info_svc service_def.ClusterInfoSvc,
 	logger_ctx *log.LoggerContext, utilsIn utilities.UtilsIface) (*RemoteClusterService, error) {
 	logger := log.NewLogger("RemClusterSvc", logger_ctx)
 	svc := &RemoteClusterService{
 		metakv_svc:           metakv_svc,
 		uilog_svc:            uilog_svc,
+		notification_svc:     notification_svc,
 		xdcr_topology_svc:    xdcr_topology_svc,
 		cluster_info_svc:     cluster_info_svc,
 		logger:               logger,
@@ -1336,6 +1351,7 @@ func (service *RemoteClusterService) formErrorFromValidatingRemotehost(ref *meta
 func (service *RemoteClusterService) NewRemoteClusterAgent() *RemoteClusterAgent {
 	newAgent := &RemoteClusterAgent{metakvSvc: service.metakv_svc,
 		uiLogSvc:               service.uilog_svc,
+		notificationSvc:        service.notification_svc,
 		utils:                  service.utils,
 		logger:                 service.logger,
 		metadataChangeCallback: service.metadata_change_callback,
@@ -1458,6 +1474,10 @@ func constructRemoteClusterReference(value []byte, rev interface{}) (*metadata.R
 
 //get remote cluster name from remote cluster uuid. Return unknown if remote cluster cannot be found
 func (service *RemoteClusterService) GetRemoteClusterNameFromClusterUuid(uuid string) string {
+	if metadata.IsSinkTargetClusterUUID(uuid) {
+		// replications to sinks have no remote cluster references, and are identified by sink type instead
+		return uuid
+	}
 	remoteClusterRef, err := service.RemoteClusterByUuid(uuid, false)
 	if err != nil || remoteClusterRef == nil {
 		errMsg := fmt.Sprintf("Error getting the name of the remote cluster with uuid=%v.", uuid)
@@ -51,7 +51,7 @@ func setupBoilerPlateRCS() (*service_def.UILogSvc,
 	utilitiesMock.On("ExponentialBackoffExecutor", "GetAllMetadataFromCatalogRemoteCluster", mock.Anything, mock.Anything,
 		mock.Anything, mock.Anything).Return(nil)
 
-	remoteClusterSvc, _ := NewRemoteClusterService(uiLogSvcMock, metadataSvcMock, xdcrTopologyMock,
+	remoteClusterSvc, _ := NewRemoteClusterService(uiLogSvcMock, nil /*notification_svc*/, metadataSvcMock, xdcrTopologyMock,
 		clusterInfoSvcMock, log.DefaultLoggerContext, utilitiesMock)
 
 	callBackCount = 0
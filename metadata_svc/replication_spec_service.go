@@ -94,6 +94,7 @@ type ReplicationSpecService struct {
 	xdcr_comp_topology_svc   service_def.XDCRCompTopologySvc
 	metadata_svc             service_def.MetadataSvc
 	uilog_svc                service_def.UILogSvc
+	notification_svc         service_def.NotificationSvc
 	remote_cluster_svc       service_def.RemoteClusterSvc
 	cluster_info_svc         service_def.ClusterInfoSvc
 	cache                    *MetadataCache
@@ -108,13 +109,14 @@ type ReplicationSpecService struct {
 	tgtGcMap specGCMap
 }
 
-func NewReplicationSpecService(uilog_svc service_def.UILogSvc, remote_cluster_svc service_def.RemoteClusterSvc,
+func NewReplicationSpecService(uilog_svc service_def.UILogSvc, notification_svc service_def.NotificationSvc, remote_cluster_svc service_def.RemoteClusterSvc,
 	metadata_svc service_def.MetadataSvc, xdcr_comp_topology_svc service_def.XDCRCompTopologySvc, cluster_info_svc service_def.ClusterInfoSvc,
 	logger_ctx *log.LoggerContext, utilities_in utilities.UtilsIface) (*ReplicationSpecService, error) {
 	logger := log.NewLogger("ReplSpecSvc", logger_ctx)
 	svc := &ReplicationSpecService{
 		metadata_svc:           metadata_svc,
 		uilog_svc:              uilog_svc,
+		notification_svc:       notification_svc,
 		remote_cluster_svc:     remote_cluster_svc,
 		xdcr_comp_topology_svc: xdcr_comp_topology_svc,
 		cluster_info_svc:       cluster_info_svc,
@@ -181,6 +183,19 @@ func (service *ReplicationSpecService) validateSourceBucket(errorMap base.ErrorM
 	return sourceBucketUUID, sourceConflictResolutionType, nil
 }
 
+// validate that the source bucket is not the bucket that stores checkpoint docs
+// checkpoint docs are written as documents of that bucket, and would be replicated to the target along with its data
+func (service *ReplicationSpecService) validateSourceBucketNotCheckpointsBucket(errorMap base.ErrorMap, sourceBucket string) error {
+	checkpointsBucket, _, err := GetCheckpointsBucket(service.metadata_svc)
+	if err != nil {
+		return err
+	}
+	if checkpointsBucket != "" && checkpointsBucket == sourceBucket {
+		errorMap[base.FromBucket] = fmt.Errorf("Bucket %v stores checkpoints of replications and cannot be the source bucket of a replication", sourceBucket)
+	}
+	return nil
+}
+
 // validate that the source bucket and target bucket are not the same bucket
 // i.e., validate that the following are not both true:
 // 1. sourceBucketName == targetBucketName
@@ -234,8 +249,8 @@ func (service *ReplicationSpecService) getRemoteReference(errorMap base.ErrorMap
 	return targetClusterRef, remote_connStr, remote_userName, remote_password, httpAuthMech, certificate, sanInCertificate, clientCertificate, clientKey
 }
 
-func (service *ReplicationSpecService) validateReplicationSpecDoesNotAlreadyExist(errorMap base.ErrorMap, sourceBucket string, targetClusterRef *metadata.RemoteClusterReference, targetBucket string) {
-	repId := metadata.ReplicationId(sourceBucket, targetClusterRef.Uuid(), targetBucket)
+func (service *ReplicationSpecService) validateReplicationSpecDoesNotAlreadyExist(errorMap base.ErrorMap, sourceBucket string, targetClusterUUID string, targetBucket string) {
+	repId := metadata.ReplicationId(sourceBucket, targetClusterUUID, targetBucket)
 	_, err := service.replicationSpec(repId)
 	if err == nil {
 		errorMap[base.PlaceHolderFieldKey] = errors.New(ReplicationSpecAlreadyExistErrorMessage)
@@ -348,12 +363,31 @@ func (service *ReplicationSpecService) ValidateNewReplicationSpec(sourceBucket,
 		return "", "", nil, errorMap, err, nil
 	}
 
+	err = service.validateSourceBucketNotCheckpointsBucket(errorMap, sourceBucket)
+	if len(errorMap) > 0 || err != nil {
+		return "", "", nil, errorMap, err, nil
+	}
+
+	if repl_type, ok := settings[metadata.ReplicationTypeKey].(string); ok && metadata.IsSinkReplicationType(repl_type) {
+		// replications to sinks do not need remote cluster references, and targetCluster is not used.
+		// sinks are not couchbase buckets. target bucket name only serves to identify the replication
+		service.validateReplicationSpecDoesNotAlreadyExist(errorMap, sourceBucket, metadata.SinkTargetClusterUUID(repl_type), targetBucket)
+		if len(errorMap) > 0 {
+			return "", "", nil, errorMap, nil, nil
+		}
+		err, warnings := service.validateSinkSettings(errorMap, repl_type, settings, true /*newSettings*/)
+		if len(errorMap) > 0 || err != nil {
+			return "", "", nil, errorMap, err, nil
+		}
+		return sourceBucketUUID, "", nil, errorMap, nil, warnings
+	}
+
 	targetClusterRef, remote_connStr, remote_userName, remote_password, httpAuthMech, certificate, sanInCertificate, clientCertificate, clientKey := service.getRemoteReference(errorMap, targetCluster)
 	if len(errorMap) > 0 {
 		return "", "", nil, errorMap, nil, nil
 	}
 
-	service.validateReplicationSpecDoesNotAlreadyExist(errorMap, sourceBucket, targetClusterRef, targetBucket)
+	service.validateReplicationSpecDoesNotAlreadyExist(errorMap, sourceBucket, targetClusterRef.Uuid(), targetBucket)
 	if len(errorMap) > 0 {
 		return "", "", nil, errorMap, nil, nil
 	}
@@ -397,6 +431,12 @@ func (service *ReplicationSpecService) ValidateNewReplicationSpec(sourceBucket,
 func (service *ReplicationSpecService) ValidateReplicationSettings(sourceBucket, targetCluster, targetBucket string, settings metadata.ReplicationSettingsMap) (base.ErrorMap, error) {
 	var errorMap base.ErrorMap = make(base.ErrorMap)
 
+	if repl_type, ok := settings[metadata.ReplicationTypeKey].(string); ok && metadata.IsSinkReplicationType(repl_type) {
+		// settings of replication to a sink are validated without the target cluster
+		err, _ := service.validateSinkSettings(errorMap, repl_type, settings, false /*new*/)
+		return errorMap, err
+	}
+
 	targetClusterRef, remote_connStr, remote_userName, remote_password, httpAuthMech, certificate, sanInCertificate, clientCertificate, clientKey := service.getRemoteReference(errorMap, targetCluster)
 	if len(errorMap) > 0 {
 		return errorMap, nil
@@ -430,13 +470,19 @@ func (service *ReplicationSpecService) validateReplicationSettingsInternal(error
 		settings[metadata.CompressionTypeKey] = compressionType
 	}
 
-	if filter, ok := settings[metadata.FilterExpressionKey].(string); ok {
-		// Validate filter if it's a new setting OR it's an existing adv filter
-		if version, ok := settings[metadata.FilterVersionKey]; newSettings || (ok && (version.(base.FilterVersionType) == base.FilterVersionAdvanced)) {
-			err = base.ValidateAdvFilter(filter)
-			if err != nil {
-				return err, warnings
-			}
+	err = validateFilterSettings(settings, newSettings)
+	if err != nil {
+		return err, warnings
+	}
+
+	if resolverName, resolverOk := settings[metadata.ConflictResolverKey].(string); resolverOk {
+		if err = base.ValidateConflictResolver(resolverName); err != nil {
+			errorMap[base.ConflictResolverREST] = err
+			return nil, warnings
+		}
+		if ok && repl_type == metadata.ReplicationTypeCapi && resolverName != base.ConflictResolverDefault {
+			errorMap[base.ConflictResolverREST] = fmt.Errorf("Custom conflict resolver is incompatible with XDCR Version 1 (CAPI Protocol)")
+			return nil, warnings
 		}
 	}
 
@@ -477,6 +523,54 @@ func (service *ReplicationSpecService) validateReplicationSettingsInternal(error
 	return nil, warnings
 }
 
+func validateFilterSettings(settings metadata.ReplicationSettingsMap, newSettings bool) error {
+	if filter, ok := settings[metadata.FilterExpressionKey].(string); ok {
+		// Validate filter if it's a new setting OR it's an existing adv filter
+		if version, ok := settings[metadata.FilterVersionKey]; newSettings || (ok && (version.(base.FilterVersionType) == base.FilterVersionAdvanced)) {
+			return base.ValidateAdvFilter(filter)
+		}
+	}
+	return nil
+}
+
+// validate settings of replication to a sink, which does not involve the target cluster
+func (service *ReplicationSpecService) validateSinkSettings(errorMap base.ErrorMap, repl_type string, settings metadata.ReplicationSettingsMap, newSettings bool) (error, []string) {
+	var warnings []string
+
+	if err := base.ValidateSink(repl_type); err != nil {
+		errorMap[base.Type] = err
+		return nil, warnings
+	}
+
+	metadata.SinkSettingsFromMap(settings).Validate(repl_type, errorMap)
+	if len(errorMap) > 0 {
+		return nil, warnings
+	}
+
+	err := validateFilterSettings(settings, newSettings)
+	if err != nil {
+		return err, warnings
+	}
+
+	if resolverName, ok := settings[metadata.ConflictResolverKey].(string); ok && resolverName != base.ConflictResolverDefault {
+		errorMap[base.ConflictResolverREST] = fmt.Errorf("Custom conflict resolver is incompatible with replication to %v sink", repl_type)
+		return nil, warnings
+	}
+
+	compressionType, ok := settings[metadata.CompressionTypeKey]
+	if !ok {
+		compressionType = metadata.DefaultReplicationSettings().CompressionType
+		settings[metadata.CompressionTypeKey] = compressionType
+	}
+	if compressionType == base.CompressionTypeAuto {
+		warnings = append(warnings, fmt.Sprintf("Compression is disabled automatically for replication to %v sink", repl_type))
+	} else if compressionType != base.CompressionTypeNone {
+		errorMap[base.CompressionTypeREST] = fmt.Errorf("Compression feature is incompatible with replication to %v sink", repl_type)
+	}
+
+	return nil, warnings
+}
+
 // validate compression - should only be called if compression setting dictates that there is compression
 func (service *ReplicationSpecService) validateCompression(errorMap base.ErrorMap, sourceBucket string, targetClusterRef *metadata.RemoteClusterReference, targetKVVBMap map[string][]uint16, targetBucket string, targetBucketInfo map[string]interface{}, compressionType int, allKvConnStrs []string, username, password string,
 	httpAuthMech base.HttpAuthMech, certificate []byte, SANInCertificate bool, clientCertificate, clientKey []byte) error {
@@ -683,7 +777,12 @@ func (service *ReplicationSpecService) AddReplicationSpec(spec *metadata.Replica
 	service.logger.Info("Adding it to metadata store...")
 
 	key := getKeyFromReplicationId(spec.Id)
-	err = service.metadata_svc.AddWithCatalog(ReplicationSpecsCatalogKey, key, value)
+	if spec.Settings.IsSink() {
+		// settings of replication to a sink may contain credentials of the sink
+		err = service.metadata_svc.AddSensitiveWithCatalog(ReplicationSpecsCatalogKey, key, value)
+	} else {
+		err = service.metadata_svc.AddWithCatalog(ReplicationSpecsCatalogKey, key, value)
+	}
 	if err != nil {
 		return err
 	}
@@ -722,7 +821,12 @@ func (service *ReplicationSpecService) SetReplicationSpec(spec *metadata.Replica
 	}
 	key := getKeyFromReplicationId(spec.Id)
 
-	err = service.metadata_svc.Set(key, value, spec.Revision)
+	if spec.Settings.IsSink() {
+		// settings of replication to a sink may contain credentials of the sink
+		err = service.metadata_svc.SetSensitive(key, value, spec.Revision)
+	} else {
+		err = service.metadata_svc.Set(key, value, spec.Revision)
+	}
 	if err != nil {
 		return err
 	}
@@ -1068,6 +1172,11 @@ func (service *ReplicationSpecService) gcTargetBucket(spec *metadata.Replication
 		return false, base.ErrorInvalidInput
 	}
 
+	if spec.Settings.IsSink() {
+		// there is no target bucket to garbage collect against
+		return false, nil
+	}
+
 	ref, err := service.remote_cluster_svc.RemoteClusterByUuid(spec.TargetClusterUUID, false /*refresh*/)
 	if err != nil {
 		service.logger.Warnf("Unable to retrieve reference from spec %v due to %v", spec.Id, err.Error())
@@ -1178,6 +1287,8 @@ func (service *ReplicationSpecService) ValidateAndGC(spec *metadata.ReplicationS
 		_, err1 := service.DelReplicationSpecWithReason(spec.Id, detailErr.Error())
 		if err1 != nil {
 			service.logger.Infof("Failed to garbage collect spec %v, err=%v\n", spec.Id, err1)
+		} else if service.notification_svc != nil {
+			service.notification_svc.Notify(metadata.NewReplicationWebhookEvent(metadata.WebhookEventReplicationSpecGC, spec.Id, detailErr.Error()))
 		}
 	}
 }
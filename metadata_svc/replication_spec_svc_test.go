@@ -47,6 +47,7 @@ func setupBoilerPlate() (*service_def.XDCRCompTopologySvc,
 		mock.Anything, mock.Anything).Return(nil)
 
 	replSpecSvc, _ := NewReplicationSpecService(uiLogSvcMock,
+		nil, /*notification_svc*/
 		remoteClusterMock,
 		metadataSvcMock,
 		xdcrTopologyMock,
@@ -482,3 +483,65 @@ func TestStripExpiry(t *testing.T) {
 
 	fmt.Println("============== Test case start: TestStripExpiry =================")
 }
+
+func TestValidateConflictResolver(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestValidateConflictResolver =================")
+	xdcrTopologyMock, metadataSvcMock, uiLogSvcMock, remoteClusterMock,
+		clusterInfoSvcMock, utilitiesMock, replSpecSvc,
+		sourceBucket, targetBucket, targetCluster, settings, clientMock := setupBoilerPlate()
+
+	// Begin mocks
+	setupMocks(base.ConflictResolutionType_Seqno, base.ConflictResolutionType_Seqno,
+		xdcrTopologyMock, metadataSvcMock, uiLogSvcMock, remoteClusterMock,
+		clusterInfoSvcMock, utilitiesMock, replSpecSvc, clientMock, true, /*IsEnterprise*/
+		false /*IsElastic*/, true /*CompressionPass*/)
+
+	settings[metadata.ReplicationTypeKey] = metadata.ReplicationTypeXmem
+	settings[metadata.ConflictResolverKey] = base.ConflictResolverSourceWins
+	errMap, err := replSpecSvc.ValidateReplicationSettings(sourceBucket, targetCluster, targetBucket, settings)
+	assert.Nil(err)
+	assert.Equal(0, len(errMap))
+
+	// resolver that has not been registered
+	settings[metadata.ConflictResolverKey] = "nonExistentResolver"
+	errMap, err = replSpecSvc.ValidateReplicationSettings(sourceBucket, targetCluster, targetBucket, settings)
+	assert.Nil(err)
+	assert.NotNil(errMap[base.ConflictResolverREST])
+
+	// custom resolver is not allowed for CAPI
+	settings[metadata.ReplicationTypeKey] = metadata.ReplicationTypeCapi
+	settings[metadata.ConflictResolverKey] = base.ConflictResolverTargetWins
+	errMap, err = replSpecSvc.ValidateReplicationSettings(sourceBucket, targetCluster, targetBucket, settings)
+	assert.Nil(err)
+	assert.NotNil(errMap[base.ConflictResolverREST])
+	fmt.Println("============== Test case end: TestValidateConflictResolver =================")
+}
+
+func TestValidateNewSinkReplicationSpec(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestValidateNewSinkReplicationSpec =================")
+	xdcrTopologyMock, metadataSvcMock, uiLogSvcMock, remoteClusterMock,
+		clusterInfoSvcMock, utilitiesMock, replSpecSvc,
+		sourceBucket, targetBucket, _, settings, clientMock := setupBoilerPlate()
+
+	// Begin mocks
+	setupMocks(base.ConflictResolutionType_Seqno, base.ConflictResolutionType_Seqno,
+		xdcrTopologyMock, metadataSvcMock, uiLogSvcMock, remoteClusterMock,
+		clusterInfoSvcMock, utilitiesMock, replSpecSvc, clientMock, true, /*IsEnterprise*/
+		false /*IsElastic*/, true /*CompressionPass*/)
+
+	// replication to sink does not need remote cluster reference
+	settings[metadata.ReplicationTypeKey] = base.SinkTypeFile
+	_, _, targetClusterRef, errMap, err, _ := replSpecSvc.ValidateNewReplicationSpec(sourceBucket, "" /*targetCluster*/, targetBucket, settings)
+	assert.Nil(err)
+	assert.Equal(0, len(errMap))
+	assert.Nil(targetClusterRef)
+	remoteClusterMock.AssertNotCalled(t, "RemoteClusterByRefName", mock.Anything, mock.Anything)
+
+	assert.Equal("sink-file/"+sourceBucket+"/"+targetBucket, metadata.ReplicationId(sourceBucket, metadata.SinkTargetClusterUUID(base.SinkTypeFile), targetBucket))
+	assert.True(metadata.IsSinkTargetClusterUUID(metadata.SinkTargetClusterUUID(base.SinkTypeFile)))
+	assert.False(metadata.IsSinkTargetClusterUUID("targetClusterUUID"))
+
+	fmt.Println("============== Test case end: TestValidateNewSinkReplicationSpec =================")
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package metadata_svc
+
+import (
+	"encoding/json"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/metadata"
+	"github.com/couchbase/goxdcr/service_def"
+	"sync"
+)
+
+const (
+	// parent dir of all webhooks
+	WebhooksCatalogKey = "webhooks"
+)
+
+// WebhookService keeps webhooks in metadata service, one entry per webhook.
+// webhooks are read whenever a notification event is delivered, and are therefore cached. the cache is loaded
+// on first use, and is reloaded after webhooks are changed on any node, as signaled by WebhookServiceCallback
+type WebhookService struct {
+	metadata_svc service_def.MetadataSvc
+	webhooks     []*metadata.Webhook
+	cacheValid   bool
+	// incremented whenever the cache is invalidated, so that a load that overlaps with changes is not cached
+	cacheGen  uint64
+	cacheLock sync.RWMutex
+	logger    *log.CommonLogger
+}
+
+func NewWebhookService(metadata_svc service_def.MetadataSvc, logger_ctx *log.LoggerContext) *WebhookService {
+	return &WebhookService{
+		metadata_svc: metadata_svc,
+		logger:       log.NewLogger("WebhookSvc", logger_ctx),
+	}
+}
+
+func (service *WebhookService) Webhooks() ([]*metadata.Webhook, error) {
+	service.cacheLock.RLock()
+	if service.cacheValid {
+		webhooks := make([]*metadata.Webhook, len(service.webhooks))
+		copy(webhooks, service.webhooks)
+		service.cacheLock.RUnlock()
+		return webhooks, nil
+	}
+	cacheGen := service.cacheGen
+	service.cacheLock.RUnlock()
+
+	webhooks, err := service.loadWebhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	service.cacheLock.Lock()
+	if service.cacheGen == cacheGen {
+		service.webhooks = webhooks
+		service.cacheValid = true
+	}
+	service.cacheLock.Unlock()
+
+	result := make([]*metadata.Webhook, len(webhooks))
+	copy(result, webhooks)
+	return result, nil
+}
+
+func (service *WebhookService) loadWebhooks() ([]*metadata.Webhook, error) {
+	entries, err := service.metadata_svc.GetAllMetadataFromCatalog(WebhooksCatalogKey)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]*metadata.Webhook, 0, len(entries))
+	for _, entry := range entries {
+		webhook, err := constructWebhook(entry.Value, entry.Rev)
+		if err != nil {
+			service.logger.Errorf("Skipping webhook %v that cannot be unmarshalled. err=%v\n", entry.Key, err)
+			continue
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, nil
+}
+
+// WebhookServiceCallback is called by metakv change listener when a webhook is added or deleted on any node
+func (service *WebhookService) WebhookServiceCallback(path string, value []byte, rev interface{}) error {
+	service.logger.Infof("WebhookServiceCallback called on path = %v\n", path)
+	service.invalidateCache()
+	return nil
+}
+
+func (service *WebhookService) invalidateCache() {
+	service.cacheLock.Lock()
+	defer service.cacheLock.Unlock()
+	service.webhooks = nil
+	service.cacheValid = false
+	service.cacheGen++
+}
+
+// returns service_def.MetadataNotFoundErr when webhook does not exist
+func (service *WebhookService) Webhook(id string) (*metadata.Webhook, error) {
+	value, rev, err := service.metadata_svc.Get(getWebhookKey(id))
+	if err != nil {
+		return nil, err
+	}
+	return constructWebhook(value, rev)
+}
+
+func (service *WebhookService) AddWebhook(webhook *metadata.Webhook) error {
+	err := webhook.Validate()
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(webhook)
+	if err != nil {
+		return err
+	}
+
+	err = service.metadata_svc.AddWithCatalog(WebhooksCatalogKey, getWebhookKey(webhook.Id), value)
+	if err != nil {
+		return err
+	}
+	// do not wait for metakv change listener, so that the webhook takes effect on this node right away
+	service.invalidateCache()
+	service.logger.Infof("Added webhook %v with url %v for event types %v\n", webhook.Id, webhook.Url, webhook.EventTypes)
+	return nil
+}
+
+// returns service_def.MetadataNotFoundErr when webhook does not exist
+func (service *WebhookService) DelWebhook(id string) error {
+	webhook, err := service.Webhook(id)
+	if err != nil {
+		return err
+	}
+
+	err = service.metadata_svc.DelWithCatalog(WebhooksCatalogKey, getWebhookKey(id), webhook.Revision)
+	if err != nil {
+		return err
+	}
+	service.invalidateCache()
+	service.logger.Infof("Deleted webhook %v with url %v\n", id, webhook.Url)
+	return nil
+}
+
+func getWebhookKey(id string) string {
+	return WebhooksCatalogKey + base.KeyPartsDelimiter + id
+}
+
+func constructWebhook(value []byte, rev interface{}) (*metadata.Webhook, error) {
+	webhook := &metadata.Webhook{}
+	err := json.Unmarshal(value, webhook)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Revision = rev
+	return webhook, nil
+}
@@ -0,0 +1,68 @@
+// +build !pcre
+
+package metadata_svc
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/metadata"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestWebhookServiceCache(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestWebhookServiceCache =================")
+
+	dir, err := ioutil.TempDir("", "fileMetadataSvc")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	file_svc, err := NewFileMetadataSvc(dir, log.DefaultLoggerContext)
+	assert.Nil(err)
+	webhook_svc := NewWebhookService(file_svc, log.DefaultLoggerContext)
+
+	webhooks, err := webhook_svc.Webhooks()
+	assert.Nil(err)
+	assert.Equal(0, len(webhooks))
+
+	// webhook added on this node takes effect right away
+	webhook, err := metadata.NewWebhook("http://localhost:8080/hook", []string{metadata.WebhookEventPipelineError})
+	assert.Nil(err)
+	assert.Nil(webhook_svc.AddWebhook(webhook))
+	webhooks, err = webhook_svc.Webhooks()
+	assert.Nil(err)
+	assert.Equal(1, len(webhooks))
+	assert.Equal(webhook.Id, webhooks[0].Id)
+
+	// webhook added on another node is served from cache until change listener calls back
+	otherWebhook, err := metadata.NewWebhook("http://localhost:8080/otherHook", []string{metadata.WebhookEventPipelineError})
+	assert.Nil(err)
+	value, err := json.Marshal(otherWebhook)
+	assert.Nil(err)
+	assert.Nil(file_svc.AddWithCatalog(WebhooksCatalogKey, getWebhookKey(otherWebhook.Id), value))
+	webhooks, err = webhook_svc.Webhooks()
+	assert.Nil(err)
+	assert.Equal(1, len(webhooks))
+
+	assert.Nil(webhook_svc.WebhookServiceCallback(getWebhookKey(otherWebhook.Id), value, nil))
+	webhooks, err = webhook_svc.Webhooks()
+	assert.Nil(err)
+	assert.Equal(2, len(webhooks))
+
+	// changes to the returned list do not affect the cache
+	webhooks[0] = nil
+	webhooks, err = webhook_svc.Webhooks()
+	assert.Nil(err)
+	assert.NotNil(webhooks[0])
+
+	assert.Nil(webhook_svc.DelWebhook(webhook.Id))
+	webhooks, err = webhook_svc.Webhooks()
+	assert.Nil(err)
+	assert.Equal(1, len(webhooks))
+	assert.Equal(otherWebhook.Id, webhooks[0].Id)
+
+	fmt.Println("============== Test case end: TestWebhookServiceCache =================")
+}
@@ -86,12 +86,20 @@ var BatchHistorySize = 20
 /************************************
 /* struct capiBatch
  * NOTE: see dataBatch comments for more info
+ * it is also the per vbucket batch of sink nozzles
 *************************************/
 type capiBatch struct {
 	dataBatch
 	vbno uint16
 }
 
+// batchSender is a nozzle that sends batches with retryBatchSend, i.e., capi nozzle or sink nozzle
+type batchSender interface {
+	Id() string
+	Logger() *log.CommonLogger
+	validateRunningState() error
+}
+
 /************************************
 /* struct capiConfig
 *************************************/
@@ -852,33 +860,55 @@ func (capi *CapiNozzle) batchUpdateDocsWithRetry(vbno uint16, req_list *[]*base.
 		return nil
 	}
 
+	sendFunc := func() error {
+		return capi.batchUpdateDocs(vbno, req_list)
+	}
+	return retryBatchSend(capi, vbno, sendFunc, capi.resetConn, capi.config.maxRetry, capi.config.retryInterval, capi.finish_ch)
+}
+
+// retryBatchSend sends the batch of vbno with sendFunc, and retries failed sends up to maxRetry times,
+// with backoff time starting at retryInterval and doubling on each retry.
+// Sends are not retried once sender stops, in which case PartStoppedError is returned,
+// or when sendFunc fails with SinkNonRetriableError.
+// resetFunc, if not nil, is called before each retry to ensure a clean start, e.g., with a new connection
+func retryBatchSend(sender batchSender, vbno uint16, sendFunc func() error, resetFunc func() error,
+	maxRetry int, retryInterval time.Duration, finch chan bool) error {
 	num_of_retry := 0
-	backoffTime := capi.config.retryInterval
+	backoffTime := retryInterval
 	for {
-		err := capi.validateRunningState()
+		err := sender.validateRunningState()
 		if err != nil {
 			return err
 		}
 
-		err = capi.batchUpdateDocs(vbno, req_list)
+		err = sendFunc()
 		if err == nil {
 			// success. no need to retry further
 			return nil
 		}
+		if _, ok := err.(*SinkNonRetriableError); ok {
+			return err
+		}
 
-		if num_of_retry < capi.config.maxRetry {
-			// reset connection to ensure a clean start
-			err = capi.resetConn()
-			if err != nil {
-				return err
+		if num_of_retry < maxRetry {
+			sender.Logger().Warnf("%v failed to send batch for vb %v. retry=%v, err=%v\n", sender.Id(), vbno, num_of_retry, err)
+			if resetFunc != nil {
+				err = resetFunc()
+				if err != nil {
+					return err
+				}
 			}
 			num_of_retry++
-			base.WaitForTimeoutOrFinishSignal(backoffTime, capi.finish_ch)
+			select {
+			case <-finch:
+				return PartStoppedError
+			case <-time.After(backoffTime):
+			}
 			backoffTime *= 2
-			capi.Logger().Infof("%v retrying update docs for vb %v for the %vth time\n", capi.Id(), vbno, num_of_retry)
+			sender.Logger().Infof("%v retrying batch send for vb %v for the %vth time\n", sender.Id(), vbno, num_of_retry)
 		} else {
-			// max retry reached. no need to call resetConn() since pipeline will get restarted
-			return errors.New(fmt.Sprintf("batch update docs failed for vb %v after %v retries", vbno, num_of_retry))
+			// max retry reached. no need to reset since pipeline will get restarted
+			return fmt.Errorf("batch send failed for vb %v after %v retries. err=%v", vbno, num_of_retry, err)
 		}
 	}
 }
@@ -31,13 +31,15 @@ import (
 
 const (
 	// start settings key name
-	DCP_VBTimestamp         = "VBTimestamps"
-	DCP_VBTimestampUpdater  = "VBTimestampUpdater"
-	DCP_Connection_Prefix   = "xdcr:"
-	EVENT_DCP_DISPATCH_TIME = "dcp_dispatch_time"
-	EVENT_DCP_DATACH_LEN    = "dcp_datach_length"
-	DCP_Stats_Interval      = "stats_interval"
-	DCP_Priority            = "dcpPriority"
+	DCP_VBTimestamp           = "VBTimestamps"
+	DCP_VBTimestampUpdater    = "VBTimestampUpdater"
+	DCP_Connection_Prefix     = "xdcr:"
+	EVENT_DCP_DISPATCH_TIME   = "dcp_dispatch_time"
+	EVENT_DCP_DATACH_LEN      = "dcp_datach_length"
+	DCP_Stats_Interval        = "stats_interval"
+	DCP_Priority              = "dcpPriority"
+	DCP_BoundedRange          = "boundedRange"
+	DCP_BoundedEndSeqnoGetter = "boundedEndSeqnoGetter"
 )
 
 type DcpStreamState int
@@ -46,8 +48,25 @@ const (
 	Dcp_Stream_NonInit = iota
 	Dcp_Stream_Init    = iota
 	Dcp_Stream_Active  = iota
+	// stream of bounded replication has reached the end of its range and has been closed by producer
+	Dcp_Stream_Completed = iota
 )
 
+func (state DcpStreamState) String() string {
+	switch state {
+	case Dcp_Stream_NonInit:
+		return "NotInitialized"
+	case Dcp_Stream_Init:
+		return "Initializing"
+	case Dcp_Stream_Active:
+		return "Active"
+	case Dcp_Stream_Completed:
+		return "Completed"
+	default:
+		return "Unknown"
+	}
+}
+
 var dcp_inactive_stream_check_interval = 30 * time.Second
 
 var dcp_setting_defs base.SettingDefinitions = base.SettingDefinitions{DCP_VBTimestamp: base.NewSettingDef(reflect.TypeOf((*map[uint16]*base.VBTimestamp)(nil)), false)}
@@ -66,6 +85,98 @@ type streamStatusWithLock struct {
 	lock  *sync.RWMutex
 }
 
+// progress of the stream of a vbucket in bounded replication
+type boundedStreamWithLock struct {
+	// seqno after which the stream starts when there is no checkpoint past it, i.e., the seqno right before the
+	// start of the seqno range, capped at the high seqno of the vbucket. 0 when the stream starts at the checkpoint
+	startSeqno uint64
+	// vbuuid of the vbucket at the time replication starts, which is valid for any seqno up to its high seqno
+	startVbuuid uint64
+	// seqno at which the stream ends
+	endSeqno uint64
+	// whether endSeqno is the high seqno of the vbucket, which needs to be replaced by the end seqno that has been
+	// kept in checkpoint since the replication first started
+	endSeqnoFromHighSeqno bool
+	// the largest seqno that has been seen in the stream, including snapshot end seqnos
+	lastSeenSeqno uint64
+	// the largest seqno of the mutations that have been received in the stream
+	lastMutationSeqno uint64
+	lock              sync.RWMutex
+}
+
+func (bounded *boundedStreamWithLock) getEndSeqno() uint64 {
+	bounded.lock.RLock()
+	defer bounded.lock.RUnlock()
+	return bounded.endSeqno
+}
+
+// returns the end seqno to open the stream with. end seqno that has been derived from the current high seqno of
+// the vbucket is passed to endSeqnoGetter, which returns the end seqno that the replication started with.
+// this is done only once, when the stream is first opened
+func (bounded *boundedStreamWithLock) resolveEndSeqno(vbno uint16, endSeqnoGetter func(uint16, uint64) uint64) uint64 {
+	bounded.lock.Lock()
+	defer bounded.lock.Unlock()
+	if bounded.endSeqnoFromHighSeqno && endSeqnoGetter != nil {
+		bounded.endSeqno = endSeqnoGetter(vbno, bounded.endSeqno)
+		bounded.endSeqnoFromHighSeqno = false
+	}
+	return bounded.endSeqno
+}
+
+// returns the timestamp to open the stream with. when vbts, which comes from checkpoint, is before the start of
+// the seqno range, the stream is opened at the start of the range instead, so that mutations before the range
+// are not streamed at all. this is done only once, since vbts after a rollback may no longer be compatible
+// with startVbuuid. mutations before the range that get streamed in that case are still dropped by router
+func (bounded *boundedStreamWithLock) getStartTimestamp(vbts *base.VBTimestamp) *base.VBTimestamp {
+	bounded.lock.Lock()
+	defer bounded.lock.Unlock()
+	if bounded.startSeqno <= vbts.Seqno {
+		return vbts
+	}
+	startTs := &base.VBTimestamp{
+		Vbno:          vbts.Vbno,
+		Vbuuid:        bounded.startVbuuid,
+		Seqno:         bounded.startSeqno,
+		SnapshotStart: bounded.startSeqno,
+		SnapshotEnd:   bounded.startSeqno,
+	}
+	bounded.startSeqno = 0
+	return startTs
+}
+
+func (bounded *boundedStreamWithLock) getLastMutationSeqno() uint64 {
+	bounded.lock.RLock()
+	defer bounded.lock.RUnlock()
+	return bounded.lastMutationSeqno
+}
+
+func (bounded *boundedStreamWithLock) onSeqnoSeen(seqno uint64, isMutation bool) {
+	bounded.lock.Lock()
+	defer bounded.lock.Unlock()
+	if seqno > bounded.lastSeenSeqno {
+		bounded.lastSeenSeqno = seqno
+	}
+	if isMutation && seqno > bounded.lastMutationSeqno {
+		bounded.lastMutationSeqno = seqno
+	}
+}
+
+// producer closes stream when it reaches end seqno, as well as in other cases, e.g., when vbucket state changes.
+// the stream is considered to have reached its end only when end seqno has been covered by what has been seen in the stream
+func (bounded *boundedStreamWithLock) reachedEnd() bool {
+	bounded.lock.RLock()
+	defer bounded.lock.RUnlock()
+	return bounded.lastSeenSeqno >= bounded.endSeqno
+}
+
+// additional info for StreamingEnd event
+type StreamingEndEventAdditional struct {
+	VBucket uint16
+	// seqno of the last mutation received in the stream, or 0 when no mutation has been received.
+	// the vbucket has been fully replicated when its through seqno reaches this seqno
+	LastSeqno uint64
+}
+
 /**
  * DCP Rollback Handshake Helper. See MB-25647 for handshake sequence design
  */
@@ -270,9 +381,11 @@ type DcpNozzleIface interface {
 	RaiseEvent(event *common.Event)
 }
 
-/************************************
+/*
+***********************************
 /* struct DcpNozzle
-*************************************/
+************************************
+*/
 type DcpNozzle struct {
 	AbstractPart
 
@@ -315,6 +428,8 @@ type DcpNozzle struct {
 	handle_error        bool
 	cur_ts              map[uint16]*vbtsWithLock
 	vbtimestamp_updater func(uint16, uint64) (*base.VBTimestamp, error)
+	// returns the end seqno of the bounded stream of a vbucket, given the one derived from its current high seqno
+	bounded_end_seqno_getter func(uint16, uint64) uint64
 
 	// the number of times that the dcp nozzle did not receive anything from dcp when there are
 	// items remaining in dcp
@@ -336,6 +451,11 @@ type DcpNozzle struct {
 
 	dcpPrioritySetting mcc.PriorityType
 	lockSetting        sync.RWMutex
+
+	// range of data that a bounded replication copies. nil when replication is not bounded
+	boundedRange *metadata.BoundedRange
+	// key - vb#, value - progress of the bounded stream of the vb. populated only when replication is bounded
+	vb_bounded_streams map[uint16]*boundedStreamWithLock
 }
 
 func NewDcpNozzle(id string,
@@ -366,6 +486,7 @@ func NewDcpNozzle(id string,
 		utils:                    utilsIn,
 		vbHandshakeMap:           make(map[uint16]*dcpStreamReqHelper),
 		dcpPrioritySetting:       mcc.PriorityDisabled,
+		vb_bounded_streams:       make(map[uint16]*boundedStreamWithLock),
 	}
 
 	for _, vbno := range vbnos {
@@ -508,6 +629,15 @@ func (dcp *DcpNozzle) initialize(settings metadata.ReplicationSettingsMap) (err
 		return err
 	}
 
+	if boundedRange, ok := settings[DCP_BoundedRange].(*metadata.BoundedRange); ok && boundedRange != nil {
+		dcp.boundedRange = boundedRange
+		// high seqnos, if needed, have to be retrieved before dcp.client is taken over by upr feed
+		err = dcp.initializeBoundedStreams()
+		if err != nil {
+			return err
+		}
+	}
+
 	err = dcp.initializeUprFeed()
 	if err != nil {
 		return err
@@ -515,6 +645,9 @@ func (dcp *DcpNozzle) initialize(settings metadata.ReplicationSettingsMap) (err
 
 	// fetch start timestamp from settings
 	dcp.vbtimestamp_updater = settings[DCP_VBTimestampUpdater].(func(uint16, uint64) (*base.VBTimestamp, error))
+	if getter, ok := settings[DCP_BoundedEndSeqnoGetter].(func(uint16, uint64) uint64); ok {
+		dcp.bounded_end_seqno_getter = getter
+	}
 
 	if val, ok := settings[DCP_Stats_Interval]; ok {
 		dcp.setStatsInterval(uint32(val.(int)))
@@ -525,6 +658,59 @@ func (dcp *DcpNozzle) initialize(settings metadata.ReplicationSettingsMap) (err
 	return
 }
 
+// determines the start seqno and the end seqno of the stream of each vbucket in bounded replication.
+// when seqno range is not specified, streams end at the high seqnos of the vbuckets at the time replication first
+// starts, which are kept in checkpoints and take the place of the current high seqnos when streams are opened
+func (dcp *DcpNozzle) initializeBoundedStreams() error {
+	vbList := dcp.GetVBList()
+	stats_map, err := dcp.client.StatsMap(base.VBUCKET_SEQNO_STAT_NAME)
+	if err != nil {
+		return err
+	}
+	highSeqnoAndVbuuids := make(map[uint16][]uint64)
+	dcp.utils.ParseHighSeqnoAndVBUuidFromStats(vbList, stats_map, highSeqnoAndVbuuids)
+
+	startSeqnos := make(map[uint16]uint64)
+	endSeqnos := make(map[uint16]uint64)
+	for _, vbno := range vbList {
+		highSeqnoAndVbuuid, ok := highSeqnoAndVbuuids[vbno]
+		if !ok {
+			return fmt.Errorf("%v cannot find high seqno and vbuuid for vb=%v", dcp.Id(), vbno)
+		}
+		bounded := &boundedStreamWithLock{endSeqno: highSeqnoAndVbuuid[0], endSeqnoFromHighSeqno: true}
+		if seqnoRange, ok := dcp.boundedRange.SeqnoRange(vbno); ok {
+			bounded.endSeqno = seqnoRange.End
+			bounded.endSeqnoFromHighSeqno = false
+			if seqnoRange.Start > 0 {
+				// dcp streams mutations with seqnos larger than the start seqno in stream request.
+				// the start seqno cannot go beyond high seqno, which the vbuuid is valid for
+				bounded.startSeqno = seqnoRange.Start - 1
+				if bounded.startSeqno > highSeqnoAndVbuuid[0] {
+					bounded.startSeqno = highSeqnoAndVbuuid[0]
+				}
+				bounded.startVbuuid = highSeqnoAndVbuuid[1]
+			}
+		}
+		dcp.vb_bounded_streams[vbno] = bounded
+		startSeqnos[vbno] = bounded.startSeqno
+		endSeqnos[vbno] = bounded.endSeqno
+	}
+	dcp.Logger().Infof("%v streams are bounded. start seqnos=%v, end seqnos=%v\n", dcp.Id(), startSeqnos, endSeqnos)
+	return nil
+}
+
+// marks the stream of a vbucket in bounded replication as completed, and lets checkpoint manager know
+// the last seqno that needs to be replicated for the vbucket
+func (dcp *DcpNozzle) completeBoundedStream(vbno uint16, bounded *boundedStreamWithLock) {
+	err := dcp.setStreamState(vbno, Dcp_Stream_Completed)
+	if err != nil {
+		return
+	}
+	lastSeqno := bounded.getLastMutationSeqno()
+	dcp.Logger().Infof("%v bounded stream for vb=%v has reached end seqno %v. last mutation seqno=%v\n", dcp.Id(), vbno, bounded.getEndSeqno(), lastSeqno)
+	dcp.RaiseEvent(common.NewEvent(common.StreamingEnd, nil, dcp, nil, &StreamingEndEventAdditional{VBucket: vbno, LastSeqno: lastSeqno}))
+}
+
 func (dcp *DcpNozzle) initializeUprHandshakeHelpers() {
 	vbList := dcp.GetVBList()
 
@@ -855,9 +1041,14 @@ func (dcp *DcpNozzle) processData() (err error) {
 				// It is possible for DCP to receive a UPR_STREAMEND even if the original StreamRequest sent was not
 				// successful. In that case, make sure it is a no-op, by checking the status, which should not be active.
 				if err == nil && stream_status == Dcp_Stream_Active {
-					err_streamend := fmt.Errorf("dcp stream for vb=%v is closed by producer", m.VBucket)
-					dcp.Logger().Infof("%v: %v", dcp.Id(), err_streamend)
-					dcp.handleVBError(vbno, err_streamend)
+					if bounded, ok := dcp.vb_bounded_streams[vbno]; ok && bounded.reachedEnd() {
+						// stream of bounded replication has reached its end seqno, which is expected
+						dcp.completeBoundedStream(vbno, bounded)
+					} else {
+						err_streamend := fmt.Errorf("dcp stream for vb=%v is closed by producer", m.VBucket)
+						dcp.Logger().Infof("%v: %v", dcp.Id(), err_streamend)
+						dcp.handleVBError(vbno, err_streamend)
+					}
 				}
 			} else {
 				// Regular mutations coming in from DCP stream
@@ -873,6 +1064,9 @@ func (dcp *DcpNozzle) processData() (err error) {
 							dcp.incCompressedCounterReceived()
 						}
 						dcp.RaiseEvent(common.NewEvent(common.DataReceived, m, dcp, nil /*derivedItems*/, nil /*otherInfos*/))
+						if bounded, ok := dcp.vb_bounded_streams[m.VBucket]; ok {
+							bounded.onSeqnoSeen(m.Seqno, true /*isMutation*/)
+						}
 						if !dcp.is_capi {
 							dcp.handleXattr(m)
 						}
@@ -886,6 +1080,9 @@ func (dcp *DcpNozzle) processData() (err error) {
 						dispatch_time := time.Since(start_time)
 						dcp.RaiseEvent(common.NewEvent(common.DataProcessed, m, dcp, nil /*derivedItems*/, dispatch_time.Seconds()*1000000 /*otherInfos*/))
 					case mc.UPR_SNAPSHOT:
+						if bounded, ok := dcp.vb_bounded_streams[m.VBucket]; ok {
+							bounded.onSeqnoSeen(m.SnapendSeq, false /*isMutation*/)
+						}
 						dcp.RaiseEvent(common.NewEvent(common.SnapshotMarkerReceived, m, dcp, nil /*derivedItems*/, nil /*otherInfos*/))
 					default:
 						dcp.Logger().Debugf("%v Uprevent OpCode=%v, is skipped\n", dcp.Id(), m.Opcode)
@@ -1027,6 +1224,15 @@ func (dcp *DcpNozzle) startUprStreams_internal(streams_to_start []uint16) error
 func (dcp *DcpNozzle) startUprStreamInner(vbno uint16, vbts *base.VBTimestamp, version uint16) (err error) {
 	flags := uint32(0)
 	seqEnd := uint64(0xFFFFFFFFFFFFFFFF)
+	if bounded, ok := dcp.vb_bounded_streams[vbno]; ok {
+		seqEnd = bounded.resolveEndSeqno(vbno, dcp.bounded_end_seqno_getter)
+		if vbts.Seqno >= seqEnd {
+			// all the data in the range has been replicated. there is no need to open the stream
+			dcp.completeBoundedStream(vbno, bounded)
+			return
+		}
+		vbts = bounded.getStartTimestamp(vbts)
+	}
 	dcp.Logger().Debugf("%v starting vb stream for vb=%v, version=%v\n", dcp.Id(), vbno, version)
 
 	dcp.lock_uprFeed.RLock()
@@ -1093,7 +1299,7 @@ func (dcp *DcpNozzle) inactiveDcpStreams() []uint16 {
 }
 
 func inactiveStateCheck(state DcpStreamState) bool {
-	return state != Dcp_Stream_Active
+	return state != Dcp_Stream_Active && state != Dcp_Stream_Completed
 }
 
 func (dcp *DcpNozzle) initedButInactiveDcpStreams() []uint16 {
@@ -1116,7 +1322,7 @@ func (dcp *DcpNozzle) inactiveDcpStreamsWithState() map[uint16]DcpStreamState {
 	ret := make(map[uint16]DcpStreamState)
 	for _, vb := range dcp.GetVBList() {
 		state, err := dcp.GetStreamState(vb)
-		if err == nil && state != Dcp_Stream_Active {
+		if err == nil && inactiveStateCheck(state) {
 			ret[vb] = state
 		}
 	}
@@ -1240,7 +1446,7 @@ func (dcp *DcpNozzle) getTS(vbno uint16, need_lock bool) (*base.VBTimestamp, err
 	}
 }
 
-//if the vbno is not belongs to this DcpNozzle, return true
+// if the vbno is not belongs to this DcpNozzle, return true
 func (dcp *DcpNozzle) isTSSet(vbno uint16, need_lock bool) bool {
 	ts, err := dcp.getTS(vbno, need_lock)
 	if err != nil {
@@ -432,3 +432,78 @@ func TestStartNozzleAuto(t *testing.T) {
 	assert.NotEqual(nozzle.State(), common.Part_Running)
 	fmt.Println("============== Test case end: TestStartStopDCPNozzleAuto =================")
 }
+
+func TestDcpStreamStateString(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestDcpStreamStateString =================")
+
+	testCases := []struct {
+		state    DcpStreamState
+		expected string
+	}{
+		{Dcp_Stream_NonInit, "NotInitialized"},
+		{Dcp_Stream_Init, "Initializing"},
+		{Dcp_Stream_Active, "Active"},
+		{DcpStreamState(100), "Unknown"},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(testCase.expected, testCase.state.String())
+	}
+	fmt.Println("============== Test case end: TestDcpStreamStateString =================")
+}
+
+func TestBoundedStreamStartTimestamp(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestBoundedStreamStartTimestamp =================")
+
+	checkpointTs := &base.VBTimestamp{Vbno: 1, Vbuuid: 111, Seqno: 500, SnapshotStart: 400, SnapshotEnd: 600}
+	testCases := []struct {
+		name       string
+		startSeqno uint64
+		vbts       *base.VBTimestamp
+		expected   *base.VBTimestamp
+	}{
+		{"no checkpoint", 99, &base.VBTimestamp{Vbno: 1},
+			&base.VBTimestamp{Vbno: 1, Vbuuid: 222, Seqno: 99, SnapshotStart: 99, SnapshotEnd: 99}},
+		{"checkpoint before range start", 999, checkpointTs,
+			&base.VBTimestamp{Vbno: 1, Vbuuid: 222, Seqno: 999, SnapshotStart: 999, SnapshotEnd: 999}},
+		{"checkpoint in range", 99, checkpointTs, checkpointTs},
+		{"range starting at 0", 0, &base.VBTimestamp{Vbno: 1}, &base.VBTimestamp{Vbno: 1}},
+	}
+
+	for _, testCase := range testCases {
+		bounded := &boundedStreamWithLock{startSeqno: testCase.startSeqno, startVbuuid: 222, endSeqno: 2000}
+		assert.Equal(testCase.expected, bounded.getStartTimestamp(testCase.vbts), testCase.name)
+		// the stream is opened at range start only once, e.g., not again after a rollback
+		assert.Equal(testCase.vbts, bounded.getStartTimestamp(testCase.vbts), testCase.name)
+	}
+	fmt.Println("============== Test case end: TestBoundedStreamStartTimestamp =================")
+}
+
+func TestBoundedStreamEndSeqno(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestBoundedStreamEndSeqno =================")
+
+	// end seqno that the replication first started with, as kept in checkpoint
+	getterCalls := 0
+	endSeqnoGetter := func(vbno uint16, highSeqno uint64) uint64 {
+		getterCalls++
+		return 1000
+	}
+
+	// end seqno derived from current high seqno is replaced, once
+	bounded := &boundedStreamWithLock{endSeqno: 2000, endSeqnoFromHighSeqno: true}
+	assert.Equal(uint64(1000), bounded.resolveEndSeqno(1, endSeqnoGetter))
+	assert.Equal(uint64(1000), bounded.resolveEndSeqno(1, endSeqnoGetter))
+	assert.Equal(1, getterCalls)
+	bounded.onSeqnoSeen(1000, true)
+	assert.True(bounded.reachedEnd())
+
+	// end seqno from seqno range is kept
+	bounded = &boundedStreamWithLock{endSeqno: 500}
+	assert.Equal(uint64(500), bounded.resolveEndSeqno(1, endSeqnoGetter))
+	assert.Equal(1, getterCalls)
+
+	fmt.Println("============== Test case end: TestBoundedStreamEndSeqno =================")
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+// defines the file sink, a reference sink that allows replications to be run without a target cluster
+package parts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/couchbase/goxdcr/log"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+const FileSinkDirPrefix = "xdcr_file_sink_"
+const FileSinkFileSuffix = ".json"
+
+// FileSink appends mutations as json lines to local files, one file per vbucket,
+// under a directory dedicated to the replication.
+// Since mutations after the last checkpoint are replicated again when replication restarts,
+// a file may contain more than one line for the same seqno.
+type FileSink struct {
+	dir    string
+	files  map[uint16]*os.File
+	logger *log.CommonLogger
+}
+
+// NewFileSinkConstructor returns the constructor of file sinks that write under the specified directory
+func NewFileSinkConstructor(rootDir string) SinkConstructor {
+	if rootDir == "" {
+		// log directory is not specified when goxdcr is run outside of couchbase server
+		rootDir = os.TempDir()
+	}
+	return func(params *SinkParams, logger *log.CommonLogger) (Sink, error) {
+		return &FileSink{
+			dir:    GetFileSinkDir(rootDir, params.Topic),
+			files:  make(map[uint16]*os.File),
+			logger: logger,
+		}, nil
+	}
+}
+
+// GetFileSinkDir returns the directory that file sinks of a replication write to
+func GetFileSinkDir(rootDir, topic string) string {
+	return filepath.Join(rootDir, FileSinkDirPrefix+url.QueryEscape(topic))
+}
+
+// GetFileSinkFileName returns the name of the file that file sinks write mutations in a vbucket to
+func GetFileSinkFileName(dir string, vbno uint16) string {
+	return filepath.Join(dir, fmt.Sprintf("%v%v", vbno, FileSinkFileSuffix))
+}
+
+func (sink *FileSink) Open() error {
+	return os.MkdirAll(sink.dir, 0755)
+}
+
+func (sink *FileSink) Write(vbno uint16, records []*SinkRecord) error {
+	file, err := sink.getFile(vbno)
+	if err != nil {
+		return err
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	for _, record := range records {
+		// Encode appends a new line after each record
+		err = encoder.Encode(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = file.Write(buffer.Bytes())
+	if err != nil {
+		return err
+	}
+	// mutations need to be durable before they can be checkpointed
+	return file.Sync()
+}
+
+func (sink *FileSink) Close() error {
+	var lastErr error
+	for vbno, file := range sink.files {
+		err := file.Close()
+		if err != nil {
+			sink.logger.Warnf("Error closing file sink for vb %v. err=%v", vbno, err)
+			lastErr = err
+		}
+	}
+	sink.files = make(map[uint16]*os.File)
+	return lastErr
+}
+
+func (sink *FileSink) getFile(vbno uint16) (*os.File, error) {
+	if file, ok := sink.files[vbno]; ok {
+		return file, nil
+	}
+	file, err := os.OpenFile(GetFileSinkFileName(sink.dir, vbno), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	sink.files[vbno] = file
+	return file, nil
+}
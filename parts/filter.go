@@ -10,12 +10,14 @@
 package parts
 
 import (
+	"encoding/binary"
 	"fmt"
 	"github.com/couchbase/gojsonsm"
 	mc "github.com/couchbase/gomemcached"
 	mcc "github.com/couchbase/gomemcached/client"
 	"github.com/couchbase/goxdcr/base"
 	utilities "github.com/couchbase/goxdcr/utils"
+	"github.com/golang/snappy"
 )
 
 type FilterIface interface {
@@ -30,6 +32,12 @@ type Filter struct {
 	dp                       utilities.DataPoolIface
 	flags                    base.FilterFlagType
 	slicesToBeReleasedBuf    [][]byte
+	// whether filter expression can be evaluated against deletions and expirations,
+	// i.e., whether it references only document key and xattrs
+	delExpFilterable bool
+	// whether to skip deletions and expirations that filter expression cannot be evaluated against
+	// set through SetDelExpFallback() and may be changed while filter is in use
+	skipUnfilterableDelExp *base.AtomicBooleanType
 }
 
 func NewFilter(id string, filterExpression string, utils utilities.UtilsIface) (*Filter, error) {
@@ -48,6 +56,8 @@ func NewFilter(id string, filterExpression string, utils utilities.UtilsIface) (
 		utils:                    utils,
 		dp:                       dpPtr,
 		slicesToBeReleasedBuf:    make([][]byte, 0, 2),
+		delExpFilterable:         !base.FilterReferencesDocBody(filterExpression),
+		skipUnfilterableDelExp:   base.NewAtomicBooleanType(false),
 	}
 
 	matcher, err := base.GoJsonsmGetFilterExprMatcher(filter.filterExpressionInternal)
@@ -85,8 +95,15 @@ func (filter *Filter) FilterUprEvent(uprEvent *mcc.UprEvent) (bool, error, strin
 	}
 
 	if uprEvent.Opcode == mc.UPR_DELETION || uprEvent.Opcode == mc.UPR_EXPIRATION {
-		// For now, pass through
-		return true, nil, "", 0
+		var errDesc string
+		uprEvent, err, errDesc = filter.delExpEventToBeFiltered(uprEvent)
+		if err != nil {
+			return false, err, errDesc, 0
+		}
+		if uprEvent == nil {
+			// filter expression cannot be evaluated against the deletion. apply fallback policy
+			return !filter.skipUnfilterableDelExp.Get(), nil, "", 0
+		}
 	}
 
 	sliceToBeFiltered, err, errDesc, releaseFunc, failedDpCnt := filter.utils.ProcessUprEventForFiltering(uprEvent, filter.dp, filter.flags, &filter.slicesToBeReleasedBuf)
@@ -109,6 +126,56 @@ func (filter *Filter) FilterUprEvent(uprEvent *mcc.UprEvent) (bool, error, strin
 	return matched, err, errDesc, failedDpCnt
 }
 
+// Deletions and expirations do not have document body, and may carry xattrs, e.g., system xattrs.
+// Returns an event that contains only the document key and, when filter expression references xattrs,
+// the xattrs in the deletion followed by an empty body, so that it can be filtered the same way as mutations.
+// Returns nil event when filter expression cannot be evaluated against the deletion
+func (filter *Filter) delExpEventToBeFiltered(uprEvent *mcc.UprEvent) (*mcc.UprEvent, error, string) {
+	if !filter.delExpFilterable {
+		return nil, nil, ""
+	}
+
+	delExpEvent := &mcc.UprEvent{
+		Opcode:  uprEvent.Opcode,
+		VBucket: uprEvent.VBucket,
+		Key:     uprEvent.Key,
+	}
+	if filter.flags&base.FilterFlagSkipXattr > 0 {
+		return delExpEvent, nil, ""
+	}
+
+	if uprEvent.DataType&mcc.XattrDataType == 0 {
+		// xattrs referenced by filter expression are not available
+		return nil, nil, ""
+	}
+
+	value := uprEvent.Value
+	if uprEvent.DataType&mcc.SnappyDataType > 0 {
+		var err error
+		value, err = snappy.Decode(nil, uprEvent.Value)
+		if err != nil {
+			return nil, base.ErrorCompressionUnableToInflate, fmt.Sprintf("XDCR for key %v%v%v is unable to snappy decompress xattrs: %v", base.UdTagBegin, string(uprEvent.Key), base.UdTagEnd, err)
+		}
+	}
+	if len(value) < 4 || int(binary.BigEndian.Uint32(value[0:4]))+4 > len(value) {
+		return nil, base.ErrorFilterParsingError, fmt.Sprintf("Unable to parse xattrs of document %v%v%v", base.UdTagBegin, string(uprEvent.Key), base.UdTagEnd)
+	}
+	xattrSectionSize := int(binary.BigEndian.Uint32(value[0:4])) + 4
+
+	// replace body, if any, with an empty json body
+	delExpEvent.Value = make([]byte, xattrSectionSize+2)
+	copy(delExpEvent.Value, value[:xattrSectionSize])
+	delExpEvent.Value[xattrSectionSize] = '{'
+	delExpEvent.Value[xattrSectionSize+1] = '}'
+	delExpEvent.DataType = mcc.XattrDataType | mcc.JSONDataType
+	return delExpEvent, nil, ""
+}
+
+// sets the policy for deletions and expirations that filter expression cannot be evaluated against
+func (filter *Filter) SetDelExpFallback(fallback string) {
+	filter.skipUnfilterableDelExp.Set(fallback == base.FilterDelExpFallbackSkip)
+}
+
 func (filter *Filter) matchWrapper(slice []byte, errPtr *error) (matched bool) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -3,6 +3,7 @@
 package parts
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	mcc "github.com/couchbase/gomemcached/client"
@@ -163,3 +164,73 @@ func TestKeyPanic(t *testing.T) {
 
 	fmt.Println("============== Test case end: TestKeyPanic =================")
 }
+
+// builds the xattr section of a dcp packet with a single xattr
+func buildXattrSection(key, value string) []byte {
+	pair := []byte(fmt.Sprintf("%v\x00%v\x00", key, value))
+	section := make([]byte, 8+len(pair))
+	binary.BigEndian.PutUint32(section[0:4], uint32(4+len(pair)))
+	binary.BigEndian.PutUint32(section[4:8], uint32(len(pair)))
+	copy(section[8:], pair)
+	return section
+}
+
+func TestFilterDeletion(t *testing.T) {
+	fmt.Println("============== Test case start: TestFilterDeletion =================")
+	assert := assert.New(t)
+
+	// key of deletion is TestDocKey
+	delEvent, err := RetrieveUprFile("./testdata/uprEventDeletion.json")
+	assert.Nil(err)
+	assert.NotNil(delEvent)
+
+	filter, err := NewFilter(filterId, "REGEXP_CONTAINS(META().id, \"^TestDoc\")", realUtil)
+	assert.Nil(err)
+	matched, err, _, _ := filter.FilterUprEvent(delEvent)
+	assert.Nil(err)
+	assert.True(matched)
+
+	filter, err = NewFilter(filterId, "REGEXP_CONTAINS(META().id, \"^abc\")", realUtil)
+	assert.Nil(err)
+	matched, err, _, _ = filter.FilterUprEvent(delEvent)
+	assert.Nil(err)
+	assert.False(matched)
+
+	// expression that references doc body cannot be evaluated. fallback policy applies
+	filter, err = NewFilter(filterId, "REGEXP_CONTAINS(META().id, \"^abc\") AND type = \"foo\"", realUtil)
+	assert.Nil(err)
+	matched, err, _, _ = filter.FilterUprEvent(delEvent)
+	assert.Nil(err)
+	assert.True(matched)
+	filter.SetDelExpFallback(base.FilterDelExpFallbackSkip)
+	matched, err, _, _ = filter.FilterUprEvent(delEvent)
+	assert.Nil(err)
+	assert.False(matched)
+
+	// deletion does not carry the xattrs referenced by expression
+	filter, err = NewFilter(filterId, "META().xattrs.app = \"xdcr\"", realUtil)
+	assert.Nil(err)
+	matched, err, _, _ = filter.FilterUprEvent(delEvent)
+	assert.Nil(err)
+	assert.True(matched)
+	filter.SetDelExpFallback(base.FilterDelExpFallbackSkip)
+	matched, err, _, _ = filter.FilterUprEvent(delEvent)
+	assert.Nil(err)
+	assert.False(matched)
+
+	// deletion with xattrs
+	delEvent.DataType = mcc.XattrDataType
+	delEvent.Value = buildXattrSection("app", "\"xdcr\"")
+	filter.SetDelExpFallback(base.FilterDelExpFallbackReplicate)
+	matched, err, _, _ = filter.FilterUprEvent(delEvent)
+	assert.Nil(err)
+	assert.True(matched)
+
+	filter, err = NewFilter(filterId, "META().xattrs.app = \"other\" AND META().id = \"TestDocKey\"", realUtil)
+	assert.Nil(err)
+	matched, err, _, _ = filter.FilterUprEvent(delEvent)
+	assert.Nil(err)
+	assert.False(matched)
+
+	fmt.Println("============== Test case end: TestFilterDeletion =================")
+}
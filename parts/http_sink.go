@@ -0,0 +1,178 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+// defines the http sink, which posts batches of mutations as json to an http or https endpoint
+package parts
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/metadata"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// max length of response body to be included in error messages
+const httpSinkMaxResponseLength = 1024
+
+var ErrorHttpSinkInvalidCertificate = errors.New("Certificate of http sink is not a valid PEM encoded certificate")
+
+// HttpSinkPayload is the json body of the requests that http sinks post
+type HttpSinkPayload struct {
+	Topic        string        `json:"topic"`
+	SourceBucket string        `json:"sourceBucket"`
+	TargetBucket string        `json:"targetBucket"`
+	VBucket      uint16        `json:"vb"`
+	Records      []*SinkRecord `json:"records"`
+}
+
+// HttpSink posts each batch of mutations as one request to the configured endpoint, and handles responses by status code:
+// 1. 2xx - batch is replicated
+// 2. retry status codes, as well as failures to get a response - batch is posted again by the owning nozzle
+// 3. skip status codes - batch is considered replicated, and is logged as skipped
+// 4. all other status codes - replication fails
+// Since batches after the last checkpoint are posted again when replication restarts,
+// the endpoint may receive the same mutation more than once.
+type HttpSink struct {
+	url              string
+	headers          map[string]string
+	username         string
+	password         string
+	retryStatusCodes []int
+	skipStatusCodes  []int
+	client           *http.Client
+	params           *SinkParams
+	logger           *log.CommonLogger
+}
+
+// NewHttpSink is the SinkConstructor of http sink. It uses the following sink settings of replication:
+// 1. endpoint - the http or https url to post to
+// 2. username and password, if any - credentials for basic authentication
+// 3. certificate, if any - certificates to trust for https url, in addition to the system ones
+// 4. http headers, if any - headers to be set on each request, e.g., for token based authentication
+// 5. http retry and skip status codes
+func NewHttpSink(params *SinkParams, logger *log.CommonLogger) (Sink, error) {
+	settings := params.Settings
+	headers, err := metadata.ParseSinkHttpHeaders(settings.HttpHeaders)
+	if err != nil {
+		return nil, err
+	}
+	retryStatusCodes, err := settings.HttpRetryStatusCodesOrDefault()
+	if err != nil {
+		return nil, err
+	}
+	skipStatusCodes, err := metadata.ParseSinkHttpStatusCodes(settings.HttpSkipStatusCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if len(settings.Certificate) > 0 {
+		certPool, err := x509.SystemCertPool()
+		if err != nil {
+			certPool = x509.NewCertPool()
+		}
+		if !certPool.AppendCertsFromPEM([]byte(settings.Certificate)) {
+			return nil, ErrorHttpSinkInvalidCertificate
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: certPool}
+	}
+
+	return &HttpSink{
+		url:              settings.Endpoint,
+		headers:          headers,
+		username:         settings.Username,
+		password:         settings.Password,
+		retryStatusCodes: retryStatusCodes,
+		skipStatusCodes:  skipStatusCodes,
+		client:           &http.Client{Transport: transport, Timeout: base.HttpSinkRequestTimeout},
+		params:           params,
+		logger:           logger,
+	}, nil
+}
+
+func (sink *HttpSink) Open() error {
+	return nil
+}
+
+func (sink *HttpSink) Write(vbno uint16, records []*SinkRecord) error {
+	payload := &HttpSinkPayload{
+		Topic:        sink.params.Topic,
+		SourceBucket: sink.params.SourceBucketName,
+		TargetBucket: sink.params.TargetBucketName,
+		VBucket:      vbno,
+		Records:      records,
+	}
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(payload)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(base.MethodPost, sink.url, &body)
+	if err != nil {
+		return &SinkNonRetriableError{err}
+	}
+	request.Header.Set(base.ContentType, base.JsonContentType)
+	for name, value := range sink.headers {
+		request.Header.Set(name, value)
+	}
+	if len(sink.username) > 0 {
+		request.SetBasicAuth(sink.username, sink.password)
+	}
+
+	response, err := sink.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	responseBody, _ := ioutil.ReadAll(io.LimitReader(response.Body, httpSinkMaxResponseLength))
+	// drains the rest of response body so that connection can be reused
+	io.Copy(ioutil.Discard, response.Body)
+
+	statusCode := response.StatusCode
+	switch {
+	case isHttpSinkSuccess(statusCode):
+		return nil
+	case intListContains(sink.skipStatusCodes, statusCode):
+		sink.logger.Warnf("Skipped %v documents in vb %v of %v, for which http sink got status code %v. response=%s",
+			len(records), vbno, sink.params.Topic, statusCode, responseBody)
+		return nil
+	case intListContains(sink.retryStatusCodes, statusCode):
+		return fmt.Errorf("Received status code %v from http sink. response=%s", statusCode, responseBody)
+	default:
+		return &SinkNonRetriableError{fmt.Errorf("Received status code %v from http sink. response=%s", statusCode, responseBody)}
+	}
+}
+
+func (sink *HttpSink) Close() error {
+	return nil
+}
+
+func isHttpSinkSuccess(statusCode int) bool {
+	return statusCode >= 200 && statusCode < 300
+}
+
+func intListContains(list []int, value int) bool {
+	for _, element := range list {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+// +build !pcre
+
+package parts
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	mc "github.com/couchbase/gomemcached"
+	base "github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/metadata"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// http endpoint that records posted payloads, and responds with the specified status codes first
+type httpSinkEndpoint struct {
+	lock        sync.Mutex
+	payloads    []*HttpSinkPayload
+	headers     []http.Header
+	statusCodes []int
+}
+
+func (endpoint *httpSinkEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint.lock.Lock()
+	defer endpoint.lock.Unlock()
+	payload := &HttpSinkPayload{}
+	if r.Method != base.MethodPost || json.NewDecoder(r.Body).Decode(payload) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	endpoint.payloads = append(endpoint.payloads, payload)
+	endpoint.headers = append(endpoint.headers, r.Header)
+	if len(endpoint.statusCodes) > 0 {
+		w.WriteHeader(endpoint.statusCodes[0])
+		w.Write([]byte("rejected"))
+		endpoint.statusCodes = endpoint.statusCodes[1:]
+	}
+}
+
+func TestHttpSink(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestHttpSink =================")
+
+	endpoint := &httpSinkEndpoint{}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	settings := metadata.SinkSettings{
+		Endpoint:            server.URL + "/hook",
+		Username:            "user",
+		Password:            "password",
+		HttpHeaders:         `{"X-Api-Key":"key"}`,
+		HttpSkipStatusCodes: "409",
+	}
+	params := &SinkParams{Topic: "uuid/sourceBucket/targetBucket", SourceBucketName: "sourceBucket", TargetBucketName: "targetBucket", Settings: settings}
+	sink, err := NewHttpSink(params, sinkTestLogger)
+	assert.Nil(err)
+	assert.Nil(sink.Open())
+	defer sink.Close()
+
+	record1, _ := NewSinkRecord(composeSinkTestRequest("doc1", 5, 1, mc.UPR_MUTATION, base.JSONDataType, []byte(`{"a":1}`)))
+	record2, _ := NewSinkRecord(composeSinkTestRequest("doc2", 5, 2, mc.UPR_DELETION, 0, nil))
+	assert.Nil(sink.Write(5, []*SinkRecord{record1, record2}))
+
+	endpoint.lock.Lock()
+	assert.Equal(1, len(endpoint.payloads))
+	if len(endpoint.payloads) == 1 {
+		payload := endpoint.payloads[0]
+		assert.Equal(params.Topic, payload.Topic)
+		assert.Equal("sourceBucket", payload.SourceBucket)
+		assert.Equal("targetBucket", payload.TargetBucket)
+		assert.Equal(uint16(5), payload.VBucket)
+		assert.Equal(2, len(payload.Records))
+		assert.Equal("doc1", payload.Records[0].Key)
+		assert.Equal(json.RawMessage(`{"a":1}`), payload.Records[0].Doc)
+		assert.True(payload.Records[1].Deleted)
+
+		header := endpoint.headers[0]
+		assert.Equal(base.JsonContentType, header.Get(base.ContentType))
+		assert.Equal("key", header.Get("X-Api-Key"))
+		request := &http.Request{Header: header}
+		username, password, ok := request.BasicAuth()
+		assert.True(ok)
+		assert.Equal("user", username)
+		assert.Equal("password", password)
+	}
+	endpoint.statusCodes = []int{http.StatusServiceUnavailable, http.StatusConflict, http.StatusBadRequest}
+	endpoint.lock.Unlock()
+
+	// retry status code
+	err = sink.Write(5, []*SinkRecord{record1})
+	assert.NotNil(err)
+	_, ok := err.(*SinkNonRetriableError)
+	assert.False(ok)
+
+	// skip status code
+	assert.Nil(sink.Write(5, []*SinkRecord{record1}))
+
+	// other status codes fail replication without retry
+	err = sink.Write(5, []*SinkRecord{record1})
+	assert.NotNil(err)
+	_, ok = err.(*SinkNonRetriableError)
+	assert.True(ok)
+
+	// failure to get a response is retried
+	server.Close()
+	err = sink.Write(5, []*SinkRecord{record1})
+	assert.NotNil(err)
+	_, ok = err.(*SinkNonRetriableError)
+	assert.False(ok)
+
+	fmt.Println("============== Test case end: TestHttpSink =================")
+}
+
+func TestHttpSinkTLS(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestHttpSinkTLS =================")
+
+	endpoint := &httpSinkEndpoint{}
+	server := httptest.NewTLSServer(endpoint)
+	defer server.Close()
+
+	record, _ := NewSinkRecord(composeSinkTestRequest("doc1", 1, 1, mc.UPR_MUTATION, base.JSONDataType, []byte(`{}`)))
+
+	// certificate of server is not trusted
+	sink, err := NewHttpSink(&SinkParams{Settings: metadata.SinkSettings{Endpoint: server.URL}}, sinkTestLogger)
+	assert.Nil(err)
+	assert.NotNil(sink.Write(1, []*SinkRecord{record}))
+
+	certificate := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	sink, err = NewHttpSink(&SinkParams{Settings: metadata.SinkSettings{Endpoint: server.URL, Certificate: certificate}}, sinkTestLogger)
+	assert.Nil(err)
+	assert.Nil(sink.Write(1, []*SinkRecord{record}))
+
+	_, err = NewHttpSink(&SinkParams{Settings: metadata.SinkSettings{Endpoint: server.URL, Certificate: "invalid"}}, sinkTestLogger)
+	assert.Equal(ErrorHttpSinkInvalidCertificate, err)
+
+	fmt.Println("============== Test case end: TestHttpSinkTLS =================")
+}
@@ -0,0 +1,493 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+// minimal implementation of the kafka wire protocol, covering what is needed to produce records
+package parts
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	KafkaApiKeyProduce  int16 = 0
+	KafkaApiKeyMetadata int16 = 3
+	// used to authenticate with SASL, before any other request is sent on a connection
+	KafkaApiKeySaslHandshake    int16 = 17
+	KafkaApiKeySaslAuthenticate int16 = 36
+
+	// produce v3 is the first version that takes record batches, i.e., message format v2
+	KafkaProduceVersion  int16 = 3
+	KafkaMetadataVersion int16 = 1
+	// handshake v1 has SASL tokens wrapped in SaslAuthenticate requests, instead of sent as raw bytes
+	KafkaSaslHandshakeVersion    int16 = 1
+	KafkaSaslAuthenticateVersion int16 = 0
+
+	KafkaSaslMechanismPlain = "PLAIN"
+
+	// magic byte of record batches, i.e., message format v2
+	KafkaRecordBatchMagic int8 = 2
+
+	// wait for records to be acknowledged by all in-sync replicas
+	KafkaAcksAll int16 = -1
+)
+
+// error codes returned by kafka brokers
+type KafkaErrorCode int16
+
+const (
+	KafkaErrorNone                     KafkaErrorCode = 0
+	KafkaErrorUnknownTopicOrPartition  KafkaErrorCode = 3
+	KafkaErrorLeaderNotAvailable       KafkaErrorCode = 5
+	KafkaErrorNotLeaderForPartition    KafkaErrorCode = 6
+	KafkaErrorRequestTimedOut          KafkaErrorCode = 7
+	KafkaErrorMessageTooLarge          KafkaErrorCode = 10
+	KafkaErrorRecordListTooLarge       KafkaErrorCode = 18
+	KafkaErrorNotEnoughReplicas        KafkaErrorCode = 19
+	KafkaErrorUnsupportedSaslMechanism KafkaErrorCode = 33
+	KafkaErrorIllegalSaslState         KafkaErrorCode = 34
+	KafkaErrorSaslAuthenticationFailed KafkaErrorCode = 58
+)
+
+var kafkaErrorNames = map[KafkaErrorCode]string{
+	KafkaErrorUnknownTopicOrPartition:  "UNKNOWN_TOPIC_OR_PARTITION",
+	KafkaErrorLeaderNotAvailable:       "LEADER_NOT_AVAILABLE",
+	KafkaErrorNotLeaderForPartition:    "NOT_LEADER_FOR_PARTITION",
+	KafkaErrorRequestTimedOut:          "REQUEST_TIMED_OUT",
+	KafkaErrorMessageTooLarge:          "MESSAGE_TOO_LARGE",
+	KafkaErrorRecordListTooLarge:       "RECORD_LIST_TOO_LARGE",
+	KafkaErrorNotEnoughReplicas:        "NOT_ENOUGH_REPLICAS",
+	KafkaErrorUnsupportedSaslMechanism: "UNSUPPORTED_SASL_MECHANISM",
+	KafkaErrorIllegalSaslState:         "ILLEGAL_SASL_STATE",
+	KafkaErrorSaslAuthenticationFailed: "SASL_AUTHENTICATION_FAILED",
+}
+
+func (code KafkaErrorCode) Error() string {
+	if name, ok := kafkaErrorNames[code]; ok {
+		return fmt.Sprintf("kafka error %v (%v)", int16(code), name)
+	}
+	return fmt.Sprintf("kafka error %v", int16(code))
+}
+
+var ErrorKafkaMalformedMessage = errors.New("Malformed kafka message")
+var ErrorKafkaCorrelationIdMismatch = errors.New("Correlation id in kafka response does not match that in request")
+
+var kafkaCrc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaEncoder appends kafka primitive types to a buffer in big endian order
+type kafkaEncoder struct {
+	buf []byte
+}
+
+func (e *kafkaEncoder) putInt8(v int8) {
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *kafkaEncoder) putInt16(v int16) {
+	e.buf = append(e.buf, byte(uint16(v)>>8), byte(v))
+}
+
+func (e *kafkaEncoder) putInt32(v int32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(v))
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *kafkaEncoder) putInt64(v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	e.buf = append(e.buf, b[:]...)
+}
+
+// varints in kafka records are zigzag encoded, same as in encoding/binary
+func (e *kafkaEncoder) putVarint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], v)
+	e.buf = append(e.buf, b[:n]...)
+}
+
+func (e *kafkaEncoder) putString(s string) {
+	e.putInt16(int16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *kafkaEncoder) putNullString() {
+	e.putInt16(-1)
+}
+
+func (e *kafkaEncoder) putBytes(b []byte) {
+	e.putInt32(int32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *kafkaEncoder) putVarintBytes(b []byte) {
+	if b == nil {
+		e.putVarint(-1)
+		return
+	}
+	e.putVarint(int64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *kafkaEncoder) putArrayLength(n int) {
+	e.putInt32(int32(n))
+}
+
+// kafkaDecoder reads kafka primitive types from a buffer.
+// the first error encountered is kept in err and all subsequent reads return zero values
+type kafkaDecoder struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || d.off+n > len(d.buf) {
+		d.err = ErrorKafkaMalformedMessage
+		return nil
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b
+}
+
+func (d *kafkaDecoder) getInt8() int8 {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return int8(b[0])
+}
+
+func (d *kafkaDecoder) getInt16() int16 {
+	b := d.next(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (d *kafkaDecoder) getInt32() int32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (d *kafkaDecoder) getInt64() int64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+// returns empty string for null string
+func (d *kafkaDecoder) getString() string {
+	length := d.getInt16()
+	if length < 0 {
+		return ""
+	}
+	return string(d.next(int(length)))
+}
+
+func (d *kafkaDecoder) getBytes() []byte {
+	length := d.getInt32()
+	if length < 0 {
+		return nil
+	}
+	return d.next(int(length))
+}
+
+func (d *kafkaDecoder) getArrayLength() int {
+	length := d.getInt32()
+	if d.err == nil && (length < -1 || int(length) > len(d.buf)-d.off) {
+		// each element takes at least one byte
+		d.err = ErrorKafkaMalformedMessage
+		return 0
+	}
+	return int(length)
+}
+
+// KafkaRecord is a record produced to kafka
+type KafkaRecord struct {
+	Key     []byte
+	Value   []byte
+	Headers []KafkaRecordHeader
+}
+
+type KafkaRecordHeader struct {
+	Key   string
+	Value []byte
+}
+
+// size of a record batch without its records, i.e., the fields from base offset to the number of records
+const kafkaRecordBatchOverhead = 61
+
+// kafkaRecordMaxSize returns the max size of a record without headers in a record batch.
+// besides key and value, a record has attributes, timestamp delta of 0, and its length, offset delta,
+// key length and value length as varints of at most 5 bytes each, and a header count of 0
+func kafkaRecordMaxSize(record *KafkaRecord) int {
+	return len(record.Key) + len(record.Value) + 23
+}
+
+// encodeKafkaRecordBatch encodes records into a record batch of message format v2
+func encodeKafkaRecordBatch(records []*KafkaRecord, timestamp time.Time) []byte {
+	timestampMs := timestamp.UnixNano() / int64(time.Millisecond)
+
+	// the part of the batch that is covered by crc
+	body := &kafkaEncoder{}
+	// attributes - no compression, create time, not transactional
+	body.putInt16(0)
+	// last offset delta
+	body.putInt32(int32(len(records) - 1))
+	// base timestamp and max timestamp
+	body.putInt64(timestampMs)
+	body.putInt64(timestampMs)
+	// producer id, producer epoch and base sequence. not an idempotent producer
+	body.putInt64(-1)
+	body.putInt16(-1)
+	body.putInt32(-1)
+	body.putArrayLength(len(records))
+	for index, record := range records {
+		recordEncoder := &kafkaEncoder{}
+		// attributes
+		recordEncoder.putInt8(0)
+		// timestamp delta
+		recordEncoder.putVarint(0)
+		// offset delta
+		recordEncoder.putVarint(int64(index))
+		recordEncoder.putVarintBytes(record.Key)
+		recordEncoder.putVarintBytes(record.Value)
+		recordEncoder.putVarint(int64(len(record.Headers)))
+		for _, header := range record.Headers {
+			recordEncoder.putVarintBytes([]byte(header.Key))
+			recordEncoder.putVarintBytes(header.Value)
+		}
+		body.putVarint(int64(len(recordEncoder.buf)))
+		body.buf = append(body.buf, recordEncoder.buf...)
+	}
+
+	batch := &kafkaEncoder{buf: make([]byte, 0, len(body.buf)+21)}
+	// base offset. assigned by broker
+	batch.putInt64(0)
+	// batch length, which covers everything after itself
+	batch.putInt32(int32(4 + 1 + 4 + len(body.buf)))
+	// partition leader epoch. set by broker
+	batch.putInt32(-1)
+	batch.putInt8(KafkaRecordBatchMagic)
+	batch.putInt32(int32(crc32.Checksum(body.buf, kafkaCrc32cTable)))
+	batch.buf = append(batch.buf, body.buf...)
+	return batch.buf
+}
+
+// encodeKafkaRequest prefixes request body with size and request header v1
+func encodeKafkaRequest(apiKey, apiVersion int16, correlationId int32, clientId string, body []byte) []byte {
+	header := &kafkaEncoder{}
+	header.putInt16(apiKey)
+	header.putInt16(apiVersion)
+	header.putInt32(correlationId)
+	header.putString(clientId)
+
+	request := &kafkaEncoder{buf: make([]byte, 0, 4+len(header.buf)+len(body))}
+	request.putInt32(int32(len(header.buf) + len(body)))
+	request.buf = append(request.buf, header.buf...)
+	request.buf = append(request.buf, body...)
+	return request.buf
+}
+
+// readKafkaMessage reads a size delimited request or response
+func readKafkaMessage(reader io.Reader) ([]byte, error) {
+	var sizeBytes [4]byte
+	_, err := io.ReadFull(reader, sizeBytes[:])
+	if err != nil {
+		return nil, err
+	}
+	size := int32(binary.BigEndian.Uint32(sizeBytes[:]))
+	if size < 0 {
+		return nil, ErrorKafkaMalformedMessage
+	}
+	message := make([]byte, size)
+	_, err = io.ReadFull(reader, message)
+	return message, err
+}
+
+// kafkaProducePartition is the data produced to one partition in a produce request
+type kafkaProducePartition struct {
+	topic     string
+	partition int32
+	records   []byte
+}
+
+func encodeKafkaProduceRequestBody(acks int16, timeout time.Duration, partitionData *kafkaProducePartition) []byte {
+	body := &kafkaEncoder{}
+	// transactional id
+	body.putNullString()
+	body.putInt16(acks)
+	body.putInt32(int32(timeout / time.Millisecond))
+	// one topic with one partition
+	body.putArrayLength(1)
+	body.putString(partitionData.topic)
+	body.putArrayLength(1)
+	body.putInt32(partitionData.partition)
+	body.putBytes(partitionData.records)
+	return body.buf
+}
+
+// kafkaProduceResult is the result of producing to one partition, as reported in produce response
+type kafkaProduceResult struct {
+	topic      string
+	partition  int32
+	errorCode  KafkaErrorCode
+	baseOffset int64
+}
+
+func decodeKafkaProduceResponseBody(body []byte) ([]*kafkaProduceResult, error) {
+	results := make([]*kafkaProduceResult, 0)
+	decoder := &kafkaDecoder{buf: body}
+	numOfTopics := decoder.getArrayLength()
+	for i := 0; i < numOfTopics && decoder.err == nil; i++ {
+		topic := decoder.getString()
+		numOfPartitions := decoder.getArrayLength()
+		for j := 0; j < numOfPartitions && decoder.err == nil; j++ {
+			result := &kafkaProduceResult{topic: topic}
+			result.partition = decoder.getInt32()
+			result.errorCode = KafkaErrorCode(decoder.getInt16())
+			result.baseOffset = decoder.getInt64()
+			// log append time
+			decoder.getInt64()
+			results = append(results, result)
+		}
+	}
+	return results, decoder.err
+}
+
+func encodeKafkaMetadataRequestBody(topics []string) []byte {
+	body := &kafkaEncoder{}
+	body.putArrayLength(len(topics))
+	for _, topic := range topics {
+		body.putString(topic)
+	}
+	return body.buf
+}
+
+type kafkaBroker struct {
+	nodeId int32
+	host   string
+	port   int32
+}
+
+func (broker *kafkaBroker) addr() string {
+	return net.JoinHostPort(broker.host, fmt.Sprintf("%v", broker.port))
+}
+
+type kafkaPartitionMetadata struct {
+	errorCode KafkaErrorCode
+	partition int32
+	leader    int32
+}
+
+type kafkaTopicMetadata struct {
+	errorCode  KafkaErrorCode
+	topic      string
+	partitions []*kafkaPartitionMetadata
+}
+
+func decodeKafkaMetadataResponseBody(body []byte) ([]*kafkaBroker, []*kafkaTopicMetadata, error) {
+	decoder := &kafkaDecoder{buf: body}
+	brokers := make([]*kafkaBroker, 0)
+	numOfBrokers := decoder.getArrayLength()
+	for i := 0; i < numOfBrokers && decoder.err == nil; i++ {
+		broker := &kafkaBroker{}
+		broker.nodeId = decoder.getInt32()
+		broker.host = decoder.getString()
+		broker.port = decoder.getInt32()
+		// rack
+		decoder.getString()
+		brokers = append(brokers, broker)
+	}
+	// controller id
+	decoder.getInt32()
+	topics := make([]*kafkaTopicMetadata, 0)
+	numOfTopics := decoder.getArrayLength()
+	for i := 0; i < numOfTopics && decoder.err == nil; i++ {
+		topic := &kafkaTopicMetadata{}
+		topic.errorCode = KafkaErrorCode(decoder.getInt16())
+		topic.topic = decoder.getString()
+		// is internal
+		decoder.getInt8()
+		numOfPartitions := decoder.getArrayLength()
+		for j := 0; j < numOfPartitions && decoder.err == nil; j++ {
+			partition := &kafkaPartitionMetadata{}
+			partition.errorCode = KafkaErrorCode(decoder.getInt16())
+			partition.partition = decoder.getInt32()
+			partition.leader = decoder.getInt32()
+			// replicas and in-sync replicas
+			for k := 0; k < 2 && decoder.err == nil; k++ {
+				numOfReplicas := decoder.getArrayLength()
+				decoder.next(4 * numOfReplicas)
+			}
+			topic.partitions = append(topic.partitions, partition)
+		}
+		topics = append(topics, topic)
+	}
+	return brokers, topics, decoder.err
+}
+
+func encodeKafkaSaslHandshakeRequestBody(mechanism string) []byte {
+	body := &kafkaEncoder{}
+	body.putString(mechanism)
+	return body.buf
+}
+
+// returns error code and the mechanisms enabled on broker
+func decodeKafkaSaslHandshakeResponseBody(body []byte) (KafkaErrorCode, []string, error) {
+	decoder := &kafkaDecoder{buf: body}
+	errorCode := KafkaErrorCode(decoder.getInt16())
+	numOfMechanisms := decoder.getArrayLength()
+	mechanisms := make([]string, 0)
+	for i := 0; i < numOfMechanisms && decoder.err == nil; i++ {
+		mechanisms = append(mechanisms, decoder.getString())
+	}
+	return errorCode, mechanisms, decoder.err
+}
+
+func encodeKafkaSaslAuthenticateRequestBody(authBytes []byte) []byte {
+	body := &kafkaEncoder{}
+	body.putBytes(authBytes)
+	return body.buf
+}
+
+// returns error code and error message. auth bytes returned by broker are not needed by PLAIN mechanism
+func decodeKafkaSaslAuthenticateResponseBody(body []byte) (KafkaErrorCode, string, error) {
+	decoder := &kafkaDecoder{buf: body}
+	errorCode := KafkaErrorCode(decoder.getInt16())
+	errorMessage := decoder.getString()
+	decoder.getBytes()
+	return errorCode, errorMessage, decoder.err
+}
+
+// kafkaSaslPlainToken composes the token of PLAIN mechanism, as defined in RFC 4616, with empty authorization identity
+func kafkaSaslPlainToken(username, password string) []byte {
+	token := make([]byte, 0, len(username)+len(password)+2)
+	token = append(token, 0)
+	token = append(token, username...)
+	token = append(token, 0)
+	token = append(token, password...)
+	return token
+}
@@ -0,0 +1,197 @@
+// +build !pcre
+
+package parts
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"hash/crc32"
+	"testing"
+	"time"
+)
+
+// broker side of the kafka wire protocol, used by fake kafka broker in tests
+
+func (d *kafkaDecoder) getVarint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf[d.off:])
+	if n <= 0 {
+		d.err = ErrorKafkaMalformedMessage
+		return 0
+	}
+	d.off += n
+	return v
+}
+
+func (d *kafkaDecoder) getVarintBytes() []byte {
+	length := d.getVarint()
+	if length < 0 {
+		return nil
+	}
+	return d.next(int(length))
+}
+
+// decodeKafkaRecordBatches decodes the record batches in the records field of produce requests
+func decodeKafkaRecordBatches(data []byte) ([]*KafkaRecord, error) {
+	records := make([]*KafkaRecord, 0)
+	decoder := &kafkaDecoder{buf: data}
+	for decoder.remaining() > 0 && decoder.err == nil {
+		// base offset
+		decoder.getInt64()
+		batchLength := decoder.getInt32()
+		batchDecoder := &kafkaDecoder{buf: decoder.next(int(batchLength))}
+		if decoder.err != nil {
+			return nil, decoder.err
+		}
+		// partition leader epoch
+		batchDecoder.getInt32()
+		if magic := batchDecoder.getInt8(); batchDecoder.err == nil && magic != KafkaRecordBatchMagic {
+			return nil, fmt.Errorf("Unsupported kafka message format. magic=%v", magic)
+		}
+		crc := uint32(batchDecoder.getInt32())
+		if batchDecoder.err == nil && crc != crc32.Checksum(batchDecoder.buf[batchDecoder.off:], kafkaCrc32cTable) {
+			return nil, fmt.Errorf("Crc mismatch in kafka record batch")
+		}
+		// attributes, last offset delta, base timestamp, max timestamp, producer id, producer epoch and base sequence
+		batchDecoder.next(2 + 4 + 8 + 8 + 8 + 2 + 4)
+		numOfRecords := batchDecoder.getArrayLength()
+		for i := 0; i < numOfRecords && batchDecoder.err == nil; i++ {
+			recordDecoder := &kafkaDecoder{buf: batchDecoder.next(int(batchDecoder.getVarint()))}
+			if batchDecoder.err != nil {
+				break
+			}
+			// attributes, timestamp delta and offset delta
+			recordDecoder.getInt8()
+			recordDecoder.getVarint()
+			recordDecoder.getVarint()
+			record := &KafkaRecord{
+				Key:   recordDecoder.getVarintBytes(),
+				Value: recordDecoder.getVarintBytes(),
+			}
+			numOfHeaders := int(recordDecoder.getVarint())
+			for j := 0; j < numOfHeaders && recordDecoder.err == nil; j++ {
+				record.Headers = append(record.Headers, KafkaRecordHeader{Key: string(recordDecoder.getVarintBytes()), Value: recordDecoder.getVarintBytes()})
+			}
+			if recordDecoder.err != nil {
+				return nil, recordDecoder.err
+			}
+			records = append(records, record)
+		}
+		if batchDecoder.err != nil {
+			return nil, batchDecoder.err
+		}
+	}
+	return records, decoder.err
+}
+
+func decodeKafkaProduceRequestBody(body []byte) (acks int16, partitions []*kafkaProducePartition, err error) {
+	decoder := &kafkaDecoder{buf: body}
+	decoder.getString()
+	acks = decoder.getInt16()
+	decoder.getInt32()
+	numOfTopics := decoder.getArrayLength()
+	for i := 0; i < numOfTopics && decoder.err == nil; i++ {
+		topic := decoder.getString()
+		numOfPartitions := decoder.getArrayLength()
+		for j := 0; j < numOfPartitions && decoder.err == nil; j++ {
+			partitions = append(partitions, &kafkaProducePartition{topic: topic, partition: decoder.getInt32(), records: decoder.getBytes()})
+		}
+	}
+	return acks, partitions, decoder.err
+}
+
+func encodeKafkaProduceResponseBody(results []*kafkaProduceResult) []byte {
+	body := &kafkaEncoder{}
+	body.putArrayLength(len(results))
+	for _, result := range results {
+		body.putString(result.topic)
+		body.putArrayLength(1)
+		body.putInt32(result.partition)
+		body.putInt16(int16(result.errorCode))
+		body.putInt64(result.baseOffset)
+		// log append time
+		body.putInt64(-1)
+	}
+	// throttle time
+	body.putInt32(0)
+	return body.buf
+}
+
+func decodeKafkaMetadataRequestBody(body []byte) ([]string, error) {
+	decoder := &kafkaDecoder{buf: body}
+	numOfTopics := decoder.getArrayLength()
+	topics := make([]string, 0)
+	for i := 0; i < numOfTopics && decoder.err == nil; i++ {
+		topics = append(topics, decoder.getString())
+	}
+	return topics, decoder.err
+}
+
+func encodeKafkaMetadataResponseBody(brokers []*kafkaBroker, topics []*kafkaTopicMetadata) []byte {
+	body := &kafkaEncoder{}
+	body.putArrayLength(len(brokers))
+	for _, broker := range brokers {
+		body.putInt32(broker.nodeId)
+		body.putString(broker.host)
+		body.putInt32(broker.port)
+		// rack
+		body.putNullString()
+	}
+	// controller id
+	body.putInt32(-1)
+	body.putArrayLength(len(topics))
+	for _, topic := range topics {
+		body.putInt16(int16(topic.errorCode))
+		body.putString(topic.topic)
+		// is internal
+		body.putInt8(0)
+		body.putArrayLength(len(topic.partitions))
+		for _, partition := range topic.partitions {
+			body.putInt16(int16(partition.errorCode))
+			body.putInt32(partition.partition)
+			body.putInt32(partition.leader)
+			// replicas and in-sync replicas
+			body.putArrayLength(1)
+			body.putInt32(partition.leader)
+			body.putArrayLength(1)
+			body.putInt32(partition.leader)
+		}
+	}
+	return body.buf
+}
+func (d *kafkaDecoder) remaining() int {
+	return len(d.buf) - d.off
+}
+
+func TestKafkaRecordBatch(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestKafkaRecordBatch =================")
+
+	records := []*KafkaRecord{
+		{Key: []byte("doc1"), Value: []byte(`{"a":1}`)},
+		{Key: []byte("doc2"), Value: nil, Headers: []KafkaRecordHeader{{Key: "deleted", Value: []byte("true")}}},
+	}
+	batch := encodeKafkaRecordBatch(records, time.Now())
+	decoded, err := decodeKafkaRecordBatches(batch)
+	assert.Nil(err)
+	assert.Equal(records, decoded)
+
+	// size of batch of records without headers stays within their max sizes
+	records = []*KafkaRecord{{Key: []byte("doc1"), Value: []byte(`{"a":1}`)}, {Key: []byte("doc2"), Value: make([]byte, 1000)}}
+	assert.True(len(encodeKafkaRecordBatch(records, time.Now())) <= kafkaRecordBatchOverhead+kafkaRecordMaxSize(records[0])+kafkaRecordMaxSize(records[1]))
+	assert.Equal(kafkaRecordBatchOverhead, len(encodeKafkaRecordBatch(nil, time.Now())))
+
+	// corrupted batch fails crc check
+	batch[len(batch)-1]++
+	_, err = decodeKafkaRecordBatches(batch)
+	assert.NotNil(err)
+
+	// truncated batch
+	_, err = decodeKafkaRecordBatches(batch[:len(batch)-5])
+	assert.Equal(ErrorKafkaMalformedMessage, err)
+
+	fmt.Println("============== Test case end: TestKafkaRecordBatch =================")
+}
@@ -0,0 +1,372 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+// defines the kafka sink, which produces mutations as records to a kafka compatible broker
+package parts
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/log"
+	"net"
+	"time"
+)
+
+var ErrorKafkaInvalidCertificate = errors.New("Certificate of kafka brokers is not a valid PEM encoded certificate")
+
+// KafkaSink produces mutations in a vbucket as records to a partition of the topic named after target bucket.
+// The partition of a vbucket is vbno % <number of partitions of topic>, so that mutations in the same vbucket
+// stay in order. Record key is document key, and record value is the json form of SinkRecord,
+// where deletions and expirations have deleted set to true.
+// Write returns only after records have been acknowledged by all in-sync replicas, so that
+// only acknowledged mutations are checkpointed.
+// The sink connects with the sink settings of the replication:
+// 1. endpoint - comma separated host:port of bootstrap brokers
+// 2. tls and certificate - whether connections use TLS, and the certificates that brokers are verified against
+// 3. username and password - credentials for SASL PLAIN authentication, which should be used together with TLS,
+// since PLAIN sends password in clear text
+// 4. kafka max request bytes - max size of the records in each produce request, which needs to be within the
+// message.max.bytes of brokers. Records of a Write are split into as many produce requests as needed, and
+// documents too large for a single produce request fail the replication
+type KafkaSink struct {
+	bootstrapBrokers []string
+	topic            string
+	// nil when TLS is not used
+	tlsConfig *tls.Config
+	username  string
+	password  string
+	// max size of the record batch in each produce request
+	maxRequestBytes int
+
+	// leader of each partition of topic, as node ids of brokers
+	partitionLeaders []int32
+	brokerAddrs      map[int32]string
+	// set when produce fails, to have metadata refreshed before the next produce
+	metadataStale bool
+
+	conns         map[string]net.Conn
+	correlationId int32
+	logger        *log.CommonLogger
+}
+
+// NewKafkaSink is the SinkConstructor of kafka sink
+func NewKafkaSink(params *SinkParams, logger *log.CommonLogger) (Sink, error) {
+	brokers, err := params.Settings.KafkaBrokers()
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	if params.Settings.TLS {
+		tlsConfig = &tls.Config{}
+		if len(params.Settings.Certificate) > 0 {
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM([]byte(params.Settings.Certificate)) {
+				return nil, ErrorKafkaInvalidCertificate
+			}
+		}
+	}
+
+	return &KafkaSink{
+		bootstrapBrokers: brokers,
+		topic:            params.TargetBucketName,
+		tlsConfig:        tlsConfig,
+		username:         params.Settings.Username,
+		password:         params.Settings.Password,
+		maxRequestBytes:  params.Settings.KafkaMaxRequestBytesOrDefault(),
+		brokerAddrs:      make(map[int32]string),
+		conns:            make(map[string]net.Conn),
+		logger:           logger,
+	}, nil
+}
+
+func (sink *KafkaSink) Open() error {
+	return sink.refreshMetadata()
+}
+
+func (sink *KafkaSink) Write(vbno uint16, records []*SinkRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	if sink.metadataStale || len(sink.partitionLeaders) == 0 {
+		err := sink.refreshMetadata()
+		if err != nil {
+			return err
+		}
+	}
+
+	partition := int32(vbno) % int32(len(sink.partitionLeaders))
+	leaderAddr, ok := sink.brokerAddrs[sink.partitionLeaders[partition]]
+	if !ok {
+		sink.metadataStale = true
+		return fmt.Errorf("Leader of partition %v of kafka topic %v is not available", partition, sink.topic)
+	}
+
+	kafkaRecords := make([]*KafkaRecord, 0, len(records))
+	for _, record := range records {
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		kafkaRecord := &KafkaRecord{Key: []byte(record.Key), Value: value}
+		// brokers would reject the record no matter how many times it is produced
+		if kafkaRecordBatchOverhead+kafkaRecordMaxSize(kafkaRecord) > sink.maxRequestBytes {
+			return &SinkNonRetriableError{fmt.Errorf("Document %v%s%v in vb %v is %v bytes as kafka record, which exceeds the max request size of %v bytes of kafka sink",
+				base.UdTagBegin, record.Key, base.UdTagEnd, vbno, kafkaRecordMaxSize(kafkaRecord), sink.maxRequestBytes)}
+		}
+		kafkaRecords = append(kafkaRecords, kafkaRecord)
+	}
+
+	// records are split into produce requests whose record batches stay within max request size
+	for len(kafkaRecords) > 0 {
+		count, batchSize := 0, kafkaRecordBatchOverhead
+		for count < len(kafkaRecords) && batchSize+kafkaRecordMaxSize(kafkaRecords[count]) <= sink.maxRequestBytes {
+			batchSize += kafkaRecordMaxSize(kafkaRecords[count])
+			count++
+		}
+		err := sink.produce(leaderAddr, partition, kafkaRecords[:count])
+		if err != nil {
+			return err
+		}
+		kafkaRecords = kafkaRecords[count:]
+	}
+	return nil
+}
+
+// produce produces records to partition in one produce request, and returns after they have been acknowledged
+func (sink *KafkaSink) produce(leaderAddr string, partition int32, kafkaRecords []*KafkaRecord) error {
+	partitionData := &kafkaProducePartition{
+		topic:     sink.topic,
+		partition: partition,
+		records:   encodeKafkaRecordBatch(kafkaRecords, time.Now()),
+	}
+	responseBody, err := sink.roundTrip(leaderAddr, KafkaApiKeyProduce, KafkaProduceVersion,
+		encodeKafkaProduceRequestBody(KafkaAcksAll, base.KafkaRequestTimeout, partitionData))
+	if err != nil {
+		sink.metadataStale = true
+		return err
+	}
+
+	results, err := decodeKafkaProduceResponseBody(responseBody)
+	if err != nil {
+		sink.closeConn(leaderAddr)
+		return err
+	}
+	for _, result := range results {
+		if result.topic == sink.topic && result.partition == partition {
+			switch result.errorCode {
+			case KafkaErrorNone:
+				return nil
+			case KafkaErrorMessageTooLarge, KafkaErrorRecordListTooLarge:
+				// the same records would be rejected again. max request size of sink needs to be lowered
+				// to within the message.max.bytes of brokers and max.message.bytes of topic
+				return &SinkNonRetriableError{fmt.Errorf("Kafka broker %v rejected %v records of %v bytes produced to partition %v of topic %v. Max request size of kafka sink may need to be lowered. err=%v",
+					leaderAddr, len(kafkaRecords), len(partitionData.records), partition, sink.topic, result.errorCode)}
+			default:
+				// most errors, e.g., NOT_LEADER_FOR_PARTITION, are resolved by refreshing metadata
+				sink.metadataStale = true
+				return fmt.Errorf("Error producing to partition %v of kafka topic %v. err=%v", partition, sink.topic, result.errorCode)
+			}
+		}
+	}
+	sink.closeConn(leaderAddr)
+	return fmt.Errorf("Produce response from kafka broker %v does not contain partition %v of topic %v", leaderAddr, partition, sink.topic)
+}
+
+func (sink *KafkaSink) Close() error {
+	for addr := range sink.conns {
+		sink.closeConn(addr)
+	}
+	return nil
+}
+
+// refreshMetadata retrieves brokers and partition leaders of topic from the first broker that responds,
+// trying known brokers before the bootstrap ones
+func (sink *KafkaSink) refreshMetadata() error {
+	addrs := make([]string, 0, len(sink.brokerAddrs)+len(sink.bootstrapBrokers))
+	for _, addr := range sink.brokerAddrs {
+		addrs = append(addrs, addr)
+	}
+	addrs = append(addrs, sink.bootstrapBrokers...)
+
+	var err error
+	for _, addr := range addrs {
+		err = sink.refreshMetadataFromBroker(addr)
+		if err == nil {
+			sink.metadataStale = false
+			return nil
+		}
+		sink.logger.Warnf("Failed to retrieve metadata of kafka topic %v from broker %v. err=%v", sink.topic, addr, err)
+	}
+	return err
+}
+
+func (sink *KafkaSink) refreshMetadataFromBroker(addr string) error {
+	responseBody, err := sink.roundTrip(addr, KafkaApiKeyMetadata, KafkaMetadataVersion, encodeKafkaMetadataRequestBody([]string{sink.topic}))
+	if err != nil {
+		return err
+	}
+	brokers, topics, err := decodeKafkaMetadataResponseBody(responseBody)
+	if err != nil {
+		sink.closeConn(addr)
+		return err
+	}
+
+	for _, topic := range topics {
+		if topic.topic != sink.topic {
+			continue
+		}
+		if topic.errorCode != KafkaErrorNone {
+			return topic.errorCode
+		}
+		if len(topic.partitions) == 0 {
+			return fmt.Errorf("Kafka topic %v has no partitions", sink.topic)
+		}
+		partitionLeaders := make([]int32, len(topic.partitions))
+		for _, partition := range topic.partitions {
+			if partition.partition < 0 || int(partition.partition) >= len(partitionLeaders) {
+				return fmt.Errorf("Invalid partition %v in metadata of kafka topic %v", partition.partition, sink.topic)
+			}
+			partitionLeaders[partition.partition] = partition.leader
+		}
+
+		brokerAddrs := make(map[int32]string)
+		for _, broker := range brokers {
+			brokerAddrs[broker.nodeId] = broker.addr()
+		}
+		// close connections to brokers that have left
+		for connAddr := range sink.conns {
+			found := false
+			for _, brokerAddr := range brokerAddrs {
+				if brokerAddr == connAddr {
+					found = true
+					break
+				}
+			}
+			if !found && connAddr != addr {
+				sink.closeConn(connAddr)
+			}
+		}
+
+		sink.partitionLeaders = partitionLeaders
+		sink.brokerAddrs = brokerAddrs
+		return nil
+	}
+	return fmt.Errorf("Metadata of kafka topic %v is not returned by broker %v", sink.topic, addr)
+}
+
+// roundTrip sends a request to the broker at addr and returns the body of its response.
+// the connection to the broker is closed on error, and will be re-established by the next request
+func (sink *KafkaSink) roundTrip(addr string, apiKey, apiVersion int16, requestBody []byte) ([]byte, error) {
+	conn, err := sink.getConn(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	responseBody, err := sink.send(conn, apiKey, apiVersion, requestBody)
+	if err != nil {
+		sink.closeConn(addr)
+		return nil, err
+	}
+	return responseBody, nil
+}
+
+// send sends a request on conn and returns the body of its response
+func (sink *KafkaSink) send(conn net.Conn, apiKey, apiVersion int16, requestBody []byte) ([]byte, error) {
+	sink.correlationId++
+	correlationId := sink.correlationId
+	request := encodeKafkaRequest(apiKey, apiVersion, correlationId, base.KafkaClientId, requestBody)
+
+	conn.SetDeadline(time.Now().Add(base.KafkaRequestTimeout))
+	_, err := conn.Write(request)
+	if err != nil {
+		return nil, err
+	}
+	response, err := readKafkaMessage(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := &kafkaDecoder{buf: response}
+	if decoder.getInt32() != correlationId || decoder.err != nil {
+		return nil, ErrorKafkaCorrelationIdMismatch
+	}
+	return response[decoder.off:], nil
+}
+
+func (sink *KafkaSink) getConn(addr string) (net.Conn, error) {
+	if conn, ok := sink.conns[addr]; ok {
+		return conn, nil
+	}
+
+	var conn net.Conn
+	var err error
+	if sink.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: base.KafkaDialTimeout}, "tcp", addr, sink.tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, base.KafkaDialTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sink.username) > 0 {
+		err = sink.authenticate(conn)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Failed to authenticate with kafka broker %v. err=%v", addr, err)
+		}
+	}
+	sink.conns[addr] = conn
+	return conn, nil
+}
+
+// authenticate authenticates a new connection with SASL PLAIN mechanism
+func (sink *KafkaSink) authenticate(conn net.Conn) error {
+	responseBody, err := sink.send(conn, KafkaApiKeySaslHandshake, KafkaSaslHandshakeVersion, encodeKafkaSaslHandshakeRequestBody(KafkaSaslMechanismPlain))
+	if err != nil {
+		return err
+	}
+	errorCode, mechanisms, err := decodeKafkaSaslHandshakeResponseBody(responseBody)
+	if err != nil {
+		return err
+	}
+	if errorCode != KafkaErrorNone {
+		return fmt.Errorf("%v. mechanisms enabled on broker: %v", errorCode, mechanisms)
+	}
+
+	responseBody, err = sink.send(conn, KafkaApiKeySaslAuthenticate, KafkaSaslAuthenticateVersion,
+		encodeKafkaSaslAuthenticateRequestBody(kafkaSaslPlainToken(sink.username, sink.password)))
+	if err != nil {
+		return err
+	}
+	errorCode, errorMessage, err := decodeKafkaSaslAuthenticateResponseBody(responseBody)
+	if err != nil {
+		return err
+	}
+	if errorCode != KafkaErrorNone {
+		return fmt.Errorf("%v. %v", errorCode, errorMessage)
+	}
+	return nil
+}
+
+func (sink *KafkaSink) closeConn(addr string) {
+	if conn, ok := sink.conns[addr]; ok {
+		err := conn.Close()
+		if err != nil {
+			sink.logger.Warnf("Error closing connection to kafka broker %v. err=%v", addr, err)
+		}
+		delete(sink.conns, addr)
+	}
+}
@@ -0,0 +1,386 @@
+// +build !pcre
+
+package parts
+
+import (
+	"encoding/json"
+	"fmt"
+	mc "github.com/couchbase/gomemcached"
+	base "github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/metadata"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// in-process kafka broker that leads all partitions of all topics and keeps produced records in memory
+type fakeKafkaBroker struct {
+	listener        net.Listener
+	numOfPartitions int32
+
+	lock    sync.Mutex
+	records map[int32][]*KafkaRecord
+	// error codes to return for the next produce requests
+	produceErrors []KafkaErrorCode
+	acks          []int16
+	numOfMetadata int
+	// when set, connections need to be authenticated with SASL PLAIN mechanism before other requests
+	saslToken []byte
+}
+
+func newFakeKafkaBroker(numOfPartitions int32) (*fakeKafkaBroker, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	broker := &fakeKafkaBroker{
+		listener:        listener,
+		numOfPartitions: numOfPartitions,
+		records:         make(map[int32][]*KafkaRecord),
+	}
+	go broker.serve()
+	return broker, nil
+}
+
+func (broker *fakeKafkaBroker) addr() string {
+	return broker.listener.Addr().String()
+}
+
+func (broker *fakeKafkaBroker) close() {
+	broker.listener.Close()
+}
+
+func (broker *fakeKafkaBroker) serve() {
+	for {
+		conn, err := broker.listener.Accept()
+		if err != nil {
+			return
+		}
+		go broker.handleConn(conn)
+	}
+}
+
+func (broker *fakeKafkaBroker) handleConn(conn net.Conn) {
+	defer conn.Close()
+	broker.lock.Lock()
+	authenticated := broker.saslToken == nil
+	broker.lock.Unlock()
+	for {
+		request, err := readKafkaMessage(conn)
+		if err != nil {
+			return
+		}
+		decoder := &kafkaDecoder{buf: request}
+		apiKey := decoder.getInt16()
+		decoder.getInt16()
+		correlationId := decoder.getInt32()
+		decoder.getString()
+		if decoder.err != nil {
+			return
+		}
+
+		var responseBody []byte
+		if !authenticated && apiKey != KafkaApiKeySaslHandshake && apiKey != KafkaApiKeySaslAuthenticate {
+			// brokers close unauthenticated connections on other requests
+			return
+		}
+		switch apiKey {
+		case KafkaApiKeySaslHandshake:
+			responseBody = broker.handleSaslHandshake(request[decoder.off:])
+		case KafkaApiKeySaslAuthenticate:
+			responseBody, authenticated = broker.handleSaslAuthenticate(request[decoder.off:])
+		case KafkaApiKeyMetadata:
+			responseBody, err = broker.handleMetadata(request[decoder.off:])
+		case KafkaApiKeyProduce:
+			responseBody, err = broker.handleProduce(request[decoder.off:])
+		default:
+			err = fmt.Errorf("unsupported api key %v", apiKey)
+		}
+		if err != nil {
+			return
+		}
+
+		response := &kafkaEncoder{}
+		response.putInt32(int32(4 + len(responseBody)))
+		response.putInt32(correlationId)
+		response.buf = append(response.buf, responseBody...)
+		_, err = conn.Write(response.buf)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (broker *fakeKafkaBroker) handleSaslHandshake(body []byte) []byte {
+	decoder := &kafkaDecoder{buf: body}
+	response := &kafkaEncoder{}
+	if decoder.getString() == KafkaSaslMechanismPlain {
+		response.putInt16(int16(KafkaErrorNone))
+	} else {
+		response.putInt16(int16(KafkaErrorUnsupportedSaslMechanism))
+	}
+	response.putArrayLength(1)
+	response.putString(KafkaSaslMechanismPlain)
+	return response.buf
+}
+
+// returns response body and whether authentication succeeded
+func (broker *fakeKafkaBroker) handleSaslAuthenticate(body []byte) ([]byte, bool) {
+	decoder := &kafkaDecoder{buf: body}
+	token := decoder.getBytes()
+	broker.lock.Lock()
+	authenticated := decoder.err == nil && string(token) == string(broker.saslToken)
+	broker.lock.Unlock()
+
+	response := &kafkaEncoder{}
+	if authenticated {
+		response.putInt16(int16(KafkaErrorNone))
+		response.putNullString()
+	} else {
+		response.putInt16(int16(KafkaErrorSaslAuthenticationFailed))
+		response.putString("Invalid username or password")
+	}
+	response.putBytes(nil)
+	return response.buf, authenticated
+}
+
+func (broker *fakeKafkaBroker) handleMetadata(body []byte) ([]byte, error) {
+	topics, err := decodeKafkaMetadataRequestBody(body)
+	if err != nil {
+		return nil, err
+	}
+	broker.lock.Lock()
+	broker.numOfMetadata++
+	broker.lock.Unlock()
+
+	host, portStr, _ := net.SplitHostPort(broker.addr())
+	port, _ := strconv.Atoi(portStr)
+	topicsMetadata := make([]*kafkaTopicMetadata, 0)
+	for _, topic := range topics {
+		topicMetadata := &kafkaTopicMetadata{topic: topic}
+		for i := int32(0); i < broker.numOfPartitions; i++ {
+			topicMetadata.partitions = append(topicMetadata.partitions, &kafkaPartitionMetadata{partition: i, leader: 1})
+		}
+		topicsMetadata = append(topicsMetadata, topicMetadata)
+	}
+	return encodeKafkaMetadataResponseBody([]*kafkaBroker{{nodeId: 1, host: host, port: int32(port)}}, topicsMetadata), nil
+}
+
+func (broker *fakeKafkaBroker) handleProduce(body []byte) ([]byte, error) {
+	acks, partitions, err := decodeKafkaProduceRequestBody(body)
+	if err != nil {
+		return nil, err
+	}
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+	broker.acks = append(broker.acks, acks)
+
+	results := make([]*kafkaProduceResult, 0, len(partitions))
+	for _, partitionData := range partitions {
+		result := &kafkaProduceResult{topic: partitionData.topic, partition: partitionData.partition}
+		if len(broker.produceErrors) > 0 {
+			result.errorCode = broker.produceErrors[0]
+			broker.produceErrors = broker.produceErrors[1:]
+		} else {
+			records, err := decodeKafkaRecordBatches(partitionData.records)
+			if err != nil {
+				return nil, err
+			}
+			result.baseOffset = int64(len(broker.records[partitionData.partition]))
+			broker.records[partitionData.partition] = append(broker.records[partitionData.partition], records...)
+		}
+		results = append(results, result)
+	}
+	return encodeKafkaProduceResponseBody(results), nil
+}
+
+func TestKafkaSink(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestKafkaSink =================")
+
+	// brokers need to be specified in sink endpoint
+	_, err := NewKafkaSink(&SinkParams{TargetBucketName: "target"}, sinkTestLogger)
+	assert.NotNil(err)
+
+	broker, err := newFakeKafkaBroker(4)
+	assert.Nil(err)
+	defer broker.close()
+
+	sink, err := NewKafkaSink(&SinkParams{TargetBucketName: "target", Settings: metadata.SinkSettings{Endpoint: broker.addr()}}, sinkTestLogger)
+	assert.Nil(err)
+	assert.Nil(sink.Open())
+	defer sink.Close()
+
+	for vbno := uint16(0); vbno < 6; vbno++ {
+		record1, _ := NewSinkRecord(composeSinkTestRequest(fmt.Sprintf("doc%v_1", vbno), vbno, 1, mc.UPR_MUTATION, base.JSONDataType, []byte(`{"a":1}`)))
+		record2, _ := NewSinkRecord(composeSinkTestRequest(fmt.Sprintf("doc%v_2", vbno), vbno, 2, mc.UPR_DELETION, 0, nil))
+		assert.Nil(sink.Write(vbno, []*SinkRecord{record1, record2}))
+	}
+
+	broker.lock.Lock()
+	for _, acks := range broker.acks {
+		assert.Equal(KafkaAcksAll, acks)
+	}
+	// vbs are mapped to partitions by vbno % number of partitions, with the order in each vb preserved
+	for partition := int32(0); partition < 4; partition++ {
+		records := broker.records[partition]
+		vbs := []uint16{uint16(partition)}
+		if partition < 2 {
+			vbs = append(vbs, uint16(partition+4))
+		}
+		assert.Equal(2*len(vbs), len(records))
+		for i, vbno := range vbs {
+			if len(records) < 2*i+2 {
+				break
+			}
+			assert.Equal(fmt.Sprintf("doc%v_1", vbno), string(records[2*i].Key))
+			assert.Equal(fmt.Sprintf("doc%v_2", vbno), string(records[2*i+1].Key))
+
+			record := &SinkRecord{}
+			assert.Nil(json.Unmarshal(records[2*i].Value, record))
+			assert.Equal(vbno, record.VBucket)
+			assert.Equal(json.RawMessage(`{"a":1}`), record.Doc)
+			record = &SinkRecord{}
+			assert.Nil(json.Unmarshal(records[2*i+1].Value, record))
+			assert.True(record.Deleted)
+		}
+	}
+	broker.lock.Unlock()
+
+	fmt.Println("============== Test case end: TestKafkaSink =================")
+}
+
+func TestKafkaSinkProduceError(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestKafkaSinkProduceError =================")
+
+	broker, err := newFakeKafkaBroker(2)
+	assert.Nil(err)
+	defer broker.close()
+
+	sink, err := NewKafkaSink(&SinkParams{TargetBucketName: "target", Settings: metadata.SinkSettings{Endpoint: broker.addr()}}, sinkTestLogger)
+	assert.Nil(err)
+	assert.Nil(sink.Open())
+	defer sink.Close()
+
+	broker.lock.Lock()
+	broker.produceErrors = []KafkaErrorCode{KafkaErrorNotLeaderForPartition}
+	broker.lock.Unlock()
+
+	record, _ := NewSinkRecord(composeSinkTestRequest("doc1", 1, 1, mc.UPR_MUTATION, base.JSONDataType, []byte(`{}`)))
+	// failed produce is reported, so that sink nozzle retries it and does not checkpoint the record
+	assert.NotNil(sink.Write(1, []*SinkRecord{record}))
+	// metadata is refreshed before the retry
+	assert.Nil(sink.Write(1, []*SinkRecord{record}))
+
+	broker.lock.Lock()
+	assert.Equal(2, broker.numOfMetadata)
+	assert.Equal(1, len(broker.records[1]))
+	broker.lock.Unlock()
+
+	// broker going away is reported too
+	broker.close()
+	sink.(*KafkaSink).Close()
+	assert.NotNil(sink.Write(1, []*SinkRecord{record}))
+
+	fmt.Println("============== Test case end: TestKafkaSinkProduceError =================")
+}
+
+func TestKafkaSinkMaxRequestBytes(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestKafkaSinkMaxRequestBytes =================")
+
+	broker, err := newFakeKafkaBroker(1)
+	assert.Nil(err)
+	defer broker.close()
+
+	records := make([]*SinkRecord, 0, 3)
+	for i := 0; i < 3; i++ {
+		record, _ := NewSinkRecord(composeSinkTestRequest(fmt.Sprintf("doc%v", i), 0, uint64(i+1), mc.UPR_MUTATION, base.JSONDataType, []byte(`{"a":1}`)))
+		records = append(records, record)
+	}
+	value, _ := json.Marshal(records[0])
+	recordSize := kafkaRecordMaxSize(&KafkaRecord{Key: []byte(records[0].Key), Value: value})
+
+	// room for two records in each produce request
+	sink, err := NewKafkaSink(&SinkParams{TargetBucketName: "target",
+		Settings: metadata.SinkSettings{Endpoint: broker.addr(), KafkaMaxRequestBytes: kafkaRecordBatchOverhead + 2*recordSize}}, sinkTestLogger)
+	assert.Nil(err)
+	assert.Nil(sink.Open())
+	defer sink.Close()
+
+	assert.Nil(sink.Write(0, records))
+	broker.lock.Lock()
+	assert.Equal(2, len(broker.acks))
+	assert.Equal(3, len(broker.records[0]))
+	for i, record := range broker.records[0] {
+		assert.Equal(fmt.Sprintf("doc%v", i), string(record.Key))
+	}
+	broker.lock.Unlock()
+
+	// document that does not fit in a produce request is not retried
+	largeRecord, _ := NewSinkRecord(composeSinkTestRequest("largeDoc", 0, 4, mc.UPR_MUTATION, base.JSONDataType, []byte(fmt.Sprintf(`{"a":"%0*d"}`, 2*recordSize, 0))))
+	err = sink.Write(0, []*SinkRecord{largeRecord})
+	_, ok := err.(*SinkNonRetriableError)
+	assert.True(ok)
+
+	// neither are records rejected by broker for their size, which do not need metadata refreshed
+	broker.lock.Lock()
+	broker.produceErrors = []KafkaErrorCode{KafkaErrorMessageTooLarge}
+	broker.lock.Unlock()
+	err = sink.Write(0, records[:1])
+	_, ok = err.(*SinkNonRetriableError)
+	assert.True(ok)
+	assert.Contains(err.Error(), "MESSAGE_TOO_LARGE")
+	assert.False(sink.(*KafkaSink).metadataStale)
+
+	broker.lock.Lock()
+	assert.Equal(1, broker.numOfMetadata)
+	assert.Equal(3, len(broker.records[0]))
+	broker.lock.Unlock()
+
+	fmt.Println("============== Test case end: TestKafkaSinkMaxRequestBytes =================")
+}
+
+func TestKafkaSinkSasl(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestKafkaSinkSasl =================")
+
+	broker, err := newFakeKafkaBroker(1)
+	assert.Nil(err)
+	defer broker.close()
+	broker.saslToken = kafkaSaslPlainToken("user", "password")
+
+	testCases := []struct {
+		name     string
+		username string
+		password string
+		succeeds bool
+	}{
+		{"valid credentials", "user", "password", true},
+		{"wrong password", "user", "wrong", false},
+		{"no credentials", "", "", false},
+	}
+
+	for _, testCase := range testCases {
+		settings := metadata.SinkSettings{Endpoint: broker.addr(), Username: testCase.username, Password: testCase.password}
+		sink, err := NewKafkaSink(&SinkParams{TargetBucketName: "target", Settings: settings}, sinkTestLogger)
+		assert.Nil(err, testCase.name)
+		err = sink.Open()
+		assert.Equal(testCase.succeeds, err == nil, testCase.name)
+		if err == nil {
+			record, _ := NewSinkRecord(composeSinkTestRequest("doc1", 0, 1, mc.UPR_MUTATION, base.JSONDataType, []byte(`{}`)))
+			assert.Nil(sink.Write(0, []*SinkRecord{record}), testCase.name)
+		}
+		sink.Close()
+	}
+
+	// certificate needs to be PEM encoded
+	settings := metadata.SinkSettings{Endpoint: broker.addr(), TLS: true, Certificate: "not a certificate"}
+	_, err = NewKafkaSink(&SinkParams{TargetBucketName: "target", Settings: settings}, sinkTestLogger)
+	assert.Equal(ErrorKafkaInvalidCertificate, err)
+
+	fmt.Println("============== Test case end: TestKafkaSinkSasl =================")
+}
@@ -13,7 +13,6 @@ package parts
 import (
 	"encoding/binary"
 	"errors"
-	"fmt"
 	mc "github.com/couchbase/gomemcached"
 	base "github.com/couchbase/goxdcr/base"
 	"github.com/couchbase/goxdcr/log"
@@ -88,46 +87,6 @@ type baseConfig struct {
 	logger             *log.CommonLogger
 }
 
-type documentMetadata struct {
-	key      []byte
-	revSeq   uint64 //Item revision seqno
-	cas      uint64 //Item cas
-	flags    uint32 // Item flags
-	expiry   uint32 // Item expiration time
-	deletion bool
-	dataType uint8 // item data type
-}
-
-func (doc_meta documentMetadata) String() string {
-	return fmt.Sprintf("[key=%s; revSeq=%v;cas=%v;flags=%v;expiry=%v;deletion=%v:datatype=%v]", doc_meta.key, doc_meta.revSeq, doc_meta.cas, doc_meta.flags, doc_meta.expiry, doc_meta.deletion, doc_meta.dataType)
-}
-
-func (doc_meta *documentMetadata) Clone() *documentMetadata {
-	var clone *documentMetadata
-	if doc_meta != nil {
-		clone = &documentMetadata{}
-		*clone = *doc_meta
-		clone.key = base.DeepCopyByteArray(doc_meta.key)
-	}
-	return clone
-}
-
-func (doc_meta *documentMetadata) Redact() *documentMetadata {
-	if doc_meta != nil {
-		if len(doc_meta.key) > 0 && !base.IsByteSliceRedacted(doc_meta.key) {
-			doc_meta.key = base.TagUDBytes(doc_meta.key)
-		}
-	}
-	return doc_meta
-}
-
-func (doc_meta *documentMetadata) CloneAndRedact() *documentMetadata {
-	if doc_meta != nil {
-		return doc_meta.Clone().Redact()
-	}
-	return doc_meta
-}
-
 // We determine the "commit" time as the time we hear back from the target, for statistics purposes
 type GetMetaReceivedEventAdditional struct {
 	Key         string
@@ -291,18 +250,15 @@ func needSend(req *base.WrappedMCRequest, batch *dataBatch, logger *log.CommonLo
 	}
 }
 
-func decodeSetMetaReq(wrapped_req *base.WrappedMCRequest) documentMetadata {
-	ret := documentMetadata{}
+func decodeSetMetaReq(wrapped_req *base.WrappedMCRequest) base.DocumentMetadata {
 	req := wrapped_req.Req
-	ret.key = req.Key
-	ret.flags = binary.BigEndian.Uint32(req.Extras[0:4])
-	ret.expiry = binary.BigEndian.Uint32(req.Extras[4:8])
-	ret.revSeq = binary.BigEndian.Uint64(req.Extras[8:16])
-	ret.cas = req.Cas
-	ret.deletion = (req.Opcode == base.DELETE_WITH_META)
-	ret.dataType = req.DataType
-
-	return ret
+	return base.NewDocumentMetadata(req.Key,
+		binary.BigEndian.Uint64(req.Extras[8:16]), /*revSeq*/
+		req.Cas,
+		binary.BigEndian.Uint32(req.Extras[0:4]), /*flags*/
+		binary.BigEndian.Uint32(req.Extras[4:8]), /*expiry*/
+		req.Opcode == base.DELETE_WITH_META,
+		req.DataType)
 }
 
 type BigDocNoRepMap map[string]bool
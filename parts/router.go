@@ -34,6 +34,7 @@ var ErrorInvalidRoutingMapForRouter = errors.New("routingMap in Router is invali
 var IsHighReplicationKey = "IsHighReplication"
 var NeedToThrottleKey = "NeedToThrottle"
 var FilterExpDelKey = base.FilterExpDelKey
+var FilterDelExpFallbackKey = base.FilterDelExpFallbackKey
 
 // enum for whether router needs to be throttled
 const (
@@ -62,9 +63,12 @@ type Router struct {
 	id string
 	*connector.Router
 	filter      *Filter
+	transformer *Transformer
 	routingMap  map[uint16]string // pvbno -> partId. This defines the loading balancing strategy of which vbnos would be routed to which part
 	req_creator ReqCreator
-	topic       string
+	// recycles requests that are not routed to downstream parts
+	req_recycler base.DataObjRecycler
+	topic        string
 	// whether lww conflict resolution mode has been enabled
 	sourceCRMode base.ConflictResolutionMode
 	utils        utilities.UtilsIface
@@ -74,6 +78,12 @@ type Router struct {
 	// whether the current replication is a high priority replication
 	// when Priority or Ongoing setting is changed, this field will be updated through UpdateSettings() call
 	isHighReplication *base.AtomicBooleanType
+
+	// range of data that a bounded replication copies. nil when replication is not bounded
+	boundedRange *metadata.BoundedRange
+	// number of vbuckets in target bucket. when it is positive and transformation rules change document keys,
+	// documents are routed to the target vbuckets of their new keys, and routingMap needs to cover all target vbuckets
+	targetVBCount int
 }
 
 /**
@@ -83,18 +93,25 @@ type Router struct {
  * 1. downStreamParts - a map of <targetNozzleID> -> <TargetNozzle>.
  * 		The map only includes the targets that this source (router) is responsible for replicating.
  * 2. routingMap == vbNozzleMap, which is a map of <vbucketID> -> <targetNozzleID>
- * 3+ Rest should be relatively obv
+ * 3. targetVBCount - number of vbuckets in target bucket, or 0 when documents are always routed by source vbucket.
+ *		When it is positive, downStreamParts and routingMap need to cover all target vbuckets
+ * 4+ Rest should be relatively obv
  */
 func NewRouter(id string, topic string, filterExpression string,
 	downStreamParts map[string]common.Part,
 	routingMap map[uint16]string,
 	sourceCRMode base.ConflictResolutionMode,
 	logger_context *log.LoggerContext, req_creator ReqCreator,
+	req_recycler base.DataObjRecycler,
 	utilsIn utilities.UtilsIface,
 	throughputThrottlerSvc service_def.ThroughputThrottlerSvc,
 	isHighReplication bool,
-	filterExpDelType base.FilterExpDelType) (*Router, error) {
+	filterExpDelType base.FilterExpDelType,
+	transformationRules string,
+	boundedRange *metadata.BoundedRange,
+	targetVBCount int) (*Router, error) {
 	var filter *Filter
+	var transformer *Transformer
 	var err error
 
 	if len(filterExpression) > 0 {
@@ -104,13 +121,24 @@ func NewRouter(id string, topic string, filterExpression string,
 		}
 	}
 
+	if len(transformationRules) > 0 {
+		transformer, err = NewTransformer(id, transformationRules)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	router := &Router{
 		id:                     id,
 		filter:                 filter,
+		transformer:            transformer,
+		boundedRange:           boundedRange,
+		targetVBCount:          targetVBCount,
 		routingMap:             routingMap,
 		topic:                  topic,
 		sourceCRMode:           sourceCRMode,
 		req_creator:            req_creator,
+		req_recycler:           req_recycler,
 		utils:                  utilsIn,
 		isHighReplication:      base.NewAtomicBooleanType(isHighReplication),
 		throughputThrottlerSvc: throughputThrottlerSvc,
@@ -132,7 +160,18 @@ func (router *Router) ComposeMCRequest(event *mcc.UprEvent) (*base.WrappedMCRequ
 		return nil, err
 	}
 
-	req := wrapped_req.Req
+	setMCRequestFromUprEvent(wrapped_req.Req, event, router.sourceCRMode)
+
+	wrapped_req.Seqno = event.Seqno
+	wrapped_req.SrcVBucket = event.VBucket
+	wrapped_req.Start_time = time.Now()
+	wrapped_req.ConstructUniqueKey()
+
+	return wrapped_req, nil
+}
+
+// populates req with the contents of a dcp event. sourceCRMode decides whether FORCE_ACCEPT_WITH_META_OPS option is set
+func setMCRequestFromUprEvent(req *mc.MCRequest, event *mcc.UprEvent, sourceCRMode base.ConflictResolutionMode) {
 	req.Cas = event.Cas
 	req.Opaque = 0
 	req.VBucket = event.VBucket
@@ -147,7 +186,7 @@ func (router *Router) ComposeMCRequest(event *mcc.UprEvent) (*base.WrappedMCRequ
 		event.Opcode == mc.UPR_EXPIRATION {
 
 		extrasSize := 24
-		if router.sourceCRMode == base.CRMode_LWW || event.Opcode == mc.UPR_EXPIRATION {
+		if sourceCRMode == base.CRMode_LWW || event.Opcode == mc.UPR_EXPIRATION {
 			extrasSize = 28
 		}
 		if len(req.Extras) != extrasSize {
@@ -161,7 +200,7 @@ func (router *Router) ComposeMCRequest(event *mcc.UprEvent) (*base.WrappedMCRequ
 		binary.BigEndian.PutUint64(req.Extras[16:24], event.Cas)
 
 		var options uint32
-		if router.sourceCRMode == base.CRMode_LWW {
+		if sourceCRMode == base.CRMode_LWW {
 			// if source bucket is of lww type, add FORCE_ACCEPT_WITH_META_OPS options for memcached
 			options |= base.FORCE_ACCEPT_WITH_META_OPS
 		}
@@ -181,12 +220,6 @@ func (router *Router) ComposeMCRequest(event *mcc.UprEvent) (*base.WrappedMCRequ
 		binary.BigEndian.PutUint64(req.Extras[16:24], event.SnapendSeq)
 		binary.BigEndian.PutUint32(req.Extras[24:28], event.SnapshotType)
 	}
-
-	wrapped_req.Seqno = event.Seqno
-	wrapped_req.Start_time = time.Now()
-	wrapped_req.ConstructUniqueKey()
-
-	return wrapped_req, nil
 }
 
 // Implementation of the routing algorithm
@@ -212,6 +245,12 @@ func (router *Router) route(data interface{}) (map[string]interface{}, error) {
 		return nil, ErrorInvalidRoutingMapForRouter
 	}
 
+	// data outside of the range of a bounded replication is not replicated
+	if router.boundedRange != nil && !router.boundedRange.Contains(uprEvent.VBucket, uprEvent.Seqno, uprEvent.Cas) {
+		router.RaiseEvent(common.NewEvent(common.DataFiltered, uprEvent, router, nil, nil))
+		return result, nil
+	}
+
 	shouldContinue := router.ProcessExpDelTTL(uprEvent)
 	if !shouldContinue {
 		router.RaiseEvent(common.NewEvent(common.DataFiltered, uprEvent, router, nil, nil))
@@ -241,10 +280,48 @@ func (router *Router) route(data interface{}) (map[string]interface{}, error) {
 	if err != nil {
 		return nil, router.utils.NewEnhancedError("Error creating new memcached request.", err)
 	}
+
+	// transform data if transformation rules have been defined
+	if router.transformer != nil {
+		transformed, err := router.transformer.TransformMCRequest(mcRequest.Req)
+		if err != nil {
+			// data that cannot be transformed, e.g., data whose body is not valid json, is replicated as it is,
+			// so that checkpoints never move past data that has not been replicated
+			router.RaiseEvent(common.NewEvent(common.DataUnableToTransform, uprEvent, router, []interface{}{err}, nil))
+		} else if transformed {
+			if router.transformer.ChangesKeys() && router.targetVBCount > 0 {
+				partId, err = router.routeToTargetVB(mcRequest)
+				if err != nil {
+					router.recycleMCRequest(mcRequest)
+					return nil, err
+				}
+			}
+			router.RaiseEvent(common.NewEvent(common.DataTransformed, uprEvent, router, nil, nil))
+		}
+	}
 	result[partId] = mcRequest
 	return result, nil
 }
 
+// sets the vbucket of a request whose key may have been changed by transformation rules to the target vbucket
+// of its key, and returns the downstream part to which the target vbucket is routed
+func (router *Router) routeToTargetVB(mcRequest *base.WrappedMCRequest) (string, error) {
+	targetVB := base.GetVBucketForKey(mcRequest.Req.Key, router.targetVBCount)
+	partId, ok := router.routingMap[targetVB]
+	if !ok {
+		return "", ErrorInvalidRoutingMapForRouter
+	}
+	mcRequest.Req.VBucket = targetVB
+	mcRequest.ConstructUniqueKey()
+	return partId, nil
+}
+
+func (router *Router) recycleMCRequest(mcRequest *base.WrappedMCRequest) {
+	if router.req_recycler != nil {
+		router.req_recycler(router.topic, mcRequest)
+	}
+}
+
 func (router *Router) throttle() {
 	// this statement before the for loop is to ensure that
 	// we do not incur the overhead of collecting start time
@@ -299,6 +376,24 @@ func (router *Router) updateExpDelMode(expDelModeObj interface{}) error {
 	return nil
 }
 
+func (router *Router) updateFilterDelExpFallback(fallbackObj interface{}) error {
+	fallback, ok := fallbackObj.(string)
+	if !ok {
+		err := fmt.Errorf("%v invalid data type for filterDelExpFallback. value = %v\n", router.id, fallbackObj)
+		router.Logger().Warn(err.Error())
+		return err
+	}
+
+	if router.filter == nil {
+		// nothing is filtered
+		return nil
+	}
+
+	router.Logger().Infof("%v changing filterDelExpFallback to %v\n", router.id, fallback)
+	router.filter.SetDelExpFallback(fallback)
+	return nil
+}
+
 func (router *Router) updateHighRepl(isHighReplicationObj interface{}) error {
 	isHighReplication, ok := isHighReplicationObj.(bool)
 	if !ok {
@@ -331,6 +426,14 @@ func (router *Router) UpdateSettings(settings metadata.ReplicationSettingsMap) e
 		}
 	}
 
+	filterDelExpFallbackObj, ok := settings[FilterDelExpFallbackKey]
+	if ok {
+		err := router.updateFilterDelExpFallback(filterDelExpFallbackObj)
+		if err != nil {
+			errMap["UpdatingFilterDelExpFallback"] = err
+		}
+	}
+
 	if len(errMap) > 0 {
 		return fmt.Errorf("Router %v UpdateSettings error(s): %v", router.id, base.FlattenErrorMap(errMap))
 	} else {
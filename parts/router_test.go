@@ -5,6 +5,8 @@ package parts
 import (
 	"encoding/binary"
 	"fmt"
+	mc "github.com/couchbase/gomemcached"
+	mcc "github.com/couchbase/gomemcached/client"
 	"github.com/couchbase/goxdcr/base"
 	"github.com/couchbase/goxdcr/common"
 	"github.com/couchbase/goxdcr/log"
@@ -13,7 +15,9 @@ import (
 	utilities "github.com/couchbase/goxdcr/utils"
 	UtilitiesMock "github.com/couchbase/goxdcr/utils/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"testing"
+	"time"
 )
 
 func setupBoilerPlateRouter() (routerId, topic, filterExpression string, downStreamParts map[string]common.Part,
@@ -46,7 +50,7 @@ func TestRouterRouteFunc(t *testing.T) {
 		needToThrottle, expDelMode := setupBoilerPlateRouter()
 
 	router, err := NewRouter(routerId, topic, filterExpression, downStreamParts,
-		routingMap, crMode, loggerCtx, req_creater, utilsMock, throughputThrottlerSvc, needToThrottle, expDelMode)
+		routingMap, crMode, loggerCtx, req_creater, nil /*req_recycler*/, utilsMock, throughputThrottlerSvc, needToThrottle, expDelMode, "" /*transformationRules*/, nil /*boundedRange*/, 0 /*targetVBCount*/)
 
 	assert.Nil(err)
 	assert.NotNil(router)
@@ -76,6 +80,54 @@ func TestRouterRouteFunc(t *testing.T) {
 	fmt.Println("============== Test case end: TestRouterRouteFunc =================")
 }
 
+func TestComposeRequestForSetMeta(t *testing.T) {
+	fmt.Println("============== Test case start: TestComposeRequestForSetMeta =================")
+	assert := assert.New(t)
+
+	uprEvent, err := RetrieveUprFile("./testdata/uprEventDeletion.json")
+	assert.Nil(err)
+	assert.NotNil(uprEvent)
+
+	req, err := ComposeRequestForSetMeta(uprEvent, base.CRMode_RevId, 5, nil)
+	assert.Nil(err)
+	assert.Equal(base.DELETE_WITH_META, req.Opcode)
+	assert.Equal(uint32(5), req.Opaque)
+	assert.Equal(uint64(0), req.Cas)
+	assert.Equal(24, len(req.Extras))
+	assert.Equal(uprEvent.RevSeqno, binary.BigEndian.Uint64(req.Extras[8:16]))
+	assert.Equal(uprEvent.Cas, binary.BigEndian.Uint64(req.Extras[16:24]))
+
+	// lww mode forces target to accept the mutation
+	uprEvent.Opcode = mc.UPR_MUTATION
+	uprEvent.DataType = base.PROTOCOL_BINARY_DATATYPE_XATTR | base.JSONDataType
+	req, err = ComposeRequestForSetMeta(uprEvent, base.CRMode_LWW, 6, nil)
+	assert.Nil(err)
+	assert.Equal(base.SET_WITH_META, req.Opcode)
+	assert.Equal(base.PROTOCOL_BINARY_DATATYPE_XATTR, req.DataType)
+	assert.Equal(28, len(req.Extras))
+	assert.True(binary.BigEndian.Uint32(req.Extras[24:28])&base.FORCE_ACCEPT_WITH_META_OPS > 0)
+
+	// transformation rules are applied
+	transformer, err := NewTransformer("test", `[{"type":"setTTL","ttl":3600}]`)
+	assert.Nil(err)
+	assert.True(transformer.SetsTTL())
+	req, err = ComposeRequestForSetMeta(uprEvent, base.CRMode_LWW, 7, transformer)
+	assert.Nil(err)
+	assert.Equal(base.SET_WITH_META, req.Opcode)
+	assert.True(binary.BigEndian.Uint32(req.Extras[4:8]) > uint32(time.Now().Unix()))
+
+	// documents that cannot be transformed are not composed
+	transformer, err = NewTransformer("test", `[{"type":"dropField","field":"a"}]`)
+	assert.Nil(err)
+	assert.False(transformer.SetsTTL())
+	uprEvent.DataType = base.JSONDataType
+	uprEvent.Value = []byte("not json")
+	_, err = ComposeRequestForSetMeta(uprEvent, base.CRMode_LWW, 8, transformer)
+	assert.NotNil(err)
+
+	fmt.Println("============== Test case end: TestComposeRequestForSetMeta =================")
+}
+
 func TestRouterInitialNone(t *testing.T) {
 	fmt.Println("============== Test case start: TestRouterInitialNone =================")
 	assert := assert.New(t)
@@ -86,7 +138,7 @@ func TestRouterInitialNone(t *testing.T) {
 		needToThrottle, expDelMode := setupBoilerPlateRouter()
 
 	router, err := NewRouter(routerId, topic, filterExpression, downStreamParts,
-		routingMap, crMode, loggerCtx, req_creater, utilsMock, throughputThrottlerSvc, needToThrottle, expDelMode)
+		routingMap, crMode, loggerCtx, req_creater, nil /*req_recycler*/, utilsMock, throughputThrottlerSvc, needToThrottle, expDelMode, "" /*transformationRules*/, nil /*boundedRange*/, 0 /*targetVBCount*/)
 
 	assert.Nil(err)
 	assert.NotNil(router)
@@ -108,7 +160,7 @@ func TestRouterSkipDeletion(t *testing.T) {
 	expDelMode = base.FilterExpDelSkipDeletes
 
 	router, err := NewRouter(routerId, topic, filterExpression, downStreamParts,
-		routingMap, crMode, loggerCtx, req_creater, utilsMock, throughputThrottlerSvc, needToThrottle, expDelMode)
+		routingMap, crMode, loggerCtx, req_creater, nil /*req_recycler*/, utilsMock, throughputThrottlerSvc, needToThrottle, expDelMode, "" /*transformationRules*/, nil /*boundedRange*/, 0 /*targetVBCount*/)
 
 	assert.Nil(err)
 	assert.NotNil(router)
@@ -144,7 +196,7 @@ func TestRouterSkipExpiration(t *testing.T) {
 	expDelMode = base.FilterExpDelSkipExpiration
 
 	router, err := NewRouter(routerId, topic, filterExpression, downStreamParts,
-		routingMap, crMode, loggerCtx, req_creater, utilsMock, throughputThrottlerSvc, needToThrottle, expDelMode)
+		routingMap, crMode, loggerCtx, req_creater, nil /*req_recycler*/, utilsMock, throughputThrottlerSvc, needToThrottle, expDelMode, "" /*transformationRules*/, nil /*boundedRange*/, 0 /*targetVBCount*/)
 
 	assert.Nil(err)
 	assert.NotNil(router)
@@ -180,7 +232,7 @@ func TestRouterSkipDeletesStripTTL(t *testing.T) {
 	expDelMode = base.FilterExpDelSkipExpiration | base.FilterExpDelStripExpiration
 
 	router, err := NewRouter(routerId, topic, filterExpression, downStreamParts,
-		routingMap, crMode, loggerCtx, req_creater, utilsMock, throughputThrottlerSvc, needToThrottle, expDelMode)
+		routingMap, crMode, loggerCtx, req_creater, nil /*req_recycler*/, utilsMock, throughputThrottlerSvc, needToThrottle, expDelMode, "" /*transformationRules*/, nil /*boundedRange*/, 0 /*targetVBCount*/)
 
 	assert.Nil(err)
 	assert.NotNil(router)
@@ -219,7 +271,7 @@ func TestRouterExpDelAllMode(t *testing.T) {
 	expDelMode = base.FilterExpDelAll
 
 	router, err := NewRouter(routerId, topic, filterExpression, downStreamParts,
-		routingMap, crMode, loggerCtx, req_creater, utilsMock, throughputThrottlerSvc, needToThrottle, expDelMode)
+		routingMap, crMode, loggerCtx, req_creater, nil /*req_recycler*/, utilsMock, throughputThrottlerSvc, needToThrottle, expDelMode, "" /*transformationRules*/, nil /*boundedRange*/, 0 /*targetVBCount*/)
 
 	assert.Nil(err)
 	assert.NotNil(router)
@@ -250,3 +302,68 @@ func TestRouterExpDelAllMode(t *testing.T) {
 	assert.False(shouldContinue)
 	fmt.Println("============== Test case end: TestRouterExpDelAllMode =================")
 }
+
+func TestRouterTransformationRouting(t *testing.T) {
+	fmt.Println("============== Test case start: TestRouterTransformationRouting =================")
+	assert := assert.New(t)
+
+	routerId, topic, filterExpression, downStreamParts,
+		_, crMode, loggerCtx,
+		req_creater, utilsMock, _,
+		needToThrottle, expDelMode := setupBoilerPlateRouter()
+
+	throughputThrottlerSvc := &ThroughputThrottlerMock.ThroughputThrottlerSvc{}
+	throughputThrottlerSvc.On("CanSend", mock.Anything).Return(true)
+
+	// target has 4 vbuckets, of which source node owns vb 0 only
+	targetVBCount := 4
+	routingMap := map[uint16]string{0: "nozzle0", 1: "nozzle0", 2: "nozzle1", 3: "nozzle1"}
+	var recycled []*base.WrappedMCRequest
+	recycler := func(topic string, req *base.WrappedMCRequest) {
+		recycled = append(recycled, req)
+	}
+
+	router, err := NewRouter(routerId, topic, filterExpression, downStreamParts,
+		routingMap, crMode, loggerCtx, req_creater, recycler, utilsMock, throughputThrottlerSvc, needToThrottle, expDelMode,
+		`[{"type":"keyPrefix","value":"p::"},{"type":"dropField","field":"a"}]`, nil /*boundedRange*/, targetVBCount)
+	assert.Nil(err)
+	assert.NotNil(router)
+
+	newUprEvent := func(key string, body string) *mcc.UprEvent {
+		return &mcc.UprEvent{Opcode: mc.UPR_MUTATION, VBucket: 0, Key: []byte(key), Value: []byte(body),
+			DataType: base.JSONDataType, Seqno: 10, Cas: 100}
+	}
+
+	// documents with changed keys are routed to the target vbucket of the new key
+	for _, key := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		result, err := router.route(newUprEvent(key, `{"a":1,"b":2}`))
+		assert.Nil(err, key)
+		assert.Equal(1, len(result), key)
+		targetVB := base.GetVBucketForKey([]byte("p::"+key), targetVBCount)
+		req, ok := result[routingMap[targetVB]].(*base.WrappedMCRequest)
+		assert.True(ok, key)
+		assert.Equal("p::"+key, string(req.Req.Key))
+		assert.Equal(targetVB, req.Req.VBucket)
+		assert.Equal(uint16(0), req.SrcVBucket)
+		assert.Equal(`{"b":2}`, string(req.Req.Body))
+	}
+
+	// documents that cannot be transformed are replicated as they are, through the source vbucket
+	result, err := router.route(newUprEvent("k1", "not json"))
+	assert.Nil(err)
+	assert.Equal(1, len(result))
+	req, ok := result["nozzle0"].(*base.WrappedMCRequest)
+	assert.True(ok)
+	assert.Equal("k1", string(req.Req.Key))
+	assert.Equal(uint16(0), req.Req.VBucket)
+	assert.Equal("not json", string(req.Req.Body))
+	assert.Equal(0, len(recycled))
+
+	// request is recycled when the target vbucket of the new key is not in routing map
+	delete(routingMap, base.GetVBucketForKey([]byte("p::k1"), targetVBCount))
+	_, err = router.route(newUprEvent("k1", `{"a":1}`))
+	assert.Equal(ErrorInvalidRoutingMapForRouter, err)
+	assert.Equal(1, len(recycled))
+
+	fmt.Println("============== Test case end: TestRouterTransformationRouting =================")
+}
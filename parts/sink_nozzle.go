@@ -0,0 +1,735 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+// defines the sink nozzle, which replicates to targets that are not couchbase clusters through pluggable sinks
+package parts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mc "github.com/couchbase/gomemcached"
+	base "github.com/couchbase/goxdcr/base"
+	common "github.com/couchbase/goxdcr/common"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/metadata"
+	utilities "github.com/couchbase/goxdcr/utils"
+	"github.com/golang/snappy"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sink is the plug-in point for replication targets that are not couchbase clusters.
+// A sink is owned by a single SinkNozzle, which takes care of batching, stats and checkpointing,
+// and is called by only one go routine at a time.
+type Sink interface {
+	// Open is called when the owning nozzle starts, before any Write
+	Open() error
+	// Write persists a batch of mutations in a vbucket, which are in increasing seqno order.
+	// Mutations are considered replicated, and may be covered by checkpoints, once Write returns nil,
+	// hence Write should not return before the mutations have been durably accepted by target.
+	// A failed Write is retried with the same mutations, and mutations after the last checkpoint are
+	// replicated again when replication restarts, so targets need to tolerate duplicates.
+	// records are not valid after Write returns and must not be retained.
+	Write(vbno uint16, records []*SinkRecord) error
+	// Close is called when the owning nozzle stops
+	Close() error
+}
+
+// SinkNonRetriableError is returned by Write for failures that retries would not resolve,
+// e.g., mutations being rejected by target, so that the owning nozzle reports them right away
+type SinkNonRetriableError struct {
+	Err error
+}
+
+func (err *SinkNonRetriableError) Error() string {
+	return err.Err.Error()
+}
+
+// SinkParams describes the replication and the vbuckets that a sink is constructed for
+type SinkParams struct {
+	Topic            string
+	SourceBucketName string
+	TargetBucketName string
+	// index of the owning nozzle among the target nozzles of the replication on the current node
+	NozzleIndex int
+	VBList      []uint16
+	// settings of the replication for connecting to the sink, e.g., endpoint and credentials
+	Settings metadata.SinkSettings
+}
+
+// SinkConstructor constructs a sink each time a pipeline of a replication using the sink is constructed
+type SinkConstructor func(params *SinkParams, logger *log.CommonLogger) (Sink, error)
+
+// SinkRecord is the target independent representation of a mutation that is passed to sinks
+type SinkRecord struct {
+	Key      string            `json:"key"`
+	VBucket  uint16            `json:"vb"`
+	Seqno    uint64            `json:"seqno"`
+	RevSeqno uint64            `json:"revSeqno"`
+	Cas      uint64            `json:"cas"`
+	Flags    uint32            `json:"flags"`
+	Expiry   uint32            `json:"expiry"`
+	Deleted  bool              `json:"deleted,omitempty"`
+	Expired  bool              `json:"expired,omitempty"`
+	Xattrs   map[string]string `json:"xattrs,omitempty"`
+	// document body, when it is json
+	Doc json.RawMessage `json:"doc,omitempty"`
+	// document body, when it is not json
+	Binary []byte `json:"base64,omitempty"`
+}
+
+// NewSinkRecord converts a request composed by router into a sink record.
+// The record may refer to the memory of the request
+func NewSinkRecord(req *base.WrappedMCRequest) (*SinkRecord, error) {
+	mc_req := req.Req
+	if len(mc_req.Extras) < 24 {
+		return nil, fmt.Errorf("Invalid extras in request for sink. len=%v", len(mc_req.Extras))
+	}
+
+	record := &SinkRecord{
+		Key:      string(mc_req.Key),
+		VBucket:  mc_req.VBucket,
+		Seqno:    req.Seqno,
+		Flags:    binary.BigEndian.Uint32(mc_req.Extras[0:4]),
+		Expiry:   binary.BigEndian.Uint32(mc_req.Extras[4:8]),
+		RevSeqno: binary.BigEndian.Uint64(mc_req.Extras[8:16]),
+		Cas:      binary.BigEndian.Uint64(mc_req.Extras[16:24]),
+		Deleted:  mc_req.Opcode == mc.UPR_DELETION || mc_req.Opcode == mc.UPR_EXPIRATION,
+		Expired:  mc_req.Opcode == mc.UPR_EXPIRATION,
+	}
+
+	value := mc_req.Body
+	if mc_req.DataType&base.SnappyDataType > 0 {
+		var err error
+		value, err = snappy.Decode(nil, mc_req.Body)
+		if err != nil {
+			return nil, base.ErrorCompressionUnableToInflate
+		}
+	}
+
+	if mc_req.DataType&base.XattrDataType > 0 {
+		if len(value) < 4 || int(binary.BigEndian.Uint32(value[0:4]))+4 > len(value) {
+			return nil, ErrorInvalidXattrSection
+		}
+		xattrSectionSize := int(binary.BigEndian.Uint32(value[0:4])) + 4
+		xattrs, err := parseXattrs(value[:xattrSectionSize])
+		if err != nil {
+			return nil, err
+		}
+		record.Xattrs = xattrs
+		value = value[xattrSectionSize:]
+	}
+
+	if len(value) > 0 {
+		if mc_req.DataType&base.JSONDataType > 0 {
+			record.Doc = json.RawMessage(value)
+		} else {
+			record.Binary = value
+		}
+	}
+	return record, nil
+}
+
+// parses xattr section, which consists of its total size followed by xattr pairs, each in the form of
+// <4 byte pair size><xattr key>\x00<xattr value>\x00
+func parseXattrs(xattrSection []byte) (map[string]string, error) {
+	xattrs := make(map[string]string)
+	pos := 4
+	for pos < len(xattrSection) {
+		if pos+4 > len(xattrSection) {
+			return nil, ErrorInvalidXattrSection
+		}
+		pairSize := int(binary.BigEndian.Uint32(xattrSection[pos : pos+4]))
+		pairEnd := pos + 4 + pairSize
+		if pairEnd > len(xattrSection) {
+			return nil, ErrorInvalidXattrSection
+		}
+		pair := xattrSection[pos+4 : pairEnd]
+		keyEnd := bytes.IndexByte(pair, 0)
+		if keyEnd < 0 || pair[len(pair)-1] != 0 {
+			return nil, ErrorInvalidXattrSection
+		}
+		xattrs[string(pair[:keyEnd])] = string(pair[keyEnd+1 : len(pair)-1])
+		pos = pairEnd
+	}
+	return xattrs, nil
+}
+
+var ErrorSinkConstructorNil = errors.New("Sink constructor cannot be nil")
+
+// constructors of registered sinks. names of sinks are registered in base as well
+var sinkRegistry = make(map[string]SinkConstructor)
+var sinkRegistryLock sync.RWMutex
+
+// RegisterSink makes a sink available under the specified name, so that it can be selected as the target
+// of a replication through the replication_type replication setting.
+// It is expected to be called during process initialization, before replications are started.
+func RegisterSink(name string, constructor SinkConstructor) error {
+	if constructor == nil {
+		return ErrorSinkConstructorNil
+	}
+	if name == metadata.ReplicationTypeXmem || name == metadata.ReplicationTypeCapi {
+		// names of built-in replication types are reserved
+		return base.ErrorSinkAlreadyRegistered(name)
+	}
+
+	sinkRegistryLock.Lock()
+	defer sinkRegistryLock.Unlock()
+	err := base.RegisterSink(name)
+	if err != nil {
+		return err
+	}
+	sinkRegistry[name] = constructor
+	return nil
+}
+
+// GetSinkConstructor returns the constructor of the sink registered under the specified name
+func GetSinkConstructor(name string) (SinkConstructor, error) {
+	sinkRegistryLock.RLock()
+	constructor, ok := sinkRegistry[name]
+	sinkRegistryLock.RUnlock()
+	if !ok {
+		return nil, base.ErrorSinkNotFound(name)
+	}
+	return constructor, nil
+}
+
+// default configuration
+const default_statsInterval_sink = 1000 * time.Millisecond
+
+var sink_setting_defs base.SettingDefinitions = base.SettingDefinitions{SETTING_BATCHCOUNT: base.NewSettingDef(reflect.TypeOf((*int)(nil)), true),
+	SETTING_BATCHSIZE:  base.NewSettingDef(reflect.TypeOf((*int)(nil)), true),
+	SETTING_NUMOFRETRY: base.NewSettingDef(reflect.TypeOf((*int)(nil)), false)}
+
+/************************************
+/* struct sinkConfig
+*************************************/
+type sinkConfig struct {
+	baseConfig
+	// backoff time before the first retry of a failed write
+	retryInterval time.Duration
+	// vbuckets that the nozzle is responsible for
+	vbList []uint16
+}
+
+func newSinkConfig(logger *log.CommonLogger) sinkConfig {
+	return sinkConfig{
+		baseConfig: baseConfig{maxCount: -1,
+			maxSize:       -1,
+			maxRetry:      base.SinkMaxRetry,
+			statsInterval: default_statsInterval_sink,
+			logger:        logger,
+		},
+		retryInterval: base.SinkInitialBackoffTime,
+	}
+}
+
+func (config *sinkConfig) initializeConfig(settings metadata.ReplicationSettingsMap, utils utilities.UtilsIface) error {
+	err := utils.ValidateSettings(sink_setting_defs, settings, config.logger)
+	if err == nil {
+		config.baseConfig.initializeConfig(settings)
+	}
+	return err
+}
+
+/************************************
+/* struct SinkNozzle
+*************************************/
+type SinkNozzle struct {
+	AbstractPart
+
+	bOpen      bool
+	lock_bOpen sync.RWMutex
+
+	// name of the sink, which is the replication type of the replication
+	sinkName string
+	sink     Sink
+
+	//data channels to accept the incoming data, one for each vb
+	vb_dataChan_map map[uint16]chan *base.WrappedMCRequest
+	//the total number of items queued in all data channels
+	items_in_dataChan int32
+	//the total size of data (in bytes) queued in all data channels
+	bytes_in_dataChan int64
+
+	config sinkConfig
+
+	//queue for ready batches
+	batches_ready chan *capiBatch
+
+	batches_nonempty_ch chan bool
+
+	//batches to be accumulated, one for each vb
+	vb_batch_map      map[uint16]*capiBatch
+	vb_batch_map_lock chan bool
+
+	childrenWaitGrp sync.WaitGroup
+
+	finish_ch chan bool
+
+	counter_sent      uint32
+	counter_received  uint32
+	handle_error      bool
+	lock_handle_error sync.RWMutex
+	dataObj_recycler  base.DataObjRecycler
+	topic             string
+
+	utils utilities.UtilsIface
+}
+
+func NewSinkNozzle(id string,
+	topic string,
+	sinkName string,
+	sink Sink,
+	vbList []uint16,
+	dataObj_recycler base.DataObjRecycler,
+	logger_context *log.LoggerContext,
+	utilsIn utilities.UtilsIface) *SinkNozzle {
+
+	part := NewAbstractPartWithLogger(id, log.NewLogger("SinkNozzle", logger_context))
+
+	sinkNozzle := &SinkNozzle{
+		AbstractPart:        part,
+		bOpen:               true,
+		sinkName:            sinkName,
+		sink:                sink,
+		config:              newSinkConfig(part.Logger()),
+		finish_ch:           make(chan bool, 1),
+		batches_nonempty_ch: make(chan bool, 1),
+		handle_error:        true,
+		dataObj_recycler:    dataObj_recycler,
+		topic:               topic,
+		utils:               utilsIn,
+	}
+	sinkNozzle.config.vbList = vbList
+
+	return sinkNozzle
+}
+
+func (sinkNozzle *SinkNozzle) SinkName() string {
+	return sinkNozzle.sinkName
+}
+
+func (sinkNozzle *SinkNozzle) IsOpen() bool {
+	sinkNozzle.lock_bOpen.RLock()
+	defer sinkNozzle.lock_bOpen.RUnlock()
+	return sinkNozzle.bOpen
+}
+
+func (sinkNozzle *SinkNozzle) Open() error {
+	sinkNozzle.lock_bOpen.Lock()
+	defer sinkNozzle.lock_bOpen.Unlock()
+	sinkNozzle.bOpen = true
+	return nil
+}
+
+func (sinkNozzle *SinkNozzle) Close() error {
+	sinkNozzle.lock_bOpen.Lock()
+	defer sinkNozzle.lock_bOpen.Unlock()
+	sinkNozzle.bOpen = false
+	return nil
+}
+
+func (sinkNozzle *SinkNozzle) handleError() bool {
+	sinkNozzle.lock_handle_error.RLock()
+	defer sinkNozzle.lock_handle_error.RUnlock()
+	return sinkNozzle.handle_error
+}
+
+func (sinkNozzle *SinkNozzle) disableHandleError() {
+	sinkNozzle.lock_handle_error.Lock()
+	defer sinkNozzle.lock_handle_error.Unlock()
+	sinkNozzle.handle_error = false
+}
+
+func (sinkNozzle *SinkNozzle) Start(settings metadata.ReplicationSettingsMap) error {
+	sinkNozzle.Logger().Infof("%v starting ....\n", sinkNozzle.Id())
+
+	err := sinkNozzle.SetState(common.Part_Starting)
+	if err != nil {
+		return err
+	}
+
+	err = sinkNozzle.initialize(settings)
+	if err != nil {
+		return err
+	}
+
+	err = sinkNozzle.sink.Open()
+	if err != nil {
+		sinkNozzle.Logger().Errorf("%v failed to open sink %v. err=%v\n", sinkNozzle.Id(), sinkNozzle.sinkName, err)
+		return err
+	}
+
+	sinkNozzle.Logger().Infof("%v initialized\n", sinkNozzle.Id())
+
+	sinkNozzle.childrenWaitGrp.Add(1)
+	go sinkNozzle.selfMonitor(sinkNozzle.finish_ch, &sinkNozzle.childrenWaitGrp)
+
+	sinkNozzle.childrenWaitGrp.Add(1)
+	go sinkNozzle.processData_batch(sinkNozzle.finish_ch, &sinkNozzle.childrenWaitGrp)
+
+	err = sinkNozzle.SetState(common.Part_Running)
+	if err != nil {
+		sinkNozzle.Logger().Errorf("%v failed to set state to running. err=%v\n", sinkNozzle.Id(), err)
+		return err
+	}
+
+	sinkNozzle.Logger().Infof("%v has been started successfully\n", sinkNozzle.Id())
+	return nil
+}
+
+func (sinkNozzle *SinkNozzle) Stop() error {
+	sinkNozzle.Logger().Infof("%v stopping \n", sinkNozzle.Id())
+
+	err := sinkNozzle.SetState(common.Part_Stopping)
+	if err != nil {
+		return err
+	}
+
+	//close data channels
+	for _, dataChan := range sinkNozzle.vb_dataChan_map {
+		close(dataChan)
+	}
+
+	if sinkNozzle.batches_ready != nil {
+		close(sinkNozzle.batches_ready)
+	}
+
+	sinkNozzle.onExit()
+
+	err = sinkNozzle.SetState(common.Part_Stopped)
+	if err == nil {
+		sinkNozzle.Logger().Infof("%v has been stopped\n", sinkNozzle.Id())
+	} else {
+		sinkNozzle.Logger().Errorf("%v failed to stop. err=%v\n", sinkNozzle.Id(), err)
+	}
+
+	return err
+}
+
+func (sinkNozzle *SinkNozzle) initialize(settings metadata.ReplicationSettingsMap) error {
+	err := sinkNozzle.config.initializeConfig(settings, sinkNozzle.utils)
+	if err != nil {
+		return err
+	}
+
+	sinkNozzle.vb_dataChan_map = make(map[uint16]chan *base.WrappedMCRequest)
+	sinkNozzle.vb_batch_map = make(map[uint16]*capiBatch)
+	sinkNozzle.vb_batch_map_lock = make(chan bool, 1)
+	for _, vbno := range sinkNozzle.config.vbList {
+		sinkNozzle.vb_dataChan_map[vbno] = make(chan *base.WrappedMCRequest, sinkNozzle.config.maxCount*base.SinkDataChanSizeMultiplier)
+		sinkNozzle.initNewBatch(vbno)
+	}
+	sinkNozzle.items_in_dataChan = 0
+	sinkNozzle.bytes_in_dataChan = 0
+	sinkNozzle.batches_ready = make(chan *capiBatch, len(sinkNozzle.config.vbList)*10)
+
+	return nil
+}
+
+func (sinkNozzle *SinkNozzle) initNewBatch(vbno uint16) {
+	sinkNozzle.vb_batch_map[vbno] = &capiBatch{*newBatch(uint32(sinkNozzle.config.maxCount), uint32(sinkNozzle.config.maxSize), sinkNozzle.Logger()), vbno}
+}
+
+// Coming from Router's Forward
+func (sinkNozzle *SinkNozzle) Receive(data interface{}) error {
+	// the attempt to write to dataChan may panic if dataChan has been closed
+	defer func() {
+		if r := recover(); r != nil {
+			sinkNozzle.Logger().Errorf("%v recovered from %v", sinkNozzle.Id(), r)
+			if sinkNozzle.validateRunningState() == nil {
+				// report error only when nozzle is still in running state
+				sinkNozzle.handleGeneralError(errors.New(fmt.Sprintf("%v", r)))
+			}
+		}
+	}()
+
+	req := data.(*base.WrappedMCRequest)
+	vbno := req.Req.VBucket
+
+	dataChan, ok := sinkNozzle.vb_dataChan_map[vbno]
+	if !ok {
+		err := fmt.Errorf("%v received a request with unexpected vb %v", sinkNozzle.Id(), vbno)
+		sinkNozzle.handleGeneralError(err)
+		return err
+	}
+
+	err := sinkNozzle.validateRunningState()
+	if err != nil {
+		sinkNozzle.Logger().Infof("%v is in %v state, Recieve did no-op", sinkNozzle.Id(), sinkNozzle.State())
+		return err
+	}
+
+	atomic.AddUint32(&sinkNozzle.counter_received, 1)
+	atomic.AddInt32(&sinkNozzle.items_in_dataChan, 1)
+	atomic.AddInt64(&sinkNozzle.bytes_in_dataChan, int64(req.Req.Size()))
+
+	select {
+	case dataChan <- req:
+	// provides an alternative exit path when nozzle stops
+	case <-sinkNozzle.finish_ch:
+		return PartStoppedError
+	}
+
+	//accumulate the batchCount and batchSize
+	err = sinkNozzle.accumuBatch(vbno, req)
+	if err != nil {
+		sinkNozzle.handleGeneralError(err)
+	}
+	return err
+}
+
+func (sinkNozzle *SinkNozzle) accumuBatch(vbno uint16, request *base.WrappedMCRequest) error {
+	sinkNozzle.vb_batch_map_lock <- true
+	defer func() { <-sinkNozzle.vb_batch_map_lock }()
+
+	// there is no source side conflict resolution for sinks. all requests are treated as optimistic
+	_, isFirst, isFull, err := sinkNozzle.vb_batch_map[vbno].accumuBatch(request, sinkNozzle.optimisticRep)
+	if err != nil {
+		return err
+	}
+
+	if isFirst {
+		select {
+		case sinkNozzle.batches_nonempty_ch <- true:
+		default:
+			// batches_nonempty_ch is already flagged.
+		}
+	}
+
+	if isFull {
+		sinkNozzle.batchReady(vbno)
+	}
+	return nil
+}
+
+// moves the batch of vb to ready batches channel. vb_batch_map_lock needs to be held by caller
+func (sinkNozzle *SinkNozzle) batchReady(vbno uint16) {
+	defer func() {
+		if r := recover(); r != nil {
+			if sinkNozzle.validateRunningState() == nil {
+				sinkNozzle.handleGeneralError(errors.New(fmt.Sprintf("%v", r)))
+			}
+		}
+	}()
+
+	batch := sinkNozzle.vb_batch_map[vbno]
+	if batch.count() > 0 {
+		sinkNozzle.batches_ready <- batch
+		sinkNozzle.initNewBatch(vbno)
+	}
+}
+
+func (sinkNozzle *SinkNozzle) processData_batch(finch chan bool, waitGrp *sync.WaitGroup) {
+	sinkNozzle.Logger().Infof("%v processData starts..........\n", sinkNozzle.Id())
+	defer waitGrp.Done()
+	for {
+		select {
+		case <-finch:
+			goto done
+		case batch, ok := <-sinkNozzle.batches_ready:
+			if !ok {
+				goto done
+			}
+			if sinkNozzle.validateRunningState() != nil {
+				goto done
+			}
+			if sinkNozzle.IsOpen() {
+				err := sinkNozzle.batchSendWithRetry(batch, finch)
+				if err != nil {
+					if err != PartStoppedError {
+						sinkNozzle.handleGeneralError(err)
+					}
+					goto done
+				}
+			}
+		// get the largest non-full batch and start processing it
+		case <-sinkNozzle.batches_nonempty_ch:
+			if sinkNozzle.validateRunningState() != nil {
+				goto done
+			}
+
+			if len(sinkNozzle.batches_ready) == 0 {
+				select {
+				case sinkNozzle.vb_batch_map_lock <- true:
+					var max_count uint32
+					var max_batch_vbno uint16
+					for vbno, batch := range sinkNozzle.vb_batch_map {
+						if batch.count() > max_count {
+							max_count = batch.count()
+							max_batch_vbno = vbno
+						}
+					}
+					if max_count > 0 {
+						sinkNozzle.batchReady(max_batch_vbno)
+					}
+					<-sinkNozzle.vb_batch_map_lock
+				default:
+					// Receive is accumulating batches. do not block, since it may be waiting for ready batches to be processed
+				}
+			}
+
+			// put a token back into batches_nonempty_ch if there is at least one non-empty batch remaining
+			if sinkNozzle.checkIfNonEmptyBatchExist() {
+				select {
+				case sinkNozzle.batches_nonempty_ch <- true:
+				default:
+				}
+			}
+		}
+	}
+
+done:
+	sinkNozzle.Logger().Infof("%v processData_batch exits\n", sinkNozzle.Id())
+}
+
+func (sinkNozzle *SinkNozzle) checkIfNonEmptyBatchExist() bool {
+	select {
+	case sinkNozzle.vb_batch_map_lock <- true:
+		defer func() { <-sinkNozzle.vb_batch_map_lock }()
+		for _, batch := range sinkNozzle.vb_batch_map {
+			if batch.count() > 0 {
+				return true
+			}
+		}
+		return false
+	default:
+		// if cannot acquire lock on batch_map, return true to ensure that we will be checking again in the next iteration
+		return true
+	}
+}
+
+// takes the requests in batch out of data channel, writes them to sink with retry,
+// and raises DataSent events, which drive stats and checkpointing, once the write succeeds
+func (sinkNozzle *SinkNozzle) batchSendWithRetry(batch *capiBatch, finch chan bool) error {
+	vbno := batch.vbno
+	count := int(batch.count())
+	dataChan := sinkNozzle.vb_dataChan_map[vbno]
+
+	req_list := make([]*base.WrappedMCRequest, 0, count)
+	records := make([]*SinkRecord, 0, count)
+	for i := 0; i < count; i++ {
+		req, ok := <-dataChan
+		if !ok {
+			return PartStoppedError
+		}
+		atomic.AddInt32(&sinkNozzle.items_in_dataChan, -1)
+		atomic.AddInt64(&sinkNozzle.bytes_in_dataChan, int64(0-req.Req.Size()))
+
+		record, err := NewSinkRecord(req)
+		if err != nil {
+			sinkNozzle.Logger().Errorf("%v unable to convert document %v%s%v in vb %v for sink. err=%v", sinkNozzle.Id(), base.UdTagBegin, req.Req.Key, base.UdTagEnd, vbno, err)
+			return err
+		}
+		req_list = append(req_list, req)
+		records = append(records, record)
+	}
+
+	// retried the same way as batches of capi nozzle. sinks keep their own connections, hence nothing to reset
+	writeFunc := func() error {
+		return sinkNozzle.sink.Write(vbno, records)
+	}
+	err := retryBatchSend(sinkNozzle, vbno, writeFunc, nil, sinkNozzle.config.maxRetry, sinkNozzle.config.retryInterval, finch)
+	if err == PartStoppedError {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("%v failed to write %v documents in vb %v to sink %v. err=%v", sinkNozzle.Id(), len(records), vbno, sinkNozzle.sinkName, err)
+	}
+
+	for _, req := range req_list {
+		additionalInfo := DataSentEventAdditional{Seqno: req.Seqno,
+			IsOptRepd:   true,
+			Commit_time: time.Since(req.Start_time),
+			Opcode:      req.Req.Opcode,
+			IsExpirySet: (binary.BigEndian.Uint32(req.Req.Extras[4:8]) != 0),
+			VBucket:     req.Req.VBucket,
+			Req_size:    req.Req.Size(),
+		}
+		sinkNozzle.RaiseEvent(common.NewEvent(common.DataSent, nil, sinkNozzle, nil, additionalInfo))
+		sinkNozzle.recycleDataObj(req)
+	}
+	atomic.AddUint32(&sinkNozzle.counter_sent, uint32(len(req_list)))
+	return nil
+}
+
+func (sinkNozzle *SinkNozzle) onExit() {
+	//in the process of stopping, no need to report any error to replication manager anymore
+	sinkNozzle.disableHandleError()
+
+	//notify the data processing routine
+	close(sinkNozzle.finish_ch)
+	sinkNozzle.childrenWaitGrp.Wait()
+
+	err := sinkNozzle.sink.Close()
+	if err != nil {
+		sinkNozzle.Logger().Warnf("%v failed to close sink %v. err=%v", sinkNozzle.Id(), sinkNozzle.sinkName, err)
+	}
+}
+
+func (sinkNozzle *SinkNozzle) selfMonitor(finch chan bool, waitGrp *sync.WaitGroup) {
+	defer waitGrp.Done()
+	statsTicker := time.NewTicker(sinkNozzle.config.statsInterval)
+	defer statsTicker.Stop()
+	for {
+		select {
+		case <-finch:
+			goto done
+		case <-statsTicker.C:
+			sinkNozzle.RaiseEvent(common.NewEvent(common.StatsUpdate, nil, sinkNozzle, nil, []int{int(atomic.LoadInt32(&sinkNozzle.items_in_dataChan)), int(atomic.LoadInt64(&sinkNozzle.bytes_in_dataChan))}))
+		}
+	}
+done:
+	sinkNozzle.Logger().Infof("%v selfMonitor routine exits", sinkNozzle.Id())
+}
+
+func (sinkNozzle *SinkNozzle) validateRunningState() error {
+	state := sinkNozzle.State()
+	if state == common.Part_Stopping || state == common.Part_Stopped || state == common.Part_Error {
+		return PartStoppedError
+	}
+	return nil
+}
+
+func (sinkNozzle *SinkNozzle) optimisticRep(req *mc.MCRequest) bool {
+	return true
+}
+
+func (sinkNozzle *SinkNozzle) PrintStatusSummary() {
+	sinkNozzle.Logger().Infof("%v received %v items, sent %v items to sink %v", sinkNozzle.Id(), atomic.LoadUint32(&sinkNozzle.counter_received), atomic.LoadUint32(&sinkNozzle.counter_sent), sinkNozzle.sinkName)
+}
+
+func (sinkNozzle *SinkNozzle) handleGeneralError(err error) {
+	if sinkNozzle.handleError() {
+		err1 := sinkNozzle.SetState(common.Part_Error)
+		if err1 == nil {
+			sinkNozzle.Logger().Errorf("%v raise error condition %v\n", sinkNozzle.Id(), err)
+			sinkNozzle.RaiseEvent(common.NewEvent(common.ErrorEncountered, nil, sinkNozzle, nil, err))
+		} else {
+			sinkNozzle.Logger().Infof("%v is already in error state. err=%v is ignored\n", sinkNozzle.Id(), err)
+		}
+	} else {
+		sinkNozzle.Logger().Infof("%v is already in shutdown process, err=%v is ignored\n", sinkNozzle.Id(), err)
+	}
+}
+
+func (sinkNozzle *SinkNozzle) UpdateSettings(settings metadata.ReplicationSettingsMap) error {
+	return nil
+}
+
+func (sinkNozzle *SinkNozzle) recycleDataObj(req *base.WrappedMCRequest) {
+	if sinkNozzle.dataObj_recycler != nil {
+		sinkNozzle.dataObj_recycler(sinkNozzle.topic, req)
+	}
+}
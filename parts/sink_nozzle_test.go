@@ -0,0 +1,313 @@
+// +build !pcre
+
+package parts
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mc "github.com/couchbase/gomemcached"
+	base "github.com/couchbase/goxdcr/base"
+	common "github.com/couchbase/goxdcr/common"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/metadata"
+	utilsMock "github.com/couchbase/goxdcr/utils/mocks"
+	"github.com/stretchr/testify/assert"
+	mock "github.com/stretchr/testify/mock"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+var sinkTestLogger = log.NewLogger("SinkTest", log.DefaultLoggerContext)
+
+// sink that records written mutations in memory, and fails the specified number of writes first
+type memorySink struct {
+	lock       sync.Mutex
+	records    map[uint16][]SinkRecord
+	failWrites int
+}
+
+func (sink *memorySink) Open() error {
+	sink.records = make(map[uint16][]SinkRecord)
+	return nil
+}
+
+func (sink *memorySink) Write(vbno uint16, records []*SinkRecord) error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	if sink.failWrites > 0 {
+		sink.failWrites--
+		return errors.New("write failed")
+	}
+	for _, record := range records {
+		sink.records[vbno] = append(sink.records[vbno], *record)
+	}
+	return nil
+}
+
+func (sink *memorySink) Close() error {
+	return nil
+}
+
+func (sink *memorySink) count() int {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	count := 0
+	for _, records := range sink.records {
+		count += len(records)
+	}
+	return count
+}
+
+type dataSentListener struct {
+	lock   sync.Mutex
+	seqnos map[uint16][]uint64
+}
+
+func (listener *dataSentListener) OnEvent(event *common.Event) {
+	listener.lock.Lock()
+	defer listener.lock.Unlock()
+	additional := event.OtherInfos.(DataSentEventAdditional)
+	listener.seqnos[additional.VBucket] = append(listener.seqnos[additional.VBucket], additional.Seqno)
+}
+
+func composeSinkTestRequest(key string, vbno uint16, seqno uint64, opcode mc.CommandCode, dataType uint8, body []byte) *base.WrappedMCRequest {
+	extras := make([]byte, 24)
+	binary.BigEndian.PutUint32(extras[0:4], 7)
+	binary.BigEndian.PutUint64(extras[8:16], 3)
+	binary.BigEndian.PutUint64(extras[16:24], 1000+seqno)
+	return &base.WrappedMCRequest{
+		Seqno:      seqno,
+		Start_time: time.Now(),
+		Req: &mc.MCRequest{
+			Opcode:   opcode,
+			VBucket:  vbno,
+			Key:      []byte(key),
+			Extras:   extras,
+			DataType: dataType,
+			Body:     body,
+		},
+	}
+}
+
+func composeXattrSection(xattrs [][2]string) []byte {
+	section := make([]byte, 4)
+	for _, xattr := range xattrs {
+		pair := append(append(append([]byte(xattr[0]), 0), []byte(xattr[1])...), 0)
+		pairSize := make([]byte, 4)
+		binary.BigEndian.PutUint32(pairSize, uint32(len(pair)))
+		section = append(section, pairSize...)
+		section = append(section, pair...)
+	}
+	binary.BigEndian.PutUint32(section[0:4], uint32(len(section)-4))
+	return section
+}
+
+func TestRegisterSink(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestRegisterSink =================")
+
+	constructor := func(params *SinkParams, logger *log.CommonLogger) (Sink, error) {
+		return &memorySink{}, nil
+	}
+
+	assert.Equal(base.ErrorSinkNameEmpty, RegisterSink("", constructor))
+	assert.Equal(ErrorSinkConstructorNil, RegisterSink("memory", nil))
+	assert.NotNil(RegisterSink(metadata.ReplicationTypeXmem, constructor))
+	assert.NotNil(base.ValidateSink("memory"))
+
+	assert.Nil(RegisterSink("memory", constructor))
+	assert.NotNil(RegisterSink("memory", constructor))
+	assert.Nil(base.ValidateSink("memory"))
+	assert.Contains(base.SinkNames(), "memory")
+	sinkConstructor, err := GetSinkConstructor("memory")
+	assert.Nil(err)
+	assert.NotNil(sinkConstructor)
+
+	fmt.Println("============== Test case end: TestRegisterSink =================")
+}
+
+func TestNewSinkRecord(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestNewSinkRecord =================")
+
+	doc := []byte(`{"name":"value"}`)
+	record, err := NewSinkRecord(composeSinkTestRequest("doc1", 10, 5, mc.UPR_MUTATION, base.JSONDataType, doc))
+	assert.Nil(err)
+	assert.Equal("doc1", record.Key)
+	assert.Equal(uint16(10), record.VBucket)
+	assert.Equal(uint64(5), record.Seqno)
+	assert.Equal(uint64(3), record.RevSeqno)
+	assert.Equal(uint64(1005), record.Cas)
+	assert.Equal(uint32(7), record.Flags)
+	assert.False(record.Deleted)
+	assert.Equal(json.RawMessage(doc), record.Doc)
+	assert.Nil(record.Binary)
+
+	body := append(composeXattrSection([][2]string{{"_sync", `{"rev":1}`}, {"empty", ""}}), []byte("binary")...)
+	record, err = NewSinkRecord(composeSinkTestRequest("doc2", 10, 6, mc.UPR_MUTATION, base.XattrDataType, body))
+	assert.Nil(err)
+	assert.Equal(map[string]string{"_sync": `{"rev":1}`, "empty": ""}, record.Xattrs)
+	assert.Equal([]byte("binary"), record.Binary)
+	assert.Nil(record.Doc)
+
+	record, err = NewSinkRecord(composeSinkTestRequest("doc3", 10, 7, mc.UPR_EXPIRATION, 0, nil))
+	assert.Nil(err)
+	assert.True(record.Deleted)
+	assert.True(record.Expired)
+
+	_, err = NewSinkRecord(composeSinkTestRequest("doc4", 10, 8, mc.UPR_MUTATION, base.XattrDataType, []byte{0, 0, 0, 9, 1}))
+	assert.Equal(ErrorInvalidXattrSection, err)
+
+	fmt.Println("============== Test case end: TestNewSinkRecord =================")
+}
+
+func TestFileSink(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestFileSink =================")
+
+	rootDir, err := ioutil.TempDir("", "fileSinkTest")
+	assert.Nil(err)
+	defer os.RemoveAll(rootDir)
+
+	topic := "uuid/sourceBucket/targetBucket"
+	sink, err := NewFileSinkConstructor(rootDir)(&SinkParams{Topic: topic, VBList: []uint16{1, 2}}, sinkTestLogger)
+	assert.Nil(err)
+	assert.Nil(sink.Open())
+
+	record1, _ := NewSinkRecord(composeSinkTestRequest("doc1", 1, 5, mc.UPR_MUTATION, base.JSONDataType, []byte(`{"a":1}`)))
+	record2, _ := NewSinkRecord(composeSinkTestRequest("doc2", 1, 6, mc.UPR_DELETION, 0, nil))
+	record3, _ := NewSinkRecord(composeSinkTestRequest("doc3", 2, 3, mc.UPR_MUTATION, 0, []byte("<a/>")))
+	assert.Nil(sink.Write(1, []*SinkRecord{record1}))
+	assert.Nil(sink.Write(1, []*SinkRecord{record2}))
+	assert.Nil(sink.Write(2, []*SinkRecord{record3}))
+	assert.Nil(sink.Close())
+
+	readRecords := func(vbno uint16) []*SinkRecord {
+		file, err := os.Open(GetFileSinkFileName(GetFileSinkDir(rootDir, topic), vbno))
+		assert.Nil(err)
+		defer file.Close()
+		records := make([]*SinkRecord, 0)
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			record := &SinkRecord{}
+			assert.Nil(json.Unmarshal(scanner.Bytes(), record))
+			records = append(records, record)
+		}
+		return records
+	}
+
+	records := readRecords(1)
+	assert.Equal(2, len(records))
+	assert.Equal("doc1", records[0].Key)
+	assert.Equal(json.RawMessage(`{"a":1}`), records[0].Doc)
+	assert.Equal("doc2", records[1].Key)
+	assert.True(records[1].Deleted)
+
+	records = readRecords(2)
+	assert.Equal(1, len(records))
+	assert.Equal([]byte("<a/>"), records[0].Binary)
+
+	fmt.Println("============== Test case end: TestFileSink =================")
+}
+
+func TestSinkNozzle(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestSinkNozzle =================")
+
+	utils := &utilsMock.UtilsIface{}
+	utils.On("ValidateSettings", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	sink := &memorySink{failWrites: 1}
+	retryInterval := base.SinkInitialBackoffTime
+	base.SinkInitialBackoffTime = 10 * time.Millisecond
+	defer func() { base.SinkInitialBackoffTime = retryInterval }()
+
+	nozzle := NewSinkNozzle("sink_testTopic_0", "testTopic", "memory", sink, []uint16{1, 2}, nil, log.DefaultLoggerContext, utils)
+	listener := &dataSentListener{seqnos: make(map[uint16][]uint64)}
+	nozzle.RegisterComponentEventListener(common.DataSent, listener)
+
+	settings := metadata.ReplicationSettingsMap{SETTING_BATCHCOUNT: 3, SETTING_BATCHSIZE: 1024, SETTING_STATS_INTERVAL: 1000}
+	assert.Nil(nozzle.Start(settings))
+
+	numOfDocs := 10
+	for i := 1; i <= numOfDocs; i++ {
+		vbno := uint16(i%2 + 1)
+		assert.Nil(nozzle.Receive(composeSinkTestRequest(fmt.Sprintf("doc%v", i), vbno, uint64(i), mc.UPR_MUTATION, base.JSONDataType, []byte(`{}`))))
+	}
+
+	// partial batches are written too
+	for i := 0; i < 100 && sink.count() < numOfDocs; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.Equal(numOfDocs, sink.count())
+	assert.Nil(nozzle.Stop())
+
+	// mutations are written and reported in seqno order
+	listener.lock.Lock()
+	defer listener.lock.Unlock()
+	for vbno, records := range sink.records {
+		seqnos := make([]uint64, 0, len(records))
+		for _, record := range records {
+			seqnos = append(seqnos, record.Seqno)
+		}
+		assert.Equal(seqnos, listener.seqnos[vbno])
+		for i := 1; i < len(seqnos); i++ {
+			assert.True(seqnos[i] > seqnos[i-1])
+		}
+	}
+
+	fmt.Println("============== Test case end: TestSinkNozzle =================")
+}
+
+func TestRetryBatchSend(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestRetryBatchSend =================")
+
+	nozzle := NewSinkNozzle("sink_testTopic_0", "testTopic", "memory", &memorySink{}, []uint16{1}, nil, log.DefaultLoggerContext, nil)
+	finch := make(chan bool)
+
+	// failed sends are retried after reset, until they succeed
+	numOfSends, numOfResets := 0, 0
+	sendFunc := func() error {
+		numOfSends++
+		if numOfSends < 3 {
+			return errors.New("send failed")
+		}
+		return nil
+	}
+	resetFunc := func() error {
+		numOfResets++
+		return nil
+	}
+	assert.Nil(retryBatchSend(nozzle, 1, sendFunc, resetFunc, 2, time.Millisecond, finch))
+	assert.Equal(3, numOfSends)
+	assert.Equal(2, numOfResets)
+
+	// up to max retry
+	numOfSends = 0
+	assert.NotNil(retryBatchSend(nozzle, 1, sendFunc, nil, 1, time.Millisecond, finch))
+	assert.Equal(2, numOfSends)
+
+	// non-retriable errors are returned right away
+	numOfSends = 0
+	nonRetriableFunc := func() error {
+		numOfSends++
+		return &SinkNonRetriableError{errors.New("rejected")}
+	}
+	err := retryBatchSend(nozzle, 1, nonRetriableFunc, nil, 2, time.Millisecond, finch)
+	_, ok := err.(*SinkNonRetriableError)
+	assert.True(ok)
+	assert.Equal(1, numOfSends)
+
+	// retries stop when nozzle stops
+	close(finch)
+	assert.Equal(PartStoppedError, retryBatchSend(nozzle, 1, sendFunc, nil, 2, time.Hour, finch))
+
+	fmt.Println("============== Test case end: TestRetryBatchSend =================")
+}
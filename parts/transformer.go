@@ -0,0 +1,294 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package parts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mc "github.com/couchbase/gomemcached"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/metadata"
+	utilities "github.com/couchbase/goxdcr/utils"
+	"github.com/golang/snappy"
+	"time"
+)
+
+// max length of document key allowed by memcached
+const MaxTransformedKeyLength = 250
+
+var ErrorTransformedKeyTooLong = fmt.Errorf("Transformed document key is empty or longer than %v bytes", MaxTransformedKeyLength)
+var ErrorInvalidXattrSection = errors.New("Unable to parse xattrs of document")
+
+// Transformer applies the transformation rules of a replication to the memcached requests composed by router
+// it is accessed only by the routing routine of the router that owns it
+type Transformer struct {
+	id         string
+	keyRules   []*metadata.TransformationRule
+	fieldRules []*metadata.TransformationRule
+	xattrs     map[string]bool
+	ttl        uint32
+	dp         utilities.DataPoolIface
+}
+
+func NewTransformer(id string, rules string) (*Transformer, error) {
+	ruleList, err := metadata.ParseTransformationRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	dpPtr := utilities.NewDataPool()
+	if dpPtr == nil {
+		return nil, base.ErrorNoDataPool
+	}
+
+	transformer := &Transformer{
+		id:     id,
+		xattrs: make(map[string]bool),
+		dp:     dpPtr,
+	}
+	for _, rule := range ruleList {
+		switch rule.Type {
+		case metadata.TransformKeyPrefix, metadata.TransformKeyRename:
+			transformer.keyRules = append(transformer.keyRules, rule)
+		case metadata.TransformDropField, metadata.TransformMaskField:
+			transformer.fieldRules = append(transformer.fieldRules, rule)
+		case metadata.TransformStripXattr:
+			transformer.xattrs[rule.Xattr] = true
+		case metadata.TransformSetTTL:
+			// the last setTTL rule wins
+			transformer.ttl = rule.TTL
+		}
+	}
+	return transformer, nil
+}
+
+// whether the transformation rules set the expiry of documents, which makes the expiry of target documents
+// depend on the time when the documents are replicated
+func (transformer *Transformer) SetsTTL() bool {
+	return transformer.ttl > 0
+}
+
+// whether the transformation rules change document keys, in which case the target vbucket of a document
+// needs to be computed from its new key
+func (transformer *Transformer) ChangesKeys() bool {
+	return len(transformer.keyRules) > 0
+}
+
+// TransformMCRequest applies the transformation rules to req in place
+// returns whether req has been changed. req is not changed when error is returned
+// the vbucket of req is not changed when its key is changed, and is left for the caller to recompute
+func (transformer *Transformer) TransformMCRequest(req *mc.MCRequest) (bool, error) {
+	if req.Opcode != mc.UPR_MUTATION && req.Opcode != mc.UPR_DELETION && req.Opcode != mc.UPR_EXPIRATION {
+		return false, nil
+	}
+
+	key := req.Key
+	for _, rule := range transformer.keyRules {
+		key = rule.TransformKey(key)
+	}
+	if len(key) == 0 || len(key) > MaxTransformedKeyLength {
+		return false, ErrorTransformedKeyTooLong
+	}
+	keyChanged := !bytes.Equal(key, req.Key)
+
+	body, dataType, bodyChanged, err := transformer.transformBody(req)
+	if err != nil {
+		return false, err
+	}
+
+	if keyChanged {
+		req.Key = key
+	}
+	if bodyChanged {
+		req.Body = body
+		req.DataType = dataType
+	}
+	ttlSet := req.Opcode == mc.UPR_MUTATION && transformer.ttl > 0 && len(req.Extras) >= 8
+	if ttlSet {
+		// expiry in the extras of SetWithMeta is always absolute unix time, unlike the expiry of Set
+		binary.BigEndian.PutUint32(req.Extras[4:8], uint32(time.Now().Unix())+transformer.ttl)
+	}
+	return keyChanged || bodyChanged || ttlSet, nil
+}
+
+// returns the new body and data type of req after xattrs are stripped and field rules are applied
+// the new body is not compressed
+func (transformer *Transformer) transformBody(req *mc.MCRequest) ([]byte, uint8, bool, error) {
+	hasXattr := req.DataType&base.XattrDataType > 0
+	isJson := req.DataType&base.JSONDataType > 0
+	needToStripXattr := hasXattr && len(transformer.xattrs) > 0
+	needToTransformFields := isJson && req.Opcode == mc.UPR_MUTATION && len(transformer.fieldRules) > 0
+	if !needToStripXattr && !needToTransformFields {
+		return nil, 0, false, nil
+	}
+
+	value := req.Body
+	if req.DataType&base.SnappyDataType > 0 {
+		decodedLen, err := snappy.DecodedLen(req.Body)
+		if err != nil {
+			return nil, 0, false, base.ErrorCompressionUnableToInflate
+		}
+		decodeBuf, err := transformer.dp.GetByteSlice(uint64(decodedLen))
+		if err != nil {
+			decodeBuf = make([]byte, decodedLen)
+		} else {
+			// new body never refers to decodeBuf, which can be released once transformation is done
+			defer transformer.dp.PutByteSlice(decodeBuf)
+		}
+		value, err = snappy.Decode(decodeBuf, req.Body)
+		if err != nil {
+			return nil, 0, false, base.ErrorCompressionUnableToInflate
+		}
+	}
+
+	xattrSection, docBody := []byte(nil), value
+	if hasXattr {
+		if len(value) < 4 || int(binary.BigEndian.Uint32(value[0:4]))+4 > len(value) {
+			return nil, 0, false, ErrorInvalidXattrSection
+		}
+		xattrSectionSize := int(binary.BigEndian.Uint32(value[0:4])) + 4
+		xattrSection, docBody = value[:xattrSectionSize], value[xattrSectionSize:]
+	}
+
+	xattrStripped := false
+	if needToStripXattr {
+		var err error
+		xattrSection, xattrStripped, err = transformer.stripXattrs(xattrSection)
+		if err != nil {
+			return nil, 0, false, err
+		}
+	}
+
+	fieldsChanged := false
+	if needToTransformFields {
+		var err error
+		docBody, fieldsChanged, err = transformer.transformFields(docBody)
+		if err != nil {
+			return nil, 0, false, err
+		}
+	}
+
+	if !xattrStripped && !fieldsChanged {
+		return nil, 0, false, nil
+	}
+
+	dataType := req.DataType &^ base.SnappyDataType
+	if len(xattrSection) == 0 {
+		dataType &^= base.XattrDataType
+	}
+	body := make([]byte, 0, len(xattrSection)+len(docBody))
+	body = append(body, xattrSection...)
+	body = append(body, docBody...)
+	return body, dataType, true, nil
+}
+
+// xattr section consists of its total size followed by xattr pairs, each in the form of
+// <4 byte pair size><xattr key>\x00<xattr value>\x00
+// returns an empty section when all xattrs are stripped
+func (transformer *Transformer) stripXattrs(xattrSection []byte) ([]byte, bool, error) {
+	newSection := make([]byte, 4, len(xattrSection))
+	stripped := false
+
+	pos := 4
+	for pos < len(xattrSection) {
+		if pos+4 > len(xattrSection) {
+			return nil, false, ErrorInvalidXattrSection
+		}
+		pairSize := int(binary.BigEndian.Uint32(xattrSection[pos : pos+4]))
+		pairEnd := pos + 4 + pairSize
+		if pairEnd > len(xattrSection) {
+			return nil, false, ErrorInvalidXattrSection
+		}
+		pair := xattrSection[pos+4 : pairEnd]
+		keyEnd := bytes.IndexByte(pair, 0)
+		if keyEnd < 0 {
+			return nil, false, ErrorInvalidXattrSection
+		}
+		if transformer.xattrs[string(pair[:keyEnd])] {
+			stripped = true
+		} else {
+			newSection = append(newSection, xattrSection[pos:pairEnd]...)
+		}
+		pos = pairEnd
+	}
+
+	if !stripped {
+		return xattrSection, false, nil
+	}
+	if len(newSection) == 4 {
+		return nil, true, nil
+	}
+	binary.BigEndian.PutUint32(newSection[0:4], uint32(len(newSection)-4))
+	return newSection, true, nil
+}
+
+// applies dropField and maskField rules to json document body
+// bodies that are valid json but not json objects, e.g., arrays, strings and numbers, do not have fields and are not changed
+func (transformer *Transformer) transformFields(docBody []byte) ([]byte, bool, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(docBody))
+	// keep numbers as they are
+	decoder.UseNumber()
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, false, fmt.Errorf("Unable to parse document body as json. err=%v", err)
+	}
+	doc, ok := value.(map[string]interface{})
+	if !ok {
+		return docBody, false, nil
+	}
+
+	changed := false
+	for _, rule := range transformer.fieldRules {
+		if transformField(doc, rule) {
+			changed = true
+		}
+	}
+	if !changed {
+		return docBody, false, nil
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode(doc)
+	if err != nil {
+		return nil, false, err
+	}
+	// remove the new line appended by encoder
+	return bytes.TrimRight(buffer.Bytes(), "\n"), true, nil
+}
+
+// returns whether the field referenced by the rule exists and has been dropped or masked
+func transformField(doc map[string]interface{}, rule *metadata.TransformationRule) bool {
+	fieldPath := rule.FieldPath()
+	parent := doc
+	for _, fieldName := range fieldPath[:len(fieldPath)-1] {
+		child, ok := parent[fieldName].(map[string]interface{})
+		if !ok {
+			return false
+		}
+		parent = child
+	}
+
+	fieldName := fieldPath[len(fieldPath)-1]
+	if _, ok := parent[fieldName]; !ok {
+		return false
+	}
+	if rule.Type == metadata.TransformDropField {
+		delete(parent, fieldName)
+	} else {
+		parent[fieldName] = rule.FieldMask()
+	}
+	return true
+}
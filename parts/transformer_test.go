@@ -0,0 +1,184 @@
+// +build !pcre
+
+package parts
+
+import (
+	"encoding/binary"
+	"fmt"
+	mc "github.com/couchbase/gomemcached"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTransformerTestRequest(key string, body []byte, dataType uint8) *mc.MCRequest {
+	return &mc.MCRequest{
+		Opcode:   mc.UPR_MUTATION,
+		Key:      []byte(key),
+		Body:     body,
+		DataType: dataType,
+		Extras:   make([]byte, 24),
+	}
+}
+
+func TestTransformerTTL(t *testing.T) {
+	fmt.Println("============== Test case start: TestTransformerTTL =================")
+	assert := assert.New(t)
+
+	transformer, err := NewTransformer("testTransformer", `[{"type":"setTTL","ttl":3600}]`)
+	assert.Nil(err)
+
+	// expiry in SetWithMeta extras is absolute unix time
+	req := newTransformerTestRequest("user::1", []byte(`{"name":"a"}`), base.JSONDataType)
+	before := uint32(time.Now().Unix())
+	transformed, err := transformer.TransformMCRequest(req)
+	after := uint32(time.Now().Unix())
+	assert.Nil(err)
+	assert.True(transformed)
+	expiry := binary.BigEndian.Uint32(req.Extras[4:8])
+	assert.True(expiry >= before+3600)
+	assert.True(expiry <= after+3600)
+	assert.Equal("user::1", string(req.Key))
+	assert.Equal(`{"name":"a"}`, string(req.Body))
+
+	// ttl longer than 30 days is also added to current time
+	transformer, err = NewTransformer("testTransformer", `[{"type":"setTTL","ttl":5184000}]`)
+	assert.Nil(err)
+	req = newTransformerTestRequest("user::1", []byte(`{"name":"a"}`), base.JSONDataType)
+	before = uint32(time.Now().Unix())
+	transformed, err = transformer.TransformMCRequest(req)
+	assert.Nil(err)
+	assert.True(transformed)
+	assert.True(binary.BigEndian.Uint32(req.Extras[4:8]) >= before+5184000)
+
+	// ttl is not set on deletions
+	req = newTransformerTestRequest("user::2", nil, 0)
+	req.Opcode = mc.UPR_DELETION
+	transformed, err = transformer.TransformMCRequest(req)
+	assert.Nil(err)
+	assert.False(transformed)
+	assert.Equal(uint32(0), binary.BigEndian.Uint32(req.Extras[4:8]))
+
+	fmt.Println("============== Test case end: TestTransformerTTL =================")
+}
+
+func TestTransformerKeyRules(t *testing.T) {
+	fmt.Println("============== Test case start: TestTransformerKeyRules =================")
+	assert := assert.New(t)
+
+	transformer, err := NewTransformer("testTransformer", `[{"type":"keyRename","match":"^user::","replace":"customer::"},{"type":"keyPrefix","value":"dc1::"}]`)
+	assert.Nil(err)
+	assert.True(transformer.ChangesKeys())
+
+	req := newTransformerTestRequest("user::1", []byte(`{"name":"a"}`), base.JSONDataType)
+	req.VBucket = 5
+	transformed, err := transformer.TransformMCRequest(req)
+	assert.Nil(err)
+	assert.True(transformed)
+	assert.Equal("dc1::customer::1", string(req.Key))
+	// vbucket is left for router to recompute
+	assert.Equal(uint16(5), req.VBucket)
+	assert.Equal(`{"name":"a"}`, string(req.Body))
+
+	// keys of deletions are changed as well
+	req = newTransformerTestRequest("user::2", nil, 0)
+	req.Opcode = mc.UPR_DELETION
+	transformed, err = transformer.TransformMCRequest(req)
+	assert.Nil(err)
+	assert.True(transformed)
+	assert.Equal("dc1::customer::2", string(req.Key))
+
+	// key that would exceed the length limit is not changed
+	longKey := strings.Repeat("k", MaxTransformedKeyLength-2)
+	req = newTransformerTestRequest(longKey, []byte(`{"name":"a"}`), base.JSONDataType)
+	transformed, err = transformer.TransformMCRequest(req)
+	assert.Equal(ErrorTransformedKeyTooLong, err)
+	assert.False(transformed)
+	assert.Equal(longKey, string(req.Key))
+
+	// key is not changed when body cannot be transformed
+	transformer, err = NewTransformer("testTransformer", `[{"type":"keyPrefix","value":"dc1::"},{"type":"dropField","field":"notes"}]`)
+	assert.Nil(err)
+	req = newTransformerTestRequest("user::3", []byte(`{"notes":`), base.JSONDataType)
+	transformed, err = transformer.TransformMCRequest(req)
+	assert.NotNil(err)
+	assert.False(transformed)
+	assert.Equal("user::3", string(req.Key))
+
+	transformer, err = NewTransformer("testTransformer", `[{"type":"setTTL","ttl":3600}]`)
+	assert.Nil(err)
+	assert.False(transformer.ChangesKeys())
+
+	fmt.Println("============== Test case end: TestTransformerKeyRules =================")
+}
+
+func TestTransformerFieldsAndXattrs(t *testing.T) {
+	fmt.Println("============== Test case start: TestTransformerFieldsAndXattrs =================")
+	assert := assert.New(t)
+
+	transformer, err := NewTransformer("testTransformer", `[{"type":"maskField","field":"customer.ssn"},
+		{"type":"dropField","field":"notes"},{"type":"stripXattr","xattr":"_sync"}]`)
+	assert.Nil(err)
+
+	body := []byte(`{"customer":{"name":"a","ssn":"123-45-6789"},"notes":"<secret>","amount":12.50}`)
+	req := newTransformerTestRequest("doc", body, base.JSONDataType)
+	transformed, err := transformer.TransformMCRequest(req)
+	assert.Nil(err)
+	assert.True(transformed)
+	assert.Equal(`{"amount":12.50,"customer":{"name":"a","ssn":"****"}}`, string(req.Body))
+
+	// body without the referenced fields is not changed
+	req = newTransformerTestRequest("doc", []byte(`{"name":"a"}`), base.JSONDataType)
+	transformed, err = transformer.TransformMCRequest(req)
+	assert.Nil(err)
+	assert.False(transformed)
+
+	// compressed body with xattrs
+	xattrs := append(buildXattrSection("_sync", `{"rev":"1"}`), buildXattrSection("app", `"x"`)[4:]...)
+	binary.BigEndian.PutUint32(xattrs[0:4], uint32(len(xattrs)-4))
+	value := append(xattrs, body...)
+	req = newTransformerTestRequest("doc", snappy.Encode(nil, value), base.JSONDataType|base.XattrDataType|base.SnappyDataType)
+	transformed, err = transformer.TransformMCRequest(req)
+	assert.Nil(err)
+	assert.True(transformed)
+	assert.Equal(uint8(base.JSONDataType|base.XattrDataType), req.DataType)
+	expectedXattrs := buildXattrSection("app", `"x"`)
+	assert.Equal(string(expectedXattrs), string(req.Body[:len(expectedXattrs)]))
+	assert.Equal(`{"amount":12.50,"customer":{"name":"a","ssn":"****"}}`, string(req.Body[len(expectedXattrs):]))
+
+	// all xattrs stripped
+	req = newTransformerTestRequest("doc", append(buildXattrSection("_sync", `{}`), []byte(`{"a":1}`)...), base.JSONDataType|base.XattrDataType)
+	transformed, err = transformer.TransformMCRequest(req)
+	assert.Nil(err)
+	assert.True(transformed)
+	assert.Equal(uint8(base.JSONDataType), req.DataType)
+	assert.Equal(`{"a":1}`, string(req.Body))
+
+	// json bodies that are not objects do not have fields and are passed through unchanged
+	for _, nonObjectBody := range []string{`[{"notes":"<secret>"},{"customer":{"ssn":"123-45-6789"}}]`, `"notes"`, `12.50`, `null`} {
+		req = newTransformerTestRequest("doc", []byte(nonObjectBody), base.JSONDataType)
+		transformed, err = transformer.TransformMCRequest(req)
+		assert.Nil(err, nonObjectBody)
+		assert.False(transformed, nonObjectBody)
+		assert.Equal(nonObjectBody, string(req.Body))
+	}
+
+	// xattrs are still stripped from documents whose bodies are json arrays
+	req = newTransformerTestRequest("doc", append(buildXattrSection("_sync", `{}`), []byte(`[1,2]`)...), base.JSONDataType|base.XattrDataType)
+	transformed, err = transformer.TransformMCRequest(req)
+	assert.Nil(err)
+	assert.True(transformed)
+	assert.Equal(uint8(base.JSONDataType), req.DataType)
+	assert.Equal(`[1,2]`, string(req.Body))
+
+	// invalid json body
+	req = newTransformerTestRequest("doc", []byte(`{"notes":`), base.JSONDataType)
+	transformed, err = transformer.TransformMCRequest(req)
+	assert.NotNil(err)
+	assert.False(transformed)
+
+	fmt.Println("============== Test case end: TestTransformerFieldsAndXattrs =================")
+}
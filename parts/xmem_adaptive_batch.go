@@ -0,0 +1,182 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package parts
+
+import (
+	"github.com/couchbase/goxdcr/base"
+	"sync/atomic"
+	"time"
+)
+
+/************************************
+/* struct adaptiveBatchSizer
+*************************************/
+// adaptiveBatchSizer decides the effective batch count and batch size of xmem.
+// When target latency is set, it periodically
+// 1. shrinks batches in proportion to how much the smoothed response latency exceeds target latency
+// 2. grows batches when the smoothed response latency is well below target latency, as long as growing
+//    batches does not reduce throughput. A growth that reduces throughput is reverted, and batches are held
+//    at the reverted size for a number of adjust intervals, or until latency goes above target
+// Batch count and size never go above the configured worker_batch_size and doc_batch_size_kb,
+// which are used as is when target latency is not set.
+type adaptiveBatchSizer struct {
+	// target response latency in nanoseconds. 0 disables adaptive batch sizing
+	targetLatency int64
+	// upper bounds, from worker_batch_size and doc_batch_size_kb
+	maxCount uint32
+	maxSize  uint32
+	// effective batch count and batch size (in KB)
+	count uint32
+	size  uint32
+	// smoothed response latency in nanoseconds
+	latency int64
+
+	// the fields below are accessed by the adjusting go routine only
+	lastAdjustTime time.Time
+	lastSentCount  uint64
+	lastThroughput float64
+	lastGrown      bool
+	// number of adjustments to go before batches are allowed to grow again after a growth has been reverted
+	holdCount int
+}
+
+func newAdaptiveBatchSizer(maxCount, maxSize int, targetLatency time.Duration) *adaptiveBatchSizer {
+	// starts with the configured batch count and size, which adaptive batch sizing can only reduce
+	return &adaptiveBatchSizer{
+		targetLatency:  int64(targetLatency),
+		maxCount:       uint32(maxCount),
+		maxSize:        uint32(maxSize),
+		count:          uint32(maxCount),
+		size:           uint32(maxSize),
+		lastAdjustTime: time.Now(),
+	}
+}
+
+func (sizer *adaptiveBatchSizer) enabled() bool {
+	return atomic.LoadInt64(&sizer.targetLatency) > 0
+}
+
+func (sizer *adaptiveBatchSizer) setTargetLatency(targetLatency time.Duration) {
+	atomic.StoreInt64(&sizer.targetLatency, int64(targetLatency))
+	if targetLatency <= 0 {
+		atomic.StoreUint32(&sizer.count, sizer.maxCount)
+		atomic.StoreUint32(&sizer.size, sizer.maxSize)
+	}
+}
+
+func (sizer *adaptiveBatchSizer) getTargetLatency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&sizer.targetLatency))
+}
+
+// effective batch count
+func (sizer *adaptiveBatchSizer) batchCount() uint32 {
+	return atomic.LoadUint32(&sizer.count)
+}
+
+// effective batch size, in KB
+func (sizer *adaptiveBatchSizer) batchSize() uint32 {
+	return atomic.LoadUint32(&sizer.size)
+}
+
+func (sizer *adaptiveBatchSizer) getLatency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&sizer.latency))
+}
+
+// recordLatency folds the response latency of a request into the smoothed latency,
+// which is an exponential moving average that gives each new sample a weight of 1/8
+func (sizer *adaptiveBatchSizer) recordLatency(latency time.Duration) {
+	for {
+		oldLatency := atomic.LoadInt64(&sizer.latency)
+		newLatency := int64(latency)
+		if oldLatency > 0 {
+			newLatency = oldLatency + (int64(latency)-oldLatency)/8
+		}
+		if atomic.CompareAndSwapInt64(&sizer.latency, oldLatency, newLatency) {
+			return
+		}
+	}
+}
+
+// adjust updates the effective batch count and size based on the latency and throughput observed since
+// the last adjustment, where sentCount is the total number of mutations sent so far.
+// It is a no-op when adaptive batch sizing is disabled, when the adjust interval has not passed,
+// or when no response has been received yet. returns whether batch count and size have been changed
+func (sizer *adaptiveBatchSizer) adjust(sentCount uint64, now time.Time) bool {
+	targetLatency := atomic.LoadInt64(&sizer.targetLatency)
+	if targetLatency <= 0 {
+		return false
+	}
+	elapsed := now.Sub(sizer.lastAdjustTime)
+	if elapsed < base.XmemAdaptiveBatchAdjustInterval {
+		return false
+	}
+	latency := atomic.LoadInt64(&sizer.latency)
+	if latency <= 0 {
+		return false
+	}
+
+	throughput := float64(sentCount-sizer.lastSentCount) / elapsed.Seconds()
+	throughputDropped := throughput < sizer.lastThroughput*float64(100-base.XmemAdaptiveBatchThroughputDropPercentage)/100
+
+	factor := 1.0
+	grown := false
+	if latency > targetLatency {
+		factor = float64(targetLatency) / float64(latency)
+		if factor < base.XmemAdaptiveBatchMaxShrinkFactor {
+			factor = base.XmemAdaptiveBatchMaxShrinkFactor
+		}
+		sizer.holdCount = 0
+	} else if sizer.lastGrown && throughputDropped {
+		// larger batches have not paid off
+		factor = 1 / base.XmemAdaptiveBatchGrowFactor
+		sizer.holdCount = base.XmemAdaptiveBatchHoldCount
+	} else if sizer.holdCount > 0 {
+		sizer.holdCount--
+	} else if float64(latency) < float64(targetLatency)*base.XmemAdaptiveBatchGrowThreshold {
+		factor = base.XmemAdaptiveBatchGrowFactor
+		grown = true
+	}
+
+	sizer.lastAdjustTime = now
+	sizer.lastSentCount = sentCount
+	sizer.lastThroughput = throughput
+	sizer.lastGrown = grown
+
+	if factor == 1.0 {
+		return false
+	}
+	oldCount := sizer.batchCount()
+	oldSize := sizer.batchSize()
+	newCount := scaleBatchLimit(oldCount, factor, uint32(base.XmemAdaptiveBatchMinCount), sizer.maxCount)
+	newSize := scaleBatchLimit(oldSize, factor, uint32(base.XmemAdaptiveBatchMinSize), sizer.maxSize)
+	if grown && newCount == oldCount && newSize == oldSize {
+		// already at upper bounds
+		sizer.lastGrown = false
+	}
+	atomic.StoreUint32(&sizer.count, newCount)
+	atomic.StoreUint32(&sizer.size, newSize)
+	return newCount != oldCount || newSize != oldSize
+}
+
+// scales limit by factor, within [min, max]. max takes precedence when min is larger than max
+func scaleBatchLimit(limit uint32, factor float64, min, max uint32) uint32 {
+	scaled := uint32(float64(limit)*factor + 0.5)
+	if scaled == limit && factor > 1 {
+		// makes sure that small limits can grow
+		scaled++
+	}
+	if scaled < min {
+		scaled = min
+	}
+	if scaled > max {
+		scaled = max
+	}
+	return scaled
+}
@@ -0,0 +1,135 @@
+// +build !pcre
+
+package parts
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveBatchSizerDisabled(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestAdaptiveBatchSizerDisabled =================")
+
+	sizer := newAdaptiveBatchSizer(500, 2048, 0)
+	assert.False(sizer.enabled())
+	assert.Equal(uint32(500), sizer.batchCount())
+	assert.Equal(uint32(2048), sizer.batchSize())
+
+	sizer.recordLatency(time.Second)
+	assert.False(sizer.adjust(1000, time.Now().Add(time.Minute)))
+	assert.Equal(uint32(500), sizer.batchCount())
+	assert.Equal(uint32(2048), sizer.batchSize())
+
+	fmt.Println("============== Test case end: TestAdaptiveBatchSizerDisabled =================")
+}
+
+func TestAdaptiveBatchSizerShrinkAndGrow(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestAdaptiveBatchSizerShrinkAndGrow =================")
+
+	sizer := newAdaptiveBatchSizer(1000, 2000, 100*time.Millisecond)
+	assert.True(sizer.enabled())
+	now := sizer.lastAdjustTime
+	interval := 10 * time.Second
+
+	// no response yet
+	assert.False(sizer.adjust(0, now.Add(interval)))
+
+	// latency is twice the target, batches are halved
+	sizer.recordLatency(200 * time.Millisecond)
+	assert.Equal(200*time.Millisecond, sizer.getLatency())
+	// too soon
+	assert.False(sizer.adjust(100, now.Add(time.Millisecond)))
+	now = now.Add(interval)
+	assert.True(sizer.adjust(1000, now))
+	assert.Equal(uint32(500), sizer.batchCount())
+	assert.Equal(uint32(1000), sizer.batchSize())
+
+	// shrinking is capped at the max shrink factor
+	sizer.latency = int64(time.Second)
+	now = now.Add(interval)
+	assert.True(sizer.adjust(2000, now))
+	assert.Equal(uint32(250), sizer.batchCount())
+	assert.Equal(uint32(500), sizer.batchSize())
+
+	// latency within target but above grow threshold, batches stay
+	sizer.latency = int64(90 * time.Millisecond)
+	now = now.Add(interval)
+	assert.False(sizer.adjust(3000, now))
+
+	// latency well below target, batches grow
+	sizer.latency = int64(10 * time.Millisecond)
+	now = now.Add(interval)
+	assert.True(sizer.adjust(4000, now))
+	assert.Equal(uint32(313), sizer.batchCount())
+	assert.Equal(uint32(625), sizer.batchSize())
+
+	// batches never grow beyond configured limits
+	for i := 0; i < 20; i++ {
+		now = now.Add(interval)
+		sizer.adjust(uint64(5000+1000*i), now)
+	}
+	assert.Equal(uint32(1000), sizer.batchCount())
+	assert.Equal(uint32(2000), sizer.batchSize())
+
+	// nor shrink below the minimums
+	sizer.latency = int64(10 * time.Second)
+	for i := 0; i < 20; i++ {
+		now = now.Add(interval)
+		sizer.adjust(uint64(30000+1000*i), now)
+	}
+	assert.Equal(uint32(10), sizer.batchCount())
+	assert.Equal(uint32(10), sizer.batchSize())
+
+	// disabling adaptive batch sizing restores configured limits
+	sizer.setTargetLatency(0)
+	assert.Equal(uint32(1000), sizer.batchCount())
+	assert.Equal(uint32(2000), sizer.batchSize())
+
+	fmt.Println("============== Test case end: TestAdaptiveBatchSizerShrinkAndGrow =================")
+}
+
+func TestAdaptiveBatchSizerThroughputDrop(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestAdaptiveBatchSizerThroughputDrop =================")
+
+	sizer := newAdaptiveBatchSizer(1000, 2000, 100*time.Millisecond)
+	sizer.count = 400
+	sizer.size = 800
+	now := sizer.lastAdjustTime
+	interval := 10 * time.Second
+	sizer.recordLatency(10 * time.Millisecond)
+
+	// batches grow
+	now = now.Add(interval)
+	assert.True(sizer.adjust(10000, now))
+	assert.Equal(uint32(500), sizer.batchCount())
+	assert.Equal(uint32(1000), sizer.batchSize())
+
+	// throughput drops after the growth, which is reverted
+	now = now.Add(interval)
+	assert.True(sizer.adjust(15000, now))
+	assert.Equal(uint32(400), sizer.batchCount())
+	assert.Equal(uint32(800), sizer.batchSize())
+
+	// batches are held even though latency is low
+	for i := 0; i < 15; i++ {
+		now = now.Add(interval)
+		assert.False(sizer.adjust(uint64(20000+5000*i), now))
+	}
+	// and grow again after the hold
+	now = now.Add(interval)
+	assert.True(sizer.adjust(100000, now))
+	assert.Equal(uint32(500), sizer.batchCount())
+
+	// latency going above target ends the hold
+	sizer.latency = int64(200 * time.Millisecond)
+	now = now.Add(interval)
+	assert.True(sizer.adjust(50000+100000, now))
+	assert.Equal(uint32(250), sizer.batchCount())
+
+	fmt.Println("============== Test case end: TestAdaptiveBatchSizerThroughputDrop =================")
+}
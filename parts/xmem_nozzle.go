@@ -22,11 +22,13 @@ import (
 	"github.com/couchbase/goxdcr/metadata"
 	"github.com/couchbase/goxdcr/service_def"
 	utilities "github.com/couchbase/goxdcr/utils"
+	"github.com/golang/snappy"
 	"io"
 	"math"
 	"math/rand"
 	"net"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -45,31 +47,39 @@ const (
 	XMEM_SETTING_REMOTE_MEM_SSL_PORT = "remote_ssl_port"
 	XMEM_SETTING_CLIENT_CERTIFICATE  = metadata.XmemClientCertificate
 	XMEM_SETTING_CLIENT_KEY          = metadata.XmemClientKey
+	XMEM_SETTING_CONFLICT_RESOLVER   = "conflict_resolver"
+	XMEM_SETTING_CONFLICT_LOGGING    = "conflict_logging"
+	// target response latency for adaptive batch sizing. 0 disables adaptive batch sizing
+	XMEM_SETTING_TARGET_BATCH_LATENCY = "target_batch_latency"
+	// number of connections that setMeta requests are striped across
+	XMEM_SETTING_SETMETA_CONNECTIONS = "setMeta_connections"
 
 	default_demandEncryption bool = false
 )
 
 var xmem_setting_defs base.SettingDefinitions = base.SettingDefinitions{SETTING_BATCHCOUNT: base.NewSettingDef(reflect.TypeOf((*int)(nil)), true),
-	SETTING_BATCHSIZE:               base.NewSettingDef(reflect.TypeOf((*int)(nil)), true),
-	SETTING_NUMOFRETRY:              base.NewSettingDef(reflect.TypeOf((*int)(nil)), false),
-	SETTING_RESP_TIMEOUT:            base.NewSettingDef(reflect.TypeOf((*time.Duration)(nil)), false),
-	SETTING_WRITE_TIMEOUT:           base.NewSettingDef(reflect.TypeOf((*time.Duration)(nil)), false),
-	SETTING_READ_TIMEOUT:            base.NewSettingDef(reflect.TypeOf((*time.Duration)(nil)), false),
-	SETTING_MAX_RETRY_INTERVAL:      base.NewSettingDef(reflect.TypeOf((*time.Duration)(nil)), false),
-	SETTING_SELF_MONITOR_INTERVAL:   base.NewSettingDef(reflect.TypeOf((*time.Duration)(nil)), false),
-	SETTING_BATCH_EXPIRATION_TIME:   base.NewSettingDef(reflect.TypeOf((*time.Duration)(nil)), false),
-	SETTING_OPTI_REP_THRESHOLD:      base.NewSettingDef(reflect.TypeOf((*int)(nil)), true),
-	XMEM_SETTING_DEMAND_ENCRYPTION:  base.NewSettingDef(reflect.TypeOf((*bool)(nil)), false),
-	XMEM_SETTING_ENCRYPTION_TYPE:    base.NewSettingDef(reflect.TypeOf((*string)(nil)), false),
-	XMEM_SETTING_CERTIFICATE:        base.NewSettingDef(reflect.TypeOf((*[]byte)(nil)), false),
-	XMEM_SETTING_SAN_IN_CERITICATE:  base.NewSettingDef(reflect.TypeOf((*bool)(nil)), false),
-	XMEM_SETTING_INSECURESKIPVERIFY: base.NewSettingDef(reflect.TypeOf((*bool)(nil)), false),
+	SETTING_BATCHSIZE:                 base.NewSettingDef(reflect.TypeOf((*int)(nil)), true),
+	SETTING_NUMOFRETRY:                base.NewSettingDef(reflect.TypeOf((*int)(nil)), false),
+	SETTING_RESP_TIMEOUT:              base.NewSettingDef(reflect.TypeOf((*time.Duration)(nil)), false),
+	SETTING_WRITE_TIMEOUT:             base.NewSettingDef(reflect.TypeOf((*time.Duration)(nil)), false),
+	SETTING_READ_TIMEOUT:              base.NewSettingDef(reflect.TypeOf((*time.Duration)(nil)), false),
+	SETTING_MAX_RETRY_INTERVAL:        base.NewSettingDef(reflect.TypeOf((*time.Duration)(nil)), false),
+	SETTING_SELF_MONITOR_INTERVAL:     base.NewSettingDef(reflect.TypeOf((*time.Duration)(nil)), false),
+	SETTING_BATCH_EXPIRATION_TIME:     base.NewSettingDef(reflect.TypeOf((*time.Duration)(nil)), false),
+	SETTING_OPTI_REP_THRESHOLD:        base.NewSettingDef(reflect.TypeOf((*int)(nil)), true),
+	XMEM_SETTING_DEMAND_ENCRYPTION:    base.NewSettingDef(reflect.TypeOf((*bool)(nil)), false),
+	XMEM_SETTING_ENCRYPTION_TYPE:      base.NewSettingDef(reflect.TypeOf((*string)(nil)), false),
+	XMEM_SETTING_CERTIFICATE:          base.NewSettingDef(reflect.TypeOf((*[]byte)(nil)), false),
+	XMEM_SETTING_SAN_IN_CERITICATE:    base.NewSettingDef(reflect.TypeOf((*bool)(nil)), false),
+	XMEM_SETTING_INSECURESKIPVERIFY:   base.NewSettingDef(reflect.TypeOf((*bool)(nil)), false),
+	XMEM_SETTING_CONFLICT_RESOLVER:    base.NewSettingDef(reflect.TypeOf((*string)(nil)), false),
+	XMEM_SETTING_CONFLICT_LOGGING:     base.NewSettingDef(reflect.TypeOf((*bool)(nil)), false),
+	XMEM_SETTING_TARGET_BATCH_LATENCY: base.NewSettingDef(reflect.TypeOf((*time.Duration)(nil)), false),
+	XMEM_SETTING_SETMETA_CONNECTIONS:  base.NewSettingDef(reflect.TypeOf((*int)(nil)), false),
 }
 
 var UninitializedReseverationNumber = -1
 
-type ConflictResolver func(doc_metadata_source documentMetadata, doc_metadata_target documentMetadata, source_cr_mode base.ConflictResolutionMode, xattrEnabled bool, logger *log.CommonLogger) bool
-
 var GetMetaClientName = "client_getMeta"
 var SetMetaClientName = "client_setMeta"
 
@@ -83,7 +93,9 @@ type bufferedMCRequest struct {
 	num_of_retry int
 	timedout     bool
 	reservation  int
-	lock         sync.RWMutex
+	// index of the setMeta connection that the request is sent through
+	conn_index int
+	lock       sync.RWMutex
 }
 
 func newBufferedMCRequest() *bufferedMCRequest {
@@ -103,6 +115,7 @@ func resetBufferedMCRequest(request *bufferedMCRequest) {
 	request.num_of_retry = 0
 	request.timedout = false
 	request.reservation = UninitializedReseverationNumber
+	request.conn_index = 0
 }
 
 /***********************************************************
@@ -121,10 +134,11 @@ type requestBuffer struct {
 	fin_ch           chan bool
 	logger           *log.CommonLogger
 	notifych_lock    sync.RWMutex
-	token_ch         chan int
+	// one token channel per setMeta connection, which holds a token for each request sent through the connection and not yet confirmed
+	token_chs []chan int
 }
 
-func newReqBuffer(size uint16, threshold uint16, token_ch chan int, logger *log.CommonLogger) *requestBuffer {
+func newReqBuffer(size uint16, threshold uint16, token_chs []chan int, logger *log.CommonLogger) *requestBuffer {
 	logger.Debugf("Create a new request buffer of size %d\n", size)
 	buf := &requestBuffer{
 		slots:            make([]*bufferedMCRequest, size, size),
@@ -134,7 +148,7 @@ func newReqBuffer(size uint16, threshold uint16, token_ch chan int, logger *log.
 		notifych:         nil,
 		notify_threshold: threshold,
 		fin_ch:           make(chan bool, 1),
-		token_ch:         token_ch,
+		token_chs:        token_chs,
 		logger:           logger,
 		notifych_lock:    sync.RWMutex{},
 		occupied_count:   0}
@@ -281,13 +295,14 @@ func (buf *requestBuffer) clearSlot(pos uint16, reservation_num int) error {
 		return errors.New("Clear slot failed, reservation number doesn't match")
 	}
 
+	conn_index := req.conn_index
 	resetBufferedMCRequest(req)
 
 	buf.empty_slots_pos <- pos
 
 	//decrease the occupied_count
 	atomic.AddInt32(&buf.occupied_count, -1)
-	<-buf.token_ch
+	<-buf.token_chs[conn_index]
 
 	//increase sequence
 	if buf.sequences[pos]+1 > 65535 {
@@ -317,7 +332,7 @@ func (buf *requestBuffer) cancelReservation(index uint16, reservation_num int) e
 	return buf.clearSlot(index, reservation_num)
 }
 
-func (buf *requestBuffer) enSlot(mcreq *base.WrappedMCRequest) (uint16, int, []byte) {
+func (buf *requestBuffer) enSlot(mcreq *base.WrappedMCRequest, conn_index int) (uint16, int, []byte) {
 	index := <-buf.empty_slots_pos
 
 	//non blocking
@@ -334,11 +349,12 @@ func (buf *requestBuffer) enSlot(mcreq *base.WrappedMCRequest) (uint16, int, []b
 
 	req.reservation = reservation_num
 	req.req = mcreq
+	req.conn_index = conn_index
 	buf.adjustRequest(mcreq, index)
 	item_bytes := mcreq.Req.Bytes()
 	now := time.Now()
 	req.sent_time = &now
-	buf.token_ch <- 1
+	buf.token_chs[conn_index] <- 1
 
 	//increase the occupied_count
 	atomic.AddInt32(&buf.occupied_count, 1)
@@ -389,7 +405,9 @@ type xmemConfig struct {
 	clientKey          []byte
 	respTimeout        unsafe.Pointer // *time.Duration
 	max_read_downtime  time.Duration
-	logger             *log.CommonLogger
+	// number of connections that setMeta requests are striped across
+	setMetaConns int
+	logger       *log.CommonLogger
 }
 
 func newConfig(logger *log.CommonLogger) xmemConfig {
@@ -410,6 +428,7 @@ func newConfig(logger *log.CommonLogger) xmemConfig {
 		certificate:        []byte{},
 		max_read_downtime:  base.XmemMaxReadDownTime,
 		memcached_ssl_port: 0,
+		setMetaConns:       1,
 		logger:             logger,
 	}
 
@@ -426,6 +445,9 @@ func (config *xmemConfig) initializeConfig(settings metadata.ReplicationSettings
 
 	if err == nil {
 		config.baseConfig.initializeConfig(settings)
+		if val, ok := settings[XMEM_SETTING_SETMETA_CONNECTIONS]; ok && val.(int) > 0 {
+			config.setMetaConns = val.(int)
+		}
 		if val, ok := settings[XMEM_SETTING_DEMAND_ENCRYPTION]; ok {
 			config.demandEncryption = val.(bool)
 		}
@@ -728,9 +750,11 @@ type XmemNozzle struct {
 	bytes_in_dataChan int32
 	dataChan_control  chan bool
 
-	//memcached client connected to the target bucket
-	client_for_setMeta *xmemClient
-	client_for_getMeta *xmemClient
+	//memcached clients connected to the target bucket
+	//setMeta requests are striped across clients_for_setMeta by vbucket, and requests in the same vbucket
+	//always go through the same client, which preserves their order
+	clients_for_setMeta []*xmemClient
+	client_for_getMeta  *xmemClient
 
 	//configurable parameter
 	config xmemConfig
@@ -748,13 +772,25 @@ type XmemNozzle struct {
 	// use this extra storage to avoid blocking
 	cur_batch_count uint32
 
+	// decides the count and size limits of new batches, which are worker_batch_size and doc_batch_size_kb
+	// unless adaptive batch sizing is enabled
+	batchSizer *adaptiveBatchSizer
+
 	childrenWaitGrp sync.WaitGroup
 
 	//buffer for the sent, but not yet confirmed data
 	buf *requestBuffer
 
 	//conflict resolover
-	conflict_resolver ConflictResolver
+	conflict_resolver base.ConflictResolver
+	// whether a resolver other than base.ConflictResolverDefault is used. when it is, every document goes through
+	// source side conflict resolution, and target is told to skip its own conflict resolution
+	customConflictResolver bool
+
+	// conflict log for mutations that lose source side conflict resolution
+	conflictLogSvc service_def.ConflictLogSvc
+	// whether mutations that lose source side conflict resolution need to be written to conflict log
+	conflictLogging *base.AtomicBooleanType
 
 	finish_ch chan bool
 
@@ -767,7 +803,9 @@ type XmemNozzle struct {
 	start_time                  time.Time
 	counter_resend              uint64
 
-	receive_token_ch chan int
+	// one token channel per setMeta client, which tells the receiveResponse routine of the client
+	// that there are requests waiting for response
+	receive_token_chs []chan int
 
 	connType base.ConnType
 
@@ -795,7 +833,7 @@ type XmemNozzle struct {
 	utils              utilities.UtilsIface
 
 	// Protect data memebers that may be accessed concurrently by Start() and Stop()
-	// i.e., buf, dataChan, client_for_setMeta, client_for_setMeta
+	// i.e., buf, dataChan, clients_for_setMeta, client_for_getMeta
 	// Access to these data members in other parts of xmem do not need to be protected,
 	// since such access can only happen after Start() has completed successfully
 	// and after the data members have been initialized and set
@@ -826,8 +864,8 @@ func NewXmemNozzle(id string,
 		bOpen:               true,
 		lock_bOpen:          sync.RWMutex{},
 		dataChan:            nil,
-		receive_token_ch:    nil,
-		client_for_setMeta:  nil,
+		receive_token_chs:   nil,
+		clients_for_setMeta: nil,
 		client_for_getMeta:  nil,
 		config:              newConfig(part.Logger()),
 		batches_ready_queue: nil,
@@ -845,12 +883,13 @@ func NewXmemNozzle(id string,
 		source_cr_mode:      source_cr_mode,
 		sourceBucketName:    sourceBucketName,
 		utils:               utilsIn,
+		conflictLogging:     base.NewAtomicBooleanType(false),
 	}
 
 	xmem.last_ten_batches_size = []uint32{0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
 
-	//set conflict resolver
-	xmem.conflict_resolver = resolveConflict
+	//set default conflict resolver. it may be overridden by XMEM_SETTING_CONFLICT_RESOLVER setting
+	xmem.conflict_resolver = base.ConflictResolverFunc(base.ResolveConflict)
 
 	xmem.config.connectStr = connectString
 	xmem.config.bucketName = targetBucketName
@@ -867,6 +906,10 @@ func (xmem *XmemNozzle) SetBandwidthThrottler(bandwidthThrottler service_def.Ban
 	xmem.bandwidthThrottler = bandwidthThrottler
 }
 
+func (xmem *XmemNozzle) SetConflictLogSvc(conflictLogSvc service_def.ConflictLogSvc) {
+	xmem.conflictLogSvc = conflictLogSvc
+}
+
 func (xmem *XmemNozzle) IsOpen() bool {
 	xmem.lock_bOpen.RLock()
 	defer xmem.lock_bOpen.RUnlock()
@@ -914,8 +957,11 @@ func (xmem *XmemNozzle) Start(settings metadata.ReplicationSettingsMap) error {
 	xmem.childrenWaitGrp.Add(1)
 	go xmem.selfMonitor(xmem.finish_ch, &xmem.childrenWaitGrp)
 
-	xmem.childrenWaitGrp.Add(1)
-	go xmem.receiveResponse(xmem.finish_ch, &xmem.childrenWaitGrp)
+	// responses are read from each setMeta client by its own routine
+	for conn_index, client := range xmem.getSetMetaClients() {
+		xmem.childrenWaitGrp.Add(1)
+		go xmem.receiveResponse(client, xmem.receive_token_chs[conn_index], xmem.finish_ch, &xmem.childrenWaitGrp)
+	}
 
 	xmem.childrenWaitGrp.Add(1)
 	go xmem.checkAndRepairBufferMonitor(xmem.finish_ch, &xmem.childrenWaitGrp)
@@ -1131,6 +1177,10 @@ func (xmem *XmemNozzle) processData_sendbatch(finch chan bool, waitGrp *sync.Wai
 				xmem.handleGeneralError(err)
 			}
 			xmem.recordBatchSize(batch.count())
+			if xmem.batchSizer.adjust(atomic.LoadUint64(&xmem.counter_sent), time.Now()) {
+				xmem.Logger().Debugf("%v adjusted batch count to %v and batch size to %vKB. response latency=%v, target=%v\n", xmem.Id(),
+					xmem.batchSizer.batchCount(), xmem.batchSizer.batchSize(), xmem.batchSizer.getLatency(), xmem.batchSizer.getTargetLatency())
+			}
 		case <-xmem.getBatchNonEmptyCh():
 			if xmem.validateRunningState() != nil {
 				xmem.Logger().Infof("%v has stopped.", xmem.Id())
@@ -1185,11 +1235,10 @@ func (xmem *XmemNozzle) finalCleanup() {
 	xmem.childrenWaitGrp.Wait()
 
 	//cleanup
-	client_for_setMeta := xmem.getClient(true /*isSetMeta*/)
-	if client_for_setMeta != nil {
+	for _, client_for_setMeta := range xmem.getSetMetaClients() {
 		client_for_setMeta.close()
 	}
-	client_for_getMeta := xmem.getClient(false /*isSetMeta*/)
+	client_for_getMeta := xmem.getGetMetaClient()
 	if client_for_getMeta != nil {
 		client_for_getMeta.close()
 	}
@@ -1218,10 +1267,20 @@ func (xmem *XmemNozzle) cleanupBufferedMCRequest(req *bufferedMCRequest) {
 func (xmem *XmemNozzle) batchSetMetaWithRetry(batch *dataBatch, numOfRetry int) error {
 	var err error
 	count := batch.count()
-	batch_replicated_count := 0
-	reqs_bytes := [][]byte{}
-	// A list of reservations for each request in the batch
-	index_reservation_list := make([][]uint16, base.XmemMaxBatchSize+1)
+	clients := xmem.getSetMetaClients()
+	// requests in the batch are striped across setMeta clients by vbucket
+	// each client has its own list of requests to send, and a list of reservations for the requests
+	reqs_bytes_list := make([][][]byte, len(clients))
+	index_reservation_lists := make([][][]uint16, len(clients))
+
+	// cancel the reservations of requests that have not been sent
+	cancelReservations := func() {
+		for _, index_reservation_list := range index_reservation_lists {
+			for _, index_reserv_tuple := range index_reservation_list {
+				xmem.buf.cancelReservation(index_reserv_tuple[0], int(index_reserv_tuple[1]))
+			}
+		}
+	}
 
 	for i := 0; i < int(count); i++ {
 		// Get a MCRequest from the data channel, which is a part of the batch
@@ -1244,33 +1303,31 @@ func (xmem *XmemNozzle) batchSetMetaWithRetry(batch *dataBatch, numOfRetry int)
 					return err
 				}
 
+				conn_index := xmem.getSetMetaConnIndex(item.Req.VBucket)
+
 				//blocking
-				index, reserv_num, item_bytes := xmem.buf.enSlot(item)
+				index, reserv_num, item_bytes := xmem.buf.enSlot(item, conn_index)
 
-				reqs_bytes = append(reqs_bytes, item_bytes)
+				reqs_bytes_list[conn_index] = append(reqs_bytes_list[conn_index], item_bytes)
 
 				reserv_num_pair := make([]uint16, 2)
 				reserv_num_pair[0] = index
 				reserv_num_pair[1] = uint16(reserv_num)
-				index_reservation_list[batch_replicated_count] = reserv_num_pair
-				batch_replicated_count++
+				index_reservation_lists[conn_index] = append(index_reservation_lists[conn_index], reserv_num_pair)
 
 				//ns_ssl_proxy choke if the batch size is too big
-				if batch_replicated_count > base.XmemMaxBatchSize {
+				if len(reqs_bytes_list[conn_index]) > base.XmemMaxBatchSize {
 					//send it
-					err = xmem.sendWithRetry(xmem.client_for_setMeta, numOfRetry, reqs_bytes)
+					err = xmem.sendWithRetry(clients[conn_index], numOfRetry, reqs_bytes_list[conn_index])
 
 					if err != nil {
-						xmem.Logger().Errorf("%v Failed to send. err=%v\n", xmem.Id(), err)
-						for _, index_reserv_tuple := range index_reservation_list {
-							xmem.buf.cancelReservation(index_reserv_tuple[0], int(index_reserv_tuple[1]))
-						}
+						xmem.Logger().Errorf("%v Failed to send through %v. err=%v\n", xmem.Id(), clients[conn_index].name, err)
+						cancelReservations()
 						return err
 					}
 
-					batch_replicated_count = 0
-					reqs_bytes = [][]byte{}
-					index_reservation_list = make([][]uint16, base.XmemMaxBatchSize+1)
+					reqs_bytes_list[conn_index] = nil
+					index_reservation_lists[conn_index] = nil
 				}
 			} else {
 				if needSendStatus == Not_Send_Failed_CR {
@@ -1279,7 +1336,7 @@ func (xmem *XmemNozzle) batchSetMetaWithRetry(batch *dataBatch, numOfRetry int)
 					additionalInfo := DataFailedCRSourceEventAdditional{Seqno: item.Seqno,
 						Opcode:      encodeOpCode(item.Req.Opcode),
 						IsExpirySet: (binary.BigEndian.Uint32(item.Req.Extras[4:8]) != 0),
-						VBucket:     item.Req.VBucket,
+						VBucket:     item.SrcVBucket,
 					}
 					xmem.RaiseEvent(common.NewEvent(common.DataFailedCRSource, nil, xmem, nil, additionalInfo))
 				}
@@ -1291,21 +1348,30 @@ func (xmem *XmemNozzle) batchSetMetaWithRetry(batch *dataBatch, numOfRetry int)
 	}
 
 	//send the batch in one shot - in case the batch didn't hit the max limit
-	if batch_replicated_count > 0 {
-		err = xmem.sendWithRetry(xmem.client_for_setMeta, numOfRetry, reqs_bytes)
+	for conn_index, reqs_bytes := range reqs_bytes_list {
+		if len(reqs_bytes) == 0 {
+			continue
+		}
+
+		err = xmem.sendWithRetry(clients[conn_index], numOfRetry, reqs_bytes)
 
 		if err != nil {
-			xmem.Logger().Errorf("%v Failed to send. err=%v\n", xmem.Id(), err)
-			for _, index_reserv_tuple := range index_reservation_list {
-				xmem.buf.cancelReservation(index_reserv_tuple[0], int(index_reserv_tuple[1]))
-			}
+			xmem.Logger().Errorf("%v Failed to send through %v. err=%v\n", xmem.Id(), clients[conn_index].name, err)
+			cancelReservations()
 			return err
 		}
+
+		index_reservation_lists[conn_index] = nil
 	}
 
 	return err
 }
 
+// index of the setMeta client that requests in vbno are sent through
+func (xmem *XmemNozzle) getSetMetaConnIndex(vbno uint16) int {
+	return int(vbno) % len(xmem.clients_for_setMeta)
+}
+
 func (xmem *XmemNozzle) preprocessMCRequest(req *base.WrappedMCRequest) error {
 	mc_req := req.Req
 
@@ -1338,83 +1404,6 @@ func (xmem *XmemNozzle) preprocessMCRequest(req *base.WrappedMCRequest) error {
 	return nil
 }
 
-//return true if doc_meta_source win; false otherwise
-func resolveConflict(doc_meta_source documentMetadata, doc_meta_target documentMetadata,
-	source_cr_mode base.ConflictResolutionMode, xattrEnabled bool, logger *log.CommonLogger) bool {
-	if source_cr_mode == base.CRMode_LWW {
-		return resolveConflictByCAS(doc_meta_source, doc_meta_target, xattrEnabled, logger)
-	} else {
-		return resolveConflictByRevSeq(doc_meta_source, doc_meta_target, xattrEnabled, logger)
-	}
-}
-
-func resolveConflictByCAS(doc_meta_source documentMetadata,
-	doc_meta_target documentMetadata, xattrEnabled bool, logger *log.CommonLogger) bool {
-	ret := true
-	if doc_meta_target.cas > doc_meta_source.cas {
-		ret = false
-	} else if doc_meta_target.cas == doc_meta_source.cas {
-		if doc_meta_target.revSeq > doc_meta_source.revSeq {
-			ret = false
-		} else if doc_meta_target.revSeq == doc_meta_source.revSeq {
-			//if the outgoing mutation is deletion and its revSeq and cas are the
-			//same as the target side document, it would lose the conflict resolution
-			if doc_meta_source.deletion || (doc_meta_target.expiry > doc_meta_source.expiry) {
-				ret = false
-			} else if doc_meta_target.expiry == doc_meta_source.expiry {
-				if doc_meta_target.flags > doc_meta_source.flags {
-					ret = false
-				} else if doc_meta_target.flags == doc_meta_source.flags {
-					ret = resolveConflictByXattr(doc_meta_source, doc_meta_target, xattrEnabled)
-				}
-			}
-		}
-	}
-	return ret
-}
-
-func resolveConflictByRevSeq(doc_meta_source documentMetadata,
-	doc_meta_target documentMetadata, xattrEnabled bool, logger *log.CommonLogger) bool {
-	ret := true
-	if doc_meta_target.revSeq > doc_meta_source.revSeq {
-		ret = false
-	} else if doc_meta_target.revSeq == doc_meta_source.revSeq {
-		if doc_meta_target.cas > doc_meta_source.cas {
-			ret = false
-		} else if doc_meta_target.cas == doc_meta_source.cas {
-			//if the outgoing mutation is deletion and its revSeq and cas are the
-			//same as the target side document, it would lose the conflict resolution
-			if doc_meta_source.deletion || (doc_meta_target.expiry > doc_meta_source.expiry) {
-				ret = false
-			} else if doc_meta_target.expiry == doc_meta_source.expiry {
-				if doc_meta_target.flags > doc_meta_source.flags {
-					ret = false
-				} else if doc_meta_target.flags == doc_meta_source.flags {
-					ret = resolveConflictByXattr(doc_meta_source, doc_meta_target, xattrEnabled)
-				}
-			}
-		}
-	}
-	return ret
-}
-
-// if all other metadata fields are equal, use xattr field to decide whether source mutations should win
-func resolveConflictByXattr(doc_meta_source documentMetadata,
-	doc_meta_target documentMetadata, xattrEnabled bool) bool {
-	if xattrEnabled {
-		// if target is xattr enabled, source mutation has xattr, and target mutation does not have xattr
-		// let source mutation win
-		source_has_xattr := base.HasXattr(doc_meta_source.dataType)
-		target_has_xattr := base.HasXattr(doc_meta_target.dataType)
-		return source_has_xattr && !target_has_xattr
-	} else {
-		// if target is not xattr enabled, target mutation always does not have xattr
-		// do not have let source mutation win even if source mutation has xattr,
-		// otherwise source mutations need to be repeatly re-sent in backfill mode
-		return false
-	}
-}
-
 func (xmem *XmemNozzle) sendWithRetry(client *xmemClient, numOfRetry int, item_byte [][]byte) error {
 
 	var err error
@@ -1517,7 +1506,8 @@ func (xmem *XmemNozzle) batchGetMetaHandler(count int, finch chan bool, return_c
 						}
 						xmem.RaiseEvent(common.NewEvent(common.GetMetaReceived, nil, xmem, nil, additionalInfo))
 
-						if response.Status != mc.SUCCESS && !isIgnorableMCError(response.Status) && !isTemporaryMCError(response.Status) && response.Status != mc.KEY_ENOENT {
+						if response.Status != mc.SUCCESS && !isIgnorableMCError(response.Status) && !isTemporaryMCError(response.Status) && response.Status != mc.KEY_ENOENT &&
+							response.Status != base.SUBDOC_MULTI_PATH_FAILURE {
 							if isTopologyChangeMCError(response.Status) {
 								vb_err := fmt.Errorf("Received error %v on vb %v\n", base.ErrorNotMyVbucket, vbno)
 								xmem.handleVBError(vbno, vb_err)
@@ -1562,6 +1552,86 @@ func (xmem *XmemNozzle) batchGetMeta(bigDoc_map base.McRequestMap) (map[string]b
 		return bigDoc_noRep_map, nil
 	}
 
+	respMap, err := xmem.sendBatchGetRequests(bigDoc_map, xmem.composeRequestForGetMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	// document conflict resolvers need the bodies and xattrs of target documents
+	var targetDocRespMap base.MCResponseMap
+	if docResolver, ok := xmem.conflict_resolver.(base.DocumentConflictResolver); ok {
+		targetDocRespMap, err = xmem.batchGetTargetDocs(bigDoc_map, respMap, docResolver.TargetXattrs())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Parse the result once the handler has finished populating the respMap
+	for _, wrappedReq := range bigDoc_map {
+		key := string(wrappedReq.Req.Key)
+		resp, ok := respMap[key]
+		if ok && resp.Status == mc.SUCCESS {
+			doc_meta_target, err := xmem.decodeGetMetaResp([]byte(key), resp)
+			if err != nil {
+				xmem.Logger().Warnf("%v batchGetMeta: Error decoding getMeta response for doc %v%v%v. err=%v. Skip conflict resolution and send the doc", xmem.Id(), base.UdTagBegin, key, base.UdTagEnd, err)
+				continue
+			}
+			doc_meta_source := decodeSetMetaReq(wrappedReq)
+			sourceWins, mergedXattrs := xmem.resolveConflict(wrappedReq, doc_meta_source, doc_meta_target, targetDocRespMap[key])
+			if !sourceWins {
+				if xmem.Logger().GetLogLevel() >= log.LogLevelDebug {
+					docMetaSrcRedacted := doc_meta_source.CloneAndRedact()
+					docMetaTgtRedacted := doc_meta_target.CloneAndRedact()
+					xmem.Logger().Debugf("%v doc %v%v%v failed source side conflict resolution. source meta=%v, target meta=%v. no need to send\n", xmem.Id(), base.UdTagBegin, key, base.UdTagEnd, docMetaSrcRedacted, docMetaTgtRedacted)
+				}
+				bigDoc_noRep_map[wrappedReq.UniqueKey] = true
+				if xmem.conflictLogging.Get() {
+					xmem.writeConflictLog(wrappedReq, doc_meta_source, doc_meta_target)
+				}
+			} else {
+				if mergedXattrs != nil {
+					err = setXattrs(wrappedReq.Req, mergedXattrs)
+					if err != nil {
+						xmem.Logger().Warnf("%v batchGetMeta: Error setting merged xattrs on doc %v%v%v. err=%v. Send the doc as it is", xmem.Id(), base.UdTagBegin, key, base.UdTagEnd, err)
+					}
+				}
+				if xmem.customConflictResolver {
+					// do not let target override the decision of the custom conflict resolver with its own conflict resolution
+					SetSkipConflictResolution(wrappedReq.Req)
+				}
+				if xmem.Logger().GetLogLevel() >= log.LogLevelDebug {
+					docMetaSrcRedacted := doc_meta_source.CloneAndRedact()
+					docMetaTgtRedacted := doc_meta_target.CloneAndRedact()
+					xmem.Logger().Debugf("%v doc %v%v%v succeeded source side conflict resolution. source meta=%v, target meta=%v. sending it to target\n", xmem.Id(), base.UdTagBegin, key, base.UdTagEnd, docMetaSrcRedacted, docMetaTgtRedacted)
+				}
+			}
+		} else if ok && isTopologyChangeMCError(resp.Status) {
+			bigDoc_noRep_map[wrappedReq.UniqueKey] = false
+		} else {
+			if !ok || resp == nil {
+				if xmem.Logger().GetLogLevel() >= log.LogLevelDebug {
+					xmem.Logger().Debugf("%v batchGetMeta: doc %v%s%v is not found in target system, send it", xmem.Id(), base.UdTagBegin, key, base.UdTagEnd)
+				}
+			} else if resp.Status == mc.KEY_ENOENT {
+				if xmem.Logger().GetLogLevel() >= log.LogLevelDebug {
+					xmem.Logger().Debugf("%v batchGetMeta: doc %v%s%v does not exist on target. Skip conflict resolution and send the doc", xmem.Id(), base.UdTagBegin, key, base.UdTagEnd)
+				}
+			} else {
+				xmem.Logger().Warnf("%v batchGetMeta: memcached response for doc %v%s%v has error status %v. Skip conflict resolution and send the doc", xmem.Id(), base.UdTagBegin, key, base.UdTagEnd, resp.Status)
+			}
+		}
+	}
+
+	if xmem.Logger().GetLogLevel() >= log.LogLevelDebug {
+		xmem.Logger().Debugf("%v Done with batchGetMeta, bigDoc_noRep_map=%v\n", xmem.Id(), bigDoc_noRep_map.CloneAndRedact())
+	}
+	return bigDoc_noRep_map, nil
+}
+
+// sends the requests composed by composeFunc for the distinct document keys in bigDoc_map through getMeta client,
+// and returns the responses received, keyed by document keys
+func (xmem *XmemNozzle) sendBatchGetRequests(bigDoc_map base.McRequestMap,
+	composeFunc func(key string, vb uint16, opaque uint32) *mc.MCRequest) (base.MCResponseMap, error) {
 	respMap := make(base.MCResponseMap, xmem.config.maxCount)
 	opaque_keySeqno_map := make(opaqueKeySeqnoMap)
 	receiver_fin_ch := make(chan bool, 1)
@@ -1590,7 +1660,7 @@ func (xmem *XmemNozzle) batchGetMeta(bigDoc_map base.McRequestMap) (map[string]b
 		}
 
 		if _, ok := sent_key_map[docKey]; !ok {
-			req := xmem.composeRequestForGetMeta(docKey, originalReq.Req.VBucket, opaque)
+			req := composeFunc(docKey, originalReq.Req.VBucket, opaque)
 			// .Bytes() returns data ready to be fed over the wire
 			reqs_bytes = append(reqs_bytes, req.Bytes())
 			// a Map of array of items and map key is the opaque currently based on time (passed to the target and back)
@@ -1628,75 +1698,111 @@ func (xmem *XmemNozzle) batchGetMeta(bigDoc_map base.McRequestMap) (map[string]b
 
 	//wait for receiver to finish
 	<-receiver_return_ch
+	return respMap, nil
+}
 
-	// Parse the result once the handler has finished populating the respMap
-	for _, wrappedReq := range bigDoc_map {
-		key := string(wrappedReq.Req.Key)
-		resp, ok := respMap[key]
-		if ok && resp.Status == mc.SUCCESS {
-			doc_meta_target, err := xmem.decodeGetMetaResp([]byte(key), resp)
-			if err != nil {
-				xmem.Logger().Warnf("%v batchGetMeta: Error decoding getMeta response for doc %v%v%v. err=%v. Skip conflict resolution and send the doc", xmem.Id(), base.UdTagBegin, key, base.UdTagEnd, err)
-				continue
-			}
-			doc_meta_source := decodeSetMetaReq(wrappedReq)
-			if !xmem.conflict_resolver(doc_meta_source, doc_meta_target, xmem.source_cr_mode, xmem.xattrEnabled, xmem.Logger()) {
-				if xmem.Logger().GetLogLevel() >= log.LogLevelDebug {
-					docMetaSrcRedacted := doc_meta_source.CloneAndRedact()
-					docMetaTgtRedacted := doc_meta_target.CloneAndRedact()
-					xmem.Logger().Debugf("%v doc %v%v%v failed source side conflict resolution. source meta=%v, target meta=%v. no need to send\n", xmem.Id(), base.UdTagBegin, key, base.UdTagEnd, docMetaSrcRedacted, docMetaTgtRedacted)
-				}
-				bigDoc_noRep_map[wrappedReq.UniqueKey] = true
-			} else if xmem.Logger().GetLogLevel() >= log.LogLevelDebug {
-				docMetaSrcRedacted := doc_meta_source.CloneAndRedact()
-				docMetaTgtRedacted := doc_meta_target.CloneAndRedact()
-				xmem.Logger().Debugf("%v doc %v%v%v succeeded source side conflict resolution. source meta=%v, target meta=%v. sending it to target\n", xmem.Id(), base.UdTagBegin, key, base.UdTagEnd, docMetaSrcRedacted, docMetaTgtRedacted)
-			}
-		} else if ok && isTopologyChangeMCError(resp.Status) {
-			bigDoc_noRep_map[wrappedReq.UniqueKey] = false
-		} else {
-			if !ok || resp == nil {
-				if xmem.Logger().GetLogLevel() >= log.LogLevelDebug {
-					xmem.Logger().Debugf("%v batchGetMeta: doc %v%s%v is not found in target system, send it", xmem.Id(), base.UdTagBegin, key, base.UdTagEnd)
-				}
-			} else if resp.Status == mc.KEY_ENOENT {
-				if xmem.Logger().GetLogLevel() >= log.LogLevelDebug {
-					xmem.Logger().Debugf("%v batchGetMeta: doc %v%s%v does not exist on target. Skip conflict resolution and send the doc", xmem.Id(), base.UdTagBegin, key, base.UdTagEnd)
-				}
-			} else {
-				xmem.Logger().Warnf("%v batchGetMeta: memcached response for doc %v%s%v has error status %v. Skip conflict resolution and send the doc", xmem.Id(), base.UdTagBegin, key, base.UdTagEnd, resp.Status)
+// fetches the bodies and the specified xattrs of the existing, non-deleted target documents of the mutations in bigDoc_map,
+// given the getMeta responses of the target documents. Deletions and expirations do not need target documents
+func (xmem *XmemNozzle) batchGetTargetDocs(bigDoc_map base.McRequestMap, getMetaRespMap base.MCResponseMap, xattrNames []string) (base.MCResponseMap, error) {
+	existingDoc_map := make(base.McRequestMap)
+	for uniqueKey, wrappedReq := range bigDoc_map {
+		if wrappedReq.Req.Opcode != mc.UPR_MUTATION {
+			continue
+		}
+		resp, ok := getMetaRespMap[string(wrappedReq.Req.Key)]
+		if !ok || resp.Status != mc.SUCCESS {
+			continue
+		}
+		doc_meta_target, err := xmem.decodeGetMetaResp(wrappedReq.Req.Key, resp)
+		if err != nil || doc_meta_target.IsDeletion() {
+			continue
+		}
+		existingDoc_map[uniqueKey] = wrappedReq
+	}
+	if len(existingDoc_map) == 0 {
+		return nil, nil
+	}
+
+	return xmem.sendBatchGetRequests(existingDoc_map, func(key string, vb uint16, opaque uint32) *mc.MCRequest {
+		return ComposeRequestForGetDocument(key, vb, opaque, xattrNames)
+	})
+}
+
+// resolves conflict between a source mutation and its target document, and returns whether source wins.
+// When a document conflict resolver is used and the target document has been fetched, it returns as well the xattrs,
+// if any, that the source mutation needs to be sent with
+func (xmem *XmemNozzle) resolveConflict(wrappedReq *base.WrappedMCRequest, doc_meta_source, doc_meta_target base.DocumentMetadata,
+	targetDocResp *mc.MCResponse) (bool, map[string]string) {
+	docResolver, ok := xmem.conflict_resolver.(base.DocumentConflictResolver)
+	if ok && targetDocResp != nil && targetDocResp.Status != mc.KEY_ENOENT {
+		sourceDoc, err := decodeDocumentFromRequest(wrappedReq.Req, doc_meta_source)
+		if err == nil {
+			var targetDoc *base.Document
+			targetDoc, err = DecodeGetDocumentResp(targetDocResp, doc_meta_target, docResolver.TargetXattrs())
+			if err == nil {
+				return docResolver.ResolveDocument(sourceDoc, targetDoc, xmem.source_cr_mode, xmem.xattrEnabled, xmem.Logger())
 			}
 		}
+		xmem.Logger().Warnf("%v Error decoding documents for conflict resolution of doc %v%s%v. err=%v. Resolve with metadata only", xmem.Id(),
+			base.UdTagBegin, wrappedReq.Req.Key, base.UdTagEnd, err)
 	}
+	return xmem.conflict_resolver.Resolve(doc_meta_source, doc_meta_target, xmem.source_cr_mode, xmem.xattrEnabled, xmem.Logger()), nil
+}
 
-	if xmem.Logger().GetLogLevel() >= log.LogLevelDebug {
-		xmem.Logger().Debugf("%v Done with batchGetMeta, bigDoc_noRep_map=%v\n", xmem.Id(), bigDoc_noRep_map.CloneAndRedact())
+// record a mutation that has lost source side conflict resolution in conflict log
+func (xmem *XmemNozzle) writeConflictLog(wrappedReq *base.WrappedMCRequest, doc_meta_source, doc_meta_target base.DocumentMetadata) {
+	if xmem.conflictLogSvc == nil {
+		return
 	}
-	return bigDoc_noRep_map, nil
+
+	record := &service_def.ConflictRecord{
+		Timestamp:    log.FormatTimeWithMilliSecondPrecision(time.Now()),
+		Key:          string(doc_meta_source.Key()),
+		VBucket:      wrappedReq.SrcVBucket,
+		Seqno:        wrappedReq.Seqno,
+		SourceCas:    doc_meta_source.Cas(),
+		SourceRevSeq: doc_meta_source.RevSeq(),
+		TargetCas:    doc_meta_target.Cas(),
+		TargetRevSeq: doc_meta_target.RevSeq(),
+	}
+	// the record is written asynchronously. failure to queue it does not affect replication,
+	// and dropped records are reported by conflict log service
+	xmem.conflictLogSvc.Write(xmem.topic, record)
+}
+
+func (xmem *XmemNozzle) decodeGetMetaResp(key []byte, resp *mc.MCResponse) (base.DocumentMetadata, error) {
+	ret, err := DecodeGetMetaResp(key, resp, xmem.xattrEnabled)
+	if err != nil {
+		err = fmt.Errorf("%v %v", xmem.Id(), err)
+	}
+	return ret, err
+}
+
+func (xmem *XmemNozzle) composeRequestForGetMeta(key string, vb uint16, opaque uint32) *mc.MCRequest {
+	return ComposeRequestForGetMeta(key, vb, opaque, xmem.xattrEnabled)
 }
 
-func (xmem *XmemNozzle) decodeGetMetaResp(key []byte, resp *mc.MCResponse) (documentMetadata, error) {
-	ret := documentMetadata{}
-	ret.key = key
+// decodes the response to a getMeta request composed by ComposeRequestForGetMeta.
+// xattrEnabled needs to be the same as the one used when composing the request
+func DecodeGetMetaResp(key []byte, resp *mc.MCResponse, xattrEnabled bool) (base.DocumentMetadata, error) {
 	extras := resp.Extras
-	ret.deletion = (binary.BigEndian.Uint32(extras[0:4]) != 0)
-	ret.flags = binary.BigEndian.Uint32(extras[4:8])
-	ret.expiry = binary.BigEndian.Uint32(extras[8:12])
-	ret.revSeq = binary.BigEndian.Uint64(extras[12:20])
-	ret.cas = resp.Cas
-	if xmem.xattrEnabled {
+	deletion := (binary.BigEndian.Uint32(extras[0:4]) != 0)
+	flags := binary.BigEndian.Uint32(extras[4:8])
+	expiry := binary.BigEndian.Uint32(extras[8:12])
+	revSeq := binary.BigEndian.Uint64(extras[12:20])
+	var dataType uint8
+	if xattrEnabled {
 		if len(extras) < 20 {
-			return ret, fmt.Errorf("%v received unexpected getMeta response, which does not include data type in extras. extras=%v", xmem.Id(), extras)
+			return base.DocumentMetadata{}, fmt.Errorf("received unexpected getMeta response, which does not include data type in extras. extras=%v", extras)
 		}
-		ret.dataType = extras[20]
+		dataType = extras[20]
 	} else {
-		ret.dataType = resp.DataType
+		dataType = resp.DataType
 	}
-	return ret, nil
-
+	return base.NewDocumentMetadata(key, revSeq, resp.Cas, flags, expiry, deletion, dataType), nil
 }
 
-func (xmem *XmemNozzle) composeRequestForGetMeta(key string, vb uint16, opaque uint32) *mc.MCRequest {
+func ComposeRequestForGetMeta(key string, vb uint16, opaque uint32, xattrEnabled bool) *mc.MCRequest {
 	req := &mc.MCRequest{VBucket: vb,
 		Key:    []byte(key),
 		Opaque: opaque,
@@ -1704,23 +1810,269 @@ func (xmem *XmemNozzle) composeRequestForGetMeta(key string, vb uint16, opaque u
 
 	// if xattr is enabled, request that data type be included in getMeta response
 	// Not needed for compression since GetMeta connection is to not use compression
-	if xmem.xattrEnabled {
+	if xattrEnabled {
 		req.Extras = make([]byte, 1)
 		req.Extras[0] = byte(base.ReqExtMetaDataType)
 	}
 	return req
 }
 
-func (xmem *XmemNozzle) sendSingleSetMeta(bytesList [][]byte, numOfRetry int) error {
+// composes the setMeta or delMeta request that would be sent by xmem for a dcp mutation, deletion or expiration.
+// xattrs are kept in the request, hence xattr needs to have been enabled on the connection that the request is sent through.
+// the value of event is expected to be uncompressed.
+// when transformer is not nil, the transformation rules of the replication are applied to the request, the same way as in router
+func ComposeRequestForSetMeta(event *mcc.UprEvent, sourceCRMode base.ConflictResolutionMode, opaque uint32, transformer *Transformer) (*mc.MCRequest, error) {
+	req := &mc.MCRequest{}
+	setMCRequestFromUprEvent(req, event, sourceCRMode)
+	if transformer != nil {
+		_, err := transformer.TransformMCRequest(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+	req.Opcode = encodeOpCode(req.Opcode)
+	req.Cas = 0
+	req.Opaque = opaque
+	// Memcached does not like it when any other flags are in there
+	req.DataType &= base.PROTOCOL_BINARY_DATATYPE_XATTR
+	return req, nil
+}
+
+// sets SKIP_CONFLICT_RESOLUTION_FLAG option in the extras of a setMeta or delMeta request,
+// extending the extras to include the options field when needed.
+// extras are in the form of <flags><expiry><revSeq><cas>[<options>][<extended meta length>], i.e.,
+// 24 bytes without options, 26 bytes with extended meta length only, 28 bytes with options only, or 30 bytes with both
+func SetSkipConflictResolution(req *mc.MCRequest) {
+	switch len(req.Extras) {
+	case 24:
+		extras := make([]byte, 28)
+		copy(extras, req.Extras)
+		req.Extras = extras
+	case 26:
+		// options go before extended meta length
+		extras := make([]byte, 30)
+		copy(extras, req.Extras[:24])
+		copy(extras[28:30], req.Extras[24:26])
+		req.Extras = extras
+	case 28, 30:
+	default:
+		return
+	}
+	options := binary.BigEndian.Uint32(req.Extras[24:28])
+	binary.BigEndian.PutUint32(req.Extras[24:28], options|base.SKIP_CONFLICT_RESOLUTION_FLAG)
+}
+
+// composes a subdoc multi lookup request that gets the body and the specified xattrs of a document.
+// there can be at most base.SubdocMaxPaths-1 xattrs
+func ComposeRequestForGetDocument(key string, vb uint16, opaque uint32, xattrNames []string) *mc.MCRequest {
+	// xattr paths need to go before document path
+	var body []byte
+	for _, name := range xattrNames {
+		body = appendSubdocLookupSpec(body, base.SUBDOC_GET, base.SUBDOC_FLAG_XATTR_PATH, name)
+	}
+	// GET with empty path gets the whole document body
+	body = appendSubdocLookupSpec(body, mc.GET, 0, "")
+	return &mc.MCRequest{VBucket: vb,
+		Key:    []byte(key),
+		Opaque: opaque,
+		Opcode: base.SUBDOC_MULTI_LOOKUP,
+		Body:   body}
+}
+
+// lookup spec is in the form of <1 byte opcode><1 byte flags><2 byte path length><path>
+func appendSubdocLookupSpec(body []byte, opcode mc.CommandCode, flags uint8, path string) []byte {
+	spec := make([]byte, 4, 4+len(path))
+	spec[0] = byte(opcode)
+	spec[1] = flags
+	binary.BigEndian.PutUint16(spec[2:4], uint16(len(path)))
+	spec = append(spec, path...)
+	return append(body, spec...)
+}
+
+// decodes the response to a request composed by ComposeRequestForGetDocument with the same xattrNames.
+// xattrs that the document does not have are not included in the returned document
+func DecodeGetDocumentResp(resp *mc.MCResponse, meta base.DocumentMetadata, xattrNames []string) (*base.Document, error) {
+	if resp.Status != mc.SUCCESS && resp.Status != base.SUBDOC_MULTI_PATH_FAILURE {
+		return nil, fmt.Errorf("received error status %v for subdoc lookup", resp.Status)
+	}
+	statuses, values, err := decodeSubdocLookupResults(resp.Body, len(xattrNames)+1)
+	if err != nil {
+		return nil, err
+	}
+	doc := &base.Document{Metadata: meta, Xattrs: make(map[string]string)}
+	for index, name := range xattrNames {
+		if statuses[index] == mc.SUCCESS {
+			doc.Xattrs[name] = string(values[index])
+		}
+	}
+	if statuses[len(xattrNames)] != mc.SUCCESS {
+		return nil, fmt.Errorf("received error status %v for document body in subdoc lookup", statuses[len(xattrNames)])
+	}
+	doc.Body = values[len(xattrNames)]
+	return doc, nil
+}
+
+// composes a subdoc multi lookup request that gets the specified xattrs of a document, including virtual xattrs.
+// the lookup is done on the tombstone of the document when it has been deleted.
+// there can be at most base.SubdocMaxPaths xattrs
+func ComposeRequestForGetXattrs(key string, vb uint16, opaque uint32, xattrNames []string) *mc.MCRequest {
+	var body []byte
+	for _, name := range xattrNames {
+		body = appendSubdocLookupSpec(body, base.SUBDOC_GET, base.SUBDOC_FLAG_XATTR_PATH, name)
+	}
+	return &mc.MCRequest{VBucket: vb,
+		Key:    []byte(key),
+		Opaque: opaque,
+		Opcode: base.SUBDOC_MULTI_LOOKUP,
+		Extras: []byte{base.SUBDOC_DOC_FLAG_ACCESS_DELETED},
+		Body:   body}
+}
+
+// decodes the response to a request composed by ComposeRequestForGetXattrs with the same xattrNames.
+// xattrs that the document does not have are not included in the returned map
+func DecodeGetXattrsResp(resp *mc.MCResponse, xattrNames []string) (map[string]string, error) {
+	if resp.Status != mc.SUCCESS && resp.Status != base.SUBDOC_MULTI_PATH_FAILURE &&
+		resp.Status != base.SUBDOC_SUCCESS_DELETED && resp.Status != base.SUBDOC_MULTI_PATH_FAILURE_DELETED {
+		return nil, fmt.Errorf("received error status %v for subdoc lookup", resp.Status)
+	}
+	statuses, values, err := decodeSubdocLookupResults(resp.Body, len(xattrNames))
+	if err != nil {
+		return nil, err
+	}
+	xattrs := make(map[string]string)
+	for index, name := range xattrNames {
+		if statuses[index] == mc.SUCCESS {
+			xattrs[name] = string(values[index])
+		}
+	}
+	return xattrs, nil
+}
+
+// decodes the results of the paths in a subdoc multi lookup response,
+// each of which is in the form of <2 byte status><4 byte value length><value>
+func decodeSubdocLookupResults(body []byte, numOfPaths int) ([]mc.Status, [][]byte, error) {
+	statuses := make([]mc.Status, numOfPaths)
+	values := make([][]byte, numOfPaths)
+	pos := 0
+	for index := 0; index < numOfPaths; index++ {
+		if pos+6 > len(body) {
+			return nil, nil, fmt.Errorf("received truncated subdoc lookup response. body length=%v", len(body))
+		}
+		statuses[index] = mc.Status(binary.BigEndian.Uint16(body[pos : pos+2]))
+		valueLen := int(binary.BigEndian.Uint32(body[pos+2 : pos+6]))
+		if pos+6+valueLen > len(body) {
+			return nil, nil, fmt.Errorf("received truncated subdoc lookup response. body length=%v", len(body))
+		}
+		values[index] = body[pos+6 : pos+6+valueLen]
+		pos += 6 + valueLen
+	}
+	return statuses, values, nil
+}
+
+// decodes the body and the xattrs of a source mutation
+func decodeDocumentFromRequest(req *mc.MCRequest, meta base.DocumentMetadata) (*base.Document, error) {
+	value := req.Body
+	if req.DataType&base.SnappyDataType > 0 {
+		var err error
+		value, err = snappy.Decode(nil, req.Body)
+		if err != nil {
+			return nil, base.ErrorCompressionUnableToInflate
+		}
+	}
+
+	doc := &base.Document{Metadata: meta, Body: value, Xattrs: make(map[string]string)}
+	if req.DataType&base.XattrDataType > 0 {
+		if len(value) < 4 || int(binary.BigEndian.Uint32(value[0:4]))+4 > len(value) {
+			return nil, ErrorInvalidXattrSection
+		}
+		xattrSectionSize := int(binary.BigEndian.Uint32(value[0:4])) + 4
+		xattrs, err := parseXattrs(value[:xattrSectionSize])
+		if err != nil {
+			return nil, err
+		}
+		doc.Xattrs = xattrs
+		doc.Body = value[xattrSectionSize:]
+	}
+	return doc, nil
+}
+
+// replaces the xattrs of a source mutation. The body of the mutation is left uncompressed
+func setXattrs(req *mc.MCRequest, xattrs map[string]string) error {
+	doc, err := decodeDocumentFromRequest(req, base.DocumentMetadata{})
+	if err != nil {
+		return err
+	}
+
+	req.Body = composeValueWithXattrs(xattrs, doc.Body)
+	req.DataType = (req.DataType &^ base.SnappyDataType) | base.XattrDataType
+	return nil
+}
+
+// composes the uncompressed value of a document with xattrs, i.e., the xattr section followed by the body
+func composeValueWithXattrs(xattrs map[string]string, docBody []byte) []byte {
+	names := make([]string, 0, len(xattrs))
+	for name, _ := range xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// xattr section consists of its total size followed by xattr pairs, each in the form of
+	// <4 byte pair size><xattr key>\x00<xattr value>\x00
+	body := make([]byte, 4)
+	for _, name := range names {
+		pairSize := make([]byte, 4)
+		binary.BigEndian.PutUint32(pairSize, uint32(len(name)+len(xattrs[name])+2))
+		body = append(body, pairSize...)
+		body = append(body, name...)
+		body = append(body, 0)
+		body = append(body, xattrs[name]...)
+		body = append(body, 0)
+	}
+	binary.BigEndian.PutUint32(body[0:4], uint32(len(body)-4))
+	return append(body, docBody...)
+}
+
+// composes the dcp mutation or deletion that would have been streamed for the current version of a document,
+// which has been read through getMeta and subdoc lookups instead of dcp.
+// the returned event can be passed to ComposeRequestForSetMeta, and to filter
+func ComposeUprEventForDocument(doc *base.Document, vbno uint16, seqno uint64) *mcc.UprEvent {
+	meta := doc.Metadata
+	event := &mcc.UprEvent{
+		Opcode:   mc.UPR_MUTATION,
+		VBucket:  vbno,
+		Seqno:    seqno,
+		Key:      meta.Key(),
+		Cas:      meta.Cas(),
+		RevSeqno: meta.RevSeq(),
+		Flags:    meta.Flags(),
+		Expiry:   meta.Expiry(),
+		// body read through subdoc lookup is not compressed
+		DataType: meta.DataType() &^ (base.SnappyDataType | base.XattrDataType),
+	}
+	if meta.IsDeletion() {
+		event.Opcode = mc.UPR_DELETION
+		event.DataType = 0
+		return event
+	}
+	if len(doc.Xattrs) > 0 {
+		event.Value = composeValueWithXattrs(doc.Xattrs, doc.Body)
+		event.DataType |= base.XattrDataType
+	} else {
+		event.Value = doc.Body
+	}
+	return event
+}
+
+func (xmem *XmemNozzle) sendSingleSetMeta(client *xmemClient, bytesList [][]byte, numOfRetry int) error {
 	var err error
-	if xmem.client_for_setMeta != nil {
+	if client != nil {
 		for j := 0; j < numOfRetry; j++ {
-			err, rev := xmem.writeToClient(xmem.client_for_setMeta, bytesList, true)
+			err, rev := xmem.writeToClient(client, bytesList, true)
 			if err == nil {
 				atomic.AddUint64(&xmem.counter_resend, 1)
 				return nil
 			} else if err == badConnectionError {
-				xmem.repairConn(xmem.client_for_setMeta, err.Error(), rev)
+				xmem.repairConn(client, err.Error(), rev)
 			}
 		}
 		return err
@@ -1787,9 +2139,15 @@ func (xmem *XmemNozzle) initializeConnection() (err error) {
 	// this needs to be done after xmem.connType is set
 	xmem.composeUserAgent()
 
-	memClient_setMeta, err := xmem.getClientWithRetry(xmem.Id(), pool, xmem.finish_ch, true /*initializing*/, xmem.Logger())
-	if err != nil {
-		return
+	clients_for_setMeta := make([]*xmemClient, xmem.config.setMetaConns)
+	for conn_index := range clients_for_setMeta {
+		memClient_setMeta, err := xmem.getClientWithRetry(xmem.Id(), pool, xmem.finish_ch, true /*initializing*/, xmem.Logger())
+		if err != nil {
+			return err
+		}
+		clients_for_setMeta[conn_index] = newXmemClient(getSetMetaClientName(conn_index), xmem.config.readTimeout,
+			xmem.config.writeTimeout, memClient_setMeta,
+			xmem.config.maxRetry, xmem.config.max_read_downtime, xmem.Logger())
 	}
 
 	memClient_getMeta, err := xmem.getClientWithRetry(xmem.Id(), pool, xmem.finish_ch, true /*initializing*/, xmem.Logger())
@@ -1797,29 +2155,29 @@ func (xmem *XmemNozzle) initializeConnection() (err error) {
 		return
 	}
 
-	xmem.setClient(newXmemClient(SetMetaClientName, xmem.config.readTimeout,
-		xmem.config.writeTimeout, memClient_setMeta,
-		xmem.config.maxRetry, xmem.config.max_read_downtime, xmem.Logger()), true /*isSetMeta*/)
-	xmem.setClient(newXmemClient(GetMetaClientName, xmem.config.readTimeout,
+	xmem.setSetMetaClients(clients_for_setMeta)
+	xmem.setGetMetaClient(newXmemClient(GetMetaClientName, xmem.config.readTimeout,
 		xmem.config.writeTimeout, memClient_getMeta,
-		xmem.config.maxRetry, xmem.config.max_read_downtime, xmem.Logger()), false /*isSetMeta*/)
+		xmem.config.maxRetry, xmem.config.max_read_downtime, xmem.Logger()))
 
 	// send helo command to setMeta and getMeta clients
-	features, err := xmem.sendHELO(true /*setMeta*/)
-	if err != nil {
-		return err
-	}
+	for _, client_for_setMeta := range clients_for_setMeta {
+		features, err := xmem.sendHELO(client_for_setMeta, true /*setMeta*/)
+		if err != nil {
+			return err
+		}
 
-	err = xmem.validateFeatures(features)
-	if err != nil {
-		return err
-	}
+		err = xmem.validateFeatures(features)
+		if err != nil {
+			return err
+		}
 
-	// initialize this only once here
-	xmem.xattrEnabled = features.Xattribute
+		// initialize this only once here. all setMeta clients negotiate the same features
+		xmem.xattrEnabled = features.Xattribute
+	}
 
 	// No need to check features for bare boned getMeta client
-	_, err = xmem.sendHELO(false /*setMeta */)
+	_, err = xmem.sendHELO(xmem.client_for_getMeta, false /*setMeta */)
 	if err != nil {
 		return err
 	}
@@ -1847,7 +2205,7 @@ func (xmem *XmemNozzle) getPoolName() string {
 }
 
 func (xmem *XmemNozzle) initNewBatch() {
-	xmem.batch = newBatch(uint32(xmem.config.maxCount), uint32(xmem.config.maxSize), xmem.Logger())
+	xmem.batch = newBatch(xmem.batchSizer.batchCount(), xmem.batchSizer.batchSize(), xmem.Logger())
 	atomic.StoreUint32(&xmem.cur_batch_count, 0)
 }
 
@@ -1862,6 +2220,26 @@ func (xmem *XmemNozzle) initialize(settings metadata.ReplicationSettingsMap) err
 		xmem.compressionSetting = compressionVal.(base.CompressionType)
 	}
 
+	if resolverName, ok := settings[XMEM_SETTING_CONFLICT_RESOLVER]; ok {
+		resolver, err := base.GetConflictResolver(resolverName.(string))
+		if err != nil {
+			return err
+		}
+		xmem.conflict_resolver = resolver
+		xmem.customConflictResolver = base.IsCustomConflictResolver(resolverName.(string))
+		xmem.Logger().Infof("%v using conflict resolver %v", xmem.Id(), resolverName)
+	}
+
+	if conflictLogging, ok := settings[XMEM_SETTING_CONFLICT_LOGGING]; ok {
+		xmem.conflictLogging.Set(conflictLogging.(bool))
+	}
+
+	var targetBatchLatency time.Duration
+	if val, ok := settings[XMEM_SETTING_TARGET_BATCH_LATENCY]; ok {
+		targetBatchLatency = val.(time.Duration)
+	}
+	xmem.batchSizer = newAdaptiveBatchSizer(xmem.config.maxCount, xmem.config.maxSize, targetBatchLatency)
+
 	xmem.setDataChan(make(chan *base.WrappedMCRequest, xmem.config.maxCount*10))
 	xmem.bytes_in_dataChan = 0
 	xmem.dataChan_control = make(chan bool, 1)
@@ -1876,8 +2254,11 @@ func (xmem *XmemNozzle) initialize(settings metadata.ReplicationSettingsMap) err
 	//init a new batch
 	xmem.initNewBatch()
 
-	xmem.receive_token_ch = make(chan int, xmem.config.maxCount*2)
-	xmem.setRequestBuffer(newReqBuffer(uint16(xmem.config.maxCount*2), uint16(float64(xmem.config.maxCount)*0.2), xmem.receive_token_ch, xmem.Logger()))
+	xmem.receive_token_chs = make([]chan int, xmem.config.setMetaConns)
+	for conn_index := range xmem.receive_token_chs {
+		xmem.receive_token_chs[conn_index] = make(chan int, xmem.config.maxCount*2)
+	}
+	xmem.setRequestBuffer(newReqBuffer(uint16(xmem.config.maxCount*2), uint16(float64(xmem.config.maxCount)*0.2), xmem.receive_token_chs, xmem.Logger()))
 
 	xmem.Logger().Infof("%v About to start initializing connection", xmem.Id())
 	err = xmem.initializeConnection()
@@ -1914,41 +2295,64 @@ func (xmem *XmemNozzle) setDataChan(dataChan chan *base.WrappedMCRequest) {
 	xmem.dataChan = dataChan
 }
 
-func (xmem *XmemNozzle) getClient(isSetMeta bool) *xmemClient {
+func (xmem *XmemNozzle) getSetMetaClients() []*xmemClient {
 	xmem.stateLock.RLock()
 	defer xmem.stateLock.RUnlock()
-	if isSetMeta {
-		return xmem.client_for_setMeta
-	} else {
-		return xmem.client_for_getMeta
-	}
+	return xmem.clients_for_setMeta
 }
 
-func (xmem *XmemNozzle) setClient(client *xmemClient, isSetMeta bool) {
+func (xmem *XmemNozzle) setSetMetaClients(clients []*xmemClient) {
 	xmem.stateLock.Lock()
 	defer xmem.stateLock.Unlock()
-	if isSetMeta {
-		xmem.client_for_setMeta = client
-	} else {
-		xmem.client_for_getMeta = client
+	xmem.clients_for_setMeta = clients
+}
+
+func (xmem *XmemNozzle) getGetMetaClient() *xmemClient {
+	xmem.stateLock.RLock()
+	defer xmem.stateLock.RUnlock()
+	return xmem.client_for_getMeta
+}
+
+func (xmem *XmemNozzle) setGetMetaClient(client *xmemClient) {
+	xmem.stateLock.Lock()
+	defer xmem.stateLock.Unlock()
+	xmem.client_for_getMeta = client
+}
+
+// returns the index of client in setMeta clients, or -1 if client is not a setMeta client
+func (xmem *XmemNozzle) getSetMetaClientIndex(client *xmemClient) int {
+	for conn_index, client_for_setMeta := range xmem.clients_for_setMeta {
+		if client_for_setMeta == client {
+			return conn_index
+		}
+	}
+	return -1
+}
+
+func getSetMetaClientName(conn_index int) string {
+	if conn_index == 0 {
+		return SetMetaClientName
 	}
+	return fmt.Sprintf("%v_%v", SetMetaClientName, conn_index)
 }
 
-func (xmem *XmemNozzle) receiveResponse(finch chan bool, waitGrp *sync.WaitGroup) {
+// reads responses from a setMeta client. token_ch of the client has a token for each request sent through it
+// and not yet confirmed, so that the client is read only when there are requests waiting for response
+func (xmem *XmemNozzle) receiveResponse(client *xmemClient, token_ch chan int, finch chan bool, waitGrp *sync.WaitGroup) {
 	defer waitGrp.Done()
 
 	for {
 		select {
 		case <-finch:
 			goto done
-		case <-xmem.receive_token_ch:
-			xmem.receive_token_ch <- 1
+		case <-token_ch:
+			token_ch <- 1
 			if xmem.validateRunningState() != nil {
 				xmem.Logger().Infof("%v has stopped. Exiting", xmem.Id())
 				goto done
 			}
 
-			response, err, rev := xmem.readFromClient(xmem.client_for_setMeta, true)
+			response, err, rev := xmem.readFromClient(client, true)
 			if err != nil {
 				if err == PartStoppedError {
 					goto done
@@ -1960,22 +2364,22 @@ func (xmem *XmemNozzle) receiveResponse(finch chan bool, waitGrp *sync.WaitGroup
 						if err == nil && wrappedReq != nil {
 							req := wrappedReq.Req
 							if req != nil && req.Opaque == response.Opaque {
-								xmem.Logger().Warnf("%v received fatal error from setMeta client. req=%v, seqno=%v, response=%v\n", xmem.Id(), req, wrappedReq.Seqno, response)
+								xmem.Logger().Warnf("%v received fatal error from %v. req=%v, seqno=%v, response=%v\n", xmem.Id(), client.name, req, wrappedReq.Seqno, response)
 							}
 						}
 					}
 					goto done
 				} else if err == badConnectionError || err == connectionClosedError {
-					xmem.Logger().Errorf("%v The connection is ruined. Repair the connection and retry.", xmem.Id())
-					xmem.repairConn(xmem.client_for_setMeta, err.Error(), rev)
+					xmem.Logger().Errorf("%v The connection for %v is ruined. Repair the connection and retry.", xmem.Id(), client.name)
+					xmem.repairConn(client, err.Error(), rev)
 				}
 			} else if response == nil {
 				errMsg := fmt.Sprintf("%v readFromClient returned nil error and nil response. Ignoring it", xmem.Id())
 				xmem.Logger().Warn(errMsg)
-			} else if response.Status != mc.SUCCESS && !isIgnorableMCError(response.Status) {
+			} else if action := GetSetMetaResponseAction(response.Status); action != SetMetaRespDone {
 				if isTemporaryMCError(response.Status) {
 					// target may be overloaded. increase backoff factor to alleviate stress on target
-					xmem.client_for_setMeta.incrementBackOffFactor()
+					client.incrementBackOffFactor()
 
 					// error is temporary. resend doc
 					pos := xmem.getPosFromOpaque(response.Opaque)
@@ -1994,10 +2398,10 @@ func (xmem *XmemNozzle) receiveResponse(finch chan bool, waitGrp *sync.WaitGroup
 						seqno = wrappedReq.Seqno
 						if req != nil && req.Opaque == response.Opaque {
 							// found matching request
-							if isTopologyChangeMCError(response.Status) {
+							if action == SetMetaRespVBMoved {
 								vb_err := fmt.Errorf("Received error %v on vb %v\n", base.ErrorNotMyVbucket, req.VBucket)
 								xmem.handleVBError(req.VBucket, vb_err)
-							} else if response.Status == mc.KEY_ENOENT {
+							} else if action == SetMetaRespResend {
 								// KEY_ENOENT response is returned when a SetMeta request is on an existing document,
 								// i.e., doc with non-0 CAS, and the target cannot find the document.
 								// This is unlikely, but possible in the following scenario:
@@ -2013,7 +2417,7 @@ func (xmem *XmemNozzle) receiveResponse(finch chan bool, waitGrp *sync.WaitGroup
 							} else {
 								// for other non-temporary errors, repair connections
 								xmem.Logger().Errorf("%v received error response from setMeta client. Repairing connection. response status=%v, opcode=%v, seqno=%v, req.Key=%v%v%v, req.Cas=%v, req.Extras=%v\n", xmem.Id(), response.Status, response.Opcode, seqno, base.UdTagBegin, req.Key, base.UdTagEnd, req.Cas, req.Extras)
-								xmem.repairConn(xmem.client_for_setMeta, "error response from memcached", rev)
+								xmem.repairConn(client, "error response from memcached", rev)
 							}
 						} else if req != nil {
 							xmem.Logger().Debugf("%v Got the response, response.Opaque=%v, req.Opaque=%v\n", xmem.Id(), response.Opaque, req.Opaque)
@@ -2033,11 +2437,13 @@ func (xmem *XmemNozzle) receiveResponse(finch chan bool, waitGrp *sync.WaitGroup
 				}
 				var req *mc.MCRequest
 				var seqno uint64
+				var srcVBucket uint16
 				var committing_time time.Duration
 				var resp_wait_time time.Duration
 				if wrappedReq != nil {
 					req = wrappedReq.Req
 					seqno = wrappedReq.Seqno
+					srcVBucket = wrappedReq.SrcVBucket
 					committing_time = time.Since(wrappedReq.Start_time)
 					resp_wait_time = time.Since(*sent_time)
 				}
@@ -2047,7 +2453,7 @@ func (xmem *XmemNozzle) receiveResponse(finch chan bool, waitGrp *sync.WaitGroup
 						IsOptRepd:      xmem.optimisticRep(req),
 						Opcode:         req.Opcode,
 						IsExpirySet:    (binary.BigEndian.Uint32(req.Extras[4:8]) != 0),
-						VBucket:        req.VBucket,
+						VBucket:        srcVBucket,
 						Req_size:       req.Size(),
 						Commit_time:    committing_time,
 						Resp_wait_time: resp_wait_time,
@@ -2057,6 +2463,7 @@ func (xmem *XmemNozzle) receiveResponse(finch chan bool, waitGrp *sync.WaitGroup
 
 					//feedback the most current commit_time to xmem.config.respTimeout
 					xmem.adjustRespTimeout(resp_wait_time)
+					xmem.batchSizer.recordLatency(resp_wait_time)
 
 					//empty the slot in the buffer
 					if xmem.buf.evictSlot(pos) != nil {
@@ -2078,7 +2485,7 @@ func (xmem *XmemNozzle) receiveResponse(finch chan bool, waitGrp *sync.WaitGroup
 	}
 
 done:
-	xmem.Logger().Infof("%v receiveResponse exits\n", xmem.Id())
+	xmem.Logger().Infof("%v receiveResponse for %v exits\n", xmem.Id(), client.name)
 }
 
 func (xmem *XmemNozzle) handleVBError(vbno uint16, err error) {
@@ -2117,6 +2524,38 @@ func isNetTimeoutError(err error) bool {
 	return ok && netError.Timeout()
 }
 
+// how the response to a setMeta or delMeta request is handled
+type SetMetaResponseAction int
+
+const (
+	// request has been processed by target, including when it has lost conflict resolution on target
+	SetMetaRespDone SetMetaResponseAction = iota
+	// request needs to be resent
+	SetMetaRespResend
+	// vbucket is no longer on the target node that request has been sent to
+	SetMetaRespVBMoved
+	// request has failed with an error that resending it does not fix
+	SetMetaRespFailed
+)
+
+// returns how the response to a setMeta or delMeta request with the specified status is handled
+func GetSetMetaResponseAction(resp_status mc.Status) SetMetaResponseAction {
+	switch {
+	case resp_status == mc.SUCCESS || isIgnorableMCError(resp_status):
+		return SetMetaRespDone
+	case isTemporaryMCError(resp_status):
+		return SetMetaRespResend
+	case isTopologyChangeMCError(resp_status):
+		return SetMetaRespVBMoved
+	case resp_status == mc.KEY_ENOENT:
+		// setMeta request on an existing document, i.e., with non-0 CAS, gets KEY_ENOENT response when target
+		// no longer has the tombstone of the document. the request is resent, which is what 3.x XDCR does
+		return SetMetaRespResend
+	default:
+		return SetMetaRespFailed
+	}
+}
+
 // check if memcached response status indicates topology change,
 // in which case we defer pipeline restart to topology change detector
 func isTopologyChangeMCError(resp_status mc.Status) bool {
@@ -2164,7 +2603,7 @@ func (xmem *XmemNozzle) getMaxIdleCount() uint32 {
 // get max idle count adjusted by backoff_factor
 func (xmem *XmemNozzle) getAdjustedMaxIdleCount() uint32 {
 	max_idle_count := xmem.getMaxIdleCount()
-	backoff_factor := math.Max(float64(xmem.client_for_getMeta.getBackOffFactor()), float64(xmem.client_for_setMeta.getBackOffFactor()))
+	backoff_factor := math.Max(float64(xmem.client_for_getMeta.getBackOffFactor()), float64(xmem.getSetMetaBackOffFactor()))
 	backoff_factor = math.Min(float64(10), backoff_factor)
 
 	//if client_for_getMeta.backoff_factor > 0 or client_for_setMeta.backoff_factor > 0, it means the target system is possibly under load, need to be more patient before
@@ -2176,6 +2615,37 @@ func (xmem *XmemNozzle) getAdjustedMaxIdleCount() uint32 {
 	return max_idle_count
 }
 
+// the largest backoff factor of setMeta clients
+func (xmem *XmemNozzle) getSetMetaBackOffFactor() int {
+	var backoff_factor int
+	for _, client := range xmem.clients_for_setMeta {
+		if client.getBackOffFactor() > backoff_factor {
+			backoff_factor = client.getBackOffFactor()
+		}
+	}
+	return backoff_factor
+}
+
+// the max write failure counter among setMeta clients
+func (xmem *XmemNozzle) getSetMetaWriteFailureCounter() int {
+	var write_failure_counter int
+	for _, client := range xmem.getSetMetaClients() {
+		if client.curWriteFailureCounter() > write_failure_counter {
+			write_failure_counter = client.curWriteFailureCounter()
+		}
+	}
+	return write_failure_counter
+}
+
+// the total number of repairs on setMeta clients
+func (xmem *XmemNozzle) getSetMetaRepairCount() int {
+	var repair_count int
+	for _, client := range xmem.clients_for_setMeta {
+		repair_count += client.repairCount()
+	}
+	return repair_count
+}
+
 func (xmem *XmemNozzle) getRespTimeout() time.Duration {
 	return *((*time.Duration)(atomic.LoadPointer(&(xmem.config.respTimeout))))
 }
@@ -2225,7 +2695,7 @@ func (xmem *XmemNozzle) selfMonitor(finch chan bool, waitGrp *sync.WaitGroup) {
 
 			if xmem_count_sent == sent_count && int(buffer_count) == resp_waitingConfirm_count &&
 				(len(xmem.dataChan) > 0 || buffer_count != 0) &&
-				repairCount_setMeta == xmem.client_for_setMeta.repairCount() &&
+				repairCount_setMeta == xmem.getSetMetaRepairCount() &&
 				repairCount_getMeta == xmem.client_for_getMeta.repairCount() {
 				// Increment freeze_counter if there is data waiting and the count hasn't increased since last time we checked
 				freeze_counter++
@@ -2236,7 +2706,7 @@ func (xmem *XmemNozzle) selfMonitor(finch chan bool, waitGrp *sync.WaitGroup) {
 
 			sent_count = xmem_count_sent
 			resp_waitingConfirm_count = int(buffer_count)
-			repairCount_setMeta = xmem.client_for_setMeta.repairCount()
+			repairCount_setMeta = xmem.getSetMetaRepairCount()
 			repairCount_getMeta = xmem.client_for_getMeta.repairCount()
 			if count == 10 {
 				xmem.Logger().Debugf("%v- freeze_counter=%v, xmem.counter_sent=%v, len(xmem.dataChan)=%v, receive_count-%v, cur_batch_count=%v\n", xmem_id, freeze_counter, xmem_count_sent, len(dataChan), received_count, atomic.LoadUint32(&xmem.cur_batch_count))
@@ -2245,17 +2715,20 @@ func (xmem *XmemNozzle) selfMonitor(finch chan bool, waitGrp *sync.WaitGroup) {
 			}
 			max_idle_count := xmem.getAdjustedMaxIdleCount()
 			if freeze_counter > max_idle_count {
-				xmem.Logger().Errorf("%v hasn't sent any item out for %v ticks, %v data in queue, flowcontrol=%v, con_retry_limit=%v, backoff_factor for client_setMeta is %v, backoff_factor for client_getMeta is %v", xmem_id, max_idle_count, len(dataChan), buffer_count <= xmem.buf.notify_threshold, xmem.client_for_setMeta.continuous_write_failure_counter, xmem.client_for_setMeta.getBackOffFactor(), xmem.client_for_getMeta.getBackOffFactor())
+				xmem.Logger().Errorf("%v hasn't sent any item out for %v ticks, %v data in queue, flowcontrol=%v, con_retry_limit=%v, backoff_factor for client_setMeta is %v, backoff_factor for client_getMeta is %v", xmem_id, max_idle_count, len(dataChan), buffer_count <= xmem.buf.notify_threshold, xmem.getSetMetaWriteFailureCounter(), xmem.getSetMetaBackOffFactor(), xmem.client_for_getMeta.getBackOffFactor())
 				xmem.Logger().Infof("%v open=%v checking..., %v item unsent, received %v items, sent %v items, %v items waiting for response, %v batches ready\n", xmem_id, isOpen, len(dataChan), received_count, xmem_count_sent, int(buffer_size)-len(empty_slots_pos), len(batches_ready_queue))
 				//				utils.DumpStack(xmem.Logger())
 				//the connection might not be healthy, it should not go back to connection pool
-				xmem.client_for_setMeta.markConnUnhealthy()
+				for _, client_for_setMeta := range xmem.clients_for_setMeta {
+					client_for_setMeta.markConnUnhealthy()
+				}
 				xmem.client_for_getMeta.markConnUnhealthy()
 				xmem.handleGeneralError(errors.New("Xmem is stuck"))
 				goto done
 			}
 		case <-statsTicker.C:
-			xmem.RaiseEvent(common.NewEvent(common.StatsUpdate, nil, xmem, nil, []int{len(xmem.dataChan), xmem.bytesInDataChan()}))
+			xmem.RaiseEvent(common.NewEvent(common.StatsUpdate, nil, xmem, nil, []int{len(xmem.dataChan), xmem.bytesInDataChan(), int(atomic.LoadUint64(&xmem.counter_resend)),
+				int(xmem.batchSizer.batchCount()), int(xmem.batchSizer.batchSize())}))
 		}
 	}
 done:
@@ -2306,6 +2779,8 @@ func (xmem *XmemNozzle) resendIfTimeout(req *bufferedMCRequest, pos uint16) (boo
 	// 1. there is a valid WrappedMCRequest associated with req
 	// and 2. req has not timed out, i.e., has not reached max retry limit
 	if req.req != nil && !req.timedout {
+		// resend through the client that the request was sent through, so that the order of requests in the vbucket is kept
+		client := xmem.clients_for_setMeta[req.conn_index]
 		if req.num_of_retry > xmem.config.maxRetry {
 			req.timedout = true
 			err = errors.New(fmt.Sprintf("%v Failed to resend document %s, has tried to resend it %v, maximum retry %v reached",
@@ -2315,7 +2790,7 @@ func (xmem *XmemNozzle) resendIfTimeout(req *bufferedMCRequest, pos uint16) (boo
 			// release lock before the expensive repairConn call
 			req.lock.Unlock()
 
-			xmem.repairConn(xmem.client_for_setMeta, err.Error(), xmem.client_for_setMeta.repairCount())
+			xmem.repairConn(client, err.Error(), client.repairCount())
 			return true, err
 		}
 
@@ -2329,7 +2804,7 @@ func (xmem *XmemNozzle) resendIfTimeout(req *bufferedMCRequest, pos uint16) (boo
 			// release the lock on req before calling sendSingleSetMeta, which may block
 			req.lock.Unlock()
 
-			err = xmem.sendSingleSetMeta(bytesList, xmem.config.maxRetry)
+			err = xmem.sendSingleSetMeta(client, bytesList, xmem.config.maxRetry)
 
 			if err == nil {
 				// lock req again since it needs to be accessed and possibly modified
@@ -2389,6 +2864,7 @@ func (xmem *XmemNozzle) resendWithReset(req *bufferedMCRequest, pos uint16) (boo
 
 	bytesList := getBytesListFromReq(req)
 	old_sequence := xmem.buf.sequences[pos]
+	client := xmem.clients_for_setMeta[req.conn_index]
 
 	// reset num_of_retry to 0 and reset timedout to false
 	if req.num_of_retry != 0 || req.timedout {
@@ -2400,7 +2876,7 @@ func (xmem *XmemNozzle) resendWithReset(req *bufferedMCRequest, pos uint16) (boo
 	// release the lock on req before calling sendSingleSetMeta, which may block
 	req.lock.Unlock()
 
-	err = xmem.sendSingleSetMeta(bytesList, xmem.config.maxRetry)
+	err = xmem.sendSingleSetMeta(client, bytesList, xmem.config.maxRetry)
 
 	if err != nil {
 		return modified, err
@@ -2450,13 +2926,13 @@ func (xmem *XmemNozzle) PrintStatusSummary() {
 		if counter_sent > 0 {
 			avg_wait_time = float64(atomic.LoadUint64(&xmem.counter_waittime)) / float64(counter_sent)
 		}
-		xmem.Logger().Infof("%v state =%v connType=%v received %v items (%v compressed), sent %v items (%v compressed), %v items waiting to confirm, %v in queue, %v in current batch, avg wait time is %vms, size of last ten batches processed %v, len(batches_ready_queue)=%v resend=%v repair_count_getMeta=%v repair_count_setMeta=%v\n",
+		xmem.Logger().Infof("%v state =%v connType=%v received %v items (%v compressed), sent %v items (%v compressed), %v items waiting to confirm, %v in queue, %v in current batch, avg wait time is %vms, size of last ten batches processed %v, batch count=%v, batch size=%vKB, len(batches_ready_queue)=%v resend=%v repair_count_getMeta=%v repair_count_setMeta=%v\n",
 			xmem.Id(), xmem.State(), connType, atomic.LoadUint64(&xmem.counter_received),
 			atomic.LoadUint64(&xmem.counter_compressed_received), atomic.LoadUint64(&xmem.counter_sent),
 			atomic.LoadUint64(&xmem.counter_compressed_sent), xmem.buf.itemCountInBuffer(), len(xmem.dataChan),
 			atomic.LoadUint32(&xmem.cur_batch_count), avg_wait_time, xmem.getLastTenBatchSize(),
-			len(xmem.batches_ready_queue), atomic.LoadUint64(&xmem.counter_resend),
-			xmem.client_for_getMeta.repairCount(), xmem.client_for_setMeta.repairCount())
+			xmem.batchSizer.batchCount(), xmem.batchSizer.batchSize(), len(xmem.batches_ready_queue), atomic.LoadUint64(&xmem.counter_resend),
+			xmem.client_for_getMeta.repairCount(), xmem.getSetMetaRepairCount())
 	} else {
 		xmem.Logger().Infof("%v state =%v ", xmem.Id(), xmem.State())
 	}
@@ -2473,22 +2949,26 @@ func (xmem *XmemNozzle) handleGeneralError(err error) {
 }
 
 func (xmem *XmemNozzle) optimisticRep(req *mc.MCRequest) bool {
+	if xmem.customConflictResolver {
+		// custom conflict resolver needs to be consulted for every document, regardless of its size
+		return false
+	}
 	if req != nil {
 		return uint32(req.Size()) < xmem.getOptiRepThreshold()
 	}
 	return true
 }
 
-func (xmem *XmemNozzle) sendHELO(setMeta bool) (utilities.HELOFeatures, error) {
+func (xmem *XmemNozzle) sendHELO(client *xmemClient, setMeta bool) (utilities.HELOFeatures, error) {
 	var features utilities.HELOFeatures
 	features.Xattribute = true
 	if setMeta {
 		// For setMeta, negotiate compression, if it is set
 		features.CompressionType = xmem.compressionSetting
-		return xmem.utils.SendHELOWithFeatures(xmem.client_for_setMeta.getMemClient(), xmem.setMetaUserAgent, xmem.config.readTimeout, xmem.config.writeTimeout, features, xmem.Logger())
+		return xmem.utils.SendHELOWithFeatures(client.getMemClient(), xmem.setMetaUserAgent, xmem.config.readTimeout, xmem.config.writeTimeout, features, xmem.Logger())
 	} else {
 		// Since compression is value only, getMeta does not benefit from it. Use a non-compressed connection
-		return xmem.utils.SendHELOWithFeatures(xmem.client_for_getMeta.getMemClient(), xmem.getMetaUserAgent, xmem.config.readTimeout, xmem.config.writeTimeout, features, xmem.Logger())
+		return xmem.utils.SendHELOWithFeatures(client.getMemClient(), xmem.getMetaUserAgent, xmem.config.readTimeout, xmem.config.writeTimeout, features, xmem.Logger())
 	}
 }
 
@@ -2787,8 +3267,8 @@ func (xmem *XmemNozzle) repairConn(client *xmemClient, reason string, rev int) e
 	repaired := client.repairConn(memClient, rev, xmem.Id(), xmem.finish_ch)
 	if repaired {
 		var features utilities.HELOFeatures
-		if client == xmem.client_for_setMeta {
-			features, err = xmem.sendHELO(true /*setMeta*/)
+		if conn_index := xmem.getSetMetaClientIndex(client); conn_index >= 0 {
+			features, err = xmem.sendHELO(client, true /*setMeta*/)
 			if err != nil {
 				xmem.handleGeneralError(err)
 				xmem.Logger().Errorf("%v - Failed to repair connections for %v. err=%v\n", xmem.Id(), client.name, err)
@@ -2802,10 +3282,10 @@ func (xmem *XmemNozzle) repairConn(client *xmemClient, reason string, rev int) e
 			}
 
 			xmem.xattrEnabled = features.Xattribute
-			go xmem.onSetMetaConnRepaired()
+			go xmem.onSetMetaConnRepaired(conn_index)
 		} else {
 			// No need to check features for bare-bone getMeta client
-			_, err = xmem.sendHELO(false /*setMeta*/)
+			_, err = xmem.sendHELO(client, false /*setMeta*/)
 			if err != nil {
 				xmem.handleGeneralError(err)
 				xmem.Logger().Errorf("%v - Failed to repair connections for %v. err=%v\n", xmem.Id(), client.name, err)
@@ -2817,11 +3297,21 @@ func (xmem *XmemNozzle) repairConn(client *xmemClient, reason string, rev int) e
 	return nil
 }
 
-func (xmem *XmemNozzle) onSetMetaConnRepaired() error {
+// resends requests that were sent through the setMeta client at conn_index and have not been responded to
+func (xmem *XmemNozzle) onSetMetaConnRepaired(conn_index int) error {
 	size := xmem.buf.bufferSize()
 	count := 0
+	resendFunc := func(req *bufferedMCRequest, pos uint16) (bool, error) {
+		req.lock.RLock()
+		onRepairedConn := req.req != nil && req.conn_index == conn_index
+		req.lock.RUnlock()
+		if !onRepairedConn {
+			return false, nil
+		}
+		return xmem.resendWithReset(req, pos)
+	}
 	for i := 0; i < int(size); i++ {
-		sent, err := xmem.buf.modSlot(uint16(i), xmem.resendWithReset)
+		sent, err := xmem.buf.modSlot(uint16(i), resendFunc)
 		if err != nil {
 			return err
 		}
@@ -2829,7 +3319,7 @@ func (xmem *XmemNozzle) onSetMetaConnRepaired() error {
 			count++
 		}
 	}
-	xmem.Logger().Infof("%v - %v unresponded items are resent\n", xmem.Id(), count)
+	xmem.Logger().Infof("%v - %v unresponded items are resent through %v\n", xmem.Id(), count, getSetMetaClientName(conn_index))
 	return nil
 
 }
@@ -2845,6 +3335,16 @@ func (xmem *XmemNozzle) UpdateSettings(settings metadata.ReplicationSettingsMap)
 		atomic.StoreUint32(&xmem.config.optiRepThreshold, uint32(optimisticReplicationThresholdInt))
 		xmem.Logger().Infof("%v updated optimistic replication threshold to %v\n", xmem.Id(), optimisticReplicationThresholdInt)
 	}
+	conflictLogging, ok := settings[XMEM_SETTING_CONFLICT_LOGGING]
+	if ok {
+		xmem.conflictLogging.Set(conflictLogging.(bool))
+		xmem.Logger().Infof("%v updated conflict logging to %v\n", xmem.Id(), conflictLogging)
+	}
+	targetBatchLatency, ok := settings[XMEM_SETTING_TARGET_BATCH_LATENCY]
+	if ok && xmem.batchSizer != nil {
+		xmem.batchSizer.setTargetLatency(targetBatchLatency.(time.Duration))
+		xmem.Logger().Infof("%v updated target batch latency to %v\n", xmem.Id(), targetBatchLatency)
+	}
 	return nil
 }
 
@@ -3,7 +3,9 @@
 package parts
 
 import (
+	"encoding/binary"
 	"fmt"
+	mc "github.com/couchbase/gomemcached"
 	mcMock "github.com/couchbase/gomemcached/client/mocks"
 	base "github.com/couchbase/goxdcr/base"
 	"github.com/couchbase/goxdcr/log"
@@ -101,3 +103,189 @@ func TestPositiveXmemNozzleAuto(t *testing.T) {
 	assert.NotNil(xmem.initialize(settings))
 	fmt.Println("============== Test case end: TestPositiveXmemNozzleAuto =================")
 }
+
+func TestXmemNozzleSetMetaConnections(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestXmemNozzleSetMetaConnections =================")
+	utils, _, settings, xmem := setupBoilerPlateXmem()
+	settings[XMEM_SETTING_SETMETA_CONNECTIONS] = 3
+	setupMocksXmem(utils)
+
+	assert.Nil(xmem.initialize(settings))
+	clients := xmem.getSetMetaClients()
+	assert.Equal(3, len(clients))
+	assert.Equal(3, len(xmem.receive_token_chs))
+	assert.Equal(SetMetaClientName, clients[0].name)
+	assert.NotEqual(clients[1].name, clients[2].name)
+	assert.Equal(1, xmem.getSetMetaClientIndex(clients[1]))
+	assert.Equal(-1, xmem.getSetMetaClientIndex(xmem.getGetMetaClient()))
+
+	// requests in the same vbucket always go through the same connection
+	assert.Equal(0, xmem.getSetMetaConnIndex(0))
+	assert.Equal(2, xmem.getSetMetaConnIndex(5))
+	assert.Equal(2, xmem.getSetMetaConnIndex(8))
+
+	// requests hold tokens of the connections that they are sent through until they are confirmed
+	req := &base.WrappedMCRequest{Req: &mc.MCRequest{Opcode: mc.UPR_MUTATION, VBucket: 5, Key: []byte("key")}}
+	pos, _, _ := xmem.buf.enSlot(req, xmem.getSetMetaConnIndex(5))
+	assert.Equal(0, len(xmem.receive_token_chs[0]))
+	assert.Equal(1, len(xmem.receive_token_chs[2]))
+	assert.Nil(xmem.buf.evictSlot(pos))
+	assert.Equal(0, len(xmem.receive_token_chs[2]))
+
+	fmt.Println("============== Test case end: TestXmemNozzleSetMetaConnections =================")
+}
+
+func TestXmemNozzleCustomConflictResolver(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestXmemNozzleCustomConflictResolver =================")
+	utils, _, settings, xmem := setupBoilerPlateXmem()
+	setupMocksXmem(utils)
+
+	smallReq := &mc.MCRequest{Opcode: mc.UPR_MUTATION, Key: []byte("key"), Extras: make([]byte, 24)}
+	assert.Nil(xmem.initialize(settings))
+	assert.False(xmem.customConflictResolver)
+	assert.True(xmem.optimisticRep(smallReq))
+
+	// with a custom conflict resolver, every document goes through source side conflict resolution
+	utils, _, settings, xmem = setupBoilerPlateXmem()
+	settings[XMEM_SETTING_CONFLICT_RESOLVER] = base.ConflictResolverSourceWins
+	setupMocksXmem(utils)
+	assert.Nil(xmem.initialize(settings))
+	assert.True(xmem.customConflictResolver)
+	assert.False(xmem.optimisticRep(smallReq))
+
+	// requests without options get the options field appended
+	SetSkipConflictResolution(smallReq)
+	assert.Equal(28, len(smallReq.Extras))
+	assert.Equal(base.SKIP_CONFLICT_RESOLUTION_FLAG, binary.BigEndian.Uint32(smallReq.Extras[24:28]))
+
+	// existing options are preserved
+	lwwReq := &mc.MCRequest{Opcode: mc.UPR_MUTATION, Key: []byte("key"), Extras: make([]byte, 28)}
+	binary.BigEndian.PutUint32(lwwReq.Extras[24:28], base.FORCE_ACCEPT_WITH_META_OPS)
+	SetSkipConflictResolution(lwwReq)
+	assert.Equal(base.SKIP_CONFLICT_RESOLUTION_FLAG|base.FORCE_ACCEPT_WITH_META_OPS, binary.BigEndian.Uint32(lwwReq.Extras[24:28]))
+
+	// options go before extended meta length, which is preserved
+	extMetaReq := &mc.MCRequest{Opcode: mc.UPR_MUTATION, Key: []byte("key"), Extras: make([]byte, 26)}
+	binary.BigEndian.PutUint16(extMetaReq.Extras[24:26], 12)
+	SetSkipConflictResolution(extMetaReq)
+	assert.Equal(30, len(extMetaReq.Extras))
+	assert.Equal(base.SKIP_CONFLICT_RESOLUTION_FLAG, binary.BigEndian.Uint32(extMetaReq.Extras[24:28]))
+	assert.Equal(uint16(12), binary.BigEndian.Uint16(extMetaReq.Extras[28:30]))
+
+	extMetaReq = &mc.MCRequest{Opcode: mc.UPR_MUTATION, Key: []byte("key"), Extras: make([]byte, 30)}
+	binary.BigEndian.PutUint32(extMetaReq.Extras[24:28], base.FORCE_ACCEPT_WITH_META_OPS)
+	binary.BigEndian.PutUint16(extMetaReq.Extras[28:30], 12)
+	SetSkipConflictResolution(extMetaReq)
+	assert.Equal(30, len(extMetaReq.Extras))
+	assert.Equal(base.SKIP_CONFLICT_RESOLUTION_FLAG|base.FORCE_ACCEPT_WITH_META_OPS, binary.BigEndian.Uint32(extMetaReq.Extras[24:28]))
+	assert.Equal(uint16(12), binary.BigEndian.Uint16(extMetaReq.Extras[28:30]))
+
+	fmt.Println("============== Test case end: TestXmemNozzleCustomConflictResolver =================")
+}
+
+func TestXmemNozzleGetDocument(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestXmemNozzleGetDocument =================")
+
+	xattrNames := []string{"a", "missing"}
+	req := ComposeRequestForGetDocument("key", 5, 10, xattrNames)
+	assert.Equal(base.SUBDOC_MULTI_LOOKUP, req.Opcode)
+	assert.Equal(uint16(5), req.VBucket)
+	// xattr specs, followed by the document spec with empty path
+	expectedBody := []byte{byte(base.SUBDOC_GET), base.SUBDOC_FLAG_XATTR_PATH, 0, 1, 'a',
+		byte(base.SUBDOC_GET), base.SUBDOC_FLAG_XATTR_PATH, 0, 7, 'm', 'i', 's', 's', 'i', 'n', 'g',
+		byte(mc.GET), 0, 0, 0}
+	assert.Equal(expectedBody, req.Body)
+
+	// results are in the form of <2 byte status><4 byte value length><value>
+	appendResult := func(body []byte, status mc.Status, value string) []byte {
+		result := make([]byte, 6)
+		binary.BigEndian.PutUint16(result[0:2], uint16(status))
+		binary.BigEndian.PutUint32(result[2:6], uint32(len(value)))
+		return append(append(body, result...), value...)
+	}
+	var respBody []byte
+	respBody = appendResult(respBody, mc.SUCCESS, `{"x":1}`)
+	respBody = appendResult(respBody, mc.Status(0xc0), "")
+	respBody = appendResult(respBody, mc.SUCCESS, `{"version":2}`)
+	meta := base.NewDocumentMetadata([]byte("key"), 1, 1, 0, 0, false, 0)
+	doc, err := DecodeGetDocumentResp(&mc.MCResponse{Status: base.SUBDOC_MULTI_PATH_FAILURE, Body: respBody}, meta, xattrNames)
+	assert.Nil(err)
+	assert.Equal(map[string]string{"a": `{"x":1}`}, doc.Xattrs)
+	assert.Equal([]byte(`{"version":2}`), doc.Body)
+
+	_, err = DecodeGetDocumentResp(&mc.MCResponse{Status: mc.SUCCESS, Body: respBody[:10]}, meta, xattrNames)
+	assert.NotNil(err)
+	_, err = DecodeGetDocumentResp(&mc.MCResponse{Status: mc.KEY_ENOENT}, meta, xattrNames)
+	assert.NotNil(err)
+
+	// merged xattrs replace the xattrs of source mutation
+	source := &mc.MCRequest{Opcode: mc.UPR_MUTATION, Key: []byte("key"), DataType: base.JSONDataType, Body: []byte(`{"version":3}`)}
+	assert.Nil(setXattrs(source, map[string]string{"b": "2", "a": `{"x":1}`}))
+	assert.Equal(uint8(base.JSONDataType|base.XattrDataType), source.DataType)
+	doc, err = decodeDocumentFromRequest(source, meta)
+	assert.Nil(err)
+	assert.Equal(map[string]string{"a": `{"x":1}`, "b": "2"}, doc.Xattrs)
+	assert.Equal([]byte(`{"version":3}`), doc.Body)
+
+	fmt.Println("============== Test case end: TestXmemNozzleGetDocument =================")
+}
+
+func TestXmemNozzleReadDocument(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestXmemNozzleReadDocument =================")
+
+	xattrNames := []string{base.SubdocDocumentSeqno, base.SubdocXattrTOC}
+	req := ComposeRequestForGetXattrs("key", 5, 10, xattrNames)
+	assert.Equal(base.SUBDOC_MULTI_LOOKUP, req.Opcode)
+	assert.Equal([]byte{base.SUBDOC_DOC_FLAG_ACCESS_DELETED}, req.Extras)
+
+	appendResult := func(body []byte, status mc.Status, value string) []byte {
+		result := make([]byte, 6)
+		binary.BigEndian.PutUint16(result[0:2], uint16(status))
+		binary.BigEndian.PutUint32(result[2:6], uint32(len(value)))
+		return append(append(body, result...), value...)
+	}
+	var respBody []byte
+	respBody = appendResult(respBody, mc.SUCCESS, `"0x000000000000000a"`)
+	respBody = appendResult(respBody, mc.SUCCESS, `["a"]`)
+	xattrs, err := DecodeGetXattrsResp(&mc.MCResponse{Status: base.SUBDOC_SUCCESS_DELETED, Body: respBody}, xattrNames)
+	assert.Nil(err)
+	assert.Equal(`"0x000000000000000a"`, xattrs[base.SubdocDocumentSeqno])
+	assert.Equal(`["a"]`, xattrs[base.SubdocXattrTOC])
+	_, err = DecodeGetXattrsResp(&mc.MCResponse{Status: mc.KEY_ENOENT}, xattrNames)
+	assert.NotNil(err)
+
+	// live document with xattrs becomes a mutation with the xattr section in its value
+	meta := base.NewDocumentMetadata([]byte("key"), 2, 100, 1, 0, false, base.JSONDataType|base.XattrDataType|base.SnappyDataType)
+	doc := &base.Document{Metadata: meta, Xattrs: map[string]string{"a": `{"x":1}`}, Body: []byte(`{"version":2}`)}
+	event := ComposeUprEventForDocument(doc, 5, 10)
+	assert.Equal(mc.UPR_MUTATION, event.Opcode)
+	assert.Equal(uint64(10), event.Seqno)
+	assert.Equal(uint64(100), event.Cas)
+	assert.Equal(uint8(base.JSONDataType|base.XattrDataType), event.DataType)
+	setMetaReq, err := ComposeRequestForSetMeta(event, base.CRMode_RevId, 0, nil)
+	assert.Nil(err)
+	decodedDoc, err := decodeDocumentFromRequest(setMetaReq, meta)
+	assert.Nil(err)
+	assert.Equal(doc.Xattrs, decodedDoc.Xattrs)
+	assert.Equal(doc.Body, decodedDoc.Body)
+
+	// deleted document becomes a deletion without value
+	meta = base.NewDocumentMetadata([]byte("key"), 3, 200, 0, 0, true, base.XattrDataType)
+	event = ComposeUprEventForDocument(&base.Document{Metadata: meta}, 5, 11)
+	assert.Equal(mc.UPR_DELETION, event.Opcode)
+	assert.Equal(uint8(0), event.DataType)
+	assert.Equal(0, len(event.Value))
+
+	assert.Equal(SetMetaRespDone, GetSetMetaResponseAction(mc.SUCCESS))
+	assert.Equal(SetMetaRespDone, GetSetMetaResponseAction(mc.KEY_EEXISTS))
+	assert.Equal(SetMetaRespResend, GetSetMetaResponseAction(mc.TMPFAIL))
+	assert.Equal(SetMetaRespResend, GetSetMetaResponseAction(mc.KEY_ENOENT))
+	assert.Equal(SetMetaRespVBMoved, GetSetMetaResponseAction(mc.NOT_MY_VBUCKET))
+	assert.Equal(SetMetaRespFailed, GetSetMetaResponseAction(mc.EINVAL))
+
+	fmt.Println("============== Test case end: TestXmemNozzleReadDocument =================")
+}
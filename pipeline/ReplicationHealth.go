@@ -0,0 +1,184 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package pipeline
+
+import (
+	"fmt"
+	"github.com/couchbase/goxdcr/base"
+	"time"
+)
+
+// health states of replication, in the order of increasing severity
+const (
+	ReplicationHealthy  = "healthy"
+	ReplicationDegraded = "degraded"
+	ReplicationStalled  = "stalled"
+	ReplicationFailed   = "failed"
+)
+
+var replicationHealthSeverity = map[string]int{
+	ReplicationHealthy:  0,
+	ReplicationDegraded: 1,
+	ReplicationStalled:  2,
+	ReplicationFailed:   3,
+}
+
+// codes of the reasons for replication health states
+const (
+	HealthReasonPaused                   = "paused"
+	HealthReasonPausedBySchedule         = "paused_by_schedule"
+	HealthReasonCompleted                = "completed"
+	HealthReasonNotRunning               = "pipeline_not_running"
+	HealthReasonThroughSeqnoNotAdvancing = "through_seqno_not_advancing"
+	HealthReasonChangesLeftGrowing       = "changes_left_growing"
+	HealthReasonRecentErrors             = "recent_errors"
+	HealthReasonHighResendRate           = "high_resend_rate"
+	HealthReasonCheckpointStale          = "checkpoint_stale"
+)
+
+type ReplicationHealthReason struct {
+	Code string `json:"code"`
+	// the health state that the reason leads to
+	State   string `json:"state"`
+	Message string `json:"message"`
+}
+
+type ReplicationHealth struct {
+	State   string                     `json:"state"`
+	Reasons []*ReplicationHealthReason `json:"reasons"`
+	// time when health was evaluated
+	Timestamp time.Time `json:"time"`
+}
+
+func NewReplicationHealth() *ReplicationHealth {
+	return &ReplicationHealth{
+		State:     ReplicationHealthy,
+		Reasons:   make([]*ReplicationHealthReason, 0),
+		Timestamp: time.Now(),
+	}
+}
+
+// adds a reason, and raises the health state to the state of the reason if it is more severe
+func (health *ReplicationHealth) AddReason(state, code, message string) {
+	health.Reasons = append(health.Reasons, &ReplicationHealthReason{Code: code, State: state, Message: message})
+	if replicationHealthSeverity[state] > replicationHealthSeverity[health.State] {
+		health.State = state
+	}
+}
+
+// replication stats taken at a health check
+type ReplicationHealthSample struct {
+	Time        time.Time
+	ChangesLeft int64
+	// sum of through seqnos of all vbs
+	DocsProcessed  int64
+	DocsResent     int64
+	NumCheckpoints int64
+}
+
+// ReplicationHealthTracker keeps the stats samples of a running pipeline over base.ReplicationHealthWindow
+// and evaluates replication health from them. It is not thread safe and is meant to be used by the health check
+// routine of pipeline supervisor
+type ReplicationHealthTracker struct {
+	samples []*ReplicationHealthSample
+	// time of the sample at which a new checkpoint was first seen, and docs processed at that time
+	lastCheckpointTime          time.Time
+	lastCheckpointDocsProcessed int64
+}
+
+func NewReplicationHealthTracker() *ReplicationHealthTracker {
+	return &ReplicationHealthTracker{samples: make([]*ReplicationHealthSample, 0)}
+}
+
+func (tracker *ReplicationHealthTracker) AddSample(sample *ReplicationHealthSample) {
+	if len(tracker.samples) == 0 {
+		// pipeline start is treated as the last checkpoint
+		tracker.lastCheckpointTime = sample.Time
+		tracker.lastCheckpointDocsProcessed = sample.DocsProcessed
+	} else if sample.NumCheckpoints > tracker.samples[len(tracker.samples)-1].NumCheckpoints {
+		tracker.lastCheckpointTime = sample.Time
+		tracker.lastCheckpointDocsProcessed = sample.DocsProcessed
+	}
+	tracker.samples = append(tracker.samples, sample)
+
+	// drop samples that are older than the window, but keep the newest of them so that the samples cover the whole window
+	cutoff := sample.Time.Add(-base.ReplicationHealthWindow)
+	for len(tracker.samples) > 1 && !tracker.samples[1].Time.After(cutoff) {
+		tracker.samples = tracker.samples[1:]
+	}
+}
+
+// Evaluate computes replication health from the samples, the errors of the replication,
+// and the checkpoint interval of the replication
+func (tracker *ReplicationHealthTracker) Evaluate(errs PipelineErrorArray, checkpointInterval time.Duration) *ReplicationHealth {
+	health := NewReplicationHealth()
+
+	recentErrors := 0
+	for _, pipelineError := range errs {
+		if health.Timestamp.Sub(pipelineError.Timestamp) <= base.ReplicationHealthWindow {
+			recentErrors++
+		}
+	}
+	if recentErrors >= base.ReplicationHealthErrorThreshold {
+		health.AddReason(ReplicationDegraded, HealthReasonRecentErrors,
+			fmt.Sprintf("%v errors in the last %v. last error: %v", recentErrors, base.ReplicationHealthWindow, errs[0].ErrMsg))
+	}
+
+	if len(tracker.samples) < 2 {
+		return health
+	}
+	first := tracker.samples[0]
+	last := tracker.samples[len(tracker.samples)-1]
+
+	// through seqnos have not moved for the whole window while there are changes left
+	if last.Time.Sub(first.Time) >= base.ReplicationHealthWindow && last.DocsProcessed == first.DocsProcessed {
+		pending := true
+		for _, sample := range tracker.samples {
+			if sample.ChangesLeft <= 0 {
+				pending = false
+				break
+			}
+		}
+		if pending {
+			health.AddReason(ReplicationStalled, HealthReasonThroughSeqnoNotAdvancing,
+				fmt.Sprintf("through seqnos have not advanced since %v while %v changes are left", first.Time.Format(time.RFC3339), last.ChangesLeft))
+		}
+	}
+
+	// changes left have grown at every sample, i.e., replication is not keeping up with mutations on source
+	if len(tracker.samples) >= 3 {
+		growing := true
+		for i := 1; i < len(tracker.samples); i++ {
+			if tracker.samples[i].ChangesLeft <= tracker.samples[i-1].ChangesLeft {
+				growing = false
+				break
+			}
+		}
+		if growing {
+			health.AddReason(ReplicationDegraded, HealthReasonChangesLeftGrowing,
+				fmt.Sprintf("changes left have grown from %v to %v since %v", first.ChangesLeft, last.ChangesLeft, first.Time.Format(time.RFC3339)))
+		}
+	}
+
+	docsResent := last.DocsResent - first.DocsResent
+	docsProcessed := last.DocsProcessed - first.DocsProcessed
+	if docsResent > 0 && float64(docsResent) > base.ReplicationHealthMaxResendRatio*float64(docsProcessed) {
+		health.AddReason(ReplicationDegraded, HealthReasonHighResendRate,
+			fmt.Sprintf("%v docs resent to target while %v docs processed since %v", docsResent, docsProcessed, first.Time.Format(time.RFC3339)))
+	}
+
+	maxCheckpointAge := checkpointInterval * time.Duration(base.ReplicationHealthMaxCheckpointIntervals)
+	if checkpointInterval > 0 && last.DocsProcessed > tracker.lastCheckpointDocsProcessed && last.Time.Sub(tracker.lastCheckpointTime) > maxCheckpointAge {
+		health.AddReason(ReplicationDegraded, HealthReasonCheckpointStale,
+			fmt.Sprintf("no checkpoint has been taken since %v", tracker.lastCheckpointTime.Format(time.RFC3339)))
+	}
+
+	return health
+}
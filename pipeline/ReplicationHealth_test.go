@@ -0,0 +1,129 @@
+// +build !pcre
+
+package pipeline
+
+import (
+	"fmt"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func reasonCodes(health *ReplicationHealth) []string {
+	codes := make([]string, 0)
+	for _, reason := range health.Reasons {
+		codes = append(codes, reason.Code)
+	}
+	return codes
+}
+
+func TestReplicationHealthTrackerHealthy(t *testing.T) {
+	fmt.Println("============== Test case start: TestReplicationHealthTrackerHealthy =================")
+	assert := assert.New(t)
+
+	tracker := NewReplicationHealthTracker()
+	start := time.Now().Add(-time.Hour)
+	// no samples
+	health := tracker.Evaluate(nil, 10*time.Minute)
+	assert.Equal(ReplicationHealthy, health.State)
+	assert.Equal(0, len(health.Reasons))
+
+	for i := 0; i < 10; i++ {
+		tracker.AddSample(&ReplicationHealthSample{
+			Time:           start.Add(time.Duration(i) * 2 * time.Minute),
+			ChangesLeft:    int64(1000 - i*100),
+			DocsProcessed:  int64(i * 100),
+			DocsResent:     0,
+			NumCheckpoints: int64(i / 5),
+		})
+	}
+	// samples older than the window are dropped
+	assert.Equal(6, len(tracker.samples))
+
+	health = tracker.Evaluate(nil, 10*time.Minute)
+	assert.Equal(ReplicationHealthy, health.State)
+	assert.Equal(0, len(health.Reasons))
+
+	fmt.Println("============== Test case end: TestReplicationHealthTrackerHealthy =================")
+}
+
+func TestReplicationHealthTrackerStalled(t *testing.T) {
+	fmt.Println("============== Test case start: TestReplicationHealthTrackerStalled =================")
+	assert := assert.New(t)
+
+	tracker := NewReplicationHealthTracker()
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		tracker.AddSample(&ReplicationHealthSample{Time: start.Add(time.Duration(i) * 2 * time.Minute), ChangesLeft: 100, DocsProcessed: 500})
+	}
+	// the samples do not cover the whole window yet
+	health := tracker.Evaluate(nil, 10*time.Minute)
+	assert.Equal(ReplicationHealthy, health.State)
+
+	tracker.AddSample(&ReplicationHealthSample{Time: start.Add(10 * time.Minute), ChangesLeft: 100, DocsProcessed: 500})
+	health = tracker.Evaluate(nil, 10*time.Minute)
+	assert.Equal(ReplicationStalled, health.State)
+	assert.Equal([]string{HealthReasonThroughSeqnoNotAdvancing}, reasonCodes(health))
+
+	// nothing to replicate is not a stall
+	tracker.AddSample(&ReplicationHealthSample{Time: start.Add(12 * time.Minute), ChangesLeft: 0, DocsProcessed: 500})
+	health = tracker.Evaluate(nil, 10*time.Minute)
+	assert.Equal(ReplicationHealthy, health.State)
+
+	fmt.Println("============== Test case end: TestReplicationHealthTrackerStalled =================")
+}
+
+func TestReplicationHealthTrackerDegraded(t *testing.T) {
+	fmt.Println("============== Test case start: TestReplicationHealthTrackerDegraded =================")
+	assert := assert.New(t)
+
+	tracker := NewReplicationHealthTracker()
+	start := time.Now().Add(-time.Hour)
+	// changes left keep growing, many docs are resent and no checkpoint is taken
+	for i := 0; i < 12; i++ {
+		tracker.AddSample(&ReplicationHealthSample{
+			Time:          start.Add(time.Duration(i) * 2 * time.Minute),
+			ChangesLeft:   int64(1000 + i*100),
+			DocsProcessed: int64(i * 100),
+			DocsResent:    int64(i * 10),
+		})
+	}
+	// errors are ordered from the newest to the oldest
+	errs := PipelineErrorArray{PipelineError{Timestamp: time.Now(), ErrMsg: "recent error"}}
+	for i := 1; i < base.ReplicationHealthErrorThreshold; i++ {
+		errs = append(errs, PipelineError{Timestamp: time.Now().Add(-time.Duration(i) * time.Minute), ErrMsg: "earlier error"})
+	}
+	errs = append(errs, PipelineError{Timestamp: time.Now().Add(-2 * base.ReplicationHealthWindow), ErrMsg: "old error"})
+
+	health := tracker.Evaluate(errs, 10*time.Minute)
+	assert.Equal(ReplicationDegraded, health.State)
+	assert.Equal([]string{HealthReasonRecentErrors, HealthReasonChangesLeftGrowing, HealthReasonHighResendRate, HealthReasonCheckpointStale},
+		reasonCodes(health))
+	assert.Contains(health.Reasons[0].Message, fmt.Sprintf("%v errors", base.ReplicationHealthErrorThreshold))
+	assert.Contains(health.Reasons[0].Message, "recent error")
+
+	// fewer recent errors than the threshold, e.g., a single transient error, do not affect health
+	health = tracker.Evaluate(errs[base.ReplicationHealthErrorThreshold-1:], 10*time.Minute)
+	assert.NotContains(reasonCodes(health), HealthReasonRecentErrors)
+
+	// checkpoint is not stale with a longer checkpoint interval
+	health = tracker.Evaluate(nil, time.Hour)
+	assert.NotContains(reasonCodes(health), HealthReasonCheckpointStale)
+
+	fmt.Println("============== Test case end: TestReplicationHealthTrackerDegraded =================")
+}
+
+func TestReplicationHealthAddReason(t *testing.T) {
+	fmt.Println("============== Test case start: TestReplicationHealthAddReason =================")
+	assert := assert.New(t)
+
+	health := NewReplicationHealth()
+	health.AddReason(ReplicationStalled, HealthReasonThroughSeqnoNotAdvancing, "")
+	health.AddReason(ReplicationDegraded, HealthReasonRecentErrors, "")
+	// state is the most severe of all reasons
+	assert.Equal(ReplicationStalled, health.State)
+	assert.Equal(2, len(health.Reasons))
+
+	fmt.Println("============== Test case end: TestReplicationHealthAddReason =================")
+}
@@ -29,6 +29,10 @@ const (
 	Pending     ReplicationState = iota
 	Replicating ReplicationState = iota
 	Paused      ReplicationState = iota
+	// bounded replication has copied all the data in its range
+	Completed ReplicationState = iota
+	// replication is outside of the time windows in its schedule
+	PausedBySchedule ReplicationState = iota
 )
 
 var OVERVIEW_METRICS_KEY = "Overview"
@@ -43,6 +47,10 @@ func (rep_state ReplicationState) String() string {
 		return base.Replicating
 	} else if rep_state == Paused {
 		return base.Paused
+	} else if rep_state == Completed {
+		return base.Completed
+	} else if rep_state == PausedBySchedule {
+		return base.PausedBySchedule
 	} else {
 		panic("Invalid rep_state")
 	}
@@ -102,6 +110,8 @@ type ReplicationStatusIface interface {
 	SetCustomSettings(customSettings map[string]interface{})
 	ClearCustomSetting(settingsKey string)
 	ClearTemporaryCustomSettings()
+	SetHealth(health *ReplicationHealth)
+	Health() *ReplicationHealth
 }
 
 type ReplicationStatus struct {
@@ -121,6 +131,8 @@ type ReplicationStatus struct {
 	// useful when replication is paused, when it can be compared with the current vb_list to determine
 	// whether topology change has occured on source
 	vb_list []uint16
+	// health of the running pipeline, as last evaluated by pipeline supervisor
+	health *ReplicationHealth
 }
 
 func NewReplicationStatus(specId string, spec_getter ReplicationSpecGetter, logger *log.CommonLogger) *ReplicationStatus {
@@ -142,6 +154,8 @@ func (rs *ReplicationStatus) SetPipeline(pipeline common.Pipeline) {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
 	rs.pipeline_ = pipeline
+	// health of the old pipeline does not apply to the new one
+	rs.health = nil
 	if pipeline != nil {
 		rs.vb_list = pipeline_utils.GetSourceVBListPerPipeline(pipeline)
 		base.SortUint16List(rs.vb_list)
@@ -267,8 +281,12 @@ func (rs *ReplicationStatus) RuntimeStatus(lock bool) ReplicationState {
 	spec := rs.Spec()
 	if rs.pipeline_ != nil && rs.pipeline_.State() == common.Pipeline_Running {
 		return Replicating
+	} else if spec != nil && spec.Settings.IsBoundedCompleted() {
+		return Completed
 	} else if spec != nil && !spec.Settings.Active {
 		return Paused
+	} else if spec != nil && !spec.Settings.InScheduleWindow(time.Now()) {
+		return PausedBySchedule
 	} else {
 		return Pending
 	}
@@ -380,6 +398,50 @@ func (rs *ReplicationStatus) PublishWithStatus(status string, lock bool) {
 
 }
 
+func (rs *ReplicationStatus) SetHealth(health *ReplicationHealth) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.health = health
+}
+
+// returns the health of replication
+// health of running pipeline is as last evaluated by pipeline supervisor, and is healthy when it has not been evaluated yet
+// replication that is not running is considered failed when it has errors
+func (rs *ReplicationStatus) Health() *ReplicationHealth {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+
+	switch rs.RuntimeStatus(false) {
+	case Replicating:
+		if rs.health != nil {
+			return rs.health
+		}
+		return NewReplicationHealth()
+	case Paused:
+		health := NewReplicationHealth()
+		health.AddReason(ReplicationHealthy, HealthReasonPaused, "replication is paused")
+		return health
+	case Completed:
+		health := NewReplicationHealth()
+		health.AddReason(ReplicationHealthy, HealthReasonCompleted, "bounded replication has completed")
+		return health
+	case PausedBySchedule:
+		health := NewReplicationHealth()
+		health.AddReason(ReplicationHealthy, HealthReasonPausedBySchedule, "replication is outside of the time windows in its schedule")
+		return health
+	default:
+		health := NewReplicationHealth()
+		if len(rs.err_list) > 0 {
+			health.AddReason(ReplicationFailed, HealthReasonNotRunning,
+				fmt.Sprintf("pipeline is not running. last error: %v", rs.err_list[0].ErrMsg))
+		} else {
+			// pipeline may be starting
+			health.AddReason(ReplicationDegraded, HealthReasonNotRunning, "pipeline is not running")
+		}
+		return health
+	}
+}
+
 func (rs *ReplicationStatus) Pipeline() common.Pipeline {
 	rs.lock.RLock()
 	defer rs.lock.RUnlock()
@@ -10,6 +10,7 @@ import (
 	"github.com/couchbase/goxdcr/metadata"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func setupBoilerPlate() (*log.CommonLogger,
@@ -74,3 +75,63 @@ func TestReplicationStatusErrorMapFull(t *testing.T) {
 
 	fmt.Println("============== Test case end: TestReplicationStatusErrorMapFull =================")
 }
+
+func TestReplicationStatusHealth(t *testing.T) {
+	fmt.Println("============== Test case start: TestReplicationStatusHealth =================")
+	assert := assert.New(t)
+	_, _, testSpec, _, repStatus := setupBoilerPlate()
+
+	// pipeline is not running
+	health := repStatus.Health()
+	assert.Equal(ReplicationDegraded, health.State)
+	assert.Equal(HealthReasonNotRunning, health.Reasons[0].Code)
+
+	repStatus.AddError(errors.New("TestError"))
+	health = repStatus.Health()
+	assert.Equal(ReplicationFailed, health.State)
+	assert.Contains(health.Reasons[0].Message, "TestError")
+
+	// health evaluated by pipeline supervisor applies to running pipeline only
+	evaluatedHealth := NewReplicationHealth()
+	evaluatedHealth.AddReason(ReplicationStalled, HealthReasonThroughSeqnoNotAdvancing, "")
+	repStatus.SetHealth(evaluatedHealth)
+	assert.Equal(ReplicationFailed, repStatus.Health().State)
+
+	testSpec.Settings.Active = false
+	health = repStatus.Health()
+	assert.Equal(ReplicationHealthy, health.State)
+	assert.Equal(HealthReasonPaused, health.Reasons[0].Code)
+
+	testSpec.Settings.Values[metadata.BoundedSeqnoRangeKey] = "*:0-100"
+	testSpec.Settings.Values[metadata.BoundedCompletedKey] = true
+	assert.Equal(Completed, repStatus.RuntimeStatus(true))
+	health = repStatus.Health()
+	assert.Equal(ReplicationHealthy, health.State)
+	assert.Equal(HealthReasonCompleted, health.Reasons[0].Code)
+
+	fmt.Println("============== Test case end: TestReplicationStatusHealth =================")
+}
+
+func TestReplicationStatusPausedBySchedule(t *testing.T) {
+	fmt.Println("============== Test case start: TestReplicationStatusPausedBySchedule =================")
+	assert := assert.New(t)
+	_, _, testSpec, _, repStatus := setupBoilerPlate()
+
+	assert.Equal(Pending, repStatus.RuntimeStatus(true))
+
+	// a window on a day other than today, which the current time cannot fall into
+	day := []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}[(time.Now().UTC().Weekday()+3)%7]
+	_, errMap := testSpec.Settings.UpdateSettingsFromMap(map[string]interface{}{metadata.ScheduleKey: day + " 00:00-01:00"})
+	assert.Equal(0, len(errMap))
+	assert.Equal(PausedBySchedule, repStatus.RuntimeStatus(true))
+	assert.Equal(base.PausedBySchedule, repStatus.RuntimeStatus(true).String())
+	health := repStatus.Health()
+	assert.Equal(ReplicationHealthy, health.State)
+	assert.Equal(HealthReasonPausedBySchedule, health.Reasons[0].Code)
+
+	// explicit pause takes precedence over schedule
+	testSpec.Settings.Active = false
+	assert.Equal(Paused, repStatus.RuntimeStatus(true))
+
+	fmt.Println("============== Test case end: TestReplicationStatusPausedBySchedule =================")
+}
@@ -119,6 +119,22 @@ func (_m *ReplicationStatusIface) GetStats(registryName string) *expvar.Map {
 	return r0
 }
 
+// Health provides a mock function with given fields:
+func (_m *ReplicationStatusIface) Health() *pipeline.ReplicationHealth {
+	ret := _m.Called()
+
+	var r0 *pipeline.ReplicationHealth
+	if rf, ok := ret.Get(0).(func() *pipeline.ReplicationHealth); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*pipeline.ReplicationHealth)
+		}
+	}
+
+	return r0
+}
+
 // ObjectPool provides a mock function with given fields:
 func (_m *ReplicationStatusIface) ObjectPool() *base.MCRequestPool {
 	ret := _m.Called()
@@ -204,6 +220,11 @@ func (_m *ReplicationStatusIface) SetCustomSettings(customSettings map[string]in
 	_m.Called(customSettings)
 }
 
+// SetHealth provides a mock function with given fields: health
+func (_m *ReplicationStatusIface) SetHealth(health *pipeline.ReplicationHealth) {
+	_m.Called(health)
+}
+
 // SetOverviewStats provides a mock function with given fields: stats
 func (_m *ReplicationStatusIface) SetOverviewStats(stats *expvar.Map) {
 	_m.Called(stats)
@@ -73,6 +73,20 @@ func (_m *PipelineOpSerializerIface) ReInit(topic string) error {
 	return r0
 }
 
+// ReInitVBs provides a mock function with given fields: topic, vbSeqnos
+func (_m *PipelineOpSerializerIface) ReInitVBs(topic string, vbSeqnos map[uint16]uint64) error {
+	ret := _m.Called(topic, vbSeqnos)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, map[uint16]uint64) error); ok {
+		r0 = rf(topic, vbSeqnos)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Stop provides a mock function with given fields:
 func (_m *PipelineOpSerializerIface) Stop() {
 	_m.Called()
@@ -155,6 +155,22 @@ func (_m *Pipeline_mgr_iface) GetLogSvc() service_def.UILogSvc {
 	return r0
 }
 
+// GetNotificationSvc provides a mock function with given fields:
+func (_m *Pipeline_mgr_iface) GetNotificationSvc() service_def.NotificationSvc {
+	ret := _m.Called()
+
+	var r0 service_def.NotificationSvc
+	if rf, ok := ret.Get(0).(func() service_def.NotificationSvc); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(service_def.NotificationSvc)
+		}
+	}
+
+	return r0
+}
+
 // GetOrCreateReplicationStatus provides a mock function with given fields: topic, cur_err
 func (_m *Pipeline_mgr_iface) GetOrCreateReplicationStatus(topic string, cur_err error) (*pipeline.ReplicationStatus, error) {
 	ret := _m.Called(topic, cur_err)
@@ -268,6 +284,20 @@ func (_m *Pipeline_mgr_iface) ReInitStreams(pipelineName string) error {
 	return r0
 }
 
+// ReInitStreamsForVBs provides a mock function with given fields: pipelineName, vbSeqnos
+func (_m *Pipeline_mgr_iface) ReInitStreamsForVBs(pipelineName string, vbSeqnos map[uint16]uint64) error {
+	ret := _m.Called(pipelineName, vbSeqnos)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, map[uint16]uint64) error); ok {
+		r0 = rf(pipelineName, vbSeqnos)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // RemoveReplicationCheckpoints provides a mock function with given fields: topic
 func (_m *Pipeline_mgr_iface) RemoveReplicationCheckpoints(topic string) error {
 	ret := _m.Called(topic)
@@ -335,6 +365,20 @@ func (_m *Pipeline_mgr_iface) ReplicationStatusMap() map[string]*pipeline.Replic
 	return r0
 }
 
+// RewindPipelineCheckpoints provides a mock function with given fields: topic, vbSeqnos
+func (_m *Pipeline_mgr_iface) RewindPipelineCheckpoints(topic string, vbSeqnos map[uint16]uint64) error {
+	ret := _m.Called(topic, vbSeqnos)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, map[uint16]uint64) error); ok {
+		r0 = rf(topic, vbSeqnos)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // StartPipeline provides a mock function with given fields: topic
 func (_m *Pipeline_mgr_iface) StartPipeline(topic string) base.ErrorMap {
 	ret := _m.Called(topic)
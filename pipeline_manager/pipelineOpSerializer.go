@@ -20,6 +20,7 @@ const (
 	PipelineUpdate       PipelineMgtOpType = iota
 	PipelineDeletion     PipelineMgtOpType = iota
 	PipelineReinitStream PipelineMgtOpType = iota
+	PipelineRewindVBs    PipelineMgtOpType = iota
 )
 
 type PipelineOpSerializerIface interface {
@@ -28,6 +29,7 @@ type PipelineOpSerializerIface interface {
 	Update(topic string, err error) error
 	Init(topic string) error
 	ReInit(topic string) error
+	ReInitVBs(topic string, vbSeqnos map[uint16]uint64) error
 
 	// Synchronous User APIs - call and get data from a channel
 	GetOrCreateReplicationStatus(topic string, cur_err error) (*pipeline.ReplicationStatus, error)
@@ -49,6 +51,8 @@ type Job struct {
 
 	// Aux inputs for jobs
 	errForUpdateOp error
+	// seqnos to rewind checkpoints of vbuckets to
+	vbSeqnos map[uint16]uint64
 
 	// Optional outputs from jobs
 	repStatusCh chan SerializerRepStatusPair
@@ -133,6 +137,20 @@ func (serializer *PipelineOpSerializer) ReInit(topic string) error {
 	return serializer.distributeJob(resetJob)
 }
 
+// re-initializes streams of the specified vbuckets only, by rewinding their checkpoints to the specified seqnos
+func (serializer *PipelineOpSerializer) ReInitVBs(topic string, vbSeqnos map[uint16]uint64) error {
+	if serializer.isStopped() {
+		return SerializerStoppedErr
+	}
+
+	var rewindJob Job
+	rewindJob.jobType = PipelineRewindVBs
+	rewindJob.pipelineTopic = topic
+	rewindJob.vbSeqnos = vbSeqnos
+
+	return serializer.distributeJob(rewindJob)
+}
+
 // Synchronous call
 func (serializer *PipelineOpSerializer) GetOrCreateReplicationStatus(topic string, err error) (*pipeline.ReplicationStatus, error) {
 	if serializer.isStopped() {
@@ -267,6 +285,19 @@ forloop:
 					continue forloop
 				}
 
+				err = serializer.pipelineMgr.Update(job.pipelineTopic, job.errForUpdateOp)
+				if err != nil {
+					serializer.logger.Warnf("Error updating pipeline %v. err=%v", job.pipelineTopic, err)
+				}
+			case PipelineRewindVBs:
+				err := serializer.pipelineMgr.RewindPipelineCheckpoints(job.pipelineTopic, job.vbSeqnos)
+				if err != nil {
+					errMsg := fmt.Sprintf("Error during rewinding checkpoints of XDCR replication %v for vbuckets %v, err=%v", job.pipelineTopic, job.vbSeqnos, err)
+					serializer.logger.Errorf(errMsg)
+					serializer.pipelineMgr.GetLogSvc().Write(errMsg)
+					continue forloop
+				}
+
 				err = serializer.pipelineMgr.Update(job.pipelineTopic, job.errForUpdateOp)
 				if err != nil {
 					serializer.logger.Warnf("Error updating pipeline %v. err=%v", job.pipelineTopic, err)
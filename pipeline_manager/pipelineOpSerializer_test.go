@@ -145,3 +145,17 @@ func TestPipelineOpSerializerReinit(t *testing.T) {
 	assert.Equal(0, len(serializer.jobTopicMap))
 	fmt.Println("============== Test case end: TestPipelineOpSerializerReinit =================")
 }
+
+func TestPipelineOpSerializerReinitVBs(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestPipelineOpSerializerReinitVBs =================")
+	serializer, pipelineMgr := setupBoilerPlateSerializer()
+	vbSeqnos := map[uint16]uint64{0: 0, 5: 100}
+	pipelineMgr.On("RewindPipelineCheckpoints", "TestTopic", vbSeqnos).Return(nil).Times(1)
+	pipelineMgr.On("Update", mock.Anything, mock.Anything).Return(nil).Times(1)
+
+	assert.Nil(serializer.ReInitVBs("TestTopic", vbSeqnos))
+	time.Sleep(serializerSleepTime)
+	assert.Equal(0, len(serializer.jobTopicMap))
+	fmt.Println("============== Test case end: TestPipelineOpSerializerReinitVBs =================")
+}
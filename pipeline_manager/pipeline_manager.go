@@ -27,6 +27,8 @@ import (
 )
 
 var ReplicationSpecNotActive error = errors.New("Replication specification not found or no longer active")
+var ReplicationOutsideScheduleWindow error = errors.New("Replication is outside of the time windows in its schedule")
+var ReplicationBoundedCompleted error = errors.New("Bounded replication has copied all the data in its range")
 var ReplicationStatusNotFound error = errors.New("Replication Status not found")
 var UpdaterStoppedError error = errors.New("Updater already stopped")
 
@@ -45,6 +47,7 @@ type PipelineManager struct {
 	cluster_info_svc   service_def.ClusterInfoSvc
 	checkpoint_svc     service_def.CheckpointsService
 	uilog_svc          service_def.UILogSvc
+	notification_svc   service_def.NotificationSvc
 	once               sync.Once
 	logger             *log.CommonLogger
 	serializer         *PipelineOpSerializer
@@ -55,6 +58,7 @@ type Pipeline_mgr_iface interface {
 	// External APIs
 	InitiateRepStatus(pipelineName string) error
 	ReInitStreams(pipelineName string) error
+	ReInitStreamsForVBs(pipelineName string, vbSeqnos map[uint16]uint64) error
 	UpdatePipeline(pipelineName string, cur_err error) error
 	DeletePipeline(pipelineName string) error
 	CheckPipelines()
@@ -71,6 +75,7 @@ type Pipeline_mgr_iface interface {
 	AllReplications() []string
 	AllReplicationsForTargetCluster(targetClusterUuid string) []string
 	CleanupPipeline(topic string) error
+	RewindPipelineCheckpoints(topic string, vbSeqnos map[uint16]uint64) error
 	RemoveReplicationStatus(topic string) error
 	RemoveReplicationCheckpoints(topic string) error
 	AllReplicationSpecsForTargetCluster(targetClusterUuid string) map[string]*metadata.ReplicationSpecification
@@ -79,6 +84,7 @@ type Pipeline_mgr_iface interface {
 	GetRemoteClusterSvc() service_def.RemoteClusterSvc
 	GetClusterInfoSvc() service_def.ClusterInfoSvc
 	GetLogSvc() service_def.UILogSvc
+	GetNotificationSvc() service_def.NotificationSvc
 	GetReplSpecSvc() service_def.ReplicationSpecSvc
 	GetXDCRTopologySvc() service_def.XDCRCompTopologySvc
 }
@@ -88,7 +94,8 @@ var pipeline_mgr *PipelineManager
 
 func NewPipelineManager(factory common.PipelineFactory, repl_spec_svc service_def.ReplicationSpecSvc, xdcr_topology_svc service_def.XDCRCompTopologySvc,
 	remote_cluster_svc service_def.RemoteClusterSvc, cluster_info_svc service_def.ClusterInfoSvc, checkpoint_svc service_def.CheckpointsService,
-	uilog_svc service_def.UILogSvc, logger_context *log.LoggerContext, utilsIn utilities.UtilsIface) *PipelineManager {
+	uilog_svc service_def.UILogSvc, notification_svc service_def.NotificationSvc, logger_context *log.LoggerContext,
+	utilsIn utilities.UtilsIface) *PipelineManager {
 
 	pipelineMgrRetVar := &PipelineManager{
 		pipeline_factory:   factory,
@@ -99,6 +106,7 @@ func NewPipelineManager(factory common.PipelineFactory, repl_spec_svc service_de
 		logger:             log.NewLogger("PipelineMgr", logger_context),
 		cluster_info_svc:   cluster_info_svc,
 		uilog_svc:          uilog_svc,
+		notification_svc:   notification_svc,
 		utils:              utilsIn,
 	}
 	pipelineMgrRetVar.logger.Info("Pipeline Manager is constucted")
@@ -372,6 +380,11 @@ func (pipelineMgr *PipelineManager) validatePipeline(topic string) error {
 		return err
 	}
 
+	if spec.Settings.IsSink() {
+		// replications to sinks do not have remote cluster references
+		return nil
+	}
+
 	// refresh remote cluster reference when retrieving it, hence making sure that all fields,
 	// especially the security settings like sanInCertificate, are up to date
 	targetClusterRef, err := pipelineMgr.remote_cluster_svc.RemoteClusterByUuid(spec.TargetClusterUUID, true)
@@ -477,9 +490,36 @@ func (pipelineMgr *PipelineManager) StopPipeline(rep_status pipeline.Replication
 // Add retry mechanism here because failure will not be ideal
 // Should be called only from serializer
 func (pipelineMgr *PipelineManager) CleanupPipeline(topic string) error {
-	var rep_status *pipeline.ReplicationStatus
 	var err error
 	defer pipelineMgr.logger.Infof("%v CleanupPipeline including checkpoints removal finished (err = %v)", topic, err)
+	err = pipelineMgr.resetCheckpointsWithPipelineStopped(topic, "DelCheckpointsDocs", func(replId string) error {
+		return pipelineMgr.checkpoint_svc.DelCheckpointsDocs(replId)
+	})
+	return err
+}
+
+// Stops pipeline and rewinds checkpoints of the vbuckets in vbSeqnos, results in a restream of these vbuckets
+// Should be called only from serializer
+func (pipelineMgr *PipelineManager) RewindPipelineCheckpoints(topic string, vbSeqnos map[uint16]uint64) error {
+	err := pipelineMgr.resetCheckpointsWithPipelineStopped(topic, "RewindCheckpointsDoc", func(replId string) error {
+		for vbno, seqno := range vbSeqnos {
+			resumeSeqno, err := pipelineMgr.checkpoint_svc.RewindCheckpointsDoc(replId, vbno, seqno)
+			if err != nil {
+				return err
+			}
+			pipelineMgr.logger.Infof("%v vb=%v will resume from seqno %v after rewinding to seqno %v", topic, vbno, resumeSeqno, seqno)
+		}
+		return nil
+	})
+	pipelineMgr.logger.Infof("%v RewindPipelineCheckpoints for %v vbuckets finished (err = %v)", topic, len(vbSeqnos), err)
+	return err
+}
+
+// Stops the updater of pipeline, so that checkpoints are not being written while resetOp modifies them,
+// and restarts the updater afterwards
+func (pipelineMgr *PipelineManager) resetCheckpointsWithPipelineStopped(topic string, opName string, resetOp func(replId string) error) error {
+	var rep_status *pipeline.ReplicationStatus
+	var err error
 	getOp := func() error {
 		rep_status, err = pipelineMgr.GetOrCreateReplicationStatus(topic, nil)
 		return err
@@ -493,15 +533,15 @@ func (pipelineMgr *PipelineManager) CleanupPipeline(topic string) error {
 	updater := rep_status.Updater().(*PipelineUpdater)
 	replId := rep_status.RepId()
 
-	// Stop the updater to stop the pipeline so it will not handle any more jobs before we remove the checkpoints
+	// Stop the updater to stop the pipeline so it will not handle any more jobs before we modify the checkpoints
 	updater.stop()
 
 	retryOp := func() error {
-		return pipelineMgr.checkpoint_svc.DelCheckpointsDocs(replId)
+		return resetOp(replId)
 	}
-	err = pipelineMgr.utils.ExponentialBackoffExecutor(fmt.Sprintf("DelCheckpointsDocs %v", topic), base.PipelineSerializerRetryWaitTime, base.PipelineSerializerMaxRetry, base.PipelineSerializerRetryFactor, retryOp)
+	err = pipelineMgr.utils.ExponentialBackoffExecutor(fmt.Sprintf("%v %v", opName, topic), base.PipelineSerializerRetryWaitTime, base.PipelineSerializerMaxRetry, base.PipelineSerializerRetryFactor, retryOp)
 	if err != nil {
-		pipelineMgr.logger.Warnf("Removing checkpoint resulting in error: %v\n")
+		pipelineMgr.logger.Warnf("%v resulting in error: %v\n", opName, err)
 	}
 
 	// regardless of err above, we should restart updater
@@ -619,6 +659,9 @@ func (pipelineMgr *PipelineManager) Update(topic string, cur_err error) error {
 		// trigger updater to update immediately, not to wait for the retry interval
 		if cur_err != nil {
 			rep_status.AddError(cur_err)
+			if pipelineMgr.notification_svc != nil {
+				pipelineMgr.notification_svc.Notify(metadata.NewReplicationWebhookEvent(metadata.WebhookEventPipelineError, topic, cur_err.Error()))
+			}
 			updater.refreshPipelineDueToErr(cur_err)
 		} else {
 			updater.refreshPipelineManually()
@@ -642,6 +685,12 @@ func (pipelineMgr *PipelineManager) ReInitStreams(pipelineName string) error {
 	return pipelineMgr.serializer.ReInit(pipelineName)
 }
 
+// Same as ReInitStreams, except that only the streams of the vbuckets in vbSeqnos are re-initialized.
+// Checkpoints of each vbucket are rewound to the corresponding seqno, and are removed when the seqno is 0
+func (pipelineMgr *PipelineManager) ReInitStreamsForVBs(pipelineName string, vbSeqnos map[uint16]uint64) error {
+	return pipelineMgr.serializer.ReInitVBs(pipelineName, vbSeqnos)
+}
+
 // Bunch of getters
 func (pipelineMgr *PipelineManager) GetRemoteClusterSvc() service_def.RemoteClusterSvc {
 	return pipelineMgr.remote_cluster_svc
@@ -655,6 +704,10 @@ func (pipelineMgr *PipelineManager) GetLogSvc() service_def.UILogSvc {
 	return pipelineMgr.uilog_svc
 }
 
+func (pipelineMgr *PipelineManager) GetNotificationSvc() service_def.NotificationSvc {
+	return pipelineMgr.notification_svc
+}
+
 func (pipelineMgr *PipelineManager) GetReplSpecSvc() service_def.ReplicationSpecSvc {
 	return pipelineMgr.repl_spec_svc
 }
@@ -933,6 +986,8 @@ func allErrorsAreAllowed(errMap base.ErrorMap) bool {
 func allowableErrorCodes(err error) bool {
 	if err == nil ||
 		err == ReplicationSpecNotActive ||
+		err == ReplicationOutsideScheduleWindow ||
+		err == ReplicationBoundedCompleted ||
 		err == service_def.MetadataNotFoundErr {
 		return true
 	}
@@ -997,7 +1052,9 @@ func (r *PipelineUpdater) update() base.ErrorMap {
 
 	r.pickupOverflowErrors()
 
-	if r.currentErrors.IsEmpty() {
+	// restart is notified only when it is caused by errors
+	restartDueToErrors := !r.currentErrors.IsEmpty()
+	if !restartDueToErrors {
 		r.logger.Infof("Try to start/restart Pipeline %v. \n", r.pipeline_name)
 	} else {
 		r.logger.Infof("Try to fix Pipeline %v. Current error(s)=%v \n", r.pipeline_name, r.currentErrors.String())
@@ -1042,6 +1099,10 @@ RE:
 		r.logger.Infof("Replication %v has been updated. Back to business\n", r.pipeline_name)
 	} else if base.CheckErrorMapForError(errMap, ReplicationSpecNotActive, true /*exactMatch*/) {
 		r.logger.Infof("Replication %v has been paused. no need to update\n", r.pipeline_name)
+	} else if base.CheckErrorMapForError(errMap, ReplicationOutsideScheduleWindow, true /*exactMatch*/) {
+		r.logger.Infof("Replication %v is outside of its scheduled time windows. no need to update\n", r.pipeline_name)
+	} else if base.CheckErrorMapForError(errMap, ReplicationBoundedCompleted, true /*exactMatch*/) {
+		r.logger.Infof("Replication %v has completed its bounded range. no need to update\n", r.pipeline_name)
 	} else if base.CheckErrorMapForError(errMap, service_def.MetadataNotFoundErr, true /*exactMatch */) {
 		r.logger.Infof("Replication %v has been deleted. no need to update\n", r.pipeline_name)
 	} else {
@@ -1066,10 +1127,28 @@ RE:
 		r.logger.Errorf("Update of pipeline %v failed with errors=%v\n", r.pipeline_name, base.FlattenErrorMap(errMap))
 	}
 	r.reportStatus()
+	if restartDueToErrors {
+		r.notifyRestart(errMap)
+	}
 
 	return errMap
 }
 
+func (r *PipelineUpdater) notifyRestart(errMap base.ErrorMap) {
+	notification_svc := r.pipelineMgr.GetNotificationSvc()
+	if notification_svc == nil {
+		return
+	}
+
+	var message string
+	if len(errMap) == 0 {
+		message = "Pipeline has been restarted after errors"
+	} else {
+		message = fmt.Sprintf("Pipeline failed to restart after errors. err=%v", base.FlattenErrorMap(errMap))
+	}
+	notification_svc.Notify(metadata.NewReplicationWebhookEvent(metadata.WebhookEventPipelineRestart, r.pipeline_name, message))
+}
+
 // pick up overflow errors that were not captured by the channel
 func (r *PipelineUpdater) pickupOverflowErrors() {
 	r.overflowErrors.curErrMtx.Lock()
@@ -1093,7 +1172,7 @@ func (r *PipelineUpdater) raiseWarningsIfNeeded(p common.Pipeline) {
 }
 
 // raise warning on UI console when
-// 1. replication is not of capi type
+// 1. replication is not of capi type and is not to a sink
 // 2. replication is not recovering from error
 // 3. target cluster does not support xattr
 // 4. current node is the master for vbucket 0 - this is needed to ensure that warning is shown on UI only once, instead of once per source node
@@ -1107,7 +1186,7 @@ func (r *PipelineUpdater) raiseXattrWarningIfNeeded(p common.Pipeline) {
 		r.logger.Warnf("Skipping xattr warning check since cannot find replication spec for pipeline %v\n", r.pipeline_name)
 		return
 	}
-	if spec.Settings.IsCapi() {
+	if spec.Settings.IsCapi() || spec.Settings.IsSink() {
 		return
 	}
 	targetClusterRef, err := r.pipelineMgr.GetRemoteClusterSvc().RemoteClusterByUuid(spec.TargetClusterUUID, false)
@@ -1164,6 +1243,10 @@ func (r *PipelineUpdater) checkReplicationActiveness() (err error) {
 	spec, err := r.pipelineMgr.GetReplSpecSvc().ReplicationSpec(r.pipeline_name)
 	if err != nil || spec == nil || !spec.Settings.Active {
 		err = ReplicationSpecNotActive
+	} else if spec.Settings.IsBoundedCompleted() {
+		err = ReplicationBoundedCompleted
+	} else if !spec.Settings.InScheduleWindow(time.Now()) {
+		err = ReplicationOutsideScheduleWindow
 	}
 	return
 }
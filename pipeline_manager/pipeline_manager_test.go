@@ -73,7 +73,7 @@ func setupBoilerPlate() (*log.CommonLogger,
 
 	pipelineMgr := NewPipelineManager(pipelineMock, replSpecSvcMock, xdcrTopologyMock,
 		remoteClusterMock, nil /*cluster_info_svc*/, nil, /*checkpoint_svc*/
-		uiLogSvcMock, log.DefaultLoggerContext, utilsNew)
+		uiLogSvcMock, nil /*notification_svc*/, log.DefaultLoggerContext, utilsNew)
 
 	// Some things needed for pipelinemgr
 	testTopic := "testTopic"
@@ -479,6 +479,7 @@ func setupMockPipelineMgr(replSpecSvcMock *service_def.ReplicationSpecSvc,
 	pmMock.On("GetReplSpecSvc").Return(replSpecSvcMock)
 	pmMock.On("GetXDCRTopologySvc").Return(xdcrTopologyMock)
 	pmMock.On("GetLogSvc").Return(uiLogSvcMock)
+	pmMock.On("GetNotificationSvc").Return(nil)
 	testReplicationSettings.Active = true
 
 	testRepairer.pipelineMgr = pmMock
@@ -770,3 +771,23 @@ func TestCleanupPipeline(t *testing.T) {
 
 	fmt.Println("============== Test case end: TestCleanupPipeline =================")
 }
+
+func TestRewindPipelineCheckpoints(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestRewindPipelineCheckpoints =================")
+	testLogger, pipelineMock, replSpecSvcMock, xdcrTopologyMock, remoteClusterMock,
+		pipelineMgr, testRepairer, testReplicationStatus, testTopic,
+		testReplicationSettings, testReplicationSpec, testRemoteClusterRef, testPipeline, uiLogSvc, replStatusMock, ckptMock := setupBoilerPlate()
+
+	setupGenericMocking(testLogger, pipelineMock, replSpecSvcMock, xdcrTopologyMock, remoteClusterMock,
+		pipelineMgr, testRepairer, testReplicationStatus, testTopic,
+		testReplicationSettings, testReplicationSpec, testRemoteClusterRef, testPipeline, uiLogSvc, replStatusMock, ckptMock)
+	ckptMock.On("RewindCheckpointsDoc", mock.Anything, uint16(0), uint64(0)).Return(uint64(0), nil).Times(1)
+	ckptMock.On("RewindCheckpointsDoc", mock.Anything, uint16(5), uint64(100)).Return(uint64(90), nil).Times(1)
+
+	setupLaunchUpdater(testRepairer, true)
+
+	assert.Nil(pipelineMgr.RewindPipelineCheckpoints(testTopic, map[uint16]uint64{0: 0, 5: 100}))
+
+	fmt.Println("============== Test case end: TestRewindPipelineCheckpoints =================")
+}
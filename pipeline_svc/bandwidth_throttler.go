@@ -25,6 +25,8 @@ import (
 // factors affecting bandwidth limit of the current node, which could be updated through UpdateSettings() call
 var OVERALL_BANDWIDTH_LIMIT = "overall_bandwidth_limit"
 var NUMBER_OF_SOURCE_NODES = "number_of_source_nodes"
+var BANDWIDTH_PROFILE = "bandwidth_profile"
+var BANDWIDTH_PROFILE_TIMEZONE = "bandwidth_profile_timezone"
 var errorZeroSrcNode = errors.New("Error: Bandwidth Throttler's number of source nodes cannot be 0")
 
 //BandwidthThrottler limits bandwidth usage of replication
@@ -35,6 +37,13 @@ type BandwidthThrottler struct {
 
 	number_of_source_nodes  uint32
 	overall_bandwidth_limit int64
+	// overall bandwidth limit currently in effect, which is either overall_bandwidth_limit
+	// or the limit of the bandwidth profile entry that covers the current time
+	effective_overall_bandwidth_limit int64
+
+	// nil when replication does not have bandwidth profile
+	bandwidth_profile      *metadata.BandwidthProfile
+	bandwidth_profile_lock sync.RWMutex
 
 	// bandwidth limit for the current node in bytes per second
 	bandwidth_limit int64
@@ -69,9 +78,16 @@ func (throttler *BandwidthThrottler) Attach(pipeline common.Pipeline) error {
 	}
 
 	throttler.number_of_source_nodes = uint32(number_of_source_nodes)
-	throttler.overall_bandwidth_limit = int64(pipeline.Specification().Settings.BandwidthLimit)
+	settings := pipeline.Specification().Settings
+	throttler.overall_bandwidth_limit = int64(settings.BandwidthLimit)
 	throttler.logger.Infof("%v set overall bandwidth limit to %v and number of source nodes to %v\n", throttler.id, throttler.overall_bandwidth_limit, throttler.number_of_source_nodes)
 
+	err = throttler.setBandwidthProfile(settings.GetBandwidthProfile(), settings.GetScheduleTimezone())
+	if err != nil {
+		return err
+	}
+	throttler.effective_overall_bandwidth_limit = throttler.getEffectiveOverallBandwidthLimit(time.Now())
+
 	bandwidth_limit, err := throttler.setBandwidthLimit()
 	if err != nil {
 		return err
@@ -126,6 +142,7 @@ func (throttler *BandwidthThrottler) update() error {
 			throttler.logger.Infof("%v received finish signal and is exitting", throttler.id)
 			return nil
 		case <-ticker.C:
+			throttler.applyBandwidthProfile(time.Now())
 			throttler.updateOnce()
 		}
 	}
@@ -266,7 +283,16 @@ func (throttler *BandwidthThrottler) UpdateSettings(settings metadata.Replicatio
 		}
 	}
 
-	if overall_bandwidth_limit != nil || number_of_source_nodes != nil {
+	bandwidth_profile := settings[BANDWIDTH_PROFILE]
+	if bandwidth_profile != nil {
+		err := throttler.setBandwidthProfile(bandwidth_profile.(string), settings[BANDWIDTH_PROFILE_TIMEZONE].(string))
+		if err != nil {
+			return err
+		}
+	}
+
+	if overall_bandwidth_limit != nil || number_of_source_nodes != nil || bandwidth_profile != nil {
+		atomic.StoreInt64(&throttler.effective_overall_bandwidth_limit, throttler.getEffectiveOverallBandwidthLimit(time.Now()))
 		bandwidth_limit, err := throttler.setBandwidthLimit()
 		if err != nil {
 			throttler.logger.Errorf(err.Error())
@@ -284,7 +310,7 @@ func (throttler *BandwidthThrottler) setBandwidthLimit() (int64, error) {
 	if number_of_source_nodes == 0 {
 		return 0, errorZeroSrcNode
 	}
-	overall_bandwidth_limit := atomic.LoadInt64(&throttler.overall_bandwidth_limit)
+	overall_bandwidth_limit := atomic.LoadInt64(&throttler.effective_overall_bandwidth_limit)
 	bandwidth_limit := overall_bandwidth_limit * 1024 * 1024 / int64(number_of_source_nodes)
 	atomic.StoreInt64(&throttler.bandwidth_limit, bandwidth_limit)
 	throttler.logger.Infof("%v updated bandwidth limit to %v\n", throttler.id, bandwidth_limit)
@@ -292,6 +318,58 @@ func (throttler *BandwidthThrottler) setBandwidthLimit() (int64, error) {
 	return bandwidth_limit, nil
 }
 
+func (throttler *BandwidthThrottler) setBandwidthProfile(profile string, timezone string) error {
+	var bandwidth_profile *metadata.BandwidthProfile
+	if len(profile) > 0 {
+		var err error
+		bandwidth_profile, err = metadata.ParseBandwidthProfile(profile, timezone)
+		if err != nil {
+			throttler.logger.Errorf("%v failed to parse bandwidth profile %v. err=%v\n", throttler.id, profile, err)
+			return err
+		}
+	}
+
+	throttler.bandwidth_profile_lock.Lock()
+	throttler.bandwidth_profile = bandwidth_profile
+	throttler.bandwidth_profile_lock.Unlock()
+
+	throttler.logger.Infof("%v updated bandwidth profile to \"%v\" in timezone %v\n", throttler.id, profile, timezone)
+	return nil
+}
+
+func (throttler *BandwidthThrottler) getEffectiveOverallBandwidthLimit(now time.Time) int64 {
+	throttler.bandwidth_profile_lock.RLock()
+	defer throttler.bandwidth_profile_lock.RUnlock()
+	if throttler.bandwidth_profile != nil {
+		if limit, ok := throttler.bandwidth_profile.LimitAt(now); ok {
+			return int64(limit)
+		}
+	}
+	return atomic.LoadInt64(&throttler.overall_bandwidth_limit)
+}
+
+// switch to the limit of the bandwidth profile entry that covers the current time, if it is different from the current limit
+func (throttler *BandwidthThrottler) applyBandwidthProfile(now time.Time) {
+	effective_overall_bandwidth_limit := throttler.getEffectiveOverallBandwidthLimit(now)
+	if effective_overall_bandwidth_limit == atomic.LoadInt64(&throttler.effective_overall_bandwidth_limit) {
+		return
+	}
+
+	atomic.StoreInt64(&throttler.effective_overall_bandwidth_limit, effective_overall_bandwidth_limit)
+	throttler.logger.Infof("%v switched overall bandwidth limit to %v according to bandwidth profile\n", throttler.id, effective_overall_bandwidth_limit)
+	bandwidth_limit, err := throttler.setBandwidthLimit()
+	if err != nil {
+		throttler.logger.Errorf(err.Error())
+		return
+	}
+	throttler.adjustBandwidthUsageQuota(bandwidth_limit)
+}
+
+// returns the overall bandwidth limit currently in effect, in MB/sec
+func (throttler *BandwidthThrottler) EffectiveBandwidthLimit() int64 {
+	return atomic.LoadInt64(&throttler.effective_overall_bandwidth_limit)
+}
+
 // adjust quota when new limit is set
 func (throttler *BandwidthThrottler) adjustBandwidthUsageQuota(bandwidth_limit int64) {
 	for {
@@ -0,0 +1,155 @@
+// +build !pcre
+
+package pipeline_svc
+
+import (
+	"expvar"
+	"fmt"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/metadata"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const testBytesPerMB = 1024 * 1024
+
+func newTestBandwidthThrottler(overallLimit int64, numberOfSourceNodes uint32, profile string, now time.Time) (*BandwidthThrottler, error) {
+	throttler := NewBandwidthThrottlerSvc(nil, log.DefaultLoggerContext)
+	throttler.number_of_source_nodes = numberOfSourceNodes
+	throttler.overall_bandwidth_limit = overallLimit
+	err := throttler.setBandwidthProfile(profile, "UTC")
+	if err != nil {
+		return nil, err
+	}
+	throttler.effective_overall_bandwidth_limit = throttler.getEffectiveOverallBandwidthLimit(now)
+	bandwidth_limit, err := throttler.setBandwidthLimit()
+	if err != nil {
+		return nil, err
+	}
+	throttler.initBandwidthUsageQuota(bandwidth_limit)
+	return throttler, nil
+}
+
+func TestApplyBandwidthProfile(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestApplyBandwidthProfile =================")
+
+	// 2024-01-05 is a Friday
+	friday := func(hour, min int) time.Time {
+		return time.Date(2024, time.January, 5, hour, min, 0, 0, time.UTC)
+	}
+
+	throttler, err := newTestBandwidthThrottler(100, 2, "Mon-Fri 08:00-18:00=50;Sat,Sun 08:00-18:00=200;12:00-13:00=10", friday(7, 0))
+	assert.Nil(err)
+	assert.Equal(int64(100), throttler.EffectiveBandwidthLimit())
+
+	// profile is applied in order, each against the limit left by the previous one
+	testCases := []struct {
+		name          string
+		now           time.Time
+		expectedLimit int64
+	}{
+		{"before first window", friday(7, 59), 100},
+		{"start of weekday window", friday(8, 0), 50},
+		{"first matching entry wins over later entry", friday(12, 30), 50},
+		{"last minute of weekday window", friday(17, 59), 50},
+		{"end of weekday window falls back to static limit", friday(18, 0), 100},
+		{"no window overnight", friday(24+7, 0), 100},
+		{"start of weekend window", friday(24+8, 0), 200},
+		{"end of weekend window", friday(24+18, 0), 100},
+	}
+
+	for _, testCase := range testCases {
+		throttler.applyBandwidthProfile(testCase.now)
+		assert.Equal(testCase.expectedLimit, throttler.EffectiveBandwidthLimit(), testCase.name)
+		// per node limit is in bytes
+		assert.Equal(testCase.expectedLimit*testBytesPerMB/2, throttler.bandwidth_limit, testCase.name)
+		assert.True(throttler.bandwidth_usage_quota <= throttler.bandwidth_limit, testCase.name)
+	}
+
+	// quota accumulated under a higher limit is trimmed when switching to a lower limit
+	throttler.bandwidth_usage_quota = throttler.bandwidth_limit
+	throttler.applyBandwidthProfile(friday(8, 0))
+	assert.Equal(int64(50), throttler.EffectiveBandwidthLimit())
+	assert.Equal(throttler.bandwidth_limit, throttler.bandwidth_usage_quota)
+
+	fmt.Println("============== Test case end: TestApplyBandwidthProfile =================")
+}
+
+func TestBandwidthProfileStaticLimitFallback(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestBandwidthProfileStaticLimitFallback =================")
+
+	// 2024-01-01 is a Monday
+	inWindow := time.Date(2024, time.January, 1, 9, 0, 0, 0, time.UTC)
+	outOfWindow := time.Date(2024, time.January, 1, 19, 0, 0, 0, time.UTC)
+
+	// without profile, static limit applies at all times
+	throttler, err := newTestBandwidthThrottler(100, 1, "", inWindow)
+	assert.Nil(err)
+	throttler.applyBandwidthProfile(inWindow)
+	assert.Equal(int64(100), throttler.EffectiveBandwidthLimit())
+	throttler.applyBandwidthProfile(outOfWindow)
+	assert.Equal(int64(100), throttler.EffectiveBandwidthLimit())
+
+	// static limit of 0 disables throttling outside of profile windows
+	throttler, err = newTestBandwidthThrottler(0, 1, "08:00-18:00=50", inWindow)
+	assert.Nil(err)
+	assert.Equal(int64(50), throttler.EffectiveBandwidthLimit())
+	throttler.applyBandwidthProfile(outOfWindow)
+	assert.Equal(int64(0), throttler.EffectiveBandwidthLimit())
+	assert.Equal(int64(0), throttler.bandwidth_limit)
+	bytesCanSend, _ := throttler.Throttle(1000, 0, 1000)
+	assert.Equal(int64(1000), bytesCanSend)
+
+	// static limit updated out of window takes effect immediately, and is overridden by profile in window
+	err = throttler.UpdateSettings(metadata.ReplicationSettingsMap{OVERALL_BANDWIDTH_LIMIT: 30})
+	assert.Nil(err)
+	throttler.applyBandwidthProfile(outOfWindow)
+	assert.Equal(int64(30), throttler.EffectiveBandwidthLimit())
+	throttler.applyBandwidthProfile(inWindow)
+	assert.Equal(int64(50), throttler.EffectiveBandwidthLimit())
+
+	// removing profile falls back to static limit
+	err = throttler.UpdateSettings(metadata.ReplicationSettingsMap{BANDWIDTH_PROFILE: "", BANDWIDTH_PROFILE_TIMEZONE: "UTC"})
+	assert.Nil(err)
+	assert.Equal(int64(30), throttler.EffectiveBandwidthLimit())
+	throttler.applyBandwidthProfile(inWindow)
+	assert.Equal(int64(30), throttler.EffectiveBandwidthLimit())
+
+	// invalid profile is rejected and the current profile is kept
+	err = throttler.UpdateSettings(metadata.ReplicationSettingsMap{BANDWIDTH_PROFILE: "08:00-18:00", BANDWIDTH_PROFILE_TIMEZONE: "UTC"})
+	assert.NotNil(err)
+	assert.Equal(int64(30), throttler.EffectiveBandwidthLimit())
+
+	fmt.Println("============== Test case end: TestBandwidthProfileStaticLimitFallback =================")
+}
+
+func TestEffectiveBandwidthLimitStat(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestEffectiveBandwidthLimitStat =================")
+
+	// 2024-01-01 is a Monday
+	inWindow := time.Date(2024, time.January, 1, 9, 0, 0, 0, time.UTC)
+	outOfWindow := time.Date(2024, time.January, 1, 19, 0, 0, 0, time.UTC)
+
+	throttler, err := newTestBandwidthThrottler(100, 1, "08:00-18:00=50", inWindow)
+	assert.Nil(err)
+
+	overviewMap := new(expvar.Map).Init()
+	setEffectiveBandwidthLimitStat(overviewMap, throttler)
+	assert.Equal("50", overviewMap.Get(EFFECTIVE_BANDWIDTH_LIMIT_METRIC).String())
+
+	// stat follows profile switch
+	throttler.applyBandwidthProfile(outOfWindow)
+	setEffectiveBandwidthLimitStat(overviewMap, throttler)
+	assert.Equal("100", overviewMap.Get(EFFECTIVE_BANDWIDTH_LIMIT_METRIC).String())
+
+	// stat is not published without bandwidth throttler
+	overviewMap = new(expvar.Map).Init()
+	setEffectiveBandwidthLimitStat(overviewMap, nil)
+	assert.Nil(overviewMap.Get(EFFECTIVE_BANDWIDTH_LIMIT_METRIC))
+
+	fmt.Println("============== Test case end: TestEffectiveBandwidthLimitStat =================")
+}
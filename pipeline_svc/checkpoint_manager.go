@@ -18,6 +18,7 @@ import (
 	component "github.com/couchbase/goxdcr/component"
 	"github.com/couchbase/goxdcr/log"
 	"github.com/couchbase/goxdcr/metadata"
+	"github.com/couchbase/goxdcr/parts"
 	"github.com/couchbase/goxdcr/pipeline_utils"
 	"github.com/couchbase/goxdcr/service_def"
 	utilities "github.com/couchbase/goxdcr/utils"
@@ -40,6 +41,10 @@ var CHECKPOINT_INTERVAL = "checkpoint_interval"
 var ckptRecordMismatch error = errors.New("Checkpoint Records internal version mismatch")
 var targetVbuuidChangedError error = errors.New("target vbuuid has changed")
 
+// sinks do not have vbuuids. mutations written to sinks are durable and sinks do not roll back,
+// hence all checkpoint records of replications to sinks carry the same target vb opaque
+var sinkTargetVBOpaque metadata.TargetVBOpaque = &metadata.TargetVBUuid{0}
+
 type CheckpointManager struct {
 	*component.AbstractComponent
 
@@ -102,6 +107,9 @@ type CheckpointManager struct {
 	// whether target cluster is elasticsearch
 	isTargetES bool
 
+	// whether target is a sink instead of a couchbase bucket
+	isTargetSink bool
+
 	user_agent string
 
 	// these fields are used for xmem replication only
@@ -111,6 +119,12 @@ type CheckpointManager struct {
 
 	target_cluster_version int
 	utils                  utilities.UtilsIface
+
+	// these fields are used for bounded replication only
+	// key - vb#, value - the last seqno that needs to be replicated for the vb, as reported by dcp nozzle
+	// when the dcp stream of the vb reaches the end of the bounded range
+	bounded_ends      map[uint16]uint64
+	bounded_ends_lock sync.RWMutex
 }
 
 // Checkpoint Manager keeps track of one checkpointRecord per vbucket
@@ -175,6 +189,7 @@ func NewCheckpointManager(checkpoints_svc service_def.CheckpointsService, capi_s
 		target_cluster_version:    target_cluster_version,
 		isTargetES:                isTargetES,
 		utils:                     utilsIn,
+		bounded_ends:              make(map[uint16]uint64),
 	}, nil
 }
 
@@ -183,18 +198,21 @@ func (ckmgr *CheckpointManager) Attach(pipeline common.Pipeline) error {
 	ckmgr.logger.Infof("Attach checkpoint manager with pipeline %v\n", pipeline.Topic())
 
 	ckmgr.pipeline = pipeline
+	ckmgr.isTargetSink = pipeline.Specification().Settings.IsSink()
 
-	//populate the remote bucket information at the time of attaching
-	err := ckmgr.populateRemoteBucketInfo(pipeline)
-
-	if err != nil {
-		return err
+	if !ckmgr.isTargetSink {
+		//populate the remote bucket information at the time of attaching
+		err := ckmgr.populateRemoteBucketInfo(pipeline)
+		if err != nil {
+			return err
+		}
 	}
 
 	dcp_parts := pipeline.Sources()
 	for _, dcp := range dcp_parts {
 		dcp.RegisterComponentEventListener(common.StreamingStart, ckmgr)
 		dcp.RegisterComponentEventListener(common.SnapshotMarkerReceived, ckmgr)
+		dcp.RegisterComponentEventListener(common.StreamingEnd, ckmgr)
 	}
 
 	//register pipeline supervisor as ckmgr's error handler
@@ -202,7 +220,7 @@ func (ckmgr *CheckpointManager) Attach(pipeline common.Pipeline) error {
 	if supervisor == nil {
 		return errors.New("Pipeline supervisor has to exist")
 	}
-	err = ckmgr.RegisterComponentEventListener(common.ErrorEncountered, supervisor.(*PipelineSupervisor))
+	err := ckmgr.RegisterComponentEventListener(common.ErrorEncountered, supervisor.(*PipelineSupervisor))
 	if err != nil {
 		return err
 	}
@@ -242,7 +260,7 @@ func (ckmgr *CheckpointManager) Start(settings metadata.ReplicationSettingsMap)
 	ckmgr.startRandomizedCheckpointingTicker()
 
 	//initialize connections
-	if !ckmgr.isTargetES {
+	if !ckmgr.isTargetES && !ckmgr.isTargetSink {
 		err = ckmgr.initConnections()
 		if err != nil {
 			return err
@@ -252,6 +270,16 @@ func (ckmgr *CheckpointManager) Start(settings metadata.ReplicationSettingsMap)
 	//start checkpointing loop
 	ckmgr.wait_grp.Add(1)
 	go ckmgr.checkpointing()
+
+	//start checkpoint verification loop
+	ckmgr.wait_grp.Add(1)
+	go ckmgr.checkpointVerifying()
+
+	if ckmgr.pipeline.Specification().Settings.IsBounded() {
+		//start bounded replication completion checking loop
+		ckmgr.wait_grp.Add(1)
+		go ckmgr.boundedCompletionChecking()
+	}
 	return nil
 }
 
@@ -453,7 +481,7 @@ func (ckmgr *CheckpointManager) Stop() error {
 	close(ckmgr.finish_ch)
 
 	//close the connections
-	if !ckmgr.isTargetES {
+	if !ckmgr.isTargetES && !ckmgr.isTargetSink {
 		ckmgr.closeConnections()
 	}
 
@@ -749,6 +777,9 @@ func (ckmgr *CheckpointManager) getVBTimestampForVB(vbno uint16, ckptDoc *metada
 	var agreedIndex int = -1
 
 	ckptRecordsList := ckmgr.ckptRecordsWLock(ckptDoc, vbno)
+	if ckmgr.isTargetSink {
+		ckmgr.updateCurrentVBOpaque(vbno, sinkTargetVBOpaque)
+	}
 	/**
 	 * If we are fed a vbno and ckptDoc, then the above ckptRecordsWLock should feed us back a list
 	 * that are not shared by anyone else so the locking here in this manner should be no problem.
@@ -768,6 +799,14 @@ func (ckmgr *CheckpointManager) getVBTimestampForVB(vbno uint16, ckptDoc *metada
 		}
 		ckptRecord.lock.RUnlock()
 
+		if remote_vb_status != nil && ckmgr.isTargetSink {
+			// sinks keep whatever has been written to them, so the most recent eligible checkpoint can always be used
+			if ckptDoc != nil {
+				agreedIndex = index
+			}
+			goto POPULATE
+		}
+
 		if remote_vb_status != nil {
 			bMatch := false
 			bMatch, current_remoteVBOpaque, err := ckmgr.capi_svc.PreReplicate(ckmgr.remote_bucket, remote_vb_status, ckmgr.support_ckpt)
@@ -863,6 +902,7 @@ func (ckmgr *CheckpointManager) retrieveCkptDoc(vbno uint16) (*metadata.Checkpoi
 
 func (ckmgr *CheckpointManager) populateVBTimestamp(ckptDoc *metadata.CheckpointsDoc, agreedIndex int, vbno uint16) (*base.VBTimestamp, error) {
 	vbts := &base.VBTimestamp{Vbno: vbno}
+	var boundedEndSeqno uint64
 	if agreedIndex > -1 {
 		ckpt_records := ckptDoc.GetCheckpointRecords()
 		if len(ckpt_records) < agreedIndex+1 {
@@ -874,6 +914,7 @@ func (ckmgr *CheckpointManager) populateVBTimestamp(ckptDoc *metadata.Checkpoint
 			vbts.Seqno = ckpt_record.Seqno
 			vbts.SnapshotStart = ckpt_record.Dcp_snapshot_seqno
 			vbts.SnapshotEnd = ckpt_record.Dcp_snapshot_end_seqno
+			boundedEndSeqno = ckpt_record.Bounded_end_seqno
 
 			//For all stream requests the snapshot start seqno must be less than or equal
 			//to the start seqno and the start seqno must be less than or equal to the snapshot end seqno.
@@ -898,6 +939,7 @@ func (ckmgr *CheckpointManager) populateVBTimestamp(ckptDoc *metadata.Checkpoint
 			obj.ckpt.Dcp_snapshot_seqno = vbts.SnapshotStart
 			obj.ckpt.Dcp_snapshot_end_seqno = vbts.SnapshotEnd
 			obj.ckpt.Seqno = vbts.Seqno
+			obj.ckpt.Bounded_end_seqno = boundedEndSeqno
 		}
 	} else {
 		err := fmt.Errorf("%v Calling populateVBTimestamp on vb=%v which is not in MyVBList", ckmgr.pipeline.Topic(), vbno)
@@ -963,6 +1005,184 @@ done:
 	ticker.Stop()
 }
 
+// periodically verifies the checkpoint records of the vbuckets that checkpoint manager manages, and removes records
+// that can no longer be used to resume replication, so that they do not cause unexpected restreams later
+func (ckmgr *CheckpointManager) checkpointVerifying() {
+	ckmgr.logger.Infof("%v checkpoint verification routine started", ckmgr.pipeline.Topic())
+
+	defer ckmgr.logger.Infof("%v Exits checkpoint verification routine.", ckmgr.pipeline.Topic())
+	defer ckmgr.wait_grp.Done()
+
+	ticker := time.NewTicker(base.CheckpointVerificationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ckmgr.finish_ch:
+			return
+		case <-ticker.C:
+			if !pipeline_utils.IsPipelineRunning(ckmgr.pipeline.State()) {
+				//pipeline is no longer running, kill itself
+				ckmgr.logger.Infof("%v Pipeline is no longer running, exit.", ckmgr.pipeline.Topic())
+				return
+			}
+			ckmgr.verifyCheckpoints(ckmgr.finish_ch)
+		}
+	}
+}
+
+func (ckmgr *CheckpointManager) verifyCheckpoints(fin_ch chan bool) {
+	topic := ckmgr.pipeline.Topic()
+	total_removed := 0
+	for _, vbno := range ckmgr.getMyVBs() {
+		select {
+		case <-fin_ch:
+			return
+		default:
+		}
+
+		failoverLog := ckmgr.getFailoverLog(vbno)
+		if failoverLog == nil {
+			// stream for vb has not started yet
+			continue
+		}
+
+		var targetVBOpaque metadata.TargetVBOpaque
+		if obj, ok := ckmgr.cur_ckpts[vbno]; ok {
+			obj.lock.RLock()
+			targetVBOpaque = obj.ckpt.Target_vb_opaque
+			obj.lock.RUnlock()
+		}
+
+		removed, err := ckmgr.checkpoints_svc.VerifyCheckpointsDoc(topic, vbno, failoverLog, targetVBOpaque)
+		if err != nil {
+			ckmgr.logger.Warnf("%v Failed to verify checkpoints for vb=%v. err=%v", topic, vbno, err)
+			continue
+		}
+		total_removed += removed
+	}
+
+	if total_removed > 0 {
+		ckmgr.logger.Infof("%v Removed %v checkpoint records that can no longer be used", topic, total_removed)
+		ckmgr.RaiseEvent(common.NewEvent(common.InvalidCheckpointsRemoved, nil, ckmgr, nil, total_removed))
+	}
+}
+
+func (ckmgr *CheckpointManager) boundedCompletionChecking() {
+	ckmgr.logger.Infof("%v bounded replication completion checking routine started", ckmgr.pipeline.Topic())
+
+	defer ckmgr.logger.Infof("%v Exits bounded replication completion checking routine.", ckmgr.pipeline.Topic())
+	defer ckmgr.wait_grp.Done()
+
+	ticker := time.NewTicker(base.BoundedReplicationCompletionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ckmgr.finish_ch:
+			return
+		case <-ticker.C:
+			if !pipeline_utils.IsPipelineRunning(ckmgr.pipeline.State()) {
+				//pipeline is no longer running, kill itself
+				ckmgr.logger.Infof("%v Pipeline is no longer running, exit.", ckmgr.pipeline.Topic())
+				return
+			}
+			completed, err := ckmgr.checkBoundedCompletion()
+			if err != nil {
+				ckmgr.logger.Warnf("%v Failed to check completion of bounded replication. err=%v", ckmgr.pipeline.Topic(), err)
+				continue
+			}
+			if completed {
+				err = ckmgr.markBoundedCompleted()
+				if err != nil {
+					ckmgr.logger.Warnf("%v Failed to mark bounded replication as completed. err=%v", ckmgr.pipeline.Topic(), err)
+					continue
+				}
+				// the replication spec change will get the pipeline stopped
+				return
+			}
+		}
+	}
+}
+
+// bounded replication is completed when all vbuckets in the source bucket, including the ones on other nodes,
+// have persisted checkpoint records marked as completed
+func (ckmgr *CheckpointManager) checkBoundedCompletion() (bool, error) {
+	// check local vbuckets first, which does not involve metakv
+	for _, vbno := range ckmgr.getMyVBs() {
+		obj, ok := ckmgr.cur_ckpts[vbno]
+		if !ok {
+			return false, nil
+		}
+		obj.lock.RLock()
+		completed := obj.ckpt.Bounded_completed
+		obj.lock.RUnlock()
+		if !completed {
+			return false, nil
+		}
+	}
+
+	topic := ckmgr.pipeline.Topic()
+	spec := ckmgr.pipeline.Specification()
+	server_vbmap, err := ckmgr.cluster_info_svc.GetLocalServerVBucketsMap(ckmgr.xdcr_topology_svc, spec.SourceBucketName)
+	if err != nil {
+		return false, err
+	}
+	ckpt_docs, err := ckmgr.checkpoints_svc.CheckpointsDocs(topic)
+	if err != nil {
+		return false, err
+	}
+	for _, vbnos := range server_vbmap {
+		for _, vbno := range vbnos {
+			ckpt_doc, ok := ckpt_docs[vbno]
+			if !ok || ckpt_doc == nil || len(ckpt_doc.Checkpoint_records) == 0 || ckpt_doc.Checkpoint_records[0] == nil ||
+				!ckpt_doc.Checkpoint_records[0].Bounded_completed {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func (ckmgr *CheckpointManager) markBoundedCompleted() error {
+	topic := ckmgr.pipeline.Topic()
+	spec, err := ckmgr.rep_spec_svc.ReplicationSpec(topic)
+	if err != nil {
+		return err
+	}
+	if spec.Settings.IsBoundedCompleted() {
+		// already marked, possibly by checkpoint manager on another node
+		return nil
+	}
+
+	settings := make(metadata.ReplicationSettingsMap)
+	settings[metadata.BoundedCompletedKey] = true
+	_, errorMap := spec.Settings.UpdateSettingsFromMap(settings)
+	if len(errorMap) != 0 {
+		return fmt.Errorf("Error updating completion state of replication %v. err=%v", topic, errorMap)
+	}
+
+	ckmgr.logger.Infof("%v All vbuckets have been replicated. Marking bounded replication as completed", topic)
+	return ckmgr.rep_spec_svc.SetReplicationSpec(spec)
+}
+
+// returns a copy of the failover log of vbno, or nil if it has not been received
+func (ckmgr *CheckpointManager) getFailoverLog(vbno uint16) [][2]uint64 {
+	failoverlog_obj, ok := ckmgr.failoverlog_map[vbno]
+	if !ok {
+		return nil
+	}
+
+	failoverlog_obj.lock.RLock()
+	defer failoverlog_obj.lock.RUnlock()
+	if failoverlog_obj.failoverlog == nil {
+		return nil
+	}
+	failoverLog := make([][2]uint64, len(*failoverlog_obj.failoverlog))
+	copy(failoverLog, *failoverlog_obj.failoverlog)
+	return failoverLog
+}
+
 // public API. performs one checkpoint operation on request
 func (ckmgr *CheckpointManager) PerformCkpt(fin_ch chan bool) {
 	ckmgr.logger.Infof("Start one time checkpointing for replication %v\n", ckmgr.pipeline.Topic())
@@ -974,8 +1194,10 @@ func (ckmgr *CheckpointManager) PerformCkpt(fin_ch chan bool) {
 	if !ckmgr.isTargetES {
 		// get through seqnos for all vbuckets in the pipeline
 		through_seqno_map = ckmgr.through_seqno_tracker_svc.GetThroughSeqnos()
-		// get high seqno and vbuuid for all vbuckets in the pipeline
-		high_seqno_and_vbuuid_map = ckmgr.getHighSeqnoAndVBUuidFromTarget(fin_ch)
+		if !ckmgr.isTargetSink {
+			// get high seqno and vbuuid for all vbuckets in the pipeline
+			high_seqno_and_vbuuid_map = ckmgr.getHighSeqnoAndVBUuidFromTarget(fin_ch)
+		}
 		// get first seen xattr seqnos for all vbuckets in the pipeline
 		xattr_seqno_map = pipeline_utils.GetXattrSeqnos(ckmgr.pipeline)
 	}
@@ -1023,8 +1245,10 @@ func (ckmgr *CheckpointManager) performCkpt(fin_ch chan bool, wait_grp *sync.Wai
 	if !ckmgr.isTargetES {
 		// get through seqnos for all vbuckets in the pipeline
 		through_seqno_map = ckmgr.through_seqno_tracker_svc.GetThroughSeqnos()
-		// get high seqno and vbuuid for all vbuckets in the pipeline
-		high_seqno_and_vbuuid_map = ckmgr.getHighSeqnoAndVBUuidFromTarget(fin_ch)
+		if !ckmgr.isTargetSink {
+			// get high seqno and vbuuid for all vbuckets in the pipeline
+			high_seqno_and_vbuuid_map = ckmgr.getHighSeqnoAndVBUuidFromTarget(fin_ch)
+		}
 		// get first seen xattr seqnos for all vbuckets in the pipeline
 		xattr_seqno_map = pipeline_utils.GetXattrSeqnos(ckmgr.pipeline)
 	}
@@ -1082,7 +1306,7 @@ func (ckmgr *CheckpointManager) performCkpt_internal(vb_list []uint16, fin_ch <-
  */
 func (ckptRecord *checkpointRecordWithLock) updateAndPersist(ckmgr *CheckpointManager, vbno uint16, versionNumberIn uint64,
 	xattrSeqno uint64, seqno uint64, targetSeqno uint64, failoverUuid uint64,
-	dcpSsSeqno uint64, dcpSsEndSeqno uint64) error {
+	dcpSsSeqno uint64, dcpSsEndSeqno uint64, boundedCompleted bool) error {
 
 	if ckptRecord == nil {
 		return errors.New("Nil ckptRecord")
@@ -1104,6 +1328,7 @@ func (ckptRecord *checkpointRecordWithLock) updateAndPersist(ckmgr *CheckpointMa
 	ckptRecord.ckpt.Failover_uuid = failoverUuid
 	ckptRecord.ckpt.Dcp_snapshot_seqno = dcpSsSeqno
 	ckptRecord.ckpt.Dcp_snapshot_end_seqno = dcpSsEndSeqno
+	ckptRecord.ckpt.Bounded_completed = boundedCompleted
 	ckptRecord.versionNum++
 
 	// Persist the record
@@ -1116,6 +1341,36 @@ func (ckptRecord *checkpointRecordWithLock) updateAndPersist(ckmgr *CheckpointMa
 	return nil
 }
 
+/**
+ * Marks this check point record of bounded replication as completed, without changing the other fields,
+ * only if the versionNumber matches. This is needed when the vb has been fully replicated at the last checkpoint,
+ * and hence there is nothing new to checkpoint.
+ */
+func (ckptRecord *checkpointRecordWithLock) setBoundedCompletedAndPersist(ckmgr *CheckpointManager, vbno uint16, versionNumberIn uint64) error {
+	if ckptRecord == nil {
+		return errors.New("Nil ckptRecord")
+	}
+
+	ckptRecord.lock.Lock()
+	defer ckptRecord.lock.Unlock()
+
+	if ckptRecord.ckpt == nil {
+		return errors.New("Nil ckpt")
+	}
+
+	if versionNumberIn != ckptRecord.versionNum {
+		return ckptRecordMismatch
+	}
+	ckptRecord.ckpt.Bounded_completed = true
+	ckptRecord.versionNum++
+
+	persistErr := ckmgr.persistCkptRecord(vbno, ckptRecord.ckpt, 0 /*xattrSeqno*/)
+	if persistErr != nil {
+		ckmgr.logger.Warnf("%v failed to persist completion of bounded replication for vb=%v. err=%v", ckmgr.pipeline.Topic(), vbno, persistErr)
+	}
+	return nil
+}
+
 /**
  * Given the current information, we want to establish a single checkpoint entry and persist it. We need to populate the followings:
  * 1. The Source vbucket through sequence number
@@ -1145,6 +1400,7 @@ func (ckmgr *CheckpointManager) doCheckpoint(vbno uint16, through_seqno_map map[
 	currRecordVersion := ckpt_obj.versionNum
 	last_seqno := ckpt_obj.ckpt.Seqno
 	curCkptTargetVBOpaque = ckpt_obj.ckpt.Target_vb_opaque
+	last_bounded_completed := ckpt_obj.ckpt.Bounded_completed
 	ckpt_obj.lock.RUnlock()
 
 	through_seqno, err := ckmgr.getThroughSeqno(vbno, through_seqno_map)
@@ -1163,6 +1419,20 @@ func (ckmgr *CheckpointManager) doCheckpoint(vbno uint16, through_seqno_map map[
 		ckmgr.logger.Infof("%v Checkpoint seqno went backward, possibly due to rollback. vb=%v, old_seqno=%v, new_seqno=%v", ckmgr.pipeline.Topic(), vbno, last_seqno, through_seqno)
 	}
 
+	bounded_completed := ckmgr.isBoundedCompletedForVB(vbno, through_seqno)
+	if through_seqno == last_seqno && bounded_completed && !last_bounded_completed {
+		// vb has been fully replicated at the last checkpoint, or has nothing to replicate in the bounded range.
+		// record the completion without the usual checkpointing, which may not be possible since dcp stream
+		// of the vb may not have been opened
+		ckmgr.logger.Infof("%v Bounded replication has completed for vb=%v. seqno=%v\n", ckmgr.pipeline.Topic(), vbno, through_seqno)
+		err = ckpt_obj.setBoundedCompletedAndPersist(ckmgr, vbno, currRecordVersion)
+		if err != nil {
+			ckmgr.logger.Warnf("%v skipping recording of bounded replication completion for vb=%v version %v since a more recent checkpoint has been completed",
+				ckmgr.pipeline.Topic(), vbno, currRecordVersion)
+		}
+		return nil
+	}
+
 	if through_seqno == last_seqno {
 		ckmgr.logger.Debugf("%v No replication has happened in vb %v since replication start or last checkpoint. seqno=%v. Skip checkpointing\\n", ckmgr.pipeline.Topic(), vbno, last_seqno)
 		return nil
@@ -1217,7 +1487,7 @@ func (ckmgr *CheckpointManager) doCheckpoint(vbno uint16, through_seqno_map map[
 
 	// Write-operation - feed the temporary variables and update them into the record and also write them to metakv
 	err = ckpt_obj.updateAndPersist(ckmgr, vbno, currRecordVersion, xattr_seqno, through_seqno, ckptRecordTargetSeqno,
-		ckRecordFailoverUuid, ckRecordDcpSnapSeqno, ckRecordDcpSnapEndSeqno)
+		ckRecordFailoverUuid, ckRecordDcpSnapSeqno, ckRecordDcpSnapEndSeqno, bounded_completed)
 
 	if err != nil {
 		// We weren't able to atomically update the checkpoint record. This checkpoint record is essentially lost
@@ -1230,6 +1500,33 @@ func (ckmgr *CheckpointManager) doCheckpoint(vbno uint16, through_seqno_map map[
 	return nil
 }
 
+// whether the bounded range of vb has been fully replicated, i.e., whether dcp stream of vb has reached its end
+// and through seqno has caught up with the last seqno in the stream
+func (ckmgr *CheckpointManager) isBoundedCompletedForVB(vbno uint16, through_seqno uint64) bool {
+	ckmgr.bounded_ends_lock.RLock()
+	defer ckmgr.bounded_ends_lock.RUnlock()
+	end_seqno, ok := ckmgr.bounded_ends[vbno]
+	return ok && through_seqno >= end_seqno
+}
+
+// returns the end seqno of the bounded stream of vbno, for bounded replication without seqno range.
+// the end seqno that the replication first started with is kept in checkpoint records, so that data written after
+// that is not replicated after pipeline restarts. when there is none, highSeqno, i.e., the current high seqno of vbno,
+// becomes the end seqno and is persisted with the next checkpoint. until then nothing has been checkpointed for vbno,
+// and the replication of vbno starts over from the beginning as if it had not been started before
+func (ckmgr *CheckpointManager) GetBoundedEndSeqno(vbno uint16, highSeqno uint64) uint64 {
+	obj, ok := ckmgr.cur_ckpts[vbno]
+	if !ok {
+		return highSeqno
+	}
+	obj.lock.Lock()
+	defer obj.lock.Unlock()
+	if obj.ckpt.Bounded_end_seqno == 0 {
+		obj.ckpt.Bounded_end_seqno = highSeqno
+	}
+	return obj.ckpt.Bounded_end_seqno
+}
+
 func (ckmgr *CheckpointManager) getThroughSeqno(vbno uint16, through_seqno_map map[uint16]uint64) (uint64, error) {
 	var through_seqno uint64
 	if !ckmgr.isTargetES {
@@ -1247,7 +1544,10 @@ func (ckmgr *CheckpointManager) getThroughSeqno(vbno uint16, through_seqno_map m
 }
 
 func (ckmgr *CheckpointManager) getRemoteSeqno(vbno uint16, high_seqno_and_vbuuid_map map[uint16][]uint64, curCkptTargetVBOpaque metadata.TargetVBOpaque) (uint64, error) {
-	if !ckmgr.isTargetES {
+	if ckmgr.isTargetSink {
+		// sinks do not have seqnos
+		return 0, nil
+	} else if !ckmgr.isTargetES {
 		// non-capi mode, high_seqno and vbuuid on target have been retrieved through vbucket-seqno stats
 		high_seqno_and_vbuuid, ok := high_seqno_and_vbuuid_map[vbno]
 		if !ok {
@@ -1354,6 +1654,14 @@ func (ckmgr *CheckpointManager) OnEvent(event *common.Event) {
 				ckmgr.handleGeneralError(err)
 			}
 		}
+	} else if event.EventType == common.StreamingEnd {
+		streamingEnd, ok := event.OtherInfos.(*parts.StreamingEndEventAdditional)
+		if ok {
+			ckmgr.logger.Infof("%v Bounded dcp stream for vb=%v has ended. last seqno=%v\n", ckmgr.pipeline.Topic(), streamingEnd.VBucket, streamingEnd.LastSeqno)
+			ckmgr.bounded_ends_lock.Lock()
+			ckmgr.bounded_ends[streamingEnd.VBucket] = streamingEnd.LastSeqno
+			ckmgr.bounded_ends_lock.Unlock()
+		}
 	}
 
 }
@@ -1481,6 +1789,18 @@ func (ckmgr *CheckpointManager) handleVBError(vbno uint16, err error) {
 	ckmgr.RaiseEvent(common.NewEvent(common.VBErrorEncountered, nil, ckmgr, nil, additionalInfo))
 }
 
+// returns the seqno and failover uuid in the current checkpoint record of the specified vb
+// the last return value is false if the vb is not managed by the checkpoint manager
+func (ckmgr *CheckpointManager) GetCheckpointedSeqnoAndFailoverUUID(vbno uint16) (uint64, uint64, bool) {
+	ckpt_obj, ok := ckmgr.cur_ckpts[vbno]
+	if !ok {
+		return 0, 0, false
+	}
+	ckpt_obj.lock.RLock()
+	defer ckpt_obj.lock.RUnlock()
+	return ckpt_obj.ckpt.Seqno, ckpt_obj.ckpt.Failover_uuid, true
+}
+
 func (ckmgr *CheckpointManager) getCurrentCkptWLock(vbno uint16) *checkpointRecordWithLock {
 	return ckmgr.cur_ckpts[vbno]
 }
@@ -12,6 +12,7 @@ package pipeline_svc
 import (
 	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
 	mcc "github.com/couchbase/gomemcached/client"
 	"github.com/couchbase/goxdcr/base"
@@ -20,11 +21,13 @@ import (
 	"github.com/couchbase/goxdcr/metadata"
 	"github.com/couchbase/goxdcr/parts"
 	"github.com/couchbase/goxdcr/pipeline"
+	"github.com/couchbase/goxdcr/pipeline_manager"
 	"github.com/couchbase/goxdcr/pipeline_utils"
 	"github.com/couchbase/goxdcr/service_def"
 	"github.com/couchbase/goxdcr/supervisor"
 	utilities "github.com/couchbase/goxdcr/utils"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -66,6 +69,9 @@ type PipelineSupervisor struct {
 
 	// Filtering Errors should be regulated for printing otherwise to prevent log flooding
 	filterErrCh chan error
+
+	// evaluates replication health from stats samples taken at health checks
+	health_tracker *pipeline.ReplicationHealthTracker
 }
 
 func NewPipelineSupervisor(id string, logger_ctx *log.LoggerContext, failure_handler common.SupervisorFailureHandler,
@@ -81,6 +87,7 @@ func NewPipelineSupervisor(id string, logger_ctx *log.LoggerContext, failure_han
 		kv_mem_clients_lock: &sync.Mutex{},
 		utils:               utilsIn,
 		filterErrCh:         make(chan error, maxFilterErrorsPerInterval),
+		health_tracker:      pipeline.NewReplicationHealthTracker(),
 	}
 	return pipelineSupervisor
 }
@@ -113,6 +120,7 @@ func (pipelineSupervisor *PipelineSupervisor) Attach(p common.Pipeline) error {
 		connector.RegisterComponentEventListener(common.ErrorEncountered, pipelineSupervisor)
 		connector.RegisterComponentEventListener(common.VBErrorEncountered, pipelineSupervisor)
 		connector.RegisterComponentEventListener(common.DataUnableToFilter, pipelineSupervisor)
+		connector.RegisterComponentEventListener(common.DataUnableToTransform, pipelineSupervisor)
 		pipelineSupervisor.Logger().Debugf("Registering ErrorEncountered event on connector %v\n", connector.Id())
 	}
 
@@ -196,6 +204,7 @@ func (pipelineSupervisor *PipelineSupervisor) monitorPipelineHealth() error {
 			pipelineSupervisor.Logger().Infof("monitorPipelineHealth routine is exiting because parent supervisor %v has been stopped\n", pipelineSupervisor.Id())
 			return nil
 		case <-health_check_ticker.C:
+			pipelineSupervisor.updateReplicationHealth()
 			err := base.ExecWithTimeout(pipelineSupervisor.checkPipelineHealth, 1000*time.Millisecond, pipelineSupervisor.Logger())
 			if err != nil {
 				if err == base.ExecutionTimeoutError {
@@ -220,6 +229,17 @@ func (pipelineSupervisor *PipelineSupervisor) logFilterError(err error, desc str
 	}
 }
 
+// data that cannot be transformed is replicated as it is. the errors are logged the same way as filter errors
+func (pipelineSupervisor *PipelineSupervisor) logTransformError(err error, key []byte) {
+	combinedErr := fmt.Errorf("Transformation error: %v - document %v%s%v is replicated without transformation", err, base.UdTagBegin, key, base.UdTagEnd)
+	select {
+	case pipelineSupervisor.filterErrCh <- combinedErr:
+		// Error added to channel
+	default:
+		// Error channel is full. Can't add anymore. Have to drop
+	}
+}
+
 func (pipelineSupervisor *PipelineSupervisor) checkAndLogFilterErrors() {
 	pipelineSupervisor.Logger().Infof("%v checkAndLogFilterErrors started", pipelineSupervisor.Id())
 
@@ -250,7 +270,7 @@ func (pipelineSupervisor *PipelineSupervisor) checkAndLogFilterErrors() {
 				break
 			}
 			if len(errMsgs) > 0 {
-				pipelineSupervisor.Logger().Warnf("Last %v filtering errors: %v", msgsPrinted, strings.Join(errMsgs, ", "))
+				pipelineSupervisor.Logger().Warnf("Last %v filtering or transformation errors: %v", msgsPrinted, strings.Join(errMsgs, ", "))
 			}
 		}
 	}
@@ -300,6 +320,9 @@ func (pipelineSupervisor *PipelineSupervisor) OnEvent(event *common.Event) {
 				pipelineSupervisor.Logger().Debugf("Failed filtering uprEvent dump\n%v%v%v\n", base.UdTagBegin, string(uprDumpBytes), base.UdTagEnd)
 			}
 		}
+	case common.DataUnableToTransform:
+		err = event.DerivedData[0].(error)
+		pipelineSupervisor.logTransformError(err, event.Data.(*mcc.UprEvent).Key)
 	default:
 		pipelineSupervisor.Logger().Errorf("%v Pipeline supervisor didn't register to recieve event %v for component %v", pipelineSupervisor.Id(), event.EventType, event.Component.Id())
 	}
@@ -359,6 +382,49 @@ func (pipelineSupervisor *PipelineSupervisor) checkPipelineHealth() error {
 	return nil
 }
 
+// samples the overview stats of the pipeline, and publishes replication health evaluated from them to replication status
+func (pipelineSupervisor *PipelineSupervisor) updateReplicationHealth() {
+	topic := pipelineSupervisor.pipeline.Topic()
+	rep_status, err := pipeline_manager.ReplicationStatus(topic)
+	if err != nil || rep_status == nil {
+		return
+	}
+	overview_stats := rep_status.GetOverviewStats()
+	if overview_stats == nil {
+		// stats have not been computed yet
+		return
+	}
+
+	pipelineSupervisor.health_tracker.AddSample(&pipeline.ReplicationHealthSample{
+		Time:           time.Now(),
+		ChangesLeft:    getIntFromOverviewStats(overview_stats, CHANGES_LEFT_METRIC),
+		DocsProcessed:  getIntFromOverviewStats(overview_stats, DOCS_PROCESSED_METRIC),
+		DocsResent:     getIntFromOverviewStats(overview_stats, DOCS_RESENT_METRIC),
+		NumCheckpoints: getIntFromOverviewStats(overview_stats, NUM_CHECKPOINTS_METRIC),
+	})
+
+	checkpointInterval := time.Duration(pipelineSupervisor.pipeline.Specification().Settings.CheckpointInterval) * time.Second
+	health := pipelineSupervisor.health_tracker.Evaluate(rep_status.Errors(), checkpointInterval)
+	if old_health := rep_status.Health(); old_health.State != health.State {
+		reasons, _ := json.Marshal(health.Reasons)
+		pipelineSupervisor.Logger().Infof("%v health of replication %v changed from %v to %v. reasons=%s", pipelineSupervisor.Id(), topic, old_health.State, health.State, reasons)
+	}
+	rep_status.SetHealth(health)
+}
+
+// returns 0 when the stats does not exist or is not an integer
+func getIntFromOverviewStats(overview_stats *expvar.Map, name string) int64 {
+	stats_var := overview_stats.Get(name)
+	if stats_var == nil {
+		return 0
+	}
+	value, err := strconv.ParseInt(stats_var.String(), base.ParseIntBase, base.ParseIntBitSize)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
 // compose user agent string for HELO command
 func (pipelineSupervisor *PipelineSupervisor) composeUserAgent() {
 	spec := pipelineSupervisor.pipeline.Specification()
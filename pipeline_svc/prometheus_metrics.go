@@ -0,0 +1,148 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package pipeline_svc
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"github.com/couchbase/goxdcr/base"
+	pipeline_pkg "github.com/couchbase/goxdcr/pipeline"
+	"sort"
+	"strings"
+)
+
+const (
+	PrometheusMetricPrefix = "xdcr_"
+
+	PrometheusSourceBucketLabel      = "source_bucket"
+	PrometheusTargetClusterUUIDLabel = "target_cluster_uuid"
+	PrometheusTargetBucketLabel      = "target_bucket"
+
+	prometheusCounterType = "counter"
+	prometheusGaugeType   = "gauge"
+)
+
+// overview metrics that only go up during the life time of a replication and can be exposed as prometheus counters.
+// all other overview metrics, e.g., changes_left and rates, are exposed as gauges
+var CumulativeMetricKeyMap = map[string]bool{
+	DOCS_WRITTEN_METRIC:              true,
+	EXPIRY_DOCS_WRITTEN_METRIC:       true,
+	DELETION_DOCS_WRITTEN_METRIC:     true,
+	SET_DOCS_WRITTEN_METRIC:          true,
+	DOCS_PROCESSED_METRIC:            true,
+	DOCS_FAILED_CR_SOURCE_METRIC:     true,
+	EXPIRY_FAILED_CR_SOURCE_METRIC:   true,
+	DELETION_FAILED_CR_SOURCE_METRIC: true,
+	SET_FAILED_CR_SOURCE_METRIC:      true,
+	DATA_REPLICATED_METRIC:           true,
+	DOCS_FILTERED_METRIC:             true,
+	DOCS_UNABLE_TO_FILTER_METRIC:     true,
+	EXPIRY_FILTERED_METRIC:           true,
+	DELETION_FILTERED_METRIC:         true,
+	SET_FILTERED_METRIC:              true,
+	EXPIRY_STRIPPED_METRIC:           true,
+	DOCS_TRANSFORMED_METRIC:          true,
+	DOCS_UNABLE_TO_TRANSFORM_METRIC:  true,
+	NUM_CHECKPOINTS_METRIC:           true,
+	NUM_FAILEDCKPTS_METRIC:           true,
+	NUM_INVALID_CKPTS_METRIC:         true,
+	DOCS_RESENT_METRIC:               true,
+	DOCS_OPT_REPD_METRIC:             true,
+	DOCS_RECEIVED_DCP_METRIC:         true,
+	EXPIRY_RECEIVED_DCP_METRIC:       true,
+	DELETION_RECEIVED_DCP_METRIC:     true,
+	SET_RECEIVED_DCP_METRIC:          true,
+	DP_GET_FAIL_METRIC:               true,
+}
+
+type prometheusSample struct {
+	labels string
+	value  string
+}
+
+// GetPrometheusMetrics renders the overview stats of the specified replications in prometheus text exposition format.
+// each sample is labeled with the source bucket, target cluster uuid and target bucket of its replication
+func GetPrometheusMetrics(repl_status_map map[string]*pipeline_pkg.ReplicationStatus) []byte {
+	// prometheus requires that all samples of the same metric be grouped together
+	samples_map := make(map[string][]*prometheusSample)
+
+	repIds := make([]string, 0, len(repl_status_map))
+	for repId, _ := range repl_status_map {
+		repIds = append(repIds, repId)
+	}
+	sort.Strings(repIds)
+
+	for _, repId := range repIds {
+		repl_status := repl_status_map[repId]
+		if repl_status == nil {
+			continue
+		}
+		spec := repl_status.Spec()
+		overview_stats := repl_status.GetOverviewStats()
+		if spec == nil || overview_stats == nil {
+			continue
+		}
+
+		labels := fmt.Sprintf("{%v=\"%v\",%v=\"%v\",%v=\"%v\"}",
+			PrometheusSourceBucketLabel, escapePrometheusLabelValue(spec.SourceBucketName),
+			PrometheusTargetClusterUUIDLabel, escapePrometheusLabelValue(spec.TargetClusterUUID),
+			PrometheusTargetBucketLabel, escapePrometheusLabelValue(spec.TargetBucketName))
+
+		overview_stats.Do(func(kv expvar.KeyValue) {
+			if kv.Key == base.CurrentTime {
+				return
+			}
+			switch kv.Value.(type) {
+			case *expvar.Int, *expvar.Float:
+				name := PrometheusMetricPrefix + sanitizePrometheusMetricName(kv.Key)
+				samples_map[name] = append(samples_map[name], &prometheusSample{labels, kv.Value.String()})
+			default:
+				// non-numeric stats, e.g., progress string, are not exposed
+			}
+		})
+	}
+
+	names := make([]string, 0, len(samples_map))
+	for name, _ := range samples_map {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buffer bytes.Buffer
+	for _, name := range names {
+		metricType := prometheusGaugeType
+		if CumulativeMetricKeyMap[strings.TrimPrefix(name, PrometheusMetricPrefix)] {
+			metricType = prometheusCounterType
+		}
+		buffer.WriteString(fmt.Sprintf("# TYPE %v %v\n", name, metricType))
+		for _, sample := range samples_map[name] {
+			buffer.WriteString(fmt.Sprintf("%v%v %v\n", name, sample.labels, sample.value))
+		}
+	}
+	return buffer.Bytes()
+}
+
+// metric names can contain only letters, digits, underscores and colons
+func sanitizePrometheusMetricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// backslash, double quote and line feed need to be escaped in label values
+func escapePrometheusLabelValue(value string) string {
+	value = strings.Replace(value, "\\", "\\\\", -1)
+	value = strings.Replace(value, "\"", "\\\"", -1)
+	return strings.Replace(value, "\n", "\\n", -1)
+}
@@ -0,0 +1,100 @@
+// +build !pcre
+
+package pipeline_svc
+
+import (
+	"expvar"
+	"fmt"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/metadata"
+	pipeline_pkg "github.com/couchbase/goxdcr/pipeline"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestSanitizePrometheusMetricName(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestSanitizePrometheusMetricName =================")
+
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{"docs_written", "docs_written"},
+		{"rate_replicated", "rate_replicated"},
+		{"bandwidth_usage:MB", "bandwidth_usage:MB"},
+		{"docs-written", "docs_written"},
+		{"percent completeness", "percent_completeness"},
+		{"size.rep.queue", "size_rep_queue"},
+		{"métrique", "m_trique"},
+		{"", ""},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(testCase.expected, sanitizePrometheusMetricName(testCase.name), testCase.name)
+	}
+	fmt.Println("============== Test case end: TestSanitizePrometheusMetricName =================")
+}
+
+func TestEscapePrometheusLabelValue(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestEscapePrometheusLabelValue =================")
+
+	testCases := []struct {
+		value    string
+		expected string
+	}{
+		{"default", "default"},
+		{"bucket-1_a", "bucket-1_a"},
+		{`a"b`, `a\"b`},
+		{`a\b`, `a\\b`},
+		{"a\nb", `a\nb`},
+		{`\"`, `\\\"`},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(testCase.expected, escapePrometheusLabelValue(testCase.value), testCase.value)
+	}
+	fmt.Println("============== Test case end: TestEscapePrometheusLabelValue =================")
+}
+
+func TestGetPrometheusMetrics(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestGetPrometheusMetrics =================")
+
+	logger := log.NewLogger("PrometheusMetricsTest", log.DefaultLoggerContext)
+	spec, err := metadata.NewReplicationSpecification("sourceBucket", "sourceBucketUUID", "targetClusterUUID", "targetBucket", "targetBucketUUID")
+	assert.Nil(err)
+	specGetter := func(string) (*metadata.ReplicationSpecification, error) {
+		return spec, nil
+	}
+	repl_status := pipeline_pkg.NewReplicationStatus(spec.Id, specGetter, logger)
+
+	overview_stats := new(expvar.Map).Init()
+	docsWritten := new(expvar.Int)
+	docsWritten.Set(10)
+	overview_stats.Set(DOCS_WRITTEN_METRIC, docsWritten)
+	changesLeft := new(expvar.Int)
+	changesLeft.Set(5)
+	overview_stats.Set(CHANGES_LEFT_METRIC, changesLeft)
+	progress := new(expvar.String)
+	progress.Set("running")
+	overview_stats.Set("progress", progress)
+	repl_status.SetOverviewStats(overview_stats)
+
+	// replications without stats are skipped
+	metrics := string(GetPrometheusMetrics(map[string]*pipeline_pkg.ReplicationStatus{spec.Id: repl_status, "noStatus": nil}))
+
+	labels := `{source_bucket="sourceBucket",target_cluster_uuid="targetClusterUUID",target_bucket="targetBucket"}`
+	assert.Contains(metrics, "# TYPE xdcr_docs_written counter\n")
+	assert.Contains(metrics, "xdcr_docs_written"+labels+" 10\n")
+	assert.Contains(metrics, "# TYPE xdcr_changes_left gauge\n")
+	assert.Contains(metrics, "xdcr_changes_left"+labels+" 5\n")
+	// non-numeric stats are not exposed
+	assert.False(strings.Contains(metrics, "progress"))
+	// metrics are sorted by name
+	assert.True(strings.Index(metrics, "xdcr_changes_left") < strings.Index(metrics, "xdcr_docs_written"))
+
+	fmt.Println("============== Test case end: TestGetPrometheusMetrics =================")
+}
@@ -53,6 +53,10 @@ const (
 	SET_FILTERED_METRIC          = "set_filtered"
 	EXPIRY_STRIPPED_METRIC       = "expiry_stripped"
 
+	// the number of docs changed by transformation rules and the number of docs that could not be transformed
+	DOCS_TRANSFORMED_METRIC         = "docs_transformed"
+	DOCS_UNABLE_TO_TRANSFORM_METRIC = "docs_unable_to_transform"
+
 	// the number of docs that failed conflict resolution on the source cluster side due to optimistic replication
 	DOCS_FAILED_CR_SOURCE_METRIC     = "docs_failed_cr_source"
 	EXPIRY_FAILED_CR_SOURCE_METRIC   = "expiry_failed_cr_source"
@@ -63,6 +67,11 @@ const (
 	DOCS_LATENCY_METRIC = "wtavg_docs_latency"
 	META_LATENCY_METRIC = "wtavg_meta_latency"
 	RESP_WAIT_METRIC    = "resp_wait_time"
+	// the number of docs resent to target because responses were not received in time
+	DOCS_RESENT_METRIC = "docs_resent"
+	// batch count and batch size (in KB) currently in use by xmem, which are adjusted when adaptive batch sizing is enabled
+	EFFECTIVE_BATCH_COUNT_METRIC = "effective_batch_count"
+	EFFECTIVE_BATCH_SIZE_METRIC  = "effective_batch_size_kb"
 
 	//checkpointing related statistics
 	DOCS_CHECKED_METRIC    = "docs_checked" //calculated
@@ -70,6 +79,8 @@ const (
 	TIME_COMMITING_METRIC  = "time_committing"
 	NUM_FAILEDCKPTS_METRIC = "num_failedckpts"
 	RATE_DOC_CHECKS_METRIC = "rate_doc_checks"
+	// the number of checkpoint records that have been found to be unusable, e.g., after failovers, and removed
+	NUM_INVALID_CKPTS_METRIC = "num_invalid_ckpts"
 	//optimistic replication replated statistics
 	DOCS_OPT_REPD_METRIC = "docs_opt_repd"
 	RATE_OPT_REPD_METRIC = "rate_doc_opt_repd"
@@ -94,6 +105,8 @@ const (
 	//rate
 	RATE_REPLICATED_METRIC = "rate_replicated"
 	BANDWIDTH_USAGE_METRIC = "bandwidth_usage"
+	// overall bandwidth limit in effect, which could come from either bandwidth limit or bandwidth profile
+	EFFECTIVE_BANDWIDTH_LIMIT_METRIC = "effective_bandwidth_limit"
 
 	VB_HIGHSEQNO_PREFIX = "vb_highseqno_"
 
@@ -135,7 +148,8 @@ var OverviewMetricKeys = []string{CHANGES_LEFT_METRIC, DOCS_CHECKED_METRIC, DOCS
 	TIME_COMMITING_METRIC, DOCS_OPT_REPD_METRIC, DOCS_RECEIVED_DCP_METRIC, EXPIRY_RECEIVED_DCP_METRIC,
 	DELETION_RECEIVED_DCP_METRIC, SET_RECEIVED_DCP_METRIC, SIZE_REP_QUEUE_METRIC, DOCS_REP_QUEUE_METRIC, DOCS_LATENCY_METRIC,
 	RESP_WAIT_METRIC, META_LATENCY_METRIC, DCP_DISPATCH_TIME_METRIC, DCP_DATACH_LEN, THROTTLE_LATENCY_METRIC, THROUGHPUT_THROTTLE_LATENCY_METRIC,
-	DP_GET_FAIL_METRIC, EXPIRY_STRIPPED_METRIC}
+	DP_GET_FAIL_METRIC, EXPIRY_STRIPPED_METRIC, DOCS_TRANSFORMED_METRIC, DOCS_UNABLE_TO_TRANSFORM_METRIC, NUM_INVALID_CKPTS_METRIC,
+	DOCS_RESENT_METRIC, EFFECTIVE_BATCH_COUNT_METRIC, EFFECTIVE_BATCH_SIZE_METRIC}
 
 // keys for metrics that do not monotonically increase during replication, to which the "going backward" check should not be applied
 var NonIncreasingMetricKeyMap = map[string]bool{
@@ -394,10 +408,13 @@ func (stats_mgr *StatisticsManager) logStatsOnce() error {
 		//log parts summary
 		outNozzle_parts := stats_mgr.pipeline.Targets()
 		for _, part := range outNozzle_parts {
-			if stats_mgr.pipeline.Specification().Settings.RepType == metadata.ReplicationTypeXmem {
-				part.(*parts.XmemNozzle).PrintStatusSummary()
-			} else {
-				part.(*parts.CapiNozzle).PrintStatusSummary()
+			switch outNozzle := part.(type) {
+			case *parts.XmemNozzle:
+				outNozzle.PrintStatusSummary()
+			case *parts.CapiNozzle:
+				outNozzle.PrintStatusSummary()
+			case *parts.SinkNozzle:
+				outNozzle.PrintStatusSummary()
 			}
 		}
 		dcp_parts := stats_mgr.pipeline.Sources()
@@ -554,6 +571,18 @@ func (stats_mgr *StatisticsManager) processRawStats() error {
 	return nil
 }
 
+// publishes the overall bandwidth limit currently in effect, which switches with the bandwidth profile of replication
+// the stat is not published when pipeline does not have bandwidth throttler
+func setEffectiveBandwidthLimitStat(overview_expvar_map *expvar.Map, throttler common.PipelineService) {
+	bandwidthThrottler, ok := throttler.(*BandwidthThrottler)
+	if !ok || bandwidthThrottler == nil {
+		return
+	}
+	effective_bandwidth_limit_var := new(expvar.Int)
+	effective_bandwidth_limit_var.Set(bandwidthThrottler.EffectiveBandwidthLimit())
+	overview_expvar_map.Set(EFFECTIVE_BANDWIDTH_LIMIT_METRIC, effective_bandwidth_limit_var)
+}
+
 func (stats_mgr *StatisticsManager) processCalculatedStats(overview_expvar_map *expvar.Map, changes_left_old,
 	docs_written_old, docs_received_dcp_old, docs_opt_repd_old, data_replicated_old, docs_checked_old int64) error {
 
@@ -605,6 +634,9 @@ func (stats_mgr *StatisticsManager) processCalculatedStats(overview_expvar_map *
 	bandwidth_usage_var.Set(bandwidth_usage)
 	overview_expvar_map.Set(BANDWIDTH_USAGE_METRIC, bandwidth_usage_var)
 
+	//publish effective bandwidth limit
+	setEffectiveBandwidthLimitStat(overview_expvar_map, stats_mgr.pipeline.RuntimeContext().Service(base.BANDWIDTH_THROTTLER_SVC))
+
 	//calculate docs_checked
 	docs_checked := stats_mgr.calculateDocsChecked()
 	docs_checked_var := new(expvar.Int)
@@ -669,6 +701,24 @@ func (stats_mgr *StatisticsManager) calculateChangesLeft(docs_processed int64) (
 	return changes_left, nil
 }
 
+// returns the source high seqnos of vbs managed by the pipeline, as retrieved at the last changes_left calculation
+// vbs whose high seqnos have not been retrieved yet are not included
+func (stats_mgr *StatisticsManager) getHighSeqnos() map[uint16]uint64 {
+	stats_mgr.kv_mem_clients_lock.RLock()
+	defer stats_mgr.kv_mem_clients_lock.RUnlock()
+
+	highseqno_map := make(map[uint16]uint64)
+	for _, vbnos := range stats_mgr.active_vbs {
+		for _, vbno := range vbnos {
+			highseqno, err := strconv.ParseUint(stats_mgr.stats_map[fmt.Sprintf(base.VBUCKET_HIGH_SEQNO_STAT_KEY_FORMAT, vbno)], 10, 64)
+			if err == nil {
+				highseqno_map[vbno] = highseqno
+			}
+		}
+	}
+	return highseqno_map
+}
+
 func (stats_mgr *StatisticsManager) getOverviewRegistry() metrics.Registry {
 	return stats_mgr.registries[OVERVIEW_METRICS_KEY]
 }
@@ -925,6 +975,8 @@ func (outNozzle_collector *outNozzleCollector) Mount(pipeline common.Pipeline, s
 		registry.Register(DATA_REPLICATED_METRIC, data_replicated)
 		docs_opt_repd := metrics.NewCounter()
 		registry.Register(DOCS_OPT_REPD_METRIC, docs_opt_repd)
+		docs_resent := metrics.NewCounter()
+		registry.Register(DOCS_RESENT_METRIC, docs_resent)
 		docs_latency := metrics.NewHistogram(metrics.NewUniformSample(stats_mgr.sample_size))
 		registry.Register(DOCS_LATENCY_METRIC, docs_latency)
 		resp_wait := metrics.NewHistogram(metrics.NewUniformSample(stats_mgr.sample_size))
@@ -933,6 +985,11 @@ func (outNozzle_collector *outNozzleCollector) Mount(pipeline common.Pipeline, s
 		registry.Register(META_LATENCY_METRIC, meta_latency)
 		throttle_latency := metrics.NewHistogram(metrics.NewUniformSample(stats_mgr.sample_size))
 		registry.Register(THROTTLE_LATENCY_METRIC, throttle_latency)
+		// histograms, rather than counters, so that the overview shows the average over all out nozzles
+		effective_batch_count := metrics.NewHistogram(metrics.NewUniformSample(stats_mgr.sample_size))
+		registry.Register(EFFECTIVE_BATCH_COUNT_METRIC, effective_batch_count)
+		effective_batch_size := metrics.NewHistogram(metrics.NewUniformSample(stats_mgr.sample_size))
+		registry.Register(EFFECTIVE_BATCH_SIZE_METRIC, effective_batch_size)
 
 		metric_map := make(map[string]interface{})
 		metric_map[SIZE_REP_QUEUE_METRIC] = size_rep_queue
@@ -947,10 +1004,13 @@ func (outNozzle_collector *outNozzleCollector) Mount(pipeline common.Pipeline, s
 		metric_map[SET_FAILED_CR_SOURCE_METRIC] = set_failed_cr
 		metric_map[DATA_REPLICATED_METRIC] = data_replicated
 		metric_map[DOCS_OPT_REPD_METRIC] = docs_opt_repd
+		metric_map[DOCS_RESENT_METRIC] = docs_resent
 		metric_map[DOCS_LATENCY_METRIC] = docs_latency
 		metric_map[RESP_WAIT_METRIC] = resp_wait
 		metric_map[META_LATENCY_METRIC] = meta_latency
 		metric_map[THROTTLE_LATENCY_METRIC] = throttle_latency
+		metric_map[EFFECTIVE_BATCH_COUNT_METRIC] = effective_batch_count
+		metric_map[EFFECTIVE_BATCH_SIZE_METRIC] = effective_batch_size
 		outNozzle_collector.component_map[part.Id()] = metric_map
 
 		// register outNozzle_collector as the sync event listener/handler for StatsUpdate event
@@ -982,6 +1042,15 @@ func (outNozzle_collector *outNozzleCollector) ProcessEvent(event *common.Event)
 		queue_size_bytes := event.OtherInfos.([]int)[1]
 		setCounter(metric_map[DOCS_REP_QUEUE_METRIC].(metrics.Counter), queue_size)
 		setCounter(metric_map[SIZE_REP_QUEUE_METRIC].(metrics.Counter), queue_size_bytes)
+		// resend count is supplied by xmem only
+		if len(event.OtherInfos.([]int)) > 2 {
+			setCounter(metric_map[DOCS_RESENT_METRIC].(metrics.Counter), event.OtherInfos.([]int)[2])
+		}
+		// effective batch count and size are supplied by xmem only
+		if len(event.OtherInfos.([]int)) > 4 {
+			setSample(metric_map[EFFECTIVE_BATCH_COUNT_METRIC].(metrics.Histogram), event.OtherInfos.([]int)[3])
+			setSample(metric_map[EFFECTIVE_BATCH_SIZE_METRIC].(metrics.Histogram), event.OtherInfos.([]int)[4])
+		}
 	} else if event.EventType == common.DataSent {
 		event_otherInfo := event.OtherInfos.(parts.DataSentEventAdditional)
 		req_size := event_otherInfo.Req_size
@@ -1158,6 +1227,10 @@ func (r_collector *routerCollector) Mount(pipeline common.Pipeline, stats_mgr *S
 		registry_router.Register(THROUGHPUT_THROTTLE_LATENCY_METRIC, throughput_throttle_latency)
 		expiry_stripped := metrics.NewCounter()
 		registry_router.Register(EXPIRY_STRIPPED_METRIC, expiry_stripped)
+		docs_transformed := metrics.NewCounter()
+		registry_router.Register(DOCS_TRANSFORMED_METRIC, docs_transformed)
+		docs_unable_to_transform := metrics.NewCounter()
+		registry_router.Register(DOCS_UNABLE_TO_TRANSFORM_METRIC, docs_unable_to_transform)
 
 		metric_map := make(map[string]interface{})
 		metric_map[DOCS_FILTERED_METRIC] = docs_filtered
@@ -1168,12 +1241,15 @@ func (r_collector *routerCollector) Mount(pipeline common.Pipeline, stats_mgr *S
 		metric_map[DP_GET_FAIL_METRIC] = dp_failed
 		metric_map[THROUGHPUT_THROTTLE_LATENCY_METRIC] = throughput_throttle_latency
 		metric_map[EXPIRY_STRIPPED_METRIC] = expiry_stripped
+		metric_map[DOCS_TRANSFORMED_METRIC] = docs_transformed
+		metric_map[DOCS_UNABLE_TO_TRANSFORM_METRIC] = docs_unable_to_transform
 		r_collector.component_map[conn.Id()] = metric_map
 	}
 
 	async_listener_map := pipeline_pkg.GetAllAsyncComponentEventListeners(pipeline)
 	pipeline_utils.RegisterAsyncComponentEventHandler(async_listener_map, base.DataFilteredEventListener, r_collector)
 	pipeline_utils.RegisterAsyncComponentEventHandler(async_listener_map, base.DataThroughputThrottledEventListener, r_collector)
+	pipeline_utils.RegisterAsyncComponentEventHandler(async_listener_map, base.DataTransformedEventListener, r_collector)
 
 	return nil
 }
@@ -1208,6 +1284,10 @@ func (r_collector *routerCollector) ProcessEvent(event *common.Event) error {
 		metric_map[THROUGHPUT_THROTTLE_LATENCY_METRIC].(metrics.Histogram).Sample().Update(throughput_throttle_latency.Nanoseconds() / 1000000)
 	case common.ExpiryFieldStripped:
 		metric_map[EXPIRY_STRIPPED_METRIC].(metrics.Counter).Inc(1)
+	case common.DataTransformed:
+		metric_map[DOCS_TRANSFORMED_METRIC].(metrics.Counter).Inc(1)
+	case common.DataUnableToTransform:
+		metric_map[DOCS_UNABLE_TO_TRANSFORM_METRIC].(metrics.Counter).Inc(1)
 	}
 
 	return nil
@@ -1238,6 +1318,11 @@ func (ckpt_collector *checkpointMgrCollector) Mount(pipeline common.Pipeline, st
 	if err != nil {
 		return err
 	}
+
+	err = ckptmgr.(common.Component).RegisterComponentEventListener(common.InvalidCheckpointsRemoved, ckpt_collector)
+	if err != nil {
+		return err
+	}
 	ckpt_collector.initRegistry()
 	return nil
 }
@@ -1247,6 +1332,7 @@ func (ckpt_collector *checkpointMgrCollector) initRegistry() {
 	registry_ckpt.Register(TIME_COMMITING_METRIC, metrics.NewHistogram(metrics.NewUniformSample(ckpt_collector.stats_mgr.sample_size)))
 	registry_ckpt.Register(NUM_CHECKPOINTS_METRIC, metrics.NewCounter())
 	registry_ckpt.Register(NUM_FAILEDCKPTS_METRIC, metrics.NewCounter())
+	registry_ckpt.Register(NUM_INVALID_CKPTS_METRIC, metrics.NewCounter())
 
 }
 
@@ -1264,6 +1350,10 @@ func (ckpt_collector *checkpointMgrCollector) OnEvent(event *common.Event) {
 		time_commit := event.OtherInfos.(time.Duration).Seconds() * 1000
 		registry.Get(NUM_CHECKPOINTS_METRIC).(metrics.Counter).Inc(1)
 		registry.Get(TIME_COMMITING_METRIC).(metrics.Histogram).Sample().Update(int64(time_commit))
+
+	} else if event.EventType == common.InvalidCheckpointsRemoved {
+		num_invalid_ckpts := event.OtherInfos.(int)
+		registry.Get(NUM_INVALID_CKPTS_METRIC).(metrics.Counter).Inc(int64(num_invalid_ckpts))
 	}
 }
 
@@ -1272,6 +1362,12 @@ func setCounter(counter metrics.Counter, count int) {
 	counter.Inc(int64(count))
 }
 
+// makes value the only sample of histogram, for stats that are gauges but need to be averaged, rather than summed, in overview
+func setSample(histogram metrics.Histogram, value int) {
+	histogram.Clear()
+	histogram.Update(int64(value))
+}
+
 func (stats_mgr *StatisticsManager) getReplicationStatus() (*pipeline_pkg.ReplicationStatus, error) {
 	topic := stats_mgr.pipeline.Topic()
 	return pipeline_manager.ReplicationStatus(topic)
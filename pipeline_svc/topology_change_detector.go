@@ -60,6 +60,9 @@ type TopologyChangeDetectorSvc struct {
 	// whether replication is of capi type
 	capi bool
 
+	// whether replication is to a sink, which has no target topology to watch
+	sink bool
+
 	// whether needs to check target version for RBAC and Xattr support
 	check_target_version_for_rbac_and_xattr bool
 
@@ -93,6 +96,7 @@ func NewTopologyChangeDetectorSvc(cluster_info_svc service_def.ClusterInfoSvc,
 func (top_detect_svc *TopologyChangeDetectorSvc) Attach(pipeline common.Pipeline) error {
 	top_detect_svc.pipeline = pipeline
 	top_detect_svc.capi = pipeline.Specification().Settings.IsCapi()
+	top_detect_svc.sink = pipeline.Specification().Settings.IsSink()
 	return nil
 }
 
@@ -111,12 +115,14 @@ func (top_detect_svc *TopologyChangeDetectorSvc) Start(metadata.ReplicationSetti
 	top_detect_svc.vblist_original = pipeline_utils.GetSourceVBListPerPipeline(top_detect_svc.pipeline)
 	base.SortUint16List(top_detect_svc.vblist_original)
 
-	//initialize target vb server map to set up a baseline for target topology change detection
-	_, target_server_vb_map, err := top_detect_svc.getTargetBucketInfo()
-	if err != nil {
-		return err
+	if !top_detect_svc.sink {
+		//initialize target vb server map to set up a baseline for target topology change detection
+		_, target_server_vb_map, err := top_detect_svc.getTargetBucketInfo()
+		if err != nil {
+			return err
+		}
+		top_detect_svc.target_vb_server_map_original = base.ConstructVbServerMap(top_detect_svc.vblist_original, target_server_vb_map)
 	}
-	top_detect_svc.target_vb_server_map_original = base.ConstructVbServerMap(top_detect_svc.vblist_original, target_server_vb_map)
 
 	top_detect_svc.number_of_source_nodes, err = top_detect_svc.xdcr_topology_svc.NumberOfKVNodes()
 	if err != nil {
@@ -174,6 +180,10 @@ func (top_detect_svc *TopologyChangeDetectorSvc) validate() {
 		top_detect_svc.logger.Warnf("ToplogyChangeDetectorSvc for pipeline %v received error when handling source topology change. err=%v", top_detect_svc.pipeline.Topic(), err)
 	}
 
+	if top_detect_svc.sink {
+		return
+	}
+
 	diff_vb_list, target_vb_server_map, err := top_detect_svc.validateTargetTopology()
 	if err == target_cluster_version_changed_for_rbac_and_xattr_err {
 		// restart pipeline if target begins to support ssl or rbac or xattr
@@ -0,0 +1,96 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package pipeline_svc
+
+import (
+	"errors"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/parts"
+	"github.com/couchbase/goxdcr/pipeline_manager"
+)
+
+var ErrorPipelineNotRunning = errors.New("Replication is not running on this node")
+
+// replication progress of a source vbucket
+type VBProgress struct {
+	VBucket uint16 `json:"vbucket"`
+	// high seqno of source vbucket at the last stats collection
+	HighSeqno uint64 `json:"highSeqno"`
+	// seqno up to which all mutations have been processed
+	ThroughSeqno uint64 `json:"throughSeqno"`
+	// seqno and failover uuid in the last checkpoint
+	CheckpointSeqno uint64 `json:"checkpointSeqno"`
+	FailoverUUID    uint64 `json:"failoverUUID"`
+	StreamState     string `json:"streamState"`
+	// number of mutations between through seqno and high seqno
+	Lag uint64 `json:"lag"`
+}
+
+// GetVBProgressForPipeline returns the progress of the source vbuckets that the replication manages on the current node,
+// sorted by vbucket number. It fails with ErrorPipelineNotRunning if the replication is not running on the current node
+func GetVBProgressForPipeline(topic string) ([]*VBProgress, error) {
+	repl_status, _ := pipeline_manager.ReplicationStatus(topic)
+	if repl_status == nil {
+		return nil, ErrorPipelineNotRunning
+	}
+	pipeline := repl_status.Pipeline()
+	if pipeline == nil || pipeline.RuntimeContext() == nil {
+		return nil, ErrorPipelineNotRunning
+	}
+
+	stats_mgr, ok := pipeline.RuntimeContext().Service(base.STATISTICS_MGR_SVC).(*StatisticsManager)
+	if !ok {
+		return nil, ErrorPipelineNotRunning
+	}
+	ckmgr, _ := pipeline.RuntimeContext().Service(base.CHECKPOINT_MGR_SVC).(*CheckpointManager)
+
+	highseqno_map := stats_mgr.getHighSeqnos()
+	through_seqno_map := stats_mgr.through_seqno_tracker_svc.GetThroughSeqnos()
+
+	// vb -> dcp nozzle that owns the vb
+	dcp_map := make(map[uint16]*parts.DcpNozzle)
+	vbnos := make([]uint16, 0)
+	for _, source := range pipeline.Sources() {
+		dcp, ok := source.(*parts.DcpNozzle)
+		if !ok {
+			continue
+		}
+		for _, vbno := range dcp.GetVBList() {
+			dcp_map[vbno] = dcp
+			vbnos = append(vbnos, vbno)
+		}
+	}
+
+	progress_list := make([]*VBProgress, 0, len(vbnos))
+	for _, vbno := range base.SortUint16List(vbnos) {
+		progress := newVBProgress(vbno, highseqno_map[vbno], through_seqno_map[vbno])
+		if state, err := dcp_map[vbno].GetStreamState(vbno); err == nil {
+			progress.StreamState = state.String()
+		}
+		if ckmgr != nil {
+			progress.CheckpointSeqno, progress.FailoverUUID, _ = ckmgr.GetCheckpointedSeqnoAndFailoverUUID(vbno)
+		}
+		progress_list = append(progress_list, progress)
+	}
+	return progress_list, nil
+}
+
+// lag is 0 when through seqno has caught up with, or has passed, the high seqno retrieved at the last stats collection
+func newVBProgress(vbno uint16, highSeqno, throughSeqno uint64) *VBProgress {
+	progress := &VBProgress{
+		VBucket:      vbno,
+		HighSeqno:    highSeqno,
+		ThroughSeqno: throughSeqno,
+	}
+	if highSeqno > throughSeqno {
+		progress.Lag = highSeqno - throughSeqno
+	}
+	return progress
+}
@@ -0,0 +1,37 @@
+// +build !pcre
+
+package pipeline_svc
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewVBProgress(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestNewVBProgress =================")
+
+	testCases := []struct {
+		name         string
+		highSeqno    uint64
+		throughSeqno uint64
+		lag          uint64
+	}{
+		{"not started", 100, 0, 100},
+		{"behind", 100, 40, 60},
+		{"caught up", 100, 100, 0},
+		{"high seqno not retrieved yet", 0, 0, 0},
+		// high seqno is retrieved periodically and can be older than through seqno
+		{"through seqno ahead of stale high seqno", 100, 120, 0},
+	}
+
+	for i, testCase := range testCases {
+		progress := newVBProgress(uint16(i), testCase.highSeqno, testCase.throughSeqno)
+		assert.Equal(uint16(i), progress.VBucket, testCase.name)
+		assert.Equal(testCase.highSeqno, progress.HighSeqno, testCase.name)
+		assert.Equal(testCase.throughSeqno, progress.ThroughSeqno, testCase.name)
+		assert.Equal(testCase.lag, progress.Lag, testCase.name)
+	}
+	fmt.Println("============== Test case end: TestNewVBProgress =================")
+}
@@ -21,6 +21,8 @@ import (
 	"github.com/couchbase/goxdcr/gen_server"
 	"github.com/couchbase/goxdcr/log"
 	"github.com/couchbase/goxdcr/metadata"
+	"github.com/couchbase/goxdcr/parts"
+	"github.com/couchbase/goxdcr/pipeline_svc"
 	"github.com/couchbase/goxdcr/service_def"
 	utilities "github.com/couchbase/goxdcr/utils"
 	"net/http"
@@ -32,8 +34,8 @@ import (
 
 import _ "net/http/pprof"
 
-var StaticPaths = []string{base.RemoteClustersPath, CreateReplicationPath, SettingsReplicationsPath, AllReplicationsPath, AllReplicationInfosPath, RegexpValidationPrefix, MemStatsPath, BlockProfileStartPath, BlockProfileStopPath, XDCRInternalSettingsPath}
-var DynamicPathPrefixes = []string{base.RemoteClustersPath, DeleteReplicationPrefix, SettingsReplicationsPath, StatisticsPrefix, AllReplicationsPath, BucketSettingsPrefix}
+var StaticPaths = []string{base.RemoteClustersPath, CreateReplicationPath, SettingsReplicationsPath, AllReplicationsPath, AllReplicationInfosPath, RegexpValidationPrefix, MemStatsPath, BlockProfileStartPath, BlockProfileStopPath, XDCRInternalSettingsPath, PrometheusMetricsPath, FilterEvaluationPath, TopologyExportPath, TopologyImportPath, HealthPath, WebhooksPath, CheckpointsMigrationPath}
+var DynamicPathPrefixes = []string{base.RemoteClustersPath, DeleteReplicationPrefix, SettingsReplicationsPath, StatisticsPrefix, AllReplicationsPath, BucketSettingsPrefix, ConflictLogsPrefix, PauseReplicationPrefix, ResumeReplicationPrefix, VBProgressPrefix, CheckpointsPrefix, RewindCheckpointsPrefix, WebhooksPath, DiffJobsPrefix, DiffResultsPrefix, RepairJobsPrefix}
 
 var logger_ap *log.CommonLogger = log.NewLogger("AdminPort", log.DefaultLoggerContext)
 
@@ -189,8 +191,24 @@ func (adminport *Adminport) handleRequest(
 		response, err = adminport.doGetStatisticsRequest(request)
 	case RegexpValidationPrefix + base.UrlDelimiter + base.MethodPost:
 		response, err = adminport.doRegexpValidationRequest(request)
+	case FilterEvaluationPath + base.UrlDelimiter + base.MethodPost:
+		response, err = adminport.doFilterEvaluationRequest(request)
+	case TopologyExportPath + base.UrlDelimiter + base.MethodPost:
+		response, err = adminport.doTopologyExportRequest(request)
+	case TopologyImportPath + base.UrlDelimiter + base.MethodPost:
+		response, err = adminport.doTopologyImportRequest(request)
+	case HealthPath + base.UrlDelimiter + base.MethodGet:
+		response, err = adminport.doGetReplicationHealthRequest(request)
+	case WebhooksPath + base.UrlDelimiter + base.MethodGet:
+		response, err = adminport.doGetWebhooksRequest(request)
+	case WebhooksPath + base.UrlDelimiter + base.MethodPost:
+		response, err = adminport.doCreateWebhookRequest(request)
+	case WebhooksPath + DynamicSuffix + base.UrlDelimiter + base.MethodDelete:
+		response, err = adminport.doDeleteWebhookRequest(request)
 	case MemStatsPath + base.UrlDelimiter + base.MethodGet:
 		response, err = adminport.doMemStatsRequest(request)
+	case PrometheusMetricsPath + base.UrlDelimiter + base.MethodGet:
+		response, err = adminport.doGetPrometheusMetricsRequest(request)
 	case BlockProfileStartPath + base.UrlDelimiter + base.MethodPost:
 		response, err = adminport.doStartBlockProfile(request)
 	case BlockProfileStopPath + base.UrlDelimiter + base.MethodPost:
@@ -203,6 +221,36 @@ func (adminport *Adminport) handleRequest(
 		response, err = adminport.doViewXDCRInternalSettingsRequest(request)
 	case XDCRInternalSettingsPath + base.UrlDelimiter + base.MethodPost:
 		response, err = adminport.doChangeXDCRInternalSettingsRequest(request)
+	case ConflictLogsPrefix + DynamicSuffix + base.UrlDelimiter + base.MethodGet:
+		response, err = adminport.doGetConflictLogsRequest(request)
+	case VBProgressPrefix + DynamicSuffix + base.UrlDelimiter + base.MethodGet:
+		response, err = adminport.doGetVBProgressRequest(request)
+	case CheckpointsPrefix + DynamicSuffix + base.UrlDelimiter + base.MethodGet:
+		response, err = adminport.doGetCheckpointsRequest(request)
+	case CheckpointsPrefix + DynamicSuffix + base.UrlDelimiter + base.MethodDelete:
+		response, err = adminport.doRewindCheckpointsRequest(request, false /*isRewind*/)
+	case RewindCheckpointsPrefix + DynamicSuffix + base.UrlDelimiter + base.MethodPost:
+		response, err = adminport.doRewindCheckpointsRequest(request, true /*isRewind*/)
+	case CheckpointsMigrationPath + base.UrlDelimiter + base.MethodPost:
+		response, err = adminport.doCheckpointsMigrationRequest(request)
+	case DiffJobsPrefix + DynamicSuffix + base.UrlDelimiter + base.MethodPost:
+		response, err = adminport.doStartDiffRequest(request)
+	case DiffJobsPrefix + DynamicSuffix + base.UrlDelimiter + base.MethodGet:
+		response, err = adminport.doGetDiffStatusRequest(request)
+	case DiffJobsPrefix + DynamicSuffix + base.UrlDelimiter + base.MethodDelete:
+		response, err = adminport.doCancelDiffRequest(request)
+	case DiffResultsPrefix + DynamicSuffix + base.UrlDelimiter + base.MethodGet:
+		response, err = adminport.doGetDiffResultsRequest(request)
+	case RepairJobsPrefix + DynamicSuffix + base.UrlDelimiter + base.MethodPost:
+		response, err = adminport.doStartRepairRequest(request)
+	case RepairJobsPrefix + DynamicSuffix + base.UrlDelimiter + base.MethodGet:
+		response, err = adminport.doGetRepairResultsRequest(request)
+	case RepairJobsPrefix + DynamicSuffix + base.UrlDelimiter + base.MethodDelete:
+		response, err = adminport.doCancelRepairRequest(request)
+	case PauseReplicationPrefix + DynamicSuffix + base.UrlDelimiter + base.MethodPost:
+		response, err = adminport.doPauseResumeReplicationRequest(request, true /*isPause*/)
+	case ResumeReplicationPrefix + DynamicSuffix + base.UrlDelimiter + base.MethodPost:
+		response, err = adminport.doPauseResumeReplicationRequest(request, false /*isPause*/)
 	default:
 		err = ap.ErrorInvalidRequest
 	}
@@ -595,6 +643,190 @@ func (adminport *Adminport) doChangeReplicationSettingsRequest(request *http.Req
 	return NewReplicationSettingsResponse(replSpec.Settings)
 }
 
+// get progress of the vbuckets that the replication manages on the current node
+func (adminport *Adminport) doGetVBProgressRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Infof("doGetVBProgressRequest\n")
+
+	replicationId, err := DecodeDynamicParamInURL(request, VBProgressPrefix, "Replication Id")
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	logger_ap.Infof("Request params: replicationId=%v\n", replicationId)
+
+	response, err := authWebCredsForReplication(request, replicationId, []string{base.PermissionBucketXDCRReadSuffix})
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	_, err = ReplicationSpecService().ReplicationSpec(replicationId)
+	if err != nil {
+		return EncodeReplicationSpecErrorIntoResponse(err)
+	}
+
+	progress, err := pipeline_svc.GetVBProgressForPipeline(replicationId)
+	if err == pipeline_svc.ErrorPipelineNotRunning {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return EncodeObjectIntoResponse(progress)
+}
+
+// get checkpoints of replication, for all vbuckets or for the specified vbuckets
+func (adminport *Adminport) doGetCheckpointsRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Infof("doGetCheckpointsRequest\n")
+
+	replicationId, err := DecodeDynamicParamInURL(request, CheckpointsPrefix, "Replication Id")
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	logger_ap.Infof("Request params: replicationId=%v\n", replicationId)
+
+	response, err := authWebCredsForReplication(request, replicationId, []string{base.PermissionBucketXDCRReadSuffix})
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	vbnos, _, err := DecodeCheckpointsRequest(request, false /*vbucketsRequired*/, false /*isRewind*/)
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	_, err = ReplicationSpecService().ReplicationSpec(replicationId)
+	if err != nil {
+		return EncodeReplicationSpecErrorIntoResponse(err)
+	}
+
+	ckptDocs, err := GetCheckpoints(replicationId, vbnos)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewCheckpointsResponse(ckptDocs)
+}
+
+// delete checkpoints of the specified vbuckets, or rewind them to the specified seqno when isRewind is true,
+// and restart replication so that these vbuckets are re-streamed
+func (adminport *Adminport) doRewindCheckpointsRequest(request *http.Request, isRewind bool) (*ap.Response, error) {
+	logger_ap.Infof("doRewindCheckpointsRequest isRewind=%v\n", isRewind)
+	defer logger_ap.Infof("Finished doRewindCheckpointsRequest\n")
+
+	pathPrefix := CheckpointsPrefix
+	if isRewind {
+		pathPrefix = RewindCheckpointsPrefix
+	}
+	replicationId, err := DecodeDynamicParamInURL(request, pathPrefix, "Replication Id")
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	logger_ap.Infof("Request params: replicationId=%v\n", replicationId)
+
+	// restarts replication, same as changing settings that require restream
+	response, err := authWebCredsForReplication(request, replicationId, []string{base.PermissionBucketXDCRWriteSuffix})
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	vbnos, seqno, err := DecodeCheckpointsRequest(request, true /*vbucketsRequired*/, isRewind)
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	logger_ap.Infof("Request params: vbuckets=%v, seqno=%v\n", vbnos, seqno)
+
+	replSpec, err := ReplicationSpecService().ReplicationSpec(replicationId)
+	if err != nil {
+		return EncodeReplicationSpecErrorIntoResponse(err)
+	}
+
+	notLocalVBs, err := VBucketsNotOnThisNode(replSpec, vbnos)
+	if err != nil {
+		return nil, err
+	}
+	if len(notLocalVBs) > 0 {
+		return EncodeReplicationValidationErrorIntoResponse(fmt.Errorf("vbuckets %v do not reside on this node. Checkpoints of a vbucket need to be modified on the node where the vbucket resides", notLocalVBs))
+	}
+
+	err = RewindCheckpoints(replicationId, vbnos, seqno)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEmptyArrayResponse()
+}
+
+// copies checkpoint docs of all replications from the previous checkpoints backend to the current one,
+// or removes them from the previous backend when cleanup is requested
+func (adminport *Adminport) doCheckpointsMigrationRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Infof("doCheckpointsMigrationRequest\n")
+	defer logger_ap.Infof("Finished doCheckpointsMigrationRequest\n")
+
+	response, err := authWebCreds(request, base.PermissionXDCRInternalWrite)
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	cleanup, err := DecodeCheckpointsMigrationRequest(request)
+	if err != nil {
+		return EncodeErrorMessageIntoResponse(err, http.StatusBadRequest)
+	}
+
+	logger_ap.Infof("Request params: cleanup=%v\n", cleanup)
+
+	count, err := MigrateCheckpoints(cleanup)
+	if err == service_def.ErrorNoCheckpointsFallback {
+		return EncodeErrorMessageIntoResponse(err, http.StatusBadRequest)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return NewCheckpointsMigrationResponse(count, cleanup)
+}
+
+func (adminport *Adminport) doPauseResumeReplicationRequest(request *http.Request, isPause bool) (*ap.Response, error) {
+	logger_ap.Infof("doPauseResumeReplicationRequest isPause=%v\n", isPause)
+	defer logger_ap.Infof("Finished doPauseResumeReplicationRequest\n")
+
+	pathPrefix := ResumeReplicationPrefix
+	if isPause {
+		pathPrefix = PauseReplicationPrefix
+	}
+	replicationId, err := DecodeDynamicParamInURL(request, pathPrefix, "Replication Id")
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	logger_ap.Infof("Request params: replicationId=%v\n", replicationId)
+
+	// same permission as that for changing "pauseRequested" setting
+	response, err := authWebCredsForReplication(request, replicationId, []string{base.PermissionBucketXDCRExecuteSuffix})
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	reason, resumeTime, err := DecodePauseResumeReplicationRequest(request, isPause)
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	if isPause {
+		err = PauseReplication(replicationId, reason, resumeTime, getRealUserIdFromRequest(request))
+	} else {
+		err = ResumeReplication(replicationId, reason, getRealUserIdFromRequest(request))
+	}
+	if err == ErrorReplicationNotPaused {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	} else if err != nil {
+		return EncodeReplicationSpecErrorIntoResponse(err)
+	}
+
+	return NewEmptyArrayResponse()
+}
+
 // get statistics for all running replications
 func (adminport *Adminport) doGetStatisticsRequest(request *http.Request) (*ap.Response, error) {
 	logger_ap.Debugf("doGetStatisticsRequest\n")
@@ -621,6 +853,95 @@ func (adminport *Adminport) doGetStatisticsRequest(request *http.Request) (*ap.R
 	}
 }
 
+// get statistics for all replications in prometheus text exposition format
+func (adminport *Adminport) doGetPrometheusMetricsRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Debugf("doGetPrometheusMetricsRequest\n")
+
+	response, err := authWebCreds(request, base.PermissionXDCRInternalRead)
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	return &ap.Response{StatusCode: http.StatusOK, Body: GetPrometheusMetrics(), ContentType: base.PrometheusContentType}, nil
+}
+
+func (adminport *Adminport) doGetReplicationHealthRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Debugf("doGetReplicationHealthRequest\n")
+
+	response, err := authWebCreds(request, base.PermissionXDCRInternalRead)
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	return NewReplicationHealthResponse(GetReplicationHealth())
+}
+
+func (adminport *Adminport) doGetWebhooksRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Debugf("doGetWebhooksRequest\n")
+
+	response, err := authWebCreds(request, base.PermissionXDCRSettingsRead)
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	webhooks, err := WebhookService().Webhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWebhooksResponse(webhooks)
+}
+
+func (adminport *Adminport) doCreateWebhookRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Infof("doCreateWebhookRequest\n")
+	defer logger_ap.Infof("Finished doCreateWebhookRequest\n")
+
+	response, err := authWebCreds(request, base.PermissionXDCRSettingsWrite)
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	webhook, err := DecodeCreateWebhookRequest(request)
+	if err != nil {
+		return EncodeErrorMessageIntoResponse(err, http.StatusBadRequest)
+	}
+
+	logger_ap.Infof("Request params: url=%v, eventTypes=%v\n", webhook.Url, webhook.EventTypes)
+
+	err = WebhookService().AddWebhook(webhook)
+	if err != nil {
+		return nil, err
+	}
+
+	return EncodeObjectIntoResponse(webhook)
+}
+
+func (adminport *Adminport) doDeleteWebhookRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Infof("doDeleteWebhookRequest\n")
+	defer logger_ap.Infof("Finished doDeleteWebhookRequest\n")
+
+	webhookId, err := DecodeDynamicParamInURL(request, WebhooksPath, "Webhook Id")
+	if err != nil {
+		return EncodeErrorMessageIntoResponse(err, http.StatusBadRequest)
+	}
+
+	logger_ap.Infof("Request params: webhookId=%v\n", webhookId)
+
+	response, err := authWebCreds(request, base.PermissionXDCRSettingsWrite)
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	err = WebhookService().DelWebhook(webhookId)
+	if err == service_def.MetadataNotFoundErr {
+		return EncodeErrorMessageIntoResponse(fmt.Errorf("Webhook %v does not exist", webhookId), http.StatusNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return NewEmptyArrayResponse()
+}
+
 func (adminport *Adminport) doMemStatsRequest(request *http.Request) (*ap.Response, error) {
 	logger_ap.Debugf("doMemStatsRequest\n")
 
@@ -820,6 +1141,122 @@ func (adminport *Adminport) doRegexpValidationRequest(request *http.Request) (*a
 	return NewRegexpValidationResponse(adminport.utils.FilterExpressionMatchesDoc(expression, docId, username, password, bucket, adminport.sourceKVHost, adminport.kvAdminPort))
 }
 
+// evaluates a filter expression against inline documents or documents retrieved from source bucket,
+// without creating or changing any replication
+func (adminport *Adminport) doFilterEvaluationRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Infof("doFilterEvaluationRequest\n")
+
+	response, err := authWebCreds(request, base.PermissionXDCRInternalRead)
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	expression, docs, docIds, username, password, bucket, err := DecodeFilterEvaluationRequest(request)
+	if err != nil {
+		return EncodeErrorMessageIntoResponse(err, http.StatusBadRequest)
+	}
+
+	logger_ap.Infof("Request params: expression=%v%v%v numOfDocs=%v docIds=%v%v%v username=%v%v%v password=XXX bucket=%v\n",
+		base.UdTagBegin, expression, base.UdTagEnd, len(docs),
+		base.UdTagBegin, docIds, base.UdTagEnd,
+		base.UdTagBegin, username, base.UdTagEnd,
+		bucket)
+
+	results, exprErr, err := evaluateFilterExpression(adminport.utils, expression, docs, docIds, username, password, bucket, adminport.sourceKVHost, adminport.kvAdminPort)
+	if err != nil {
+		return EncodeErrorMessageIntoResponse(err, http.StatusBadRequest)
+	}
+	return NewFilterEvaluationResponse(results, exprErr)
+}
+
+// evaluates filter expression against either the inline docs or the documents with docIds in source bucket.
+// exprErr is returned when expression cannot be parsed. err is returned when documents cannot be retrieved from source bucket
+func evaluateFilterExpression(utils utilities.UtilsIface, expression string, docs []*FilterEvaluationDoc, docIds []string,
+	username, password, bucket, addr string, port uint16) (results []*FilterEvaluationResult, exprErr error, err error) {
+	filter, exprErr := parts.NewFilter("filterEvaluation", expression, utils)
+	if exprErr != nil {
+		return
+	}
+
+	results = make([]*FilterEvaluationResult, 0, len(docs)+len(docIds))
+	evaluate := func(key string, slice []byte, docErr error) {
+		result := &FilterEvaluationResult{Key: key}
+		if docErr == nil {
+			result.Match, docErr = filter.FilterByteSlice(slice)
+		}
+		if docErr != nil {
+			result.Error = docErr.Error()
+		}
+		results = append(results, result)
+	}
+
+	if len(docIds) > 0 {
+		retrievedDocs, docErrs, err := utils.FilterExpressionGetDocs(expression, docIds, username, password, bucket, addr, port)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, docId := range docIds {
+			evaluate(docId, retrievedDocs[docId], docErrs[docId])
+		}
+	} else {
+		for _, doc := range docs {
+			slice, docErr := doc.toBeFiltered(expression)
+			evaluate(doc.Key, slice, docErr)
+		}
+	}
+	return
+}
+
+// export remote cluster references, replications and settings as a single topology document
+// POST is used so that passphrase for encrypting credentials is not part of the url
+func (adminport *Adminport) doTopologyExportRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Infof("doTopologyExportRequest\n")
+
+	response, err := authWebCreds(request, base.PermissionXDCRInternalRead)
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	credentials, passphrase, err := DecodeTopologyExportRequest(request)
+	if err != nil {
+		return EncodeErrorMessageIntoResponse(err, http.StatusBadRequest)
+	}
+
+	logger_ap.Infof("Request params: credentials=%v\n", credentials)
+
+	doc, err := ExportTopology(credentials, passphrase)
+	if err != nil {
+		return EncodeErrorMessageIntoResponse(err, http.StatusBadRequest)
+	}
+
+	return EncodeObjectIntoResponseSensitive(doc)
+}
+
+func (adminport *Adminport) doTopologyImportRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Infof("doTopologyImportRequest\n")
+	defer logger_ap.Infof("Finished doTopologyImportRequest\n")
+
+	response, err := authWebCreds(request, base.PermissionXDCRInternalWrite)
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	doc, err := DecodeTopologyImportRequest(request)
+	if err != nil {
+		return EncodeErrorMessageIntoResponse(err, http.StatusBadRequest)
+	}
+
+	logger_ap.Infof("Request params: version=%v exportTime=%v credentials=%v numOfRemoteClusters=%v numOfReplications=%v\n",
+		doc.Version, doc.ExportTime, doc.Credentials, len(doc.RemoteClusters), len(doc.Replications))
+
+	result, err := ImportTopology(doc, getRealUserIdFromRequest(request))
+	if err != nil {
+		return nil, err
+	}
+
+	return EncodeObjectIntoResponse(result)
+}
+
 func (adminport *Adminport) doStartBlockProfile(request *http.Request) (*ap.Response, error) {
 	response, err := authWebCreds(request, base.PermissionXDCRInternalWrite)
 	if response != nil || err != nil {
@@ -946,3 +1383,246 @@ func (adminport *Adminport) doChangeXDCRInternalSettingsRequest(request *http.Re
 
 	return NewXDCRInternalSettingsResponse(internalSettings)
 }
+
+// get the conflict log of a replication on the local node
+func (adminport *Adminport) doGetConflictLogsRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Infof("doGetConflictLogsRequest\n")
+
+	replicationId, err := DecodeDynamicParamInURL(request, ConflictLogsPrefix, "Replication Id")
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	logger_ap.Infof("Request params: replicationId=%v\n", replicationId)
+
+	response, err := authWebCredsForReplication(request, replicationId, []string{base.PermissionBucketXDCRReadSuffix})
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	offset, limit, err := DecodeConflictLogsRequest(request)
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	// conflict log of deleted replication is not available
+	_, err = ReplicationSpecService().ReplicationSpec(replicationId)
+	if err != nil {
+		return EncodeReplicationSpecErrorIntoResponse(err)
+	}
+
+	records, total, err := ConflictLogService().Records(replicationId, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewConflictLogsResponse(records, total, offset, limit)
+}
+
+// start a job that compares the documents in the source vbuckets on the local node with the ones in target bucket
+func (adminport *Adminport) doStartDiffRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Infof("doStartDiffRequest\n")
+	defer logger_ap.Infof("Finished doStartDiffRequest\n")
+
+	replicationId, err := DecodeDynamicParamInURL(request, DiffJobsPrefix, "Replication Id")
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	logger_ap.Infof("Request params: replicationId=%v\n", replicationId)
+
+	response, err := authWebCredsForReplication(request, replicationId, []string{base.PermissionBucketXDCRExecuteSuffix})
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	maxDocsPerSecond, err := DecodeStartDiffRequest(request)
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	spec, err := ReplicationSpecService().ReplicationSpec(replicationId)
+	if err != nil {
+		return EncodeReplicationSpecErrorIntoResponse(err)
+	}
+
+	status, err := DiffService().StartDiff(spec, maxDocsPerSecond)
+	if err == service_def.ErrorDiffJobRunning || err == service_def.ErrorDiffSinkNotSupported {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return NewDiffStatusResponse(status)
+}
+
+// get the status and progress of the latest diff job of a replication on the local node
+func (adminport *Adminport) doGetDiffStatusRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Debugf("doGetDiffStatusRequest\n")
+
+	replicationId, err := DecodeDynamicParamInURL(request, DiffJobsPrefix, "Replication Id")
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	response, err := authWebCredsForReplication(request, replicationId, []string{base.PermissionBucketXDCRReadSuffix})
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	status, err := DiffService().DiffStatus(replicationId)
+	if err == service_def.ErrorDiffJobNotFound {
+		return EncodeErrorMessageIntoResponse(err, http.StatusNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return NewDiffStatusResponse(status)
+}
+
+// cancel the running diff job of a replication on the local node
+func (adminport *Adminport) doCancelDiffRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Infof("doCancelDiffRequest\n")
+	defer logger_ap.Infof("Finished doCancelDiffRequest\n")
+
+	replicationId, err := DecodeDynamicParamInURL(request, DiffJobsPrefix, "Replication Id")
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	logger_ap.Infof("Request params: replicationId=%v\n", replicationId)
+
+	response, err := authWebCredsForReplication(request, replicationId, []string{base.PermissionBucketXDCRExecuteSuffix})
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	err = DiffService().CancelDiff(replicationId)
+	if err == service_def.ErrorDiffJobNotFound {
+		return EncodeErrorMessageIntoResponse(err, http.StatusNotFound)
+	} else if err == service_def.ErrorDiffJobNotRunning {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return NewEmptyArrayResponse()
+}
+
+// get the per vbucket summaries and the differences found by the latest diff job of a replication on the local node
+func (adminport *Adminport) doGetDiffResultsRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Infof("doGetDiffResultsRequest\n")
+
+	replicationId, err := DecodeDynamicParamInURL(request, DiffResultsPrefix, "Replication Id")
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	logger_ap.Infof("Request params: replicationId=%v\n", replicationId)
+
+	response, err := authWebCredsForReplication(request, replicationId, []string{base.PermissionBucketXDCRReadSuffix})
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	status, summaries, records, err := DiffService().DiffResults(replicationId)
+	if err == service_def.ErrorDiffJobNotFound {
+		return EncodeErrorMessageIntoResponse(err, http.StatusNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return NewDiffResultsResponse(status, summaries, records)
+}
+
+// start a job that sends the current source versions of the specified documents, or of the documents found different
+// by the latest diff job, to target. only documents in the source vbuckets on the local node are repaired
+func (adminport *Adminport) doStartRepairRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Infof("doStartRepairRequest\n")
+	defer logger_ap.Infof("Finished doStartRepairRequest\n")
+
+	replicationId, err := DecodeDynamicParamInURL(request, RepairJobsPrefix, "Replication Id")
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	response, err := authWebCredsForReplication(request, replicationId, []string{base.PermissionBucketXDCRExecuteSuffix})
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	keys, fromDiffResults, err := DecodeStartRepairRequest(request)
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	logger_ap.Infof("Request params: replicationId=%v numOfKeys=%v fromDiffResults=%v\n", replicationId, len(keys), fromDiffResults)
+
+	spec, err := ReplicationSpecService().ReplicationSpec(replicationId)
+	if err != nil {
+		return EncodeReplicationSpecErrorIntoResponse(err)
+	}
+
+	status, err := DiffService().StartRepair(spec, keys, fromDiffResults)
+	if err == service_def.ErrorDiffJobNotFound {
+		return EncodeErrorMessageIntoResponse(err, http.StatusNotFound)
+	} else if err != nil {
+		// the other errors are caused by invalid input or by a running job
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	return NewRepairStatusResponse(status)
+}
+
+// get the status of the latest repair job of a replication on the local node, and the outcomes of the documents processed so far
+func (adminport *Adminport) doGetRepairResultsRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Debugf("doGetRepairResultsRequest\n")
+
+	replicationId, err := DecodeDynamicParamInURL(request, RepairJobsPrefix, "Replication Id")
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	response, err := authWebCredsForReplication(request, replicationId, []string{base.PermissionBucketXDCRReadSuffix})
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	status, records, err := DiffService().RepairResults(replicationId)
+	if err == service_def.ErrorRepairJobNotFound {
+		return EncodeErrorMessageIntoResponse(err, http.StatusNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return NewRepairResultsResponse(status, records)
+}
+
+// cancel the running repair job of a replication on the local node
+func (adminport *Adminport) doCancelRepairRequest(request *http.Request) (*ap.Response, error) {
+	logger_ap.Infof("doCancelRepairRequest\n")
+	defer logger_ap.Infof("Finished doCancelRepairRequest\n")
+
+	replicationId, err := DecodeDynamicParamInURL(request, RepairJobsPrefix, "Replication Id")
+	if err != nil {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	}
+
+	logger_ap.Infof("Request params: replicationId=%v\n", replicationId)
+
+	response, err := authWebCredsForReplication(request, replicationId, []string{base.PermissionBucketXDCRExecuteSuffix})
+	if response != nil || err != nil {
+		return response, err
+	}
+
+	err = DiffService().CancelRepair(replicationId)
+	if err == service_def.ErrorRepairJobNotFound {
+		return EncodeErrorMessageIntoResponse(err, http.StatusNotFound)
+	} else if err == service_def.ErrorRepairJobNotRunning {
+		return EncodeReplicationValidationErrorIntoResponse(err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return NewEmptyArrayResponse()
+}
@@ -0,0 +1,267 @@
+// +build !pcre
+
+package replication_manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/metadata"
+	utilsMock "github.com/couchbase/goxdcr/utils/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFilterEvaluationRequest(values url.Values) *http.Request {
+	request, _ := http.NewRequest(base.MethodPost, "/"+FilterEvaluationPath, strings.NewReader(values.Encode()))
+	request.Header.Set(base.ContentType, base.DefaultContentType)
+	return request
+}
+
+func TestDecodeFilterEvaluationRequest(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestDecodeFilterEvaluationRequest =================")
+
+	// inline documents
+	values := url.Values{}
+	values.Set(Expression, `city = "London"`)
+	values.Set(FilterEvalDocuments, `[{"key":"doc1","doc":{"city":"London"}},{"key":"doc2","doc":{"city":"Paris"},"xattrs":{"x":1}}]`)
+	expression, docs, docIds, _, _, _, err := DecodeFilterEvaluationRequest(newFilterEvaluationRequest(values))
+	assert.Nil(err)
+	assert.Equal(`city = "London"`, expression)
+	assert.Equal(2, len(docs))
+	assert.Equal("doc1", docs[0].Key)
+	assert.Equal(0, len(docIds))
+
+	// documents from source bucket
+	values = url.Values{}
+	values.Set(Expression, `city = "London"`)
+	values.Set(FilterEvalDocIds, `["doc1","doc2"]`)
+	values.Set(UserName, "user")
+	values.Set(Password, "password")
+	values.Set(Bucket, "bucket")
+	_, docs, docIds, username, password, bucket, err := DecodeFilterEvaluationRequest(newFilterEvaluationRequest(values))
+	assert.Nil(err)
+	assert.Equal(0, len(docs))
+	assert.Equal([]string{"doc1", "doc2"}, docIds)
+	assert.Equal("user", username)
+	assert.Equal("password", password)
+	assert.Equal("bucket", bucket)
+
+	// docIds at the cap are accepted
+	maxDocIds := make([]string, base.MaxFilterEvaluationDocIds)
+	for i := range maxDocIds {
+		maxDocIds[i] = fmt.Sprintf("doc%v", i)
+	}
+	maxDocIdsJson, _ := json.Marshal(maxDocIds)
+	values.Set(FilterEvalDocIds, string(maxDocIdsJson))
+	_, _, docIds, _, _, _, err = DecodeFilterEvaluationRequest(newFilterEvaluationRequest(values))
+	assert.Nil(err)
+	assert.Equal(base.MaxFilterEvaluationDocIds, len(docIds))
+	tooManyDocIdsJson, _ := json.Marshal(append(maxDocIds, "oneTooMany"))
+	tooManyDocIds := string(tooManyDocIdsJson)
+
+	invalidRequests := []url.Values{
+		// missing expression
+		{FilterEvalDocIds: {`["doc1"]`}, UserName: {"user"}, Password: {"password"}, Bucket: {"bucket"}},
+		// neither documents nor docIds
+		{Expression: {`city = "London"`}},
+		// both documents and docIds
+		{Expression: {`city = "London"`}, FilterEvalDocuments: {`[{"key":"doc1","doc":{}}]`}, FilterEvalDocIds: {`["doc1"]`}},
+		// docIds without credentials
+		{Expression: {`city = "London"`}, FilterEvalDocIds: {`["doc1"]`}, Bucket: {"bucket"}},
+		// docIds without bucket
+		{Expression: {`city = "London"`}, FilterEvalDocIds: {`["doc1"]`}, UserName: {"user"}, Password: {"password"}},
+		// documents not a json array
+		{Expression: {`city = "London"`}, FilterEvalDocuments: {`{"key":"doc1"}`}},
+		// docIds not a json array
+		{Expression: {`city = "London"`}, FilterEvalDocIds: {`doc1`}, UserName: {"user"}, Password: {"password"}, Bucket: {"bucket"}},
+		// too many docIds
+		{Expression: {`city = "London"`}, FilterEvalDocIds: {tooManyDocIds}, UserName: {"user"}, Password: {"password"}, Bucket: {"bucket"}},
+	}
+	for _, values := range invalidRequests {
+		_, _, _, _, _, _, err = DecodeFilterEvaluationRequest(newFilterEvaluationRequest(values))
+		assert.NotNil(err, values.Encode())
+	}
+
+	fmt.Println("============== Test case end: TestDecodeFilterEvaluationRequest =================")
+}
+
+func TestEvaluateFilterExpressionInlineDocs(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestEvaluateFilterExpressionInlineDocs =================")
+
+	utils := &utilsMock.UtilsIface{}
+	docs := []*FilterEvaluationDoc{
+		{Key: "doc1", Doc: []byte(`{"city":"London"}`)},
+		{Key: "doc2", Doc: []byte(`{"city":"Paris"}`)},
+		{Key: "doc3", Doc: []byte(`"notAnObject"`)},
+	}
+
+	results, exprErr, err := evaluateFilterExpression(utils, `city = "London"`, docs, nil, "", "", "", "localhost", 11210)
+	assert.Nil(err)
+	assert.Nil(exprErr)
+	assert.Equal(3, len(results))
+	assert.Equal("doc1", results[0].Key)
+	assert.True(results[0].Match)
+	assert.Equal("", results[0].Error)
+	assert.Equal("doc2", results[1].Key)
+	assert.False(results[1].Match)
+	assert.Equal("", results[1].Error)
+	assert.Equal("doc3", results[2].Key)
+	assert.False(results[2].Match)
+	assert.NotEqual("", results[2].Error)
+
+	// key is added to doc body when expression references it
+	results, exprErr, err = evaluateFilterExpression(utils, `REGEXP_CONTAINS(META().id, "^doc1$")`, docs[:2], nil, "", "", "", "localhost", 11210)
+	assert.Nil(err)
+	assert.Nil(exprErr)
+	assert.Equal(2, len(results))
+	assert.True(results[0].Match)
+	assert.False(results[1].Match)
+
+	// source bucket is not contacted for inline documents
+	utils.AssertNotCalled(t, "FilterExpressionGetDocs", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	fmt.Println("============== Test case end: TestEvaluateFilterExpressionInlineDocs =================")
+}
+
+func TestEvaluateFilterExpressionDocIds(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestEvaluateFilterExpressionDocIds =================")
+
+	expression := `city = "London"`
+	docIds := []string{"doc1", "doc2", "doc3"}
+	retrievedDocs := map[string][]byte{
+		"doc1": []byte(`{"city":"London"}`),
+		"doc2": []byte(`{"city":"Paris"}`),
+	}
+	docErrs := map[string]error{
+		"doc3": fmt.Errorf("document not found"),
+	}
+
+	utils := &utilsMock.UtilsIface{}
+	utils.On("FilterExpressionGetDocs", expression, docIds, "user", "password", "bucket", "localhost", uint16(11210)).Return(retrievedDocs, docErrs, nil)
+
+	results, exprErr, err := evaluateFilterExpression(utils, expression, nil, docIds, "user", "password", "bucket", "localhost", 11210)
+	assert.Nil(err)
+	assert.Nil(exprErr)
+	assert.Equal(3, len(results))
+	// results are in the order of docIds
+	assert.Equal("doc1", results[0].Key)
+	assert.True(results[0].Match)
+	assert.Equal("doc2", results[1].Key)
+	assert.False(results[1].Match)
+	assert.Equal("doc3", results[2].Key)
+	assert.False(results[2].Match)
+	assert.Equal("document not found", results[2].Error)
+
+	// failure to open bucket is returned as an error for the whole request
+	utils = &utilsMock.UtilsIface{}
+	utils.On("FilterExpressionGetDocs", expression, docIds, "user", "wrongPassword", "bucket", "localhost", uint16(11210)).Return(nil, nil, fmt.Errorf("authentication failure"))
+	results, exprErr, err = evaluateFilterExpression(utils, expression, nil, docIds, "user", "wrongPassword", "bucket", "localhost", 11210)
+	assert.NotNil(err)
+	assert.Nil(exprErr)
+	assert.Nil(results)
+
+	// invalid expression is reported without retrieving any document
+	utils = &utilsMock.UtilsIface{}
+	results, exprErr, err = evaluateFilterExpression(utils, `city = = "London"`, nil, docIds, "user", "password", "bucket", "localhost", 11210)
+	assert.Nil(err)
+	assert.NotNil(exprErr)
+	assert.Nil(results)
+	utils.AssertNotCalled(t, "FilterExpressionGetDocs", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	fmt.Println("============== Test case end: TestEvaluateFilterExpressionDocIds =================")
+}
+
+func TestProcessKeyConflictResolver(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestProcessKeyConflictResolver =================")
+
+	testCases := []struct {
+		name      string
+		value     string
+		isCapi    bool
+		expectErr bool
+	}{
+		{"registered resolver", base.ConflictResolverSourceWins, false, false},
+		{"default resolver", base.ConflictResolverDefault, false, false},
+		{"unregistered resolver", "bogus", false, true},
+		{"custom resolver for capi", base.ConflictResolverTargetWins, true, true},
+	}
+
+	// settings updates go through processKey, and are not always validated by ReplicationSpecService afterwards
+	for _, testCase := range testCases {
+		settings := make(metadata.ReplicationSettingsMap)
+		err := processKey(base.ConflictResolverREST, []string{testCase.value}, &settings, false /*isDefaultSettings*/, true /*isUpdate*/, true /*isEnterprise*/, testCase.isCapi)
+		if testCase.expectErr {
+			assert.NotNil(err, testCase.name)
+			assert.Equal(0, len(settings), testCase.name)
+		} else {
+			assert.Nil(err, testCase.name)
+			assert.Equal(testCase.value, settings[metadata.ConflictResolverKey], testCase.name)
+		}
+	}
+
+	fmt.Println("============== Test case end: TestProcessKeyConflictResolver =================")
+}
+
+func TestDecodePauseResumeReplicationRequest(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestDecodePauseResumeReplicationRequest =================")
+
+	futureTime := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	testCases := []struct {
+		name              string
+		values            url.Values
+		isPause           bool
+		expectErr         bool
+		expectedReason    string
+		expectResumeTime  bool
+		expectedResumeAt  time.Time
+		minResumeDuration time.Duration
+	}{
+		{"pause without schedule", url.Values{PauseReason: {"maintenance"}}, true, false, "maintenance", false, time.Time{}, 0},
+		{"resume with reason", url.Values{PauseReason: {"done"}}, false, false, "done", false, time.Time{}, 0},
+		{"pause with resume timestamp", url.Values{ResumeAt: {futureTime.Format(time.RFC3339)}}, true, false, "", true, futureTime, 0},
+		{"pause with resume duration", url.Values{ResumeAfter: {"90m"}}, true, false, "", true, time.Time{}, 90 * time.Minute},
+		{"empty resume timestamp", url.Values{ResumeAt: {""}}, true, false, "", false, time.Time{}, 0},
+		{"bad timestamp", url.Values{ResumeAt: {"tomorrow"}}, true, true, "", false, time.Time{}, 0},
+		{"past timestamp", url.Values{ResumeAt: {"2001-01-01T00:00:00Z"}}, true, true, "", false, time.Time{}, 0},
+		{"bad duration", url.Values{ResumeAfter: {"90 minutes"}}, true, true, "", false, time.Time{}, 0},
+		{"negative duration", url.Values{ResumeAfter: {"-1h"}}, true, true, "", false, time.Time{}, 0},
+		{"both timestamp and duration", url.Values{ResumeAt: {futureTime.Format(time.RFC3339)}, ResumeAfter: {"1h"}}, true, true, "", false, time.Time{}, 0},
+		{"schedule on resume", url.Values{ResumeAfter: {"1h"}}, false, true, "", false, time.Time{}, 0},
+	}
+
+	for _, testCase := range testCases {
+		request, _ := http.NewRequest(base.MethodPost, "/"+PauseReplicationPrefix, strings.NewReader(testCase.values.Encode()))
+		request.Header.Set(base.ContentType, base.DefaultContentType)
+
+		before := time.Now()
+		reason, resumeTime, err := DecodePauseResumeReplicationRequest(request, testCase.isPause)
+		if testCase.expectErr {
+			assert.NotNil(err, testCase.name)
+			continue
+		}
+		assert.Nil(err, testCase.name)
+		assert.Equal(testCase.expectedReason, reason, testCase.name)
+		if !testCase.expectResumeTime {
+			assert.True(resumeTime.IsZero(), testCase.name)
+		} else if testCase.minResumeDuration > 0 {
+			assert.False(resumeTime.Before(before.Add(testCase.minResumeDuration)), testCase.name)
+			assert.False(resumeTime.After(time.Now().Add(testCase.minResumeDuration)), testCase.name)
+		} else {
+			assert.True(testCase.expectedResumeAt.Equal(resumeTime), testCase.name)
+		}
+	}
+
+	fmt.Println("============== Test case end: TestDecodePauseResumeReplicationRequest =================")
+}
@@ -33,6 +33,16 @@ import (
 var SetTimeSyncRetryInterval = 10 * time.Second
 var BucketSettingsChanSize = 100
 
+// observer of metadata changes for metadata services that are not backed by metakv
+// metakv is observed when it is nil
+var metadataChangeObserver service_def.MetadataChangeObserver
+
+// SetMetadataChangeObserver needs to be called before replication manager is started
+// when metadata is not stored in metakv
+func SetMetadataChangeObserver(observer service_def.MetadataChangeObserver) {
+	metadataChangeObserver = observer
+}
+
 // generic listener for metadata stored in metakv
 type MetakvChangeListener struct {
 	id                         string
@@ -77,7 +87,12 @@ func (mcl *MetakvChangeListener) Start() error {
 
 func (mcl *MetakvChangeListener) observeChildren() {
 	defer mcl.children_waitgrp.Done()
-	err := metakv.RunObserveChildren(mcl.dirpath, mcl.metakvCallback, mcl.cancel_chan)
+	var err error
+	if metadataChangeObserver != nil {
+		err = metadataChangeObserver.ObserveChildren(mcl.dirpath, mcl.metakvCallback, mcl.cancel_chan)
+	} else {
+		err = metakv.RunObserveChildren(mcl.dirpath, mcl.metakvCallback, mcl.cancel_chan)
+	}
 	// call failure call back only when there are real errors
 	// err may be nil when observeChildren is canceled, in which case there is no need to call failure call back
 	mcl.failureCallback(err)
@@ -179,6 +194,8 @@ func (rscl *ReplicationSpecChangeListener) replicationSpecChangeHandlerCallback(
 		err = replication_mgr.pipelineMgr.DeletePipeline(topic)
 		if err == nil {
 			go replication_mgr.resourceMgr.HandlePipelineDeletion(topic)
+			// conflict log is kept on each node and needs to be removed on each node
+			rscl.removeConflictLog(topic)
 		}
 		return err
 	}
@@ -248,6 +265,14 @@ func (rscl *ReplicationSpecChangeListener) validateReplicationSpec(specObj inter
 	return spec, nil
 }
 
+func (rscl *ReplicationSpecChangeListener) removeConflictLog(topic string) {
+	err := ConflictLogService().DelLog(topic)
+	if err != nil {
+		// failure to remove conflict log does not affect replication deletion
+		rscl.logger.Warnf("Error removing conflict log for replication %v. err=%v\n", topic, err)
+	}
+}
+
 // whether there are critical changes to the replication spec that require pipeline reconstruction
 func needToReconstructPipeline(oldSettings *metadata.ReplicationSettings, newSettings *metadata.ReplicationSettings) bool {
 
@@ -257,6 +282,14 @@ func needToReconstructPipeline(oldSettings *metadata.ReplicationSettings, newSet
 	targetNozzlePerNodeChanged := !(oldSettings.TargetNozzlePerNode == newSettings.TargetNozzlePerNode)
 	compressionTypeChanged := base.GetCompressionType(oldSettings.CompressionType) != base.GetCompressionType(newSettings.CompressionType)
 	filterChanged := !(oldSettings.FilterExpression == newSettings.FilterExpression)
+	conflictResolverChanged := oldSettings.GetConflictResolver() != newSettings.GetConflictResolver()
+	transformationRulesChanged := oldSettings.GetTransformationRules() != newSettings.GetTransformationRules()
+	// bounded replication that has completed needs to be stopped
+	boundedCompletedChanged := oldSettings.IsBoundedCompleted() != newSettings.IsBoundedCompleted()
+	// connection pool size depends on the number of connections per target nozzle
+	connectionsPerTargetNozzleChanged := oldSettings.GetConnectionsPerTargetNozzle() != newSettings.GetConnectionsPerTargetNozzle()
+	// sinks connect with sink settings when they are constructed
+	sinkSettingsChanged := oldSettings.GetSinkSettings() != newSettings.GetSinkSettings()
 
 	// the following may qualify for live update in the future.
 	// batchCount is tricky since the sizes of xmem data channels depend on it.
@@ -265,7 +298,8 @@ func needToReconstructPipeline(oldSettings *metadata.ReplicationSettings, newSet
 	batchSizeChanged := (oldSettings.BatchSize != newSettings.BatchSize)
 
 	return repTypeChanged || sourceNozzlePerNodeChanged || targetNozzlePerNodeChanged ||
-		batchCountChanged || batchSizeChanged || compressionTypeChanged || filterChanged
+		batchCountChanged || batchSizeChanged || compressionTypeChanged || filterChanged || conflictResolverChanged ||
+		transformationRulesChanged || boundedCompletedChanged || connectionsPerTargetNozzleChanged || sinkSettingsChanged
 }
 
 func needToRestreamPipeline(oldSettings *metadata.ReplicationSettings, newSettings *metadata.ReplicationSettings) bool {
@@ -286,8 +320,13 @@ func (rscl *ReplicationSpecChangeListener) liveUpdatePipeline(topic string, oldS
 		oldSettings.StatsInterval != newSettings.StatsInterval ||
 		oldSettings.OptimisticReplicationThreshold != newSettings.OptimisticReplicationThreshold ||
 		oldSettings.BandwidthLimit != newSettings.BandwidthLimit ||
+		oldSettings.GetBandwidthProfile() != newSettings.GetBandwidthProfile() ||
+		oldSettings.GetScheduleTimezone() != newSettings.GetScheduleTimezone() ||
 		isOldReplHighPriority != isNewReplHighPriority ||
-		oldSettings.GetExpDelMode() != newSettings.GetExpDelMode() {
+		oldSettings.GetExpDelMode() != newSettings.GetExpDelMode() ||
+		oldSettings.GetFilterDelExpFallback() != newSettings.GetFilterDelExpFallback() ||
+		oldSettings.GetConflictLogging() != newSettings.GetConflictLogging() ||
+		oldSettings.GetTargetBatchLatency() != newSettings.GetTargetBatchLatency() {
 
 		newSettingsMap := newSettings.ToMap(false /*isDefaultSettings*/)
 
@@ -600,6 +639,28 @@ func (iscl *InternalSettingsChangeListener) internalSettingsChangeHandlerCallbac
 	return nil
 }
 
+// listener for webhook changes. webhook service reloads webhooks when they are changed
+type WebhookChangeListener struct {
+	*MetakvChangeListener
+}
+
+func NewWebhookChangeListener(webhook_svc service_def.WebhookSvc,
+	cancel_chan chan struct{},
+	children_waitgrp *sync.WaitGroup,
+	logger_ctx *log.LoggerContext,
+	utilsIn utilities.UtilsIface) *WebhookChangeListener {
+	return &WebhookChangeListener{
+		NewMetakvChangeListener(base.WebhookChangeListener,
+			metadata_svc.GetCatalogPathFromCatalogKey(metadata_svc.WebhooksCatalogKey),
+			cancel_chan,
+			children_waitgrp,
+			webhook_svc.WebhookServiceCallback,
+			logger_ctx,
+			"WebhookChangeListener",
+			utilsIn),
+	}
+}
+
 //Bucket settings listeners
 
 type BucketSettingsChangeListener struct {
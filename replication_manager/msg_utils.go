@@ -12,15 +12,21 @@ package replication_manager
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	ap "github.com/couchbase/goxdcr/adminport"
 	"github.com/couchbase/goxdcr/base"
 	"github.com/couchbase/goxdcr/log"
 	"github.com/couchbase/goxdcr/metadata"
+	"github.com/couchbase/goxdcr/pipeline"
+	"github.com/couchbase/goxdcr/service_def"
 	utilities "github.com/couchbase/goxdcr/utils"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // xdcr prefix for internal settings keys
@@ -37,10 +43,26 @@ const (
 	DeleteReplicationPrefix  = "controller/cancelXDCR"
 	SettingsReplicationsPath = "settings/replications"
 	MemStatsPath             = "stats/mem"
+	PrometheusMetricsPath    = "metrics"
 	BlockProfileStartPath    = "profile/block/start"
 	BlockProfileStopPath     = "profile/block/stop"
 	BucketSettingsPrefix     = "controller/bucketSettings"
 	XDCRInternalSettingsPath = "xdcr/internalSettings"
+	ConflictLogsPrefix       = "xdcr/conflictLogs"
+	PauseReplicationPrefix   = "controller/pauseReplication"
+	ResumeReplicationPrefix  = "controller/resumeReplication"
+	VBProgressPrefix         = "xdcr/vbProgress"
+	FilterEvaluationPath     = "xdcr/filterEvaluation"
+	TopologyExportPath       = "xdcr/topology/export"
+	TopologyImportPath       = "xdcr/topology/import"
+	CheckpointsPrefix        = "xdcr/checkpoints"
+	RewindCheckpointsPrefix  = "xdcr/rewindCheckpoints"
+	HealthPath               = "xdcr/health"
+	WebhooksPath             = "xdcr/webhooks"
+	DiffJobsPrefix           = "xdcr/diffJobs"
+	DiffResultsPrefix        = "xdcr/diffResults"
+	RepairJobsPrefix         = "xdcr/repairJobs"
+	CheckpointsMigrationPath = "xdcr/checkpointsMigration"
 
 	// Some url paths are not static and have variable contents, e.g., settings/replications/$replication_id
 	// The message keys for such paths are constructed by appending the dynamic suffix below to the static portion of the path.
@@ -96,6 +118,101 @@ const (
 	MatchError  = "error"
 )
 
+// constants for conflict log request
+const (
+	// Input
+	ConflictLogOffset = "offset"
+	ConflictLogLimit  = "limit"
+	// Output
+	ConflictLogTotal   = "total"
+	ConflictLogRecords = "records"
+)
+
+// constants for diff job requests
+const (
+	// Input
+	DiffMaxDocsPerSecond = "maxDocsPerSecond"
+	// Output
+	DiffStatus   = "status"
+	DiffVBuckets = "vbuckets"
+)
+
+// constants for repair job requests
+const (
+	// Input
+	// json array of keys of documents to be repaired
+	RepairKeys = "keys"
+	// whether to repair the documents found different by the latest diff job, instead of the ones in keys
+	RepairFromDiffResults = "fromDiffResults"
+	// Output
+	RepairStatus  = "status"
+	RepairRecords = "records"
+)
+
+// constants for pause/resume replication request
+const (
+	PauseReason = "reason"
+	// time at which replication is to be resumed automatically, in RFC3339 format
+	ResumeAt = "resumeAt"
+	// duration after which replication is to be resumed automatically, e.g., "90m". cannot be specified together with ResumeAt
+	ResumeAfter = "resumeAfter"
+)
+
+// constants for filter evaluation request
+const (
+	// Input
+	// json array of inline documents, each in the form of {"key":<key>, "doc":<doc body>, "xattrs":<xattrs>}
+	// key and xattrs are optional
+	FilterEvalDocuments = "documents"
+	// json array of keys of documents to be retrieved from source bucket
+	FilterEvalDocIds = "docIds"
+	// Output
+	FilterEvalResults = "results"
+)
+
+// constants for topology export and import requests
+const (
+	// Input
+	// how credentials of remote cluster references are exported, redacted or encrypted
+	TopologyCredentials = "credentials"
+	// passphrase for encrypting and decrypting credentials
+	TopologyPassphrase = "passphrase"
+	// topology document to be imported
+	TopologyDocument = "document"
+)
+
+// constants for checkpoint requests
+const (
+	// Input
+	// comma separated list of vbuckets, e.g., 0,1,5
+	CheckpointVBuckets = "vbuckets"
+	// seqno to rewind checkpoints to. checkpoints are removed when it is 0
+	CheckpointSeqno = "seqno"
+	// Output
+	CheckpointVBucket       = "vbucket"
+	CheckpointRecords       = "checkpoints"
+	CheckpointXattrSeqno    = "xattrSeqno"
+	CheckpointTargetVersion = "targetClusterVersion"
+)
+
+// constants for checkpoints migration requests
+const (
+	// Input
+	// when true, checkpoint docs are removed from the previous checkpoints backend instead of being copied from it
+	CheckpointsMigrationCleanup = "cleanup"
+	// Output
+	CheckpointsMigrated = "migrated"
+	CheckpointsRemoved  = "removed"
+)
+
+// constants for webhook requests
+const (
+	// Input
+	WebhookUrl = "url"
+	// comma separated list of event types that the webhook subscribes to
+	WebhookEventTypes = "eventTypes"
+)
+
 // constants used for parsing bucket setting changes
 const (
 	BucketName = "bucketName"
@@ -133,29 +250,49 @@ var MissingOldSettingsInRequest = errors.New("Invalid http request. No old repli
 
 // replication settings key in rest api -> internal replication settings key
 var RestKeyToSettingsKeyMap = map[string]string{
-	base.Type:                      metadata.ReplicationTypeKey,
-	FilterExpression:               metadata.FilterExpressionKey,
-	PauseRequested:                 metadata.ActiveKey,
-	CheckpointInterval:             metadata.CheckpointIntervalKey,
-	BatchCount:                     metadata.BatchCountKey,
-	BatchSize:                      metadata.BatchSizeKey,
-	FailureRestartInterval:         metadata.FailureRestartIntervalKey,
-	OptimisticReplicationThreshold: metadata.OptimisticReplicationThresholdKey,
-	SourceNozzlePerNode:            metadata.SourceNozzlePerNodeKey,
-	TargetNozzlePerNode:            metadata.TargetNozzlePerNodeKey,
-	LogLevel:                       metadata.PipelineLogLevelKey,
-	StatsInterval:                  metadata.PipelineStatsIntervalKey,
-	BandwidthLimit:                 metadata.BandwidthLimitKey,
-	GoMaxProcs:                     metadata.GoMaxProcsKey,
-	GoGC:                           metadata.GoGCKey,
-	base.CompressionTypeREST:       metadata.CompressionTypeKey,
-	FilterVersionKey:               metadata.FilterVersionKey,
-	FilterSkipRestreamKey:          metadata.FilterSkipRestreamKey,
-	Priority:                       metadata.PriorityKey,
-	BacklogThreshold:               metadata.BacklogThresholdKey,
-	FilterExpKey:                   metadata.FilterExpKey,
-	FilterDelKey:                   metadata.FilterDelKey,
-	BypassExpiryKey:                metadata.BypassExpiryKey,
+	base.Type:                           metadata.ReplicationTypeKey,
+	FilterExpression:                    metadata.FilterExpressionKey,
+	PauseRequested:                      metadata.ActiveKey,
+	CheckpointInterval:                  metadata.CheckpointIntervalKey,
+	BatchCount:                          metadata.BatchCountKey,
+	BatchSize:                           metadata.BatchSizeKey,
+	FailureRestartInterval:              metadata.FailureRestartIntervalKey,
+	OptimisticReplicationThreshold:      metadata.OptimisticReplicationThresholdKey,
+	SourceNozzlePerNode:                 metadata.SourceNozzlePerNodeKey,
+	TargetNozzlePerNode:                 metadata.TargetNozzlePerNodeKey,
+	LogLevel:                            metadata.PipelineLogLevelKey,
+	StatsInterval:                       metadata.PipelineStatsIntervalKey,
+	BandwidthLimit:                      metadata.BandwidthLimitKey,
+	GoMaxProcs:                          metadata.GoMaxProcsKey,
+	GoGC:                                metadata.GoGCKey,
+	base.CompressionTypeREST:            metadata.CompressionTypeKey,
+	FilterVersionKey:                    metadata.FilterVersionKey,
+	FilterSkipRestreamKey:               metadata.FilterSkipRestreamKey,
+	Priority:                            metadata.PriorityKey,
+	BacklogThreshold:                    metadata.BacklogThresholdKey,
+	FilterExpKey:                        metadata.FilterExpKey,
+	FilterDelKey:                        metadata.FilterDelKey,
+	BypassExpiryKey:                     metadata.BypassExpiryKey,
+	base.ConflictResolverREST:           metadata.ConflictResolverKey,
+	base.ConflictLoggingREST:            metadata.ConflictLoggingKey,
+	base.ScheduleREST:                   metadata.ScheduleKey,
+	base.ScheduleTimezoneREST:           metadata.ScheduleTimezoneKey,
+	base.BandwidthProfileREST:           metadata.BandwidthProfileKey,
+	base.FilterDelExpFallbackREST:       metadata.FilterDelExpFallbackKey,
+	base.TransformationRulesREST:        metadata.TransformationRulesKey,
+	base.BoundedSeqnoRangeREST:          metadata.BoundedSeqnoRangeKey,
+	base.BoundedTimeRangeREST:           metadata.BoundedTimeRangeKey,
+	base.TargetBatchLatencyREST:         metadata.TargetBatchLatencyKey,
+	base.ConnectionsPerTargetNozzleREST: metadata.ConnectionsPerTargetNozzleKey,
+	base.SinkEndpointREST:               metadata.SinkEndpointKey,
+	base.SinkUsernameREST:               metadata.SinkUsernameKey,
+	base.SinkPasswordREST:               metadata.SinkPasswordKey,
+	base.SinkTLSREST:                    metadata.SinkTLSKey,
+	base.SinkCertificateREST:            metadata.SinkCertificateKey,
+	base.SinkHttpHeadersREST:            metadata.SinkHttpHeadersKey,
+	base.SinkHttpRetryCodesREST:         metadata.SinkHttpRetryStatusCodesKey,
+	base.SinkHttpSkipCodesREST:          metadata.SinkHttpSkipStatusCodesKey,
+	base.SinkKafkaMaxRequestBytesREST:   metadata.SinkKafkaMaxRequestBytesKey,
 }
 
 // internal replication settings key -> replication settings key in rest api
@@ -183,6 +320,26 @@ var SettingsKeyToRestKeyMap = map[string]string{
 	metadata.FilterExpKey:                      FilterExpKey,
 	metadata.FilterDelKey:                      FilterDelKey,
 	metadata.BypassExpiryKey:                   BypassExpiryKey,
+	metadata.ConflictResolverKey:               base.ConflictResolverREST,
+	metadata.ConflictLoggingKey:                base.ConflictLoggingREST,
+	metadata.ScheduleKey:                       base.ScheduleREST,
+	metadata.ScheduleTimezoneKey:               base.ScheduleTimezoneREST,
+	metadata.BandwidthProfileKey:               base.BandwidthProfileREST,
+	metadata.FilterDelExpFallbackKey:           base.FilterDelExpFallbackREST,
+	metadata.TransformationRulesKey:            base.TransformationRulesREST,
+	metadata.BoundedSeqnoRangeKey:              base.BoundedSeqnoRangeREST,
+	metadata.BoundedTimeRangeKey:               base.BoundedTimeRangeREST,
+	metadata.TargetBatchLatencyKey:             base.TargetBatchLatencyREST,
+	metadata.ConnectionsPerTargetNozzleKey:     base.ConnectionsPerTargetNozzleREST,
+	metadata.SinkEndpointKey:                   base.SinkEndpointREST,
+	metadata.SinkUsernameKey:                   base.SinkUsernameREST,
+	metadata.SinkPasswordKey:                   base.SinkPasswordREST,
+	metadata.SinkTLSKey:                        base.SinkTLSREST,
+	metadata.SinkCertificateKey:                base.SinkCertificateREST,
+	metadata.SinkHttpHeadersKey:                base.SinkHttpHeadersREST,
+	metadata.SinkHttpRetryStatusCodesKey:       base.SinkHttpRetryCodesREST,
+	metadata.SinkHttpSkipStatusCodesKey:        base.SinkHttpSkipCodesREST,
+	metadata.SinkKafkaMaxRequestBytesKey:       base.SinkKafkaMaxRequestBytesREST,
 }
 
 // Conversion to REST for user -> pauseRequested - Pretty much a NOT operation
@@ -239,6 +396,15 @@ func NewGetAllReplicationInfosResponse(replInfos []base.ReplicationInfo) (*ap.Re
 	return EncodeObjectIntoResponse(replInfos)
 }
 
+// health of replications keyed by replication id
+func NewReplicationHealthResponse(healthMap map[string]*pipeline.ReplicationHealth) (*ap.Response, error) {
+	return EncodeObjectIntoResponse(healthMap)
+}
+
+func NewWebhooksResponse(webhooks []*metadata.Webhook) (*ap.Response, error) {
+	return EncodeObjectIntoResponse(webhooks)
+}
+
 func getReplicationDocMap(replSpec *metadata.ReplicationSpecification) map[string]interface{} {
 	replDocMap := make(map[string]interface{})
 	if replSpec != nil {
@@ -251,6 +417,8 @@ func getReplicationDocMap(replSpec *metadata.ReplicationSpecification) map[strin
 		replDocMap[base.ReplicationDocPauseRequestedOutput] = !replSpec.Settings.Active
 		if replSpec.Settings.RepType == metadata.ReplicationTypeXmem {
 			replDocMap[base.ReplicationDocType] = base.ReplicationDocTypeXmem
+		} else if replSpec.Settings.IsSink() {
+			replDocMap[base.ReplicationDocType] = replSpec.Settings.RepType
 		} else {
 			replDocMap[base.ReplicationDocType] = base.ReplicationDocTypeCapi
 		}
@@ -500,6 +668,7 @@ func DecodeCreateReplicationRequest(request *http.Request) (justValidate bool, f
 
 	// default isCapi to false if replication type is not explicitly specified in request
 	isCapi := false
+	isSink := false
 
 	for key, valArr := range request.Form {
 		switch key {
@@ -522,6 +691,7 @@ func DecodeCreateReplicationRequest(request *http.Request) (justValidate bool, f
 		case base.Type:
 			replType := getStringFromValArr(valArr)
 			isCapi = (replType == metadata.ReplicationTypeCapi)
+			isSink = metadata.IsSinkReplicationType(replType)
 		default:
 			// ignore other parameters
 		}
@@ -534,7 +704,8 @@ func DecodeCreateReplicationRequest(request *http.Request) (justValidate bool, f
 	if len(fromBucket) == 0 {
 		errorsMap[base.FromBucket] = base.MissingValueError("source bucket")
 	}
-	if len(toCluster) == 0 {
+	// replications to sinks do not need remote cluster references
+	if len(toCluster) == 0 && !isSink {
 		errorsMap[base.ToCluster] = base.MissingValueError("target cluster")
 	}
 	if len(toBucket) == 0 {
@@ -659,22 +830,28 @@ func DecodeCreateReplicationResponse(response *http.Response) (string, error) {
 
 // decode replication settings related parameters from http request
 func DecodeSettingsFromRequest(request *http.Request, isDefaultSettings bool, isUpdate bool, isCapi bool) (metadata.ReplicationSettingsMap, map[string]error) {
-	settings := make(metadata.ReplicationSettingsMap)
-	errorsMap := make(map[string]error)
-	mvHelper := metadata.NewMultiValueHelper()
-
 	if err := request.ParseForm(); err != nil {
+		errorsMap := make(map[string]error)
 		errorsMap[base.PlaceHolderFieldKey] = ErrorParsingForm
 		return nil, errorsMap
 	}
 
+	return decodeSettingsFromForm(request.Form, isDefaultSettings, isUpdate, isCapi)
+}
+
+// decodes settings keyed by rest keys, from the form of http request or from topology document
+func decodeSettingsFromForm(form url.Values, isDefaultSettings bool, isUpdate bool, isCapi bool) (metadata.ReplicationSettingsMap, map[string]error) {
+	settings := make(metadata.ReplicationSettingsMap)
+	errorsMap := make(map[string]error)
+	mvHelper := metadata.NewMultiValueHelper()
+
 	isEnterprise, err := XDCRCompTopologyService().IsMyClusterEnterprise()
 	if err != nil {
 		errorsMap[base.PlaceHolderFieldKey] = err
 		return nil, errorsMap
 	}
 
-	for key, valArr := range request.Form {
+	for key, valArr := range form {
 		key, valArr, err := mvHelper.CheckAndConvertMultiValue(key, valArr)
 		if err != nil {
 			errorsMap[key] = err
@@ -766,6 +943,510 @@ func DecodeRegexpValidationRequest(request *http.Request, utils utilities.UtilsI
 	return
 }
 
+func DecodeConflictLogsRequest(request *http.Request) (offset, limit int, err error) {
+	if err = request.ParseForm(); err != nil {
+		return
+	}
+
+	limit = base.ConflictLogDefaultQueryLimit
+	for key, valArr := range request.Form {
+		switch key {
+		case ConflictLogOffset:
+			offset, err = strconv.Atoi(getStringFromValArr(valArr))
+			if err != nil || offset < 0 {
+				err = base.IncorrectValueTypeError("a non-negative integer")
+				return
+			}
+		case ConflictLogLimit:
+			limit, err = strconv.Atoi(getStringFromValArr(valArr))
+			if err != nil || limit < 1 || limit > base.ConflictLogMaxQueryLimit {
+				err = base.InvalidValueError("an integer", 1, base.ConflictLogMaxQueryLimit)
+				return
+			}
+		default:
+			// ignore other parameters
+		}
+	}
+	return
+}
+
+func DecodeStartDiffRequest(request *http.Request) (maxDocsPerSecond int, err error) {
+	if err = request.ParseForm(); err != nil {
+		return
+	}
+
+	maxDocsPerSecond = base.DiffDefaultMaxDocsPerSecond
+	for key, valArr := range request.Form {
+		switch key {
+		case DiffMaxDocsPerSecond:
+			maxDocsPerSecond, err = strconv.Atoi(getStringFromValArr(valArr))
+			if err != nil || maxDocsPerSecond < 1 || maxDocsPerSecond > base.DiffMaxMaxDocsPerSecond {
+				err = base.InvalidValueError("an integer", 1, base.DiffMaxMaxDocsPerSecond)
+				return
+			}
+		default:
+			// ignore other parameters
+		}
+	}
+	return
+}
+
+func DecodeStartRepairRequest(request *http.Request) (keys []string, fromDiffResults bool, err error) {
+	if err = request.ParseForm(); err != nil {
+		return
+	}
+
+	for key, valArr := range request.Form {
+		switch key {
+		case RepairKeys:
+			err = json.Unmarshal([]byte(getStringFromValArr(valArr)), &keys)
+			if err != nil {
+				err = fmt.Errorf("%v needs to be a json array of document keys", RepairKeys)
+				return
+			}
+		case RepairFromDiffResults:
+			fromDiffResults, err = getBoolFromValArr(valArr, false)
+			if err != nil {
+				return
+			}
+		default:
+			// ignore other parameters
+		}
+	}
+
+	if len(keys) == 0 && !fromDiffResults {
+		err = fmt.Errorf("Either %v or %v needs to be specified", RepairKeys, RepairFromDiffResults)
+	} else if len(keys) > 0 && fromDiffResults {
+		err = fmt.Errorf("%v and %v cannot be specified at the same time", RepairKeys, RepairFromDiffResults)
+	}
+	return
+}
+
+func DecodeCreateWebhookRequest(request *http.Request) (*metadata.Webhook, error) {
+	if err := request.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	var webhookUrl string
+	var eventTypes []string
+	for key, valArr := range request.Form {
+		switch key {
+		case WebhookUrl:
+			webhookUrl = getStringFromValArr(valArr)
+		case WebhookEventTypes:
+			for _, eventType := range strings.Split(getStringFromValArr(valArr), ",") {
+				eventType = strings.TrimSpace(eventType)
+				if len(eventType) > 0 {
+					eventTypes = append(eventTypes, eventType)
+				}
+			}
+		default:
+			// ignore other parameters
+		}
+	}
+
+	if len(webhookUrl) == 0 {
+		return nil, base.MissingParameterError(WebhookUrl)
+	}
+	return metadata.NewWebhook(webhookUrl, eventTypes)
+}
+
+// decodes the vbuckets, and the seqno to rewind them to, from checkpoint request
+// when vbuckets are not required and not specified, nil vbnos is returned to indicate all vbuckets
+func DecodeCheckpointsRequest(request *http.Request, vbucketsRequired, isRewind bool) (vbnos []uint16, seqno uint64, err error) {
+	if err = request.ParseForm(); err != nil {
+		return
+	}
+
+	for key, valArr := range request.Form {
+		switch key {
+		case CheckpointVBuckets:
+			vbnos, err = decodeVBucketList(getStringFromValArr(valArr))
+			if err != nil {
+				return
+			}
+		case CheckpointSeqno:
+			if !isRewind {
+				err = fmt.Errorf("%v can only be specified when rewinding checkpoints", CheckpointSeqno)
+				return
+			}
+			seqno, err = strconv.ParseUint(getStringFromValArr(valArr), 10, 64)
+			if err != nil {
+				err = base.IncorrectValueTypeError("a non-negative integer")
+				return
+			}
+		default:
+			// ignore other parameters
+		}
+	}
+
+	if vbucketsRequired && vbnos == nil {
+		err = base.MissingParameterError(CheckpointVBuckets)
+	}
+	return
+}
+
+func DecodeCheckpointsMigrationRequest(request *http.Request) (cleanup bool, err error) {
+	if err = request.ParseForm(); err != nil {
+		return
+	}
+
+	for key, valArr := range request.Form {
+		switch key {
+		case CheckpointsMigrationCleanup:
+			cleanup, err = getBoolFromValArr(valArr, false)
+			if err != nil {
+				return
+			}
+		default:
+			// ignore other parameters
+		}
+	}
+	return
+}
+
+func NewCheckpointsMigrationResponse(count int, cleanup bool) (*ap.Response, error) {
+	params := make(map[string]interface{})
+	if cleanup {
+		params[CheckpointsRemoved] = count
+	} else {
+		params[CheckpointsMigrated] = count
+	}
+	return EncodeObjectIntoResponse(params)
+}
+
+func decodeVBucketList(vbucketsStr string) ([]uint16, error) {
+	vbnos := make([]uint16, 0)
+	vbnoMap := make(map[uint16]bool)
+	for _, vbnoStr := range strings.Split(vbucketsStr, ",") {
+		vbnoStr = strings.TrimSpace(vbnoStr)
+		if len(vbnoStr) == 0 {
+			continue
+		}
+		vbno, err := strconv.ParseUint(vbnoStr, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%v needs to be a comma separated list of vbucket numbers. invalid vbucket: %v", CheckpointVBuckets, vbnoStr)
+		}
+		if !vbnoMap[uint16(vbno)] {
+			vbnoMap[uint16(vbno)] = true
+			vbnos = append(vbnos, uint16(vbno))
+		}
+	}
+	if len(vbnos) == 0 {
+		return nil, fmt.Errorf("%v needs to contain at least one vbucket", CheckpointVBuckets)
+	}
+	return base.SortUint16List(vbnos), nil
+}
+
+func DecodePauseResumeReplicationRequest(request *http.Request, isPause bool) (reason string, resumeTime time.Time, err error) {
+	if err = request.ParseForm(); err != nil {
+		return
+	}
+
+	var resumeAtStr, resumeAfterStr string
+	for key, valArr := range request.Form {
+		switch key {
+		case PauseReason:
+			reason = getStringFromValArr(valArr)
+		case ResumeAt:
+			resumeAtStr = getStringFromValArr(valArr)
+		case ResumeAfter:
+			resumeAfterStr = getStringFromValArr(valArr)
+		default:
+			// ignore other parameters
+		}
+	}
+
+	if len(resumeAtStr) == 0 && len(resumeAfterStr) == 0 {
+		return
+	}
+	if !isPause {
+		err = fmt.Errorf("%v and %v can only be specified when pausing replication", ResumeAt, ResumeAfter)
+		return
+	}
+	if len(resumeAtStr) > 0 && len(resumeAfterStr) > 0 {
+		err = fmt.Errorf("%v and %v cannot both be specified", ResumeAt, ResumeAfter)
+		return
+	}
+
+	if len(resumeAfterStr) > 0 {
+		resumeAfter, parseErr := time.ParseDuration(resumeAfterStr)
+		if parseErr != nil {
+			err = base.IncorrectValueTypeError("a duration, e.g., \"90m\"")
+			return
+		}
+		if resumeAfter <= 0 {
+			err = fmt.Errorf("%v needs to be positive", ResumeAfter)
+			return
+		}
+		resumeTime = time.Now().Add(resumeAfter)
+		return
+	}
+
+	resumeTime, err = time.Parse(time.RFC3339, resumeAtStr)
+	if err != nil {
+		err = base.IncorrectValueTypeError("a timestamp in RFC3339 format")
+		return
+	}
+	if !resumeTime.After(time.Now()) {
+		err = fmt.Errorf("%v needs to be in the future", ResumeAt)
+		return
+	}
+	return
+}
+
+// a document supplied inline in filter evaluation request
+type FilterEvaluationDoc struct {
+	Key    string          `json:"key"`
+	Doc    json.RawMessage `json:"doc"`
+	Xattrs json.RawMessage `json:"xattrs"`
+}
+
+// either docs or docIds is specified. username, password and bucket are needed only when docIds is specified
+func DecodeFilterEvaluationRequest(request *http.Request) (expression string, docs []*FilterEvaluationDoc, docIds []string, username, password, bucket string, err error) {
+	if err = request.ParseForm(); err != nil {
+		return
+	}
+
+	for key, valArr := range request.Form {
+		switch key {
+		case Expression:
+			expression = getStringFromValArr(valArr)
+		case FilterEvalDocuments:
+			err = json.Unmarshal([]byte(getStringFromValArr(valArr)), &docs)
+			if err != nil {
+				err = fmt.Errorf("%v needs to be a json array of documents in the form of {\"key\":<key>, \"doc\":<doc>, \"xattrs\":<xattrs>}", FilterEvalDocuments)
+				return
+			}
+		case FilterEvalDocIds:
+			err = json.Unmarshal([]byte(getStringFromValArr(valArr)), &docIds)
+			if err != nil {
+				err = fmt.Errorf("%v needs to be a json array of document keys", FilterEvalDocIds)
+				return
+			}
+		case UserName:
+			username = getStringFromValArr(valArr)
+		case Password:
+			password = getStringFromValArr(valArr)
+		case Bucket:
+			bucket = getStringFromValArr(valArr)
+		default:
+			// ignore other parameters
+		}
+	}
+
+	if len(expression) == 0 {
+		err = base.MissingParameterError(Expression)
+	} else if len(docs) == 0 && len(docIds) == 0 {
+		err = fmt.Errorf("Either %v or %v needs to be specified", FilterEvalDocuments, FilterEvalDocIds)
+	} else if len(docs) > 0 && len(docIds) > 0 {
+		err = fmt.Errorf("%v and %v cannot be specified at the same time", FilterEvalDocuments, FilterEvalDocIds)
+	} else if len(docIds) > base.MaxFilterEvaluationDocIds {
+		err = fmt.Errorf("%v cannot contain more than %v document keys", FilterEvalDocIds, base.MaxFilterEvaluationDocIds)
+	} else if len(docIds) > 0 {
+		if len(username) == 0 {
+			err = base.MissingParameterError(UserName)
+		} else if len(password) == 0 {
+			err = base.MissingParameterError(Password)
+		} else if len(bucket) == 0 {
+			err = base.MissingParameterError(Bucket)
+		}
+	}
+	return
+}
+
+func DecodeTopologyExportRequest(request *http.Request) (credentials, passphrase string, err error) {
+	if err = request.ParseForm(); err != nil {
+		return
+	}
+
+	credentials = metadata.TopologyCredentialsRedacted
+	for key, valArr := range request.Form {
+		switch key {
+		case TopologyCredentials:
+			credentials = getStringFromValArr(valArr)
+		case TopologyPassphrase:
+			passphrase = getStringFromValArr(valArr)
+		default:
+			// ignore other parameters
+		}
+	}
+	return
+}
+
+// passphrase is needed only when credentials in topology document are encrypted
+func DecodeTopologyImportRequest(request *http.Request) (doc *metadata.TopologyDocument, err error) {
+	if err = request.ParseForm(); err != nil {
+		return
+	}
+
+	var passphrase string
+	for key, valArr := range request.Form {
+		switch key {
+		case TopologyDocument:
+			doc = &metadata.TopologyDocument{}
+			err = json.Unmarshal([]byte(getStringFromValArr(valArr)), doc)
+			if err != nil {
+				err = fmt.Errorf("%v is not a valid topology document. err=%v", TopologyDocument, err)
+				return
+			}
+		case TopologyPassphrase:
+			passphrase = getStringFromValArr(valArr)
+		default:
+			// ignore other parameters
+		}
+	}
+
+	if doc == nil {
+		err = base.MissingParameterError(TopologyDocument)
+		return
+	}
+	err = doc.Prepare(passphrase)
+	return
+}
+
+// builds the byte slice that filter expression is evaluated against from an inline document,
+// adding xattrs and key to doc body when expression references them, as is done for documents from dcp
+func (doc *FilterEvaluationDoc) toBeFiltered(expression string) ([]byte, error) {
+	// re-marshal doc body to make sure that it is a compact json object
+	var docBody map[string]interface{}
+	err := json.Unmarshal(doc.Doc, &docBody)
+	if err != nil || docBody == nil {
+		return nil, fmt.Errorf("Document is not a valid json object")
+	}
+	body, err := json.Marshal(docBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if base.FilterContainsXattrExpression(expression) {
+		xattrs := make(map[string]interface{})
+		if len(doc.Xattrs) > 0 {
+			err = json.Unmarshal(doc.Xattrs, &xattrs)
+			if err != nil {
+				return nil, fmt.Errorf("Xattrs of document is not a valid json object")
+			}
+		}
+		xattrSlice, err := json.Marshal(xattrs)
+		if err != nil {
+			return nil, err
+		}
+		body, err = base.AddXattrToBeFilteredWithoutDP(body, xattrSlice)
+		if err != nil {
+			return nil, fmt.Errorf("Error adding xattributes to be filtered: %v", err)
+		}
+	}
+
+	if base.FilterContainsKeyExpression(expression) {
+		keyBytes := []byte(doc.Key)
+		body, err, _ = base.AddKeyToBeFiltered(body, keyBytes, nil, nil, len(keyBytes)-1)
+		if err != nil {
+			return nil, fmt.Errorf("Error adding key to be filtered: %v", err)
+		}
+	}
+	return body, nil
+}
+
+// result of evaluating filter expression against a document
+type FilterEvaluationResult struct {
+	Key   string `json:"key"`
+	Match bool   `json:"result"`
+	Error string `json:"error,omitempty"`
+}
+
+// exprErr is the error encountered when parsing the filter expression, in which case no document is evaluated
+func NewFilterEvaluationResponse(results []*FilterEvaluationResult, exprErr error) (*ap.Response, error) {
+	returnMap := make(map[string]interface{})
+	if exprErr != nil {
+		returnMap[MatchError] = exprErr.Error()
+	} else {
+		returnMap[FilterEvalResults] = results
+	}
+	// results contain document keys
+	return EncodeObjectIntoResponseSensitive(returnMap)
+}
+
+func NewConflictLogsResponse(records []*service_def.ConflictRecord, total, offset, limit int) (*ap.Response, error) {
+	params := make(map[string]interface{})
+	params[ConflictLogRecords] = records
+	params[ConflictLogTotal] = total
+	params[ConflictLogOffset] = offset
+	params[ConflictLogLimit] = limit
+	// records contain document keys
+	return EncodeObjectIntoResponseSensitive(params)
+}
+
+func NewDiffStatusResponse(status *service_def.DiffJobStatus) (*ap.Response, error) {
+	return EncodeObjectIntoResponse(status)
+}
+
+// summary of a vbucket together with the differences found in it
+type diffVBResult struct {
+	*service_def.DiffVBSummary
+	Docs []*service_def.DiffRecord `json:"docs"`
+}
+
+// differences are listed under the summaries of the vbuckets they belong to
+func NewDiffResultsResponse(status *service_def.DiffJobStatus, summaries []*service_def.DiffVBSummary, records []*service_def.DiffRecord) (*ap.Response, error) {
+	vbRecords := make(map[uint16][]*service_def.DiffRecord)
+	for _, record := range records {
+		vbRecords[record.VBucket] = append(vbRecords[record.VBucket], record)
+	}
+
+	vbResults := make([]*diffVBResult, 0, len(summaries))
+	for _, summary := range summaries {
+		docs := vbRecords[summary.VBucket]
+		if docs == nil {
+			docs = make([]*service_def.DiffRecord, 0)
+		}
+		vbResults = append(vbResults, &diffVBResult{summary, docs})
+	}
+
+	params := make(map[string]interface{})
+	params[DiffStatus] = status
+	params[DiffVBuckets] = vbResults
+	// records contain document keys
+	return EncodeObjectIntoResponseSensitive(params)
+}
+
+func NewRepairStatusResponse(status *service_def.RepairJobStatus) (*ap.Response, error) {
+	return EncodeObjectIntoResponse(status)
+}
+
+func NewRepairResultsResponse(status *service_def.RepairJobStatus, records []*service_def.RepairRecord) (*ap.Response, error) {
+	params := make(map[string]interface{})
+	params[RepairStatus] = status
+	params[RepairRecords] = records
+	// records contain document keys
+	return EncodeObjectIntoResponseSensitive(params)
+}
+
+// checkpoint docs are listed by vbucket number, with nil records left out
+func NewCheckpointsResponse(ckptDocs map[uint16]*metadata.CheckpointsDoc) (*ap.Response, error) {
+	vbnos := make([]uint16, 0, len(ckptDocs))
+	for vbno := range ckptDocs {
+		vbnos = append(vbnos, vbno)
+	}
+
+	ckptList := make([]map[string]interface{}, 0, len(vbnos))
+	for _, vbno := range base.SortUint16List(vbnos) {
+		ckptDoc := ckptDocs[vbno]
+		records := make([]*metadata.CheckpointRecord, 0)
+		for _, record := range ckptDoc.GetCheckpointRecords() {
+			if record != nil {
+				records = append(records, record)
+			}
+		}
+		ckptMap := make(map[string]interface{})
+		ckptMap[CheckpointVBucket] = vbno
+		ckptMap[CheckpointRecords] = records
+		ckptMap[CheckpointXattrSeqno] = ckptDoc.XattrSeqno
+		ckptMap[CheckpointTargetVersion] = ckptDoc.TargetClusterVersion
+		ckptList = append(ckptList, ckptMap)
+	}
+	return EncodeObjectIntoResponse(ckptList)
+}
+
 func NewCreateReplicationResponse(replicationId string, warnings []string) (*ap.Response, error) {
 	params := make(map[string]interface{})
 	params[ReplicationId] = replicationId
@@ -869,6 +1550,28 @@ func convertSettingsInternalValuesToRESTValues(restKey string, origValue interfa
 	return origValue
 }
 
+// converts settings to string values keyed by rest keys, which can be decoded by decodeSettingsFromForm
+// settings that are not exposed through rest api are skipped
+func convertSettingsToRestStringMap(settingsMap map[string]interface{}) map[string]string {
+	restStringMap := make(map[string]string)
+	for key, value := range settingsMap {
+		restKey, ok := SettingsKeyToRestKeyMap[key]
+		if !ok {
+			continue
+		}
+		restStringMap[restKey] = fmt.Sprintf("%v", convertSettingsInternalValuesToRESTValues(restKey, value))
+	}
+	return restStringMap
+}
+
+func convertRestStringMapToForm(restStringMap map[string]string) url.Values {
+	form := make(url.Values)
+	for key, value := range restStringMap {
+		form.Set(key, value)
+	}
+	return form
+}
+
 func getStringFromValArr(valArr []string) string {
 	if len(valArr) == 0 {
 		return ""
@@ -26,6 +26,7 @@ import (
 	"github.com/couchbase/goxdcr/pipeline"
 	"github.com/couchbase/goxdcr/pipeline_manager"
 	"github.com/couchbase/goxdcr/pipeline_svc"
+	"github.com/couchbase/goxdcr/pipeline_utils"
 	"github.com/couchbase/goxdcr/resource_manager"
 	"github.com/couchbase/goxdcr/service_def"
 	"github.com/couchbase/goxdcr/supervisor"
@@ -43,6 +44,12 @@ import (
 var logger_rm *log.CommonLogger = log.NewLogger("ReplMgr", log.DefaultLoggerContext)
 var StatsUpdateIntervalForPausedReplications = 60 * time.Second
 
+// reason and user id recorded when a replication is resumed at the scheduled resume time
+var ScheduledResumeReason = "Scheduled resume time has been reached"
+var scheduledResumeUserId = &service_def.RealUserId{"internal", "scheduledResume"}
+
+var ErrorReplicationNotPaused = errors.New("Replication is not paused")
+
 var GoXDCROptions struct {
 	SourceKVAdminPort    uint64 //source kv admin port
 	XdcrRestPort         uint64 // port number of XDCR rest server
@@ -73,6 +80,8 @@ type replicationManager struct {
 	pipelineMgr pipeline_manager.Pipeline_mgr_iface
 
 	resourceMgr resource_manager.ResourceMgrIface
+	//starts and stops replications according to their schedules
+	scheduler *replicationScheduler
 
 	//replication specification service handle
 	repl_spec_svc service_def.ReplicationSpecSvc
@@ -96,6 +105,12 @@ type replicationManager struct {
 	bucket_settings_svc service_def.BucketSettingsSvc
 	//internal settings service
 	internal_settings_svc service_def.InternalSettingsSvc
+	//conflict log service
+	conflict_log_svc service_def.ConflictLogSvc
+	//webhook service
+	webhook_svc service_def.WebhookSvc
+	//diff service
+	diff_svc service_def.DiffSvc
 	// Mockable utils object
 	utils utilities.UtilsIface
 
@@ -134,6 +149,10 @@ func StartReplicationManager(sourceKVHost string,
 	bucket_settings_svc service_def.BucketSettingsSvc,
 	internal_settings_svc service_def.InternalSettingsSvc,
 	throughput_throttler_svc service_def.ThroughputThrottlerSvc,
+	conflict_log_svc service_def.ConflictLogSvc,
+	webhook_svc service_def.WebhookSvc,
+	notification_svc service_def.NotificationSvc,
+	diff_svc service_def.DiffSvc,
 	utilitiesIn utilities.UtilsIface) {
 
 	replication_mgr.once.Do(func() {
@@ -147,7 +166,7 @@ func StartReplicationManager(sourceKVHost string,
 		replication_mgr.utils = utilitiesIn
 
 		// initializes replication manager
-		replication_mgr.init(repl_spec_svc, remote_cluster_svc, cluster_info_svc, xdcr_topology_svc, replication_settings_svc, checkpoint_svc, capi_svc, audit_svc, uilog_svc, global_setting_svc, bucket_settings_svc, internal_settings_svc, throughput_throttler_svc)
+		replication_mgr.init(repl_spec_svc, remote_cluster_svc, cluster_info_svc, xdcr_topology_svc, replication_settings_svc, checkpoint_svc, capi_svc, audit_svc, uilog_svc, global_setting_svc, bucket_settings_svc, internal_settings_svc, throughput_throttler_svc, conflict_log_svc, webhook_svc, notification_svc, diff_svc)
 
 		// start replication manager supervisor
 		// TODO should we make heart beat settings configurable?
@@ -314,6 +333,14 @@ func (rm *replicationManager) initMetadataChangeMonitor() {
 	mcm.RegisterListener(internalSettingsChangeListener)
 	rm.internal_settings_svc.SetMetadataChangeHandlerCallback(internalSettingsChangeListener.internalSettingsChangeHandlerCallback)
 
+	webhookChangeListener := NewWebhookChangeListener(
+		rm.webhook_svc,
+		rm.metadata_change_callback_cancel_ch,
+		rm.children_waitgrp,
+		log.DefaultLoggerContext,
+		rm.utils)
+	mcm.RegisterListener(webhookChangeListener)
+
 	remoteClusterChangeListener := NewRemoteClusterChangeListener(
 		rm.remote_cluster_svc,
 		rm.repl_spec_svc,
@@ -380,6 +407,8 @@ func (rm *replicationManager) checkReplicationStatus(fin_chan chan bool) {
 			return
 		case <-status_check_ticker.C:
 			rm.pipelineMgr.CheckPipelines()
+			rm.resumeScheduledReplications()
+			rm.scheduler.checkSchedules(time.Now())
 		case <-stats_update_ticker.C:
 			pipeline_svc.UpdateStats(ClusterInfoService(), XDCRCompTopologyService(), CheckpointService(), bucket_kv_mem_clients, logger_rm, rm.utils)
 		}
@@ -399,7 +428,11 @@ func (rm *replicationManager) init(
 	global_setting_svc service_def.GlobalSettingsSvc,
 	bucket_settings_svc service_def.BucketSettingsSvc,
 	internal_settings_svc service_def.InternalSettingsSvc,
-	throughput_throttler_svc service_def.ThroughputThrottlerSvc) {
+	throughput_throttler_svc service_def.ThroughputThrottlerSvc,
+	conflict_log_svc service_def.ConflictLogSvc,
+	webhook_svc service_def.WebhookSvc,
+	notification_svc service_def.NotificationSvc,
+	diff_svc service_def.DiffSvc) {
 
 	rm.GenericSupervisor = *supervisor.NewGenericSupervisor(base.ReplicationManagerSupervisorId, log.DefaultLoggerContext, rm, nil, rm.utils)
 	rm.repl_spec_svc = repl_spec_svc
@@ -415,14 +448,19 @@ func (rm *replicationManager) init(
 	rm.global_setting_svc = global_setting_svc
 	rm.bucket_settings_svc = bucket_settings_svc
 	rm.internal_settings_svc = internal_settings_svc
+	rm.conflict_log_svc = conflict_log_svc
+	rm.webhook_svc = webhook_svc
+	rm.diff_svc = diff_svc
 
-	fac := factory.NewXDCRFactory(repl_spec_svc, remote_cluster_svc, cluster_info_svc, xdcr_topology_svc, checkpoint_svc, capi_svc, uilog_svc, bucket_settings_svc, throughput_throttler_svc, log.DefaultLoggerContext, log.DefaultLoggerContext, rm, rm.utils)
+	fac := factory.NewXDCRFactory(repl_spec_svc, remote_cluster_svc, cluster_info_svc, xdcr_topology_svc, checkpoint_svc, capi_svc, uilog_svc, bucket_settings_svc, throughput_throttler_svc, conflict_log_svc, log.DefaultLoggerContext, log.DefaultLoggerContext, rm, rm.utils)
 
-	rm.pipelineMgr = pipeline_manager.NewPipelineManager(fac, repl_spec_svc, xdcr_topology_svc, remote_cluster_svc, cluster_info_svc, checkpoint_svc, uilog_svc, log.DefaultLoggerContext, rm.utils)
+	rm.pipelineMgr = pipeline_manager.NewPipelineManager(fac, repl_spec_svc, xdcr_topology_svc, remote_cluster_svc, cluster_info_svc, checkpoint_svc, uilog_svc, notification_svc, log.DefaultLoggerContext, rm.utils)
 
 	rm.resourceMgr = resource_manager.NewResourceManager(rm.pipelineMgr, repl_spec_svc, xdcr_topology_svc, remote_cluster_svc, cluster_info_svc, checkpoint_svc, uilog_svc, throughput_throttler_svc, log.DefaultLoggerContext, rm.utils)
 	rm.resourceMgr.Start()
 
+	rm.scheduler = newReplicationScheduler(repl_spec_svc, remote_cluster_svc, uilog_svc, rm.pipelineMgr, log.DefaultLoggerContext)
+
 	rm.metadata_change_callback_cancel_ch = make(chan struct{}, 1)
 
 	logger_rm.Info("Replication manager is initialized")
@@ -467,6 +505,18 @@ func InternalSettingsService() service_def.InternalSettingsSvc {
 	return replication_mgr.internal_settings_svc
 }
 
+func ConflictLogService() service_def.ConflictLogSvc {
+	return replication_mgr.conflict_log_svc
+}
+
+func WebhookService() service_def.WebhookSvc {
+	return replication_mgr.webhook_svc
+}
+
+func DiffService() service_def.DiffSvc {
+	return replication_mgr.diff_svc
+}
+
 //CreateReplication create the replication specification in metadata store
 //and start the replication pipeline
 func CreateReplication(justValidate bool, sourceBucket, targetCluster, targetBucket string, settings metadata.ReplicationSettingsMap, realUserId *service_def.RealUserId) (string, map[string]error, error, []string) {
@@ -578,6 +628,11 @@ func UpdateDefaultReplicationSettings(settings metadata.ReplicationSettingsMap,
 		return errorMap, nil
 	}
 
+	// default settings are not validated against target, which sinks need
+	if defaultSettings.IsSink() {
+		return map[string]error{base.Type: fmt.Errorf("Replication to a sink cannot be the default replication type")}, nil
+	}
+
 	if len(changedSettingsMap) != 0 {
 		err = ReplicationSettingsService().SetDefaultReplicationSettings(defaultSettings)
 		if err != nil {
@@ -633,10 +688,20 @@ func UpdateReplicationSettings(topic string, settings metadata.ReplicationSettin
 	filterExpression := replSpec.Settings.Values[metadata.FilterExpressionKey].(string)
 	oldCompressionType := replSpec.Settings.Values[metadata.CompressionTypeKey].(int)
 	filterVersion := replSpec.Settings.Values[metadata.FilterVersionKey].(base.FilterVersionType)
+	isSink := replSpec.Settings.IsSink()
+	oldSinkSettings := replSpec.Settings.GetSinkSettings()
 
 	// update replication spec with input settings
 	changedSettingsMap, errorMap := replSpec.Settings.UpdateSettingsFromMap(settings)
 
+	// checkpoints of replications to sinks are not compatible with those of replications to couchbase buckets, and vice versa
+	if _, ok := changedSettingsMap[metadata.ReplicationTypeKey]; ok && (isSink || replSpec.Settings.IsSink()) {
+		return map[string]error{base.Type: fmt.Errorf("Replication type of replication %v cannot be changed to or from a sink", topic)}, nil
+	}
+	if compressionType, ok := changedSettingsMap[metadata.CompressionTypeKey]; ok && isSink && compressionType.(int) != base.CompressionTypeNone && compressionType.(int) != base.CompressionTypeAuto {
+		return map[string]error{base.CompressionTypeREST: fmt.Errorf("Compression feature is incompatible with replication to %v sink", replSpec.Settings.RepType)}, nil
+	}
+
 	// Only Re-evaluate Compression pre-requisites if it is turned on and actually switched algorithms to catch any cluster-wide compression changes
 	if compressionType, ok := changedSettingsMap[metadata.CompressionTypeKey]; ok && (base.GetCompressionType(compressionType.(int)) != base.CompressionTypeNone) &&
 		base.GetCompressionType(oldCompressionType) != base.GetCompressionType(compressionType.(int)) {
@@ -653,6 +718,17 @@ func UpdateReplicationSettings(topic string, settings metadata.ReplicationSettin
 		return errorMap, nil
 	}
 
+	// sink settings are validated as a whole, since they depend on each other and on the type of the sink
+	if isSink && replSpec.Settings.GetSinkSettings() != oldSinkSettings {
+		validateRoutineErrorMap, validateErr := ReplicationSpecService().ValidateReplicationSettings(replSpecificFields.SourceBucketName,
+			replSpecificFields.RemoteClusterName, replSpecificFields.TargetBucketName, replSpec.Settings.ToMap(false /*isDefaultSettings*/))
+		if len(validateRoutineErrorMap) > 0 {
+			return validateRoutineErrorMap, nil
+		} else if validateErr != nil {
+			return nil, validateErr
+		}
+	}
+
 	// If nonfilter-settings invoked this change, take this opportunity to fix stale infos if there is an existing expression present
 	if !filterSettingsChanged(changedSettingsMap, filterExpression) && len(filterExpression) > 0 && filterVersion < base.FilterVersionAdvanced {
 		settings[metadata.FilterVersionKey] = base.FilterVersionAdvanced
@@ -665,6 +741,11 @@ func UpdateReplicationSettings(topic string, settings metadata.ReplicationSettin
 	}
 
 	if len(changedSettingsMap) != 0 {
+		if _, ok := changedSettingsMap[metadata.ActiveKey]; ok {
+			// pause info from an earlier pauseReplication request no longer applies
+			replSpec.PauseInfo = nil
+		}
+
 		err = ReplicationSpecService().SetReplicationSpec(replSpec)
 		if err != nil {
 			return nil, err
@@ -698,6 +779,171 @@ func UpdateReplicationSettings(topic string, settings metadata.ReplicationSettin
 	return nil, nil
 }
 
+//PauseReplication pauses the replication with the specified id, and records the reason of the pause
+//and the time at which replication is to be resumed automatically, if any, in replication spec
+//zero resumeTime indicates that replication is not to be resumed automatically
+func PauseReplication(topic string, reason string, resumeTime time.Time, realUserId *service_def.RealUserId) error {
+	logger_rm.Infof("Pausing replication %v, reason=%v, resumeTime=%v\n", topic, reason, resumeTime)
+
+	replSpec, err := ReplicationSpecService().ReplicationSpec(topic)
+	if err != nil {
+		return err
+	}
+
+	pauseInfo := &base.PauseInfo{Reason: reason, PauseTime: time.Now().Unix()}
+	if !resumeTime.IsZero() {
+		pauseInfo.ResumeTime = resumeTime.Unix()
+	}
+
+	err = setReplicationActiveState(replSpec, false /*active*/, pauseInfo)
+	if err != nil {
+		return err
+	}
+
+	go writePauseResumeReplicationEvent(service_def.PauseReplicationRequestEventId, replSpec, reason, resumeTime, realUserId)
+
+	logger_rm.Infof("Replication %v has been paused\n", topic)
+	return nil
+}
+
+//ResumeReplication resumes the replication with the specified id and clears the pause info in replication spec
+func ResumeReplication(topic string, reason string, realUserId *service_def.RealUserId) error {
+	logger_rm.Infof("Resuming replication %v, reason=%v\n", topic, reason)
+
+	replSpec, err := ReplicationSpecService().ReplicationSpec(topic)
+	if err != nil {
+		return err
+	}
+
+	if replSpec.Settings.Active {
+		return ErrorReplicationNotPaused
+	}
+
+	err = setReplicationActiveState(replSpec, true /*active*/, nil)
+	if err != nil {
+		return err
+	}
+
+	go writePauseResumeReplicationEvent(service_def.ResumeReplicationRequestEventId, replSpec, reason, time.Time{}, realUserId)
+
+	logger_rm.Infof("Replication %v has been resumed\n", topic)
+	return nil
+}
+
+//GetCheckpoints returns the checkpoint docs of the replication with the specified id, keyed by vbucket number
+//nil vbnos indicates all vbuckets
+func GetCheckpoints(topic string, vbnos []uint16) (map[uint16]*metadata.CheckpointsDoc, error) {
+	ckptDocs, err := CheckpointService().CheckpointsDocs(topic)
+	if err != nil {
+		return nil, err
+	}
+	if vbnos == nil {
+		return ckptDocs, nil
+	}
+
+	filteredDocs := make(map[uint16]*metadata.CheckpointsDoc)
+	for _, vbno := range vbnos {
+		if ckptDoc, ok := ckptDocs[vbno]; ok {
+			filteredDocs[vbno] = ckptDoc
+		}
+	}
+	return filteredDocs, nil
+}
+
+//VBucketsNotOnThisNode returns the vbuckets among vbnos whose source vbuckets do not reside on the current node.
+//checkpoints of these vbuckets are maintained by the replication on other nodes, and cannot be modified from the current node
+func VBucketsNotOnThisNode(replSpec *metadata.ReplicationSpecification, vbnos []uint16) ([]uint16, error) {
+	kv_vb_map, _, err := pipeline_utils.GetSourceVBMap(ClusterInfoService(), XDCRCompTopologyService(), replSpec.SourceBucketName, logger_rm)
+	if err != nil {
+		return nil, err
+	}
+
+	localVBs := make(map[uint16]bool)
+	for _, vblist := range kv_vb_map {
+		for _, vbno := range vblist {
+			localVBs[vbno] = true
+		}
+	}
+
+	notLocalVBs := make([]uint16, 0)
+	for _, vbno := range vbnos {
+		if !localVBs[vbno] {
+			notLocalVBs = append(notLocalVBs, vbno)
+		}
+	}
+	return notLocalVBs, nil
+}
+
+//RewindCheckpoints rewinds checkpoints of the specified vbuckets of the replication to the most recent checkpoint at or before seqno,
+//or removes them when seqno is 0, and restarts the replication so that these vbuckets are re-streamed from the rewound checkpoints.
+//the vbuckets need to reside on the current node
+func RewindCheckpoints(topic string, vbnos []uint16, seqno uint64) error {
+	logger_rm.Infof("Rewinding checkpoints of replication %v to seqno %v for vbuckets %v\n", topic, seqno, vbnos)
+
+	vbSeqnos := make(map[uint16]uint64)
+	for _, vbno := range vbnos {
+		vbSeqnos[vbno] = seqno
+	}
+
+	err := replication_mgr.pipelineMgr.ReInitStreamsForVBs(topic, vbSeqnos)
+	if err != nil {
+		logger_rm.Errorf("Unable to queue rewind checkpoints job for replication %v. err=%v\n", topic, err)
+	}
+	return err
+}
+
+// copies checkpoint docs of all replications from the previous checkpoints backend to the current one, without removing
+// them from the previous backend, so that nodes that have not switched to the current backend can still read them.
+// when cleanup is true, removes checkpoint docs from the previous backend instead, which is to be done only after
+// all nodes have switched to the current backend. checkpoint docs are shared by all nodes, so either needs to be
+// requested on only one node. returns the number of checkpoint docs copied or removed
+func MigrateCheckpoints(cleanup bool) (int, error) {
+	replicationIds, err := ReplicationSpecService().AllReplicationSpecIds()
+	if err != nil {
+		return 0, err
+	}
+
+	if cleanup {
+		logger_rm.Infof("Removing checkpoints of replications %v from previous checkpoints backend\n", replicationIds)
+		return CheckpointService().RemoveFallbackCheckpoints(replicationIds)
+	}
+	logger_rm.Infof("Migrating checkpoints of replications %v\n", replicationIds)
+	return CheckpointService().MigrateCheckpoints(replicationIds)
+}
+
+func setReplicationActiveState(replSpec *metadata.ReplicationSpecification, active bool, pauseInfo *base.PauseInfo) error {
+	settings := make(metadata.ReplicationSettingsMap)
+	settings[metadata.ActiveKey] = active
+	_, errorMap := replSpec.Settings.UpdateSettingsFromMap(settings)
+	if len(errorMap) != 0 {
+		return fmt.Errorf("Error updating active state of replication %v. err=%v", replSpec.Id, errorMap)
+	}
+	replSpec.PauseInfo = pauseInfo
+
+	return ReplicationSpecService().SetReplicationSpec(replSpec)
+}
+
+// resume replications whose scheduled resume time has been reached
+// the spec update is done with revision check, so only one node succeeds when multiple nodes attempt it
+func (rm *replicationManager) resumeScheduledReplications() {
+	specs, err := rm.repl_spec_svc.AllReplicationSpecs()
+	if err != nil {
+		logger_rm.Warnf("Failed to retrieve replication specs for scheduled resume. err=%v\n", err)
+		return
+	}
+
+	now := time.Now()
+	for _, spec := range specs {
+		if !spec.IsResumeDue(now) {
+			continue
+		}
+		err = ResumeReplication(spec.Id, ScheduledResumeReason, scheduledResumeUserId)
+		if err != nil {
+			logger_rm.Warnf("Failed to resume replication %v at scheduled time. err=%v\n", spec.Id, err)
+		}
+	}
+}
+
 // get statistics for all running replications
 //% returns a list of replication stats for the bucket. the format for each
 //% item in the list is:
@@ -724,6 +970,11 @@ func GetStatistics(bucket string) (*expvar.Map, error) {
 	return stats, nil
 }
 
+// get statistics for all replications in prometheus text exposition format
+func GetPrometheusMetrics() []byte {
+	return pipeline_svc.GetPrometheusMetrics(replication_mgr.pipelineMgr.ReplicationStatusMap())
+}
+
 //create and persist the replication specification
 func (rm *replicationManager) createAndPersistReplicationSpec(justValidate bool, sourceBucket, targetCluster, targetBucket string, settings metadata.ReplicationSettingsMap) (*metadata.ReplicationSpecification, map[string]error, error, []string) {
 	logger_rm.Infof("Creating replication spec - justValidate=%v, sourceBucket=%s, targetCluster=%s, targetBucket=%s, settings=%v\n",
@@ -734,7 +985,14 @@ func (rm *replicationManager) createAndPersistReplicationSpec(justValidate bool,
 		return nil, errorMap, err, nil
 	}
 
-	spec, err := metadata.NewReplicationSpecification(sourceBucket, sourceBucketUUID, targetClusterRef.Uuid(), targetBucket, targetBucketUUID)
+	var targetClusterUUID string
+	if repl_type, ok := settings[metadata.ReplicationTypeKey].(string); ok && metadata.IsSinkReplicationType(repl_type) {
+		targetClusterUUID = metadata.SinkTargetClusterUUID(repl_type)
+	} else {
+		targetClusterUUID = targetClusterRef.Uuid()
+	}
+
+	spec, err := metadata.NewReplicationSpecification(sourceBucket, sourceBucketUUID, targetClusterUUID, targetBucket, targetBucketUUID)
 	if err != nil {
 		return nil, nil, err, nil
 	}
@@ -792,6 +1050,18 @@ func bypassUIErrorCodes(errStr string) bool {
 	return false
 }
 
+// get health of all replications on this node, keyed by replication id - serves back to consumers who call the health REST end point
+func GetReplicationHealth() map[string]*pipeline.ReplicationHealth {
+	healthMap := make(map[string]*pipeline.ReplicationHealth)
+	for _, replId := range replication_mgr.pipelineMgr.AllReplications() {
+		rep_status, _ := replication_mgr.pipelineMgr.ReplicationStatus(replId)
+		if rep_status != nil {
+			healthMap[replId] = rep_status.Health()
+		}
+	}
+	return healthMap
+}
+
 // get info of all running replications - serves back to consumers who call the REST end point, i.e. UI
 func GetReplicationInfos() ([]base.ReplicationInfo, error) {
 	replInfos := make([]base.ReplicationInfo, 0)
@@ -837,8 +1107,25 @@ func GetReplicationInfos() ([]base.ReplicationInfo, error) {
 			}
 		}
 
-		// set maxVBReps stats to 0 when replication has never been run or has been paused to ensure that ns_server gets the correct replication status
-		if rep_status == nil || rep_status.RuntimeStatus(true) == pipeline.Paused {
+		// set pause info for replications that have been paused through pauseReplication endpoint
+		spec, err := ReplicationSpecService().ReplicationSpec(replId)
+		if err == nil && !spec.Settings.Active {
+			replInfo.PauseInfo = spec.PauseInfo
+		}
+
+		// set schedule info for replications with schedule
+		if err == nil && len(spec.Settings.GetSchedule()) > 0 {
+			replInfo.ScheduleInfo = &base.ScheduleInfo{
+				Schedule: spec.Settings.GetSchedule(),
+				Timezone: spec.Settings.GetScheduleTimezone(),
+				InWindow: spec.Settings.InScheduleWindow(time.Now()),
+			}
+		}
+
+		// set maxVBReps stats to 0 when replication has never been run, has been paused, including by its schedule, or has completed
+		// to ensure that ns_server gets the correct replication status
+		if rep_status == nil || rep_status.RuntimeStatus(true) == pipeline.Paused || rep_status.RuntimeStatus(true) == pipeline.PausedBySchedule ||
+			rep_status.RuntimeStatus(true) == pipeline.Completed {
 			replInfo.StatsMap[base.MaxVBReps] = 0
 		}
 
@@ -1046,6 +1333,22 @@ func writeGenericReplicationEvent(eventId uint32, spec *metadata.ReplicationSpec
 	logAuditErrors(err)
 }
 
+func writePauseResumeReplicationEvent(eventId uint32, spec *metadata.ReplicationSpecification, reason string, resumeTime time.Time, realUserId *service_def.RealUserId) {
+	genericReplicationEvent, err := constructGenericReplicationEvent(spec, realUserId)
+	if err == nil {
+		pauseResumeReplicationEvent := &service_def.PauseResumeReplicationEvent{
+			GenericReplicationEvent: *genericReplicationEvent,
+			Reason:                  reason}
+		if !resumeTime.IsZero() {
+			pauseResumeReplicationEvent.ResumeAt = log.FormatTimeWithMilliSecondPrecision(resumeTime)
+		}
+
+		err = AuditService().Write(eventId, pauseResumeReplicationEvent)
+	}
+
+	logAuditErrors(err)
+}
+
 func writeCreateReplicationEvent(spec *metadata.ReplicationSpecification, realUserId *service_def.RealUserId) {
 	genericReplicationEvent, err := constructGenericReplicationEvent(spec, realUserId)
 	if err == nil {
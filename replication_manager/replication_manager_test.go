@@ -0,0 +1,180 @@
+// +build !pcre
+
+package replication_manager
+
+import (
+	"fmt"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/metadata"
+	"github.com/couchbase/goxdcr/service_def"
+	service_def_mocks "github.com/couchbase/goxdcr/service_def/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+type auditedEvent struct {
+	eventId uint32
+	event   *service_def.PauseResumeReplicationEvent
+}
+
+// sets up the services used by pause and resume. audit events are written asynchronously, and are sent to the returned channel
+func setupPauseResumeMocks(specs ...*metadata.ReplicationSpecification) (*service_def_mocks.ReplicationSpecSvc, chan *auditedEvent) {
+	replSpecSvc := &service_def_mocks.ReplicationSpecSvc{}
+	specMap := make(map[string]*metadata.ReplicationSpecification)
+	for _, spec := range specs {
+		replSpecSvc.On("ReplicationSpec", spec.Id).Return(spec, nil)
+		specMap[spec.Id] = spec
+	}
+	replSpecSvc.On("AllReplicationSpecs").Return(specMap, nil)
+	replSpecSvc.On("SetReplicationSpec", mock.Anything).Return(nil)
+
+	xdcrTopologySvc := &service_def_mocks.XDCRCompTopologySvc{}
+	xdcrTopologySvc.On("MyHostAddr").Return("localhost", nil)
+	remoteClusterSvc := &service_def_mocks.RemoteClusterSvc{}
+	remoteClusterSvc.On("GetRemoteClusterNameFromClusterUuid", mock.Anything).Return("remote")
+
+	auditCh := make(chan *auditedEvent, len(specs)+1)
+	auditSvc := &service_def_mocks.AuditSvc{}
+	auditSvc.On("Write", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		auditCh <- &auditedEvent{args.Get(0).(uint32), args.Get(1).(*service_def.PauseResumeReplicationEvent)}
+	})
+
+	replication_mgr.repl_spec_svc = replSpecSvc
+	replication_mgr.xdcr_topology_svc = xdcrTopologySvc
+	replication_mgr.remote_cluster_svc = remoteClusterSvc
+	replication_mgr.audit_svc = auditSvc
+	return replSpecSvc, auditCh
+}
+
+func resetPauseResumeMocks() {
+	replication_mgr.repl_spec_svc = nil
+	replication_mgr.xdcr_topology_svc = nil
+	replication_mgr.remote_cluster_svc = nil
+	replication_mgr.audit_svc = nil
+}
+
+func waitForAuditEvent(auditCh chan *auditedEvent) *auditedEvent {
+	select {
+	case event := <-auditCh:
+		return event
+	case <-time.After(5 * time.Second):
+		return nil
+	}
+}
+
+func newTestReplicationSpec(sourceBucket string, active bool, pauseInfo *base.PauseInfo) *metadata.ReplicationSpecification {
+	spec, _ := metadata.NewReplicationSpecification(sourceBucket, "sourceBucketUUID", "targetClusterUUID", "target", "targetBucketUUID")
+	spec.Settings.UpdateSettingsFromMap(metadata.ReplicationSettingsMap{metadata.ActiveKey: active})
+	spec.PauseInfo = pauseInfo
+	return spec
+}
+
+func TestPauseResumeReplication(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestPauseResumeReplication =================")
+	defer resetPauseResumeMocks()
+
+	resumeTime := time.Now().Add(time.Hour)
+
+	testCases := []struct {
+		name       string
+		resumeTime time.Time
+	}{
+		{"pause without scheduled resume", time.Time{}},
+		{"pause with scheduled resume", resumeTime},
+	}
+
+	for _, testCase := range testCases {
+		spec := newTestReplicationSpec("source", true /*active*/, nil)
+		replSpecSvc, auditCh := setupPauseResumeMocks(spec)
+
+		before := time.Now().Unix()
+		err := PauseReplication(spec.Id, "maintenance", testCase.resumeTime, scheduledResumeUserId)
+		assert.Nil(err, testCase.name)
+		assert.False(spec.Settings.Active, testCase.name)
+		assert.NotNil(spec.PauseInfo, testCase.name)
+		assert.Equal("maintenance", spec.PauseInfo.Reason, testCase.name)
+		assert.True(spec.PauseInfo.PauseTime >= before, testCase.name)
+		replSpecSvc.AssertCalled(t, "SetReplicationSpec", spec)
+
+		event := waitForAuditEvent(auditCh)
+		assert.NotNil(event, testCase.name)
+		assert.Equal(service_def.PauseReplicationRequestEventId, event.eventId, testCase.name)
+		assert.Equal("maintenance", event.event.Reason, testCase.name)
+		if testCase.resumeTime.IsZero() {
+			assert.Equal(int64(0), spec.PauseInfo.ResumeTime, testCase.name)
+			assert.Equal("", event.event.ResumeAt, testCase.name)
+		} else {
+			assert.Equal(testCase.resumeTime.Unix(), spec.PauseInfo.ResumeTime, testCase.name)
+			assert.NotEqual("", event.event.ResumeAt, testCase.name)
+		}
+
+		// resuming clears pause info
+		err = ResumeReplication(spec.Id, "done", scheduledResumeUserId)
+		assert.Nil(err, testCase.name)
+		assert.True(spec.Settings.Active, testCase.name)
+		assert.Nil(spec.PauseInfo, testCase.name)
+
+		event = waitForAuditEvent(auditCh)
+		assert.NotNil(event, testCase.name)
+		assert.Equal(service_def.ResumeReplicationRequestEventId, event.eventId, testCase.name)
+		assert.Equal("done", event.event.Reason, testCase.name)
+	}
+
+	// resuming a replication that is not paused
+	spec := newTestReplicationSpec("source", true /*active*/, nil)
+	replSpecSvc, _ := setupPauseResumeMocks(spec)
+	err := ResumeReplication(spec.Id, "", scheduledResumeUserId)
+	assert.Equal(ErrorReplicationNotPaused, err)
+	replSpecSvc.AssertNotCalled(t, "SetReplicationSpec", mock.Anything)
+
+	fmt.Println("============== Test case end: TestPauseResumeReplication =================")
+}
+
+func TestResumeScheduledReplications(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestResumeScheduledReplications =================")
+	defer resetPauseResumeMocks()
+
+	now := time.Now().Unix()
+
+	testCases := []struct {
+		name          string
+		spec          *metadata.ReplicationSpecification
+		expectResumed bool
+	}{
+		{"active", newTestReplicationSpec("active", true, nil), false},
+		{"paused without pause info", newTestReplicationSpec("noPauseInfo", false, nil), false},
+		{"paused without scheduled resume", newTestReplicationSpec("noResume", false, &base.PauseInfo{Reason: "r", PauseTime: now - 10}), false},
+		{"resume time in future", newTestReplicationSpec("future", false, &base.PauseInfo{PauseTime: now - 10, ResumeTime: now + 3600}), false},
+		{"resume time reached", newTestReplicationSpec("due", false, &base.PauseInfo{PauseTime: now - 10, ResumeTime: now - 1}), true},
+	}
+
+	specs := make([]*metadata.ReplicationSpecification, 0, len(testCases))
+	for _, testCase := range testCases {
+		specs = append(specs, testCase.spec)
+	}
+	replSpecSvc, auditCh := setupPauseResumeMocks(specs...)
+
+	replication_mgr.resumeScheduledReplications()
+
+	for _, testCase := range testCases {
+		if testCase.expectResumed {
+			assert.True(testCase.spec.Settings.Active, testCase.name)
+			assert.Nil(testCase.spec.PauseInfo, testCase.name)
+			replSpecSvc.AssertCalled(t, "SetReplicationSpec", testCase.spec)
+		} else {
+			replSpecSvc.AssertNotCalled(t, "SetReplicationSpec", testCase.spec)
+		}
+	}
+
+	event := waitForAuditEvent(auditCh)
+	assert.NotNil(event)
+	assert.Equal(service_def.ResumeReplicationRequestEventId, event.eventId)
+	assert.Equal(ScheduledResumeReason, event.event.Reason)
+	assert.Equal(*scheduledResumeUserId, event.event.RealUserid)
+
+	fmt.Println("============== Test case end: TestResumeScheduledReplications =================")
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package replication_manager
+
+import (
+	"fmt"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/metadata"
+	"github.com/couchbase/goxdcr/pipeline_manager"
+	"github.com/couchbase/goxdcr/service_def"
+	"time"
+)
+
+// replicationScheduler stops and starts replications at the boundaries of the time windows in their schedules
+// the pipeline updater does not start a replication that is outside of its time windows. when a replication
+// leaves its time window, its pipeline is updated, which checkpoints through CheckpointBeforeStop and stops the pipeline.
+// when a replication enters its time window, its pipeline is updated again, which starts the pipeline
+type replicationScheduler struct {
+	repl_spec_svc      service_def.ReplicationSpecSvc
+	remote_cluster_svc service_def.RemoteClusterSvc
+	uilog_svc          service_def.UILogSvc
+	pipelineMgr        pipeline_manager.Pipeline_mgr_iface
+
+	// replication id -> whether replication was in its time windows at the last check
+	// only active replications are tracked. replications without schedule are always in window
+	// accessed only by the status check routine of replication manager and hence not protected by lock
+	windowStates map[string]bool
+
+	logger *log.CommonLogger
+}
+
+func newReplicationScheduler(repl_spec_svc service_def.ReplicationSpecSvc, remote_cluster_svc service_def.RemoteClusterSvc,
+	uilog_svc service_def.UILogSvc, pipelineMgr pipeline_manager.Pipeline_mgr_iface, logger_ctx *log.LoggerContext) *replicationScheduler {
+	return &replicationScheduler{
+		repl_spec_svc:      repl_spec_svc,
+		remote_cluster_svc: remote_cluster_svc,
+		uilog_svc:          uilog_svc,
+		pipelineMgr:        pipelineMgr,
+		windowStates:       make(map[string]bool),
+		logger:             log.NewLogger("ReplScheduler", logger_ctx),
+	}
+}
+
+// checkSchedules updates the pipelines of replications that have entered or left their time windows since the last check
+func (scheduler *replicationScheduler) checkSchedules(now time.Time) {
+	specs, err := scheduler.repl_spec_svc.AllReplicationSpecs()
+	if err != nil {
+		scheduler.logger.Warnf("Failed to retrieve replication specs for schedule check. err=%v\n", err)
+		return
+	}
+
+	for replId, _ := range scheduler.windowStates {
+		if spec, ok := specs[replId]; !ok || !spec.Settings.Active {
+			// replication has been deleted or paused. its pipeline will be checked against its schedule when it is resumed
+			delete(scheduler.windowStates, replId)
+		}
+	}
+
+	for replId, spec := range specs {
+		if !spec.Settings.Active {
+			continue
+		}
+
+		inWindow := spec.Settings.InScheduleWindow(now)
+		prevInWindow, ok := scheduler.windowStates[replId]
+		scheduler.windowStates[replId] = inWindow
+		if !ok || prevInWindow == inWindow {
+			// when a replication is first seen, its pipeline is being or has been started by pipeline updater,
+			// which has already taken its time windows into consideration
+			continue
+		}
+
+		var action, reason string
+		if inWindow {
+			action, reason = "started", "it has entered a time window in its schedule"
+		} else {
+			action, reason = "stopped", "it has left the time windows in its schedule"
+		}
+		scheduler.logger.Infof("Updating pipeline %v since %v\n", replId, reason)
+		scheduler.writeUiLog(spec, action, reason)
+
+		err = scheduler.pipelineMgr.UpdatePipeline(replId, nil)
+		if err != nil {
+			scheduler.logger.Warnf("Failed to update pipeline %v at schedule window boundary. err=%v\n", replId, err)
+		}
+	}
+}
+
+func (scheduler *replicationScheduler) writeUiLog(spec *metadata.ReplicationSpecification, action, reason string) {
+	if scheduler.uilog_svc != nil {
+		remoteClusterName := scheduler.remote_cluster_svc.GetRemoteClusterNameFromClusterUuid(spec.TargetClusterUUID)
+		uiLogMsg := fmt.Sprintf("Replication from bucket \"%s\" to bucket \"%s\" on cluster \"%s\" has been %s, since %s", spec.SourceBucketName, spec.TargetBucketName, remoteClusterName, action, reason)
+		scheduler.uilog_svc.Write(uiLogMsg)
+	}
+}
@@ -0,0 +1,137 @@
+// +build !pcre
+
+package replication_manager
+
+import (
+	"fmt"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/metadata"
+	PipelineMgrMock "github.com/couchbase/goxdcr/pipeline_manager/mocks"
+	service_def_mocks "github.com/couchbase/goxdcr/service_def/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"sort"
+	"testing"
+	"time"
+)
+
+func newScheduledReplicationSpec(sourceBucket string, schedule string) *metadata.ReplicationSpecification {
+	spec, _ := metadata.NewReplicationSpecification(sourceBucket, "sourceBucketUUID", "targetClusterUUID", "target", "targetBucketUUID")
+	if len(schedule) > 0 {
+		spec.Settings.UpdateSettingsFromMap(metadata.ReplicationSettingsMap{metadata.ScheduleKey: schedule})
+	}
+	return spec
+}
+
+// sets up a scheduler for the specs. the ids of the replications whose pipelines are updated are sent to the returned channel
+func setupReplicationScheduler(specs map[string]*metadata.ReplicationSpecification) (*replicationScheduler, chan string) {
+	replSpecSvc := &service_def_mocks.ReplicationSpecSvc{}
+	replSpecSvc.On("AllReplicationSpecs").Return(specs, nil)
+	remoteClusterSvc := &service_def_mocks.RemoteClusterSvc{}
+	remoteClusterSvc.On("GetRemoteClusterNameFromClusterUuid", mock.Anything).Return("remote")
+	uiLogSvc := &service_def_mocks.UILogSvc{}
+	uiLogSvc.On("Write", mock.Anything).Return()
+
+	updatedCh := make(chan string, len(specs))
+	pipelineMgr := &PipelineMgrMock.Pipeline_mgr_iface{}
+	pipelineMgr.On("UpdatePipeline", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		updatedCh <- args.Get(0).(string)
+	})
+
+	return newReplicationScheduler(replSpecSvc, remoteClusterSvc, uiLogSvc, pipelineMgr, log.DefaultLoggerContext), updatedCh
+}
+
+func drainUpdatedReplications(updatedCh chan string) []string {
+	updated := []string{}
+	for {
+		select {
+		case replId := <-updatedCh:
+			updated = append(updated, replId)
+		default:
+			sort.Strings(updated)
+			return updated
+		}
+	}
+}
+
+func TestReplicationSchedulerCheckSchedules(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestReplicationSchedulerCheckSchedules =================")
+
+	single := newScheduledReplicationSpec("single", "Mon 08:00-10:00")
+	// windows overlap between 10:30 and 11:00, during which replication stays in window
+	overlapping := newScheduledReplicationSpec("overlapping", "Mon 09:00-11:00;Mon 10:30-12:00")
+	// window spanning midnight
+	overnight := newScheduledReplicationSpec("overnight", "Mon 22:00-02:00")
+	unscheduled := newScheduledReplicationSpec("unscheduled", "")
+	specs := map[string]*metadata.ReplicationSpecification{
+		single.Id:      single,
+		overlapping.Id: overlapping,
+		overnight.Id:   overnight,
+		unscheduled.Id: unscheduled,
+	}
+	scheduler, updatedCh := setupReplicationScheduler(specs)
+
+	// 2024-01-01 is a Monday
+	monday := func(hour, min int) time.Time {
+		return time.Date(2024, time.January, 1, hour, min, 0, 0, time.UTC)
+	}
+
+	// checks are done in order, each against the window states left by the previous one
+	testCases := []struct {
+		name            string
+		now             time.Time
+		expectedUpdated []string
+	}{
+		{"first check does not update pipelines", monday(7, 0), []string{}},
+		{"no window boundary crossed", monday(7, 30), []string{}},
+		{"enter single window", monday(8, 30), []string{single.Id}},
+		{"enter first overlapping window", monday(9, 30), []string{overlapping.Id}},
+		{"leave single window, enter second overlapping window while in first", monday(10, 45), []string{single.Id}},
+		{"leave first overlapping window while in second", monday(11, 30), []string{}},
+		{"leave second overlapping window", monday(12, 30), []string{overlapping.Id}},
+		{"enter overnight window", monday(23, 0), []string{overnight.Id}},
+		{"stay in overnight window past midnight", monday(24+1, 0), []string{}},
+		{"leave overnight window", monday(24+3, 0), []string{overnight.Id}},
+	}
+
+	for _, testCase := range testCases {
+		scheduler.checkSchedules(testCase.now)
+		assert.Equal(testCase.expectedUpdated, drainUpdatedReplications(updatedCh), testCase.name)
+	}
+	assert.True(scheduler.windowStates[unscheduled.Id])
+
+	fmt.Println("============== Test case end: TestReplicationSchedulerCheckSchedules =================")
+}
+
+func TestReplicationSchedulerPausedReplication(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestReplicationSchedulerPausedReplication =================")
+
+	spec := newScheduledReplicationSpec("paused", "Mon 08:00-10:00")
+	specs := map[string]*metadata.ReplicationSpecification{spec.Id: spec}
+	scheduler, updatedCh := setupReplicationScheduler(specs)
+
+	scheduler.checkSchedules(time.Date(2024, time.January, 1, 7, 0, 0, 0, time.UTC))
+	assert.Equal(1, len(scheduler.windowStates))
+
+	// paused replication is no longer tracked, and its pipeline is not updated at window boundaries
+	spec.Settings.Active = false
+	scheduler.checkSchedules(time.Date(2024, time.January, 1, 8, 30, 0, 0, time.UTC))
+	assert.Equal(0, len(scheduler.windowStates))
+	assert.Equal([]string{}, drainUpdatedReplications(updatedCh))
+
+	// resumed replication is treated as first seen, since pipeline updater has taken its schedule into consideration
+	spec.Settings.Active = true
+	scheduler.checkSchedules(time.Date(2024, time.January, 1, 9, 0, 0, 0, time.UTC))
+	assert.Equal([]string{}, drainUpdatedReplications(updatedCh))
+	scheduler.checkSchedules(time.Date(2024, time.January, 1, 10, 30, 0, 0, time.UTC))
+	assert.Equal([]string{spec.Id}, drainUpdatedReplications(updatedCh))
+
+	// deleted replication is no longer tracked
+	delete(specs, spec.Id)
+	scheduler.checkSchedules(time.Date(2024, time.January, 1, 11, 0, 0, 0, time.UTC))
+	assert.Equal(0, len(scheduler.windowStates))
+
+	fmt.Println("============== Test case end: TestReplicationSchedulerPausedReplication =================")
+}
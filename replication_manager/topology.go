@@ -0,0 +1,419 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package replication_manager
+
+import (
+	"errors"
+	"fmt"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/metadata"
+	"github.com/couchbase/goxdcr/service_def"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// actions taken on the items in topology document during import
+const (
+	TopologyActionCreated   = "created"
+	TopologyActionUpdated   = "updated"
+	TopologyActionUnchanged = "unchanged"
+	TopologyActionFailed    = "failed"
+)
+
+// names of settings items in topology import result
+const (
+	TopologyDefaultSettingsName  = "defaultSettings"
+	TopologyInternalSettingsName = "internalSettings"
+	TopologyBucketSettingsPrefix = "bucketSettings"
+)
+
+type TopologyImportItem struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// result of topology import, which lists the action taken on every item in topology document
+type TopologyImportResult struct {
+	RemoteClusters []*TopologyImportItem `json:"remoteClusters"`
+	Replications   []*TopologyImportItem `json:"replications"`
+	Settings       []*TopologyImportItem `json:"settings"`
+}
+
+func newTopologyImportItem(name string) *TopologyImportItem {
+	return &TopologyImportItem{Name: name}
+}
+
+func (item *TopologyImportItem) setResult(action string, err error) {
+	if err != nil {
+		item.Action = TopologyActionFailed
+		item.Error = err.Error()
+	} else {
+		item.Action = action
+	}
+}
+
+// ExportTopology takes a snapshot of remote cluster references, replications, default, global and internal settings,
+// and bucket settings of the source buckets of replications
+func ExportTopology(credentials, passphrase string) (*metadata.TopologyDocument, error) {
+	doc, err := metadata.NewTopologyDocument(credentials, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := RemoteClusterService().RemoteClusters()
+	if err != nil {
+		return nil, err
+	}
+	refNames := make([]string, 0, len(refs))
+	// uuid -> name of remote cluster reference
+	refNameMap := make(map[string]string)
+	refByNameMap := make(map[string]*metadata.RemoteClusterReference)
+	for _, ref := range refs {
+		refNames = append(refNames, ref.Name())
+		refNameMap[ref.Uuid()] = ref.Name()
+		refByNameMap[ref.Name()] = ref
+	}
+	sort.Strings(refNames)
+	for _, refName := range refNames {
+		err = doc.AddRemoteCluster(refByNameMap[refName])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	specs, err := ReplicationSpecService().AllReplicationSpecs()
+	if err != nil {
+		return nil, err
+	}
+	specIds := make([]string, 0, len(specs))
+	for specId, _ := range specs {
+		specIds = append(specIds, specId)
+	}
+	sort.Strings(specIds)
+	sourceBuckets := make(map[string]bool)
+	for _, specId := range specIds {
+		spec := specs[specId]
+		refName, ok := refNameMap[spec.TargetClusterUUID]
+		if spec.Settings.IsSink() {
+			// replications to sinks do not have remote cluster references
+			refName, ok = spec.TargetClusterUUID, true
+		}
+		if !ok {
+			logger_rm.Warnf("Skipping replication %v in topology export since its remote cluster reference does not exist\n", specId)
+			continue
+		}
+		sinkSettings := spec.Settings.GetSinkSettings()
+		err = doc.AddReplication(&metadata.TopologyReplication{
+			SourceBucket:  spec.SourceBucketName,
+			TargetCluster: refName,
+			TargetBucket:  spec.TargetBucketName,
+			Settings:      convertSettingsToRestStringMap(spec.Settings.ToRESTMap()),
+		}, sinkSettings.Password, sinkSettings.HttpHeaders)
+		if err != nil {
+			return nil, err
+		}
+		sourceBuckets[spec.SourceBucketName] = true
+	}
+
+	doc.DefaultSettings, err = getDefaultSettingsForTopology()
+	if err != nil {
+		return nil, err
+	}
+	doc.InternalSettings = getInternalSettingsForTopology()
+
+	bucketNames := make([]string, 0, len(sourceBuckets))
+	for bucketName, _ := range sourceBuckets {
+		bucketNames = append(bucketNames, bucketName)
+	}
+	sort.Strings(bucketNames)
+	for _, bucketName := range bucketNames {
+		bucketSettings, err := BucketSettingsService().BucketSettings(bucketName)
+		if err != nil {
+			logger_rm.Warnf("Skipping settings of bucket %v in topology export. err=%v\n", bucketName, err)
+			continue
+		}
+		doc.BucketSettings = append(doc.BucketSettings, &metadata.TopologyBucketSettings{bucketName, bucketSettings.LWWEnabled})
+	}
+
+	logger_rm.Infof("Exported topology with %v remote cluster references and %v replications\n", len(doc.RemoteClusters), len(doc.Replications))
+	return doc, nil
+}
+
+// ImportTopology applies topology document to the current cluster. Items that already exist with the same
+// configuration are left unchanged, so that the same document can be imported repeatedly.
+// Failure of an item does not stop the import of other items, except for replications that depend on it.
+// Internal settings are applied last, since xdcr process restarts when they are changed
+func ImportTopology(doc *metadata.TopologyDocument, realUserId *service_def.RealUserId) (*TopologyImportResult, error) {
+	result := &TopologyImportResult{
+		RemoteClusters: make([]*TopologyImportItem, 0),
+		Replications:   make([]*TopologyImportItem, 0),
+		Settings:       make([]*TopologyImportItem, 0),
+	}
+
+	// default settings go first so that they apply to replications being created
+	if len(doc.DefaultSettings) > 0 {
+		item := newTopologyImportItem(TopologyDefaultSettingsName)
+		item.setResult(importDefaultSettings(doc.DefaultSettings, realUserId))
+		result.Settings = append(result.Settings, item)
+	}
+
+	refs, err := RemoteClusterService().RemoteClusters()
+	if err != nil {
+		return nil, err
+	}
+	refByNameMap := make(map[string]*metadata.RemoteClusterReference)
+	for _, ref := range refs {
+		refByNameMap[ref.Name()] = ref
+	}
+	for _, remoteCluster := range doc.RemoteClusters {
+		item := newTopologyImportItem(remoteCluster.Name)
+		item.setResult(importRemoteCluster(doc, remoteCluster, refByNameMap[remoteCluster.Name], realUserId))
+		result.RemoteClusters = append(result.RemoteClusters, item)
+	}
+
+	specs, err := ReplicationSpecService().AllReplicationSpecs()
+	if err != nil {
+		return nil, err
+	}
+	for _, replication := range doc.Replications {
+		item := newTopologyImportItem(strings.Join([]string{replication.TargetCluster, replication.SourceBucket, replication.TargetBucket}, base.KeyPartsDelimiter))
+		item.setResult(importReplication(doc, replication, specs, realUserId))
+		result.Replications = append(result.Replications, item)
+	}
+
+	for _, bucketSettings := range doc.BucketSettings {
+		item := newTopologyImportItem(TopologyBucketSettingsPrefix + base.KeyPartsDelimiter + bucketSettings.BucketName)
+		item.setResult(importBucketSettings(bucketSettings, realUserId))
+		result.Settings = append(result.Settings, item)
+	}
+
+	if len(doc.InternalSettings) > 0 {
+		item := newTopologyImportItem(TopologyInternalSettingsName)
+		item.setResult(importInternalSettings(doc.InternalSettings))
+		result.Settings = append(result.Settings, item)
+	}
+
+	return result, nil
+}
+
+// default replication settings and global settings, in the same form as returned by default settings rest api
+func getDefaultSettingsForTopology() (map[string]string, error) {
+	defaultSettings, err := ReplicationSettingsService().GetDefaultReplicationSettings()
+	if err != nil {
+		return nil, err
+	}
+	globalSettings, err := GlobalSettingsService().GetDefaultGlobalSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	settingsMap := convertSettingsToRestStringMap(defaultSettings.ToDefaultSettingsMap())
+	for key, value := range convertSettingsToRestStringMap(globalSettings.ToMap()) {
+		settingsMap[key] = value
+	}
+	return settingsMap, nil
+}
+
+func getInternalSettingsForTopology() map[string]string {
+	settingsMap := make(map[string]string)
+	for key, value := range InternalSettingsService().GetInternalSettings().ToMap() {
+		settingsMap[key] = fmt.Sprintf("%v", value)
+	}
+	return settingsMap
+}
+
+func importDefaultSettings(restSettings map[string]string, realUserId *service_def.RealUserId) (string, error) {
+	oldSettings, err := getDefaultSettingsForTopology()
+	if err != nil {
+		return "", err
+	}
+
+	settings, errorsMap := decodeSettingsFromForm(convertRestStringMapToForm(restSettings), true /*isDefaultSettings*/, false /*isUpdate*/, false /*isCapi*/)
+	if len(errorsMap) > 0 {
+		return "", errors.New(base.FlattenErrorMap(errorsMap))
+	}
+	errorsMap, err = UpdateDefaultSettings(settings, realUserId)
+	if err != nil {
+		return "", err
+	} else if len(errorsMap) > 0 {
+		return "", errors.New(base.FlattenErrorMap(errorsMap))
+	}
+
+	newSettings, err := getDefaultSettingsForTopology()
+	if err != nil {
+		return "", err
+	}
+	if reflect.DeepEqual(oldSettings, newSettings) {
+		return TopologyActionUnchanged, nil
+	}
+	return TopologyActionUpdated, nil
+}
+
+// existingRef is nil when remote cluster reference with the same name does not exist
+func importRemoteCluster(doc *metadata.TopologyDocument, remoteCluster *metadata.TopologyRemoteCluster,
+	existingRef *metadata.RemoteClusterReference, realUserId *service_def.RealUserId) (string, error) {
+	ref, err := doc.RemoteClusterReference(remoteCluster)
+	if err == metadata.ErrorTopologyCredentialsRedacted && existingRef != nil && existingRef.HostName() == remoteCluster.HostName {
+		// credentials of existing reference are kept
+		return TopologyActionUnchanged, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	remoteClusterService := RemoteClusterService()
+	if existingRef == nil {
+		err = remoteClusterService.ValidateAddRemoteCluster(ref)
+		if err == nil {
+			// connectivity has been validated by ValidateAddRemoteCluster
+			err = remoteClusterService.AddRemoteCluster(ref, true /*skipConnectivityValidation*/)
+		}
+		if err != nil {
+			_, err = remoteClusterService.CheckAndUnwrapRemoteClusterError(err)
+			return "", err
+		}
+		go writeRemoteClusterAuditEvent(service_def.CreateRemoteClusterRefEventId, ref, realUserId)
+		return TopologyActionCreated, nil
+	}
+
+	if existingRef.HostName() == ref.HostName() && existingRef.AreUserSecurityCredentialsTheSame(ref) {
+		return TopologyActionUnchanged, nil
+	}
+	err = remoteClusterService.SetRemoteCluster(remoteCluster.Name, ref)
+	if err != nil {
+		_, err = remoteClusterService.CheckAndUnwrapRemoteClusterError(err)
+		return "", err
+	}
+	go writeRemoteClusterAuditEvent(service_def.UpdateRemoteClusterRefEventId, ref, realUserId)
+	return TopologyActionUpdated, nil
+}
+
+func importReplication(doc *metadata.TopologyDocument, replication *metadata.TopologyReplication,
+	specs map[string]*metadata.ReplicationSpecification, realUserId *service_def.RealUserId) (string, error) {
+	var targetClusterUUID string
+	if replType := replication.Settings[base.Type]; metadata.IsSinkReplicationType(replType) {
+		// replications to sinks do not have remote cluster references
+		targetClusterUUID = metadata.SinkTargetClusterUUID(replType)
+	} else {
+		ref, err := RemoteClusterService().RemoteClusterByRefName(replication.TargetCluster, false)
+		if err != nil {
+			return "", fmt.Errorf("Remote cluster reference %v is not available. err=%v", replication.TargetCluster, err)
+		}
+		targetClusterUUID = ref.Uuid()
+	}
+	spec, ok := specs[metadata.ReplicationId(replication.SourceBucket, targetClusterUUID, replication.TargetBucket)]
+
+	restSettings := make(map[string]string)
+	for key, value := range replication.Settings {
+		restSettings[key] = value
+	}
+	sinkPassword, sinkHttpHeaders, err := doc.SinkCredentials(replication)
+	if err == metadata.ErrorTopologySinkCredentialsRedacted && ok {
+		// password and http headers of existing sink are kept
+	} else if err != nil {
+		return "", err
+	} else {
+		if len(sinkPassword) > 0 {
+			restSettings[base.SinkPasswordREST] = sinkPassword
+		}
+		if len(sinkHttpHeaders) > 0 {
+			restSettings[base.SinkHttpHeadersREST] = sinkHttpHeaders
+		}
+	}
+
+	isCapi := restSettings[base.Type] == metadata.ReplicationTypeCapi
+	settings, errorsMap := decodeSettingsFromForm(convertRestStringMapToForm(restSettings), false /*isDefaultSettings*/, false /*isUpdate*/, isCapi)
+	if len(errorsMap) > 0 {
+		return "", errors.New(base.FlattenErrorMap(errorsMap))
+	}
+
+	if !ok {
+		// ValidateNewReplicationSpec is called when replication is created
+		_, errorsMap, err, _ = CreateReplication(false /*justValidate*/, replication.SourceBucket, replication.TargetCluster,
+			replication.TargetBucket, settings, realUserId)
+		if err != nil {
+			return "", err
+		} else if len(errorsMap) > 0 {
+			return "", errors.New(base.FlattenErrorMap(errorsMap))
+		}
+		return TopologyActionCreated, nil
+	}
+
+	// settings that cannot be changed after replication is created are left as they are
+	for key, _ := range settings {
+		if !metadata.IsSettingValueMutable(key) {
+			delete(settings, key)
+		}
+	}
+	oldSettings := convertSettingsToRestStringMap(spec.Settings.ToRESTMap())
+	// password and http headers of sink are not in rest map
+	oldSinkSettings := spec.Settings.GetSinkSettings()
+	errorsMap, err = UpdateReplicationSettings(spec.Id, settings, realUserId)
+	if err != nil {
+		return "", err
+	} else if len(errorsMap) > 0 {
+		return "", errors.New(base.FlattenErrorMap(errorsMap))
+	}
+
+	newSpec, err := ReplicationSpecService().ReplicationSpec(spec.Id)
+	if err != nil {
+		return "", err
+	}
+	if reflect.DeepEqual(oldSettings, convertSettingsToRestStringMap(newSpec.Settings.ToRESTMap())) &&
+		oldSinkSettings == newSpec.Settings.GetSinkSettings() {
+		return TopologyActionUnchanged, nil
+	}
+	return TopologyActionUpdated, nil
+}
+
+func importBucketSettings(bucketSettings *metadata.TopologyBucketSettings, realUserId *service_def.RealUserId) (string, error) {
+	oldBucketSettings, err := BucketSettingsService().BucketSettings(bucketSettings.BucketName)
+	if err != nil {
+		return "", err
+	}
+	if oldBucketSettings.LWWEnabled == bucketSettings.LWWEnabled {
+		return TopologyActionUnchanged, nil
+	}
+
+	_, err = setBucketSettings(bucketSettings.BucketName, bucketSettings.LWWEnabled, realUserId)
+	if err != nil {
+		return "", err
+	}
+	return TopologyActionUpdated, nil
+}
+
+func importInternalSettings(restSettings map[string]string) (string, error) {
+	if reflect.DeepEqual(restSettings, getInternalSettingsForTopology()) {
+		return TopologyActionUnchanged, nil
+	}
+
+	settings := make(metadata.ReplicationSettingsMap)
+	errorsMap := make(map[string]error)
+	for key, value := range restSettings {
+		convertedValue, err := metadata.ValidateAndConvertXDCRInternalSettingsValue(key, value)
+		if err != nil {
+			errorsMap[key] = err
+		} else {
+			settings[key] = convertedValue
+		}
+	}
+	if len(errorsMap) > 0 {
+		return "", errors.New(base.FlattenErrorMap(errorsMap))
+	}
+
+	_, errorsMap, err := InternalSettingsService().UpdateInternalSettings(settings)
+	if err != nil {
+		return "", err
+	} else if len(errorsMap) > 0 {
+		return "", errors.New(base.FlattenErrorMap(errorsMap))
+	}
+	return TopologyActionUpdated, nil
+}
@@ -0,0 +1,176 @@
+// +build !pcre
+
+package replication_manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/metadata"
+	"github.com/couchbase/goxdcr/service_def"
+	service_def_mocks "github.com/couchbase/goxdcr/service_def/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+// sets up the services used by topology export and import, with refs and specs as the current state of the cluster.
+// audit events are written asynchronously, and their ids are sent to the returned channel
+func setupTopologyMocks(refs []*metadata.RemoteClusterReference, specs []*metadata.ReplicationSpecification) chan uint32 {
+	remoteClusterSvc := &service_def_mocks.RemoteClusterSvc{}
+	refMap := make(map[string]*metadata.RemoteClusterReference)
+	for _, ref := range refs {
+		remoteClusterSvc.On("RemoteClusterByRefName", ref.Name(), false).Return(ref, nil)
+		refMap[ref.Id()] = ref
+	}
+	remoteClusterSvc.On("RemoteClusters").Return(refMap, nil)
+	remoteClusterSvc.On("GetRemoteClusterNameFromClusterUuid", mock.Anything).Return("remote")
+
+	replSpecSvc := &service_def_mocks.ReplicationSpecSvc{}
+	specMap := make(map[string]*metadata.ReplicationSpecification)
+	for _, spec := range specs {
+		replSpecSvc.On("ReplicationSpec", spec.Id).Return(spec, nil)
+		specMap[spec.Id] = spec
+	}
+	replSpecSvc.On("AllReplicationSpecs").Return(specMap, nil)
+	replSpecSvc.On("SetReplicationSpec", mock.Anything).Return(nil)
+	replSpecSvc.On("ValidateReplicationSettings", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(base.ErrorMap{}, nil)
+
+	replSettingsSvc := &service_def_mocks.ReplicationSettingsSvc{}
+	replSettingsSvc.On("GetDefaultReplicationSettings").Return(metadata.DefaultReplicationSettings(), nil)
+	replSettingsSvc.On("SetDefaultReplicationSettings", mock.Anything).Return(nil)
+	globalSettingsSvc := &service_def_mocks.GlobalSettingsSvc{}
+	globalSettingsSvc.On("GetDefaultGlobalSettings").Return(metadata.DefaultGlobalSettings(), nil)
+	globalSettingsSvc.On("SetDefaultGlobalSettings", mock.Anything).Return(nil)
+	internalSettingsSvc := &service_def_mocks.InternalSettingsSvc{}
+	internalSettingsSvc.On("GetInternalSettings").Return(metadata.DefaultInternalSettings())
+	bucketSettingsSvc := &service_def_mocks.BucketSettingsSvc{}
+	bucketSettingsSvc.On("BucketSettings", mock.Anything).Return(metadata.NewBucketSettings("bucket"), nil)
+
+	xdcrTopologySvc := &service_def_mocks.XDCRCompTopologySvc{}
+	xdcrTopologySvc.On("IsMyClusterEnterprise").Return(true, nil)
+	xdcrTopologySvc.On("MyHostAddr").Return("localhost", nil)
+	auditCh := make(chan uint32, 10)
+	auditSvc := &service_def_mocks.AuditSvc{}
+	auditSvc.On("Write", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		auditCh <- args.Get(0).(uint32)
+	})
+
+	replication_mgr.remote_cluster_svc = remoteClusterSvc
+	replication_mgr.repl_spec_svc = replSpecSvc
+	replication_mgr.replication_settings_svc = replSettingsSvc
+	replication_mgr.global_setting_svc = globalSettingsSvc
+	replication_mgr.internal_settings_svc = internalSettingsSvc
+	replication_mgr.bucket_settings_svc = bucketSettingsSvc
+	replication_mgr.xdcr_topology_svc = xdcrTopologySvc
+	replication_mgr.audit_svc = auditSvc
+	return auditCh
+}
+
+func resetTopologyMocks() {
+	replication_mgr.remote_cluster_svc = nil
+	replication_mgr.repl_spec_svc = nil
+	replication_mgr.replication_settings_svc = nil
+	replication_mgr.global_setting_svc = nil
+	replication_mgr.internal_settings_svc = nil
+	replication_mgr.bucket_settings_svc = nil
+	replication_mgr.xdcr_topology_svc = nil
+	replication_mgr.audit_svc = nil
+}
+
+func newTopologyTestSinkSpec(password string) *metadata.ReplicationSpecification {
+	spec, _ := metadata.NewReplicationSpecification("sinkSource", "sourceBucketUUID", metadata.SinkTargetClusterUUID(base.SinkTypeHttp), "sinkTarget", "")
+	spec.Settings.UpdateSettingsFromMap(metadata.ReplicationSettingsMap{
+		metadata.ReplicationTypeKey: base.SinkTypeHttp,
+		metadata.SinkEndpointKey:    "http://localhost:8080/docs",
+		metadata.SinkUsernameKey:    "user",
+		metadata.SinkPasswordKey:    password,
+		metadata.SinkHttpHeadersKey: `{"X-Token":"token"}`,
+	})
+	return spec
+}
+
+func findTopologyImportItem(items []*TopologyImportItem, name string) *TopologyImportItem {
+	for _, item := range items {
+		if item.Name == name {
+			return item
+		}
+	}
+	return nil
+}
+
+func TestImportTopologyRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestImportTopologyRoundTrip =================")
+	defer resetTopologyMocks()
+
+	ref, err := metadata.NewRemoteClusterReference("targetClusterUUID", "remote", "127.0.0.1:9000", "Administrator", "password",
+		false /*demandEncryption*/, "", nil, nil, nil)
+	assert.Nil(err)
+	xmemSpec, err := metadata.NewReplicationSpecification("xmemSource", "sourceBucketUUID", "targetClusterUUID", "target", "targetBucketUUID")
+	assert.Nil(err)
+	sinkSpec := newTopologyTestSinkSpec("secret")
+	setupTopologyMocks([]*metadata.RemoteClusterReference{ref}, []*metadata.ReplicationSpecification{xmemSpec, sinkSpec})
+
+	doc, err := ExportTopology(metadata.TopologyCredentialsEncrypted, "passphrase")
+	assert.Nil(err)
+	assert.Equal(1, len(doc.RemoteClusters))
+	assert.Equal(2, len(doc.Replications))
+	docBytes, err := json.Marshal(doc)
+	assert.Nil(err)
+	assert.NotContains(string(docBytes), "secret")
+	assert.NotContains(string(docBytes), "token")
+
+	importedDoc := &metadata.TopologyDocument{}
+	assert.Nil(json.Unmarshal(docBytes, importedDoc))
+	assert.Nil(importedDoc.Prepare("passphrase"))
+
+	// the cluster that topology is imported into has the same configuration, except for the password of sink
+	importedSinkSpec := newTopologyTestSinkSpec("stale")
+	importedXmemSpec, err := metadata.NewReplicationSpecification("xmemSource", "sourceBucketUUID", "targetClusterUUID", "target", "targetBucketUUID")
+	assert.Nil(err)
+	auditCh := setupTopologyMocks([]*metadata.RemoteClusterReference{ref.Clone()}, []*metadata.ReplicationSpecification{importedXmemSpec, importedSinkSpec})
+
+	realUserId := &service_def.RealUserId{"local", "Administrator"}
+	result, err := ImportTopology(importedDoc, realUserId)
+	assert.Nil(err)
+
+	assert.Equal(1, len(result.RemoteClusters))
+	assert.Equal(TopologyActionUnchanged, result.RemoteClusters[0].Action)
+	assert.Equal(2, len(result.Replications))
+	xmemItem := findTopologyImportItem(result.Replications, "remote/xmemSource/target")
+	assert.NotNil(xmemItem)
+	assert.Equal(TopologyActionUnchanged, xmemItem.Action, xmemItem.Error)
+	sinkItem := findTopologyImportItem(result.Replications, "sink-http/sinkSource/sinkTarget")
+	assert.NotNil(sinkItem)
+	assert.Equal(TopologyActionUpdated, sinkItem.Action, sinkItem.Error)
+	for _, item := range result.Settings {
+		assert.Equal(TopologyActionUnchanged, item.Action, item.Name+" "+item.Error)
+	}
+
+	// password and http headers of sink are restored from the encrypted credentials
+	sinkSettings := importedSinkSpec.Settings.GetSinkSettings()
+	assert.Equal("secret", sinkSettings.Password)
+	assert.Equal(`{"X-Token":"token"}`, sinkSettings.HttpHeaders)
+	select {
+	case eventId := <-auditCh:
+		assert.Equal(service_def.UpdateReplicationSettingsEventId, eventId)
+	case <-time.After(5 * time.Second):
+		assert.Fail("update of sink replication has not been audited")
+	}
+
+	// redacted credentials of existing sink are kept
+	doc, err = ExportTopology(metadata.TopologyCredentialsRedacted, "")
+	assert.Nil(err)
+	assert.Nil(doc.Prepare(""))
+	importedSinkSpec.Settings.UpdateSettingsFromMap(metadata.ReplicationSettingsMap{metadata.SinkPasswordKey: "kept"})
+	result, err = ImportTopology(doc, realUserId)
+	assert.Nil(err)
+	sinkItem = findTopologyImportItem(result.Replications, "sink-http/sinkSource/sinkTarget")
+	assert.NotNil(sinkItem)
+	assert.Equal(TopologyActionUnchanged, sinkItem.Action, sinkItem.Error)
+	assert.Equal("kept", importedSinkSpec.Settings.GetSinkSettings().Password)
+
+	fmt.Println("============== Test case end: TestImportTopologyRoundTrip =================")
+}
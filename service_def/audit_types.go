@@ -24,6 +24,8 @@ const (
 	UpdateDefaultReplicationSettingsEventId uint32 = 16391
 	UpdateReplicationSettingsEventId        uint32 = 16392
 	UpdateBucketSettingsEventId             uint32 = 16393
+	PauseReplicationRequestEventId          uint32 = 16394
+	ResumeReplicationRequestEventId         uint32 = 16395
 )
 
 var ErrorWritingAudit = "Could not write audit logs."
@@ -61,6 +63,13 @@ type UpdateBucketSettingsEvent struct {
 	UpdatedSettings map[string]interface{} `json:"updated_settings"`
 }
 
+// event for explicit pause/resume of replication through pauseReplication/resumeReplication endpoints
+type PauseResumeReplicationEvent struct {
+	GenericReplicationEvent
+	Reason   string `json:"reason,omitempty"`
+	ResumeAt string `json:"resume_at,omitempty"`
+}
+
 type GenericReplicationEvent struct {
 	GenericReplicationFields
 	ReplicationSpecificFields
@@ -149,3 +158,13 @@ func (event *GenericReplicationEvent) Clone() AuditEventIface {
 	clonedEvent := *event
 	return &clonedEvent
 }
+
+func (event *PauseResumeReplicationEvent) Redact() AuditEventIface {
+	event.GenericFields.Redact()
+	return event
+}
+
+func (event *PauseResumeReplicationEvent) Clone() AuditEventIface {
+	clonedEvent := *event
+	return &clonedEvent
+}
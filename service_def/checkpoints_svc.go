@@ -10,9 +10,12 @@
 package service_def
 
 import (
+	"errors"
 	"github.com/couchbase/goxdcr/metadata"
 )
 
+var ErrorNoCheckpointsFallback = errors.New("Checkpoints backend has not been changed. There are no checkpoint docs to migrate")
+
 type CheckpointsService interface {
 	CheckpointsDoc(replicationId string, vbno uint16) (*metadata.CheckpointsDoc, error)
 	DelCheckpointsDoc(replicationId string, vbno uint16) error
@@ -21,4 +24,16 @@ type CheckpointsService interface {
 		xattr_seqno uint64, targetClusterVersion int) error
 	CheckpointsDocs(replicationId string) (map[uint16]*metadata.CheckpointsDoc, error)
 	GetVbnosFromCheckpointDocs(replicationId string) ([]uint16, error)
+	// removes checkpoint records with seqno larger than the specified seqno for vbno, and removes the checkpoint doc
+	// altogether when no records remain. returns the seqno replication will resume from for vbno
+	RewindCheckpointsDoc(replicationId string, vbno uint16, seqno uint64) (uint64, error)
+	// removes checkpoint records of vbno that can no longer be used to resume replication, given the current failover log
+	// of source vbucket and the current opaque of target vbucket. returns the number of records removed
+	VerifyCheckpointsDoc(replicationId string, vbno uint16, failoverLog [][2]uint64, targetVBOpaque metadata.TargetVBOpaque) (int, error)
+	// copies checkpoint docs of the specified replications from the previous checkpoints backend to the current one,
+	// without removing them from the previous backend. returns the number of checkpoint docs copied
+	MigrateCheckpoints(replicationIds []string) (int, error)
+	// removes checkpoint docs of the specified replications from the previous checkpoints backend
+	// returns the number of checkpoint docs removed
+	RemoveFallbackCheckpoints(replicationIds []string) (int, error)
 }
@@ -0,0 +1,36 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package service_def
+
+// a mutation that has lost source side conflict resolution and has not been sent to target
+type ConflictRecord struct {
+	Timestamp    string `json:"timestamp"`
+	Key          string `json:"key"`
+	VBucket      uint16 `json:"vbucket"`
+	Seqno        uint64 `json:"seqno"`
+	SourceCas    uint64 `json:"sourceCas"`
+	SourceRevSeq uint64 `json:"sourceRevSeq"`
+	TargetCas    uint64 `json:"targetCas"`
+	TargetRevSeq uint64 `json:"targetRevSeq"`
+}
+
+type ConflictLogSvc interface {
+	// queues a record to be appended to the conflict log of the specified replication.
+	// it does not block on file I/O. returns an error when the record cannot be queued and is dropped
+	Write(replicationId string, record *ConflictRecord) error
+
+	// returns up to limit records of the specified replication, starting from the record at offset,
+	// in the order in which they were written. oldest records may have been dropped because of log rotation
+	// total is the number of records currently available in the conflict log
+	Records(replicationId string, offset, limit int) (records []*ConflictRecord, total int, err error)
+
+	// removes the conflict log of the specified replication
+	DelLog(replicationId string) error
+}
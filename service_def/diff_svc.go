@@ -0,0 +1,153 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package service_def
+
+import (
+	"errors"
+	"github.com/couchbase/goxdcr/metadata"
+)
+
+var ErrorDiffJobNotFound = errors.New("No diff job has been run for the replication on this node")
+var ErrorDiffJobRunning = errors.New("A diff job is already running for the replication on this node")
+var ErrorDiffJobNotRunning = errors.New("Diff job for the replication is not running")
+var ErrorRepairJobNotFound = errors.New("No repair job has been run for the replication on this node")
+var ErrorRepairJobRunning = errors.New("A repair job is already running for the replication on this node")
+var ErrorRepairJobNotRunning = errors.New("Repair job for the replication is not running")
+var ErrorRepairNoKeys = errors.New("There are no documents to repair")
+var ErrorDiffSinkNotSupported = errors.New("Replications to sinks have no target bucket to compare with or repair")
+
+// types of differences between source and target documents
+const (
+	// document exists on source but not on target
+	DiffTypeMissing = "missing"
+	// document has been deleted on source but still exists on target
+	DiffTypeExtra = "extra"
+	// document exists on both source and target, with different metadata
+	DiffTypeMismatch = "mismatch"
+)
+
+// states of diff and repair jobs
+const (
+	DiffJobRunning   = "running"
+	DiffJobCompleted = "completed"
+	DiffJobFailed    = "failed"
+	DiffJobCancelled = "cancelled"
+)
+
+// metadata of a document that is compared between source and target
+type DiffDocMetadata struct {
+	Cas     uint64 `json:"cas"`
+	RevSeq  uint64 `json:"revSeq"`
+	Flags   uint32 `json:"flags"`
+	Expiry  uint32 `json:"expiry"`
+	Deleted bool   `json:"deleted"`
+}
+
+// a document that differs between source and target
+type DiffRecord struct {
+	Key     string `json:"key"`
+	VBucket uint16 `json:"vbucket"`
+	Type    string `json:"type"`
+	// nil when document does not exist, or has been purged, on source
+	Source *DiffDocMetadata `json:"source,omitempty"`
+	// nil when document does not exist on target
+	Target *DiffDocMetadata `json:"target,omitempty"`
+}
+
+// summary of the differences found in a vbucket
+type DiffVBSummary struct {
+	VBucket    uint16 `json:"vbucket"`
+	Compared   uint64 `json:"compared"`
+	Missing    uint64 `json:"missing"`
+	Extra      uint64 `json:"extra"`
+	Mismatched uint64 `json:"mismatched"`
+	Done       bool   `json:"done"`
+}
+
+type DiffJobStatus struct {
+	ReplicationId     string `json:"replicationId"`
+	State             string `json:"state"`
+	StartTime         string `json:"startTime"`
+	EndTime           string `json:"endTime,omitempty"`
+	TotalVBuckets     int    `json:"totalVBuckets"`
+	CompletedVBuckets int    `json:"completedVBuckets"`
+	Compared          uint64 `json:"compared"`
+	Missing           uint64 `json:"missing"`
+	Extra             uint64 `json:"extra"`
+	Mismatched        uint64 `json:"mismatched"`
+	// max number of documents compared per second
+	MaxDocsPerSecond int `json:"maxDocsPerSecond"`
+	// whether some differences have not been recorded since the number of differences exceeds the limit
+	Truncated bool   `json:"truncated,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// outcomes of repairing a document
+const (
+	// current source version of the document has been accepted by target
+	RepairOutcomeRepaired = "repaired"
+	// current source version of the document has lost conflict resolution against the target document
+	RepairOutcomeLostConflict = "lostConflictResolution"
+	// document does not exist on source, or its tombstone has been purged
+	RepairOutcomeNotFound = "notFoundOnSource"
+	// current source version of the document is not replicated because of the filter or bounded range of the replication
+	RepairOutcomeNotReplicated = "notReplicated"
+	// document belongs to a source vbucket that is not on the current node
+	RepairOutcomeNotLocal = "notOnThisNode"
+	RepairOutcomeFailed   = "failed"
+)
+
+// outcome of repairing a document
+type RepairRecord struct {
+	Key     string `json:"key"`
+	VBucket uint16 `json:"vbucket"`
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+type RepairJobStatus struct {
+	ReplicationId string `json:"replicationId"`
+	State         string `json:"state"`
+	StartTime     string `json:"startTime"`
+	EndTime       string `json:"endTime,omitempty"`
+	TotalKeys     int    `json:"totalKeys"`
+	ProcessedKeys int    `json:"processedKeys"`
+	Repaired      int    `json:"repaired"`
+	Error         string `json:"error,omitempty"`
+}
+
+type DiffSvc interface {
+	// starts a job in the background that compares the documents in the source vbuckets on the current node
+	// with the ones in target bucket. returns ErrorDiffJobRunning when there is already a running job for the replication.
+	// maxDocsPerSecond limits the impact of the job on source and target clusters. default is used when it is 0
+	StartDiff(spec *metadata.ReplicationSpecification, maxDocsPerSecond int) (*DiffJobStatus, error)
+
+	// status and progress of the latest diff job of the replication
+	DiffStatus(replicationId string) (*DiffJobStatus, error)
+
+	// per vbucket summaries and the differences found by the latest diff job of the replication
+	DiffResults(replicationId string) (*DiffJobStatus, []*DiffVBSummary, []*DiffRecord, error)
+
+	// cancels the running diff job of the replication
+	CancelDiff(replicationId string) error
+
+	// starts a job in the background that sends the current source versions of the documents with the specified keys
+	// to target, subject to conflict resolution, the same way as the replication would.
+	// when fromDiffResults is true, keys are ignored and the documents found different by the latest diff job are repaired.
+	// only documents in the source vbuckets on the current node are repaired.
+	// returns ErrorRepairJobRunning when there is already a running repair job for the replication
+	StartRepair(spec *metadata.ReplicationSpecification, keys []string, fromDiffResults bool) (*RepairJobStatus, error)
+
+	// status of the latest repair job of the replication, and the outcomes of the documents processed so far
+	RepairResults(replicationId string) (*RepairJobStatus, []*RepairRecord, error)
+
+	// cancels the running repair job of the replication
+	CancelRepair(replicationId string) error
+}
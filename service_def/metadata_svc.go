@@ -54,3 +54,11 @@ type MetadataSvc interface {
 	GetAllKeysFromCatalog(catalogKey string) ([]string, error)
 	DelAllFromCatalog(catalogKey string) error
 }
+
+// metadata service that can notify listeners of changes to metadata, as metakv does
+// metadata services that are not backed by metakv need to implement it for metadata change listeners to work
+type MetadataChangeObserver interface {
+	// calls callback for all existing metadata under dirpath, and then for every change to metadata under dirpath,
+	// until cancel is closed or callback returns error. value is nil when metadata is deleted
+	ObserveChildren(dirpath string, callback base.MetadataServiceCallback, cancel <-chan struct{}) error
+}
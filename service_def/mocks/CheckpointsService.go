@@ -106,6 +106,69 @@ func (_m *CheckpointsService) GetVbnosFromCheckpointDocs(replicationId string) (
 	return r0, r1
 }
 
+// MigrateCheckpoints provides a mock function with given fields: replicationIds
+func (_m *CheckpointsService) MigrateCheckpoints(replicationIds []string) (int, error) {
+	ret := _m.Called(replicationIds)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func([]string) int); ok {
+		r0 = rf(replicationIds)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]string) error); ok {
+		r1 = rf(replicationIds)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RemoveFallbackCheckpoints provides a mock function with given fields: replicationIds
+func (_m *CheckpointsService) RemoveFallbackCheckpoints(replicationIds []string) (int, error) {
+	ret := _m.Called(replicationIds)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func([]string) int); ok {
+		r0 = rf(replicationIds)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]string) error); ok {
+		r1 = rf(replicationIds)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RewindCheckpointsDoc provides a mock function with given fields: replicationId, vbno, seqno
+func (_m *CheckpointsService) RewindCheckpointsDoc(replicationId string, vbno uint16, seqno uint64) (uint64, error) {
+	ret := _m.Called(replicationId, vbno, seqno)
+
+	var r0 uint64
+	if rf, ok := ret.Get(0).(func(string, uint16, uint64) uint64); ok {
+		r0 = rf(replicationId, vbno, seqno)
+	} else {
+		r0 = ret.Get(0).(uint64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, uint16, uint64) error); ok {
+		r1 = rf(replicationId, vbno, seqno)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // UpsertCheckpoints provides a mock function with given fields: replicationId, specInternalId, vbno, ckpt_record, xattr_seqno, targetClusterVersion
 func (_m *CheckpointsService) UpsertCheckpoints(replicationId string, specInternalId string, vbno uint16, ckpt_record *metadata.CheckpointRecord, xattr_seqno uint64, targetClusterVersion int) error {
 	ret := _m.Called(replicationId, specInternalId, vbno, ckpt_record, xattr_seqno, targetClusterVersion)
@@ -119,3 +182,24 @@ func (_m *CheckpointsService) UpsertCheckpoints(replicationId string, specIntern
 
 	return r0
 }
+
+// VerifyCheckpointsDoc provides a mock function with given fields: replicationId, vbno, failoverLog, targetVBOpaque
+func (_m *CheckpointsService) VerifyCheckpointsDoc(replicationId string, vbno uint16, failoverLog [][2]uint64, targetVBOpaque metadata.TargetVBOpaque) (int, error) {
+	ret := _m.Called(replicationId, vbno, failoverLog, targetVBOpaque)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(string, uint16, [][2]uint64, metadata.TargetVBOpaque) int); ok {
+		r0 = rf(replicationId, vbno, failoverLog, targetVBOpaque)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, uint16, [][2]uint64, metadata.TargetVBOpaque) error); ok {
+		r1 = rf(replicationId, vbno, failoverLog, targetVBOpaque)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -0,0 +1,68 @@
+// Code generated by mockery v1.0.0
+package mocks
+
+import service_def "github.com/couchbase/goxdcr/service_def"
+import mock "github.com/stretchr/testify/mock"
+
+// ConflictLogSvc is an autogenerated mock type for the ConflictLogSvc type
+type ConflictLogSvc struct {
+	mock.Mock
+}
+
+// DelLog provides a mock function with given fields: replicationId
+func (_m *ConflictLogSvc) DelLog(replicationId string) error {
+	ret := _m.Called(replicationId)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(replicationId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Records provides a mock function with given fields: replicationId, offset, limit
+func (_m *ConflictLogSvc) Records(replicationId string, offset int, limit int) ([]*service_def.ConflictRecord, int, error) {
+	ret := _m.Called(replicationId, offset, limit)
+
+	var r0 []*service_def.ConflictRecord
+	if rf, ok := ret.Get(0).(func(string, int, int) []*service_def.ConflictRecord); ok {
+		r0 = rf(replicationId, offset, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*service_def.ConflictRecord)
+		}
+	}
+
+	var r1 int
+	if rf, ok := ret.Get(1).(func(string, int, int) int); ok {
+		r1 = rf(replicationId, offset, limit)
+	} else {
+		r1 = ret.Get(1).(int)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(string, int, int) error); ok {
+		r2 = rf(replicationId, offset, limit)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// Write provides a mock function with given fields: replicationId, record
+func (_m *ConflictLogSvc) Write(replicationId string, record *service_def.ConflictRecord) error {
+	ret := _m.Called(replicationId, record)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, *service_def.ConflictRecord) error); ok {
+		r0 = rf(replicationId, record)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
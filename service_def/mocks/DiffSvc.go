@@ -0,0 +1,181 @@
+// Code generated by mockery v1.0.0
+package mocks
+
+import metadata "github.com/couchbase/goxdcr/metadata"
+import mock "github.com/stretchr/testify/mock"
+import service_def "github.com/couchbase/goxdcr/service_def"
+
+// DiffSvc is an autogenerated mock type for the DiffSvc type
+type DiffSvc struct {
+	mock.Mock
+}
+
+// CancelDiff provides a mock function with given fields: replicationId
+func (_m *DiffSvc) CancelDiff(replicationId string) error {
+	ret := _m.Called(replicationId)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(replicationId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CancelRepair provides a mock function with given fields: replicationId
+func (_m *DiffSvc) CancelRepair(replicationId string) error {
+	ret := _m.Called(replicationId)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(replicationId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DiffResults provides a mock function with given fields: replicationId
+func (_m *DiffSvc) DiffResults(replicationId string) (*service_def.DiffJobStatus, []*service_def.DiffVBSummary, []*service_def.DiffRecord, error) {
+	ret := _m.Called(replicationId)
+
+	var r0 *service_def.DiffJobStatus
+	if rf, ok := ret.Get(0).(func(string) *service_def.DiffJobStatus); ok {
+		r0 = rf(replicationId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service_def.DiffJobStatus)
+		}
+	}
+
+	var r1 []*service_def.DiffVBSummary
+	if rf, ok := ret.Get(1).(func(string) []*service_def.DiffVBSummary); ok {
+		r1 = rf(replicationId)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).([]*service_def.DiffVBSummary)
+		}
+	}
+
+	var r2 []*service_def.DiffRecord
+	if rf, ok := ret.Get(2).(func(string) []*service_def.DiffRecord); ok {
+		r2 = rf(replicationId)
+	} else {
+		if ret.Get(2) != nil {
+			r2 = ret.Get(2).([]*service_def.DiffRecord)
+		}
+	}
+
+	var r3 error
+	if rf, ok := ret.Get(3).(func(string) error); ok {
+		r3 = rf(replicationId)
+	} else {
+		r3 = ret.Error(3)
+	}
+
+	return r0, r1, r2, r3
+}
+
+// DiffStatus provides a mock function with given fields: replicationId
+func (_m *DiffSvc) DiffStatus(replicationId string) (*service_def.DiffJobStatus, error) {
+	ret := _m.Called(replicationId)
+
+	var r0 *service_def.DiffJobStatus
+	if rf, ok := ret.Get(0).(func(string) *service_def.DiffJobStatus); ok {
+		r0 = rf(replicationId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service_def.DiffJobStatus)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(replicationId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RepairResults provides a mock function with given fields: replicationId
+func (_m *DiffSvc) RepairResults(replicationId string) (*service_def.RepairJobStatus, []*service_def.RepairRecord, error) {
+	ret := _m.Called(replicationId)
+
+	var r0 *service_def.RepairJobStatus
+	if rf, ok := ret.Get(0).(func(string) *service_def.RepairJobStatus); ok {
+		r0 = rf(replicationId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service_def.RepairJobStatus)
+		}
+	}
+
+	var r1 []*service_def.RepairRecord
+	if rf, ok := ret.Get(1).(func(string) []*service_def.RepairRecord); ok {
+		r1 = rf(replicationId)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).([]*service_def.RepairRecord)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(string) error); ok {
+		r2 = rf(replicationId)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// StartDiff provides a mock function with given fields: spec, maxDocsPerSecond
+func (_m *DiffSvc) StartDiff(spec *metadata.ReplicationSpecification, maxDocsPerSecond int) (*service_def.DiffJobStatus, error) {
+	ret := _m.Called(spec, maxDocsPerSecond)
+
+	var r0 *service_def.DiffJobStatus
+	if rf, ok := ret.Get(0).(func(*metadata.ReplicationSpecification, int) *service_def.DiffJobStatus); ok {
+		r0 = rf(spec, maxDocsPerSecond)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service_def.DiffJobStatus)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*metadata.ReplicationSpecification, int) error); ok {
+		r1 = rf(spec, maxDocsPerSecond)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// StartRepair provides a mock function with given fields: spec, keys, fromDiffResults
+func (_m *DiffSvc) StartRepair(spec *metadata.ReplicationSpecification, keys []string, fromDiffResults bool) (*service_def.RepairJobStatus, error) {
+	ret := _m.Called(spec, keys, fromDiffResults)
+
+	var r0 *service_def.RepairJobStatus
+	if rf, ok := ret.Get(0).(func(*metadata.ReplicationSpecification, []string, bool) *service_def.RepairJobStatus); ok {
+		r0 = rf(spec, keys, fromDiffResults)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service_def.RepairJobStatus)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*metadata.ReplicationSpecification, []string, bool) error); ok {
+		r1 = rf(spec, keys, fromDiffResults)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
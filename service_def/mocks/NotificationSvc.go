@@ -0,0 +1,15 @@
+// Code generated by mockery v1.0.0
+package mocks
+
+import metadata "github.com/couchbase/goxdcr/metadata"
+import mock "github.com/stretchr/testify/mock"
+
+// NotificationSvc is an autogenerated mock type for the NotificationSvc type
+type NotificationSvc struct {
+	mock.Mock
+}
+
+// Notify provides a mock function with given fields: event
+func (_m *NotificationSvc) Notify(event *metadata.WebhookEvent) {
+	_m.Called(event)
+}
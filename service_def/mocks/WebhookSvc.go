@@ -0,0 +1,98 @@
+// Code generated by mockery v1.0.0
+package mocks
+
+import metadata "github.com/couchbase/goxdcr/metadata"
+import mock "github.com/stretchr/testify/mock"
+
+// WebhookSvc is an autogenerated mock type for the WebhookSvc type
+type WebhookSvc struct {
+	mock.Mock
+}
+
+// AddWebhook provides a mock function with given fields: webhook
+func (_m *WebhookSvc) AddWebhook(webhook *metadata.Webhook) error {
+	ret := _m.Called(webhook)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*metadata.Webhook) error); ok {
+		r0 = rf(webhook)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DelWebhook provides a mock function with given fields: id
+func (_m *WebhookSvc) DelWebhook(id string) error {
+	ret := _m.Called(id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Webhook provides a mock function with given fields: id
+func (_m *WebhookSvc) Webhook(id string) (*metadata.Webhook, error) {
+	ret := _m.Called(id)
+
+	var r0 *metadata.Webhook
+	if rf, ok := ret.Get(0).(func(string) *metadata.Webhook); ok {
+		r0 = rf(id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*metadata.Webhook)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// WebhookServiceCallback provides a mock function with given fields: path, value, rev
+func (_m *WebhookSvc) WebhookServiceCallback(path string, value []byte, rev interface{}) error {
+	ret := _m.Called(path, value, rev)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, []byte, interface{}) error); ok {
+		r0 = rf(path, value, rev)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Webhooks provides a mock function with given fields:
+func (_m *WebhookSvc) Webhooks() ([]*metadata.Webhook, error) {
+	ret := _m.Called()
+
+	var r0 []*metadata.Webhook
+	if rf, ok := ret.Get(0).(func() []*metadata.Webhook); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*metadata.Webhook)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
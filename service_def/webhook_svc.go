@@ -0,0 +1,28 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package service_def
+
+import (
+	"github.com/couchbase/goxdcr/metadata"
+)
+
+type WebhookSvc interface {
+	Webhooks() ([]*metadata.Webhook, error)
+	Webhook(id string) (*metadata.Webhook, error)
+	AddWebhook(webhook *metadata.Webhook) error
+	DelWebhook(id string) error
+	// callback for metakv change listener, which is called when webhooks are changed
+	WebhookServiceCallback(path string, value []byte, rev interface{}) error
+}
+
+type NotificationSvc interface {
+	// queues the event for delivery to the webhooks that are subscribed to its event type. does not block
+	Notify(event *metadata.WebhookEvent)
+}
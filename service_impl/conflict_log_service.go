@@ -0,0 +1,253 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package service_impl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/service_def"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+const ConflictLogFilePrefix = "xdcr_conflicts_"
+const ConflictLogFileSuffix = ".log"
+
+var ErrorInvalidConflictLogQuery = errors.New("offset and limit of conflict log query cannot be negative")
+var ErrorConflictLogQueueFull = errors.New("conflict log queue is full")
+
+// conflict log of a replication
+type conflictLog struct {
+	fileName string
+	writer   *log.RotatingLogFileWriter
+	// write lock is held when log files are read, so that they are not rotated in the middle of a read.
+	// writes hold read lock since RotatingLogFileWriter serializes writes itself
+	lock sync.RWMutex
+}
+
+// a record queued for writing. flushed, when not nil, is closed once all records queued before it have been written
+type conflictLogRequest struct {
+	replicationId string
+	record        *service_def.ConflictRecord
+	flushed       chan bool
+}
+
+// ConflictLogService keeps the conflict log of each replication in a set of rotating files
+// under the log directory, with one json encoded ConflictRecord per line.
+// records are queued and written by a background routine, so that Write never blocks the replication
+type ConflictLogService struct {
+	logFileDir          string
+	maxLogFileSize      uint64
+	maxNumberOfLogFiles uint64
+
+	logs     map[string]*conflictLog
+	logsLock sync.Mutex
+
+	requestCh chan *conflictLogRequest
+	// number of records dropped since the last time it was reported
+	droppedCount uint64
+
+	logger *log.CommonLogger
+}
+
+func NewConflictLogSvc(logFileDir string, logger_ctx *log.LoggerContext) *ConflictLogService {
+	if logFileDir == "" {
+		// log directory is not specified when goxdcr is run outside of couchbase server
+		logFileDir = os.TempDir()
+	}
+	service := &ConflictLogService{
+		logFileDir:          logFileDir,
+		maxLogFileSize:      base.ConflictLogMaxFileSize,
+		maxNumberOfLogFiles: base.ConflictLogMaxNumberOfFiles,
+		logs:                make(map[string]*conflictLog),
+		requestCh:           make(chan *conflictLogRequest, base.ConflictLogQueueSize),
+		logger:              log.NewLogger("ConflictLogSvc", logger_ctx),
+	}
+
+	go service.run()
+
+	return service
+}
+
+func (service *ConflictLogService) Write(replicationId string, record *service_def.ConflictRecord) error {
+	select {
+	case service.requestCh <- &conflictLogRequest{replicationId: replicationId, record: record}:
+		return nil
+	default:
+		atomic.AddUint64(&service.droppedCount, 1)
+		return ErrorConflictLogQueueFull
+	}
+}
+
+func (service *ConflictLogService) run() {
+	for request := range service.requestCh {
+		if request.flushed != nil {
+			close(request.flushed)
+			continue
+		}
+
+		droppedCount := atomic.SwapUint64(&service.droppedCount, 0)
+		if droppedCount > 0 {
+			service.logger.Warnf("Conflict log queue was full. Dropped %v records\n", droppedCount)
+		}
+
+		err := service.writeRecord(request.replicationId, request.record)
+		if err != nil {
+			service.logger.Warnf("Failed to write conflict log for replication %v. key=%v%v%v, err=%v\n", request.replicationId,
+				base.UdTagBegin, request.record.Key, base.UdTagEnd, err)
+		}
+	}
+}
+
+// waits until all records queued so far have been written
+func (service *ConflictLogService) flush() {
+	flushed := make(chan bool)
+	service.requestCh <- &conflictLogRequest{flushed: flushed}
+	<-flushed
+}
+
+func (service *ConflictLogService) writeRecord(replicationId string, record *service_def.ConflictRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	replLog, err := service.getOrCreateLog(replicationId)
+	if err != nil {
+		return err
+	}
+
+	replLog.lock.RLock()
+	defer replLog.lock.RUnlock()
+	_, err = replLog.writer.Write(data)
+	return err
+}
+
+func (service *ConflictLogService) Records(replicationId string, offset, limit int) ([]*service_def.ConflictRecord, int, error) {
+	if offset < 0 || limit < 0 {
+		return nil, 0, ErrorInvalidConflictLogQuery
+	}
+
+	records := make([]*service_def.ConflictRecord, 0)
+	total := 0
+
+	service.logsLock.Lock()
+	replLog, ok := service.logs[replicationId]
+	service.logsLock.Unlock()
+
+	fileName := service.getLogFileName(replicationId)
+	if ok {
+		replLog.lock.Lock()
+		defer replLog.lock.Unlock()
+	}
+
+	// read log files from the oldest to the newest
+	for _, name := range service.getLogFileNames(fileName) {
+		file, err := os.Open(name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, 0, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			record := &service_def.ConflictRecord{}
+			err = json.Unmarshal(scanner.Bytes(), record)
+			if err != nil {
+				// the last record could have been partially written when process crashed. skip it,
+				// and do not count it, so that offset and total refer to the records that can be returned
+				service.logger.Warnf("Skipping corrupted record in conflict log %v. err=%v", name, err)
+				continue
+			}
+			if total >= offset && len(records) < limit {
+				records = append(records, record)
+			}
+			total++
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return records, total, nil
+}
+
+func (service *ConflictLogService) DelLog(replicationId string) error {
+	service.logsLock.Lock()
+	defer service.logsLock.Unlock()
+
+	fileName := service.getLogFileName(replicationId)
+	if replLog, ok := service.logs[replicationId]; ok {
+		replLog.lock.Lock()
+		defer replLog.lock.Unlock()
+		err := replLog.writer.Close()
+		if err != nil {
+			service.logger.Warnf("Error closing conflict log %v. err=%v", fileName, err)
+		}
+		delete(service.logs, replicationId)
+	}
+
+	for _, name := range service.getLogFileNames(fileName) {
+		err := os.Remove(name)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	service.logger.Infof("Removed conflict log for replication %v", replicationId)
+	return nil
+}
+
+func (service *ConflictLogService) getOrCreateLog(replicationId string) (*conflictLog, error) {
+	service.logsLock.Lock()
+	defer service.logsLock.Unlock()
+
+	if replLog, ok := service.logs[replicationId]; ok {
+		return replLog, nil
+	}
+
+	fileName := service.getLogFileName(replicationId)
+	writer, err := log.NewRotatingLogFileWriter(fileName, service.maxLogFileSize, service.maxNumberOfLogFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	replLog := &conflictLog{fileName: fileName, writer: writer}
+	service.logs[replicationId] = replLog
+	service.logger.Infof("Created conflict log %v for replication %v", fileName, replicationId)
+	return replLog, nil
+}
+
+// replication id contains "/" and needs to be escaped to be used in file name
+func (service *ConflictLogService) getLogFileName(replicationId string) string {
+	return filepath.Join(service.logFileDir, ConflictLogFilePrefix+url.QueryEscape(replicationId)+ConflictLogFileSuffix)
+}
+
+// returns the names of all potential log files, including rotated ones, from the oldest to the newest
+func (service *ConflictLogService) getLogFileNames(fileName string) []string {
+	names := make([]string, 0, service.maxNumberOfLogFiles)
+	for i := service.maxNumberOfLogFiles - 1; i > 0; i-- {
+		names = append(names, fmt.Sprintf("%v.%v", fileName, i))
+	}
+	names = append(names, fileName)
+	return names
+}
@@ -0,0 +1,145 @@
+// +build !pcre
+
+package service_impl
+
+import (
+	"fmt"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/service_def"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const conflictLogTestReplId = "remoteClusterUuid/sourceBucket/targetBucket"
+
+func setupConflictLogBoilerPlate(t *testing.T) (*ConflictLogService, string) {
+	dir, err := ioutil.TempDir("", "conflictLogTest")
+	assert.Nil(t, err)
+	return NewConflictLogSvc(dir, log.DefaultLoggerContext), dir
+}
+
+func writeConflictRecords(t *testing.T, service *ConflictLogService, start, count int) {
+	for i := start; i < start+count; i++ {
+		record := &service_def.ConflictRecord{Key: fmt.Sprintf("key%v", i), VBucket: uint16(i % 1024), Seqno: uint64(i),
+			SourceCas: uint64(i), SourceRevSeq: 1, TargetCas: uint64(i + 1), TargetRevSeq: 2}
+		assert.Nil(t, service.Write(conflictLogTestReplId, record))
+	}
+	service.flush()
+}
+
+func TestConflictLogPaging(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestConflictLogPaging =================")
+	service, dir := setupConflictLogBoilerPlate(t)
+	defer os.RemoveAll(dir)
+
+	records, total, err := service.Records(conflictLogTestReplId, 0, 10)
+	assert.Nil(err)
+	assert.Equal(0, total)
+	assert.Equal(0, len(records))
+
+	writeConflictRecords(t, service, 0, 25)
+
+	records, total, err = service.Records(conflictLogTestReplId, 10, 10)
+	assert.Nil(err)
+	assert.Equal(25, total)
+	assert.Equal(10, len(records))
+	assert.Equal("key10", records[0].Key)
+	assert.Equal(uint64(11), records[0].TargetCas)
+
+	records, total, err = service.Records(conflictLogTestReplId, 20, 10)
+	assert.Nil(err)
+	assert.Equal(5, len(records))
+	assert.Equal("key24", records[4].Key)
+
+	_, _, err = service.Records(conflictLogTestReplId, -1, 10)
+	assert.Equal(ErrorInvalidConflictLogQuery, err)
+
+	assert.Nil(service.DelLog(conflictLogTestReplId))
+	records, total, err = service.Records(conflictLogTestReplId, 0, 10)
+	assert.Nil(err)
+	assert.Equal(0, total)
+	fmt.Println("============== Test case end: TestConflictLogPaging =================")
+}
+
+func TestConflictLogRotation(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestConflictLogRotation =================")
+	service, dir := setupConflictLogBoilerPlate(t)
+	defer os.RemoveAll(dir)
+	// small files so that every few records trigger a rotation
+	service.maxLogFileSize = 512
+	service.maxNumberOfLogFiles = 3
+
+	writeConflictRecords(t, service, 0, 100)
+
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(err)
+	assert.Equal(3, len(files))
+
+	// oldest records have been dropped. remaining records are returned in the order in which they were written
+	records, total, err := service.Records(conflictLogTestReplId, 0, 100)
+	assert.Nil(err)
+	assert.True(total > 0 && total < 100)
+	assert.Equal(total, len(records))
+	assert.Equal("key99", records[total-1].Key)
+	for i := 1; i < len(records); i++ {
+		assert.Equal(records[i-1].Seqno+1, records[i].Seqno)
+	}
+
+	assert.Nil(service.DelLog(conflictLogTestReplId))
+	files, err = ioutil.ReadDir(dir)
+	assert.Nil(err)
+	assert.Equal(0, len(files))
+	fmt.Println("============== Test case end: TestConflictLogRotation =================")
+}
+
+func TestConflictLogSkipsCorruptedRecords(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestConflictLogSkipsCorruptedRecords =================")
+	service, dir := setupConflictLogBoilerPlate(t)
+	defer os.RemoveAll(dir)
+
+	writeConflictRecords(t, service, 0, 5)
+	// simulate a record partially written when process crashed, followed by more records
+	file, err := os.OpenFile(service.getLogFileName(conflictLogTestReplId), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(err)
+	_, err = file.Write([]byte("{\"key\":\"partial\n"))
+	assert.Nil(err)
+	file.Close()
+	writeConflictRecords(t, service, 5, 5)
+
+	// corrupted record is not counted, so that total and offset match the records returned
+	records, total, err := service.Records(conflictLogTestReplId, 0, 100)
+	assert.Nil(err)
+	assert.Equal(10, total)
+	assert.Equal(10, len(records))
+
+	records, total, err = service.Records(conflictLogTestReplId, 5, 2)
+	assert.Nil(err)
+	assert.Equal(10, total)
+	assert.Equal(2, len(records))
+	assert.Equal("key5", records[0].Key)
+	assert.Equal("key6", records[1].Key)
+	fmt.Println("============== Test case end: TestConflictLogSkipsCorruptedRecords =================")
+}
+
+func TestConflictLogQueueFull(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestConflictLogQueueFull =================")
+	dir, err := ioutil.TempDir("", "conflictLogTest")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	// service without background routine, so that queued records are not consumed
+	service := &ConflictLogService{logFileDir: dir, requestCh: make(chan *conflictLogRequest, 2),
+		logs: make(map[string]*conflictLog), logger: log.NewLogger("ConflictLogSvc", log.DefaultLoggerContext)}
+
+	record := &service_def.ConflictRecord{Key: "key"}
+	assert.Nil(service.Write(conflictLogTestReplId, record))
+	assert.Nil(service.Write(conflictLogTestReplId, record))
+	assert.Equal(ErrorConflictLogQueueFull, service.Write(conflictLogTestReplId, record))
+	assert.Equal(uint64(1), service.droppedCount)
+	fmt.Println("============== Test case end: TestConflictLogQueueFull =================")
+}
@@ -0,0 +1,598 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package service_impl
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	mc "github.com/couchbase/gomemcached"
+	mcc "github.com/couchbase/gomemcached/client"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/metadata"
+	"github.com/couchbase/goxdcr/parts"
+	"github.com/couchbase/goxdcr/service_def"
+	utilities "github.com/couchbase/goxdcr/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a repair job sends the current source versions of a list of documents to target, through setMeta and delMeta requests
+// composed the same way as in router and xmem, including the application of transformation rules, so that they go
+// through the same conflict resolution as replicated mutations.
+// current source version of a document, including its xattrs, is read through getMeta and subdoc lookups
+type repairJob struct {
+	jobContext
+	status service_def.RepairJobStatus
+	// outcomes of the documents processed so far, in the order that they are processed
+	records []*service_def.RepairRecord
+	// protects status and records
+	lock sync.RWMutex
+
+	// the following are used by the job routine only
+	keys []string
+	// connection to source bucket on the current node
+	sourceClient     mcc.ClientIface
+	conflictResolver base.ConflictResolver
+	// when a custom conflict resolver is used, target is told to skip its own conflict resolution
+	// for documents that have won source side conflict resolution, the same way as in xmem
+	customConflictResolver bool
+}
+
+func (service *DiffService) StartRepair(spec *metadata.ReplicationSpecification, keys []string, fromDiffResults bool) (*service_def.RepairJobStatus, error) {
+	if spec.Settings.IsSink() {
+		return nil, service_def.ErrorDiffSinkNotSupported
+	}
+	if fromDiffResults {
+		var err error
+		keys, err = service.getKeysFromDiffResults(spec.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	keys = dedupeKeys(keys)
+	if len(keys) == 0 {
+		return nil, service_def.ErrorRepairNoKeys
+	}
+	if len(keys) > base.RepairMaxKeys {
+		return nil, fmt.Errorf("Number of documents to repair, %v, exceeds the limit of %v", len(keys), base.RepairMaxKeys)
+	}
+	conflictResolver, err := base.GetConflictResolver(spec.Settings.GetConflictResolver())
+	if err != nil {
+		return nil, err
+	}
+
+	service.repairJobsLock.Lock()
+	defer service.repairJobsLock.Unlock()
+
+	if job, ok := service.repairJobs[spec.Id]; ok && job.getStatus().State == service_def.DiffJobRunning {
+		return nil, service_def.ErrorRepairJobRunning
+	}
+
+	job := &repairJob{
+		jobContext: newJobContext(spec, "Repair", base.DiffDefaultMaxDocsPerSecond),
+		status: service_def.RepairJobStatus{
+			ReplicationId: spec.Id,
+			State:         service_def.DiffJobRunning,
+			StartTime:     log.FormatTimeWithMilliSecondPrecision(time.Now()),
+			TotalKeys:     len(keys),
+		},
+		records:                make([]*service_def.RepairRecord, 0, len(keys)),
+		keys:                   keys,
+		conflictResolver:       conflictResolver,
+		customConflictResolver: base.IsCustomConflictResolver(spec.Settings.GetConflictResolver()),
+	}
+	service.repairJobs[spec.Id] = job
+
+	service.logger.Infof("Starting repair job for replication %v. numOfKeys=%v fromDiffResults=%v\n", spec.Id, len(keys), fromDiffResults)
+	go service.runRepairJob(job)
+
+	return job.getStatus(), nil
+}
+
+func (service *DiffService) RepairResults(replicationId string) (*service_def.RepairJobStatus, []*service_def.RepairRecord, error) {
+	job, err := service.getRepairJob(replicationId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	job.lock.RLock()
+	defer job.lock.RUnlock()
+	status := job.status
+	records := make([]*service_def.RepairRecord, len(job.records))
+	copy(records, job.records)
+	return &status, records, nil
+}
+
+func (service *DiffService) CancelRepair(replicationId string) error {
+	job, err := service.getRepairJob(replicationId)
+	if err != nil {
+		return err
+	}
+
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	if job.status.State != service_def.DiffJobRunning {
+		return service_def.ErrorRepairJobNotRunning
+	}
+	job.cancel()
+	return nil
+}
+
+func (service *DiffService) getRepairJob(replicationId string) (*repairJob, error) {
+	service.repairJobsLock.RLock()
+	defer service.repairJobsLock.RUnlock()
+	job, ok := service.repairJobs[replicationId]
+	if !ok {
+		return nil, service_def.ErrorRepairJobNotFound
+	}
+	return job, nil
+}
+
+// keys of the documents found different by the latest diff job of the replication
+func (service *DiffService) getKeysFromDiffResults(replicationId string) ([]string, error) {
+	status, _, records, err := service.DiffResults(replicationId)
+	if err != nil {
+		return nil, err
+	}
+	if status.State == service_def.DiffJobRunning {
+		return nil, service_def.ErrorDiffJobRunning
+	}
+	keys := make([]string, 0, len(records))
+	for _, record := range records {
+		keys = append(keys, record.Key)
+	}
+	return keys, nil
+}
+
+func (service *DiffService) runRepairJob(job *repairJob) {
+	err := service.runRepairJobInner(job)
+	service.closeConnections(&job.jobContext)
+	if job.sourceClient != nil {
+		job.sourceClient.Close()
+	}
+
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	job.status.EndTime = log.FormatTimeWithMilliSecondPrecision(time.Now())
+	if err == nil {
+		job.status.State = service_def.DiffJobCompleted
+		service.logger.Infof("Repair job for replication %v has completed. processed=%v repaired=%v\n",
+			job.spec.Id, job.status.ProcessedKeys, job.status.Repaired)
+	} else if err == errorJobCancelled {
+		job.status.State = service_def.DiffJobCancelled
+		service.logger.Infof("Repair job for replication %v has been cancelled\n", job.spec.Id)
+	} else {
+		job.status.State = service_def.DiffJobFailed
+		job.status.Error = err.Error()
+		service.logger.Errorf("Repair job for replication %v has failed. err=%v\n", job.spec.Id, err)
+	}
+}
+
+func (service *DiffService) runRepairJobInner(job *repairJob) error {
+	localVBs, err := service.getLocalVBs(job.spec)
+	if err != nil {
+		return err
+	}
+	numOfSourceVBs, err := service.getNumOfSourceVBs(job.spec)
+	if err != nil {
+		return err
+	}
+
+	err = service.initReplicationSettings(&job.jobContext)
+	if err != nil {
+		return err
+	}
+
+	// xattrs of documents need to be sent to target
+	err = service.initTargetConnections(&job.jobContext, true /*xattrEnabled*/)
+	if err != nil {
+		return err
+	}
+
+	vbKeys, notLocalRecords := groupKeysByVB(job.keys, localVBs, numOfSourceVBs)
+	job.addRecords(notLocalRecords)
+	if len(vbKeys) == 0 {
+		return nil
+	}
+
+	err = service.initSourceClient(job)
+	if err != nil {
+		return err
+	}
+
+	vbnos := make([]uint16, 0, len(vbKeys))
+	for vbno := range vbKeys {
+		vbnos = append(vbnos, vbno)
+	}
+	vbnos = base.SortUint16List(vbnos)
+
+	for _, vbno := range vbnos {
+		err = service.repairVB(job, vbno, vbKeys[vbno])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// number of vbuckets of source bucket
+func (service *DiffService) getNumOfSourceVBs(spec *metadata.ReplicationSpecification) (int, error) {
+	server_vbmap, err := service.cluster_info_svc.GetLocalServerVBucketsMap(service.xdcr_topology_svc, spec.SourceBucketName)
+	if err != nil {
+		return 0, err
+	}
+	numOfVBs := 0
+	for _, vblist := range server_vbmap {
+		numOfVBs += len(vblist)
+	}
+	if numOfVBs == 0 {
+		return 0, fmt.Errorf("Cannot find vbuckets of source bucket %v", spec.SourceBucketName)
+	}
+	return numOfVBs, nil
+}
+
+// opens a connection to source bucket on the current node, with xattrs enabled,
+// for reading the current versions of documents
+func (service *DiffService) initSourceClient(job *repairJob) error {
+	spec := job.spec
+	addr, err := service.xdcr_topology_svc.MyMemcachedAddr()
+	if err != nil {
+		return err
+	}
+	userAgent := base.ComposeUserAgentWithBucketNames("Goxdcr "+job.jobType, spec.SourceBucketName, spec.TargetBucketName)
+	job.sourceClient, err = service.utils.GetMemcachedConnection(addr, spec.SourceBucketName, userAgent, base.KeepAlivePeriod, service.logger)
+	if err != nil {
+		return err
+	}
+	features, err := service.utils.SendHELOWithFeatures(job.sourceClient, userAgent, base.HELOTimeout, base.HELOTimeout, utilities.HELOFeatures{Xattribute: true}, service.logger)
+	if err != nil {
+		return err
+	}
+	if !features.Xattribute {
+		return fmt.Errorf("Source bucket %v does not support xattrs", spec.SourceBucketName)
+	}
+	return nil
+}
+
+// reads the current versions of the documents with the specified keys from vbno of source, one key at a time,
+// and sends the ones that are replicated to target
+func (service *DiffService) repairVB(job *repairJob, vbno uint16, keys []string) error {
+	records := make([]*service_def.RepairRecord, 0)
+	// source and target buckets may have different numbers of vbuckets
+	eventsToSend := make(map[uint16][]*mcc.UprEvent)
+	for _, key := range keys {
+		err := job.throttle(1)
+		if err != nil {
+			return err
+		}
+		event, readErr, err := service.readSourceDocument(job, vbno, key)
+		if err != nil {
+			return err
+		}
+		if readErr != nil {
+			records = append(records, &service_def.RepairRecord{Key: key, VBucket: vbno, Outcome: service_def.RepairOutcomeFailed, Error: readErr.Error()})
+		} else if event == nil {
+			records = append(records, &service_def.RepairRecord{Key: key, VBucket: vbno, Outcome: service_def.RepairOutcomeNotFound})
+		} else if !service.isReplicated(&job.jobContext, event) {
+			records = append(records, &service_def.RepairRecord{Key: key, VBucket: vbno, Outcome: service_def.RepairOutcomeNotReplicated})
+		} else {
+			targetVB := base.GetVBucketForKey(event.Key, len(job.targetVBServerMap))
+			eventsToSend[targetVB] = append(eventsToSend[targetVB], event)
+		}
+	}
+	job.addRecords(records)
+
+	targetVBs := make([]uint16, 0, len(eventsToSend))
+	for targetVB := range eventsToSend {
+		targetVBs = append(targetVBs, targetVB)
+	}
+	targetVBs = base.SortUint16List(targetVBs)
+
+	for _, targetVB := range targetVBs {
+		events := eventsToSend[targetVB]
+		for len(events) > 0 {
+			select {
+			case <-job.finCh:
+				return errorJobCancelled
+			default:
+			}
+
+			batchSize := base.IntMin(base.DiffGetMetaBatchSize, len(events))
+			err := service.repairBatch(job, vbno, targetVB, events[:batchSize])
+			if err != nil {
+				return err
+			}
+			events = events[batchSize:]
+		}
+	}
+	return nil
+}
+
+// reads the current version of a document from vbno of source through getMeta and subdoc lookups, and returns
+// the dcp mutation or deletion that would have been streamed for it, or nil when the document does not exist.
+// readErr is returned when the document cannot be read, and err when the connection to source has failed
+func (service *DiffService) readSourceDocument(job *repairJob, vbno uint16, key string) (event *mcc.UprEvent, readErr error, err error) {
+	// the lookups are retried when the document changes in between
+	for attempt := 0; attempt <= base.RepairMaxReadRetry; attempt++ {
+		var changed bool
+		event, changed, readErr, err = service.readSourceDocumentOnce(job, vbno, key)
+		if err != nil || readErr != nil || !changed {
+			return
+		}
+	}
+	return nil, fmt.Errorf("Document kept changing while being read from source"), nil
+}
+
+func (service *DiffService) readSourceDocumentOnce(job *repairJob, vbno uint16, key string) (event *mcc.UprEvent, changed bool, readErr error, err error) {
+	resp, err := service.sendToSource(job, parts.ComposeRequestForGetMeta(key, vbno, 0 /*opaque*/, true /*xattrEnabled*/))
+	if err != nil {
+		return
+	}
+	if resp.Status == mc.KEY_ENOENT {
+		return
+	}
+	if resp.Status != mc.SUCCESS {
+		readErr = fmt.Errorf("Received error response with status %v for getMeta from source", resp.Status)
+		return
+	}
+	meta, readErr := parts.DecodeGetMetaResp([]byte(key), resp, true /*xattrEnabled*/)
+	if readErr != nil {
+		return
+	}
+
+	// seqno is needed by bounded range, and the names of xattrs for reading the xattrs along with the body
+	xattrNames := []string{base.SubdocDocumentSeqno, base.SubdocXattrTOC}
+	resp, err = service.sendToSource(job, parts.ComposeRequestForGetXattrs(key, vbno, 0 /*opaque*/, xattrNames))
+	if err != nil {
+		return
+	}
+	if resp.Status == mc.KEY_ENOENT || resp.Cas != meta.Cas() {
+		changed = true
+		return
+	}
+	xattrs, readErr := parts.DecodeGetXattrsResp(resp, xattrNames)
+	if readErr != nil {
+		return
+	}
+	seqno, readErr := strconv.ParseUint(strings.Trim(xattrs[base.SubdocDocumentSeqno], "\""), 0, 64)
+	if readErr != nil {
+		return
+	}
+
+	doc := &base.Document{Metadata: meta, Xattrs: make(map[string]string)}
+	if !meta.IsDeletion() {
+		var docXattrNames []string
+		if toc, ok := xattrs[base.SubdocXattrTOC]; ok {
+			readErr = json.Unmarshal([]byte(toc), &docXattrNames)
+			if readErr != nil {
+				return
+			}
+		}
+		// body is read along with at most SubdocMaxPaths-1 xattrs in each lookup
+		for {
+			batchSize := base.IntMin(base.SubdocMaxPaths-1, len(docXattrNames))
+			batchNames := docXattrNames[:batchSize]
+			resp, err = service.sendToSource(job, parts.ComposeRequestForGetDocument(key, vbno, 0 /*opaque*/, batchNames))
+			if err != nil {
+				return
+			}
+			if resp.Status == mc.KEY_ENOENT || resp.Cas != meta.Cas() {
+				changed = true
+				return
+			}
+			var batchDoc *base.Document
+			batchDoc, readErr = parts.DecodeGetDocumentResp(resp, meta, batchNames)
+			if readErr != nil {
+				return
+			}
+			for name, value := range batchDoc.Xattrs {
+				doc.Xattrs[name] = value
+			}
+			doc.Body = batchDoc.Body
+			docXattrNames = docXattrNames[batchSize:]
+			if len(docXattrNames) == 0 {
+				break
+			}
+		}
+	}
+	event = parts.ComposeUprEventForDocument(doc, vbno, seqno)
+	return
+}
+
+func (service *DiffService) sendToSource(job *repairJob, req *mc.MCRequest) (*mc.MCResponse, error) {
+	err := job.sourceClient.Transmit(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := job.sourceClient.ReceiveWithDeadline(time.Now().Add(base.DiffReadTimeout))
+	if err != nil && resp == nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// resolves conflicts between the source versions of a batch of documents in sourceVB and the target documents,
+// which are in targetVB, and sends the source versions that win to target
+func (service *DiffService) repairBatch(job *repairJob, sourceVB, targetVB uint16, events []*mcc.UprEvent) error {
+	server_addr, ok := job.targetVBServerMap[targetVB]
+	if !ok {
+		return fmt.Errorf("Cannot find target server for vb %v", targetVB)
+	}
+	client := job.targetClients[server_addr]
+
+	// setMeta and delMeta requests are composed upfront, since transformation rules may change
+	// the expiry and xattrs of documents, which are used in source side conflict resolution
+	setMetaReqs := make([]*mc.MCRequest, len(events))
+	for i, event := range events {
+		var err error
+		setMetaReqs[i], err = parts.ComposeRequestForSetMeta(event, job.sourceCRMode, uint32(i), job.transformer)
+		if err != nil {
+			return err
+		}
+		setMetaReqs[i].VBucket = targetVB
+	}
+
+	for i, event := range events {
+		err := client.Transmit(parts.ComposeRequestForGetMeta(string(event.Key), targetVB, uint32(i), true /*xattrEnabled*/))
+		if err != nil {
+			return err
+		}
+	}
+
+	records := make([]*service_def.RepairRecord, len(events))
+	for i, event := range events {
+		records[i] = &service_def.RepairRecord{Key: string(event.Key), VBucket: sourceVB}
+	}
+	indexesToSend := make([]int, 0, len(events))
+	// indexes of documents that exist on target and have won source side conflict resolution
+	wonSourceCR := make(map[int]bool)
+	for range events {
+		resp, err := client.ReceiveWithDeadline(time.Now().Add(base.DiffReadTimeout))
+		if err != nil && resp == nil {
+			return err
+		}
+		if int(resp.Opaque) >= len(events) {
+			return fmt.Errorf("Received getMeta response with unexpected opaque %v", resp.Opaque)
+		}
+		index := int(resp.Opaque)
+		event := events[index]
+		switch resp.Status {
+		case mc.SUCCESS:
+			targetMeta, err := parts.DecodeGetMetaResp(event.Key, resp, true /*xattrEnabled*/)
+			if err != nil {
+				records[index].Outcome = service_def.RepairOutcomeFailed
+				records[index].Error = err.Error()
+				continue
+			}
+			setMetaReq := setMetaReqs[index]
+			sourceMeta := base.NewDocumentMetadata(event.Key, event.RevSeqno, event.Cas, event.Flags, binary.BigEndian.Uint32(setMetaReq.Extras[4:8]),
+				event.Opcode != mc.UPR_MUTATION, setMetaReq.DataType)
+			if !job.conflictResolver.Resolve(sourceMeta, targetMeta, job.sourceCRMode, true /*xattrEnabled*/, service.logger) {
+				records[index].Outcome = service_def.RepairOutcomeLostConflict
+				continue
+			}
+			wonSourceCR[index] = true
+			indexesToSend = append(indexesToSend, index)
+		case mc.KEY_ENOENT:
+			// document does not exist on target
+			indexesToSend = append(indexesToSend, index)
+		default:
+			records[index].Outcome = service_def.RepairOutcomeFailed
+			records[index].Error = fmt.Sprintf("Received error response with status %v for getMeta", resp.Status)
+		}
+	}
+
+	for _, index := range indexesToSend {
+		req := setMetaReqs[index]
+		if job.customConflictResolver && wonSourceCR[index] {
+			parts.SetSkipConflictResolution(req)
+		}
+	}
+
+	// responses are handled the same way as in xmem, where requests with temporary errors are resent with backoff
+	for attempt := 0; len(indexesToSend) > 0; attempt++ {
+		if attempt > 0 {
+			time.Sleep(base.XmemBackoffWaitTime * time.Duration(attempt))
+		}
+		for _, index := range indexesToSend {
+			err := client.Transmit(setMetaReqs[index])
+			if err != nil {
+				return err
+			}
+		}
+
+		indexesToResend := make([]int, 0)
+		for range indexesToSend {
+			resp, err := client.ReceiveWithDeadline(time.Now().Add(base.DiffReadTimeout))
+			if err != nil && resp == nil {
+				return err
+			}
+			if int(resp.Opaque) >= len(events) {
+				return fmt.Errorf("Received setMeta response with unexpected opaque %v", resp.Opaque)
+			}
+			record := records[resp.Opaque]
+			switch parts.GetSetMetaResponseAction(resp.Status) {
+			case parts.SetMetaRespDone:
+				if resp.Status == mc.KEY_EEXISTS {
+					// lost conflict resolution on target
+					record.Outcome = service_def.RepairOutcomeLostConflict
+				} else {
+					record.Outcome = service_def.RepairOutcomeRepaired
+				}
+			case parts.SetMetaRespResend:
+				if attempt < base.XmemMaxRetry {
+					indexesToResend = append(indexesToResend, int(resp.Opaque))
+					continue
+				}
+				record.Outcome = service_def.RepairOutcomeFailed
+				record.Error = fmt.Sprintf("Received error response with status %v for setMeta after %v retries", resp.Status, attempt)
+			default:
+				record.Outcome = service_def.RepairOutcomeFailed
+				record.Error = fmt.Sprintf("Received error response with status %v for setMeta", resp.Status)
+			}
+		}
+		indexesToSend = indexesToResend
+	}
+
+	job.addRecords(records)
+	return nil
+}
+
+// groups keys by the source vbuckets they belong to. keys in vbuckets not in localVBs get RepairOutcomeNotLocal records
+func groupKeysByVB(keys []string, localVBs []uint16, numOfSourceVBs int) (map[uint16][]string, []*service_def.RepairRecord) {
+	vbKeys := make(map[uint16][]string)
+	notLocalRecords := make([]*service_def.RepairRecord, 0)
+	for _, key := range keys {
+		vbno := base.GetVBucketForKey([]byte(key), numOfSourceVBs)
+		if _, found := base.SearchVBInSortedList(vbno, localVBs); !found {
+			notLocalRecords = append(notLocalRecords, &service_def.RepairRecord{Key: key, VBucket: vbno, Outcome: service_def.RepairOutcomeNotLocal})
+			continue
+		}
+		vbKeys[vbno] = append(vbKeys[vbno], key)
+	}
+	return vbKeys, notLocalRecords
+}
+
+// removes duplicate and empty keys, keeping the order of the remaining ones
+func dedupeKeys(keys []string) []string {
+	dedupedKeys := make([]string, 0, len(keys))
+	keySet := make(map[string]bool)
+	for _, key := range keys {
+		if len(key) == 0 || keySet[key] {
+			continue
+		}
+		keySet[key] = true
+		dedupedKeys = append(dedupedKeys, key)
+	}
+	return dedupedKeys
+}
+
+func (job *repairJob) addRecords(records []*service_def.RepairRecord) {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	for _, record := range records {
+		job.records = append(job.records, record)
+		job.status.ProcessedKeys++
+		if record.Outcome == service_def.RepairOutcomeRepaired {
+			job.status.Repaired++
+		}
+	}
+}
+
+func (job *repairJob) getStatus() *service_def.RepairJobStatus {
+	job.lock.RLock()
+	defer job.lock.RUnlock()
+	status := job.status
+	return &status
+}
@@ -0,0 +1,96 @@
+// +build !pcre
+
+package service_impl
+
+import (
+	"fmt"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/metadata"
+	"github.com/couchbase/goxdcr/service_def"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRepairKeys(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestRepairKeys =================")
+
+	keys := dedupeKeys([]string{"key2", "", "key1", "key2", "key3"})
+	assert.Equal([]string{"key2", "key1", "key3"}, keys)
+
+	numOfSourceVBs := 1024
+	localVBs := base.SortUint16List([]uint16{base.GetVBucketForKey([]byte("key1"), numOfSourceVBs)})
+	vbKeys, notLocalRecords := groupKeysByVB(keys, localVBs, numOfSourceVBs)
+	numOfKeys := len(notLocalRecords)
+	for vbno, keysInVB := range vbKeys {
+		assert.Equal(localVBs[0], vbno)
+		for _, key := range keysInVB {
+			assert.Equal(vbno, base.GetVBucketForKey([]byte(key), numOfSourceVBs))
+		}
+		numOfKeys += len(keysInVB)
+	}
+	assert.Equal(len(keys), numOfKeys)
+	assert.Contains(vbKeys[localVBs[0]], "key1")
+	for _, record := range notLocalRecords {
+		assert.Equal(service_def.RepairOutcomeNotLocal, record.Outcome)
+		assert.NotEqual(localVBs[0], record.VBucket)
+	}
+
+	fmt.Println("============== Test case end: TestRepairKeys =================")
+}
+
+func TestRepairResults(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestRepairResults =================")
+
+	service := NewDiffSvc(nil, nil, nil, "", log.DefaultLoggerContext, nil)
+	spec := &metadata.ReplicationSpecification{Id: diffTestReplId, Settings: metadata.DefaultReplicationSettings()}
+
+	_, _, err := service.RepairResults(diffTestReplId)
+	assert.Equal(service_def.ErrorRepairJobNotFound, err)
+	_, err = service.StartRepair(spec, []string{""}, false /*fromDiffResults*/)
+	assert.Equal(service_def.ErrorRepairNoKeys, err)
+	_, err = service.StartRepair(spec, nil, true /*fromDiffResults*/)
+	assert.Equal(service_def.ErrorDiffJobNotFound, err)
+
+	// documents cannot be taken from diff job that is still running
+	service.jobs[spec.Id] = &diffJob{
+		jobContext: newJobContext(spec, "Diff", base.DiffDefaultMaxDocsPerSecond),
+		status:     service_def.DiffJobStatus{ReplicationId: spec.Id, State: service_def.DiffJobRunning},
+	}
+	_, err = service.StartRepair(spec, nil, true /*fromDiffResults*/)
+	assert.Equal(service_def.ErrorDiffJobRunning, err)
+
+	maxKeys := base.RepairMaxKeys
+	base.RepairMaxKeys = 1
+	_, err = service.StartRepair(spec, []string{"key1", "key2"}, false /*fromDiffResults*/)
+	assert.NotNil(err)
+	base.RepairMaxKeys = maxKeys
+
+	// set up a job as if it was started by StartRepair
+	job := &repairJob{
+		jobContext: newJobContext(spec, "Repair", base.DiffDefaultMaxDocsPerSecond),
+		status:     service_def.RepairJobStatus{ReplicationId: spec.Id, State: service_def.DiffJobRunning, TotalKeys: 3},
+	}
+	service.repairJobs[spec.Id] = job
+	_, err = service.StartRepair(spec, []string{"key1"}, false /*fromDiffResults*/)
+	assert.Equal(service_def.ErrorRepairJobRunning, err)
+
+	job.addRecords([]*service_def.RepairRecord{
+		{Key: "key1", Outcome: service_def.RepairOutcomeRepaired},
+		{Key: "key2", Outcome: service_def.RepairOutcomeLostConflict},
+	})
+	status, records, err := service.RepairResults(diffTestReplId)
+	assert.Nil(err)
+	assert.Equal(2, status.ProcessedKeys)
+	assert.Equal(1, status.Repaired)
+	assert.Equal(2, len(records))
+	assert.Equal("key2", records[1].Key)
+
+	assert.Nil(service.CancelRepair(diffTestReplId))
+	job.status.State = service_def.DiffJobCancelled
+	assert.Equal(service_def.ErrorRepairJobNotRunning, service.CancelRepair(diffTestReplId))
+
+	fmt.Println("============== Test case end: TestRepairResults =================")
+}
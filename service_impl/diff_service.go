@@ -0,0 +1,877 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package service_impl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mc "github.com/couchbase/gomemcached"
+	mcc "github.com/couchbase/gomemcached/client"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/metadata"
+	"github.com/couchbase/goxdcr/parts"
+	"github.com/couchbase/goxdcr/pipeline_utils"
+	"github.com/couchbase/goxdcr/service_def"
+	utilities "github.com/couchbase/goxdcr/utils"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DiffResultFilePrefix = "xdcr_diff_"
+const DiffResultFileSuffix = ".json"
+
+var errorJobCancelled = errors.New("job has been cancelled")
+
+// connections and replication settings used by a diff or repair job
+type jobContext struct {
+	spec *metadata.ReplicationSpecification
+	// Diff or Repair, used in logging and user agent
+	jobType string
+	finCh   chan bool
+
+	// the following are used by the job routine only
+	uprFeed       mcc.UprFeedIface
+	targetClients map[string]mcc.ClientIface
+	// key - vb#, value - target server address that the vb resides on
+	targetVBServerMap map[uint16]string
+	// conflict resolution mode of target bucket, which is what the replication uses
+	sourceCRMode base.ConflictResolutionMode
+	filter       *parts.Filter
+	boundedRange *metadata.BoundedRange
+	// nil when the replication has no transformation rules
+	transformer *parts.Transformer
+	// max number of documents streamed from source per second. 0 means no limit
+	maxDocsPerSecond int
+	// for throttling
+	throttleStartTime  time.Time
+	numOfDocsThrottled uint64
+}
+
+// a diff job compares the documents in the source vbuckets on the current node with the ones in target bucket
+type diffJob struct {
+	jobContext
+	status         service_def.DiffJobStatus
+	vbSummaries    map[uint16]*service_def.DiffVBSummary
+	resultFileName string
+	numOfRecords   int
+	// protects status, vbSummaries and numOfRecords
+	lock sync.RWMutex
+
+	// the following are used by the job routine only
+	resultWriter *bufio.Writer
+}
+
+// DiffService runs diff jobs, one per replication at a time, and keeps the results of the latest job of each replication.
+// a diff job streams the keys and metadata of documents in the source vbuckets on the current node through dcp,
+// one vbucket at a time, retrieves the metadata of the same documents from target bucket through getMeta,
+// and records the documents that are missing on target, that still exist on target after being deleted on source,
+// or whose metadata differ between source and target.
+// documents are compared in windows of DiffWindowSize documents as they are streamed, at no more than MaxDocsPerSecond.
+// documents changed while the job is running may be reported as different before replication catches up
+type DiffService struct {
+	remote_cluster_svc service_def.RemoteClusterSvc
+	cluster_info_svc   service_def.ClusterInfoSvc
+	xdcr_topology_svc  service_def.XDCRCompTopologySvc
+	utils              utilities.UtilsIface
+
+	resultDir string
+
+	jobs     map[string]*diffJob
+	jobsLock sync.RWMutex
+
+	repairJobs     map[string]*repairJob
+	repairJobsLock sync.RWMutex
+
+	logger *log.CommonLogger
+}
+
+func NewDiffSvc(remote_cluster_svc service_def.RemoteClusterSvc, cluster_info_svc service_def.ClusterInfoSvc,
+	xdcr_topology_svc service_def.XDCRCompTopologySvc, resultDir string, logger_ctx *log.LoggerContext, utilsIn utilities.UtilsIface) *DiffService {
+	if resultDir == "" {
+		// log directory is not specified when goxdcr is run outside of couchbase server
+		resultDir = os.TempDir()
+	}
+	return &DiffService{
+		remote_cluster_svc: remote_cluster_svc,
+		cluster_info_svc:   cluster_info_svc,
+		xdcr_topology_svc:  xdcr_topology_svc,
+		utils:              utilsIn,
+		resultDir:          resultDir,
+		jobs:               make(map[string]*diffJob),
+		repairJobs:         make(map[string]*repairJob),
+		logger:             log.NewLogger("DiffSvc", logger_ctx),
+	}
+}
+
+func (service *DiffService) StartDiff(spec *metadata.ReplicationSpecification, maxDocsPerSecond int) (*service_def.DiffJobStatus, error) {
+	if spec.Settings.IsSink() {
+		return nil, service_def.ErrorDiffSinkNotSupported
+	}
+	if maxDocsPerSecond == 0 {
+		maxDocsPerSecond = base.DiffDefaultMaxDocsPerSecond
+	}
+
+	service.jobsLock.Lock()
+	defer service.jobsLock.Unlock()
+
+	if job, ok := service.jobs[spec.Id]; ok && job.getStatus().State == service_def.DiffJobRunning {
+		return nil, service_def.ErrorDiffJobRunning
+	}
+
+	job := &diffJob{
+		jobContext: newJobContext(spec, "Diff", maxDocsPerSecond),
+		status: service_def.DiffJobStatus{
+			ReplicationId:    spec.Id,
+			State:            service_def.DiffJobRunning,
+			StartTime:        log.FormatTimeWithMilliSecondPrecision(time.Now()),
+			MaxDocsPerSecond: maxDocsPerSecond,
+		},
+		vbSummaries:    make(map[uint16]*service_def.DiffVBSummary),
+		resultFileName: service.getResultFileName(spec.Id),
+	}
+	service.jobs[spec.Id] = job
+
+	service.logger.Infof("Starting diff job for replication %v. maxDocsPerSecond=%v\n", spec.Id, maxDocsPerSecond)
+	go service.runJob(job)
+
+	return job.getStatus(), nil
+}
+
+func (service *DiffService) DiffStatus(replicationId string) (*service_def.DiffJobStatus, error) {
+	job, err := service.getJob(replicationId)
+	if err != nil {
+		return nil, err
+	}
+	return job.getStatus(), nil
+}
+
+func (service *DiffService) DiffResults(replicationId string) (*service_def.DiffJobStatus, []*service_def.DiffVBSummary, []*service_def.DiffRecord, error) {
+	job, err := service.getJob(replicationId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	status := job.getStatus()
+	summaries := job.getVBSummaries()
+	if status.State == service_def.DiffJobRunning {
+		// records are still being written
+		return status, summaries, nil, nil
+	}
+
+	file, err := os.Open(job.resultFileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// job has failed before any record is written
+			return status, summaries, []*service_def.DiffRecord{}, nil
+		}
+		return nil, nil, nil, err
+	}
+	defer file.Close()
+
+	records := make([]*service_def.DiffRecord, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		record := &service_def.DiffRecord{}
+		err = json.Unmarshal(scanner.Bytes(), record)
+		if err != nil {
+			service.logger.Warnf("Skipping corrupted record in diff result file %v. err=%v", job.resultFileName, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return status, summaries, records, scanner.Err()
+}
+
+func (service *DiffService) CancelDiff(replicationId string) error {
+	job, err := service.getJob(replicationId)
+	if err != nil {
+		return err
+	}
+
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	if job.status.State != service_def.DiffJobRunning {
+		return service_def.ErrorDiffJobNotRunning
+	}
+	job.cancel()
+	return nil
+}
+
+func (service *DiffService) getJob(replicationId string) (*diffJob, error) {
+	service.jobsLock.RLock()
+	defer service.jobsLock.RUnlock()
+	job, ok := service.jobs[replicationId]
+	if !ok {
+		return nil, service_def.ErrorDiffJobNotFound
+	}
+	return job, nil
+}
+
+// replication id contains "/", which needs to be escaped in file name
+func (service *DiffService) getResultFileName(replicationId string) string {
+	return filepath.Join(service.resultDir, DiffResultFilePrefix+url.QueryEscape(replicationId)+DiffResultFileSuffix)
+}
+
+func (service *DiffService) runJob(job *diffJob) {
+	err := service.runJobInner(job)
+	service.closeConnections(&job.jobContext)
+
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	job.status.EndTime = log.FormatTimeWithMilliSecondPrecision(time.Now())
+	if err == nil {
+		job.status.State = service_def.DiffJobCompleted
+		service.logger.Infof("Diff job for replication %v has completed. compared=%v missing=%v extra=%v mismatched=%v\n",
+			job.spec.Id, job.status.Compared, job.status.Missing, job.status.Extra, job.status.Mismatched)
+	} else if err == errorJobCancelled {
+		job.status.State = service_def.DiffJobCancelled
+		service.logger.Infof("Diff job for replication %v has been cancelled\n", job.spec.Id)
+	} else {
+		job.status.State = service_def.DiffJobFailed
+		job.status.Error = err.Error()
+		service.logger.Errorf("Diff job for replication %v has failed. err=%v\n", job.spec.Id, err)
+	}
+}
+
+func (service *DiffService) runJobInner(job *diffJob) error {
+	spec := job.spec
+
+	vbnos, err := service.getLocalVBs(spec)
+	if err != nil {
+		return err
+	}
+
+	job.lock.Lock()
+	job.status.TotalVBuckets = len(vbnos)
+	for _, vbno := range vbnos {
+		job.vbSummaries[vbno] = &service_def.DiffVBSummary{VBucket: vbno}
+	}
+	job.lock.Unlock()
+
+	err = service.initReplicationSettings(&job.jobContext)
+	if err != nil {
+		return err
+	}
+
+	err = service.initTargetConnections(&job.jobContext, false /*xattrEnabled*/)
+	if err != nil {
+		return err
+	}
+
+	highSeqnos, err := service.initSourceFeed(&job.jobContext, vbnos)
+	if err != nil {
+		return err
+	}
+
+	resultFile, err := os.OpenFile(job.resultFileName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer resultFile.Close()
+	job.resultWriter = bufio.NewWriter(resultFile)
+	defer job.resultWriter.Flush()
+
+	for _, vbno := range vbnos {
+		err = service.diffVB(job, vbno, highSeqnos[vbno])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// source vbuckets on the current node
+func (service *DiffService) getLocalVBs(spec *metadata.ReplicationSpecification) ([]uint16, error) {
+	kv_vb_map, _, err := pipeline_utils.GetSourceVBMap(service.cluster_info_svc, service.xdcr_topology_svc, spec.SourceBucketName, service.logger)
+	if err != nil {
+		return nil, err
+	}
+	vbnos := make([]uint16, 0)
+	for _, vblist := range kv_vb_map {
+		vbnos = append(vbnos, vblist...)
+	}
+	return base.SortUint16List(vbnos), nil
+}
+
+// sets up filter and bounded range, which decide which documents are replicated,
+// and transformer, which decides what replicated documents look like on target
+func (service *DiffService) initReplicationSettings(ctx *jobContext) error {
+	spec := ctx.spec
+	if spec.Settings.FilterExpression != "" {
+		var err error
+		ctx.filter, err = parts.NewFilter(strings.ToLower(ctx.jobType)+"_"+spec.Id, spec.Settings.FilterExpression, service.utils)
+		if err != nil {
+			return err
+		}
+		ctx.filter.SetDelExpFallback(spec.Settings.GetFilterDelExpFallback())
+	}
+	ctx.boundedRange = spec.Settings.GetBoundedRange()
+	if spec.Settings.GetTransformationRules() != "" {
+		// documents are compared within the same vbucket on source and target, which does not hold when their keys are changed
+		if metadata.TransformationRulesChangeKeys(spec.Settings.GetTransformationRules()) {
+			return fmt.Errorf("%v is not supported when transformation rules change document keys", ctx.jobType)
+		}
+		var err error
+		ctx.transformer, err = parts.NewTransformer(strings.ToLower(ctx.jobType)+"_"+spec.Id, spec.Settings.GetTransformationRules())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// opens a connection to each target kv node. when xattrEnabled is true, xattr is enabled on the connections through HELO,
+// so that documents with xattrs can be sent through them
+func (service *DiffService) initTargetConnections(ctx *jobContext, xattrEnabled bool) error {
+	spec := ctx.spec
+	targetClusterRef, err := service.remote_cluster_svc.RemoteClusterByUuid(spec.TargetClusterUUID, false)
+	if err != nil {
+		return err
+	}
+	connStr, err := service.remote_cluster_svc.GetConnectionStringForRemoteCluster(targetClusterRef, false /*isCapiReplication*/)
+	if err != nil {
+		return err
+	}
+	username, password, httpAuthMech, certificate, sanInCertificate, clientCertificate, clientKey, err := targetClusterRef.MyCredentials()
+	if err != nil {
+		return err
+	}
+
+	targetBucketInfo, err := service.utils.GetBucketInfo(connStr, spec.TargetBucketName, username, password, httpAuthMech, certificate, sanInCertificate, clientCertificate, clientKey, service.logger)
+	if err != nil {
+		return err
+	}
+	if service.utils.CheckWhetherClusterIsESBasedOnBucketInfo(targetBucketInfo) {
+		return fmt.Errorf("%v is not supported when target is elasticsearch", ctx.jobType)
+	}
+	targetClusterVersion, err := service.utils.GetClusterCompatibilityFromBucketInfo(targetBucketInfo, service.logger)
+	if err != nil {
+		return err
+	}
+	if !base.IsClusterCompatible(targetClusterVersion, base.VersionForRBACAndXattrSupport) {
+		return fmt.Errorf("%v is not supported when target cluster does not support RBAC", ctx.jobType)
+	}
+	conflictResolutionType, err := service.utils.GetConflictResolutionTypeFromBucketInfo(spec.TargetBucketName, targetBucketInfo)
+	if err != nil {
+		return err
+	}
+	ctx.sourceCRMode = base.GetCRModeFromConflictResolutionTypeSetting(conflictResolutionType)
+
+	kvVBMap, err := service.utils.GetRemoteServerVBucketsMap(targetClusterRef.HostName(), spec.TargetBucketName, targetBucketInfo)
+	if err != nil {
+		return err
+	}
+
+	var ssl_port_map base.SSLPortMap
+	if targetClusterRef.IsFullEncryption() {
+		ssl_port_map, err = service.utils.GetMemcachedSSLPortMap(connStr, username, password, httpAuthMech, certificate, sanInCertificate, clientCertificate, clientKey, spec.TargetBucketName, service.logger)
+		if err != nil {
+			return err
+		}
+	}
+
+	userAgent := base.ComposeUserAgentWithBucketNames("Goxdcr "+ctx.jobType, spec.SourceBucketName, spec.TargetBucketName)
+	ctx.targetVBServerMap = make(map[uint16]string)
+	for server_addr, vbnos := range kvVBMap {
+		var client mcc.ClientIface
+		if targetClusterRef.IsFullEncryption() {
+			ssl_port, ok := ssl_port_map[server_addr]
+			if !ok {
+				return fmt.Errorf("Can't get remote memcached ssl port for %v", server_addr)
+			}
+			ssl_con_str := base.GetHostAddr(base.GetHostName(server_addr), uint16(ssl_port))
+			client, err = base.NewTLSConn(ssl_con_str, username, password, certificate, sanInCertificate, clientCertificate, clientKey, spec.TargetBucketName, service.logger)
+		} else {
+			client, err = service.utils.GetRemoteMemcachedConnection(server_addr, username, password, spec.TargetBucketName, userAgent,
+				!targetClusterRef.IsEncryptionEnabled() /*plain_auth*/, base.KeepAlivePeriod, service.logger)
+		}
+		if err != nil {
+			return err
+		}
+		ctx.targetClients[server_addr] = client
+		if xattrEnabled {
+			features, err := service.utils.SendHELOWithFeatures(client, userAgent, base.HELOTimeout, base.HELOTimeout, utilities.HELOFeatures{Xattribute: true}, service.logger)
+			if err != nil {
+				return err
+			}
+			if !features.Xattribute {
+				return fmt.Errorf("Xattr is not enabled on connection to %v", server_addr)
+			}
+		}
+		for _, vbno := range vbnos {
+			ctx.targetVBServerMap[vbno] = server_addr
+		}
+	}
+	return nil
+}
+
+// opens a low priority dcp connection to source bucket, and returns the high seqnos of vbnos at the time,
+// which are where dcp streams of the job end
+func (service *DiffService) initSourceFeed(ctx *jobContext, vbnos []uint16) (map[uint16]uint64, error) {
+	spec := ctx.spec
+	addr, err := service.xdcr_topology_svc.MyMemcachedAddr()
+	if err != nil {
+		return nil, err
+	}
+	userAgent := base.ComposeUserAgentWithBucketNames("Goxdcr "+ctx.jobType, spec.SourceBucketName, spec.TargetBucketName)
+	client, err := service.utils.GetMemcachedConnection(addr, spec.SourceBucketName, userAgent, base.KeepAlivePeriod, service.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	stats_map, err := client.StatsMap(base.VBUCKET_SEQNO_STAT_NAME)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	highSeqnos := make(map[uint16]uint64)
+	err = service.utils.ParseHighSeqnoStat(vbnos, stats_map, highSeqnos)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	// upr feed takes over the client, and closes it when the feed is closed
+	ctx.uprFeed, err = client.NewUprFeedIface()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	randName, err := base.GenerateRandomId(base.LengthOfRandomId, base.MaxRetryForRandomIdGeneration)
+	if err != nil {
+		return nil, err
+	}
+	var uprFeatures mcc.UprFeatures
+	// xattrs are needed for filtering, and for sending documents to target
+	uprFeatures.Xattribute = true
+	uprFeatures.DcpPriority = mcc.PriorityLow
+	err, _ = ctx.uprFeed.UprOpenWithFeatures(parts.DCP_Connection_Prefix+strings.ToLower(ctx.jobType)+":"+randName, uint32(0) /*seqno*/, base.UprFeedBufferSize, uprFeatures)
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.uprFeed.StartFeedWithConfig(base.UprFeedDataChanLength)
+	if err != nil {
+		return nil, err
+	}
+	return highSeqnos, nil
+}
+
+func (service *DiffService) closeConnections(ctx *jobContext) {
+	if ctx.uprFeed != nil {
+		ctx.uprFeed.Close()
+	}
+	for server_addr, client := range ctx.targetClients {
+		err := client.Close()
+		if err != nil {
+			service.logger.Warnf("Error closing connection to %v for %v job of %v. err=%v\n", server_addr, ctx.jobType, ctx.spec.Id, err)
+		}
+	}
+}
+
+// differences found in a vbucket by a diff job. a key can appear more than once in the dcp stream of a vbucket, e.g.,
+// when it is updated while the stream is open. differences are kept until the whole vbucket has been compared, so that
+// the difference found for an older version of a key in an earlier window does not get reported as a false mismatch
+type vbDiffResult struct {
+	comparedKeys map[string]bool
+	records      map[string]*service_def.DiffRecord
+}
+
+func newVBDiffResult() *vbDiffResult {
+	return &vbDiffResult{
+		comparedKeys: make(map[string]bool),
+		records:      make(map[string]*service_def.DiffRecord),
+	}
+}
+
+// records the result of comparing key, which is nil when no difference has been found.
+// the result replaces the one from an earlier window, if any. returns whether key has not been compared before
+func (result *vbDiffResult) add(key string, record *service_def.DiffRecord) bool {
+	newKey := !result.comparedKeys[key]
+	result.comparedKeys[key] = true
+	if record != nil {
+		result.records[key] = record
+	} else {
+		delete(result.records, key)
+	}
+	return newKey
+}
+
+// returns the differences found, sorted by key
+func (result *vbDiffResult) getRecords() []*service_def.DiffRecord {
+	keys := make([]string, 0, len(result.records))
+	for key := range result.records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	records := make([]*service_def.DiffRecord, len(keys))
+	for i, key := range keys {
+		records[i] = result.records[key]
+	}
+	return records
+}
+
+// streams vbno from seqno 0 to highSeqno, and compares the documents in the stream with target, one window at a time.
+// a document that appears again in the stream after the window that it was in has been compared is compared again,
+// and only the result of its last comparison is recorded
+func (service *DiffService) diffVB(job *diffJob, vbno uint16, highSeqno uint64) error {
+	docs := make(map[string]*service_def.DiffDocMetadata)
+	result := newVBDiffResult()
+	if highSeqno > 0 {
+		err := service.streamVB(&job.jobContext, vbno, highSeqno, func(event *mcc.UprEvent, replicated bool) error {
+			if !replicated {
+				// later version of the document may still be replicated
+				delete(docs, string(event.Key))
+				return nil
+			}
+			docs[string(event.Key)] = &service_def.DiffDocMetadata{
+				Cas:     event.Cas,
+				RevSeq:  event.RevSeqno,
+				Flags:   event.Flags,
+				Expiry:  event.Expiry,
+				Deleted: event.Opcode != mc.UPR_MUTATION,
+			}
+			if len(docs) < base.DiffWindowSize {
+				return nil
+			}
+			err := service.compareWindow(job, vbno, docs, result)
+			docs = make(map[string]*service_def.DiffDocMetadata)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err := service.compareWindow(job, vbno, docs, result)
+	if err != nil {
+		return err
+	}
+	err = service.recordBatch(job, vbno, 0 /*compared*/, result.getRecords())
+	if err != nil {
+		return err
+	}
+
+	job.lock.Lock()
+	job.vbSummaries[vbno].Done = true
+	job.status.CompletedVBuckets++
+	job.lock.Unlock()
+	return nil
+}
+
+// compares the documents in a window with target, in batches of DiffGetMetaBatchSize documents
+func (service *DiffService) compareWindow(job *diffJob, vbno uint16, docs map[string]*service_def.DiffDocMetadata, result *vbDiffResult) error {
+	keys := make([]string, 0, len(docs))
+	for key := range docs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// source and target buckets may have different numbers of vbuckets
+	targetVBKeys := make(map[uint16][]string)
+	for _, key := range keys {
+		targetVB := base.GetVBucketForKey([]byte(key), len(job.targetVBServerMap))
+		targetVBKeys[targetVB] = append(targetVBKeys[targetVB], key)
+	}
+	targetVBs := make([]uint16, 0, len(targetVBKeys))
+	for targetVB := range targetVBKeys {
+		targetVBs = append(targetVBs, targetVB)
+	}
+	targetVBs = base.SortUint16List(targetVBs)
+
+	for _, targetVB := range targetVBs {
+		keys = targetVBKeys[targetVB]
+		for len(keys) > 0 {
+			batchSize := base.IntMin(base.DiffGetMetaBatchSize, len(keys))
+			err := service.compareBatch(job, vbno, targetVB, keys[:batchSize], docs, result)
+			if err != nil {
+				return err
+			}
+			keys = keys[batchSize:]
+		}
+	}
+	return nil
+}
+
+// streams vbno from seqno 0 to highSeqno, at no more than ctx.maxDocsPerSecond, and calls onDoc for each mutation,
+// deletion and expiration in the stream, along with whether it is replicated by the replication
+func (service *DiffService) streamVB(ctx *jobContext, vbno uint16, highSeqno uint64, onDoc func(event *mcc.UprEvent, replicated bool) error) error {
+	err := ctx.uprFeed.UprRequestStream(vbno, vbno /*opaqueMSB*/, 0 /*flags*/, 0 /*vbuuid*/, 0 /*startSeqno*/, highSeqno, 0 /*snapStart*/, 0 /*snapEnd*/)
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(base.DiffReadTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.finCh:
+			return errorJobCancelled
+		case <-timer.C:
+			return fmt.Errorf("Timed out waiting for dcp stream of vb %v", vbno)
+		case event, ok := <-ctx.uprFeed.GetUprEventCh():
+			if !ok {
+				return fmt.Errorf("Dcp feed has been closed. err=%v", ctx.uprFeed.GetError())
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+
+			if event.VBucket == vbno {
+				switch event.Opcode {
+				case mc.UPR_STREAMREQ:
+					if event.Status != mc.SUCCESS {
+						return fmt.Errorf("Failed to open dcp stream for vb %v. status=%v", vbno, event.Status)
+					}
+				case mc.UPR_STREAMEND:
+					return ctx.uprFeed.ClientAck(event)
+				case mc.UPR_MUTATION, mc.UPR_DELETION, mc.UPR_EXPIRATION:
+					// holding off the acknowledgement of the event slows down the feed through flow control
+					err = ctx.throttle(1)
+					if err != nil {
+						return err
+					}
+					err = onDoc(event, service.isReplicated(ctx, event))
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			// acknowledge the processing of the event, which is necessary for flow control of the feed to work
+			err = ctx.uprFeed.ClientAck(event)
+			if err != nil {
+				return err
+			}
+			timer.Reset(base.DiffReadTimeout)
+		}
+	}
+}
+
+// whether the mutation is replicated, i.e., whether it passes filter and bounded range of the replication,
+// and can be transformed by the transformation rules of the replication
+func (service *DiffService) isReplicated(ctx *jobContext, event *mcc.UprEvent) bool {
+	if ctx.boundedRange != nil && !ctx.boundedRange.Contains(event.VBucket, event.Seqno, event.Cas) {
+		return false
+	}
+	if ctx.filter != nil {
+		pass, err, errDesc, _ := ctx.filter.FilterUprEvent(event)
+		if err != nil {
+			service.logger.Warnf("%v job for %v skipping document that failed filtering. err=%v %v\n", ctx.jobType, ctx.spec.Id, err, errDesc)
+			return false
+		}
+		if !pass {
+			return false
+		}
+	}
+	if ctx.transformer != nil {
+		// documents that cannot be transformed are not replicated
+		_, err := parts.ComposeRequestForSetMeta(event, ctx.sourceCRMode, 0 /*opaque*/, ctx.transformer)
+		return err == nil
+	}
+	return true
+}
+
+// retrieves metadata of documents in source vbno with the specified keys from targetVB of target, and adds the differences to result
+func (service *DiffService) compareBatch(job *diffJob, vbno, targetVB uint16, keys []string, docs map[string]*service_def.DiffDocMetadata, result *vbDiffResult) error {
+	server_addr, ok := job.targetVBServerMap[targetVB]
+	if !ok {
+		return fmt.Errorf("Cannot find target server for vb %v", targetVB)
+	}
+	client := job.targetClients[server_addr]
+
+	for i, key := range keys {
+		err := client.Transmit(parts.ComposeRequestForGetMeta(key, targetVB, uint32(i), false /*xattrEnabled*/))
+		if err != nil {
+			return err
+		}
+	}
+
+	targetDocs := make(map[string]*service_def.DiffDocMetadata)
+	for range keys {
+		resp, err := client.ReceiveWithDeadline(time.Now().Add(base.DiffReadTimeout))
+		if err != nil && resp == nil {
+			return err
+		}
+		if int(resp.Opaque) >= len(keys) {
+			return fmt.Errorf("Received getMeta response with unexpected opaque %v", resp.Opaque)
+		}
+		key := keys[resp.Opaque]
+		switch resp.Status {
+		case mc.SUCCESS:
+			docMeta, err := parts.DecodeGetMetaResp([]byte(key), resp, false /*xattrEnabled*/)
+			if err != nil {
+				return err
+			}
+			targetDocs[key] = &service_def.DiffDocMetadata{
+				Cas:     docMeta.Cas(),
+				RevSeq:  docMeta.RevSeq(),
+				Flags:   docMeta.Flags(),
+				Expiry:  docMeta.Expiry(),
+				Deleted: docMeta.IsDeletion(),
+			}
+		case mc.KEY_ENOENT:
+			// document does not exist on target
+		default:
+			return fmt.Errorf("Received error response with status %v from target for vb %v", resp.Status, targetVB)
+		}
+	}
+
+	compared := 0
+	for _, key := range keys {
+		var record *service_def.DiffRecord
+		diffType := diffDocMetadata(docs[key], targetDocs[key], job.transformer != nil && job.transformer.SetsTTL())
+		if diffType != "" {
+			record = &service_def.DiffRecord{Key: key, VBucket: vbno, Type: diffType, Source: docs[key], Target: targetDocs[key]}
+		}
+		if result.add(key, record) {
+			compared++
+		}
+	}
+	// differences are recorded when the whole vbucket has been compared
+	return service.recordBatch(job, vbno, compared, nil)
+}
+
+func (service *DiffService) recordBatch(job *diffJob, vbno uint16, compared int, records []*service_def.DiffRecord) error {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+
+	summary := job.vbSummaries[vbno]
+	summary.Compared += uint64(compared)
+	job.status.Compared += uint64(compared)
+	for _, record := range records {
+		switch record.Type {
+		case service_def.DiffTypeMissing:
+			summary.Missing++
+			job.status.Missing++
+		case service_def.DiffTypeExtra:
+			summary.Extra++
+			job.status.Extra++
+		case service_def.DiffTypeMismatch:
+			summary.Mismatched++
+			job.status.Mismatched++
+		}
+
+		if job.numOfRecords >= base.DiffMaxRecords {
+			job.status.Truncated = true
+			continue
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+		_, err = job.resultWriter.Write(data)
+		if err != nil {
+			return err
+		}
+		job.numOfRecords++
+	}
+	return nil
+}
+
+// waits, if needed, so that documents are streamed at no more than maxDocsPerSecond on average
+func (ctx *jobContext) throttle(numOfDocs int) error {
+	if ctx.maxDocsPerSecond <= 0 {
+		return nil
+	}
+	if ctx.throttleStartTime.IsZero() {
+		ctx.throttleStartTime = time.Now()
+	}
+	ctx.numOfDocsThrottled += uint64(numOfDocs)
+	expectedElapsed := time.Duration(ctx.numOfDocsThrottled) * time.Second / time.Duration(ctx.maxDocsPerSecond)
+	waitTime := expectedElapsed - time.Since(ctx.throttleStartTime)
+	if waitTime <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(waitTime)
+	defer timer.Stop()
+	select {
+	case <-ctx.finCh:
+		return errorJobCancelled
+	case <-timer.C:
+		return nil
+	}
+}
+
+// compares source and target metadata of a document, and returns the type of difference, or "" when they are consistent.
+// nil target means that the document does not exist on target.
+// expiry is not compared when it is set by transformation rules at the time the document is replicated
+func diffDocMetadata(source, target *service_def.DiffDocMetadata, ignoreExpiry bool) string {
+	sourceExists := source != nil && !source.Deleted
+	targetExists := target != nil && !target.Deleted
+	switch {
+	case sourceExists && !targetExists:
+		return service_def.DiffTypeMissing
+	case !sourceExists && targetExists:
+		return service_def.DiffTypeExtra
+	case !sourceExists && !targetExists:
+		// tombstones do not need to match
+		return ""
+	case source.Cas != target.Cas || source.RevSeq != target.RevSeq || source.Flags != target.Flags:
+		return service_def.DiffTypeMismatch
+	case !ignoreExpiry && source.Expiry != target.Expiry:
+		return service_def.DiffTypeMismatch
+	default:
+		return ""
+	}
+}
+
+func newJobContext(spec *metadata.ReplicationSpecification, jobType string, maxDocsPerSecond int) jobContext {
+	return jobContext{
+		spec:             spec,
+		jobType:          jobType,
+		finCh:            make(chan bool),
+		targetClients:    make(map[string]mcc.ClientIface),
+		maxDocsPerSecond: maxDocsPerSecond,
+	}
+}
+
+// called with lock on the job that the context belongs to
+func (ctx *jobContext) cancel() {
+	select {
+	case <-ctx.finCh:
+		// already cancelled
+	default:
+		close(ctx.finCh)
+	}
+}
+
+func (job *diffJob) getStatus() *service_def.DiffJobStatus {
+	job.lock.RLock()
+	defer job.lock.RUnlock()
+	status := job.status
+	return &status
+}
+
+func (job *diffJob) getVBSummaries() []*service_def.DiffVBSummary {
+	job.lock.RLock()
+	defer job.lock.RUnlock()
+	vbnos := make([]uint16, 0, len(job.vbSummaries))
+	for vbno := range job.vbSummaries {
+		vbnos = append(vbnos, vbno)
+	}
+	summaries := make([]*service_def.DiffVBSummary, 0, len(vbnos))
+	for _, vbno := range base.SortUint16List(vbnos) {
+		summary := *job.vbSummaries[vbno]
+		summaries = append(summaries, &summary)
+	}
+	return summaries
+}
@@ -0,0 +1,176 @@
+// +build !pcre
+
+package service_impl
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/metadata"
+	"github.com/couchbase/goxdcr/service_def"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+const diffTestReplId = "remoteClusterUuid/sourceBucket/targetBucket"
+
+func TestDiffDocMetadata(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestDiffDocMetadata =================")
+
+	source := &service_def.DiffDocMetadata{Cas: 100, RevSeq: 2, Flags: 1, Expiry: 0}
+	same := *source
+	assert.Equal("", diffDocMetadata(source, &same, false))
+	assert.Equal(service_def.DiffTypeMissing, diffDocMetadata(source, nil, false))
+	assert.Equal(service_def.DiffTypeMissing, diffDocMetadata(source, &service_def.DiffDocMetadata{Cas: 200, RevSeq: 3, Deleted: true}, false))
+
+	newer := same
+	newer.Cas = 200
+	assert.Equal(service_def.DiffTypeMismatch, diffDocMetadata(source, &newer, false))
+	differentFlags := same
+	differentFlags.Flags = 2
+	assert.Equal(service_def.DiffTypeMismatch, diffDocMetadata(source, &differentFlags, false))
+	// expiry set by transformation rules is not compared
+	differentExpiry := same
+	differentExpiry.Expiry = 1600000000
+	assert.Equal(service_def.DiffTypeMismatch, diffDocMetadata(source, &differentExpiry, false))
+	assert.Equal("", diffDocMetadata(source, &differentExpiry, true))
+	assert.Equal(service_def.DiffTypeMismatch, diffDocMetadata(source, &differentFlags, true))
+
+	deleted := &service_def.DiffDocMetadata{Cas: 300, RevSeq: 3, Deleted: true}
+	assert.Equal(service_def.DiffTypeExtra, diffDocMetadata(deleted, source, false))
+	assert.Equal("", diffDocMetadata(deleted, nil, false))
+	// tombstones are not compared
+	assert.Equal("", diffDocMetadata(deleted, &service_def.DiffDocMetadata{Cas: 250, RevSeq: 2, Deleted: true}, false))
+
+	fmt.Println("============== Test case end: TestDiffDocMetadata =================")
+}
+
+func TestDiffResults(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestDiffResults =================")
+	dir, err := ioutil.TempDir("", "diffTest")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	service := NewDiffSvc(nil, nil, nil, dir, log.DefaultLoggerContext, nil)
+	_, err = service.DiffStatus(diffTestReplId)
+	assert.Equal(service_def.ErrorDiffJobNotFound, err)
+
+	// set up a job as if it was started by StartDiff
+	spec := &metadata.ReplicationSpecification{Id: diffTestReplId}
+	job := &diffJob{
+		jobContext:     newJobContext(spec, "Diff", base.DiffDefaultMaxDocsPerSecond),
+		status:         service_def.DiffJobStatus{ReplicationId: spec.Id, State: service_def.DiffJobRunning},
+		vbSummaries:    map[uint16]*service_def.DiffVBSummary{1: {VBucket: 1}, 0: {VBucket: 0}},
+		resultFileName: service.getResultFileName(spec.Id),
+	}
+	service.jobs[spec.Id] = job
+
+	_, err = service.StartDiff(spec, 0)
+	assert.Equal(service_def.ErrorDiffJobRunning, err)
+
+	resultFile, err := os.Create(job.resultFileName)
+	assert.Nil(err)
+	job.resultWriter = bufio.NewWriter(resultFile)
+
+	maxRecords := base.DiffMaxRecords
+	base.DiffMaxRecords = 2
+	defer func() { base.DiffMaxRecords = maxRecords }()
+
+	source := &service_def.DiffDocMetadata{Cas: 100, RevSeq: 1}
+	assert.Nil(service.recordBatch(job, 0, 10, []*service_def.DiffRecord{
+		{Key: "key0", VBucket: 0, Type: service_def.DiffTypeMissing, Source: source},
+		{Key: "key1", VBucket: 0, Type: service_def.DiffTypeMismatch, Source: source, Target: &service_def.DiffDocMetadata{Cas: 200, RevSeq: 2}},
+	}))
+	assert.Nil(service.recordBatch(job, 1, 5, []*service_def.DiffRecord{
+		{Key: "key2", VBucket: 1, Type: service_def.DiffTypeExtra, Source: &service_def.DiffDocMetadata{Cas: 300, RevSeq: 2, Deleted: true}, Target: source},
+	}))
+	assert.Nil(job.resultWriter.Flush())
+	resultFile.Close()
+
+	// records are not returned while job is running
+	status, summaries, records, err := service.DiffResults(diffTestReplId)
+	assert.Nil(err)
+	assert.Nil(records)
+	assert.Equal(uint64(15), status.Compared)
+	assert.Equal(2, len(summaries))
+	assert.Equal(uint16(0), summaries[0].VBucket)
+	assert.Equal(uint64(1), summaries[0].Missing)
+	assert.Equal(uint64(1), summaries[0].Mismatched)
+	assert.Equal(uint64(1), summaries[1].Extra)
+
+	assert.Nil(service.CancelDiff(diffTestReplId))
+	job.status.State = service_def.DiffJobCancelled
+	assert.Equal(service_def.ErrorDiffJobNotRunning, service.CancelDiff(diffTestReplId))
+
+	status, _, records, err = service.DiffResults(diffTestReplId)
+	assert.Nil(err)
+	assert.Equal(uint64(1), status.Missing)
+	assert.Equal(uint64(1), status.Extra)
+	assert.Equal(uint64(1), status.Mismatched)
+	// the third record exceeds the limit and is not recorded
+	assert.True(status.Truncated)
+	assert.Equal(2, len(records))
+	assert.Equal("key1", records[1].Key)
+	assert.Equal(uint64(200), records[1].Target.Cas)
+
+	fmt.Println("============== Test case end: TestDiffResults =================")
+}
+
+func TestJobContextThrottle(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestJobContextThrottle =================")
+
+	spec := &metadata.ReplicationSpecification{Id: diffTestReplId}
+
+	// no limit
+	ctx := newJobContext(spec, "Repair", 0)
+	ctx.cancel()
+	assert.Nil(ctx.throttle(1000000))
+
+	ctx = newJobContext(spec, "Diff", 1000)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		assert.Nil(ctx.throttle(1))
+	}
+	// 100 docs at 1000 docs per second take at least 100ms, less the first doc
+	assert.True(time.Since(start) >= 99*time.Millisecond)
+
+	// cancellation interrupts the wait
+	ctx.cancel()
+	assert.Equal(errorJobCancelled, ctx.throttle(1000000))
+
+	fmt.Println("============== Test case end: TestJobContextThrottle =================")
+}
+
+func TestVBDiffResultKeyInLaterWindow(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestVBDiffResultKeyInLaterWindow =================")
+
+	result := newVBDiffResult()
+	older := &service_def.DiffDocMetadata{Cas: 100, RevSeq: 1}
+	newer := &service_def.DiffDocMetadata{Cas: 200, RevSeq: 2}
+
+	// first window. target already has the newer version of key0, and is missing key1
+	assert.True(result.add("key0", &service_def.DiffRecord{Key: "key0", Type: service_def.DiffTypeMismatch, Source: older, Target: newer}))
+	assert.True(result.add("key1", &service_def.DiffRecord{Key: "key1", Type: service_def.DiffTypeMissing, Source: older}))
+	assert.True(result.add("key2", nil))
+
+	// later window with the newer version of key0, which matches target
+	assert.False(result.add("key0", nil))
+	// later window with the newer version of key2, which has not been replicated yet
+	assert.False(result.add("key2", &service_def.DiffRecord{Key: "key2", Type: service_def.DiffTypeMismatch, Source: newer, Target: older}))
+
+	records := result.getRecords()
+	assert.Equal(2, len(records))
+	assert.Equal("key1", records[0].Key)
+	assert.Equal("key2", records[1].Key)
+	assert.Equal(uint64(200), records[1].Source.Cas)
+
+	fmt.Println("============== Test case end: TestVBDiffResultKeyInLaterWindow =================")
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2019 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package service_impl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/couchbase/goxdcr/base"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/metadata"
+	"github.com/couchbase/goxdcr/service_def"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// NotificationService posts replication lifecycle events to the webhooks that are subscribed to them.
+// events are queued and dispatched by a background routine, so that Notify never blocks the caller.
+// each webhook has its own bounded delivery queue and worker, so that a slow webhook does not hold up the others.
+// each delivery to a webhook is retried with exponential backoff
+type NotificationService struct {
+	webhook_svc service_def.WebhookSvc
+	top_svc     service_def.XDCRCompTopologySvc
+
+	eventCh        chan *metadata.WebhookEvent
+	client         *http.Client
+	queueSize      int
+	maxRetry       int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	// webhook id -> delivery queue of webhook. only accessed by the dispatch routine
+	queues map[string]*webhookQueue
+	// number of events dropped because the queue of notification service or of a webhook was full
+	droppedEvents uint64
+
+	logger *log.CommonLogger
+}
+
+type webhookDelivery struct {
+	webhook   *metadata.Webhook
+	eventType string
+	body      []byte
+}
+
+type webhookQueue struct {
+	deliveryCh chan *webhookDelivery
+}
+
+func NewNotificationSvc(webhook_svc service_def.WebhookSvc, top_svc service_def.XDCRCompTopologySvc, logger_ctx *log.LoggerContext) *NotificationService {
+	service := &NotificationService{
+		webhook_svc:    webhook_svc,
+		top_svc:        top_svc,
+		eventCh:        make(chan *metadata.WebhookEvent, base.WebhookEventQueueSize),
+		client:         &http.Client{Timeout: base.WebhookRequestTimeout},
+		queueSize:      base.WebhookDeliveryQueueSize,
+		maxRetry:       base.WebhookMaxRetry,
+		initialBackoff: base.WebhookInitialBackoffTime,
+		maxBackoff:     base.WebhookMaxBackoffTime,
+		queues:         make(map[string]*webhookQueue),
+		logger:         log.NewLogger("NotificationSvc", logger_ctx),
+	}
+
+	go service.run()
+
+	service.logger.Infof("Created notification service.\n")
+	return service
+}
+
+func (service *NotificationService) Notify(event *metadata.WebhookEvent) {
+	if event.Node == "" {
+		node, err := service.top_svc.MyConnectionStr()
+		if err == nil {
+			event.Node = node
+		}
+	}
+
+	select {
+	case service.eventCh <- event:
+	default:
+		dropped := atomic.AddUint64(&service.droppedEvents, 1)
+		service.logger.Warnf("Notification queue is full. Dropping %v event for %v%v. message=%v, total dropped=%v\n", event.EventType,
+			event.ReplicationId, event.RemoteClusterName, event.Message, dropped)
+	}
+}
+
+// number of events that have been dropped since the service started
+func (service *NotificationService) DroppedEvents() uint64 {
+	return atomic.LoadUint64(&service.droppedEvents)
+}
+
+func (service *NotificationService) run() {
+	for event := range service.eventCh {
+		service.dispatch(event)
+	}
+}
+
+func (service *NotificationService) dispatch(event *metadata.WebhookEvent) {
+	webhooks, err := service.webhook_svc.Webhooks()
+	if err != nil {
+		service.logger.Errorf("Failed to retrieve webhooks. Dropping %v event. err=%v\n", event.EventType, err)
+		return
+	}
+
+	service.removeStaleQueues(webhooks)
+
+	var body []byte
+	for _, webhook := range webhooks {
+		if !webhook.IsSubscribedTo(event.EventType) {
+			continue
+		}
+		if body == nil {
+			body, err = json.Marshal(event)
+			if err != nil {
+				service.logger.Errorf("Failed to marshal %v event. err=%v\n", event.EventType, err)
+				return
+			}
+		}
+		service.enqueue(webhook, event.EventType, body)
+	}
+}
+
+func (service *NotificationService) enqueue(webhook *metadata.Webhook, eventType string, body []byte) {
+	queue, ok := service.queues[webhook.Id]
+	if !ok {
+		queue = &webhookQueue{deliveryCh: make(chan *webhookDelivery, service.queueSize)}
+		service.queues[webhook.Id] = queue
+		go service.runDeliveries(queue)
+	}
+
+	select {
+	case queue.deliveryCh <- &webhookDelivery{webhook: webhook, eventType: eventType, body: body}:
+	default:
+		dropped := atomic.AddUint64(&service.droppedEvents, 1)
+		service.logger.Warnf("Delivery queue of webhook %v is full. Dropping %v event. total dropped=%v\n", webhook.Id, eventType, dropped)
+	}
+}
+
+// stops the workers of webhooks that have been deleted. events that are still queued for them are delivered first
+func (service *NotificationService) removeStaleQueues(webhooks []*metadata.Webhook) {
+	if len(service.queues) == 0 {
+		return
+	}
+	webhookIds := make(map[string]bool)
+	for _, webhook := range webhooks {
+		webhookIds[webhook.Id] = true
+	}
+	for id, queue := range service.queues {
+		if !webhookIds[id] {
+			close(queue.deliveryCh)
+			delete(service.queues, id)
+		}
+	}
+}
+
+// delivers the events queued for a webhook one at a time, in the order that they were queued
+func (service *NotificationService) runDeliveries(queue *webhookQueue) {
+	for delivery := range queue.deliveryCh {
+		service.deliver(delivery.webhook, delivery.eventType, delivery.body)
+	}
+}
+
+func (service *NotificationService) deliver(webhook *metadata.Webhook, eventType string, body []byte) {
+	backoff := service.initialBackoff
+	for attempt := 0; ; attempt++ {
+		err := service.post(webhook.Url, body)
+		if err == nil {
+			return
+		}
+
+		if attempt >= service.maxRetry {
+			service.logger.Errorf("Failed to post %v event to webhook %v after %v retries. err=%v\n", eventType, webhook.Id, attempt, err)
+			return
+		}
+		service.logger.Warnf("Failed to post %v event to webhook %v. Retrying in %v. err=%v\n", eventType, webhook.Id, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > service.maxBackoff {
+			backoff = service.maxBackoff
+		}
+	}
+}
+
+func (service *NotificationService) post(url string, body []byte) error {
+	response, err := service.client.Post(url, base.JsonContentType, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	// drain body so that connection can be reused
+	io.Copy(ioutil.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("received status code %v", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// +build !pcre
+
+package service_impl
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/couchbase/goxdcr/log"
+	"github.com/couchbase/goxdcr/metadata"
+	service_def "github.com/couchbase/goxdcr/service_def/mocks"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func setupNotificationBoilerPlate(webhooks []*metadata.Webhook) *NotificationService {
+	webhookSvc := &service_def.WebhookSvc{}
+	webhookSvc.On("Webhooks").Return(webhooks, nil)
+	topSvc := &service_def.XDCRCompTopologySvc{}
+	topSvc.On("MyConnectionStr").Return("127.0.0.1:8091", nil)
+
+	service := NewNotificationSvc(webhookSvc, topSvc, log.DefaultLoggerContext)
+	service.initialBackoff = 10 * time.Millisecond
+	service.maxBackoff = 20 * time.Millisecond
+	return service
+}
+
+func TestNotificationDeliveryWithRetry(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestNotificationDeliveryWithRetry =================")
+
+	var attempts int32
+	eventCh := make(chan *metadata.WebhookEvent, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// fail the first two attempts
+		if atomic.AddInt32(&attempts, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		event := &metadata.WebhookEvent{}
+		assert.Nil(json.Unmarshal(body, event))
+		eventCh <- event
+	}))
+	defer server.Close()
+
+	unsubscribedHits := int32(0)
+	unsubscribedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&unsubscribedHits, 1)
+	}))
+	defer unsubscribedServer.Close()
+
+	webhooks := []*metadata.Webhook{
+		&metadata.Webhook{Id: "subscribed", Url: server.URL, EventTypes: []string{metadata.WebhookEventPipelineError}},
+		&metadata.Webhook{Id: "unsubscribed", Url: unsubscribedServer.URL, EventTypes: []string{metadata.WebhookEventReplicationSpecGC}},
+	}
+	service := setupNotificationBoilerPlate(webhooks)
+
+	service.Notify(metadata.NewReplicationWebhookEvent(metadata.WebhookEventPipelineError, "uuid/src/tgt", "connection reset"))
+
+	select {
+	case event := <-eventCh:
+		assert.Equal(metadata.WebhookEventPipelineError, event.EventType)
+		assert.Equal("uuid/src/tgt", event.ReplicationId)
+		assert.Equal("connection reset", event.Message)
+		assert.Equal("127.0.0.1:8091", event.Node)
+	case <-time.After(5 * time.Second):
+		assert.Fail("event was not delivered")
+	}
+	assert.Equal(int32(3), atomic.LoadInt32(&attempts))
+	assert.Equal(int32(0), atomic.LoadInt32(&unsubscribedHits))
+
+	fmt.Println("============== Test case end: TestNotificationDeliveryWithRetry =================")
+}
+
+func TestNotificationDeliveryGivesUp(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestNotificationDeliveryGivesUp =================")
+
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	webhook := &metadata.Webhook{Id: "failing", Url: server.URL, EventTypes: []string{metadata.WebhookEventPipelineRestart}}
+	service := setupNotificationBoilerPlate([]*metadata.Webhook{webhook})
+	service.maxRetry = 2
+
+	service.deliver(webhook, metadata.WebhookEventPipelineRestart, []byte("{}"))
+	// the first attempt and two retries
+	assert.Equal(int32(3), atomic.LoadInt32(&attempts))
+
+	fmt.Println("============== Test case end: TestNotificationDeliveryGivesUp =================")
+}
+
+func TestNotificationDeliveryQueuePerWebhook(t *testing.T) {
+	assert := assert.New(t)
+	fmt.Println("============== Test case start: TestNotificationDeliveryQueuePerWebhook =================")
+
+	var inFlight, maxInFlight, delivered int32
+	releaseCh := make(chan bool)
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		if current > atomic.LoadInt32(&maxInFlight) {
+			atomic.StoreInt32(&maxInFlight, current)
+		}
+		<-releaseCh
+		atomic.AddInt32(&inFlight, -1)
+		atomic.AddInt32(&delivered, 1)
+	}))
+	defer slowServer.Close()
+
+	fastCh := make(chan bool, 10)
+	fastServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fastCh <- true
+	}))
+	defer fastServer.Close()
+
+	webhooks := []*metadata.Webhook{
+		&metadata.Webhook{Id: "slow", Url: slowServer.URL, EventTypes: []string{metadata.WebhookEventPipelineError}},
+		&metadata.Webhook{Id: "fast", Url: fastServer.URL, EventTypes: []string{metadata.WebhookEventPipelineError}},
+	}
+	service := setupNotificationBoilerPlate(webhooks)
+	service.queueSize = 1
+
+	numEvents := 5
+	for i := 0; i < numEvents; i++ {
+		service.Notify(metadata.NewReplicationWebhookEvent(metadata.WebhookEventPipelineError, "uuid/src/tgt", "connection reset"))
+	}
+
+	// the slow webhook does not hold up deliveries to the fast one
+	for i := 0; i < numEvents; i++ {
+		select {
+		case <-fastCh:
+		case <-time.After(5 * time.Second):
+			assert.Fail("event was not delivered to fast webhook")
+		}
+	}
+
+	// one event is being delivered to the slow webhook and at most one is queued. the others are dropped
+	assert.True(service.DroppedEvents() >= uint64(numEvents-2))
+	close(releaseCh)
+	expectedDelivered := int32(numEvents) - int32(service.DroppedEvents())
+	for i := 0; i < 100 && atomic.LoadInt32(&delivered) < expectedDelivered; i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.Equal(expectedDelivered, atomic.LoadInt32(&delivered))
+	assert.Equal(int32(1), atomic.LoadInt32(&maxInFlight))
+
+	fmt.Println("============== Test case end: TestNotificationDeliveryQueuePerWebhook =================")
+}
@@ -106,7 +106,7 @@ func invokeFactory() error {
 	}
 
 	uilog_svc := service_impl.NewUILogSvc(top_svc, nil, utils)
-	remote_cluster_svc, err := metadata_svc.NewRemoteClusterService(uilog_svc, msvc, top_svc, cluster_info_svc, nil, utils)
+	remote_cluster_svc, err := metadata_svc.NewRemoteClusterService(uilog_svc, nil, msvc, top_svc, cluster_info_svc, nil, utils)
 	if err != nil {
 		fmt.Println(err.Error())
 		return err
@@ -145,7 +145,7 @@ func setup() error {
 	}
 
 	uilog_svc := service_impl.NewUILogSvc(top_svc, nil, utils)
-	remote_cluster_svc, err := metadata_svc.NewRemoteClusterService(uilog_svc, metakv_svc, top_svc, cluster_info_svc, nil, utils)
+	remote_cluster_svc, err := metadata_svc.NewRemoteClusterService(uilog_svc, nil, metakv_svc, top_svc, cluster_info_svc, nil, utils)
 	if err != nil {
 		fmt.Println(err.Error())
 		return err
@@ -61,7 +61,7 @@ func startReplicationSpecService() error {
 		return err
 	}
 
-	remote_cluster_svc, err := metadata_svc.NewRemoteClusterService(nil, metadataSvc, top_svc, cluster_info_svc, nil, utils)
+	remote_cluster_svc, err := metadata_svc.NewRemoteClusterService(nil, nil, metadataSvc, top_svc, cluster_info_svc, nil, utils)
 	if err != nil {
 		fmt.Println(err.Error())
 		return err
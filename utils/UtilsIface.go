@@ -30,6 +30,7 @@ type UtilsIface interface {
 	 * ------------------------
 	 */
 	ComposeHELORequest(userAgent string, features HELOFeatures) *mc.MCRequest
+	FilterExpressionGetDocs(expression string, docIds []string, username, password, bucketName, addr string, port uint16) (docs map[string][]byte, docErrs map[string]error, err error)
 	FilterExpressionMatchesDoc(expression, docId, username, password, bucketName, addr string, port uint16) (result bool, err error)
 	GetMemcachedClient(serverAddr, bucketName string, kv_mem_clients map[string]mcc.ClientIface, userAgent string, keepAlivePeriod time.Duration, logger *log.CommonLogger) (mcc.ClientIface, error)
 	GetMemcachedConnection(serverAddr, bucketName, userAgent string, keepAlivePeriod time.Duration, logger *log.CommonLogger) (mcc.ClientIface, error)
@@ -321,6 +321,38 @@ func (_m *UtilsIface) ExponentialBackoffExecutorWithFinishSignal(name string, in
 	return r0, r1
 }
 
+// FilterExpressionGetDocs provides a mock function with given fields: expression, docIds, username, password, bucketName, addr, port
+func (_m *UtilsIface) FilterExpressionGetDocs(expression string, docIds []string, username string, password string, bucketName string, addr string, port uint16) (map[string][]byte, map[string]error, error) {
+	ret := _m.Called(expression, docIds, username, password, bucketName, addr, port)
+
+	var r0 map[string][]byte
+	if rf, ok := ret.Get(0).(func(string, []string, string, string, string, string, uint16) map[string][]byte); ok {
+		r0 = rf(expression, docIds, username, password, bucketName, addr, port)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string][]byte)
+		}
+	}
+
+	var r1 map[string]error
+	if rf, ok := ret.Get(1).(func(string, []string, string, string, string, string, uint16) map[string]error); ok {
+		r1 = rf(expression, docIds, username, password, bucketName, addr, port)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(map[string]error)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(string, []string, string, string, string, string, uint16) error); ok {
+		r2 = rf(expression, docIds, username, password, bucketName, addr, port)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
 // FilterExpressionMatchesDoc provides a mock function with given fields: expression, docId, username, password, bucketName, addr, port
 func (_m *UtilsIface) FilterExpressionMatchesDoc(expression string, docId string, username string, password string, bucketName string, addr string, port uint16) (bool, error) {
 	ret := _m.Called(expression, docId, username, password, bucketName, addr, port)
@@ -358,23 +358,74 @@ func filterExpressionGetDocVal(bucket *gocb.Bucket, docId string) ([]byte, gocb.
 }
 
 func (u *Utilities) FilterExpressionMatchesDoc(expression, docId, username, password, bucketName, addr string, port uint16) (result bool, err error) {
-	var bodySlice []byte
-	var docCas gocb.Cas
+	bucket, err := filterExpressionOpenBucket(username, password, bucketName, addr, port)
+	if err != nil {
+		return
+	}
+	defer bucket.Close()
 
-	cluster, err := gocb.Connect(fmt.Sprintf("http://%v:%v", addr, port))
+	bodySlice, err := u.filterExpressionGetDocToBeFiltered(bucket, expression, docId)
+	if err != nil {
+		return
+	}
+
+	matcher, err := gojsonsm.GetFilterExpressionMatcher(base.ReplaceKeyWordsForExpression(expression))
+	if err != nil {
+		err = fmt.Errorf("Error filtering doc %v ID: %v", docId, err.Error())
+		return
+	}
+
+	result, err = matcher.Match(bodySlice)
+	return
+}
+
+// FilterExpressionGetDocs retrieves the specified documents from bucket and returns them in the form that filter expression
+// can be evaluated against, i.e., with xattrs and key added to doc body when expression references them.
+// docErrs contains the errors encountered when retrieving individual documents. err is returned when bucket cannot be opened
+func (u *Utilities) FilterExpressionGetDocs(expression string, docIds []string, username, password, bucketName, addr string, port uint16) (docs map[string][]byte, docErrs map[string]error, err error) {
+	bucket, err := filterExpressionOpenBucket(username, password, bucketName, addr, port)
 	if err != nil {
 		return
 	}
+	defer bucket.Close()
+
+	docs, docErrs = filterExpressionGetDocsWithGetter(docIds, func(docId string) ([]byte, error) {
+		return u.filterExpressionGetDocToBeFiltered(bucket, expression, docId)
+	})
+	return
+}
+
+// retrieves each of docIds with getDoc and sorts the results into retrieved docs and per document errors
+func filterExpressionGetDocsWithGetter(docIds []string, getDoc func(docId string) ([]byte, error)) (docs map[string][]byte, docErrs map[string]error) {
+	docs = make(map[string][]byte)
+	docErrs = make(map[string]error)
+	for _, docId := range docIds {
+		bodySlice, docErr := getDoc(docId)
+		if docErr != nil {
+			docErrs[docId] = docErr
+		} else {
+			docs[docId] = bodySlice
+		}
+	}
+	return
+}
+
+func filterExpressionOpenBucket(username, password, bucketName, addr string, port uint16) (*gocb.Bucket, error) {
+	cluster, err := gocb.Connect(fmt.Sprintf("http://%v:%v", addr, port))
+	if err != nil {
+		return nil, err
+	}
 
 	cluster.Authenticate(gocb.PasswordAuthenticator{
 		Username: username,
 		Password: password,
 	})
 
-	bucket, err := cluster.OpenBucket(bucketName, "")
-	if err != nil {
-		return
-	}
+	return cluster.OpenBucket(bucketName, "")
+}
+
+func (u *Utilities) filterExpressionGetDocToBeFiltered(bucket *gocb.Bucket, expression, docId string) (bodySlice []byte, err error) {
+	var docCas gocb.Cas
 
 	retrieveRetryOp := func() ([]byte, error) {
 		bodySlice, docCas, err = filterExpressionGetDocVal(bucket, docId)
@@ -416,17 +467,9 @@ func (u *Utilities) FilterExpressionMatchesDoc(expression, docId, username, pass
 		if strings.Contains(err.Error(), base.ErrorInvalidCAS.Error()) {
 			err = fmt.Errorf("Unable to successfully retrieve document %v because it keeps mutating", docId)
 		}
-		return
-	}
-
-	matcher, err := gojsonsm.GetFilterExpressionMatcher(base.ReplaceKeyWordsForExpression(expression))
-	if err != nil {
-		err = fmt.Errorf("Error filtering doc %v ID: %v", docId, err.Error())
-		return
+		return nil, err
 	}
-
-	result, err = matcher.Match(bodySlice)
-	return
+	return bodySlice, nil
 }
 
 // given a matches map, convert the indices from byte index to rune index
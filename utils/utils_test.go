@@ -692,3 +692,31 @@ func TestDataPool(t *testing.T) {
 
 	fmt.Println("============== Test case start: TestDataPool =================")
 }
+
+func TestFilterExpressionGetDocsWithGetter(t *testing.T) {
+	fmt.Println("============== Test case start: TestFilterExpressionGetDocsWithGetter =================")
+	assert := assert.New(t)
+
+	getErr := fmt.Errorf("document not found")
+	getDoc := func(docId string) ([]byte, error) {
+		if docId == "missing" {
+			return nil, getErr
+		}
+		return []byte(fmt.Sprintf(`{"id":"%v"}`, docId)), nil
+	}
+
+	docs, docErrs := filterExpressionGetDocsWithGetter([]string{"doc1", "missing", "doc2"}, getDoc)
+	assert.Equal(2, len(docs))
+	assert.Equal([]byte(`{"id":"doc1"}`), docs["doc1"])
+	assert.Equal([]byte(`{"id":"doc2"}`), docs["doc2"])
+	assert.Equal(1, len(docErrs))
+	assert.Equal(getErr, docErrs["missing"])
+	_, exists := docs["missing"]
+	assert.False(exists)
+
+	docs, docErrs = filterExpressionGetDocsWithGetter(nil, getDoc)
+	assert.Equal(0, len(docs))
+	assert.Equal(0, len(docErrs))
+
+	fmt.Println("============== Test case end: TestFilterExpressionGetDocsWithGetter =================")
+}